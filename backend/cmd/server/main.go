@@ -37,8 +37,20 @@ func main() {
 
 	log.Printf("Database initialized successfully (%s)", cfg.Database.Type)
 
+	// Encrypt designated tags at rest
+	if cfg.IPAM.EncryptionKey != "" {
+		encryptor, err := repository.NewFieldEncryptor(cfg.IPAM.EncryptionKey, cfg.IPAM.EncryptedTags)
+		if err != nil {
+			log.Fatalf("Failed to initialize tag encryption: %v", err)
+		}
+		repo = repository.NewEncryptingRepository(repo, encryptor)
+		log.Printf("Tag encryption enabled for %d tag keys", len(cfg.IPAM.EncryptedTags))
+	}
+
 	// Initialize IP service
-	ipService := service.NewGoIPAMService()
+	ipService := service.NewGoIPAMServiceWithOptions(service.IPServiceOptions{
+		IncludeNetworkBroadcast: cfg.IPAM.IncludeNetworkBroadcast,
+	})
 	log.Println("IP service initialized")
 
 	// Initialize cloud provider manager
@@ -53,11 +65,49 @@ func main() {
 	defer cloudManager.Stop()
 
 	// Initialize service layer
-	serviceLayer := service.NewServiceLayer(repo, ipService, cloudManager)
+	idempotencyKeyTTL, err := cfg.IPAM.GetIdempotencyKeyTTL()
+	if err != nil {
+		log.Fatalf("Invalid idempotency key TTL: %v", err)
+	}
+	var connectionMetadataSchema map[string]string
+	if cfg.IPAM.ConnectionMetadata.Enforce {
+		// An enforced schema without keys allows no metadata at all
+		connectionMetadataSchema = make(map[string]string, len(cfg.IPAM.ConnectionMetadata.AllowedKeys))
+		for key, keyType := range cfg.IPAM.ConnectionMetadata.AllowedKeys {
+			connectionMetadataSchema[key] = keyType
+		}
+	}
+	serviceLayer := service.NewServiceLayerWithOptions(repo, ipService, cloudManager, service.ServiceOptions{
+		MaxTagsPerSubnet:          cfg.IPAM.MaxTagsPerSubnet,
+		AllowedEnvironments:       cfg.IPAM.Environments,
+		MaxSplitSubnets:           cfg.IPAM.MaxSplitSubnets,
+		AllowSiblingOverlap:       cfg.IPAM.AllowSiblingOverlap,
+		UndirectedConnectionTypes: cfg.IPAM.UndirectedConnectionTypes,
+		IdempotencyKeyTTL:         idempotencyKeyTTL,
+		ConnectionMetadataSchema:  connectionMetadataSchema,
+		MaxUtilizationSamples:     cfg.IPAM.UtilizationHistory.MaxSamples,
+	})
 	log.Println("Service layer initialized")
 
+	// Start utilization history downsampling
+	historyCompactor, err := newHistoryCompactor(cfg, serviceLayer)
+	if err != nil {
+		log.Fatalf("Failed to configure utilization history compaction: %v", err)
+	}
+	historyCompactor.Start(ctx)
+	defer historyCompactor.Stop()
+
+	// Start deleting subnets whose TTL has passed
+	expiryInterval, err := cfg.IPAM.GetSubnetExpiryInterval()
+	if err != nil {
+		log.Fatalf("Invalid subnet expiry interval: %v", err)
+	}
+	expiryReconciler := service.NewExpiryReconciler(serviceLayer, expiryInterval)
+	expiryReconciler.Start(ctx)
+	defer expiryReconciler.Stop()
+
 	// Initialize REST gateway with cloud manager
-	gatewayHandler := gateway.NewGateway(serviceLayer, cloudManager)
+	gatewayHandler := gateway.NewGatewayWithConfig(serviceLayer, cloudManager, cfg)
 	log.Println("REST gateway initialized")
 
 	// Start HTTP server
@@ -80,7 +130,10 @@ func loadConfiguration() (*config.Config, error) {
 	// Check if config file exists
 	if _, err := os.Stat(configPath); err == nil {
 		log.Printf("Loading configuration from file: %s", configPath)
-		return config.LoadConfig(configPath)
+		// CONFIG_FALLBACK_TO_ENV=true starts from environment variables
+		// instead of failing when the file is malformed
+		fallbackToEnv := os.Getenv("CONFIG_FALLBACK_TO_ENV") == "true"
+		return config.LoadConfigWithFallback(configPath, fallbackToEnv)
 	}
 
 	// Fall back to environment variables
@@ -94,3 +147,26 @@ func loadConfiguration() (*config.Config, error) {
 
 	return cfg, nil
 }
+
+// newHistoryCompactor builds the utilization history compactor from configuration
+func newHistoryCompactor(cfg *config.Config, serviceLayer *service.ServiceLayer) (*service.HistoryCompactor, error) {
+	historyConfig := &cfg.IPAM.UtilizationHistory
+
+	interval, err := historyConfig.GetCompactionInterval()
+	if err != nil {
+		return nil, err
+	}
+	minuteRetention, err := historyConfig.GetMinuteRetention()
+	if err != nil {
+		return nil, err
+	}
+	hourlyRetention, err := historyConfig.GetHourlyRetention()
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewHistoryCompactor(serviceLayer, interval, service.HistoryRetention{
+		MinuteRetention: minuteRetention,
+		HourlyRetention: hourlyRetention,
+	}), nil
+}
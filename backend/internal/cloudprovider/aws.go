@@ -2,21 +2,37 @@ package cloudprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider/aws"
 )
 
 // AWSProvider implements the CloudProvider interface for Amazon Web Services
 type AWSProvider struct {
-	name string
+	name      string
+	newClient func(ctx context.Context, cfg aws.AWSConfig) (*aws.Client, error)
+	// regionClient, when set, supplies already authenticated clients per region
+	// so no static keys are needed in the credentials
+	regionClient func(region string) (*aws.Client, error)
 }
 
 // NewAWSProvider creates a new AWS cloud provider instance
 func NewAWSProvider() *AWSProvider {
 	return &AWSProvider{
-		name: "Amazon Web Services",
+		name:      "Amazon Web Services",
+		newClient: aws.NewClient,
 	}
 }
 
+// NewAWSProviderWithClients creates an AWS provider that fetches through
+// clients that were authenticated elsewhere, looked up by region
+func NewAWSProviderWithClients(regionClient func(region string) (*aws.Client, error)) *AWSProvider {
+	provider := NewAWSProvider()
+	provider.regionClient = regionClient
+	return provider
+}
+
 // GetName returns the name of the cloud provider
 func (p *AWSProvider) GetName() string {
 	return p.name
@@ -27,17 +43,64 @@ func (p *AWSProvider) GetType() CloudProviderType {
 	return ProviderAWS
 }
 
-// FetchSubnets retrieves all subnets from AWS
-// This is a stub implementation - actual AWS SDK integration will be added in the future
+// FetchSubnets retrieves all subnets from AWS in the credentials' region
 func (p *AWSProvider) FetchSubnets(ctx context.Context, credentials CloudCredentials) ([]*CloudSubnet, error) {
-	// Validate credentials
-	if err := p.ValidateCredentials(ctx, credentials); err != nil {
-		return nil, err
+	// Validate credentials; pre-authenticated clients need no static keys
+	if p.regionClient == nil {
+		if err := p.ValidateCredentials(ctx, credentials); err != nil {
+			return nil, err
+		}
+	} else if credentials.Provider != ProviderAWS {
+		return nil, fmt.Errorf("invalid provider type: expected %s, got %s", ProviderAWS, credentials.Provider)
+	}
+
+	if credentials.Region == "" {
+		return nil, fmt.Errorf("%w: region is required to fetch AWS subnets", ErrInvalidCredentials)
+	}
+
+	client, err := p.client(ctx, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+
+	subnetInfos, err := client.ListSubnets(ctx)
+	if errors.Is(err, aws.ErrRateLimited) {
+		return nil, fmt.Errorf("%w: %v", ErrRateLimited, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
 	}
 
-	// TODO: Implement actual AWS SDK integration
-	// For now, return an error indicating the feature is not yet implemented
-	return nil, fmt.Errorf("%w: AWS subnet fetching not yet implemented", ErrProviderUnavailable)
+	// Subnets are still returned when the account ID cannot be resolved
+	accountID, _ := client.GetAccountID(ctx)
+
+	subnets := make([]*CloudSubnet, 0, len(subnetInfos))
+	for _, info := range subnetInfos {
+		subnets = append(subnets, &CloudSubnet{
+			ID:        info.ID,
+			CIDR:      info.CIDR,
+			Name:      info.Name,
+			Region:    info.Region,
+			AccountID: accountID,
+			VPCId:     info.VPCId,
+			Tags:      info.Tags,
+		})
+	}
+
+	return subnets, nil
+}
+
+// client returns the client to fetch with for the credentials' region
+func (p *AWSProvider) client(ctx context.Context, credentials CloudCredentials) (*aws.Client, error) {
+	if p.regionClient != nil {
+		return p.regionClient(credentials.Region)
+	}
+
+	return p.newClient(ctx, aws.AWSConfig{
+		Region:          credentials.Region,
+		AccessKeyID:     credentials.AccessKey,
+		SecretAccessKey: credentials.SecretKey,
+	})
 }
 
 // GetRegions returns the list of available AWS regions
@@ -60,6 +123,11 @@ func (p *AWSProvider) GetRegions() []string {
 	}
 }
 
+// Implemented reports that AWS subnets are fetched from the AWS API
+func (p *AWSProvider) Implemented() bool {
+	return true
+}
+
 // ValidateCredentials checks if the provided AWS credentials are valid
 func (p *AWSProvider) ValidateCredentials(ctx context.Context, credentials CloudCredentials) error {
 	if credentials.Provider != ProviderAWS {
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 // AWSConfig represents AWS configuration
@@ -17,12 +21,37 @@ type AWSConfig struct {
 	Region          string `yaml:"region"`
 	AccessKeyID     string `yaml:"access_key_id"`
 	SecretAccessKey string `yaml:"secret_access_key"`
+
+	// Throttled EC2 calls are retried up to MaxRetries times, waiting about
+	// RetryBaseDelay doubled after each attempt. Zero uses the defaults and a
+	// negative MaxRetries disables retries.
+	MaxRetries     int           `yaml:"max_retries"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay"`
+
+	// ExcludeDefaultVPC leaves the account's default VPC, and every subnet
+	// in it, out of ListVPCs and ListSubnets
+	ExcludeDefaultVPC bool `yaml:"exclude_default_vpc"`
+}
+
+// EC2API is the subset of the EC2 client used by Client, allowing tests to substitute a mock
+type EC2API interface {
+	DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error)
+	DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
+}
+
+// STSAPI is the subset of the STS client used by Client to resolve the account ID
+type STSAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
 }
 
 // Client represents an AWS client
 type Client struct {
-	ec2Client *ec2.Client
+	ec2Client EC2API
+	stsClient STSAPI
 	config    AWSConfig
+
+	accountMu sync.Mutex
+	accountID string
 }
 
 // VPCInfo represents VPC information
@@ -78,21 +107,67 @@ func NewClient(ctx context.Context, awsConfig AWSConfig) (*Client, error) {
 
 	return &Client{
 		ec2Client: ec2.NewFromConfig(cfg),
+		stsClient: sts.NewFromConfig(cfg),
 		config:    awsConfig,
 	}, nil
 }
 
-// ListVPCs retrieves all VPCs in the configured region
+// NewClientWithEC2 creates a client backed by the given EC2 API implementation.
+// The client has no STS access, so GetAccountID returns an error.
+func NewClientWithEC2(ec2Client EC2API, awsConfig AWSConfig) *Client {
+	return NewClientWithAPIs(ec2Client, nil, awsConfig)
+}
+
+// NewClientWithAPIs creates a client backed by the given EC2 and STS API implementations
+func NewClientWithAPIs(ec2Client EC2API, stsClient STSAPI, awsConfig AWSConfig) *Client {
+	return &Client{
+		ec2Client: ec2Client,
+		stsClient: stsClient,
+		config:    awsConfig,
+	}
+}
+
+// ListVPCs retrieves all VPCs in the configured region, following every
+// result page. The default VPC is left out when ExcludeDefaultVPC is set.
 func (c *Client) ListVPCs(ctx context.Context) ([]VPCInfo, error) {
-	input := &ec2.DescribeVpcsInput{}
+	vpcs, err := c.describeVPCs(ctx)
+	if err != nil || !c.config.ExcludeDefaultVPC {
+		return vpcs, err
+	}
 
-	result, err := c.ec2Client.DescribeVpcs(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to describe VPCs: %w", err)
+	var included []VPCInfo
+	for _, vpc := range vpcs {
+		if vpc.IsDefault {
+			continue
+		}
+		included = append(included, vpc)
+	}
+	return included, nil
+}
+
+// describeVPCs retrieves every VPC in the configured region, default or not
+func (c *Client) describeVPCs(ctx context.Context) ([]VPCInfo, error) {
+	var results []types.Vpc
+	paginator := ec2.NewDescribeVpcsPaginator(c.ec2Client, &ec2.DescribeVpcsInput{})
+	for paginator.HasMorePages() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// A failed page leaves the paginator's token alone, so it can be retried
+		var page *ec2.DescribeVpcsOutput
+		err := c.retryThrottled(ctx, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe VPCs: %w", err)
+		}
+		results = append(results, page.Vpcs...)
 	}
 
 	var vpcs []VPCInfo
-	for _, vpc := range result.Vpcs {
+	for _, vpc := range results {
 		vpcInfo := VPCInfo{
 			ID:        aws.ToString(vpc.VpcId),
 			CIDR:      aws.ToString(vpc.CidrBlock),
@@ -120,17 +195,47 @@ func (c *Client) ListVPCs(ctx context.Context) ([]VPCInfo, error) {
 	return vpcs, nil
 }
 
-// ListSubnets retrieves all subnets in the configured region
+// ListSubnets retrieves all subnets in the configured region, following every
+// result page. Subnets of the default VPC are left out when ExcludeDefaultVPC
+// is set, which costs an extra DescribeVpcs call to find it.
 func (c *Client) ListSubnets(ctx context.Context) ([]SubnetInfo, error) {
-	input := &ec2.DescribeSubnetsInput{}
+	excludedVPCs := make(map[string]bool)
+	if c.config.ExcludeDefaultVPC {
+		vpcs, err := c.describeVPCs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, vpc := range vpcs {
+			if vpc.IsDefault {
+				excludedVPCs[vpc.ID] = true
+			}
+		}
+	}
 
-	result, err := c.ec2Client.DescribeSubnets(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to describe subnets: %w", err)
+	var results []types.Subnet
+	paginator := ec2.NewDescribeSubnetsPaginator(c.ec2Client, &ec2.DescribeSubnetsInput{})
+	for paginator.HasMorePages() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var page *ec2.DescribeSubnetsOutput
+		err := c.retryThrottled(ctx, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe subnets: %w", err)
+		}
+		results = append(results, page.Subnets...)
 	}
 
 	var subnets []SubnetInfo
-	for _, subnet := range result.Subnets {
+	for _, subnet := range results {
+		if excludedVPCs[aws.ToString(subnet.VpcId)] {
+			continue
+		}
+
 		subnetInfo := SubnetInfo{
 			ID:               aws.ToString(subnet.SubnetId),
 			CIDR:             aws.ToString(subnet.CidrBlock),
@@ -166,7 +271,11 @@ func (c *Client) GetSubnetUtilization(ctx context.Context, subnetID string) (flo
 		SubnetIds: []string{subnetID},
 	}
 
-	result, err := c.ec2Client.DescribeSubnets(ctx, input)
+	var result *ec2.DescribeSubnetsOutput
+	err := c.retryThrottled(ctx, func() (err error) {
+		result, err = c.ec2Client.DescribeSubnets(ctx, input)
+		return err
+	})
 	if err != nil {
 		return 0, fmt.Errorf("failed to describe subnet %s: %w", subnetID, err)
 	}
@@ -214,6 +323,34 @@ func (c *Client) ValidateCredentials(ctx context.Context) error {
 	return nil
 }
 
+// GetAccountID returns the AWS account ID of the configured credentials.
+// The ID is resolved through STS GetCallerIdentity on first use and cached.
+func (c *Client) GetAccountID(ctx context.Context) (string, error) {
+	c.accountMu.Lock()
+	defer c.accountMu.Unlock()
+
+	if c.accountID != "" {
+		return c.accountID, nil
+	}
+
+	if c.stsClient == nil {
+		return "", fmt.Errorf("STS client is not configured")
+	}
+
+	result, err := c.stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	accountID := aws.ToString(result.Account)
+	if accountID == "" {
+		return "", fmt.Errorf("caller identity did not include an account ID")
+	}
+
+	c.accountID = accountID
+	return accountID, nil
+}
+
 // GetRegion returns the configured region
 func (c *Client) GetRegion() string {
 	return c.config.Region
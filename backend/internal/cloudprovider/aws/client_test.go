@@ -0,0 +1,94 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// pagedEC2 serves VPCs and subnets one page at a time, keyed by NextToken
+type pagedEC2 struct {
+	vpcPages    [][]ec2types.Vpc
+	subnetPages [][]ec2types.Subnet
+	calls       int
+}
+
+// pagedToken returns the index of the page requested by token and the token of the page after it
+func pagedToken(token *string, pages int) (int, *string) {
+	index := 0
+	if token != nil {
+		fmt.Sscanf(*token, "page-%d", &index)
+	}
+	if index+1 < pages {
+		return index, aws.String(fmt.Sprintf("page-%d", index+1))
+	}
+	return index, nil
+}
+
+func (m *pagedEC2) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	m.calls++
+	index, next := pagedToken(params.NextToken, len(m.vpcPages))
+	return &ec2.DescribeVpcsOutput{Vpcs: m.vpcPages[index], NextToken: next}, nil
+}
+
+func (m *pagedEC2) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	m.calls++
+	index, next := pagedToken(params.NextToken, len(m.subnetPages))
+	return &ec2.DescribeSubnetsOutput{Subnets: m.subnetPages[index], NextToken: next}, nil
+}
+
+func TestClientListsEveryPage(t *testing.T) {
+	ctx := context.Background()
+	api := &pagedEC2{
+		vpcPages: [][]ec2types.Vpc{
+			{{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.1.0.0/16")}},
+			{{VpcId: aws.String("vpc-2"), CidrBlock: aws.String("10.2.0.0/16")}},
+		},
+		subnetPages: [][]ec2types.Subnet{
+			{
+				{SubnetId: aws.String("subnet-1"), CidrBlock: aws.String("10.1.1.0/24"), VpcId: aws.String("vpc-1")},
+				{SubnetId: aws.String("subnet-2"), CidrBlock: aws.String("10.1.2.0/24"), VpcId: aws.String("vpc-1")},
+			},
+			{
+				{SubnetId: aws.String("subnet-3"), CidrBlock: aws.String("10.2.1.0/24"), VpcId: aws.String("vpc-2")},
+			},
+		},
+	}
+	client := NewClientWithEC2(api, AWSConfig{Region: "eu-west-1"})
+
+	vpcs, err := client.ListVPCs(ctx)
+	if err != nil {
+		t.Fatalf("ListVPCs failed: %v", err)
+	}
+	var vpcIDs []string
+	for _, vpc := range vpcs {
+		vpcIDs = append(vpcIDs, vpc.ID)
+	}
+	if want := []string{"vpc-1", "vpc-2"}; !reflect.DeepEqual(vpcIDs, want) || api.calls != 2 {
+		t.Errorf("Expected VPCs %v from 2 calls, got %v from %d", want, vpcIDs, api.calls)
+	}
+
+	api.calls = 0
+	subnets, err := client.ListSubnets(ctx)
+	if err != nil {
+		t.Fatalf("ListSubnets failed: %v", err)
+	}
+	var subnetIDs []string
+	for _, subnet := range subnets {
+		subnetIDs = append(subnetIDs, subnet.ID)
+	}
+	if want := []string{"subnet-1", "subnet-2", "subnet-3"}; !reflect.DeepEqual(subnetIDs, want) || api.calls != 2 {
+		t.Errorf("Expected subnets %v from 2 calls, got %v from %d", want, subnetIDs, api.calls)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.ListSubnets(canceled); err == nil {
+		t.Error("Expected ListSubnets to stop on a canceled context")
+	}
+}
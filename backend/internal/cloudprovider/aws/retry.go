@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// ErrRateLimited is returned when AWS keeps throttling a call after every retry
+var ErrRateLimited = errors.New("rate limited by AWS")
+
+const (
+	// DefaultMaxRetries is used when AWSConfig.MaxRetries is zero
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBaseDelay is used when AWSConfig.RetryBaseDelay is zero
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+
+	// maxRetryDelay caps the exponential backoff between two attempts
+	maxRetryDelay = 20 * time.Second
+)
+
+// retryThrottled runs call, retrying with exponential backoff and jitter while
+// AWS throttles it. Other errors are returned straight away, and throttling
+// that outlasts the configured retries is reported as ErrRateLimited.
+func (c *Client) retryThrottled(ctx context.Context, call func() error) error {
+	maxRetries := c.config.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	baseDelay := c.config.RetryBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !isThrottled(err) {
+			return err
+		}
+		if attempt >= maxRetries {
+			return fmt.Errorf("%w after %d retries: %v", ErrRateLimited, attempt, err)
+		}
+
+		timer := time.NewTimer(backoffDelay(baseDelay, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoffDelay returns the wait before retry number attempt (counted from 0):
+// a random delay between half and all of baseDelay * 2^attempt, capped at
+// maxRetryDelay, so concurrent syncs do not retry in lockstep
+func backoffDelay(baseDelay time.Duration, attempt int) time.Duration {
+	delay := baseDelay
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isThrottled reports whether err carries one of the AWS throttling error
+// codes, such as RequestLimitExceeded
+func isThrottled(err error) bool {
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// apiError mimics the smithy errors returned by the EC2 client
+type apiError struct {
+	code string
+}
+
+func (e *apiError) Error() string     { return "api error " + e.code }
+func (e *apiError) ErrorCode() string { return e.code }
+
+// throttlingEC2 fails the first failures calls with err before delegating to mockEC2
+type throttlingEC2 struct {
+	mockEC2
+	failures int
+	err      error
+	calls    int
+}
+
+func (m *throttlingEC2) fail() error {
+	m.calls++
+	if m.calls <= m.failures {
+		return m.err
+	}
+	return nil
+}
+
+func (m *throttlingEC2) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	if err := m.fail(); err != nil {
+		return nil, err
+	}
+	return m.mockEC2.DescribeVpcs(ctx, params, optFns...)
+}
+
+func (m *throttlingEC2) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	if err := m.fail(); err != nil {
+		return nil, err
+	}
+	return m.mockEC2.DescribeSubnets(ctx, params, optFns...)
+}
+
+func TestClientRetriesThrottledCalls(t *testing.T) {
+	ctx := context.Background()
+	throttled := &apiError{code: "RequestLimitExceeded"}
+	subnets := []ec2types.Subnet{{
+		SubnetId:                aws.String("subnet-1"),
+		CidrBlock:               aws.String("10.1.1.0/24"),
+		VpcId:                   aws.String("vpc-1"),
+		AvailableIpAddressCount: aws.Int32(251),
+	}}
+	newClient := func(api *throttlingEC2, maxRetries int) *Client {
+		api.subnets = subnets
+		api.vpcs = []ec2types.Vpc{{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.1.0.0/16")}}
+		return NewClientWithEC2(api, AWSConfig{Region: "eu-west-1", MaxRetries: maxRetries, RetryBaseDelay: time.Millisecond})
+	}
+
+	t.Run("succeeds after two throttled attempts", func(t *testing.T) {
+		api := &throttlingEC2{failures: 2, err: throttled}
+		result, err := newClient(api, 3).ListSubnets(ctx)
+		if err != nil {
+			t.Fatalf("ListSubnets failed: %v", err)
+		}
+		if len(result) != 1 || api.calls != 3 {
+			t.Errorf("Expected 1 subnet after 3 calls, got %d after %d", len(result), api.calls)
+		}
+
+		api = &throttlingEC2{failures: 2, err: throttled}
+		if _, err := newClient(api, 3).ListVPCs(ctx); err != nil || api.calls != 3 {
+			t.Errorf("Expected ListVPCs to succeed on the third call, got %v after %d", err, api.calls)
+		}
+
+		api = &throttlingEC2{failures: 2, err: throttled}
+		if _, err := newClient(api, 3).GetSubnetUtilization(ctx, "subnet-1"); err != nil || api.calls != 3 {
+			t.Errorf("Expected GetSubnetUtilization to succeed on the third call, got %v after %d", err, api.calls)
+		}
+	})
+
+	t.Run("reports ErrRateLimited once retries run out", func(t *testing.T) {
+		api := &throttlingEC2{failures: 5, err: throttled}
+		_, err := newClient(api, 2).ListSubnets(ctx)
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("Expected ErrRateLimited, got %v", err)
+		}
+		if api.calls != 3 {
+			t.Errorf("Expected 3 calls, got %d", api.calls)
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		api := &throttlingEC2{failures: 1, err: &apiError{code: "UnauthorizedOperation"}}
+		_, err := newClient(api, 3).ListSubnets(ctx)
+		if err == nil || errors.Is(err, ErrRateLimited) || api.calls != 1 {
+			t.Errorf("Expected a single failed call, got %v after %d", err, api.calls)
+		}
+	})
+
+	t.Run("negative MaxRetries disables retries", func(t *testing.T) {
+		api := &throttlingEC2{failures: 1, err: throttled}
+		_, err := newClient(api, -1).ListSubnets(ctx)
+		if !errors.Is(err, ErrRateLimited) || api.calls != 1 {
+			t.Errorf("Expected ErrRateLimited after one call, got %v after %d", err, api.calls)
+		}
+	})
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		delay := backoffDelay(100*time.Millisecond, attempt)
+		if delay < want/2 || delay > want {
+			t.Errorf("Attempt %d: expected a delay between %s and %s, got %s", attempt, want/2, want, delay)
+		}
+	}
+	if delay := backoffDelay(time.Hour, 100); delay > maxRetryDelay {
+		t.Errorf("Expected the delay to be capped at %s, got %s", maxRetryDelay, delay)
+	}
+}
@@ -6,14 +6,70 @@ import (
 	"log"
 	"time"
 
+	"github.com/bananaops/ipam-bananaops/internal/netutil"
 	"github.com/bananaops/ipam-bananaops/internal/repository"
 	"github.com/google/uuid"
 )
 
 // SyncService handles synchronization of AWS resources with IPAM
 type SyncService struct {
-	client     *Client
-	repository repository.SubnetRepository
+	client          *Client
+	repository      repository.SubnetRepository
+	overwriteManual bool
+}
+
+// SyncStats counts what a synchronization did. Errors counts resources that
+// could not be stored as well as regions or providers that failed to sync;
+// Failures describes them, up to MaxSyncFailures.
+type SyncStats struct {
+	VPCsCreated    int
+	SubnetsCreated int
+	SubnetsUpdated int
+	SubnetsSkipped int
+	Errors         int
+	Failures       []SyncFailure
+}
+
+// MaxSyncFailures caps the failures kept in SyncStats, so a sync in which
+// every resource fails does not hold thousands of messages; Errors still
+// counts them all
+const MaxSyncFailures = 100
+
+// SyncFailure describes a resource, or a whole region or provider, that a
+// synchronization could not store
+type SyncFailure struct {
+	Provider   string
+	Region     string
+	ResourceID string // Empty when a whole region or provider failed
+	CIDR       string
+	Error      string
+}
+
+// Synced returns the number of resources created or updated
+func (s *SyncStats) Synced() int {
+	return s.VPCsCreated + s.SubnetsCreated + s.SubnetsUpdated
+}
+
+// Fail counts a failure and records its description
+func (s *SyncStats) Fail(failure SyncFailure) {
+	s.Errors++
+	if len(s.Failures) < MaxSyncFailures {
+		s.Failures = append(s.Failures, failure)
+	}
+}
+
+// Add accumulates other into s
+func (s *SyncStats) Add(other *SyncStats) {
+	if other == nil {
+		return
+	}
+	s.VPCsCreated += other.VPCsCreated
+	s.SubnetsCreated += other.SubnetsCreated
+	s.SubnetsUpdated += other.SubnetsUpdated
+	s.SubnetsSkipped += other.SubnetsSkipped
+	s.Errors += other.Errors
+	room := MaxSyncFailures - len(s.Failures)
+	s.Failures = append(s.Failures, other.Failures[:min(room, len(other.Failures))]...)
 }
 
 // NewSyncService creates a new AWS sync service
@@ -24,22 +80,60 @@ func NewSyncService(client *Client, repo repository.SubnetRepository) *SyncServi
 	}
 }
 
+// SetOverwriteManual controls whether an AWS subnet whose CIDR matches a
+// manually created subnet takes it over. When false such subnets are skipped.
+func (s *SyncService) SetOverwriteManual(overwrite bool) {
+	s.overwriteManual = overwrite
+}
+
 // SyncVPCs synchronizes VPCs from AWS to IPAM
-func (s *SyncService) SyncVPCs(ctx context.Context) error {
+func (s *SyncService) SyncVPCs(ctx context.Context) (*SyncStats, error) {
 	log.Printf("Starting VPC synchronization for region: %s", s.client.GetRegion())
 
 	vpcs, err := s.client.ListVPCs(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list VPCs: %w", err)
+		return nil, fmt.Errorf("failed to list VPCs: %w", err)
 	}
 
 	log.Printf("Found %d VPCs in AWS", len(vpcs))
 
+	accountID := s.accountID(ctx)
+	stats := &SyncStats{}
+
+	syncedVPCs, err := s.loadVPCs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, vpc := range vpcs {
+		vpc.CIDR = netutil.NormalizeCIDR("aws", vpc.ID, vpc.CIDR)
+
 		// Check if VPC already exists in IPAM
+		if _, ok := syncedVPCs[vpcKey{accountID: accountID, vpcID: vpc.ID}]; ok {
+			log.Printf("VPC %s (%s) already exists in IPAM, skipping", vpc.ID, vpc.CIDR)
+			continue
+		}
+
+		// CIDRs are unique in IPAM, so a VPC whose CIDR is already recorded
+		// cannot get an entry of its own. When that entry is this VPC, synced
+		// before its account ID could be resolved, the account is backfilled.
 		existingSubnet, err := s.repository.GetSubnetByCIDR(ctx, vpc.CIDR)
 		if err == nil && existingSubnet != nil {
-			log.Printf("VPC %s (%s) already exists in IPAM, skipping", vpc.ID, vpc.CIDR)
+			info := existingSubnet.CloudInfo
+			if info == nil || info.Provider != "aws" || info.ResourceType != "vpc" || info.VPCId != vpc.ID || info.AccountID != "" || accountID == "" {
+				log.Printf("Skipping VPC %s: CIDR %s is already recorded as subnet %s", vpc.ID, vpc.CIDR, existingSubnet.ID)
+				continue
+			}
+
+			info.AccountID = accountID
+			existingSubnet.UpdatedAt = time.Now()
+			if err := s.repository.UpdateSubnet(ctx, existingSubnet.ID, existingSubnet); err != nil {
+				log.Printf("Failed to record the account of VPC %s in IPAM: %v", vpc.ID, err)
+				stats.Fail(SyncFailure{Provider: "aws", Region: vpc.Region, ResourceID: vpc.ID, CIDR: vpc.CIDR, Error: err.Error()})
+				continue
+			}
+			log.Printf("Recorded account %s for VPC %s (%s)", accountID, vpc.ID, vpc.CIDR)
+			syncedVPCs[vpcKey{accountID: accountID, vpcID: vpc.ID}] = existingSubnet
 			continue
 		}
 
@@ -53,7 +147,7 @@ func (s *SyncService) SyncVPCs(ctx context.Context) error {
 			CloudInfo: &repository.CloudInfo{
 				Provider:     "aws",
 				Region:       vpc.Region,
-				AccountID:    "", // Will be populated if available
+				AccountID:    accountID,
 				ResourceType: "vpc",
 				VPCId:        vpc.ID,
 				SubnetId:     "", // Empty for VPC entries
@@ -70,35 +164,56 @@ func (s *SyncService) SyncVPCs(ctx context.Context) error {
 		err = s.repository.CreateSubnet(ctx, subnet)
 		if err != nil {
 			log.Printf("Failed to create VPC %s in IPAM: %v", vpc.ID, err)
+			stats.Fail(SyncFailure{Provider: "aws", Region: vpc.Region, ResourceID: vpc.ID, CIDR: vpc.CIDR, Error: err.Error()})
 			continue
 		}
 
+		stats.VPCsCreated++
+		syncedVPCs[vpcKey{accountID: accountID, vpcID: vpc.ID}] = subnet
 		log.Printf("Successfully synchronized VPC %s (%s) to IPAM", vpc.ID, vpc.CIDR)
 	}
 
-	return nil
+	return stats, nil
 }
 
-// SyncSubnets synchronizes subnets from AWS to IPAM
-func (s *SyncService) SyncSubnets(ctx context.Context) error {
+// SyncSubnets synchronizes subnets from AWS to IPAM. A CIDR already recorded
+// as a manual subnet is left untouched unless overwriteManual is set.
+func (s *SyncService) SyncSubnets(ctx context.Context) (*SyncStats, error) {
 	log.Printf("Starting subnet synchronization for region: %s", s.client.GetRegion())
 
 	subnets, err := s.client.ListSubnets(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list subnets: %w", err)
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
 	}
 
 	log.Printf("Found %d subnets in AWS", len(subnets))
 
+	accountID := s.accountID(ctx)
+	stats := &SyncStats{}
+
+	syncedVPCs, err := s.loadVPCs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, awsSubnet := range subnets {
+		awsSubnet.CIDR = netutil.NormalizeCIDR("aws", awsSubnet.ID, awsSubnet.CIDR)
+
 		// Check if subnet already exists in IPAM
 		existingSubnet, err := s.repository.GetSubnetByCIDR(ctx, awsSubnet.CIDR)
 		if err == nil && existingSubnet != nil {
+			if existingSubnet.LocationType != "cloud" && !s.overwriteManual {
+				log.Printf("Skipping AWS subnet %s: CIDR %s is already managed manually as subnet %s (%s)",
+					awsSubnet.ID, awsSubnet.CIDR, existingSubnet.ID, existingSubnet.LocationType)
+				stats.SubnetsSkipped++
+				continue
+			}
+
 			// Update existing subnet with AWS information
 			existingSubnet.CloudInfo = &repository.CloudInfo{
 				Provider:     "aws",
 				Region:       awsSubnet.Region,
-				AccountID:    "", // Will be populated if available
+				AccountID:    accountID,
 				ResourceType: "subnet",
 				VPCId:        awsSubnet.VPCId,
 				SubnetId:     awsSubnet.ID,
@@ -108,7 +223,7 @@ func (s *SyncService) SyncSubnets(ctx context.Context) error {
 			existingSubnet.UpdatedAt = time.Now()
 
 			// Find parent VPC
-			if parentVPC, err := s.findParentVPC(ctx, awsSubnet.VPCId); err == nil && parentVPC != nil {
+			if parentVPC, ok := syncedVPCs[vpcKey{accountID: accountID, vpcID: awsSubnet.VPCId}]; ok {
 				existingSubnet.ParentID = parentVPC.ID
 			}
 
@@ -119,9 +234,11 @@ func (s *SyncService) SyncSubnets(ctx context.Context) error {
 			err = s.repository.UpdateSubnet(ctx, existingSubnet.ID, existingSubnet)
 			if err != nil {
 				log.Printf("Failed to update subnet %s in IPAM: %v", awsSubnet.ID, err)
+				stats.Fail(SyncFailure{Provider: "aws", Region: awsSubnet.Region, ResourceID: awsSubnet.ID, CIDR: awsSubnet.CIDR, Error: err.Error()})
 				continue
 			}
 
+			stats.SubnetsUpdated++
 			log.Printf("Updated existing subnet %s (%s) with AWS information", awsSubnet.ID, awsSubnet.CIDR)
 			continue
 		}
@@ -143,7 +260,7 @@ func (s *SyncService) SyncSubnets(ctx context.Context) error {
 			CloudInfo: &repository.CloudInfo{
 				Provider:     "aws",
 				Region:       awsSubnet.Region,
-				AccountID:    "", // Will be populated if available
+				AccountID:    accountID,
 				ResourceType: "subnet",
 				VPCId:        awsSubnet.VPCId,
 				SubnetId:     awsSubnet.ID,
@@ -157,7 +274,7 @@ func (s *SyncService) SyncSubnets(ctx context.Context) error {
 		}
 
 		// Find parent VPC
-		if parentVPC, err := s.findParentVPC(ctx, awsSubnet.VPCId); err == nil && parentVPC != nil {
+		if parentVPC, ok := syncedVPCs[vpcKey{accountID: accountID, vpcID: awsSubnet.VPCId}]; ok {
 			subnet.ParentID = parentVPC.ID
 		}
 
@@ -169,31 +286,40 @@ func (s *SyncService) SyncSubnets(ctx context.Context) error {
 		err = s.repository.CreateSubnet(ctx, subnet)
 		if err != nil {
 			log.Printf("Failed to create subnet %s in IPAM: %v", awsSubnet.ID, err)
+			stats.Fail(SyncFailure{Provider: "aws", Region: awsSubnet.Region, ResourceID: awsSubnet.ID, CIDR: awsSubnet.CIDR, Error: err.Error()})
 			continue
 		}
 
+		stats.SubnetsCreated++
+		s.recordUtilization(ctx, subnet.ID, utilization)
 		log.Printf("Successfully synchronized subnet %s (%s) to IPAM", awsSubnet.ID, awsSubnet.CIDR)
 	}
 
-	return nil
+	log.Printf("Subnet synchronization for region %s: %d created, %d updated, %d skipped, %d failed",
+		s.client.GetRegion(), stats.SubnetsCreated, stats.SubnetsUpdated, stats.SubnetsSkipped, stats.Errors)
+
+	return stats, nil
 }
 
 // SyncAll synchronizes both VPCs and subnets
-func (s *SyncService) SyncAll(ctx context.Context) error {
+func (s *SyncService) SyncAll(ctx context.Context) (*SyncStats, error) {
 	log.Printf("Starting full AWS synchronization for region: %s", s.client.GetRegion())
 
 	// First sync VPCs
-	if err := s.SyncVPCs(ctx); err != nil {
-		return fmt.Errorf("failed to sync VPCs: %w", err)
+	stats, err := s.SyncVPCs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync VPCs: %w", err)
 	}
 
 	// Then sync subnets
-	if err := s.SyncSubnets(ctx); err != nil {
-		return fmt.Errorf("failed to sync subnets: %w", err)
+	subnetStats, err := s.SyncSubnets(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("failed to sync subnets: %w", err)
 	}
+	stats.Add(subnetStats)
 
 	log.Printf("Successfully completed AWS synchronization for region: %s", s.client.GetRegion())
-	return nil
+	return stats, nil
 }
 
 // UpdateUtilization updates utilization data for all AWS subnets
@@ -219,15 +345,7 @@ func (s *SyncService) UpdateUtilization(ctx context.Context) error {
 			continue
 		}
 
-		// Update utilization
-		subnet.Utilization = &repository.Utilization{
-			UtilizationPercent: utilization,
-			LastUpdated:        time.Now(),
-		}
-		subnet.UpdatedAt = time.Now()
-
-		err = s.repository.UpdateSubnet(ctx, subnet.ID, subnet)
-		if err != nil {
+		if err := s.updateSubnetUtilization(ctx, subnet.ID, utilization); err != nil {
 			log.Printf("Failed to update utilization for subnet %s: %v", subnet.ID, err)
 			continue
 		}
@@ -238,9 +356,63 @@ func (s *SyncService) UpdateUtilization(ctx context.Context) error {
 	return nil
 }
 
-// findParentVPC finds the parent VPC for a given VPC ID
-func (s *SyncService) findParentVPC(ctx context.Context, vpcID string) (*repository.Subnet, error) {
-	// List all subnets with AWS cloud info
+// updateSubnetUtilization writes a utilization figure under the subnet lock. The
+// subnet is re-read after locking so concurrent edits made since the listing
+// are preserved rather than overwritten with stale fields.
+func (s *SyncService) updateSubnetUtilization(ctx context.Context, id string, utilization float64) error {
+	unlock := repository.LockSubnet(id)
+	defer unlock()
+
+	subnet, err := s.repository.GetSubnetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	changed := subnet.Utilization == nil || subnet.Utilization.UtilizationPercent != utilization
+
+	subnet.Utilization = &repository.Utilization{
+		UtilizationPercent: utilization,
+		LastUpdated:        time.Now(),
+	}
+	subnet.UpdatedAt = time.Now()
+
+	if err := s.repository.UpdateSubnet(ctx, subnet.ID, subnet); err != nil {
+		return err
+	}
+
+	if changed {
+		s.recordUtilization(ctx, subnet.ID, utilization)
+	}
+	return nil
+}
+
+// recordUtilization appends a synced utilization figure to the subnet's
+// history. The history is capped by the service's compaction job.
+func (s *SyncService) recordUtilization(ctx context.Context, id string, utilization float64) {
+	sample := &repository.UtilizationSample{SubnetID: id, Percent: utilization, RecordedAt: time.Now()}
+	if err := s.repository.CreateUtilizationSample(ctx, sample); err != nil {
+		log.Printf("Failed to record utilization history for subnet %s: %v", id, err)
+	}
+}
+
+// accountID resolves the AWS account ID for synced resources. Sync proceeds
+// with an empty account ID if it cannot be resolved.
+func (s *SyncService) accountID(ctx context.Context) string {
+	accountID, err := s.client.GetAccountID(ctx)
+	if err != nil {
+		log.Printf("Failed to resolve AWS account ID, continuing without it: %v", err)
+		return ""
+	}
+	return accountID
+}
+
+// vpcKey identifies a VPC: VPC IDs are only meaningful within an account
+type vpcKey struct {
+	accountID string
+	vpcID     string
+}
+
+// loadVPCs indexes the VPC entries synced from AWS by account and VPC ID
+func (s *SyncService) loadVPCs(ctx context.Context) (map[vpcKey]*repository.Subnet, error) {
 	subnets, err := s.repository.ListSubnets(ctx, repository.SubnetFilters{
 		CloudProvider: "aws",
 	})
@@ -248,14 +420,11 @@ func (s *SyncService) findParentVPC(ctx context.Context, vpcID string) (*reposit
 		return nil, fmt.Errorf("failed to list subnets: %w", err)
 	}
 
-	// Find the VPC entry
+	vpcs := make(map[vpcKey]*repository.Subnet)
 	for _, subnet := range subnets.Subnets {
-		if subnet.CloudInfo != nil &&
-			subnet.CloudInfo.ResourceType == "vpc" &&
-			subnet.CloudInfo.VPCId == vpcID {
-			return subnet, nil
+		if subnet.CloudInfo != nil && subnet.CloudInfo.ResourceType == "vpc" {
+			vpcs[vpcKey{accountID: subnet.CloudInfo.AccountID, vpcID: subnet.CloudInfo.VPCId}] = subnet
 		}
 	}
-
-	return nil, fmt.Errorf("VPC %s not found", vpcID)
+	return vpcs, nil
 }
@@ -0,0 +1,565 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"github.com/bananaops/ipam-bananaops/internal/service"
+	pb "github.com/bananaops/ipam-bananaops/proto"
+)
+
+// mockEC2 is a mock implementation of EC2API for testing
+type mockEC2 struct {
+	vpcs    []ec2types.Vpc
+	subnets []ec2types.Subnet
+}
+
+func (m *mockEC2) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	return &ec2.DescribeVpcsOutput{Vpcs: m.vpcs}, nil
+}
+
+func (m *mockEC2) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	if len(params.SubnetIds) == 0 {
+		return &ec2.DescribeSubnetsOutput{Subnets: m.subnets}, nil
+	}
+
+	var matched []ec2types.Subnet
+	for _, subnet := range m.subnets {
+		for _, id := range params.SubnetIds {
+			if aws.ToString(subnet.SubnetId) == id {
+				matched = append(matched, subnet)
+			}
+		}
+	}
+	return &ec2.DescribeSubnetsOutput{Subnets: matched}, nil
+}
+
+// mockSTS is a mock implementation of STSAPI that counts identity lookups
+type mockSTS struct {
+	account string
+	calls   int
+}
+
+func (m *mockSTS) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	m.calls++
+	return &sts.GetCallerIdentityOutput{Account: aws.String(m.account)}, nil
+}
+
+func TestSyncAllPopulatesAccountID(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	// A VPC with the same ID already synced from another account must not
+	// become the parent of this account's subnets
+	foreignVPC := &repository.Subnet{
+		ID:           "foreign-vpc",
+		Name:         "VPC-foreign",
+		CIDR:         "10.0.0.0/16",
+		Location:     "eu-west-1",
+		LocationType: "cloud",
+		CloudInfo: &repository.CloudInfo{
+			Provider:     "aws",
+			Region:       "eu-west-1",
+			AccountID:    "111111111111",
+			ResourceType: "vpc",
+			VPCId:        "vpc-1",
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := repo.CreateSubnet(ctx, foreignVPC); err != nil {
+		t.Fatalf("Failed to create foreign VPC: %v", err)
+	}
+
+	ec2API := &mockEC2{
+		vpcs: []ec2types.Vpc{
+			{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.1.0.0/16")},
+		},
+		subnets: []ec2types.Subnet{
+			{
+				SubnetId:                aws.String("subnet-1"),
+				CidrBlock:               aws.String("10.1.1.0/24"),
+				VpcId:                   aws.String("vpc-1"),
+				AvailableIpAddressCount: aws.Int32(251),
+			},
+		},
+	}
+	stsAPI := &mockSTS{account: "222222222222"}
+	client := NewClientWithAPIs(ec2API, stsAPI, AWSConfig{Region: "eu-west-1"})
+
+	if _, err := NewSyncService(client, repo).SyncAll(ctx); err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+
+	vpc, err := repo.GetSubnetByCIDR(ctx, "10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("Failed to get synced VPC: %v", err)
+	}
+	if vpc.CloudInfo == nil || vpc.CloudInfo.AccountID != "222222222222" {
+		t.Errorf("Expected VPC account ID 222222222222, got %+v", vpc.CloudInfo)
+	}
+
+	subnet, err := repo.GetSubnetByCIDR(ctx, "10.1.1.0/24")
+	if err != nil {
+		t.Fatalf("Failed to get synced subnet: %v", err)
+	}
+	if subnet.CloudInfo == nil || subnet.CloudInfo.AccountID != "222222222222" {
+		t.Errorf("Expected subnet account ID 222222222222, got %+v", subnet.CloudInfo)
+	}
+	if subnet.ParentID != vpc.ID {
+		t.Errorf("Expected subnet parent %s, got %s", vpc.ID, subnet.ParentID)
+	}
+
+	if stsAPI.calls != 1 {
+		t.Errorf("Expected account ID to be resolved once, got %d calls", stsAPI.calls)
+	}
+}
+
+func TestSyncAllBackfillsVPCAccountID(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	// Synced before the account ID could be resolved
+	legacyVPC := &repository.Subnet{
+		ID:           "legacy-vpc",
+		Name:         "VPC-legacy",
+		CIDR:         "10.3.0.0/16",
+		Location:     "eu-west-1",
+		LocationType: "cloud",
+		CloudInfo: &repository.CloudInfo{
+			Provider:     "aws",
+			Region:       "eu-west-1",
+			ResourceType: "vpc",
+			VPCId:        "vpc-3",
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := repo.CreateSubnet(ctx, legacyVPC); err != nil {
+		t.Fatalf("Failed to create legacy VPC: %v", err)
+	}
+
+	ec2API := &mockEC2{
+		vpcs: []ec2types.Vpc{
+			{VpcId: aws.String("vpc-3"), CidrBlock: aws.String("10.3.0.0/16")},
+		},
+		subnets: []ec2types.Subnet{
+			{SubnetId: aws.String("subnet-3"), CidrBlock: aws.String("10.3.1.0/24"), VpcId: aws.String("vpc-3")},
+		},
+	}
+	client := NewClientWithAPIs(ec2API, &mockSTS{account: "333333333333"}, AWSConfig{Region: "eu-west-1"})
+
+	stats, err := NewSyncService(client, repo).SyncAll(ctx)
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	if want := (SyncStats{SubnetsCreated: 1}); !reflect.DeepEqual(*stats, want) {
+		t.Errorf("Expected %+v, got %+v", want, *stats)
+	}
+
+	vpc, err := repo.GetSubnetByID(ctx, legacyVPC.ID)
+	if err != nil {
+		t.Fatalf("Failed to get VPC: %v", err)
+	}
+	if vpc.CloudInfo == nil || vpc.CloudInfo.AccountID != "333333333333" {
+		t.Errorf("Expected the VPC account ID to be backfilled, got %+v", vpc.CloudInfo)
+	}
+
+	subnet, err := repo.GetSubnetByCIDR(ctx, "10.3.1.0/24")
+	if err != nil {
+		t.Fatalf("Failed to get synced subnet: %v", err)
+	}
+	if subnet.ParentID != legacyVPC.ID {
+		t.Errorf("Expected the subnet to be attached to VPC %s, got parent %q", legacyVPC.ID, subnet.ParentID)
+	}
+}
+
+func TestUpdateUtilizationConcurrentWithManualEdit(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := service.NewServiceLayer(repo, service.NewGoIPAMService(), nil)
+
+	subnet := &repository.Subnet{
+		ID:           "synced-subnet",
+		CIDR:         "10.1.1.0/24",
+		Name:         "original",
+		Location:     "eu-west-1",
+		LocationType: "cloud",
+		CloudInfo: &repository.CloudInfo{
+			Provider:     "aws",
+			Region:       "eu-west-1",
+			ResourceType: "subnet",
+			VPCId:        "vpc-1",
+			SubnetId:     "subnet-1",
+		},
+	}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	ec2API := &mockEC2{
+		subnets: []ec2types.Subnet{
+			{
+				SubnetId:                aws.String("subnet-1"),
+				CidrBlock:               aws.String("10.1.1.0/24"),
+				VpcId:                   aws.String("vpc-1"),
+				AvailableIpAddressCount: aws.Int32(200),
+			},
+		},
+	}
+	syncService := NewSyncService(NewClientWithEC2(ec2API, AWSConfig{Region: "eu-west-1"}), repo)
+
+	const iterations = 25
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			resp, err := serviceLayer.UpdateSubnet(ctx, &pb.UpdateSubnetRequest{
+				Id:           subnet.ID,
+				Name:         fmt.Sprintf("renamed-%d", i),
+				LocationType: pb.LocationType_CLOUD,
+			})
+			if err != nil || resp.Error != nil {
+				t.Errorf("UpdateSubnet failed: %v %v", err, resp.GetError())
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			if err := syncService.UpdateUtilization(ctx); err != nil {
+				t.Errorf("UpdateUtilization failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	got, err := repo.GetSubnetByID(ctx, subnet.ID)
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	if want := fmt.Sprintf("renamed-%d", iterations-1); got.Name != want {
+		t.Errorf("Expected manual edit %q to survive utilization updates, got %q", want, got.Name)
+	}
+	if got.Utilization == nil || got.Utilization.UtilizationPercent == 0 {
+		t.Errorf("Expected utilization to survive manual edits, got %+v", got.Utilization)
+	}
+}
+
+func TestManagedByFilterAfterSync(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ec2API := &mockEC2{
+		vpcs: []ec2types.Vpc{
+			{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.1.0.0/16")},
+		},
+		subnets: []ec2types.Subnet{
+			{
+				SubnetId:                aws.String("subnet-1"),
+				CidrBlock:               aws.String("10.1.1.0/24"),
+				VpcId:                   aws.String("vpc-1"),
+				AvailableIpAddressCount: aws.Int32(251),
+			},
+		},
+	}
+	client := NewClientWithAPIs(ec2API, &mockSTS{account: "222222222222"}, AWSConfig{Region: "eu-west-1"})
+	if _, err := NewSyncService(client, repo).SyncAll(ctx); err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+
+	// A manually tracked reservation may name a provider without being synced
+	serviceLayer := service.NewServiceLayer(repo, service.NewGoIPAMService(), nil)
+	manual := []*repository.Subnet{
+		{ID: "office", CIDR: "192.168.0.0/24", Name: "Office", Location: "paris"},
+		{ID: "reserved", CIDR: "10.2.0.0/16", Name: "Reserved", Location: "eu-west-1",
+			CloudInfo: &repository.CloudInfo{Provider: "aws", Region: "eu-west-1"}},
+	}
+	for _, subnet := range manual {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+		}
+	}
+
+	tests := []struct {
+		managedBy string
+		want      []string
+	}{
+		{repository.ManagedByCloud, []string{"10.1.0.0/16", "10.1.1.0/24"}},
+		{repository.ManagedByManual, []string{"10.2.0.0/16", "192.168.0.0/24"}},
+		{"", []string{"10.1.0.0/16", "10.1.1.0/24", "10.2.0.0/16", "192.168.0.0/24"}},
+	}
+	for _, tt := range tests {
+		list, err := repo.ListSubnets(ctx, repository.SubnetFilters{ManagedBy: tt.managedBy, PageSize: 50})
+		if err != nil {
+			t.Fatalf("Failed to list subnets managed by %q: %v", tt.managedBy, err)
+		}
+
+		got := make(map[string]bool)
+		for _, subnet := range list.Subnets {
+			got[subnet.CIDR] = true
+		}
+		if len(got) != len(tt.want) || int(list.TotalCount) != len(tt.want) {
+			t.Errorf("managed_by %q: expected %v, got %v (total %d)", tt.managedBy, tt.want, got, list.TotalCount)
+			continue
+		}
+		for _, cidr := range tt.want {
+			if !got[cidr] {
+				t.Errorf("managed_by %q: expected %s in results, got %v", tt.managedBy, cidr, got)
+			}
+		}
+	}
+}
+
+func TestSyncSubnetsManualConflict(t *testing.T) {
+	newRepo := func(t *testing.T) repository.SubnetRepository {
+		t.Helper()
+		repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+
+		manual := &repository.Subnet{
+			ID:           "dc-subnet",
+			CIDR:         "10.1.1.0/24",
+			Name:         "Datacenter",
+			Location:     "paris",
+			LocationType: "datacenter",
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		if err := repo.CreateSubnet(context.Background(), manual); err != nil {
+			t.Fatalf("Failed to create manual subnet: %v", err)
+		}
+		return repo
+	}
+
+	ec2API := &mockEC2{
+		subnets: []ec2types.Subnet{
+			{SubnetId: aws.String("subnet-1"), CidrBlock: aws.String("10.1.1.0/24"), VpcId: aws.String("vpc-1")},
+			{SubnetId: aws.String("subnet-2"), CidrBlock: aws.String("10.1.2.0/24"), VpcId: aws.String("vpc-1")},
+		},
+	}
+	client := NewClientWithAPIs(ec2API, &mockSTS{account: "222222222222"}, AWSConfig{Region: "eu-west-1"})
+
+	t.Run("overwrite off skips the manual subnet", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+
+		stats, err := NewSyncService(client, repo).SyncSubnets(ctx)
+		if err != nil {
+			t.Fatalf("SyncSubnets failed: %v", err)
+		}
+		if stats.SubnetsCreated != 1 || stats.SubnetsUpdated != 0 || stats.SubnetsSkipped != 1 {
+			t.Errorf("Expected 1 created and 1 skipped, got %+v", stats)
+		}
+
+		got, err := repo.GetSubnetByID(ctx, "dc-subnet")
+		if err != nil {
+			t.Fatalf("Failed to get manual subnet: %v", err)
+		}
+		if got.LocationType != "datacenter" || got.Location != "paris" || (got.CloudInfo != nil && got.CloudInfo.Provider != "") {
+			t.Errorf("Expected the manual subnet to be untouched, got %+v (cloud %+v)", got, got.CloudInfo)
+		}
+	})
+
+	t.Run("overwrite on reclassifies the manual subnet", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+
+		syncService := NewSyncService(client, repo)
+		syncService.SetOverwriteManual(true)
+		stats, err := syncService.SyncSubnets(ctx)
+		if err != nil {
+			t.Fatalf("SyncSubnets failed: %v", err)
+		}
+		if stats.SubnetsCreated != 1 || stats.SubnetsUpdated != 1 || stats.SubnetsSkipped != 0 {
+			t.Errorf("Expected 1 created and 1 updated, got %+v", stats)
+		}
+
+		got, err := repo.GetSubnetByID(ctx, "dc-subnet")
+		if err != nil {
+			t.Fatalf("Failed to get manual subnet: %v", err)
+		}
+		if got.LocationType != "cloud" || got.Location != "eu-west-1" || got.CloudInfo == nil || got.CloudInfo.Provider != "aws" {
+			t.Errorf("Expected the subnet to be taken over by AWS, got %+v (cloud %+v)", got, got.CloudInfo)
+		}
+	})
+}
+
+func TestSyncAllStats(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	existing := &repository.Subnet{
+		ID:           "synced-subnet",
+		CIDR:         "10.1.1.0/24",
+		Name:         "subnet-1",
+		Location:     "eu-west-1",
+		LocationType: "cloud",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := repo.CreateSubnet(ctx, existing); err != nil {
+		t.Fatalf("Failed to create existing subnet: %v", err)
+	}
+
+	ec2API := &mockEC2{
+		vpcs: []ec2types.Vpc{
+			{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.1.0.0/16")},
+		},
+		subnets: []ec2types.Subnet{
+			{SubnetId: aws.String("subnet-1"), CidrBlock: aws.String("10.1.1.0/24"), VpcId: aws.String("vpc-1")},
+			{SubnetId: aws.String("subnet-2"), CidrBlock: aws.String("10.1.2.0/24"), VpcId: aws.String("vpc-1")},
+			{SubnetId: aws.String("subnet-3"), CidrBlock: aws.String("10.1.3.0/24"), VpcId: aws.String("vpc-1")},
+		},
+	}
+	client := NewClientWithAPIs(ec2API, &mockSTS{account: "222222222222"}, AWSConfig{Region: "eu-west-1"})
+
+	stats, err := NewSyncService(client, repo).SyncAll(ctx)
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+
+	want := SyncStats{VPCsCreated: 1, SubnetsCreated: 2, SubnetsUpdated: 1}
+	if !reflect.DeepEqual(*stats, want) {
+		t.Errorf("Expected %+v, got %+v", want, *stats)
+	}
+}
+
+func TestSyncAllExcludesDefaultVPC(t *testing.T) {
+	ctx := context.Background()
+
+	ec2API := &mockEC2{
+		vpcs: []ec2types.Vpc{
+			{VpcId: aws.String("vpc-default"), CidrBlock: aws.String("172.31.0.0/16"), IsDefault: aws.Bool(true)},
+			{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.1.0.0/16"), IsDefault: aws.Bool(false)},
+		},
+		subnets: []ec2types.Subnet{
+			{SubnetId: aws.String("subnet-default"), CidrBlock: aws.String("172.31.0.0/20"), VpcId: aws.String("vpc-default")},
+			{SubnetId: aws.String("subnet-1"), CidrBlock: aws.String("10.1.1.0/24"), VpcId: aws.String("vpc-1")},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		exclude     bool
+		wantStats   SyncStats
+		wantDefault bool
+	}{
+		{"included by default", false, SyncStats{VPCsCreated: 2, SubnetsCreated: 2}, true},
+		{"excluded", true, SyncStats{VPCsCreated: 1, SubnetsCreated: 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("Failed to create repository: %v", err)
+			}
+			defer repo.Close()
+
+			client := NewClientWithAPIs(ec2API, &mockSTS{account: "222222222222"}, AWSConfig{Region: "eu-west-1", ExcludeDefaultVPC: tt.exclude})
+			stats, err := NewSyncService(client, repo).SyncAll(ctx)
+			if err != nil {
+				t.Fatalf("SyncAll failed: %v", err)
+			}
+			if !reflect.DeepEqual(*stats, tt.wantStats) {
+				t.Errorf("Expected %+v, got %+v", tt.wantStats, *stats)
+			}
+
+			for _, cidr := range []string{"172.31.0.0/16", "172.31.0.0/20"} {
+				_, err := repo.GetSubnetByCIDR(ctx, cidr)
+				if found := err == nil; found != tt.wantDefault {
+					t.Errorf("Expected %s synced = %v, got error %v", cidr, tt.wantDefault, err)
+				}
+			}
+			if _, err := repo.GetSubnetByCIDR(ctx, "10.1.1.0/24"); err != nil {
+				t.Errorf("Expected the non-default VPC's subnet to be synced: %v", err)
+			}
+		})
+	}
+}
+
+func TestSyncAllNormalizesHostBits(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ec2API := &mockEC2{
+		vpcs: []ec2types.Vpc{
+			{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.2.3.4/16")},
+		},
+		subnets: []ec2types.Subnet{
+			{SubnetId: aws.String("subnet-1"), CidrBlock: aws.String("10.2.1.9/24"), VpcId: aws.String("vpc-1")},
+		},
+	}
+	client := NewClientWithAPIs(ec2API, &mockSTS{account: "222222222222"}, AWSConfig{Region: "eu-west-1"})
+
+	stats, err := NewSyncService(client, repo).SyncAll(ctx)
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	if want := (SyncStats{VPCsCreated: 1, SubnetsCreated: 1}); !reflect.DeepEqual(*stats, want) {
+		t.Errorf("Expected %+v, got %+v", want, *stats)
+	}
+
+	vpc, err := repo.GetSubnetByCIDR(ctx, "10.2.0.0/16")
+	if err != nil {
+		t.Fatalf("Expected the VPC to be stored as 10.2.0.0/16: %v", err)
+	}
+	subnet, err := repo.GetSubnetByCIDR(ctx, "10.2.1.0/24")
+	if err != nil {
+		t.Fatalf("Expected the subnet to be stored as 10.2.1.0/24: %v", err)
+	}
+	if subnet.ParentID != vpc.ID {
+		t.Errorf("Expected the subnet to be attached to its VPC %s, got parent %q", vpc.ID, subnet.ParentID)
+	}
+}
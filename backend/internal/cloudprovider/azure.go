@@ -2,18 +2,34 @@ package cloudprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v6"
 )
 
+// AzureNetworkAPI is the subset of the Azure virtual network client used by AzureProvider, allowing tests to substitute a fake
+type AzureNetworkAPI interface {
+	// ListVirtualNetworks returns every virtual network in the subscription, including its subnets
+	ListVirtualNetworks(ctx context.Context) ([]*armnetwork.VirtualNetwork, error)
+}
+
 // AzureProvider implements the CloudProvider interface for Microsoft Azure
 type AzureProvider struct {
-	name string
+	name      string
+	newClient func(subscriptionID string, credential azcore.TokenCredential) (AzureNetworkAPI, error)
 }
 
 // NewAzureProvider creates a new Azure cloud provider instance
 func NewAzureProvider() *AzureProvider {
 	return &AzureProvider{
-		name: "Microsoft Azure",
+		name:      "Microsoft Azure",
+		newClient: newAzureNetworkClient,
 	}
 }
 
@@ -27,17 +43,92 @@ func (p *AzureProvider) GetType() CloudProviderType {
 	return ProviderAzure
 }
 
-// FetchSubnets retrieves all subnets from Azure
-// This is a stub implementation - actual Azure SDK integration will be added in the future
+// FetchSubnets retrieves the subnets of every virtual network in the subscription.
+// The subscription ID is read from credentials.Extra["subscription_id"] and the token is used as a bearer token.
+// When credentials.Region is set only that region is queried, otherwise all regions returned by GetRegions are.
 func (p *AzureProvider) FetchSubnets(ctx context.Context, credentials CloudCredentials) ([]*CloudSubnet, error) {
 	// Validate credentials
 	if err := p.ValidateCredentials(ctx, credentials); err != nil {
 		return nil, err
 	}
 
-	// TODO: Implement actual Azure SDK integration
-	// For now, return an error indicating the feature is not yet implemented
-	return nil, fmt.Errorf("%w: Azure subnet fetching not yet implemented", ErrProviderUnavailable)
+	subscriptionID := credentials.Extra["subscription_id"]
+	if subscriptionID == "" {
+		return nil, fmt.Errorf("%w: subscription_id is required to fetch Azure subnets", ErrInvalidCredentials)
+	}
+
+	regions, err := p.queriedRegions(credentials.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := p.newClient(subscriptionID, staticTokenCredential{token: credentials.Token})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+
+	vnets, err := client.ListVirtualNetworks(ctx)
+	if err != nil {
+		return nil, wrapAzureError(err)
+	}
+
+	var subnets []*CloudSubnet
+	for _, vnet := range vnets {
+		if vnet == nil || vnet.Properties == nil {
+			continue
+		}
+
+		region := normalizeAzureRegion(azureString(vnet.Location))
+		if !regions[region] {
+			continue
+		}
+
+		tags := make(map[string]string, len(vnet.Tags))
+		for key, value := range vnet.Tags {
+			tags[key] = azureString(value)
+		}
+
+		for _, subnet := range vnet.Properties.Subnets {
+			if subnet == nil || subnet.Properties == nil {
+				continue
+			}
+			for _, cidr := range azureSubnetPrefixes(subnet.Properties) {
+				subnets = append(subnets, &CloudSubnet{
+					ID:        azureString(subnet.ID),
+					CIDR:      cidr,
+					Name:      azureString(subnet.Name),
+					Region:    region,
+					AccountID: subscriptionID,
+					VPCId:     azureString(vnet.ID),
+					Tags:      tags,
+				})
+			}
+		}
+	}
+
+	return subnets, nil
+}
+
+// queriedRegions returns the set of regions to keep, restricted to the credentials' region when one is set
+func (p *AzureProvider) queriedRegions(credentialRegion string) (map[string]bool, error) {
+	known := p.GetRegions()
+	regions := make(map[string]bool, len(known))
+
+	if credentialRegion == "" {
+		for _, region := range known {
+			regions[region] = true
+		}
+		return regions, nil
+	}
+
+	region := normalizeAzureRegion(credentialRegion)
+	for _, candidate := range known {
+		if candidate == region {
+			regions[region] = true
+			return regions, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported Azure region %q", ErrInvalidCredentials, credentialRegion)
 }
 
 // GetRegions returns the list of available Azure regions
@@ -67,6 +158,11 @@ func (p *AzureProvider) GetRegions() []string {
 	}
 }
 
+// Implemented reports that Azure subnets are fetched from the Azure API
+func (p *AzureProvider) Implemented() bool {
+	return true
+}
+
 // ValidateCredentials checks if the provided Azure credentials are valid
 func (p *AzureProvider) ValidateCredentials(ctx context.Context, credentials CloudCredentials) error {
 	if credentials.Provider != ProviderAzure {
@@ -77,6 +173,94 @@ func (p *AzureProvider) ValidateCredentials(ctx context.Context, credentials Clo
 		return ErrInvalidCredentials
 	}
 
-	// TODO: Implement actual Azure credential validation
 	return nil
 }
+
+// azureNetworkClient adapts the armnetwork virtual networks client to AzureNetworkAPI
+type azureNetworkClient struct {
+	client *armnetwork.VirtualNetworksClient
+}
+
+// newAzureNetworkClient creates an AzureNetworkAPI backed by the Azure SDK
+func newAzureNetworkClient(subscriptionID string, credential azcore.TokenCredential) (AzureNetworkAPI, error) {
+	client, err := armnetwork.NewVirtualNetworksClient(subscriptionID, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure virtual networks client: %w", err)
+	}
+	return &azureNetworkClient{client: client}, nil
+}
+
+// ListVirtualNetworks pages through all virtual networks in the subscription
+func (c *azureNetworkClient) ListVirtualNetworks(ctx context.Context) ([]*armnetwork.VirtualNetwork, error) {
+	var vnets []*armnetwork.VirtualNetwork
+
+	pager := c.client.NewListAllPager(nil)
+	for pager.More() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list virtual networks: %w", err)
+		}
+		vnets = append(vnets, page.Value...)
+	}
+
+	return vnets, nil
+}
+
+// staticTokenCredential hands a pre-issued bearer token to the Azure SDK
+type staticTokenCredential struct {
+	token string
+}
+
+// GetToken returns the configured token; its lifetime is managed by whoever issued it
+func (c staticTokenCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: c.token, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// wrapAzureError maps Azure SDK errors onto the provider error sentinels
+func wrapAzureError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w: %v", ErrAuthenticationFailed, err)
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %v", ErrRateLimited, err)
+		}
+	}
+
+	return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+}
+
+// azureSubnetPrefixes returns the address prefixes of a subnet, which Azure reports in either of two fields
+func azureSubnetPrefixes(props *armnetwork.SubnetPropertiesFormat) []string {
+	if props.AddressPrefix != nil && *props.AddressPrefix != "" {
+		return []string{*props.AddressPrefix}
+	}
+
+	prefixes := make([]string, 0, len(props.AddressPrefixes))
+	for _, prefix := range props.AddressPrefixes {
+		if prefix != nil && *prefix != "" {
+			prefixes = append(prefixes, *prefix)
+		}
+	}
+	return prefixes
+}
+
+// normalizeAzureRegion converts display names such as "East US" to the canonical "eastus" form
+func normalizeAzureRegion(region string) string {
+	return strings.ToLower(strings.ReplaceAll(region, " ", ""))
+}
+
+func azureString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -2,18 +2,38 @@ package cloudprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
+// GCPSubnetworksAPI is the subset of the Compute subnetworks client used by GCPProvider, allowing tests to substitute a fake
+type GCPSubnetworksAPI interface {
+	// ListSubnetworks returns every subnetwork of the project in one region
+	ListSubnetworks(ctx context.Context, project, region string) ([]*computepb.Subnetwork, error)
+	Close() error
+}
+
 // GCPProvider implements the CloudProvider interface for Google Cloud Platform
 type GCPProvider struct {
-	name string
+	name      string
+	newClient func(ctx context.Context, opts ...option.ClientOption) (GCPSubnetworksAPI, error)
 }
 
 // NewGCPProvider creates a new GCP cloud provider instance
 func NewGCPProvider() *GCPProvider {
 	return &GCPProvider{
-		name: "Google Cloud Platform",
+		name:      "Google Cloud Platform",
+		newClient: newGCPSubnetworksClient,
 	}
 }
 
@@ -27,17 +47,80 @@ func (p *GCPProvider) GetType() CloudProviderType {
 	return ProviderGCP
 }
 
-// FetchSubnets retrieves all subnets from GCP
-// This is a stub implementation - actual GCP SDK integration will be added in the future
+// FetchSubnets retrieves the subnetworks of the project given in credentials.Extra["project_id"].
+// The token is used as an OAuth2 access token, or a service account key can be passed as JSON
+// in credentials.Extra["credentials_json"]. When credentials.Region is set only that region is
+// queried, otherwise all regions returned by GetRegions are.
 func (p *GCPProvider) FetchSubnets(ctx context.Context, credentials CloudCredentials) ([]*CloudSubnet, error) {
 	// Validate credentials
 	if err := p.ValidateCredentials(ctx, credentials); err != nil {
 		return nil, err
 	}
 
-	// TODO: Implement actual GCP SDK integration
-	// For now, return an error indicating the feature is not yet implemented
-	return nil, fmt.Errorf("%w: GCP subnet fetching not yet implemented", ErrProviderUnavailable)
+	projectID := credentials.Extra["project_id"]
+	if projectID == "" {
+		return nil, fmt.Errorf("%w: project_id is required to fetch GCP subnets", ErrInvalidCredentials)
+	}
+
+	regions, err := p.queriedRegions(credentials.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	var clientOption option.ClientOption
+	if key := credentials.Extra["credentials_json"]; key != "" {
+		clientOption = option.WithCredentialsJSON([]byte(key))
+	} else {
+		clientOption = option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: credentials.Token}))
+	}
+
+	client, err := p.newClient(ctx, clientOption)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	defer client.Close()
+
+	var subnets []*CloudSubnet
+	for _, region := range regions {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		subnetworks, err := client.ListSubnetworks(ctx, projectID, region)
+		if err != nil {
+			return nil, wrapGCPError(err)
+		}
+
+		for _, subnetwork := range subnetworks {
+			if subnetwork == nil || subnetwork.GetIpCidrRange() == "" {
+				continue
+			}
+			subnets = append(subnets, &CloudSubnet{
+				ID:        strconv.FormatUint(subnetwork.GetId(), 10),
+				CIDR:      subnetwork.GetIpCidrRange(),
+				Name:      subnetwork.GetName(),
+				Region:    region,
+				AccountID: projectID,
+				VPCId:     path.Base(subnetwork.GetNetwork()),
+			})
+		}
+	}
+
+	return subnets, nil
+}
+
+// queriedRegions returns the regions to list, restricted to the credentials' region when one is set
+func (p *GCPProvider) queriedRegions(credentialRegion string) ([]string, error) {
+	known := p.GetRegions()
+	if credentialRegion == "" {
+		return known, nil
+	}
+
+	for _, candidate := range known {
+		if candidate == credentialRegion {
+			return []string{credentialRegion}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported GCP region %q", ErrInvalidCredentials, credentialRegion)
 }
 
 // GetRegions returns the list of available GCP regions
@@ -69,16 +152,77 @@ func (p *GCPProvider) GetRegions() []string {
 	}
 }
 
+// Implemented reports that GCP subnets are fetched from the Compute API
+func (p *GCPProvider) Implemented() bool {
+	return true
+}
+
 // ValidateCredentials checks if the provided GCP credentials are valid
 func (p *GCPProvider) ValidateCredentials(ctx context.Context, credentials CloudCredentials) error {
 	if credentials.Provider != ProviderGCP {
 		return fmt.Errorf("invalid provider type: expected %s, got %s", ProviderGCP, credentials.Provider)
 	}
 
-	if credentials.Token == "" {
+	if credentials.Token == "" && credentials.Extra["credentials_json"] == "" {
 		return ErrInvalidCredentials
 	}
 
-	// TODO: Implement actual GCP credential validation
 	return nil
 }
+
+// gcpSubnetworksClient adapts the Compute subnetworks client to GCPSubnetworksAPI
+type gcpSubnetworksClient struct {
+	client *compute.SubnetworksClient
+}
+
+// newGCPSubnetworksClient creates a GCPSubnetworksAPI backed by the Compute REST client
+func newGCPSubnetworksClient(ctx context.Context, opts ...option.ClientOption) (GCPSubnetworksAPI, error) {
+	client, err := compute.NewSubnetworksRESTClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP subnetworks client: %w", err)
+	}
+	return &gcpSubnetworksClient{client: client}, nil
+}
+
+// ListSubnetworks pages through the subnetworks of a project in one region
+func (c *gcpSubnetworksClient) ListSubnetworks(ctx context.Context, project, region string) ([]*computepb.Subnetwork, error) {
+	var subnetworks []*computepb.Subnetwork
+
+	it := c.client.List(ctx, &computepb.ListSubnetworksRequest{Project: project, Region: region})
+	for {
+		subnetwork, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subnetworks in %s: %w", region, err)
+		}
+		subnetworks = append(subnetworks, subnetwork)
+	}
+
+	return subnetworks, nil
+}
+
+// Close releases the underlying client connection
+func (c *gcpSubnetworksClient) Close() error {
+	return c.client.Close()
+}
+
+// wrapGCPError maps Compute API errors onto the provider error sentinels
+func wrapGCPError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w: %v", ErrAuthenticationFailed, err)
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %v", ErrRateLimited, err)
+		}
+	}
+
+	return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+}
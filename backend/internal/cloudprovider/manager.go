@@ -2,8 +2,10 @@ package cloudprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,23 +16,92 @@ import (
 
 // Manager manages cloud provider integrations
 type Manager struct {
-	config     *config.Config
-	repository repository.SubnetRepository
-	awsClients map[string]*aws.Client
-	awsSyncs   map[string]*aws.SyncService
-	mu         sync.RWMutex
-	stopCh     chan struct{}
-	wg         sync.WaitGroup
+	config      *config.Config
+	repository  repository.SubnetRepository
+	awsClients  map[string]*aws.Client
+	awsSyncs    map[string]*aws.SyncService
+	providers   *CloudProviderManager
+	credentials map[CloudProviderType][]CloudCredentials // Non-AWS providers to sync, one entry per region or account
+	mu          sync.RWMutex
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+	onSync      func(provider string, failed int, err error)
+	now         func() time.Time
+
+	historyMu   sync.Mutex
+	syncHistory map[string]*syncHistory // Keyed by provider type
+
+	// syncSlot holds a token while a sync runs so runs never overlap
+	syncSlot  chan struct{}
+	syncMu    sync.Mutex
+	syncState SyncState
+}
+
+// SyncState reports whether a full or single-region sync is running and when
+// the last one started and completed. Zero times mean no sync has started or completed.
+type SyncState struct {
+	InProgress    bool
+	LastStarted   time.Time
+	LastCompleted time.Time
 }
 
 // NewManager creates a new cloud provider manager
 func NewManager(cfg *config.Config, repo repository.SubnetRepository) *Manager {
-	return &Manager{
-		config:     cfg,
-		repository: repo,
-		awsClients: make(map[string]*aws.Client),
-		awsSyncs:   make(map[string]*aws.SyncService),
-		stopCh:     make(chan struct{}),
+	m := &Manager{
+		config:      cfg,
+		repository:  repo,
+		awsClients:  make(map[string]*aws.Client),
+		awsSyncs:    make(map[string]*aws.SyncService),
+		providers:   NewCloudProviderManager(),
+		credentials: make(map[CloudProviderType][]CloudCredentials),
+		stopCh:      make(chan struct{}),
+		now:         time.Now,
+		syncHistory: make(map[string]*syncHistory),
+		syncSlot:    make(chan struct{}, 1),
+	}
+
+	// AWS discovery goes through the clients authenticated in initializeAWS
+	for _, provider := range []CloudProvider{
+		NewAWSProviderWithClients(m.awsClient),
+		NewAzureProvider(),
+		NewGCPProvider(),
+		NewScalewayProvider(),
+		NewOVHProvider(),
+	} {
+		// Built-in provider types are unique, so registration cannot fail
+		_ = m.providers.Register(provider)
+	}
+
+	return m
+}
+
+// RegisterProvider adds a provider to the periodic sync along with the
+// credentials to fetch with, one entry per region or account
+func (m *Manager) RegisterProvider(provider CloudProvider, credentials ...CloudCredentials) error {
+	if err := m.providers.Register(provider); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.credentials[provider.GetType()] = credentials
+	return nil
+}
+
+// SetSyncObserver registers a function called with the outcome of every
+// provider region synchronization, whether periodic or triggered through the
+// API, along with the number of resources it failed to store
+func (m *Manager) SetSyncObserver(observer func(provider string, failed int, err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onSync = observer
+}
+
+// observeSync reports a synchronization outcome to the registered observer.
+// Callers must hold m.mu.
+func (m *Manager) observeSync(provider string, failed int, err error) {
+	if m.onSync != nil {
+		m.onSync(provider, failed, err)
 	}
 }
 
@@ -48,9 +119,23 @@ func (m *Manager) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to initialize AWS: %w", err)
 	}
 
-	// Start periodic sync
-	if err := m.startPeriodicSync(ctx); err != nil {
-		return fmt.Errorf("failed to start periodic sync: %w", err)
+	// Collect credentials for the providers synced through the generic interface
+	m.initializeProviders()
+
+	// Start periodic sync unless only on-demand sync is wanted
+	if m.config.CloudProviders.IsPeriodicSyncEnabled() {
+		if err := m.startPeriodicSync(ctx); err != nil {
+			return fmt.Errorf("failed to start periodic sync: %w", err)
+		}
+	} else {
+		log.Println("Periodic sync is disabled, cloud resources sync on demand only")
+	}
+
+	// Pruning is opt-in since it deletes subnets without operator action
+	if m.config.CloudProviders.AutoPrune {
+		if err := m.startAutoPrune(ctx); err != nil {
+			return fmt.Errorf("failed to start stale subnet pruning: %w", err)
+		}
 	}
 
 	log.Println("Cloud provider manager started successfully")
@@ -74,11 +159,17 @@ func (m *Manager) initializeAWS(ctx context.Context) error {
 
 	log.Printf("Initializing AWS integration for %d regions", len(m.config.CloudProviders.AWS.Regions))
 
+	// Validate rejects malformed delays, so the error can be ignored here
+	retryBaseDelay, _ := m.config.CloudProviders.AWS.GetRetryBaseDelay()
+
 	for _, regionConfig := range m.config.CloudProviders.AWS.Regions {
 		awsConfig := aws.AWSConfig{
-			Region:          regionConfig.Region,
-			AccessKeyID:     regionConfig.AccessKeyID,
-			SecretAccessKey: regionConfig.SecretAccessKey,
+			Region:            regionConfig.Region,
+			AccessKeyID:       regionConfig.AccessKeyID,
+			SecretAccessKey:   regionConfig.SecretAccessKey,
+			MaxRetries:        m.config.CloudProviders.AWS.MaxRetries,
+			RetryBaseDelay:    retryBaseDelay,
+			ExcludeDefaultVPC: !m.config.CloudProviders.AWS.IsDefaultVPCIncluded(),
 		}
 
 		client, err := aws.NewClient(ctx, awsConfig)
@@ -95,7 +186,9 @@ func (m *Manager) initializeAWS(ctx context.Context) error {
 
 		m.mu.Lock()
 		m.awsClients[regionConfig.Region] = client
-		m.awsSyncs[regionConfig.Region] = aws.NewSyncService(client, m.repository)
+		syncService := aws.NewSyncService(client, m.repository)
+		syncService.SetOverwriteManual(m.config.CloudProviders.OverwriteManual)
+		m.awsSyncs[regionConfig.Region] = syncService
 		m.mu.Unlock()
 
 		log.Printf("Successfully initialized AWS client for region: %s", regionConfig.Region)
@@ -108,6 +201,34 @@ func (m *Manager) initializeAWS(ctx context.Context) error {
 	return nil
 }
 
+// initializeProviders loads the credentials of every enabled non-AWS provider from configuration
+func (m *Manager) initializeProviders() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, providerConfig := range m.config.CloudProviders.GenericProviders() {
+		if !providerConfig.Enabled {
+			continue
+		}
+
+		providerType := CloudProviderType(name)
+		credentials := make([]CloudCredentials, 0, len(providerConfig.Regions))
+		for _, regionConfig := range providerConfig.Regions {
+			credentials = append(credentials, CloudCredentials{
+				Provider:  providerType,
+				AccessKey: regionConfig.AccessKey,
+				SecretKey: regionConfig.SecretKey,
+				Token:     regionConfig.Token,
+				Region:    regionConfig.Region,
+				Extra:     regionConfig.Extra,
+			})
+		}
+		m.credentials[providerType] = credentials
+
+		log.Printf("Initialized %s integration for %d regions", providerType, len(credentials))
+	}
+}
+
 // startPeriodicSync starts the periodic synchronization process
 func (m *Manager) startPeriodicSync(ctx context.Context) error {
 	syncInterval, err := m.config.CloudProviders.GetSyncInterval()
@@ -118,7 +239,7 @@ func (m *Manager) startPeriodicSync(ctx context.Context) error {
 	log.Printf("Starting periodic sync with interval: %v", syncInterval)
 
 	// Perform initial sync
-	if err := m.SyncAll(ctx); err != nil {
+	if _, err := m.TrySyncAll(ctx); err != nil {
 		log.Printf("Initial sync failed: %v", err)
 	}
 
@@ -132,7 +253,9 @@ func (m *Manager) startPeriodicSync(ctx context.Context) error {
 		for {
 			select {
 			case <-ticker.C:
-				if err := m.SyncAll(ctx); err != nil {
+				if _, err := m.TrySyncAll(ctx); errors.Is(err, ErrSyncInProgress) {
+					log.Println("Skipping periodic sync: a sync is already in progress")
+				} else if err != nil {
 					log.Printf("Periodic sync failed: %v", err)
 				}
 			case <-m.stopCh:
@@ -144,33 +267,94 @@ func (m *Manager) startPeriodicSync(ctx context.Context) error {
 	return nil
 }
 
-// SyncAll synchronizes all cloud providers
-func (m *Manager) SyncAll(ctx context.Context) error {
+// TrySyncAll runs SyncAll unless another sync is in progress, in which
+// case it returns ErrSyncInProgress without waiting
+func (m *Manager) TrySyncAll(ctx context.Context) (*aws.SyncStats, error) {
+	select {
+	case m.syncSlot <- struct{}{}:
+	default:
+		return nil, ErrSyncInProgress
+	}
+	defer func() { <-m.syncSlot }()
+
+	return m.syncAll(ctx)
+}
+
+// SyncState returns the progress of full synchronizations
+func (m *Manager) SyncState() SyncState {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+	return m.syncState
+}
+
+// setSyncInProgress records the start or end of a sync
+func (m *Manager) setSyncInProgress(inProgress bool) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	m.syncState.InProgress = inProgress
+	if inProgress {
+		m.syncState.LastStarted = m.now()
+	} else {
+		m.syncState.LastCompleted = m.now()
+	}
+}
+
+// SyncAll synchronizes all cloud providers and returns the combined
+// statistics of every region, including the ones that failed. Only one full
+// sync runs at a time; SyncAll waits for a running one to finish first.
+func (m *Manager) SyncAll(ctx context.Context) (*aws.SyncStats, error) {
+	select {
+	case m.syncSlot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-m.syncSlot }()
+
+	return m.syncAll(ctx)
+}
+
+// syncAll runs a full sync. Callers must hold the sync slot.
+func (m *Manager) syncAll(ctx context.Context) (*aws.SyncStats, error) {
+	m.setSyncInProgress(true)
+	defer m.setSyncInProgress(false)
+
 	log.Println("Starting full cloud provider synchronization...")
 
 	var errors []error
+	stats := &aws.SyncStats{}
 
 	// Sync AWS
-	if err := m.syncAWS(ctx); err != nil {
+	awsStats, err := m.syncAWS(ctx)
+	stats.Add(awsStats)
+	if err != nil {
 		errors = append(errors, fmt.Errorf("AWS sync failed: %w", err))
 	}
 
+	// Sync the providers discovered through the generic interface
+	providerStats, err := m.syncProviders(ctx)
+	stats.Add(providerStats)
+	if err != nil {
+		errors = append(errors, err)
+	}
+
 	if len(errors) > 0 {
 		log.Printf("Synchronization completed with %d errors", len(errors))
-		return fmt.Errorf("sync errors: %v", errors)
+		return stats, fmt.Errorf("sync errors: %v", errors)
 	}
 
 	log.Println("Full cloud provider synchronization completed successfully")
-	return nil
+	return stats, nil
 }
 
 // syncAWS synchronizes all AWS regions
-func (m *Manager) syncAWS(ctx context.Context) error {
+func (m *Manager) syncAWS(ctx context.Context) (*aws.SyncStats, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	stats := &aws.SyncStats{}
 	if len(m.awsSyncs) == 0 {
-		return nil
+		return stats, nil
 	}
 
 	log.Printf("Synchronizing %d AWS regions", len(m.awsSyncs))
@@ -178,7 +362,11 @@ func (m *Manager) syncAWS(ctx context.Context) error {
 	var errors []error
 	for region, syncService := range m.awsSyncs {
 		log.Printf("Synchronizing AWS region: %s", region)
-		if err := syncService.SyncAll(ctx); err != nil {
+		regionStats, err := m.syncAWSRegion(ctx, region, syncService)
+		stats.Add(regionStats)
+		m.recordSync("aws", regionStats, err)
+		if err != nil {
+			stats.Fail(aws.SyncFailure{Provider: "aws", Region: region, Error: err.Error()})
 			errors = append(errors, fmt.Errorf("region %s: %w", region, err))
 			continue
 		}
@@ -186,24 +374,225 @@ func (m *Manager) syncAWS(ctx context.Context) error {
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf("AWS sync errors: %v", errors)
+		return stats, fmt.Errorf("AWS sync errors: %v", errors)
 	}
 
-	return nil
+	return stats, nil
 }
 
-// SyncAWSRegion synchronizes a specific AWS region
-func (m *Manager) SyncAWSRegion(ctx context.Context, region string) error {
+// SyncAWSRegion synchronizes a specific AWS region. It shares the sync slot
+// with full syncs and returns ErrSyncInProgress without waiting while another
+// sync is running.
+func (m *Manager) SyncAWSRegion(ctx context.Context, region string) (*aws.SyncStats, error) {
+	select {
+	case m.syncSlot <- struct{}{}:
+	default:
+		return nil, ErrSyncInProgress
+	}
+	defer func() { <-m.syncSlot }()
+
+	m.setSyncInProgress(true)
+	defer m.setSyncInProgress(false)
+
 	m.mu.RLock()
-	syncService, exists := m.awsSyncs[region]
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
 
+	syncService, exists := m.awsSyncs[region]
 	if !exists {
-		return fmt.Errorf("AWS region %s is not configured", region)
+		return nil, fmt.Errorf("AWS region %s is not configured", region)
 	}
 
 	log.Printf("Synchronizing AWS region: %s", region)
-	return syncService.SyncAll(ctx)
+	stats, err := m.syncAWSRegion(ctx, region, syncService)
+	m.recordSync("aws", stats, err)
+	return stats, err
+}
+
+// syncAWSRegion synchronizes the VPCs of a region, its subnets through the
+// generic provider interface, and then their utilization. Callers must hold m.mu.
+func (m *Manager) syncAWSRegion(ctx context.Context, region string, syncService *aws.SyncService) (*aws.SyncStats, error) {
+	// VPCs are AWS-specific; they are synced first so subnets can be attached to them
+	stats, err := syncService.SyncVPCs(ctx)
+	if err != nil {
+		return &aws.SyncStats{}, fmt.Errorf("failed to sync VPCs: %w", err)
+	}
+
+	provider, err := m.providers.GetProvider(ProviderAWS)
+	if err != nil {
+		return stats, err
+	}
+	subnetStats, err := m.syncProviderCredentials(ctx, provider, CloudCredentials{Provider: ProviderAWS, Region: region}, nil)
+	stats.Add(subnetStats)
+	if err != nil {
+		return stats, fmt.Errorf("failed to sync subnets: %w", err)
+	}
+
+	if err := syncService.UpdateUtilization(ctx); err != nil {
+		log.Printf("Failed to update utilization for AWS region %s: %v", region, err)
+	}
+
+	log.Printf("Successfully completed AWS synchronization for region: %s", region)
+	return stats, nil
+}
+
+// syncProviders synchronizes every non-AWS provider that has credentials
+func (m *Manager) syncProviders(ctx context.Context) (*aws.SyncStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var errors []error
+	stats := &aws.SyncStats{}
+	for providerType, credentialsList := range m.credentials {
+		providerStats, providerErrors := m.syncProvider(ctx, providerType, credentialsList)
+		stats.Add(providerStats)
+		errors = append(errors, providerErrors...)
+	}
+
+	if len(errors) > 0 {
+		return stats, fmt.Errorf("provider sync errors: %v", errors)
+	}
+
+	return stats, nil
+}
+
+// SyncProvider synchronizes every configured region of a single provider. It
+// shares the sync slot with full syncs: while another sync is running it
+// returns ErrSyncInProgress, or waits for it to finish when wait is set.
+func (m *Manager) SyncProvider(ctx context.Context, providerType CloudProviderType, wait bool) (*aws.SyncStats, error) {
+	if providerType != ProviderAWS {
+		m.mu.RLock()
+		_, configured := m.credentials[providerType]
+		m.mu.RUnlock()
+		if !configured {
+			return nil, fmt.Errorf("%w: %s has no credentials configured", ErrProviderNotFound, providerType)
+		}
+	}
+
+	if wait {
+		select {
+		case m.syncSlot <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		select {
+		case m.syncSlot <- struct{}{}:
+		default:
+			return nil, ErrSyncInProgress
+		}
+	}
+	defer func() { <-m.syncSlot }()
+
+	m.setSyncInProgress(true)
+	defer m.setSyncInProgress(false)
+
+	if providerType == ProviderAWS {
+		return m.syncAWS(ctx)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats, errors := m.syncProvider(ctx, providerType, m.credentials[providerType])
+	if len(errors) > 0 {
+		return stats, fmt.Errorf("%s sync errors: %v", providerType, errors)
+	}
+	return stats, nil
+}
+
+// syncProvider synchronizes each set of credentials of a non-AWS provider and
+// returns the combined statistics and the errors of the regions that failed.
+// Callers must hold m.mu.
+func (m *Manager) syncProvider(ctx context.Context, providerType CloudProviderType, credentialsList []CloudCredentials) (*aws.SyncStats, []error) {
+	stats := &aws.SyncStats{}
+	provider, err := m.providers.GetProvider(providerType)
+	if err != nil {
+		stats.Fail(aws.SyncFailure{Provider: string(providerType), Error: err.Error()})
+		return stats, []error{err}
+	}
+
+	var errors []error
+	regions := configuredRegions(credentialsList)
+	for _, credentials := range credentialsList {
+		log.Printf("Synchronizing %s region: %s", providerType, credentials.Region)
+		regionStats, err := m.syncProviderCredentials(ctx, provider, credentials, regions)
+		stats.Add(regionStats)
+		m.recordSync(string(providerType), regionStats, err)
+		if err != nil {
+			stats.Fail(aws.SyncFailure{Provider: string(providerType), Region: credentials.Region, Error: err.Error()})
+			errors = append(errors, fmt.Errorf("%s region %s: %w", providerType, credentials.Region, err))
+			continue
+		}
+		log.Printf("Successfully synchronized %s region: %s", providerType, credentials.Region)
+	}
+	return stats, errors
+}
+
+// configuredRegions returns the regions named in a provider's credentials.
+// Nil means no credentials name a region, so every region is in scope.
+func configuredRegions(credentialsList []CloudCredentials) map[string]bool {
+	var regions map[string]bool
+	for _, credentials := range credentialsList {
+		if credentials.Region == "" {
+			continue
+		}
+		if regions == nil {
+			regions = make(map[string]bool)
+		}
+		regions[credentials.Region] = true
+	}
+	return regions
+}
+
+// syncProviderCredentials fetches the subnets visible with one set of
+// credentials and upserts them into the repository. Subnets that cannot be
+// stored, or that match a manually created subnet, are logged and skipped.
+// When regions is set, subnets reported in any other region are ignored;
+// subnets without a region cannot be scoped and are kept.
+func (m *Manager) syncProviderCredentials(ctx context.Context, provider CloudProvider, credentials CloudCredentials, regions map[string]bool) (*aws.SyncStats, error) {
+	stats := &aws.SyncStats{}
+	subnets, err := provider.FetchSubnets(ctx, credentials)
+	if err != nil {
+		return stats, fmt.Errorf("failed to fetch subnets: %w", err)
+	}
+
+	log.Printf("Found %d subnets in %s", len(subnets), provider.GetType())
+
+	if regions != nil {
+		inScope := subnets[:0:0]
+		for _, subnet := range subnets {
+			if subnet.Region == "" || regions[subnet.Region] {
+				inScope = append(inScope, subnet)
+			}
+		}
+		if ignored := len(subnets) - len(inScope); ignored > 0 {
+			log.Printf("Ignoring %d %s subnets outside the configured regions", ignored, provider.GetType())
+		}
+		subnets = inScope
+	}
+
+	networks, err := loadNetworks(ctx, m.repository, provider.GetType())
+	if err != nil {
+		return stats, err
+	}
+
+	for _, subnet := range subnets {
+		if err := upsertCloudSubnet(ctx, m.repository, provider.GetType(), subnet, networks, m.config.CloudProviders.OverwriteManual, m.now(), stats); err != nil {
+			log.Printf("Failed to synchronize %s subnet %s (%s): %v", provider.GetType(), subnet.ID, subnet.CIDR, err)
+			stats.Fail(aws.SyncFailure{
+				Provider:   string(provider.GetType()),
+				Region:     credentials.Region,
+				ResourceID: subnet.ID,
+				CIDR:       subnet.CIDR,
+				Error:      err.Error(),
+			})
+		}
+	}
+
+	log.Printf("Synchronized %s subnets in region %s: %d created, %d updated, %d skipped, %d failed",
+		provider.GetType(), credentials.Region, stats.SubnetsCreated, stats.SubnetsUpdated, stats.SubnetsSkipped, stats.Errors)
+
+	return stats, nil
 }
 
 // UpdateUtilization updates utilization data for all cloud providers
@@ -242,6 +631,16 @@ func (m *Manager) GetAWSClient(region string) (*aws.Client, error) {
 	return client, nil
 }
 
+// awsClient returns the AWS client for a region without locking; it backs the
+// AWS provider, which is only called while m.mu is held
+func (m *Manager) awsClient(region string) (*aws.Client, error) {
+	client, exists := m.awsClients[region]
+	if !exists {
+		return nil, fmt.Errorf("AWS client for region %s not found", region)
+	}
+	return client, nil
+}
+
 // ListAWSRegions returns all configured AWS regions
 func (m *Manager) ListAWSRegions() []string {
 	m.mu.RLock()
@@ -264,3 +663,47 @@ func (m *Manager) IsEnabled() bool {
 func (m *Manager) IsAWSEnabled() bool {
 	return m.config.CloudProviders.AWS.Enabled
 }
+
+// ProviderStatus describes a registered provider for status reporting
+type ProviderStatus struct {
+	Type        CloudProviderType
+	Name        string
+	Enabled     bool
+	Implemented bool
+	Regions     []string
+}
+
+// ListProviderStatus reports every registered provider with the regions it
+// syncs and whether its subnet fetching is implemented or still a stub
+func (m *Manager) ListProviderStatus() []ProviderStatus {
+	providers := m.providers.ListProviders()
+	awsRegions := m.ListAWSRegions()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]ProviderStatus, 0, len(providers))
+	for _, provider := range providers {
+		status := ProviderStatus{
+			Type:        provider.GetType(),
+			Name:        provider.GetName(),
+			Implemented: provider.Implemented(),
+			Regions:     []string{},
+		}
+
+		if status.Type == ProviderAWS {
+			status.Enabled = m.IsAWSEnabled()
+			status.Regions = awsRegions
+		} else if credentialsList, ok := m.credentials[status.Type]; ok {
+			status.Enabled = true
+			for _, credentials := range credentialsList {
+				status.Regions = append(status.Regions, credentials.Region)
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Type < statuses[j].Type })
+	return statuses
+}
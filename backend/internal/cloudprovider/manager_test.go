@@ -3,7 +3,18 @@ package cloudprovider
 import (
 	"context"
 	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider/aws"
+	"github.com/bananaops/ipam-bananaops/internal/config"
+	"github.com/bananaops/ipam-bananaops/internal/repository"
 )
 
 // mockProvider is a mock implementation of CloudProvider for testing
@@ -12,6 +23,7 @@ type mockProvider struct {
 	providerType CloudProviderType
 	regions      []string
 	fetchError   error
+	subnets      []*CloudSubnet // Returned instead of the default subnet when set
 }
 
 func (m *mockProvider) GetName() string {
@@ -26,6 +38,9 @@ func (m *mockProvider) FetchSubnets(ctx context.Context, credentials CloudCreden
 	if m.fetchError != nil {
 		return nil, m.fetchError
 	}
+	if m.subnets != nil {
+		return m.subnets, nil
+	}
 	return []*CloudSubnet{
 		{
 			CIDR:      "10.0.0.0/24",
@@ -44,6 +59,10 @@ func (m *mockProvider) ValidateCredentials(ctx context.Context, credentials Clou
 	return nil
 }
 
+func (m *mockProvider) Implemented() bool {
+	return true
+}
+
 func TestNewCloudProviderManager(t *testing.T) {
 	manager := NewCloudProviderManager()
 	if manager == nil {
@@ -322,3 +341,583 @@ func TestFetchSubnetsFromAllProviders(t *testing.T) {
 		t.Error("Expected error from test2 provider")
 	}
 }
+
+func TestManagerPeriodicSync(t *testing.T) {
+	newManager := func(t *testing.T, periodicSyncEnabled bool) (*Manager, *mockEC2) {
+		repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+
+		cfg := &config.Config{
+			CloudProviders: config.CloudProvidersConfig{
+				Enabled:             true,
+				SyncInterval:        "10ms",
+				PeriodicSyncEnabled: &periodicSyncEnabled,
+			},
+		}
+
+		// Register a region directly, bypassing credential validation
+		api := &mockEC2{}
+		client := aws.NewClientWithEC2(api, aws.AWSConfig{Region: "eu-west-1"})
+		manager := NewManager(cfg, repo)
+		manager.awsClients["eu-west-1"] = client
+		manager.awsSyncs["eu-west-1"] = aws.NewSyncService(client, repo)
+
+		return manager, api
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		manager, api := newManager(t, false)
+		ctx := context.Background()
+
+		if err := manager.Start(ctx); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		manager.Stop()
+
+		if calls := api.vpcCalls.Load(); calls != 0 {
+			t.Fatalf("Expected no sync while periodic sync is disabled, got %d", calls)
+		}
+
+		// Manual sync keeps working
+		if _, err := manager.SyncAll(ctx); err != nil {
+			t.Fatalf("Manual sync failed: %v", err)
+		}
+		if calls := api.vpcCalls.Load(); calls != 1 {
+			t.Errorf("Expected manual sync to run once, got %d", calls)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		manager, api := newManager(t, true)
+
+		if err := manager.Start(context.Background()); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		manager.Stop()
+
+		// Initial sync plus at least one tick
+		if calls := api.vpcCalls.Load(); calls < 2 {
+			t.Errorf("Expected the ticker to sync, got %d syncs", calls)
+		}
+	})
+}
+
+func TestManagerSyncProviders(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, repo)
+
+	var synced []string
+	manager.SetSyncObserver(func(provider string, failed int, err error) {
+		synced = append(synced, provider)
+	})
+
+	provider := &mockProvider{name: "Test Provider", providerType: "test"}
+	if err := manager.RegisterProvider(provider, CloudCredentials{Provider: "test", Region: "us-east-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	// Syncing twice updates the subnet instead of duplicating it
+	for i := 0; i < 2; i++ {
+		if _, err := manager.SyncAll(ctx); err != nil {
+			t.Fatalf("SyncAll failed: %v", err)
+		}
+	}
+
+	result, err := repo.ListSubnets(ctx, repository.SubnetFilters{CloudProvider: "test"})
+	if err != nil {
+		t.Fatalf("ListSubnets failed: %v", err)
+	}
+	if len(result.Subnets) != 1 {
+		t.Fatalf("Expected 1 synced subnet, got %d", len(result.Subnets))
+	}
+
+	subnet := result.Subnets[0]
+	if subnet.CIDR != "10.0.0.0/24" || subnet.Name != "test-subnet" || subnet.LocationType != "cloud" {
+		t.Errorf("Unexpected synced subnet: %+v", subnet)
+	}
+	if subnet.CloudInfo == nil || subnet.CloudInfo.Region != "us-east-1" || subnet.CloudInfo.AccountID != "123456" {
+		t.Errorf("Unexpected cloud info: %+v", subnet.CloudInfo)
+	}
+	if len(synced) != 2 || synced[0] != "test" {
+		t.Errorf("Expected the observer to see two test syncs, got %v", synced)
+	}
+
+	t.Run("fetch failure", func(t *testing.T) {
+		provider.fetchError = ErrAuthenticationFailed
+		defer func() { provider.fetchError = nil }()
+
+		if _, err := manager.SyncAll(ctx); err == nil {
+			t.Error("Expected SyncAll to report the provider failure")
+		}
+	})
+
+	t.Run("aws subnets", func(t *testing.T) {
+		api := &mockEC2{subnets: []ec2types.Subnet{{
+			SubnetId:  awssdk.String("subnet-1"),
+			CidrBlock: awssdk.String("10.9.0.0/24"),
+			VpcId:     awssdk.String("vpc-1"),
+		}}}
+		client := aws.NewClientWithEC2(api, aws.AWSConfig{Region: "eu-west-1"})
+		manager.awsClients["eu-west-1"] = client
+		manager.awsSyncs["eu-west-1"] = aws.NewSyncService(client, repo)
+
+		if _, err := manager.SyncAll(ctx); err != nil {
+			t.Fatalf("SyncAll failed: %v", err)
+		}
+
+		subnet, err := repo.GetSubnetByCIDR(ctx, "10.9.0.0/24")
+		if err != nil {
+			t.Fatalf("Expected the AWS subnet to be synced: %v", err)
+		}
+		if subnet.CloudInfo == nil || subnet.CloudInfo.Provider != "aws" || subnet.CloudInfo.SubnetId != "subnet-1" {
+			t.Errorf("Unexpected cloud info: %+v", subnet.CloudInfo)
+		}
+	})
+}
+
+func TestManagerSyncIgnoresUnconfiguredRegions(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, repo)
+
+	provider := &mockProvider{name: "Test Provider", providerType: "test", subnets: []*CloudSubnet{
+		{ID: "subnet-1", CIDR: "10.0.1.0/24", Region: "us-east-1"},
+		{ID: "subnet-2", CIDR: "10.0.2.0/24", Region: "eu-west-1"},
+		{ID: "subnet-3", CIDR: "10.0.3.0/24", Region: "ap-south-1"},
+		{ID: "subnet-4", CIDR: "10.0.4.0/24"},
+	}}
+	err = manager.RegisterProvider(provider,
+		CloudCredentials{Provider: "test", Region: "us-east-1"},
+		CloudCredentials{Provider: "test", Region: "eu-west-1"},
+	)
+	if err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	if _, err := manager.SyncAll(ctx); err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+
+	result, err := repo.ListSubnets(ctx, repository.SubnetFilters{CloudProvider: "test"})
+	if err != nil {
+		t.Fatalf("ListSubnets failed: %v", err)
+	}
+	var cidrs []string
+	for _, subnet := range result.Subnets {
+		cidrs = append(cidrs, subnet.CIDR)
+	}
+	slices.Sort(cidrs)
+
+	// Subnets without a region cannot be scoped, so they are kept
+	want := []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.4.0/24"}
+	if !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("Expected only configured regions to be stored %v, got %v", want, cidrs)
+	}
+}
+
+func TestUpsertCloudSubnetManualConflict(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	manual := &repository.Subnet{ID: "dc-subnet", CIDR: "10.7.0.0/24", Name: "Datacenter", Location: "paris", LocationType: "datacenter"}
+	if err := repo.CreateSubnet(ctx, manual); err != nil {
+		t.Fatalf("Failed to create manual subnet: %v", err)
+	}
+	cloudSubnet := &CloudSubnet{ID: "subnet-1", CIDR: "10.7.0.0/24", Region: "westeurope", AccountID: "sub-1"}
+
+	stats := &aws.SyncStats{}
+	if err := upsertCloudSubnet(ctx, repo, ProviderAzure, cloudSubnet, nil, false, time.Now(), stats); err != nil {
+		t.Fatalf("upsertCloudSubnet failed: %v", err)
+	}
+	got, err := repo.GetSubnetByID(ctx, manual.ID)
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	if stats.SubnetsSkipped != 1 || got.LocationType != "datacenter" || got.Location != "paris" {
+		t.Errorf("Expected the manual subnet to be skipped, got %+v and %+v", stats, got)
+	}
+
+	stats = &aws.SyncStats{}
+	if err := upsertCloudSubnet(ctx, repo, ProviderAzure, cloudSubnet, nil, true, time.Now(), stats); err != nil {
+		t.Fatalf("upsertCloudSubnet failed: %v", err)
+	}
+	got, err = repo.GetSubnetByID(ctx, manual.ID)
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	if stats.SubnetsUpdated != 1 || got.LocationType != "cloud" || got.Location != "westeurope" {
+		t.Errorf("Expected the manual subnet to be overwritten, got %+v and %+v", stats, got)
+	}
+}
+
+func TestUpsertCloudSubnetTagsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cloudSubnet := &CloudSubnet{
+		ID:        "subnet-0abc",
+		CIDR:      "10.8.0.0/24",
+		Region:    "eu-west-1",
+		AccountID: "123456789012",
+		Tags:      map[string]string{"Name": "private-a", "Environment": "prod"},
+	}
+	if err := upsertCloudSubnet(ctx, repo, ProviderAWS, cloudSubnet, nil, false, time.Now(), &aws.SyncStats{}); err != nil {
+		t.Fatalf("upsertCloudSubnet failed: %v", err)
+	}
+	got, err := repo.GetSubnetByCIDR(ctx, cloudSubnet.CIDR)
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	if !reflect.DeepEqual(got.Tags, cloudSubnet.Tags) {
+		t.Errorf("Expected synced tags %v, got %v", cloudSubnet.Tags, got.Tags)
+	}
+
+	// A later sync replaces the tags of the existing subnet
+	cloudSubnet.Tags = map[string]string{"Name": "private-a", "Environment": "staging"}
+	if err := upsertCloudSubnet(ctx, repo, ProviderAWS, cloudSubnet, nil, false, time.Now(), &aws.SyncStats{}); err != nil {
+		t.Fatalf("upsertCloudSubnet failed: %v", err)
+	}
+	got, err = repo.GetSubnetByID(ctx, got.ID)
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	if !reflect.DeepEqual(got.Tags, cloudSubnet.Tags) {
+		t.Errorf("Expected resynced tags %v, got %v", cloudSubnet.Tags, got.Tags)
+	}
+}
+
+func TestUpsertCloudSubnetNormalizesCIDR(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cloudSubnet := &CloudSubnet{ID: "subnet-host-bits", CIDR: "10.9.0.17/24", Region: "europe-west1", AccountID: "project-1"}
+	stats := &aws.SyncStats{}
+	if err := upsertCloudSubnet(ctx, repo, ProviderGCP, cloudSubnet, nil, false, time.Now(), stats); err != nil {
+		t.Fatalf("upsertCloudSubnet failed: %v", err)
+	}
+	got, err := repo.GetSubnetByCIDR(ctx, "10.9.0.0/24")
+	if err != nil || stats.SubnetsCreated != 1 {
+		t.Fatalf("Expected the subnet to be stored as 10.9.0.0/24, got %+v (%v)", stats, err)
+	}
+	if got.CloudInfo == nil || got.CloudInfo.SubnetId != "subnet-host-bits" {
+		t.Errorf("Expected the cloud info to be kept, got %+v", got.CloudInfo)
+	}
+
+	// A later sync reporting the same CIDR updates the normalized subnet
+	stats = &aws.SyncStats{}
+	if err := upsertCloudSubnet(ctx, repo, ProviderGCP, cloudSubnet, nil, false, time.Now(), stats); err != nil {
+		t.Fatalf("upsertCloudSubnet failed: %v", err)
+	}
+	if stats.SubnetsUpdated != 1 || stats.SubnetsCreated != 0 {
+		t.Errorf("Expected the resync to update the stored subnet, got %+v", stats)
+	}
+}
+
+func TestSyncAttachesSubnetsToTheirNetwork(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	for _, network := range []*repository.Subnet{
+		{ID: "vnet-a", CIDR: "10.10.0.0/16", Name: "vnet", LocationType: "cloud",
+			CloudInfo: &repository.CloudInfo{Provider: "test", AccountID: "sub-a", ResourceType: "vpc", VPCId: "vnet"}},
+		{ID: "vnet-b", CIDR: "10.20.0.0/16", Name: "vnet", LocationType: "cloud",
+			CloudInfo: &repository.CloudInfo{Provider: "test", AccountID: "sub-b", ResourceType: "vpc", VPCId: "vnet"}},
+	} {
+		if err := repo.CreateSubnet(ctx, network); err != nil {
+			t.Fatalf("Failed to create network: %v", err)
+		}
+	}
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, repo)
+	provider := &mockProvider{name: "Test Provider", providerType: "test", subnets: []*CloudSubnet{
+		{ID: "subnet-a", CIDR: "10.10.1.0/24", Region: "westeurope", AccountID: "sub-a", VPCId: "vnet"},
+		{ID: "subnet-b", CIDR: "10.20.1.0/24", Region: "westeurope", AccountID: "sub-b", VPCId: "vnet"},
+		{ID: "subnet-c", CIDR: "10.30.1.0/24", Region: "westeurope", AccountID: "sub-c", VPCId: "vnet"},
+	}}
+	if err := manager.RegisterProvider(provider, CloudCredentials{Provider: "test", Region: "westeurope"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	if _, err := manager.SyncProvider(ctx, "test", false); err != nil {
+		t.Fatalf("SyncProvider failed: %v", err)
+	}
+	for cidr, wantParent := range map[string]string{"10.10.1.0/24": "vnet-a", "10.20.1.0/24": "vnet-b", "10.30.1.0/24": ""} {
+		subnet, err := repo.GetSubnetByCIDR(ctx, cidr)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", cidr, err)
+		}
+		if subnet.ParentID != wantParent {
+			t.Errorf("Expected %s to be attached to %q, got %q", cidr, wantParent, subnet.ParentID)
+		}
+	}
+
+	if _, err := manager.SyncProvider(ctx, ProviderGCP, false); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("Expected ErrProviderNotFound for a provider without credentials, got %v", err)
+	}
+}
+
+func TestManagerListProviderStatus(t *testing.T) {
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, nil)
+	manager.credentials[ProviderAzure] = []CloudCredentials{{Provider: ProviderAzure, Region: "westeurope"}}
+
+	want := map[CloudProviderType]bool{
+		ProviderAWS:      true,
+		ProviderAzure:    true,
+		ProviderGCP:      true,
+		ProviderScaleway: false,
+		ProviderOVH:      false,
+	}
+
+	statuses := manager.ListProviderStatus()
+	if len(statuses) != len(want) {
+		t.Fatalf("Expected %d providers, got %d", len(want), len(statuses))
+	}
+	for _, status := range statuses {
+		if implemented, ok := want[status.Type]; !ok || status.Implemented != implemented {
+			t.Errorf("Expected %s implemented=%v, got %v", status.Type, implemented, status.Implemented)
+		}
+		if status.Type == ProviderAzure && (!status.Enabled || len(status.Regions) != 1 || status.Regions[0] != "westeurope") {
+			t.Errorf("Expected Azure to be enabled in westeurope, got %+v", status)
+		}
+		if status.Type == ProviderGCP && (status.Enabled || status.Regions == nil) {
+			t.Errorf("Expected GCP to be disabled with no regions, got %+v", status)
+		}
+	}
+}
+
+func TestManagerSyncAllStats(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	existing := &repository.Subnet{ID: "synced", CIDR: "10.10.1.0/24", Name: "synced", Location: "eu-west-1", LocationType: "cloud"}
+	if err := repo.CreateSubnet(ctx, existing); err != nil {
+		t.Fatalf("Failed to create existing subnet: %v", err)
+	}
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, repo)
+
+	// Each region is registered directly, bypassing credential validation
+	regions := map[string][]ec2types.Subnet{
+		"eu-west-1": {
+			{SubnetId: awssdk.String("subnet-1"), CidrBlock: awssdk.String("10.10.1.0/24"), VpcId: awssdk.String("vpc-1")},
+			{SubnetId: awssdk.String("subnet-2"), CidrBlock: awssdk.String("10.10.2.0/24"), VpcId: awssdk.String("vpc-1")},
+		},
+		"us-east-1": {
+			{SubnetId: awssdk.String("subnet-3"), CidrBlock: awssdk.String("10.20.1.0/24"), VpcId: awssdk.String("vpc-2")},
+		},
+	}
+	for region, subnets := range regions {
+		client := aws.NewClientWithEC2(&mockEC2{subnets: subnets}, aws.AWSConfig{Region: region})
+		manager.awsClients[region] = client
+		manager.awsSyncs[region] = aws.NewSyncService(client, repo)
+	}
+
+	stats, err := manager.SyncAll(ctx)
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	if stats.SubnetsCreated != 2 || stats.SubnetsUpdated != 1 || stats.Errors != 0 {
+		t.Errorf("Expected 2 created and 1 updated across regions, got %+v", stats)
+	}
+}
+
+// failingRepository fails to create subnets with the listed CIDRs
+type failingRepository struct {
+	repository.SubnetRepository
+	failCIDRs map[string]bool
+}
+
+func (r *failingRepository) CreateSubnet(ctx context.Context, subnet *repository.Subnet) error {
+	if r.failCIDRs[subnet.CIDR] {
+		return errors.New("disk full")
+	}
+	return r.SubnetRepository.CreateSubnet(ctx, subnet)
+}
+
+func TestManagerSyncReportsResourceFailures(t *testing.T) {
+	ctx := context.Background()
+
+	sqliteRepo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { sqliteRepo.Close() })
+	repo := &failingRepository{SubnetRepository: sqliteRepo, failCIDRs: map[string]bool{"10.0.2.0/24": true, "10.0.3.0/24": true}}
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, repo)
+
+	var observed []int
+	manager.SetSyncObserver(func(provider string, failed int, err error) {
+		observed = append(observed, failed)
+	})
+
+	provider := &mockProvider{name: "Test Provider", providerType: "test", subnets: []*CloudSubnet{
+		{ID: "subnet-1", CIDR: "10.0.1.0/24", Region: "us-east-1"},
+		{ID: "subnet-2", CIDR: "10.0.2.0/24", Region: "us-east-1"},
+		{ID: "subnet-3", CIDR: "10.0.3.0/24", Region: "us-east-1"},
+	}}
+	if err := manager.RegisterProvider(provider, CloudCredentials{Provider: "test", Region: "us-east-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	stats, err := manager.SyncAll(ctx)
+	if err != nil {
+		t.Fatalf("Expected resource failures not to fail the sync, got %v", err)
+	}
+	if stats.SubnetsCreated != 1 || stats.Synced() != 1 || stats.Errors != 2 {
+		t.Errorf("Expected 1 synced and 2 failed, got %+v", stats)
+	}
+
+	want := []aws.SyncFailure{
+		{Provider: "test", Region: "us-east-1", ResourceID: "subnet-2", CIDR: "10.0.2.0/24", Error: "disk full"},
+		{Provider: "test", Region: "us-east-1", ResourceID: "subnet-3", CIDR: "10.0.3.0/24", Error: "disk full"},
+	}
+	if !reflect.DeepEqual(stats.Failures, want) {
+		t.Errorf("Expected failures %+v, got %+v", want, stats.Failures)
+	}
+	if !reflect.DeepEqual(observed, []int{2}) {
+		t.Errorf("Expected the observer to see 2 failed resources, got %v", observed)
+	}
+}
+
+func TestSyncStatsCapsFailures(t *testing.T) {
+	stats := &aws.SyncStats{}
+	for i := 0; i < aws.MaxSyncFailures; i++ {
+		stats.Fail(aws.SyncFailure{Provider: "test", Error: "failed"})
+	}
+	other := &aws.SyncStats{}
+	other.Fail(aws.SyncFailure{Provider: "test", Error: "one too many"})
+	stats.Add(other)
+
+	if stats.Errors != aws.MaxSyncFailures+1 || len(stats.Failures) != aws.MaxSyncFailures {
+		t.Errorf("Expected %d errors with %d described, got %d with %d", aws.MaxSyncFailures+1, aws.MaxSyncFailures, stats.Errors, len(stats.Failures))
+	}
+}
+
+// blockingProvider is a mock provider whose fetches block until released
+type blockingProvider struct {
+	mockProvider
+	started chan struct{}
+	release chan struct{}
+	fetches atomic.Int32
+}
+
+func (p *blockingProvider) FetchSubnets(ctx context.Context, credentials CloudCredentials) ([]*CloudSubnet, error) {
+	p.fetches.Add(1)
+	p.started <- struct{}{}
+	<-p.release
+	return p.mockProvider.FetchSubnets(ctx, credentials)
+}
+
+func TestManagerSyncAllDoesNotOverlap(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := NewManager(cfg, repo)
+
+	provider := &blockingProvider{
+		mockProvider: mockProvider{name: "Test Provider", providerType: "test"},
+		started:      make(chan struct{}, 1),
+		release:      make(chan struct{}),
+	}
+	if err := manager.RegisterProvider(provider, CloudCredentials{Provider: "test", Region: "us-east-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.SyncAll(ctx)
+		done <- err
+	}()
+	<-provider.started
+
+	if state := manager.SyncState(); !state.InProgress || state.LastStarted.IsZero() {
+		t.Errorf("Expected a sync in progress, got %+v", state)
+	}
+
+	// A second sync either fails fast or waits for the running one
+	if _, err := manager.TrySyncAll(ctx); !errors.Is(err, ErrSyncInProgress) {
+		t.Errorf("Expected ErrSyncInProgress, got %v", err)
+	}
+	if _, err := manager.SyncAWSRegion(ctx, "us-east-1"); !errors.Is(err, ErrSyncInProgress) {
+		t.Errorf("Expected a region sync to report ErrSyncInProgress, got %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := manager.SyncAll(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the waiting sync to give up with its context, got %v", err)
+	}
+
+	close(provider.release)
+	if err := <-done; err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+
+	if fetches := provider.fetches.Load(); fetches != 1 {
+		t.Errorf("Expected only one sync to fetch, got %d fetches", fetches)
+	}
+	state := manager.SyncState()
+	if state.InProgress || state.LastCompleted.Before(state.LastStarted) {
+		t.Errorf("Expected the sync to be completed, got %+v", state)
+	}
+
+	// The slot is free again once the sync completes
+	if _, err := manager.TrySyncAll(ctx); err != nil {
+		t.Errorf("Expected a sync after completion to run, got %v", err)
+	}
+}
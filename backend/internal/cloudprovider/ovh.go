@@ -61,6 +61,11 @@ func (p *OVHProvider) GetRegions() []string {
 	}
 }
 
+// Implemented reports that OVH subnet fetching is still a stub
+func (p *OVHProvider) Implemented() bool {
+	return false
+}
+
 // ValidateCredentials checks if the provided OVH credentials are valid
 func (p *OVHProvider) ValidateCredentials(ctx context.Context, credentials CloudCredentials) error {
 	if credentials.Provider != ProviderOVH {
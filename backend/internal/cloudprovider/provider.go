@@ -12,6 +12,7 @@ var (
 	ErrAuthenticationFailed = errors.New("authentication failed")
 	ErrRateLimited          = errors.New("rate limited by provider")
 	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrSyncInProgress       = errors.New("cloud sync already in progress")
 )
 
 // CloudProviderType represents the type of cloud provider
@@ -38,6 +39,7 @@ type CloudCredentials struct {
 
 // CloudSubnet represents a subnet fetched from a cloud provider
 type CloudSubnet struct {
+	ID        string // Provider resource ID of the subnet, when known
 	CIDR      string
 	Name      string
 	Region    string
@@ -62,4 +64,8 @@ type CloudProvider interface {
 
 	// ValidateCredentials checks if the provided credentials are valid
 	ValidateCredentials(ctx context.Context, credentials CloudCredentials) error
+
+	// Implemented reports whether FetchSubnets calls the provider's API rather
+	// than being a stub that always returns ErrProviderUnavailable
+	Implemented() bool
 }
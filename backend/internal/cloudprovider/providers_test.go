@@ -3,7 +3,22 @@ package cloudprovider
 import (
 	"context"
 	"errors"
+	"reflect"
+	"sync/atomic"
 	"testing"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v6"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider/aws"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestAWSProvider(t *testing.T) {
@@ -78,7 +93,7 @@ func TestAWSProvider(t *testing.T) {
 		}
 	})
 
-	t.Run("FetchSubnets - not implemented", func(t *testing.T) {
+	t.Run("FetchSubnets - missing region", func(t *testing.T) {
 		ctx := context.Background()
 		credentials := CloudCredentials{
 			Provider:  ProviderAWS,
@@ -86,8 +101,119 @@ func TestAWSProvider(t *testing.T) {
 			SecretKey: "test-secret-key",
 		}
 		_, err := provider.FetchSubnets(ctx, credentials)
-		if err == nil {
-			t.Error("FetchSubnets() expected error for unimplemented feature, got nil")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+}
+
+// mockEC2 is a mock implementation of aws.EC2API for testing
+type mockEC2 struct {
+	subnets     []ec2types.Subnet
+	describeErr error
+	vpcCalls    atomic.Int32
+}
+
+func (m *mockEC2) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	m.vpcCalls.Add(1)
+	return &ec2.DescribeVpcsOutput{}, nil
+}
+
+func (m *mockEC2) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	if m.describeErr != nil {
+		return nil, m.describeErr
+	}
+	return &ec2.DescribeSubnetsOutput{Subnets: m.subnets}, nil
+}
+
+func TestAWSProviderFetchSubnets(t *testing.T) {
+	ctx := context.Background()
+	credentials := CloudCredentials{
+		Provider:  ProviderAWS,
+		AccessKey: "test-access-key",
+		SecretKey: "test-secret-key",
+		Region:    "eu-west-1",
+	}
+
+	newProvider := func(api aws.EC2API, gotConfig *aws.AWSConfig) *AWSProvider {
+		provider := NewAWSProvider()
+		provider.newClient = func(ctx context.Context, cfg aws.AWSConfig) (*aws.Client, error) {
+			*gotConfig = cfg
+			return aws.NewClientWithEC2(api, cfg), nil
+		}
+		return provider
+	}
+
+	t.Run("maps subnets", func(t *testing.T) {
+		api := &mockEC2{
+			subnets: []ec2types.Subnet{
+				{
+					SubnetId:  awssdk.String("subnet-1"),
+					CidrBlock: awssdk.String("10.0.1.0/24"),
+					VpcId:     awssdk.String("vpc-1"),
+					Tags: []ec2types.Tag{
+						{Key: awssdk.String("Name"), Value: awssdk.String("app-a")},
+						{Key: awssdk.String("env"), Value: awssdk.String("prod")},
+					},
+				},
+				{
+					SubnetId:  awssdk.String("subnet-2"),
+					CidrBlock: awssdk.String("10.0.2.0/24"),
+					VpcId:     awssdk.String("vpc-1"),
+				},
+			},
+		}
+
+		var gotConfig aws.AWSConfig
+		subnets, err := newProvider(api, &gotConfig).FetchSubnets(ctx, credentials)
+		if err != nil {
+			t.Fatalf("FetchSubnets() error = %v", err)
+		}
+
+		if gotConfig.Region != "eu-west-1" || gotConfig.AccessKeyID != "test-access-key" || gotConfig.SecretAccessKey != "test-secret-key" {
+			t.Errorf("Client built with unexpected config: %+v", gotConfig)
+		}
+
+		if len(subnets) != 2 {
+			t.Fatalf("Expected 2 subnets, got %d", len(subnets))
+		}
+
+		first := subnets[0]
+		if first.CIDR != "10.0.1.0/24" || first.Name != "app-a" || first.Region != "eu-west-1" || first.VPCId != "vpc-1" {
+			t.Errorf("Unexpected first subnet: %+v", first)
+		}
+		if first.Tags["env"] != "prod" || first.Tags["Name"] != "app-a" {
+			t.Errorf("Unexpected first subnet tags: %v", first.Tags)
+		}
+
+		// Subnets without a Name tag fall back to their ID
+		if subnets[1].Name != "subnet-2" {
+			t.Errorf("Expected name subnet-2, got %s", subnets[1].Name)
+		}
+	})
+
+	t.Run("EC2 failure", func(t *testing.T) {
+		var gotConfig aws.AWSConfig
+		api := &mockEC2{describeErr: errors.New("throttled")}
+		_, err := newProvider(api, &gotConfig).FetchSubnets(ctx, credentials)
+		if !errors.Is(err, ErrProviderUnavailable) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrProviderUnavailable)
+		}
+	})
+
+	t.Run("through the registry", func(t *testing.T) {
+		var gotConfig aws.AWSConfig
+		manager := NewCloudProviderManager()
+		if err := manager.Register(newProvider(&mockEC2{subnets: []ec2types.Subnet{{CidrBlock: awssdk.String("10.0.3.0/24")}}}, &gotConfig)); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		subnets, err := manager.FetchSubnetsFromProvider(ctx, ProviderAWS, credentials)
+		if err != nil {
+			t.Fatalf("FetchSubnetsFromProvider() error = %v", err)
+		}
+		if len(subnets) != 1 || subnets[0].CIDR != "10.0.3.0/24" {
+			t.Errorf("Unexpected subnets: %+v", subnets)
 		}
 	})
 }
@@ -140,6 +266,141 @@ func TestAzureProvider(t *testing.T) {
 	})
 }
 
+// fakeAzureNetwork is a fake implementation of AzureNetworkAPI for testing
+type fakeAzureNetwork struct {
+	vnets   []*armnetwork.VirtualNetwork
+	listErr error
+}
+
+func (f *fakeAzureNetwork) ListVirtualNetworks(ctx context.Context) ([]*armnetwork.VirtualNetwork, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	return f.vnets, nil
+}
+
+func TestAzureProviderFetchSubnets(t *testing.T) {
+	fake := &fakeAzureNetwork{
+		vnets: []*armnetwork.VirtualNetwork{
+			{
+				ID:       to.Ptr("/subscriptions/sub-1/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/prod"),
+				Location: to.Ptr("westeurope"),
+				Tags:     map[string]*string{"env": to.Ptr("prod")},
+				Properties: &armnetwork.VirtualNetworkPropertiesFormat{
+					Subnets: []*armnetwork.Subnet{
+						{Name: to.Ptr("app"), Properties: &armnetwork.SubnetPropertiesFormat{AddressPrefix: to.Ptr("10.1.0.0/24")}},
+						{Name: to.Ptr("data"), Properties: &armnetwork.SubnetPropertiesFormat{AddressPrefixes: []*string{to.Ptr("10.1.1.0/24")}}},
+					},
+				},
+			},
+			{
+				ID:       to.Ptr("/subscriptions/sub-1/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/dr"),
+				Location: to.Ptr("East US"),
+				Properties: &armnetwork.VirtualNetworkPropertiesFormat{
+					Subnets: []*armnetwork.Subnet{
+						{Name: to.Ptr("dr"), Properties: &armnetwork.SubnetPropertiesFormat{AddressPrefix: to.Ptr("10.2.0.0/24")}},
+					},
+				},
+			},
+			{
+				Location: to.Ptr("mars-central"),
+				Properties: &armnetwork.VirtualNetworkPropertiesFormat{
+					Subnets: []*armnetwork.Subnet{
+						{Name: to.Ptr("unknown"), Properties: &armnetwork.SubnetPropertiesFormat{AddressPrefix: to.Ptr("10.3.0.0/24")}},
+					},
+				},
+			},
+		},
+	}
+
+	var gotSubscription string
+	provider := NewAzureProvider()
+	provider.newClient = func(subscriptionID string, credential azcore.TokenCredential) (AzureNetworkAPI, error) {
+		gotSubscription = subscriptionID
+		return fake, nil
+	}
+
+	credentials := CloudCredentials{
+		Provider: ProviderAzure,
+		Token:    "test-token",
+		Extra:    map[string]string{"subscription_id": "sub-1"},
+	}
+
+	t.Run("all known regions", func(t *testing.T) {
+		subnets, err := provider.FetchSubnets(context.Background(), credentials)
+		if err != nil {
+			t.Fatalf("FetchSubnets() error = %v", err)
+		}
+		if gotSubscription != "sub-1" {
+			t.Errorf("Expected subscription sub-1, got %q", gotSubscription)
+		}
+		if len(subnets) != 3 {
+			t.Fatalf("Expected 3 subnets from known regions, got %d", len(subnets))
+		}
+		first := subnets[0]
+		if first.CIDR != "10.1.0.0/24" || first.Name != "app" || first.Region != "westeurope" || first.AccountID != "sub-1" {
+			t.Errorf("Unexpected subnet mapping: %+v", first)
+		}
+		if first.Tags["env"] != "prod" {
+			t.Errorf("Expected virtual network tags on the subnet, got %v", first.Tags)
+		}
+		if subnets[1].CIDR != "10.1.1.0/24" {
+			t.Errorf("Expected AddressPrefixes fallback, got %s", subnets[1].CIDR)
+		}
+		if subnets[2].Region != "eastus" {
+			t.Errorf("Expected normalized region eastus, got %s", subnets[2].Region)
+		}
+	})
+
+	t.Run("region filter", func(t *testing.T) {
+		regional := credentials
+		regional.Region = "eastus"
+		subnets, err := provider.FetchSubnets(context.Background(), regional)
+		if err != nil {
+			t.Fatalf("FetchSubnets() error = %v", err)
+		}
+		if len(subnets) != 1 || subnets[0].CIDR != "10.2.0.0/24" {
+			t.Errorf("Expected only the eastus subnet, got %+v", subnets)
+		}
+	})
+
+	t.Run("unknown region", func(t *testing.T) {
+		regional := credentials
+		regional.Region = "mars-central"
+		if _, err := provider.FetchSubnets(context.Background(), regional); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("missing subscription", func(t *testing.T) {
+		noSubscription := credentials
+		noSubscription.Extra = nil
+		if _, err := provider.FetchSubnets(context.Background(), noSubscription); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("authentication failure", func(t *testing.T) {
+		fake.listErr = &azcore.ResponseError{StatusCode: 401, ErrorCode: "InvalidAuthenticationToken"}
+		defer func() { fake.listErr = nil }()
+
+		if _, err := provider.FetchSubnets(context.Background(), credentials); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrAuthenticationFailed)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := provider.FetchSubnets(ctx, credentials); !errors.Is(err, context.Canceled) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
 func TestGCPProvider(t *testing.T) {
 	provider := NewGCPProvider()
 
@@ -175,6 +436,148 @@ func TestGCPProvider(t *testing.T) {
 			t.Errorf("ValidateCredentials() error = %v, want nil", err)
 		}
 	})
+
+	t.Run("ValidateCredentials - service account key", func(t *testing.T) {
+		credentials := CloudCredentials{
+			Provider: ProviderGCP,
+			Extra:    map[string]string{"credentials_json": `{"type": "service_account"}`},
+		}
+		if err := provider.ValidateCredentials(context.Background(), credentials); err != nil {
+			t.Errorf("ValidateCredentials() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("ValidateCredentials - missing token", func(t *testing.T) {
+		credentials := CloudCredentials{Provider: ProviderGCP}
+		if err := provider.ValidateCredentials(context.Background(), credentials); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("ValidateCredentials() error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+}
+
+// fakeGCPSubnetworks is a fake implementation of GCPSubnetworksAPI for testing
+type fakeGCPSubnetworks struct {
+	subnetworks map[string][]*computepb.Subnetwork // Keyed by region
+	listErr     error
+	projects    []string
+}
+
+func (f *fakeGCPSubnetworks) ListSubnetworks(ctx context.Context, project, region string) ([]*computepb.Subnetwork, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	f.projects = append(f.projects, project)
+	return f.subnetworks[region], nil
+}
+
+func (f *fakeGCPSubnetworks) Close() error {
+	return nil
+}
+
+func TestGCPProviderFetchSubnets(t *testing.T) {
+	fake := &fakeGCPSubnetworks{
+		subnetworks: map[string][]*computepb.Subnetwork{
+			"europe-west1": {
+				{
+					Id:          proto.Uint64(101),
+					Name:        proto.String("app"),
+					IpCidrRange: proto.String("10.10.0.0/24"),
+					Network:     proto.String("https://www.googleapis.com/compute/v1/projects/proj-1/global/networks/prod"),
+				},
+			},
+			"us-central1": {
+				{
+					Id:          proto.Uint64(102),
+					Name:        proto.String("batch"),
+					IpCidrRange: proto.String("10.20.0.0/24"),
+					Network:     proto.String("https://www.googleapis.com/compute/v1/projects/proj-1/global/networks/default"),
+				},
+			},
+		},
+	}
+
+	provider := NewGCPProvider()
+	provider.newClient = func(ctx context.Context, opts ...option.ClientOption) (GCPSubnetworksAPI, error) {
+		return fake, nil
+	}
+
+	credentials := CloudCredentials{
+		Provider: ProviderGCP,
+		Token:    "test-token",
+		Extra:    map[string]string{"project_id": "proj-1"},
+	}
+
+	t.Run("all known regions", func(t *testing.T) {
+		subnets, err := provider.FetchSubnets(context.Background(), credentials)
+		if err != nil {
+			t.Fatalf("FetchSubnets() error = %v", err)
+		}
+		if len(subnets) != 2 {
+			t.Fatalf("Expected 2 subnets, got %d", len(subnets))
+		}
+		// Regions are queried in GetRegions order
+		first := subnets[0]
+		if first.ID != "102" || first.CIDR != "10.20.0.0/24" || first.Name != "batch" || first.Region != "us-central1" || first.VPCId != "default" {
+			t.Errorf("Unexpected subnet mapping: %+v", first)
+		}
+		for _, subnet := range subnets {
+			if subnet.AccountID != "proj-1" {
+				t.Errorf("Expected project proj-1 as account, got %+v", subnet)
+			}
+		}
+		if len(fake.projects) == 0 || fake.projects[0] != "proj-1" {
+			t.Errorf("Expected project proj-1 to be queried, got %v", fake.projects)
+		}
+	})
+
+	t.Run("region filter", func(t *testing.T) {
+		regional := credentials
+		regional.Region = "europe-west1"
+		subnets, err := provider.FetchSubnets(context.Background(), regional)
+		if err != nil {
+			t.Fatalf("FetchSubnets() error = %v", err)
+		}
+		want := &CloudSubnet{ID: "101", CIDR: "10.10.0.0/24", Name: "app", Region: "europe-west1", AccountID: "proj-1", VPCId: "prod"}
+		if len(subnets) != 1 || !reflect.DeepEqual(subnets[0], want) {
+			t.Errorf("Expected only %+v, got %+v", want, subnets)
+		}
+	})
+
+	t.Run("unknown region", func(t *testing.T) {
+		regional := credentials
+		regional.Region = "mars-central1"
+		if _, err := provider.FetchSubnets(context.Background(), regional); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("missing project", func(t *testing.T) {
+		noProject := credentials
+		noProject.Extra = nil
+		if _, err := provider.FetchSubnets(context.Background(), noProject); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("authentication failure", func(t *testing.T) {
+		fake.listErr = &googleapi.Error{Code: 403, Message: "Request had insufficient authentication scopes"}
+		defer func() { fake.listErr = nil }()
+
+		if _, err := provider.FetchSubnets(context.Background(), credentials); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, ErrAuthenticationFailed)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := provider.FetchSubnets(ctx, credentials); !errors.Is(err, context.Canceled) {
+			t.Errorf("FetchSubnets() error = %v, want %v", err, context.Canceled)
+		}
+	})
 }
 
 func TestScalewayProvider(t *testing.T) {
@@ -0,0 +1,123 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider/aws"
+)
+
+// syncHistory records when a provider last synced cleanly and when one of its
+// syncs last failed
+type syncHistory struct {
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+// recordSync notes the outcome of a provider region synchronization for
+// pruning and reports it to the sync observer. A sync that could not store
+// some subnets counts as a failure, since those subnets were not marked seen.
+// Callers must hold m.mu.
+func (m *Manager) recordSync(provider string, stats *aws.SyncStats, err error) {
+	m.historyMu.Lock()
+	history, ok := m.syncHistory[provider]
+	if !ok {
+		history = &syncHistory{}
+		m.syncHistory[provider] = history
+	}
+	failed := 0
+	if stats != nil {
+		failed = stats.Errors
+	}
+	if err != nil || failed > 0 {
+		history.lastFailure = m.now()
+	} else {
+		history.lastSuccess = m.now()
+	}
+	m.historyMu.Unlock()
+
+	m.observeSync(provider, failed, err)
+}
+
+// syncedCleanlySince reports whether a provider synced successfully at or
+// after since without any sync failing in the meantime
+func (m *Manager) syncedCleanlySince(provider string, since time.Time) bool {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	history, ok := m.syncHistory[provider]
+	if !ok {
+		return false
+	}
+	return !history.lastSuccess.Before(since) && history.lastFailure.Before(since)
+}
+
+// PruneStaleSubnets deletes the synced cloud subnets that no sync has seen
+// for the configured threshold and returns how many were deleted. Subnets of
+// a provider are only pruned when it has synced cleanly since the threshold,
+// so a provider outage does not empty the inventory. Deleted subnets can be
+// restored like any soft-deleted subnet.
+func (m *Manager) PruneStaleSubnets(ctx context.Context) (int, error) {
+	staleAfter, err := m.config.CloudProviders.GetPruneStaleAfter()
+	if err != nil {
+		return 0, fmt.Errorf("invalid prune stale threshold: %w", err)
+	}
+	cutoff := m.now().Add(-staleAfter)
+
+	stale, err := m.repository.ListStaleCloudSubnets(ctx, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, subnet := range stale {
+		if subnet.CloudInfo == nil || !m.syncedCleanlySince(subnet.CloudInfo.Provider, cutoff) {
+			continue
+		}
+		if err := m.repository.Delete(ctx, subnet.ID); err != nil {
+			log.Printf("Failed to prune stale %s subnet %s (%s): %v", subnet.CloudInfo.Provider, subnet.ID, subnet.CIDR, err)
+			continue
+		}
+		log.Printf("Pruned %s subnet %s (%s), not seen by a sync since before %s",
+			subnet.CloudInfo.Provider, subnet.ID, subnet.CIDR, cutoff.Format(time.RFC3339))
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// startAutoPrune starts the background pruning of stale cloud subnets
+func (m *Manager) startAutoPrune(ctx context.Context) error {
+	interval, err := m.config.CloudProviders.GetPruneInterval()
+	if err != nil {
+		return fmt.Errorf("invalid prune interval: %w", err)
+	}
+	staleAfter, err := m.config.CloudProviders.GetPruneStaleAfter()
+	if err != nil {
+		return fmt.Errorf("invalid prune stale threshold: %w", err)
+	}
+
+	log.Printf("Starting stale cloud subnet pruning every %v for subnets unseen for %v", interval, staleAfter)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.PruneStaleSubnets(ctx); err != nil {
+					log.Printf("Stale cloud subnet pruning failed: %v", err)
+				}
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/config"
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+func TestPruneStaleSubnets(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{
+		Enabled:      true,
+		SyncInterval: "5m",
+		AutoPrune:    true,
+	}}
+	manager := NewManager(cfg, repo)
+
+	// The fake clock only moves when the test advances it
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	kept := &CloudSubnet{ID: "subnet-kept", CIDR: "10.30.1.0/24", Region: "us-east-1", AccountID: "123456"}
+	removed := &CloudSubnet{ID: "subnet-removed", CIDR: "10.30.2.0/24", Region: "us-east-1", AccountID: "123456"}
+	provider := &mockProvider{name: "Test Provider", providerType: "test", subnets: []*CloudSubnet{kept, removed}}
+	if err := manager.RegisterProvider(provider, CloudCredentials{Provider: "test", Region: "us-east-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	syncAt := func(t *testing.T, at time.Time) {
+		t.Helper()
+		now = at
+		if _, err := manager.SyncAll(ctx); err != nil && provider.fetchError == nil {
+			t.Fatalf("SyncAll failed: %v", err)
+		}
+	}
+	pruneAt := func(t *testing.T, at time.Time) int {
+		t.Helper()
+		now = at
+		pruned, err := manager.PruneStaleSubnets(ctx)
+		if err != nil {
+			t.Fatalf("PruneStaleSubnets failed: %v", err)
+		}
+		return pruned
+	}
+	exists := func(t *testing.T, cidr string) bool {
+		t.Helper()
+		_, err := repo.GetSubnetByCIDR(ctx, cidr)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		return err == nil
+	}
+
+	start := now
+	syncAt(t, start)
+
+	// The provider stops reporting one subnet
+	provider.subnets = []*CloudSubnet{kept}
+	syncAt(t, start.Add(5*time.Minute))
+	syncAt(t, start.Add(10*time.Minute))
+
+	t.Run("not pruned within the threshold", func(t *testing.T) {
+		// The default threshold is three sync intervals
+		if pruned := pruneAt(t, start.Add(14*time.Minute)); pruned != 0 {
+			t.Errorf("Expected nothing to be pruned, got %d", pruned)
+		}
+		if !exists(t, removed.CIDR) {
+			t.Error("Expected the subnet to be kept within the threshold")
+		}
+	})
+
+	t.Run("not pruned while the provider is failing", func(t *testing.T) {
+		provider.fetchError = ErrProviderUnavailable
+		syncAt(t, start.Add(15*time.Minute))
+		provider.fetchError = nil
+
+		if pruned := pruneAt(t, start.Add(16*time.Minute)); pruned != 0 {
+			t.Errorf("Expected nothing to be pruned after a failed sync, got %d", pruned)
+		}
+		if !exists(t, removed.CIDR) {
+			t.Error("Expected the subnet to be kept after a failed sync")
+		}
+	})
+
+	t.Run("pruned after the threshold", func(t *testing.T) {
+		syncAt(t, start.Add(35*time.Minute))
+		if pruned := pruneAt(t, start.Add(36*time.Minute)); pruned != 1 {
+			t.Errorf("Expected one subnet to be pruned, got %d", pruned)
+		}
+		if exists(t, removed.CIDR) {
+			t.Error("Expected the stale subnet to be pruned")
+		}
+		if !exists(t, kept.CIDR) {
+			t.Error("Expected the subnet still reported by the provider to be kept")
+		}
+	})
+
+	t.Run("manual subnets are never pruned", func(t *testing.T) {
+		manual := &repository.Subnet{ID: "manual", CIDR: "10.31.0.0/24", Name: "Manual", Location: "paris", LocationType: "datacenter"}
+		if err := repo.CreateSubnet(ctx, manual); err != nil {
+			t.Fatalf("Failed to create manual subnet: %v", err)
+		}
+		syncAt(t, start.Add(24*time.Hour))
+		if pruned := pruneAt(t, start.Add(24*time.Hour+time.Minute)); pruned != 0 {
+			t.Errorf("Expected nothing to be pruned, got %d", pruned)
+		}
+		if !exists(t, manual.CIDR) {
+			t.Error("Expected the manual subnet to be kept")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// CloudProviderManager manages the registry of cloud providers
+type CloudProviderManager struct {
+	providers map[CloudProviderType]CloudProvider
+	mu        sync.RWMutex
+}
+
+// NewCloudProviderManager creates a new empty cloud provider registry
+func NewCloudProviderManager() *CloudProviderManager {
+	return &CloudProviderManager{
+		providers: make(map[CloudProviderType]CloudProvider),
+	}
+}
+
+// InitializeDefaultProviders creates a registry with all built-in providers registered
+func InitializeDefaultProviders() *CloudProviderManager {
+	manager := NewCloudProviderManager()
+
+	for _, provider := range []CloudProvider{
+		NewAWSProvider(),
+		NewAzureProvider(),
+		NewGCPProvider(),
+		NewScalewayProvider(),
+		NewOVHProvider(),
+	} {
+		// Built-in provider types are unique, so registration cannot fail
+		_ = manager.Register(provider)
+	}
+
+	return manager
+}
+
+// Register adds a provider to the registry
+func (m *CloudProviderManager) Register(provider CloudProvider) error {
+	if provider == nil {
+		return fmt.Errorf("cannot register nil provider")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	providerType := provider.GetType()
+	if _, exists := m.providers[providerType]; exists {
+		return fmt.Errorf("provider %s is already registered", providerType)
+	}
+
+	m.providers[providerType] = provider
+	return nil
+}
+
+// Unregister removes a provider from the registry
+func (m *CloudProviderManager) Unregister(providerType CloudProviderType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.providers[providerType]; !exists {
+		return fmt.Errorf("%w: %s", ErrProviderNotFound, providerType)
+	}
+
+	delete(m.providers, providerType)
+	return nil
+}
+
+// GetProvider retrieves a registered provider by type
+func (m *CloudProviderManager) GetProvider(providerType CloudProviderType) (CloudProvider, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	provider, exists := m.providers[providerType]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotFound, providerType)
+	}
+
+	return provider, nil
+}
+
+// ListProviders returns all registered providers
+func (m *CloudProviderManager) ListProviders() []CloudProvider {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	providers := make([]CloudProvider, 0, len(m.providers))
+	for _, provider := range m.providers {
+		providers = append(providers, provider)
+	}
+
+	return providers
+}
+
+// IsProviderRegistered reports whether a provider type is registered
+func (m *CloudProviderManager) IsProviderRegistered(providerType CloudProviderType) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.providers[providerType]
+	return exists
+}
+
+// FetchSubnetsFromProvider retrieves subnets from a single registered provider
+func (m *CloudProviderManager) FetchSubnetsFromProvider(ctx context.Context, providerType CloudProviderType, credentials CloudCredentials) ([]*CloudSubnet, error) {
+	provider, err := m.GetProvider(providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	subnets, err := provider.FetchSubnets(ctx, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch subnets from %s: %w", providerType, err)
+	}
+
+	return subnets, nil
+}
+
+// FetchSubnetsFromAllProviders retrieves subnets from every provider that has
+// credentials. Failures are collected per provider instead of aborting the run.
+func (m *CloudProviderManager) FetchSubnetsFromAllProviders(ctx context.Context, credentialsMap map[CloudProviderType]CloudCredentials) (map[CloudProviderType][]*CloudSubnet, map[CloudProviderType]error) {
+	results := make(map[CloudProviderType][]*CloudSubnet)
+	errs := make(map[CloudProviderType]error)
+
+	for providerType, credentials := range credentialsMap {
+		subnets, err := m.FetchSubnetsFromProvider(ctx, providerType, credentials)
+		if err != nil {
+			errs[providerType] = err
+			continue
+		}
+		results[providerType] = subnets
+	}
+
+	return results, errs
+}
@@ -53,6 +53,11 @@ func (p *ScalewayProvider) GetRegions() []string {
 	}
 }
 
+// Implemented reports that Scaleway subnet fetching is still a stub
+func (p *ScalewayProvider) Implemented() bool {
+	return false
+}
+
 // ValidateCredentials checks if the provided Scaleway credentials are valid
 func (p *ScalewayProvider) ValidateCredentials(ctx context.Context, credentials CloudCredentials) error {
 	if credentials.Provider != ProviderScaleway {
@@ -0,0 +1,128 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider/aws"
+	"github.com/bananaops/ipam-bananaops/internal/netutil"
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"github.com/google/uuid"
+)
+
+// upsertCloudSubnet records a subnet fetched from a provider and counts the
+// outcome in stats. A subnet with the same CIDR is updated with the cloud
+// information, otherwise a new subnet is created. A CIDR with host bits set is
+// stored as its network address. A matching manually created subnet is skipped
+// unless overwriteManual is set. Subnets are attached to their VPC or virtual
+// network when it is in networks, as loaded by loadNetworks. Stored subnets are
+// marked as seen at seenAt.
+func upsertCloudSubnet(ctx context.Context, repo repository.SubnetRepository, providerType CloudProviderType, cloudSubnet *CloudSubnet, networks map[networkKey]*repository.Subnet, overwriteManual bool, seenAt time.Time, stats *aws.SyncStats) error {
+	cloudInfo := &repository.CloudInfo{
+		Provider:     string(providerType),
+		Region:       cloudSubnet.Region,
+		AccountID:    cloudSubnet.AccountID,
+		ResourceType: "subnet",
+		VPCId:        cloudSubnet.VPCId,
+		SubnetId:     cloudSubnet.ID,
+	}
+
+	cidr := netutil.NormalizeCIDR(string(providerType), cloudSubnet.ID, cloudSubnet.CIDR)
+
+	parentID := ""
+	if parent, ok := networks[networkKey{accountID: cloudSubnet.AccountID, networkID: cloudSubnet.VPCId}]; ok && cloudSubnet.VPCId != "" {
+		parentID = parent.ID
+	}
+
+	existingSubnet, err := repo.GetSubnetByCIDR(ctx, cidr)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("failed to look up subnet: %w", err)
+	}
+
+	if existingSubnet != nil {
+		if existingSubnet.LocationType != "cloud" && !overwriteManual {
+			log.Printf("Skipping %s subnet %s: CIDR %s is already managed manually as subnet %s (%s)",
+				providerType, cloudSubnet.ID, cidr, existingSubnet.ID, existingSubnet.LocationType)
+			stats.SubnetsSkipped++
+			return nil
+		}
+
+		existingSubnet.CloudInfo = cloudInfo
+		existingSubnet.Location = cloudSubnet.Region
+		existingSubnet.LocationType = "cloud"
+		existingSubnet.UpdatedAt = time.Now()
+		if parentID != "" {
+			existingSubnet.ParentID = parentID
+		}
+		if len(cloudSubnet.Tags) > 0 {
+			existingSubnet.Tags = cloudSubnet.Tags
+		}
+
+		if err := repo.UpdateSubnet(ctx, existingSubnet.ID, existingSubnet); err != nil {
+			return err
+		}
+		if err := repo.MarkSubnetSeen(ctx, existingSubnet.ID, seenAt); err != nil {
+			return err
+		}
+		stats.SubnetsUpdated++
+		return nil
+	}
+
+	name := cloudSubnet.Name
+	if name == "" {
+		name = cloudSubnet.ID
+	}
+
+	subnet := &repository.Subnet{
+		ID:           uuid.New().String(),
+		Name:         name,
+		CIDR:         cidr,
+		Location:     cloudSubnet.Region,
+		LocationType: "cloud",
+		CloudInfo:    cloudInfo,
+		ParentID:     parentID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if len(cloudSubnet.Tags) > 0 {
+		subnet.Tags = cloudSubnet.Tags
+	}
+
+	if err := repo.CreateSubnet(ctx, subnet); err != nil {
+		return err
+	}
+	if err := repo.MarkSubnetSeen(ctx, subnet.ID, seenAt); err != nil {
+		return err
+	}
+	stats.SubnetsCreated++
+	return nil
+}
+
+// networkKey identifies a synced VPC or virtual network within an account
+type networkKey struct {
+	accountID string
+	networkID string
+}
+
+// loadNetworks lists the VPCs and virtual networks synced for a provider once,
+// indexed by account and network ID, so subnets can be attached to them
+// without a lookup per subnet
+func loadNetworks(ctx context.Context, repo repository.SubnetRepository, providerType CloudProviderType) (map[networkKey]*repository.Subnet, error) {
+	subnets, err := repo.ListSubnets(ctx, repository.SubnetFilters{
+		CloudProvider: string(providerType),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
+	}
+
+	networks := make(map[networkKey]*repository.Subnet)
+	for _, subnet := range subnets.Subnets {
+		if subnet.CloudInfo != nil && subnet.CloudInfo.ResourceType == "vpc" {
+			networks[networkKey{accountID: subnet.CloudInfo.AccountID, networkID: subnet.CloudInfo.VPCId}] = subnet
+		}
+	}
+	return networks, nil
+}
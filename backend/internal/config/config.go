@@ -1,8 +1,17 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -18,33 +27,81 @@ type Config struct {
 
 // ServerConfig contains server-related configuration
 type ServerConfig struct {
-	Port string `yaml:"port"`
-	Host string `yaml:"host"`
+	Port                string `yaml:"port"`
+	Host                string `yaml:"host"`
+	AdminToken          string `yaml:"admin_token"`            // Bearer token for /api/v1/admin endpoints; empty disables them
+	MaxRequestBodyBytes int    `yaml:"max_request_body_bytes"` // Larger request bodies are rejected with 413; 0 uses 1 MiB
+	StrictJSON          bool   `yaml:"strict_json"`            // Reject request bodies with fields the endpoint does not define
 }
 
 // DatabaseConfig contains database-related configuration
 type DatabaseConfig struct {
-	Type             string `yaml:"type"`              // "sqlite" or "mongodb"
-	Path             string `yaml:"path"`              // For SQLite
-	ConnectionString string `yaml:"connection_string"` // For MongoDB
+	Type                  string `yaml:"type"`                   // "sqlite", "mongodb" or "postgres"
+	Path                  string `yaml:"path"`                   // For SQLite
+	ConnectionString      string `yaml:"connection_string"`      // For MongoDB and PostgreSQL
+	Database              string `yaml:"database"`               // MongoDB database; empty uses "ipam"
+	Collection            string `yaml:"collection"`             // MongoDB subnet collection; empty uses "subnets"
+	ConnectionsCollection string `yaml:"connections_collection"` // MongoDB connection collection; empty uses "connections"
+	TablePrefix           string `yaml:"table_prefix"`           // Prepended to SQLite table and MongoDB collection names
 }
 
 // IPAMConfig contains IPAM-related configuration
 type IPAMConfig struct {
-	DefaultAllocationSize int `yaml:"default_allocation_size"`
+	DefaultAllocationSize     int                      `yaml:"default_allocation_size"`
+	IncludeNetworkBroadcast   bool                     `yaml:"include_network_broadcast"`   // Allow allocating IPv4 network/broadcast addresses
+	MaxTagsPerSubnet          int                      `yaml:"max_tags_per_subnet"`         // Reject subnets with more tags; 0 disables the cap
+	Environments              []string                 `yaml:"environments"`                // Allowed subnet environments; empty uses prod, staging, dev, test
+	MaxSplitSubnets           int                      `yaml:"max_split_subnets"`           // Reject splits producing more subnets; 0 uses the default of 1024
+	AllowSiblingOverlap       bool                     `yaml:"allow_sibling_overlap"`       // Accept children overlapping siblings in another location
+	EncryptionKey             string                   `yaml:"encryption_key"`              // Base64 AES key (16, 24 or 32 bytes) for encrypted tags
+	EncryptedTags             []string                 `yaml:"encrypted_tags"`              // Tag keys whose values are stored encrypted
+	IdempotencyKeyTTL         string                   `yaml:"idempotency_key_ttl"`         // How long an Idempotency-Key replays its result; empty uses 24h
+	SubnetExpiryInterval      string                   `yaml:"subnet_expiry_interval"`      // How often subnets past their TTL are deleted; empty uses 1m
+	UndirectedConnectionTypes []string                 `yaml:"undirected_connection_types"` // Connection types linking both ways, so A-B duplicates B-A
+	UtilizationHistory        UtilizationHistoryConfig `yaml:"utilization_history"`
+	ConnectionMetadata        ConnectionMetadataConfig `yaml:"connection_metadata"`
+}
+
+// ConnectionMetadataConfig restricts connection metadata to a defined schema
+type ConnectionMetadataConfig struct {
+	Enforce     bool              `yaml:"enforce"`      // Reject metadata keys not in allowed_keys or of the wrong type
+	AllowedKeys map[string]string `yaml:"allowed_keys"` // Metadata key to type: string, number, boolean, object, array or any
+}
+
+// ConnectionMetadataTypes lists the types allowed connection metadata keys may declare
+var ConnectionMetadataTypes = []string{"string", "number", "boolean", "object", "array", "any"}
+
+// UtilizationHistoryConfig contains utilization history downsampling configuration
+type UtilizationHistoryConfig struct {
+	CompactionInterval string `yaml:"compaction_interval"` // How often the downsampling job runs
+	MinuteRetention    string `yaml:"minute_retention"`    // Per-minute points are kept this long
+	HourlyRetention    string `yaml:"hourly_retention"`    // Per-hour points are kept this long, per-day beyond
+	MaxSamples         int    `yaml:"max_samples"`         // Samples kept per subnet, oldest pruned first; 0 keeps all
 }
 
 // CloudProvidersConfig contains cloud provider configuration
 type CloudProvidersConfig struct {
-	Enabled      bool      `yaml:"enabled"`
-	SyncInterval string    `yaml:"sync_interval"`
-	AWS          AWSConfig `yaml:"aws"`
+	Enabled             bool           `yaml:"enabled"`
+	SyncInterval        string         `yaml:"sync_interval"`
+	PeriodicSyncEnabled *bool          `yaml:"periodic_sync_enabled"` // Defaults to true; false leaves only on-demand sync
+	OverwriteManual     bool           `yaml:"overwrite_manual"`      // Reclassify manually created subnets as cloud when a synced CIDR matches
+	AutoPrune           bool           `yaml:"auto_prune"`            // Delete cloud subnets no sync has seen for prune_stale_after; defaults to off
+	PruneInterval       string         `yaml:"prune_interval"`        // How often stale cloud subnets are pruned; empty uses 1h
+	PruneStaleAfter     string         `yaml:"prune_stale_after"`     // Time since the last sighting before pruning; empty uses three sync intervals
+	AWS                 AWSConfig      `yaml:"aws"`
+	Azure               ProviderConfig `yaml:"azure"`
+	GCP                 ProviderConfig `yaml:"gcp"`
+	Scaleway            ProviderConfig `yaml:"scaleway"`
+	OVH                 ProviderConfig `yaml:"ovh"`
 }
 
 // AWSConfig contains AWS-specific configuration
 type AWSConfig struct {
-	Enabled bool              `yaml:"enabled"`
-	Regions []AWSRegionConfig `yaml:"regions"`
+	Enabled           bool              `yaml:"enabled"`
+	Regions           []AWSRegionConfig `yaml:"regions"`
+	MaxRetries        int               `yaml:"max_retries"`         // Retries of a throttled EC2 call; 0 uses the client default, negative disables
+	RetryBaseDelay    string            `yaml:"retry_base_delay"`    // First backoff between retries, doubled each time; empty uses the client default
+	IncludeDefaultVPC *bool             `yaml:"include_default_vpc"` // Defaults to true; false skips default VPCs and their subnets during sync
 }
 
 // AWSRegionConfig contains AWS region-specific configuration
@@ -54,7 +111,57 @@ type AWSRegionConfig struct {
 	SecretAccessKey string `yaml:"secret_access_key"`
 }
 
-// LoadConfig loads configuration from a YAML file
+// ProviderConfig contains the configuration of a cloud provider synced through
+// the generic CloudProvider interface
+type ProviderConfig struct {
+	Enabled bool                   `yaml:"enabled"`
+	Regions []ProviderRegionConfig `yaml:"regions"`
+}
+
+// ProviderRegionConfig contains the credentials used to fetch one region or account
+type ProviderRegionConfig struct {
+	Region    string            `yaml:"region"`
+	AccessKey string            `yaml:"access_key"`
+	SecretKey string            `yaml:"secret_key"`
+	Token     string            `yaml:"token"`
+	Extra     map[string]string `yaml:"extra"` // Provider-specific settings, e.g. subscription_id for Azure
+}
+
+// ParseError reports a config file that is not valid YAML for Config
+type ParseError struct {
+	Path string
+	Line int // First line the YAML parser complained about; 0 when unknown
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("failed to parse config file %s at line %d: %v", e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("failed to parse config file %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// yamlLinePattern matches the "line N" position yaml.v3 puts in its error messages
+var yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// TablePrefixPattern matches prefixes that keep table names valid unquoted identifiers
+var TablePrefixPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// newParseError wraps a yaml.v3 error with the line it refers to
+func newParseError(path string, err error) *ParseError {
+	parseErr := &ParseError{Path: path, Err: err}
+	if match := yamlLinePattern.FindStringSubmatch(err.Error()); match != nil {
+		parseErr.Line, _ = strconv.Atoi(match[1])
+	}
+	return parseErr
+}
+
+// LoadConfig loads configuration from a YAML file. A file that cannot be
+// parsed is reported as a *ParseError naming the offending line.
 func LoadConfig(path string) (*Config, error) {
 	// Read config file
 	data, err := os.ReadFile(path)
@@ -65,7 +172,7 @@ func LoadConfig(path string) (*Config, error) {
 	// Parse YAML
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, newParseError(path, err)
 	}
 
 	// Validate configuration
@@ -76,26 +183,81 @@ func LoadConfig(path string) (*Config, error) {
 	return &config, nil
 }
 
+// LoadConfigWithFallback loads configuration from a YAML file like LoadConfig.
+// When the file is malformed and fallbackToEnv is set, the parse error is
+// logged and the configuration is loaded from environment variables instead.
+// Unreadable files and invalid settings are still returned as errors.
+func LoadConfigWithFallback(path string, fallbackToEnv bool) (*Config, error) {
+	config, err := LoadConfig(path)
+	var parseErr *ParseError
+	if err == nil || !fallbackToEnv || !errors.As(err, &parseErr) {
+		return config, err
+	}
+
+	log.Printf("Warning: %v; falling back to environment variables", parseErr)
+	config = LoadConfigFromEnv()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
 // LoadConfigFromEnv loads configuration from environment variables
 func LoadConfigFromEnv() *Config {
+	periodicSyncEnabled := getEnv("CLOUD_PERIODIC_SYNC_ENABLED", "true") == "true"
+	awsIncludeDefaultVPC := getEnv("AWS_INCLUDE_DEFAULT_VPC", "true") == "true"
+
 	config := &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:                getEnv("SERVER_PORT", "8080"),
+			Host:                getEnv("SERVER_HOST", "0.0.0.0"),
+			AdminToken:          getEnv("ADMIN_TOKEN", ""),
+			MaxRequestBodyBytes: getEnvInt("SERVER_MAX_REQUEST_BODY_BYTES", 1<<20),
+			StrictJSON:          getEnv("SERVER_STRICT_JSON", "false") == "true",
 		},
 		Database: DatabaseConfig{
-			Type:             getEnv("DATABASE_TYPE", "sqlite"),
-			Path:             getEnv("DATABASE_PATH", "./data/ipam.db"),
-			ConnectionString: getEnv("DATABASE_CONNECTION_STRING", ""),
+			Type:                  getEnv("DATABASE_TYPE", "sqlite"),
+			Path:                  getEnv("DATABASE_PATH", "./data/ipam.db"),
+			ConnectionString:      getEnv("DATABASE_CONNECTION_STRING", ""),
+			Database:              getEnv("DATABASE_NAME", "ipam"),
+			Collection:            getEnv("DATABASE_COLLECTION", "subnets"),
+			ConnectionsCollection: getEnv("DATABASE_CONNECTIONS_COLLECTION", "connections"),
+			TablePrefix:           getEnv("DATABASE_TABLE_PREFIX", ""),
 		},
 		IPAM: IPAMConfig{
-			DefaultAllocationSize: 256,
+			DefaultAllocationSize:     256,
+			IncludeNetworkBroadcast:   getEnv("IPAM_INCLUDE_NETWORK_BROADCAST", "false") == "true",
+			MaxTagsPerSubnet:          getEnvInt("IPAM_MAX_TAGS_PER_SUBNET", 50),
+			Environments:              getEnvList("IPAM_ENVIRONMENTS"),
+			MaxSplitSubnets:           getEnvInt("IPAM_MAX_SPLIT_SUBNETS", 1024),
+			AllowSiblingOverlap:       getEnv("IPAM_ALLOW_SIBLING_OVERLAP", "false") == "true",
+			EncryptionKey:             getEnv("IPAM_ENCRYPTION_KEY", ""),
+			EncryptedTags:             getEnvList("IPAM_ENCRYPTED_TAGS"),
+			IdempotencyKeyTTL:         getEnv("IPAM_IDEMPOTENCY_KEY_TTL", "24h"),
+			SubnetExpiryInterval:      getEnv("IPAM_SUBNET_EXPIRY_INTERVAL", "1m"),
+			UndirectedConnectionTypes: getEnvList("IPAM_UNDIRECTED_CONNECTION_TYPES"),
+			UtilizationHistory: UtilizationHistoryConfig{
+				CompactionInterval: getEnv("UTILIZATION_HISTORY_COMPACTION_INTERVAL", "1h"),
+				MinuteRetention:    getEnv("UTILIZATION_HISTORY_MINUTE_RETENTION", "24h"),
+				HourlyRetention:    getEnv("UTILIZATION_HISTORY_HOURLY_RETENTION", "720h"),
+				MaxSamples:         getEnvInt("UTILIZATION_HISTORY_MAX_SAMPLES", 10000),
+			},
+			ConnectionMetadata: ConnectionMetadataConfig{
+				Enforce:     getEnv("IPAM_CONNECTION_METADATA_ENFORCE", "false") == "true",
+				AllowedKeys: getEnvMap("IPAM_CONNECTION_METADATA_KEYS"),
+			},
 		},
 		CloudProviders: CloudProvidersConfig{
-			Enabled:      getEnv("CLOUD_PROVIDERS_ENABLED", "false") == "true",
-			SyncInterval: getEnv("CLOUD_SYNC_INTERVAL", "5m"),
+			Enabled:             getEnv("CLOUD_PROVIDERS_ENABLED", "false") == "true",
+			SyncInterval:        getEnv("CLOUD_SYNC_INTERVAL", "5m"),
+			PeriodicSyncEnabled: &periodicSyncEnabled,
+			OverwriteManual:     getEnv("CLOUD_OVERWRITE_MANUAL", "false") == "true",
+			AutoPrune:           getEnv("CLOUD_AUTO_PRUNE", "false") == "true",
+			PruneInterval:       getEnv("CLOUD_PRUNE_INTERVAL", "1h"),
+			PruneStaleAfter:     getEnv("CLOUD_PRUNE_STALE_AFTER", ""),
 			AWS: AWSConfig{
-				Enabled: getEnv("AWS_ENABLED", "false") == "true",
+				Enabled:           getEnv("AWS_ENABLED", "false") == "true",
+				IncludeDefaultVPC: &awsIncludeDefaultVPC,
 				Regions: []AWSRegionConfig{
 					{
 						Region:          getEnv("AWS_REGION", "eu-west-1"),
@@ -110,16 +272,85 @@ func LoadConfigFromEnv() *Config {
 	return config
 }
 
+// GenericProviders returns the non-AWS provider configurations keyed by provider type
+func (c *CloudProvidersConfig) GenericProviders() map[string]ProviderConfig {
+	return map[string]ProviderConfig{
+		"azure":    c.Azure,
+		"gcp":      c.GCP,
+		"scaleway": c.Scaleway,
+		"ovh":      c.OVH,
+	}
+}
+
 // GetSyncInterval returns the sync interval as a duration
 func (c *CloudProvidersConfig) GetSyncInterval() (time.Duration, error) {
 	return time.ParseDuration(c.SyncInterval)
 }
 
+// IsPeriodicSyncEnabled reports whether the sync ticker should run, defaulting to true
+func (c *CloudProvidersConfig) IsPeriodicSyncEnabled() bool {
+	return c.PeriodicSyncEnabled == nil || *c.PeriodicSyncEnabled
+}
+
+// GetPruneInterval returns how often stale cloud subnets are pruned, defaulting to 1h
+func (c *CloudProvidersConfig) GetPruneInterval() (time.Duration, error) {
+	return parseDurationOrDefault(c.PruneInterval, time.Hour)
+}
+
+// GetPruneStaleAfter returns how long a cloud subnet may go unseen by syncs
+// before it is pruned, defaulting to three sync intervals
+func (c *CloudProvidersConfig) GetPruneStaleAfter() (time.Duration, error) {
+	if c.PruneStaleAfter != "" {
+		return time.ParseDuration(c.PruneStaleAfter)
+	}
+	syncInterval, err := c.GetSyncInterval()
+	if err != nil {
+		return 0, err
+	}
+	return 3 * syncInterval, nil
+}
+
+// IsDefaultVPCIncluded reports whether default VPCs are synced, defaulting to true
+func (c *AWSConfig) IsDefaultVPCIncluded() bool {
+	return c.IncludeDefaultVPC == nil || *c.IncludeDefaultVPC
+}
+
+// GetRetryBaseDelay returns the first backoff between retries of a throttled
+// AWS call; zero leaves the choice to the AWS client
+func (c *AWSConfig) GetRetryBaseDelay() (time.Duration, error) {
+	return parseDurationOrDefault(c.RetryBaseDelay, 0)
+}
+
+// GetIdempotencyKeyTTL returns how long idempotency keys are remembered, defaulting to 24h
+func (c *IPAMConfig) GetIdempotencyKeyTTL() (time.Duration, error) {
+	return parseDurationOrDefault(c.IdempotencyKeyTTL, 24*time.Hour)
+}
+
+// GetSubnetExpiryInterval returns how often expired subnets are deleted, defaulting to 1m
+func (c *IPAMConfig) GetSubnetExpiryInterval() (time.Duration, error) {
+	return parseDurationOrDefault(c.SubnetExpiryInterval, time.Minute)
+}
+
+// GetCompactionInterval returns the downsampling interval as a duration, defaulting to 1h
+func (c *UtilizationHistoryConfig) GetCompactionInterval() (time.Duration, error) {
+	return parseDurationOrDefault(c.CompactionInterval, time.Hour)
+}
+
+// GetMinuteRetention returns how long per-minute points are kept, defaulting to 24h
+func (c *UtilizationHistoryConfig) GetMinuteRetention() (time.Duration, error) {
+	return parseDurationOrDefault(c.MinuteRetention, 24*time.Hour)
+}
+
+// GetHourlyRetention returns how long per-hour points are kept, defaulting to 30 days
+func (c *UtilizationHistoryConfig) GetHourlyRetention() (time.Duration, error) {
+	return parseDurationOrDefault(c.HourlyRetention, 30*24*time.Hour)
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	// Validate database type
-	if c.Database.Type != "sqlite" && c.Database.Type != "mongodb" {
-		return fmt.Errorf("invalid database type: %s (must be 'sqlite' or 'mongodb')", c.Database.Type)
+	if c.Database.Type != "sqlite" && c.Database.Type != "mongodb" && c.Database.Type != "postgres" {
+		return fmt.Errorf("invalid database type: %s (must be 'sqlite', 'mongodb' or 'postgres')", c.Database.Type)
 	}
 
 	// Validate database-specific configuration
@@ -131,9 +362,235 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("connection string is required for MongoDB")
 	}
 
+	if c.Database.Type == "postgres" && c.Database.ConnectionString == "" {
+		return fmt.Errorf("connection string is required for PostgreSQL")
+	}
+
+	if c.Database.TablePrefix != "" {
+		if c.Database.Type == "postgres" {
+			return fmt.Errorf("table prefix is not supported for PostgreSQL; use a separate schema or database instead")
+		}
+		if !TablePrefixPattern.MatchString(c.Database.TablePrefix) {
+			return fmt.Errorf("invalid table prefix %q: use letters, digits and underscores, starting with a letter", c.Database.TablePrefix)
+		}
+	}
+
+	if c.Server.MaxRequestBodyBytes < 0 {
+		return fmt.Errorf("max request body bytes must not be negative, got %d", c.Server.MaxRequestBodyBytes)
+	}
+
+	if c.IPAM.MaxTagsPerSubnet < 0 {
+		return fmt.Errorf("max tags per subnet must not be negative, got %d", c.IPAM.MaxTagsPerSubnet)
+	}
+
+	if c.IPAM.MaxSplitSubnets < 0 {
+		return fmt.Errorf("max split subnets must not be negative, got %d", c.IPAM.MaxSplitSubnets)
+	}
+
+	if len(c.IPAM.EncryptedTags) > 0 && c.IPAM.EncryptionKey == "" {
+		return fmt.Errorf("encryption key is required when encrypted tags are configured")
+	}
+	if c.IPAM.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.IPAM.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("encryption key must be base64 encoded: %w", err)
+		}
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return fmt.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+		}
+	}
+
+	if ttl, err := c.IPAM.GetIdempotencyKeyTTL(); err != nil {
+		return fmt.Errorf("invalid idempotency key TTL: %w", err)
+	} else if ttl <= 0 {
+		return fmt.Errorf("idempotency key TTL must be positive, got %s", ttl)
+	}
+
+	if interval, err := c.IPAM.GetSubnetExpiryInterval(); err != nil {
+		return fmt.Errorf("invalid subnet expiry interval: %w", err)
+	} else if interval <= 0 {
+		return fmt.Errorf("subnet expiry interval must be positive, got %s", interval)
+	}
+
+	allowedKeys := c.IPAM.ConnectionMetadata.AllowedKeys
+	for _, key := range slices.Sorted(maps.Keys(allowedKeys)) {
+		keyType := allowedKeys[key]
+		if key == "" {
+			return fmt.Errorf("connection metadata keys must not be empty")
+		}
+		if !slices.Contains(ConnectionMetadataTypes, keyType) {
+			return fmt.Errorf("connection metadata key %q has type %q, must be one of %s",
+				key, keyType, strings.Join(ConnectionMetadataTypes, ", "))
+		}
+	}
+
+	// Validate utilization history downsampling tiers
+	history := &c.IPAM.UtilizationHistory
+	if _, err := history.GetCompactionInterval(); err != nil {
+		return fmt.Errorf("invalid utilization history compaction interval: %w", err)
+	}
+	minuteRetention, err := history.GetMinuteRetention()
+	if err != nil {
+		return fmt.Errorf("invalid utilization history minute retention: %w", err)
+	}
+	hourlyRetention, err := history.GetHourlyRetention()
+	if err != nil {
+		return fmt.Errorf("invalid utilization history hourly retention: %w", err)
+	}
+	if hourlyRetention < minuteRetention {
+		return fmt.Errorf("utilization history hourly retention (%s) must not be shorter than minute retention (%s)",
+			hourlyRetention, minuteRetention)
+	}
+	if history.MaxSamples < 0 {
+		return fmt.Errorf("utilization history max samples must not be negative, got %d", history.MaxSamples)
+	}
+
+	if delay, err := c.CloudProviders.AWS.GetRetryBaseDelay(); err != nil {
+		return fmt.Errorf("invalid AWS retry base delay: %w", err)
+	} else if delay < 0 {
+		return fmt.Errorf("AWS retry base delay must not be negative")
+	}
+
+	// A threshold shorter than the sync interval would prune subnets between syncs
+	if c.CloudProviders.AutoPrune {
+		if _, err := c.CloudProviders.GetPruneInterval(); err != nil {
+			return fmt.Errorf("invalid cloud prune interval: %w", err)
+		}
+		syncInterval, err := c.CloudProviders.GetSyncInterval()
+		if err != nil {
+			return fmt.Errorf("invalid cloud sync interval: %w", err)
+		}
+		staleAfter, err := c.CloudProviders.GetPruneStaleAfter()
+		if err != nil {
+			return fmt.Errorf("invalid cloud prune stale threshold: %w", err)
+		}
+		if staleAfter <= syncInterval {
+			return fmt.Errorf("cloud prune stale threshold (%s) must be longer than the sync interval (%s)", staleAfter, syncInterval)
+		}
+	}
+
 	return nil
 }
 
+// redactedValue replaces secrets in redacted configuration
+const redactedValue = "********"
+
+// Redacted returns a copy of the configuration with credentials masked, safe
+// to expose for debugging
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Server.AdminToken = redactSecret(c.Server.AdminToken)
+	redacted.Database.ConnectionString = redactConnectionString(c.Database.ConnectionString)
+	redacted.IPAM.EncryptionKey = redactSecret(c.IPAM.EncryptionKey)
+
+	redacted.CloudProviders.AWS.Regions = make([]AWSRegionConfig, len(c.CloudProviders.AWS.Regions))
+	for i, region := range c.CloudProviders.AWS.Regions {
+		region.AccessKeyID = redactSecret(region.AccessKeyID)
+		region.SecretAccessKey = redactSecret(region.SecretAccessKey)
+		redacted.CloudProviders.AWS.Regions[i] = region
+	}
+
+	redacted.CloudProviders.Azure = c.CloudProviders.Azure.redacted()
+	redacted.CloudProviders.GCP = c.CloudProviders.GCP.redacted()
+	redacted.CloudProviders.Scaleway = c.CloudProviders.Scaleway.redacted()
+	redacted.CloudProviders.OVH = c.CloudProviders.OVH.redacted()
+
+	return &redacted
+}
+
+// redacted returns a copy of the provider configuration with credentials masked
+func (c ProviderConfig) redacted() ProviderConfig {
+	redacted := c
+	redacted.Regions = make([]ProviderRegionConfig, len(c.Regions))
+	for i, region := range c.Regions {
+		region.AccessKey = redactSecret(region.AccessKey)
+		region.SecretKey = redactSecret(region.SecretKey)
+		region.Token = redactSecret(region.Token)
+		region.Extra = redactExtra(region.Extra)
+		redacted.Regions[i] = region
+	}
+	return redacted
+}
+
+// nonSecretExtraKeys are the provider extra settings shown unmasked; any other
+// key, such as GCP's credentials_json, may hold a credential
+var nonSecretExtraKeys = map[string]bool{
+	"subscription_id": true,
+	"project_id":      true,
+}
+
+// redactExtra returns a copy of provider extra settings with every value not
+// known to be safe masked
+func redactExtra(extra map[string]string) map[string]string {
+	if extra == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(extra))
+	for key, value := range extra {
+		if nonSecretExtraKeys[key] {
+			redacted[key] = value
+		} else {
+			redacted[key] = redactSecret(value)
+		}
+	}
+	return redacted
+}
+
+// RedactedMap returns the redacted configuration keyed by its YAML field names
+func (c *Config) RedactedMap() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %w", err)
+	}
+
+	var result map[string]interface{}
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration: %w", err)
+	}
+
+	return result, nil
+}
+
+// redactSecret masks a non-empty secret, leaving empty values visible so
+// operators can tell whether a credential is configured
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// redactConnectionString masks the password of a database URL, in the userinfo
+// or a password query parameter, or the whole string when it is not a URL
+func redactConnectionString(connectionString string) string {
+	if connectionString == "" {
+		return ""
+	}
+
+	u, err := url.Parse(connectionString)
+	if err != nil || u.Scheme == "" {
+		return redactedValue
+	}
+
+	query := u.Query()
+	for key := range query {
+		if strings.Contains(strings.ToLower(key), "password") {
+			query.Set(key, redactedValue)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.Redacted()
+}
+
+// parseDurationOrDefault parses a duration string, returning def when it is empty
+func parseDurationOrDefault(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -141,3 +598,44 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable, falling back to the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvMap retrieves a comma-separated list of key:value pairs from an
+// environment variable, or nil when it is unset
+func getEnvMap(key string) map[string]string {
+	items := getEnvList(key)
+	if items == nil {
+		return nil
+	}
+
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		k, v, _ := strings.Cut(item, ":")
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return values
+}
+
+// getEnvList gets a comma-separated environment variable as a list, or nil when unset
+func getEnvList(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
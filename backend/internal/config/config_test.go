@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigMalformedYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantLine int
+	}{
+		{
+			name:     "syntax error",
+			content:  "server:\n  port: \"8080\"\n database:\n  type: sqlite\n",
+			wantLine: 2,
+		},
+		{
+			name:     "type mismatch",
+			content:  "server:\n  port: \"8080\"\nipam:\n  max_split_subnets: many\n",
+			wantLine: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.content)
+
+			_, err := LoadConfig(path)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected a ParseError, got %v", err)
+			}
+			if parseErr.Path != path || parseErr.Line != tt.wantLine {
+				t.Errorf("Expected %s line %d, got %s line %d", path, tt.wantLine, parseErr.Path, parseErr.Line)
+			}
+			if !strings.Contains(err.Error(), "line") {
+				t.Errorf("Expected the error to reference the line, got %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithFallback(t *testing.T) {
+	malformed := writeConfigFile(t, "server:\n  port: \"8080\"\n database:\n  type: sqlite\n")
+	t.Setenv("SERVER_PORT", "9090")
+
+	t.Run("without fallback the parse error is returned", func(t *testing.T) {
+		cfg, err := LoadConfigWithFallback(malformed, false)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || cfg != nil {
+			t.Fatalf("Expected a ParseError and no config, got %v, %+v", err, cfg)
+		}
+	})
+
+	t.Run("with fallback the environment is used", func(t *testing.T) {
+		cfg, err := LoadConfigWithFallback(malformed, true)
+		if err != nil {
+			t.Fatalf("Expected fallback to environment variables, got %v", err)
+		}
+		if cfg.Server.Port != "9090" {
+			t.Errorf("Expected port 9090 from the environment, got %s", cfg.Server.Port)
+		}
+	})
+
+	t.Run("a valid file is not replaced", func(t *testing.T) {
+		valid := writeConfigFile(t, "server:\n  port: \"8081\"\n  host: 127.0.0.1\ndatabase:\n  type: sqlite\n  path: ./ipam.db\n")
+		cfg, err := LoadConfigWithFallback(valid, true)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if cfg.Server.Port != "8081" {
+			t.Errorf("Expected port 8081 from the file, got %s", cfg.Server.Port)
+		}
+	})
+
+	t.Run("a missing file is not a parse error", func(t *testing.T) {
+		if _, err := LoadConfigWithFallback(filepath.Join(t.TempDir(), "missing.yaml"), true); err == nil {
+			t.Error("Expected an error for an unreadable file")
+		}
+	})
+}
+
+func TestValidateEncryptionKey(t *testing.T) {
+	validKey := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	tests := []struct {
+		name    string
+		key     string
+		tags    []string
+		wantErr bool
+	}{
+		{name: "disabled", wantErr: false},
+		{name: "valid key", key: validKey, tags: []string{"contact_email"}, wantErr: false},
+		{name: "tags without key", tags: []string{"contact_email"}, wantErr: true},
+		{name: "not base64", key: "not base64!", wantErr: true},
+		{name: "wrong length", key: "c2hvcnQ=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.IPAM.EncryptionKey = tt.key
+			cfg.IPAM.EncryptedTags = tt.tags
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cfg := LoadConfigFromEnv()
+	cfg.IPAM.EncryptionKey = validKey
+	if redacted := cfg.Redacted(); redacted.IPAM.EncryptionKey == validKey {
+		t.Error("Expected the encryption key to be redacted")
+	}
+}
+
+func TestValidateAutoPrune(t *testing.T) {
+	tests := []struct {
+		name       string
+		staleAfter string
+		interval   string
+		wantErr    bool
+	}{
+		{name: "default threshold", wantErr: false},
+		{name: "explicit threshold", staleAfter: "1h", wantErr: false},
+		{name: "threshold within one sync", staleAfter: "5m", wantErr: true},
+		{name: "invalid threshold", staleAfter: "soon", wantErr: true},
+		{name: "invalid interval", interval: "often", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.CloudProviders.AutoPrune = true
+			cfg.CloudProviders.SyncInterval = "5m"
+			cfg.CloudProviders.PruneStaleAfter = tt.staleAfter
+			if tt.interval != "" {
+				cfg.CloudProviders.PruneInterval = tt.interval
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cfg := LoadConfigFromEnv()
+	cfg.CloudProviders.SyncInterval = "10m"
+	if staleAfter, err := cfg.CloudProviders.GetPruneStaleAfter(); err != nil || staleAfter != 30*time.Minute {
+		t.Errorf("Expected a default of three sync intervals, got %v (%v)", staleAfter, err)
+	}
+}
+
+func TestValidateTablePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbType  string
+		prefix  string
+		wantErr bool
+	}{
+		{name: "no prefix", dbType: "sqlite"},
+		{name: "sqlite prefix", dbType: "sqlite", prefix: "staging_"},
+		{name: "mongodb prefix", dbType: "mongodb", prefix: "dev_"},
+		{name: "postgres prefix", dbType: "postgres", prefix: "dev_", wantErr: true},
+		{name: "leading digit", dbType: "sqlite", prefix: "1dev_", wantErr: true},
+		{name: "punctuation", dbType: "sqlite", prefix: "dev; DROP TABLE subnets;", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.Database.Type = tt.dbType
+			cfg.Database.ConnectionString = "db://localhost"
+			cfg.Database.TablePrefix = tt.prefix
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateConnectionMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		wantErr bool
+	}{
+		{name: "no schema", wantErr: false},
+		{name: "known types", keys: map[string]string{"vlan": "number", "circuit_id": "string", "extra": "any"}, wantErr: false},
+		{name: "unknown type", keys: map[string]string{"vlan": "integer"}, wantErr: true},
+		{name: "empty key", keys: map[string]string{"": "string"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.IPAM.ConnectionMetadata = ConnectionMetadataConfig{Enforce: true, AllowedKeys: tt.keys}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Setenv("IPAM_CONNECTION_METADATA_ENFORCE", "true")
+	t.Setenv("IPAM_CONNECTION_METADATA_KEYS", "vlan:number, circuit_id:string")
+	cfg := LoadConfigFromEnv()
+	want := map[string]string{"vlan": "number", "circuit_id": "string"}
+	if !cfg.IPAM.ConnectionMetadata.Enforce || !maps.Equal(cfg.IPAM.ConnectionMetadata.AllowedKeys, want) {
+		t.Errorf("Expected enforced keys %v from the environment, got %+v", want, cfg.IPAM.ConnectionMetadata)
+	}
+}
@@ -0,0 +1,103 @@
+// Package events distributes change notifications to in-process subscribers,
+// such as the gateway's server-sent event stream
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Type names the kind of change an event reports
+type Type string
+
+// Event types published by the service layer
+const (
+	SubnetCreated     Type = "subnet.created"
+	SubnetUpdated     Type = "subnet.updated"
+	SubnetDeleted     Type = "subnet.deleted"
+	ConnectionCreated Type = "connection.created"
+)
+
+// Event reports a change to a subnet or connection. It carries the ID only;
+// subscribers fetch the resource when they need its current state.
+type Event struct {
+	Type Type      `json:"type"`
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// Hub fans published events out to its subscribers. Publishing never blocks:
+// a subscriber whose buffer is full is dropped and its channel closed, so a
+// stalled client cannot hold up the mutations that publish.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub creates a hub without subscribers
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+// Subscribe registers a subscriber that may fall up to buffer events behind
+// before it is dropped
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{hub: h, events: make(chan Event, buffer)}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription is closed or dropped for falling behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unregisters the subscription; closing it again is a no-op
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove unregisters sub and closes its channel. Callers must hold h.mu.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.events)
+}
+
+// Publish delivers event to every subscriber
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("Dropping event subscriber %d events behind", cap(sub.events))
+			h.remove(sub)
+		}
+	}
+}
+
+// SubscriberCount returns the number of registered subscribers
+func (h *Hub) SubscriberCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
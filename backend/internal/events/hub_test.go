@@ -0,0 +1,61 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHubPublishAndClose(t *testing.T) {
+	hub := NewHub()
+	first := hub.Subscribe(4)
+	second := hub.Subscribe(4)
+
+	event := Event{Type: SubnetCreated, ID: "subnet-1", Time: time.Unix(1700000000, 0)}
+	hub.Publish(event)
+
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case got := <-sub.Events():
+			if got != event {
+				t.Errorf("Expected %+v, got %+v", event, got)
+			}
+		default:
+			t.Error("Expected every subscriber to receive the event")
+		}
+	}
+
+	first.Close()
+	first.Close()
+	if _, ok := <-first.Events(); ok {
+		t.Error("Expected a closed subscription's channel to be closed")
+	}
+	if count := hub.SubscriberCount(); count != 1 {
+		t.Errorf("Expected 1 subscriber after closing one, got %d", count)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe(1)
+	fast := hub.Subscribe(4)
+
+	hub.Publish(Event{Type: SubnetCreated, ID: "a"})
+	<-fast.Events()
+	hub.Publish(Event{Type: SubnetUpdated, ID: "a"})
+
+	if count := hub.SubscriberCount(); count != 1 {
+		t.Fatalf("Expected the slow subscriber to be dropped, got %d subscribers", count)
+	}
+
+	// The slow subscriber still gets what fit in its buffer, then the close
+	if got, ok := <-slow.Events(); !ok || got.Type != SubnetCreated {
+		t.Errorf("Expected the buffered event, got %+v (%v)", got, ok)
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Error("Expected the dropped subscriber's channel to be closed")
+	}
+	if got := <-fast.Events(); got.Type != SubnetUpdated {
+		t.Errorf("Expected the fast subscriber to keep receiving, got %+v", got)
+	}
+	slow.Close()
+}
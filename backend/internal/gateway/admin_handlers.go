@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin only lets requests through that carry the configured admin
+// token as a bearer token. Admin endpoints are disabled when no token is set.
+func (g *Gateway) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if g.authorizeAdmin(w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// authorizeAdmin reports whether r carries the admin bearer token, writing
+// the error response when it does not. It guards admin-only variants of
+// otherwise public endpoints.
+func (g *Gateway) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if g.config == nil || g.config.Server.AdminToken == "" {
+		g.writeErrorResponse(w, http.StatusForbidden, "ADMIN_DISABLED", "Admin endpoints are disabled; set server.admin_token to enable them", nil)
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(g.config.Server.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipam-admin"`)
+		g.writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid admin bearer token is required", nil)
+		return false
+	}
+
+	return true
+}
+
+// handleAdminConfig handles GET /api/v1/admin/config
+func (g *Gateway) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	effective, err := g.config.RedactedMap()
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to render configuration", err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, effective)
+}
@@ -0,0 +1,49 @@
+package gateway
+
+import "net/http"
+
+// CapabilitiesResponseJSON lists the optional features of this server.
+// Features maps a feature name to whether it is enabled; CloudProviders maps
+// each registered provider to whether it is configured to sync.
+type CapabilitiesResponseJSON struct {
+	Features       map[string]bool `json:"features"`
+	CloudProviders map[string]bool `json:"cloud_providers"`
+}
+
+// handleCapabilities handles GET /api/v1/capabilities
+func (g *Gateway) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	g.writeJSON(w, http.StatusOK, g.capabilities())
+}
+
+// capabilities derives the feature flags from the active configuration.
+// Features compiled into every build are always reported enabled.
+func (g *Gateway) capabilities() *CapabilitiesResponseJSON {
+	resp := &CapabilitiesResponseJSON{
+		Features: map[string]bool{
+			"soft_delete":      true,
+			"ip_allocation":    true,
+			"connections":      true,
+			"events":           true,
+			"idempotency_keys": true,
+			"subnet_expiry":    true,
+			"metrics":          true,
+		},
+		CloudProviders: map[string]bool{},
+	}
+
+	cfg := g.config
+	resp.Features["admin_auth"] = cfg != nil && cfg.Server.AdminToken != ""
+	resp.Features["strict_json"] = cfg != nil && cfg.Server.StrictJSON
+	resp.Features["tag_encryption"] = cfg != nil && cfg.IPAM.EncryptionKey != ""
+	resp.Features["connection_metadata_schema"] = cfg != nil && cfg.IPAM.ConnectionMetadata.Enforce
+	resp.Features["sibling_overlap"] = cfg != nil && cfg.IPAM.AllowSiblingOverlap
+
+	resp.Features["cloud_providers"] = g.cloudManager != nil && g.cloudManager.IsEnabled()
+	if g.cloudManager != nil {
+		for _, status := range g.cloudManager.ListProviderStatus() {
+			resp.CloudProviders[string(status.Type)] = resp.Features["cloud_providers"] && status.Enabled
+		}
+	}
+
+	return resp
+}
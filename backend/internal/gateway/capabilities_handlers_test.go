@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider"
+	"github.com/bananaops/ipam-bananaops/internal/config"
+)
+
+func TestCapabilitiesReflectConfiguration(t *testing.T) {
+	get := func(t *testing.T, g *Gateway) *CapabilitiesResponseJSON {
+		t.Helper()
+		rec := doRequest(g.Handler(), http.MethodGet, "/api/v1/capabilities", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var caps CapabilitiesResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		return &caps
+	}
+
+	t.Run("without configuration", func(t *testing.T) {
+		caps := get(t, NewGateway(newTestServiceLayer(t), nil))
+
+		for _, feature := range []string{"soft_delete", "ip_allocation", "connections"} {
+			if !caps.Features[feature] {
+				t.Errorf("Expected compiled-in feature %s to be enabled", feature)
+			}
+		}
+		for _, feature := range []string{"admin_auth", "cloud_providers", "strict_json", "tag_encryption"} {
+			enabled, ok := caps.Features[feature]
+			if !ok || enabled {
+				t.Errorf("Expected %s to be reported disabled, got %v (present %v)", feature, enabled, ok)
+			}
+		}
+		if len(caps.CloudProviders) != 0 {
+			t.Errorf("Expected no cloud providers without a manager, got %v", caps.CloudProviders)
+		}
+	})
+
+	t.Run("with configuration", func(t *testing.T) {
+		cfg := &config.Config{
+			Server: config.ServerConfig{AdminToken: "secret", StrictJSON: true},
+			IPAM:   config.IPAMConfig{AllowSiblingOverlap: true},
+			CloudProviders: config.CloudProvidersConfig{
+				Enabled: true,
+				AWS:     config.AWSConfig{Enabled: true},
+			},
+		}
+		caps := get(t, NewGatewayWithConfig(newTestServiceLayer(t), cloudprovider.NewManager(cfg, nil), cfg))
+
+		for _, feature := range []string{"admin_auth", "strict_json", "sibling_overlap", "cloud_providers"} {
+			if !caps.Features[feature] {
+				t.Errorf("Expected %s to be enabled, got %v", feature, caps.Features)
+			}
+		}
+		if caps.Features["tag_encryption"] {
+			t.Error("Expected tag_encryption to stay disabled without a key")
+		}
+		if !caps.CloudProviders["aws"] || caps.CloudProviders["gcp"] {
+			t.Errorf("Expected only aws to be enabled, got %v", caps.CloudProviders)
+		}
+	})
+}
@@ -1,32 +1,73 @@
 package gateway
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider"
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider/aws"
 )
 
-// CloudSyncRequest represents a cloud sync request
+// CloudSyncRequest represents a cloud sync request. An empty Provider syncs
+// every provider, and Region narrows an AWS sync to one region. A sync
+// requested while another is running fails with SYNC_IN_PROGRESS unless Wait
+// is set, in which case it starts once the running one finishes; single-region
+// syncs never wait.
 type CloudSyncRequest struct {
 	Provider string `json:"provider,omitempty"`
 	Region   string `json:"region,omitempty"`
+	Wait     bool   `json:"wait,omitempty"`
 }
 
-// CloudSyncResponse represents a cloud sync response
+// CloudSyncResponse represents a cloud sync response. Success is false when
+// the sync completed but some resources could not be stored; Errors describes
+// them, up to aws.MaxSyncFailures.
 type CloudSyncResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success bool               `json:"success"`
+	Message string             `json:"message"`
+	Synced  int                `json:"synced"`
+	Failed  int                `json:"failed"`
+	Errors  []*SyncFailureJSON `json:"errors"`
+	Stats   *SyncStatsJSON     `json:"stats"`
+}
+
+// SyncFailureJSON describes a resource, or a whole region, a cloud sync failed to store
+type SyncFailureJSON struct {
+	Provider   string `json:"provider"`
+	Region     string `json:"region,omitempty"`
+	ResourceID string `json:"resource_id,omitempty"`
+	CIDR       string `json:"cidr,omitempty"`
+	Error      string `json:"error"`
+}
+
+// SyncStatsJSON counts the resources a cloud sync created, updated or skipped
+type SyncStatsJSON struct {
+	VPCsCreated    int `json:"vpcs_created"`
+	SubnetsCreated int `json:"subnets_created"`
+	SubnetsUpdated int `json:"subnets_updated"`
+	SubnetsSkipped int `json:"subnets_skipped"`
+	Errors         int `json:"errors"`
 }
 
-// CloudStatusResponse represents cloud provider status
+// CloudStatusResponse represents cloud provider status. The sync timestamps
+// are Unix seconds and omitted until a full sync has started or completed.
 type CloudStatusResponse struct {
-	Enabled   bool                    `json:"enabled"`
-	Providers map[string]ProviderInfo `json:"providers"`
+	Enabled           bool                    `json:"enabled"`
+	Providers         map[string]ProviderInfo `json:"providers"`
+	InProgress        bool                    `json:"in_progress"`
+	LastSyncStarted   int64                   `json:"last_sync_started,omitempty"`
+	LastSyncCompleted int64                   `json:"last_sync_completed,omitempty"`
 }
 
 // ProviderInfo represents cloud provider information
 type ProviderInfo struct {
-	Enabled bool     `json:"enabled"`
-	Regions []string `json:"regions"`
+	Name        string   `json:"name"`
+	Enabled     bool     `json:"enabled"`
+	Implemented bool     `json:"implemented"` // False for providers whose subnet fetching is still a stub
+	Regions     []string `json:"regions"`
 }
 
 // HandleCloudSync handles cloud synchronization requests
@@ -37,8 +78,8 @@ func (g *Gateway) HandleCloudSync(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CloudSyncRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", err)
+	if err := g.newRequestDecoder(r.Body).Decode(&req); err != nil {
+		g.writeDecodeError(w, err)
 		return
 	}
 
@@ -50,39 +91,79 @@ func (g *Gateway) HandleCloudSync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var stats *aws.SyncStats
 	var err error
 	var message string
 
-	switch req.Provider {
-	case "aws":
-		if req.Region != "" {
-			err = g.cloudManager.SyncAWSRegion(ctx, req.Region)
-			message = "AWS region " + req.Region + " synchronized successfully"
-		} else {
-			err = g.cloudManager.SyncAll(ctx)
-			message = "All AWS regions synchronized successfully"
-		}
-	case "":
+	syncAll := g.cloudManager.TrySyncAll
+	if req.Wait {
+		syncAll = g.cloudManager.SyncAll
+	}
+
+	switch {
+	case req.Provider == "":
 		// Sync all providers
-		err = g.cloudManager.SyncAll(ctx)
+		stats, err = syncAll(ctx)
 		message = "All cloud providers synchronized successfully"
+	case req.Provider == string(cloudprovider.ProviderAWS) && req.Region != "":
+		stats, err = g.cloudManager.SyncAWSRegion(ctx, req.Region)
+		message = "AWS region " + req.Region + " synchronized successfully"
+	case req.Region != "":
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "A region can only be synchronized on its own for AWS", nil)
+		return
 	default:
+		stats, err = g.cloudManager.SyncProvider(ctx, cloudprovider.CloudProviderType(req.Provider), req.Wait)
+		if req.Provider == string(cloudprovider.ProviderAWS) {
+			message = "All AWS regions synchronized successfully"
+		} else {
+			message = "All " + req.Provider + " regions synchronized successfully"
+		}
+	}
+
+	if errors.Is(err, cloudprovider.ErrProviderNotFound) {
 		g.writeErrorResponse(w, http.StatusBadRequest, "UNSUPPORTED_PROVIDER", "Unsupported cloud provider: "+req.Provider, nil)
 		return
 	}
 
+	if errors.Is(err, cloudprovider.ErrSyncInProgress) {
+		g.writeErrorResponse(w, http.StatusConflict, "SYNC_IN_PROGRESS", "A cloud synchronization is already in progress; retry later or set wait", nil)
+		return
+	}
 	if err != nil {
 		g.writeErrorResponse(w, http.StatusInternalServerError, "SYNC_FAILED", "Cloud synchronization failed", err)
 		return
 	}
 
+	failures := make([]*SyncFailureJSON, len(stats.Failures))
+	for i, failure := range stats.Failures {
+		failures[i] = &SyncFailureJSON{
+			Provider:   failure.Provider,
+			Region:     failure.Region,
+			ResourceID: failure.ResourceID,
+			CIDR:       failure.CIDR,
+			Error:      failure.Error,
+		}
+	}
+	if stats.Errors > 0 {
+		message = fmt.Sprintf("%s, but %d resource(s) failed", strings.TrimSuffix(message, " successfully"), stats.Errors)
+	}
+
 	response := CloudSyncResponse{
-		Success: true,
+		Success: stats.Errors == 0,
 		Message: message,
+		Synced:  stats.Synced(),
+		Failed:  stats.Errors,
+		Errors:  failures,
+		Stats: &SyncStatsJSON{
+			VPCsCreated:    stats.VPCsCreated,
+			SubnetsCreated: stats.SubnetsCreated,
+			SubnetsUpdated: stats.SubnetsUpdated,
+			SubnetsSkipped: stats.SubnetsSkipped,
+			Errors:         stats.Errors,
+		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	g.writeJSON(w, http.StatusOK, response)
 }
 
 // HandleCloudStatus handles cloud provider status requests
@@ -92,28 +173,29 @@ func (g *Gateway) HandleCloudStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	providers := make(map[string]ProviderInfo)
+	g.writeJSON(w, http.StatusOK, g.cloudStatus())
+}
 
-	// AWS status
-	if g.cloudManager.IsAWSEnabled() {
-		providers["aws"] = ProviderInfo{
-			Enabled: true,
-			Regions: g.cloudManager.ListAWSRegions(),
-		}
-	} else {
-		providers["aws"] = ProviderInfo{
-			Enabled: false,
-			Regions: []string{},
+// cloudStatus reports whether cloud providers are enabled and the status of each one
+func (g *Gateway) cloudStatus() *CloudStatusResponse {
+	providers := make(map[string]ProviderInfo)
+	for _, status := range g.cloudManager.ListProviderStatus() {
+		providers[string(status.Type)] = ProviderInfo{
+			Name:        status.Name,
+			Enabled:     status.Enabled,
+			Implemented: status.Implemented,
+			Regions:     emptyIfNil(status.Regions),
 		}
 	}
 
-	response := CloudStatusResponse{
-		Enabled:   g.cloudManager.IsEnabled(),
-		Providers: providers,
+	state := g.cloudManager.SyncState()
+	return &CloudStatusResponse{
+		Enabled:           g.cloudManager.IsEnabled(),
+		Providers:         providers,
+		InProgress:        state.InProgress,
+		LastSyncStarted:   unixOrZero(state.LastStarted),
+		LastSyncCompleted: unixOrZero(state.LastCompleted),
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 }
 
 // HandleUpdateUtilization handles utilization update requests
@@ -142,6 +224,13 @@ func (g *Gateway) HandleUpdateUtilization(w http.ResponseWriter, r *http.Request
 		Message: "Utilization data updated successfully",
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	g.writeJSON(w, http.StatusOK, response)
+}
+
+// unixOrZero returns t as Unix seconds, or zero for the zero time
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
 }
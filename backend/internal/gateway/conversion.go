@@ -3,9 +3,16 @@ package gateway
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"github.com/bananaops/ipam-bananaops/internal/service"
 	pb "github.com/bananaops/ipam-bananaops/proto"
+	"github.com/google/uuid"
 )
 
 // JSON request/response types for REST API
@@ -22,12 +29,16 @@ type CreateSubnetJSON struct {
 
 // UpdateSubnetJSON represents the JSON request for updating a subnet
 type UpdateSubnetJSON struct {
-	CIDR         string         `json:"cidr,omitempty"`
-	Name         string         `json:"name,omitempty"`
-	Description  string         `json:"description,omitempty"`
-	Location     string         `json:"location,omitempty"`
-	LocationType string         `json:"location_type,omitempty"`
-	CloudInfo    *CloudInfoJSON `json:"cloud_info,omitempty"`
+	CIDR           string         `json:"cidr,omitempty"`
+	Name           *string        `json:"name,omitempty"`        // Unchanged when omitted; "" clears it
+	Description    *string        `json:"description,omitempty"` // Unchanged when omitted; "" clears it
+	Location       *string        `json:"location,omitempty"`    // Unchanged when omitted; "" clears it
+	LocationType   string         `json:"location_type,omitempty"`
+	Environment    *string        `json:"environment,omitempty"`      // Unchanged when omitted; "" clears it
+	DHCPRangeStart *string        `json:"dhcp_range_start,omitempty"` // Unchanged when omitted; "" clears it
+	DHCPRangeEnd   *string        `json:"dhcp_range_end,omitempty"`   // Unchanged when omitted; "" clears it
+	DNSZone        *string        `json:"dns_zone,omitempty"`         // Unchanged when omitted; "" clears it
+	CloudInfo      *CloudInfoJSON `json:"cloud_info,omitempty"`
 }
 
 // CloudInfoJSON represents cloud provider information in JSON
@@ -42,18 +53,89 @@ type CloudInfoJSON struct {
 
 // SubnetJSON represents a subnet in JSON format
 type SubnetJSON struct {
-	ID           string             `json:"id"`
-	CIDR         string             `json:"cidr"`
-	Name         string             `json:"name"`
-	Description  string             `json:"description,omitempty"`
-	Location     string             `json:"location,omitempty"`
-	LocationType string             `json:"location_type"`
-	CloudInfo    *CloudInfoJSON     `json:"cloud_info,omitempty"`
-	Details      *SubnetDetailsJSON `json:"details,omitempty"`
-	Utilization  *UtilizationJSON   `json:"utilization,omitempty"`
-	ParentID     string             `json:"parent_id,omitempty"`
-	CreatedAt    int64              `json:"created_at"`
-	UpdatedAt    int64              `json:"updated_at"`
+	ID             string             `json:"id"`
+	CIDR           string             `json:"cidr"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description,omitempty"`
+	Location       string             `json:"location,omitempty"`
+	LocationType   string             `json:"location_type"`
+	Environment    string             `json:"environment,omitempty"`
+	DHCPRangeStart string             `json:"dhcp_range_start,omitempty"`
+	DHCPRangeEnd   string             `json:"dhcp_range_end,omitempty"`
+	DNSZone        string             `json:"dns_zone,omitempty"`
+	CloudInfo      *CloudInfoJSON     `json:"cloud_info,omitempty"`
+	Details        *SubnetDetailsJSON `json:"details,omitempty"`
+	Utilization    *UtilizationJSON   `json:"utilization,omitempty"`
+	Tags           map[string]string  `json:"tags,omitempty"`
+	ParentID       string             `json:"parent_id,omitempty"`
+	ChildRollup    *ChildRollupJSON   `json:"child_rollup,omitempty"`
+	ExpiresAt      int64              `json:"expires_at,omitempty"`
+	CreatedAt      int64              `json:"created_at"`
+	UpdatedAt      int64              `json:"updated_at"`
+}
+
+// SubnetWithIncludesJSON is the single-subnet response with the related
+// resources requested through ?include. A related list is only present when
+// requested, and is then [] rather than null when empty.
+type SubnetWithIncludesJSON struct {
+	*SubnetJSON
+	Children    *[]*SubnetJSON     `json:"children,omitempty"`
+	Connections *[]*ConnectionJSON `json:"connections,omitempty"`
+}
+
+// SubnetFacetsJSON represents subnet counts grouped by facet value. Subnets
+// without an environment are counted under the empty string.
+type SubnetFacetsJSON struct {
+	Environment map[string]int32 `json:"environment"`
+}
+
+// PrefixLengthStatsJSON represents subnet counts grouped by CIDR prefix length
+type PrefixLengthStatsJSON struct {
+	PrefixLengths []*PrefixLengthCountJSON `json:"prefix_lengths"`
+	TotalCount    int32                    `json:"total_count"`
+}
+
+// PrefixLengthCountJSON represents the number of subnets with one prefix length
+type PrefixLengthCountJSON struct {
+	PrefixLength int32 `json:"prefix_length"`
+	Count        int32 `json:"count"`
+}
+
+// EfficiencyStatsJSON represents address space usage across the top-level
+// subnets, with totals per address family
+type EfficiencyStatsJSON struct {
+	IPv4  *EfficiencyTotalsJSON `json:"ipv4,omitempty"`
+	IPv6  *EfficiencyTotalsJSON `json:"ipv6,omitempty"`
+	Pools []*PoolEfficiencyJSON `json:"pools"`
+}
+
+// EfficiencyTotalsJSON represents the summed usage of one address family
+type EfficiencyTotalsJSON struct {
+	Pools              int     `json:"pools"`
+	TotalAddresses     float64 `json:"total_addresses"`
+	AllocatedAddresses float64 `json:"allocated_addresses"`
+	FreeAddresses      float64 `json:"free_addresses"`
+	FreeBlocks         int     `json:"free_blocks"`
+}
+
+// PoolEfficiencyJSON represents the usage and fragmentation of one top-level subnet
+type PoolEfficiencyJSON struct {
+	SubnetID           string  `json:"subnet_id"`
+	Name               string  `json:"name"`
+	CIDR               string  `json:"cidr"`
+	TotalAddresses     float64 `json:"total_addresses"`
+	AllocatedAddresses float64 `json:"allocated_addresses"`
+	FreeAddresses      float64 `json:"free_addresses"`
+	FreeBlocks         int     `json:"free_blocks"`
+	LargestFreeBlock   string  `json:"largest_free_block,omitempty"`
+}
+
+// ChildRollupJSON represents the aggregate utilization of a subnet's direct children
+type ChildRollupJSON struct {
+	ChildCount         int32   `json:"child_count"`
+	TotalIPs           int64   `json:"total_ips"`
+	AllocatedIPs       int64   `json:"allocated_ips"`
+	UtilizationPercent float64 `json:"utilization_percent"`
 }
 
 // SubnetDetailsJSON represents subnet details in JSON format
@@ -66,21 +148,64 @@ type SubnetDetailsJSON struct {
 	Broadcast   string `json:"broadcast"`
 	HostMin     string `json:"host_min"`
 	HostMax     string `json:"host_max"`
-	HostsPerNet int32  `json:"hosts_per_net"`
+	HostsPerNet int32  `json:"hosts_per_net"` // Saturates at 2147483647
+	HostCount   string `json:"host_count,omitempty"`
 	IsPublic    bool   `json:"is_public"`
 }
 
+// SubnetDetailsToJSON converts Protobuf SubnetDetails to JSON
+func SubnetDetailsToJSON(details *pb.SubnetDetails) *SubnetDetailsJSON {
+	return &SubnetDetailsJSON{
+		Address:     details.Address,
+		Netmask:     details.Netmask,
+		Wildcard:    details.Wildcard,
+		Network:     details.Network,
+		Type:        details.Type,
+		Broadcast:   details.Broadcast,
+		HostMin:     details.HostMin,
+		HostMax:     details.HostMax,
+		HostsPerNet: details.HostsPerNet,
+		HostCount:   hostCount(details.HostMin, details.HostMax),
+		IsPublic:    details.IsPublic,
+	}
+}
+
+// hostCount returns the exact number of addresses from hostMin to hostMax as
+// a decimal string, or "" when the range cannot be parsed. The count is
+// derived from the host range so it honours the same network and broadcast
+// exclusions as HostsPerNet without being capped.
+func hostCount(hostMin, hostMax string) string {
+	from, err := netip.ParseAddr(hostMin)
+	if err != nil {
+		return ""
+	}
+	to, err := netip.ParseAddr(hostMax)
+	if err != nil || from.BitLen() != to.BitLen() || to.Less(from) {
+		return ""
+	}
+	return service.RangeSize(from, to).String()
+}
+
 // UtilizationJSON represents utilization info in JSON format
 type UtilizationJSON struct {
-	TotalIPs           int32   `json:"total_ips"`
-	AllocatedIPs       int32   `json:"allocated_ips"`
-	UtilizationPercent float32 `json:"utilization_percent"`
+	TotalIPs                 int32   `json:"total_ips"`
+	AllocatedIPs             int32   `json:"allocated_ips"`
+	AvailableIPs             int32   `json:"available_ips"`              // TotalIPs less AllocatedIPs, never negative
+	UtilizationPercent       float32 `json:"utilization_percent"`        // Share of addresses allocated
+	PrefixUtilizationPercent float32 `json:"prefix_utilization_percent"` // Share of address space covered by child subnets
+}
+
+// availableIPs returns the addresses left unallocated, clamped at zero for
+// records whose allocation was reported above the subnet size
+func availableIPs(total, allocated int32) int32 {
+	return max(total-allocated, 0)
 }
 
 // ListSubnetsResponseJSON represents the list subnets response in JSON
 type ListSubnetsResponseJSON struct {
 	Subnets    []*SubnetJSON `json:"subnets"`
 	TotalCount int32         `json:"total_count"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
 
 // ErrorResponse represents an error response in JSON
@@ -96,6 +221,109 @@ type ErrorDetail struct {
 	Timestamp int64             `json:"timestamp"`
 }
 
+// CreateSubnetRepositoryJSON is the create subnet payload, also used for each bulk create item
+type CreateSubnetRepositoryJSON struct {
+	CIDR           string             `json:"cidr"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description,omitempty"`
+	Location       string             `json:"location,omitempty"`
+	LocationType   string             `json:"location_type,omitempty"`
+	Environment    string             `json:"environment,omitempty"`
+	DHCPRangeStart string             `json:"dhcp_range_start,omitempty"`
+	DHCPRangeEnd   string             `json:"dhcp_range_end,omitempty"`
+	DNSZone        string             `json:"dns_zone,omitempty"`
+	CloudInfo      *CloudInfoJSON     `json:"cloud_info,omitempty"`
+	Tags           map[string]string  `json:"tags,omitempty"`
+	ParentID       string             `json:"parent_id,omitempty"`
+	Details        *SubnetDetailsJSON `json:"details,omitempty"` // Stored as-is with ?skip_details=true, otherwise recalculated
+}
+
+// missingField returns the message for the first missing required field, or ""
+func (c *CreateSubnetRepositoryJSON) missingField() string {
+	if c.CIDR == "" {
+		return "CIDR is required"
+	}
+	if c.Name == "" {
+		return "Name is required"
+	}
+	return ""
+}
+
+// toRepositorySubnet converts the payload to a new repository subnet with a generated ID
+func (c *CreateSubnetRepositoryJSON) toRepositorySubnet() *repository.Subnet {
+	subnet := &repository.Subnet{
+		ID:             uuid.New().String(),
+		Name:           c.Name,
+		CIDR:           c.CIDR,
+		Location:       c.Location,
+		LocationType:   c.LocationType,
+		Environment:    c.Environment,
+		DHCPRangeStart: c.DHCPRangeStart,
+		DHCPRangeEnd:   c.DHCPRangeEnd,
+		DNSZone:        c.DNSZone,
+		Tags:           c.Tags,
+		ParentID:       c.ParentID,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	if c.CloudInfo != nil {
+		subnet.CloudInfo = &repository.CloudInfo{
+			Provider:     c.CloudInfo.Provider,
+			Region:       c.CloudInfo.Region,
+			AccountID:    c.CloudInfo.AccountID,
+			ResourceType: c.CloudInfo.ResourceType,
+			VPCId:        c.CloudInfo.VPCId,
+			SubnetId:     c.CloudInfo.SubnetId,
+		}
+	}
+
+	if c.Details != nil {
+		subnet.Details = &repository.SubnetDetails{
+			Address:     c.Details.Address,
+			Netmask:     c.Details.Netmask,
+			Wildcard:    c.Details.Wildcard,
+			Network:     c.Details.Network,
+			Type:        c.Details.Type,
+			Broadcast:   c.Details.Broadcast,
+			HostMin:     c.Details.HostMin,
+			HostMax:     c.Details.HostMax,
+			HostsPerNet: c.Details.HostsPerNet,
+			IsPublic:    c.Details.IsPublic,
+		}
+	}
+
+	return subnet
+}
+
+// BulkCreateSubnetsResponseJSON represents the bulk create response in JSON
+type BulkCreateSubnetsResponseJSON struct {
+	Success bool                          `json:"success"`
+	Created int32                         `json:"created"`
+	Results []*BulkCreateSubnetResultJSON `json:"results"`
+}
+
+// BulkCreateSubnetResultJSON reports the outcome of one bulk create item
+type BulkCreateSubnetResultJSON struct {
+	Index   int          `json:"index"`
+	CIDR    string       `json:"cidr"`
+	Success bool         `json:"success"`
+	ID      string       `json:"id,omitempty"`
+	Error   *ErrorDetail `json:"error,omitempty"`
+}
+
+// UtilizationReportJSON is one externally computed allocated IP count
+type UtilizationReportJSON struct {
+	SubnetID     string `json:"subnet_id"`
+	AllocatedIPs *int32 `json:"allocated_ips"`
+}
+
+// BulkUpdateUtilizationResponseJSON represents the bulk utilization update response in JSON
+type BulkUpdateUtilizationResponseJSON struct {
+	Success bool  `json:"success"`
+	Updated int32 `json:"updated"`
+}
+
 // DeleteResponseJSON represents the delete response in JSON
 type DeleteResponseJSON struct {
 	Success bool `json:"success"`
@@ -108,6 +336,7 @@ type CreateConnectionJSON struct {
 	SourceSubnetID string                 `json:"source_subnet_id"`
 	TargetSubnetID string                 `json:"target_subnet_id"`
 	ConnectionType string                 `json:"connection_type"`
+	Status         string                 `json:"status,omitempty"`
 	Name           string                 `json:"name"`
 	Description    string                 `json:"description,omitempty"`
 	Bandwidth      string                 `json:"bandwidth,omitempty"`
@@ -151,6 +380,434 @@ type ListConnectionsResponseJSON struct {
 	TotalCount  int32             `json:"total_count"`
 }
 
+// SubnetConnectionJSON is a connection seen from one of its subnets; Direction
+// is "source" when that subnet is the source and "target" otherwise
+type SubnetConnectionJSON struct {
+	*ConnectionJSON
+	Direction string `json:"direction"`
+}
+
+// SubnetConnectionsResponseJSON represents the connections of a subnet in JSON
+type SubnetConnectionsResponseJSON struct {
+	Connections []*SubnetConnectionJSON `json:"connections"`
+	TotalCount  int32                   `json:"total_count"`
+}
+
+// Note JSON structures
+
+// CreateNoteJSON represents the JSON request for appending a subnet note
+type CreateNoteJSON struct {
+	Text string `json:"text"`
+}
+
+// NoteJSON represents a subnet note in JSON format
+type NoteJSON struct {
+	ID        string `json:"id"`
+	SubnetID  string `json:"subnet_id"`
+	Author    string `json:"author"`
+	Text      string `json:"text"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ListNotesResponseJSON represents the list subnet notes response in JSON
+type ListNotesResponseJSON struct {
+	Notes      []*NoteJSON `json:"notes"`
+	TotalCount int32       `json:"total_count"`
+}
+
+// IP allocation JSON structures
+
+// CreateAllocationJSON represents the JSON request for allocating an IP.
+// When IP is empty the lowest free host address is allocated.
+type CreateAllocationJSON struct {
+	IP          string `json:"ip,omitempty"`
+	Hostname    string `json:"hostname,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// AllocationJSON represents an IP allocation in JSON format
+type AllocationJSON struct {
+	SubnetID    string `json:"subnet_id"`
+	IP          string `json:"ip"`
+	Hostname    string `json:"hostname,omitempty"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// ListAllocationsResponseJSON represents the list IP allocations response in JSON
+type ListAllocationsResponseJSON struct {
+	Allocations []*AllocationJSON `json:"allocations"`
+	TotalCount  int32             `json:"total_count"`
+}
+
+// Reserved range JSON structures
+
+// CreateReservationJSON represents the JSON request for reserving addresses.
+// When EndIP is empty only StartIP is reserved.
+type CreateReservationJSON struct {
+	StartIP string `json:"start_ip"`
+	EndIP   string `json:"end_ip,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ReservationJSON represents a reserved range in JSON format
+type ReservationJSON struct {
+	ID        string `json:"id"`
+	SubnetID  string `json:"subnet_id"`
+	StartIP   string `json:"start_ip"`
+	EndIP     string `json:"end_ip"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ListReservationsResponseJSON represents the list reserved ranges response in JSON
+type ListReservationsResponseJSON struct {
+	Reservations []*ReservationJSON `json:"reservations"`
+	TotalCount   int32              `json:"total_count"`
+}
+
+// UtilizationSampleJSON represents one point of a subnet's utilization history
+type UtilizationSampleJSON struct {
+	Percent      float64 `json:"percent"`
+	TotalIPs     int32   `json:"total_ips"`
+	AllocatedIPs int32   `json:"allocated_ips"`
+	RecordedAt   int64   `json:"recorded_at"`
+}
+
+// UtilizationHistoryResponseJSON represents a subnet's utilization history, oldest first
+type UtilizationHistoryResponseJSON struct {
+	SubnetID string                   `json:"subnet_id"`
+	Samples  []*UtilizationSampleJSON `json:"samples"`
+}
+
+// NextAvailableSubnetJSON represents the next free child block of a subnet
+type NextAvailableSubnetJSON struct {
+	ParentID     string `json:"parent_id"`
+	PrefixLength int    `json:"prefix_length"`
+	CIDR         string `json:"cidr"`
+}
+
+// SplitSubnetJSON represents the request for splitting a subnet into equal children
+type SplitSubnetJSON struct {
+	Prefix int `json:"prefix"`
+}
+
+// RenumberSubnetJSON represents the request for moving a subnet to a new base CIDR
+type RenumberSubnetJSON struct {
+	CIDR string `json:"cidr"`
+}
+
+// RenumberSubnetResponseJSON lists the renumbered subnet followed by its descendants
+type RenumberSubnetResponseJSON struct {
+	Subnets []*SubnetJSON `json:"subnets"`
+	Count   int           `json:"count"`
+}
+
+// SplitSubnetResponseJSON represents the children created by a split
+type SplitSubnetResponseJSON struct {
+	ParentID     string        `json:"parent_id"`
+	PrefixLength int           `json:"prefix_length"`
+	Subnets      []*SubnetJSON `json:"subnets"`
+	Count        int           `json:"count"`
+}
+
+// SplitPreviewJSON lists the child CIDRs a split would create
+type SplitPreviewJSON struct {
+	ParentID     string   `json:"parent_id"`
+	PrefixLength int      `json:"prefix_length"`
+	CIDRs        []string `json:"cidrs"`
+	Count        int      `json:"count"`
+}
+
+// ValidateTilingJSON lists the candidate child CIDRs to check against a parent
+type ValidateTilingJSON struct {
+	CIDRs []string `json:"cidrs"`
+}
+
+// TilingOverlapJSON is a pair of candidate CIDRs sharing addresses
+type TilingOverlapJSON struct {
+	CIDRs   [2]string `json:"cidrs"`
+	Overlap string    `json:"overlap"`
+}
+
+// TilingValidationJSON reports whether candidate CIDRs exactly cover a parent
+type TilingValidationJSON struct {
+	ParentID   string               `json:"parent_id"`
+	ParentCIDR string               `json:"parent_cidr"`
+	Valid      bool                 `json:"valid"`
+	Gaps       []string             `json:"gaps"`
+	Overlaps   []*TilingOverlapJSON `json:"overlaps"`
+	Outside    []string             `json:"outside"`
+}
+
+// SubnetExportJSON is one subnet row of a CSV or NDJSON export
+type SubnetExportJSON struct {
+	ID                 string  `json:"id"`
+	CIDR               string  `json:"cidr"`
+	Name               string  `json:"name"`
+	Location           string  `json:"location"`
+	LocationType       string  `json:"location_type"`
+	CloudProvider      string  `json:"cloud_provider"`
+	CloudRegion        string  `json:"cloud_region"`
+	AccountID          string  `json:"account_id"`
+	TotalIPs           int32   `json:"total_ips"`
+	AllocatedIPs       int32   `json:"allocated_ips"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+// SubnetExportColumns is the CSV header row, in the order of CSVRecord
+var SubnetExportColumns = []string{
+	"id", "cidr", "name", "location", "location_type",
+	"cloud_provider", "cloud_region", "account_id",
+	"total_ips", "allocated_ips", "utilization_percent",
+}
+
+// RepositorySubnetToExportJSON flattens a repository subnet into an export row
+func RepositorySubnetToExportJSON(subnet *repository.Subnet) *SubnetExportJSON {
+	row := &SubnetExportJSON{
+		ID:           subnet.ID,
+		CIDR:         subnet.CIDR,
+		Name:         subnet.Name,
+		Location:     subnet.Location,
+		LocationType: subnet.LocationType,
+	}
+	if subnet.CloudInfo != nil {
+		row.CloudProvider = subnet.CloudInfo.Provider
+		row.CloudRegion = subnet.CloudInfo.Region
+		row.AccountID = subnet.CloudInfo.AccountID
+	}
+	if subnet.Utilization != nil {
+		row.TotalIPs = subnet.Utilization.TotalIPs
+		row.AllocatedIPs = subnet.Utilization.AllocatedIPs
+		row.UtilizationPercent = subnet.Utilization.UtilizationPercent
+	}
+	return row
+}
+
+// CSVRecord returns the row's fields in SubnetExportColumns order. Text fields
+// are escaped so spreadsheets do not evaluate them as formulas.
+func (e *SubnetExportJSON) CSVRecord() []string {
+	return []string{
+		csvText(e.ID), e.CIDR, csvText(e.Name), csvText(e.Location), csvText(e.LocationType),
+		csvText(e.CloudProvider), csvText(e.CloudRegion), csvText(e.AccountID),
+		strconv.FormatInt(int64(e.TotalIPs), 10),
+		strconv.FormatInt(int64(e.AllocatedIPs), 10),
+		strconv.FormatFloat(e.UtilizationPercent, 'f', 2, 64),
+	}
+}
+
+// csvText prefixes a cell starting with a formula character with a single
+// quote, which spreadsheets display as text instead of evaluating
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// NetBoxPrefixJSON is a subnet in the shape of NetBox's writable prefix model,
+// as accepted by POST /api/ipam/prefixes/ and the prefix bulk import. IPAM
+// fields without a NetBox equivalent are carried as custom fields, which must
+// be defined in NetBox before importing.
+type NetBoxPrefixJSON struct {
+	Prefix       string            `json:"prefix"`
+	Status       string            `json:"status"`
+	Description  string            `json:"description"`
+	IsPool       bool              `json:"is_pool"`
+	Tags         []*NetBoxTagJSON  `json:"tags"`
+	CustomFields map[string]string `json:"custom_fields"`
+}
+
+// NetBoxTagJSON is a NetBox tag reference
+type NetBoxTagJSON struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// NetBox field limits
+const (
+	netBoxDescriptionMaxLength = 200
+	netBoxTagMaxLength         = 100
+)
+
+// NetBox prefix statuses used by the export
+const (
+	netBoxStatusActive    = "active"
+	netBoxStatusContainer = "container"
+)
+
+// RepositorySubnetToNetBoxJSON maps a repository subnet to a NetBox prefix.
+// The subnet name becomes the description, cloud VPCs become containers,
+// and each key=value tag becomes a tag named "key:value".
+func RepositorySubnetToNetBoxJSON(subnet *repository.Subnet) *NetBoxPrefixJSON {
+	prefix := &NetBoxPrefixJSON{
+		Prefix:      subnet.CIDR,
+		Status:      netBoxStatusActive,
+		Description: truncateRunes(subnet.Name, netBoxDescriptionMaxLength),
+		Tags:        []*NetBoxTagJSON{},
+		CustomFields: map[string]string{
+			"ipam_id": subnet.ID,
+		},
+	}
+
+	setField := func(name, value string) {
+		if value != "" {
+			prefix.CustomFields[name] = value
+		}
+	}
+	setField("ipam_location", subnet.Location)
+	setField("ipam_location_type", subnet.LocationType)
+	setField("ipam_environment", subnet.Environment)
+	setField("ipam_parent_id", subnet.ParentID)
+	if subnet.CloudInfo != nil {
+		if subnet.CloudInfo.ResourceType == "vpc" {
+			prefix.Status = netBoxStatusContainer
+		}
+		setField("ipam_cloud_provider", subnet.CloudInfo.Provider)
+		setField("ipam_cloud_region", subnet.CloudInfo.Region)
+		setField("ipam_cloud_account_id", subnet.CloudInfo.AccountID)
+		setField("ipam_cloud_vpc_id", subnet.CloudInfo.VPCId)
+		setField("ipam_cloud_subnet_id", subnet.CloudInfo.SubnetId)
+	}
+
+	keys := make([]string, 0, len(subnet.Tags))
+	for key := range subnet.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := truncateRunes(key+":"+subnet.Tags[key], netBoxTagMaxLength)
+		prefix.Tags = append(prefix.Tags, &NetBoxTagJSON{Name: name, Slug: netBoxSlug(name)})
+	}
+
+	return prefix
+}
+
+// netBoxSlug turns a tag name into a NetBox slug: lowercase letters, digits,
+// underscores and hyphens, with other runs of characters replaced by a hyphen
+func netBoxSlug(name string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingHyphen = true
+	}
+	if b.Len() == 0 {
+		return "tag"
+	}
+	return truncateRunes(b.String(), netBoxTagMaxLength)
+}
+
+// truncateRunes shortens s to at most max runes
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// SubnetTreeJSON is a subnet with its nested children. DescendantCount
+// always covers the whole subtree, including levels cut off by max_depth.
+type SubnetTreeJSON struct {
+	*SubnetJSON
+	DescendantCount int               `json:"descendant_count"`
+	Children        []*SubnetTreeJSON `json:"children"`
+}
+
+// SubnetTreeToJSON converts a subnet tree, nesting at most maxDepth levels of
+// children below the root; a negative maxDepth nests every level
+func SubnetTreeToJSON(node *service.SubnetTreeNode, maxDepth int) *SubnetTreeJSON {
+	tree := &SubnetTreeJSON{
+		SubnetJSON:      RepositorySubnetToJSON(node.Subnet),
+		DescendantCount: node.DescendantCount,
+		Children:        []*SubnetTreeJSON{},
+	}
+	if maxDepth == 0 {
+		return tree
+	}
+	for _, child := range node.Children {
+		tree.Children = append(tree.Children, SubnetTreeToJSON(child, maxDepth-1))
+	}
+	return tree
+}
+
+// SubnetPathJSON lists the CIDRs from the hierarchy root down to a subnet
+type SubnetPathJSON struct {
+	SubnetID string   `json:"subnet_id"`
+	Path     []string `json:"path"`
+}
+
+// SubnetLookupJSON is the most specific subnet containing an IP address
+type SubnetLookupJSON struct {
+	IP      string        `json:"ip"`
+	Subnet  *SubnetJSON   `json:"subnet"`
+	Parents []*SubnetJSON `json:"parents"`
+}
+
+// FindBatchRequestJSON lists the IP addresses to resolve to subnets
+type FindBatchRequestJSON struct {
+	IPs []string `json:"ips"`
+}
+
+// FindBatchResultJSON is the most specific subnet containing one IP address,
+// or a null subnet when none does
+type FindBatchResultJSON struct {
+	IP     string      `json:"ip"`
+	Subnet *SubnetJSON `json:"subnet"`
+}
+
+// FindBatchResponseJSON holds one result per requested IP, in request order
+type FindBatchResponseJSON struct {
+	Results []*FindBatchResultJSON `json:"results"`
+}
+
+// ContainedSubnetsJSON lists the subnets found within a CIDR block
+type ContainedSubnetsJSON struct {
+	CIDR    string        `json:"cidr"`
+	Subnets []*SubnetJSON `json:"subnets"`
+}
+
+// CIDR tool JSON structures
+
+// SubtractCIDRJSON represents the JSON request for subtracting CIDRs from a parent
+type SubtractCIDRJSON struct {
+	From     string   `json:"from"`
+	Subtract []string `json:"subtract"`
+}
+
+// SubtractCIDRResponseJSON represents the ranges left after a subtraction
+type SubtractCIDRResponseJSON struct {
+	From      string   `json:"from"`
+	Subtract  []string `json:"subtract"`
+	Remaining []string `json:"remaining"`
+}
+
+// CalculateRequestJSON lists the CIDRs to compute subnet details for
+type CalculateRequestJSON struct {
+	CIDRs []string `json:"cidrs"`
+}
+
+// CalculateResultJSON holds the details of one CIDR, or the error that
+// prevented computing them
+type CalculateResultJSON struct {
+	CIDR    string             `json:"cidr"`
+	Details *SubnetDetailsJSON `json:"details,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// CalculateResponseJSON holds one result per requested CIDR, in request order
+type CalculateResponseJSON struct {
+	Results []*CalculateResultJSON `json:"results"`
+}
+
 // JSONToCreateSubnetRequest converts JSON to Protobuf CreateSubnetRequest
 func JSONToCreateSubnetRequest(data []byte) (*pb.CreateSubnetRequest, error) {
 	var jsonReq CreateSubnetJSON
@@ -177,22 +834,47 @@ func JSONToCreateSubnetRequest(data []byte) (*pb.CreateSubnetRequest, error) {
 	return req, nil
 }
 
-// JSONToUpdateSubnetRequest converts JSON to Protobuf UpdateSubnetRequest
-func JSONToUpdateSubnetRequest(id string, data []byte) (*pb.UpdateSubnetRequest, error) {
+// JSONToUpdateSubnetRequest converts JSON to Protobuf UpdateSubnetRequest. The
+// Protobuf request cannot tell an omitted string from an empty one, so the
+// returned options record which optional fields were present in the JSON.
+func JSONToUpdateSubnetRequest(id string, data []byte) (*pb.UpdateSubnetRequest, service.UpdateSubnetOptions, error) {
 	var jsonReq UpdateSubnetJSON
 	if err := json.Unmarshal(data, &jsonReq); err != nil {
-		return nil, fmt.Errorf("invalid JSON: %w", err)
+		return nil, service.UpdateSubnetOptions{}, fmt.Errorf("invalid JSON: %w", err)
 	}
 
+	req, opts := UpdateSubnetJSONToRequest(id, &jsonReq)
+	return req, opts, nil
+}
+
+// UpdateSubnetJSONToRequest converts a decoded update body to a Protobuf
+// UpdateSubnetRequest and the options recording which optional fields were set
+func UpdateSubnetJSONToRequest(id string, jsonReq *UpdateSubnetJSON) (*pb.UpdateSubnetRequest, service.UpdateSubnetOptions) {
+	var opts service.UpdateSubnetOptions
 	req := &pb.UpdateSubnetRequest{
 		Id:           id,
 		Cidr:         jsonReq.CIDR,
-		Name:         jsonReq.Name,
-		Description:  jsonReq.Description,
-		Location:     jsonReq.Location,
 		LocationType: stringToLocationType(jsonReq.LocationType),
 	}
 
+	opts.SetFields = make(service.UpdateFieldSet)
+	if jsonReq.Name != nil {
+		req.Name = *jsonReq.Name
+		opts.SetFields[service.UpdateFieldName] = true
+	}
+	if jsonReq.Description != nil {
+		req.Description = *jsonReq.Description
+		opts.SetFields[service.UpdateFieldDescription] = true
+	}
+	if jsonReq.Location != nil {
+		req.Location = *jsonReq.Location
+		opts.SetFields[service.UpdateFieldLocation] = true
+	}
+	opts.DHCPRangeStart = jsonReq.DHCPRangeStart
+	opts.DHCPRangeEnd = jsonReq.DHCPRangeEnd
+	opts.DNSZone = jsonReq.DNSZone
+	opts.Environment = jsonReq.Environment
+
 	if jsonReq.CloudInfo != nil {
 		req.CloudInfo = &pb.CloudInfo{
 			Provider:  jsonReq.CloudInfo.Provider,
@@ -201,7 +883,7 @@ func JSONToUpdateSubnetRequest(id string, data []byte) (*pb.UpdateSubnetRequest,
 		}
 	}
 
-	return req, nil
+	return req, opts
 }
 
 // SubnetToJSON converts a Protobuf Subnet to JSON format
@@ -233,24 +915,14 @@ func SubnetToJSON(subnet *pb.Subnet) *SubnetJSON {
 	}
 
 	if subnet.Details != nil {
-		result.Details = &SubnetDetailsJSON{
-			Address:     subnet.Details.Address,
-			Netmask:     subnet.Details.Netmask,
-			Wildcard:    subnet.Details.Wildcard,
-			Network:     subnet.Details.Network,
-			Type:        subnet.Details.Type,
-			Broadcast:   subnet.Details.Broadcast,
-			HostMin:     subnet.Details.HostMin,
-			HostMax:     subnet.Details.HostMax,
-			HostsPerNet: subnet.Details.HostsPerNet,
-			IsPublic:    subnet.Details.IsPublic,
-		}
+		result.Details = SubnetDetailsToJSON(subnet.Details)
 	}
 
 	if subnet.Utilization != nil {
 		result.Utilization = &UtilizationJSON{
 			TotalIPs:           subnet.Utilization.TotalIps,
 			AllocatedIPs:       subnet.Utilization.AllocatedIps,
+			AvailableIPs:       availableIPs(subnet.Utilization.TotalIps, subnet.Utilization.AllocatedIps),
 			UtilizationPercent: subnet.Utilization.UtilizationPercent,
 		}
 	}
@@ -258,6 +930,17 @@ func SubnetToJSON(subnet *pb.Subnet) *SubnetJSON {
 	return result
 }
 
+// emptyIfNil returns values, or an empty slice when values is nil, so list
+// fields serialize as [] rather than null. The list converters below allocate
+// their results and never return nil; slices passed through from the service
+// layer unconverted go through emptyIfNil.
+func emptyIfNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
+
 // SubnetsToJSON converts a slice of Protobuf Subnets to JSON format
 func SubnetsToJSON(subnets []*pb.Subnet) []*SubnetJSON {
 	result := make([]*SubnetJSON, len(subnets))
@@ -304,14 +987,23 @@ func RepositorySubnetToJSON(subnet *repository.Subnet) *SubnetJSON {
 	}
 
 	result := &SubnetJSON{
-		ID:           subnet.ID,
-		CIDR:         subnet.CIDR,
-		Name:         subnet.Name,
-		Location:     subnet.Location,
-		LocationType: subnet.LocationType,
-		ParentID:     subnet.ParentID,
-		CreatedAt:    subnet.CreatedAt.Unix(),
-		UpdatedAt:    subnet.UpdatedAt.Unix(),
+		ID:             subnet.ID,
+		CIDR:           subnet.CIDR,
+		Name:           subnet.Name,
+		Location:       subnet.Location,
+		LocationType:   subnet.LocationType,
+		Environment:    subnet.Environment,
+		DHCPRangeStart: subnet.DHCPRangeStart,
+		DHCPRangeEnd:   subnet.DHCPRangeEnd,
+		DNSZone:        subnet.DNSZone,
+		Tags:           subnet.Tags,
+		ParentID:       subnet.ParentID,
+		CreatedAt:      subnet.CreatedAt.Unix(),
+		UpdatedAt:      subnet.UpdatedAt.Unix(),
+	}
+
+	if subnet.ExpiresAt != nil {
+		result.ExpiresAt = subnet.ExpiresAt.Unix()
 	}
 
 	if subnet.CloudInfo != nil && subnet.CloudInfo.Provider != "" {
@@ -336,21 +1028,38 @@ func RepositorySubnetToJSON(subnet *repository.Subnet) *SubnetJSON {
 			HostMin:     subnet.Details.HostMin,
 			HostMax:     subnet.Details.HostMax,
 			HostsPerNet: subnet.Details.HostsPerNet,
+			HostCount:   hostCount(subnet.Details.HostMin, subnet.Details.HostMax),
 			IsPublic:    subnet.Details.IsPublic,
 		}
 	}
 
 	if subnet.Utilization != nil {
 		result.Utilization = &UtilizationJSON{
-			TotalIPs:           subnet.Utilization.TotalIPs,
-			AllocatedIPs:       subnet.Utilization.AllocatedIPs,
-			UtilizationPercent: float32(subnet.Utilization.UtilizationPercent),
+			TotalIPs:                 subnet.Utilization.TotalIPs,
+			AllocatedIPs:             subnet.Utilization.AllocatedIPs,
+			AvailableIPs:             availableIPs(subnet.Utilization.TotalIPs, subnet.Utilization.AllocatedIPs),
+			UtilizationPercent:       float32(subnet.Utilization.UtilizationPercent),
+			PrefixUtilizationPercent: float32(subnet.Utilization.PrefixUtilizationPercent),
 		}
 	}
 
 	return result
 }
 
+// ChildRollupToJSON converts a repository ChildRollup to JSON format
+func ChildRollupToJSON(rollup *repository.ChildRollup) *ChildRollupJSON {
+	if rollup == nil {
+		return nil
+	}
+
+	return &ChildRollupJSON{
+		ChildCount:         rollup.ChildCount,
+		TotalIPs:           rollup.TotalIPs,
+		AllocatedIPs:       rollup.AllocatedIPs,
+		UtilizationPercent: rollup.UtilizationPercent,
+	}
+}
+
 // RepositorySubnetsToJSON converts a slice of repository Subnets to JSON format
 func RepositorySubnetsToJSON(subnets []*repository.Subnet) []*SubnetJSON {
 	result := make([]*SubnetJSON, len(subnets))
@@ -393,3 +1102,128 @@ func RepositoryConnectionsToJSON(connections []*repository.Connection) []*Connec
 	}
 	return result
 }
+
+// Note conversion functions
+
+// RepositoryNoteToJSON converts a repository SubnetNote to JSON format
+func RepositoryNoteToJSON(note *repository.SubnetNote) *NoteJSON {
+	if note == nil {
+		return nil
+	}
+
+	return &NoteJSON{
+		ID:        note.ID,
+		SubnetID:  note.SubnetID,
+		Author:    note.Author,
+		Text:      note.Text,
+		CreatedAt: note.CreatedAt.Unix(),
+	}
+}
+
+// RepositoryNotesToJSON converts a slice of repository SubnetNotes to JSON format
+func RepositoryNotesToJSON(notes []*repository.SubnetNote) []*NoteJSON {
+	result := make([]*NoteJSON, len(notes))
+	for i, note := range notes {
+		result[i] = RepositoryNoteToJSON(note)
+	}
+	return result
+}
+
+// RepositoryAllocationToJSON converts a repository IPAllocation to JSON format
+func RepositoryAllocationToJSON(allocation *repository.IPAllocation) *AllocationJSON {
+	if allocation == nil {
+		return nil
+	}
+
+	return &AllocationJSON{
+		SubnetID:    allocation.SubnetID,
+		IP:          allocation.IP,
+		Hostname:    allocation.Hostname,
+		Description: allocation.Description,
+		CreatedAt:   allocation.CreatedAt.Unix(),
+	}
+}
+
+// RepositoryUtilizationSamplesToJSON converts repository utilization samples to JSON format
+func RepositoryUtilizationSamplesToJSON(samples []*repository.UtilizationSample) []*UtilizationSampleJSON {
+	result := make([]*UtilizationSampleJSON, len(samples))
+	for i, sample := range samples {
+		result[i] = &UtilizationSampleJSON{
+			Percent:      sample.Percent,
+			TotalIPs:     sample.TotalIPs,
+			AllocatedIPs: sample.AllocatedIPs,
+			RecordedAt:   sample.RecordedAt.Unix(),
+		}
+	}
+	return result
+}
+
+// RepositoryAllocationsToJSON converts a slice of repository IPAllocations to JSON format
+func RepositoryAllocationsToJSON(allocations []*repository.IPAllocation) []*AllocationJSON {
+	result := make([]*AllocationJSON, len(allocations))
+	for i, allocation := range allocations {
+		result[i] = RepositoryAllocationToJSON(allocation)
+	}
+	return result
+}
+
+// RepositoryReservationToJSON converts a repository ReservedRange to JSON format
+func RepositoryReservationToJSON(reservation *repository.ReservedRange) *ReservationJSON {
+	if reservation == nil {
+		return nil
+	}
+
+	return &ReservationJSON{
+		ID:        reservation.ID,
+		SubnetID:  reservation.SubnetID,
+		StartIP:   reservation.StartIP,
+		EndIP:     reservation.EndIP,
+		Reason:    reservation.Reason,
+		CreatedAt: reservation.CreatedAt.Unix(),
+	}
+}
+
+// RepositoryReservationsToJSON converts a slice of repository ReservedRanges to JSON format
+func RepositoryReservationsToJSON(reservations []*repository.ReservedRange) []*ReservationJSON {
+	result := make([]*ReservationJSON, len(reservations))
+	for i, reservation := range reservations {
+		result[i] = RepositoryReservationToJSON(reservation)
+	}
+	return result
+}
+
+// EfficiencyStatsToJSON converts efficiency stats to their JSON representation
+func EfficiencyStatsToJSON(stats *service.EfficiencyStats) *EfficiencyStatsJSON {
+	resp := &EfficiencyStatsJSON{
+		IPv4:  efficiencyTotalsToJSON(stats.IPv4),
+		IPv6:  efficiencyTotalsToJSON(stats.IPv6),
+		Pools: make([]*PoolEfficiencyJSON, len(stats.Pools)),
+	}
+	for i, pool := range stats.Pools {
+		resp.Pools[i] = &PoolEfficiencyJSON{
+			SubnetID:           pool.SubnetID,
+			Name:               pool.Name,
+			CIDR:               pool.CIDR,
+			TotalAddresses:     pool.TotalAddresses,
+			AllocatedAddresses: pool.AllocatedAddresses,
+			FreeAddresses:      pool.FreeAddresses,
+			FreeBlocks:         pool.FreeBlocks,
+			LargestFreeBlock:   pool.LargestFreeBlock,
+		}
+	}
+	return resp
+}
+
+// efficiencyTotalsToJSON converts the totals of one address family, keeping nil as nil
+func efficiencyTotalsToJSON(totals *service.EfficiencyTotals) *EfficiencyTotalsJSON {
+	if totals == nil {
+		return nil
+	}
+	return &EfficiencyTotalsJSON{
+		Pools:              totals.Pools,
+		TotalAddresses:     totals.TotalAddresses,
+		AllocatedAddresses: totals.AllocatedAddresses,
+		FreeAddresses:      totals.FreeAddresses,
+		FreeBlocks:         totals.FreeBlocks,
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/events"
+)
+
+func TestEventStream(t *testing.T) {
+	svc := newTestServiceLayer(t)
+	server := httptest.NewServer(NewGateway(svc, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/events")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %q", got)
+	}
+
+	// The subscription is registered before the headers are flushed
+	if got := svc.Events().SubscriberCount(); got != 1 {
+		t.Fatalf("Expected one subscriber, got %d", got)
+	}
+
+	create, err := http.Post(server.URL+"/api/v1/subnets", "application/json",
+		strings.NewReader(`{"cidr": "10.60.0.0/24", "name": "Streamed", "location": "eu-west"}`))
+	if err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+	var created SubnetJSON
+	if err := json.NewDecoder(create.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode created subnet: %v", err)
+	}
+	create.Body.Close()
+
+	lines := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var eventName, data string
+	timeout := time.After(5 * time.Second)
+	for data == "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Event stream closed before an event arrived")
+			}
+			if name, found := strings.CutPrefix(line, "event: "); found {
+				eventName = name
+			}
+			if payload, found := strings.CutPrefix(line, "data: "); found {
+				data = payload
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for an event")
+		}
+	}
+
+	if eventName != string(events.SubnetCreated) {
+		t.Errorf("Expected event %s, got %q", events.SubnetCreated, eventName)
+	}
+	var event events.Event
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Failed to decode event data %q: %v", data, err)
+	}
+	if event.Type != events.SubnetCreated || event.ID != created.ID {
+		t.Errorf("Expected %s for %s, got %+v", events.SubnetCreated, created.ID, event)
+	}
+
+	// Disconnecting unsubscribes the client
+	resp.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.Events().SubscriberCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the subscriber to be removed after disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
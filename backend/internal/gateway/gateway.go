@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/bananaops/ipam-bananaops/internal/service"
@@ -13,6 +15,18 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// apiPrefix is the path prefix of all versioned REST API routes
+const apiPrefix = "/api/v1"
+
+// resourcePath builds the API path of a resource, escaping each segment
+func resourcePath(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return apiPrefix + "/" + strings.Join(escaped, "/")
+}
+
 // RESTGateway handles HTTP REST requests and converts between JSON and Protobuf
 type RESTGateway struct {
 	serviceLayer *service.ServiceLayer
@@ -32,7 +46,7 @@ func NewRESTGateway(serviceLayer *service.ServiceLayer) *RESTGateway {
 // setupRoutes configures all REST API routes
 func (g *RESTGateway) setupRoutes() {
 	// API v1 routes
-	api := g.router.PathPrefix("/api/v1").Subrouter()
+	api := g.router.PathPrefix(apiPrefix).Subrouter()
 
 	// Subnet endpoints
 	api.HandleFunc("/subnets", g.handleCreateSubnet).Methods(http.MethodPost, http.MethodOptions)
@@ -89,6 +103,12 @@ func (g *RESTGateway) writeJSON(w http.ResponseWriter, status int, data interfac
 	}
 }
 
+// writeCreated writes a 201 response with the Location of the new resource and its full body
+func (g *RESTGateway) writeCreated(w http.ResponseWriter, location string, data interface{}) {
+	w.Header().Set("Location", location)
+	g.writeJSON(w, http.StatusCreated, data)
+}
+
 // writeError writes an error response in JSON format
 func (g *RESTGateway) writeError(w http.ResponseWriter, status int, code, message string) {
 	errResp := &ErrorResponse{
@@ -103,7 +123,7 @@ func (g *RESTGateway) writeError(w http.ResponseWriter, status int, code, messag
 
 // writeProtobufError writes a Protobuf error as JSON response
 func (g *RESTGateway) writeProtobufError(w http.ResponseWriter, pbErr *pb.Error) {
-	status := g.errorCodeToHTTPStatus(pbErr.Code)
+	status := errorCodeToHTTPStatus(pbErr.Code)
 	errResp := &ErrorResponse{
 		Error: &ErrorDetail{
 			Code:      pbErr.Code,
@@ -115,14 +135,17 @@ func (g *RESTGateway) writeProtobufError(w http.ResponseWriter, pbErr *pb.Error)
 	g.writeJSON(w, status, errResp)
 }
 
-// errorCodeToHTTPStatus maps error codes to HTTP status codes
-func (g *RESTGateway) errorCodeToHTTPStatus(code string) int {
+// errorCodeToHTTPStatus maps service error codes to HTTP status codes for
+// both gateways
+func errorCodeToHTTPStatus(code string) int {
 	switch code {
-	case "INVALID_CIDR", "INVALID_IP", "INVALID_REQUEST", "MISSING_FIELD", "INVALID_MESSAGE_FORMAT":
+	case "INVALID_CIDR", "INVALID_IP", "INVALID_REQUEST", "MISSING_FIELD", "INVALID_MESSAGE_FORMAT", "INVALID_PREFIX_LENGTH", "LIMIT_EXCEEDED", "INVALID_ENVIRONMENT", "INVALID_DHCP_RANGE":
 		return http.StatusBadRequest
 	case "SUBNET_NOT_FOUND":
 		return http.StatusNotFound
-	case "DUPLICATE_SUBNET":
+	case "PRECONDITION_FAILED":
+		return http.StatusPreconditionFailed
+	case "DUPLICATE_SUBNET", "OVERLAPPING_CIDR", "NO_SPACE_AVAILABLE", "CHILDREN_OUT_OF_RANGE", "RESERVATIONS_OUT_OF_RANGE", "HAS_CHILDREN", "CONFLICT":
 		return http.StatusConflict
 	case "DB_ERROR", "DB_CONNECTION_ERROR", "CALCULATION_ERROR":
 		return http.StatusInternalServerError
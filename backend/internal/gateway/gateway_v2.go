@@ -1,13 +1,22 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bananaops/ipam-bananaops/internal/cloudprovider"
+	"github.com/bananaops/ipam-bananaops/internal/config"
+	"github.com/bananaops/ipam-bananaops/internal/metrics"
 	"github.com/bananaops/ipam-bananaops/internal/repository"
 	"github.com/bananaops/ipam-bananaops/internal/service"
 	pb "github.com/bananaops/ipam-bananaops/proto"
@@ -19,16 +28,30 @@ import (
 type Gateway struct {
 	serviceLayer *service.ServiceLayer
 	cloudManager *cloudprovider.Manager
+	config       *config.Config
+	metrics      *metrics.Metrics
 	router       *mux.Router
 }
 
-// NewGateway creates a new gateway instance with cloud provider support
+// NewGateway creates a new gateway instance with cloud provider support.
+// Admin endpoints are disabled; use NewGatewayWithConfig to enable them.
 func NewGateway(serviceLayer *service.ServiceLayer, cloudManager *cloudprovider.Manager) *Gateway {
+	return NewGatewayWithConfig(serviceLayer, cloudManager, nil)
+}
+
+// NewGatewayWithConfig creates a gateway that can expose the running
+// configuration through the admin endpoints
+func NewGatewayWithConfig(serviceLayer *service.ServiceLayer, cloudManager *cloudprovider.Manager, cfg *config.Config) *Gateway {
 	g := &Gateway{
 		serviceLayer: serviceLayer,
 		cloudManager: cloudManager,
+		config:       cfg,
+		metrics:      metrics.New(serviceLayer),
 		router:       mux.NewRouter(),
 	}
+	if cloudManager != nil {
+		cloudManager.SetSyncObserver(g.metrics.ObserveCloudSync)
+	}
 	g.setupRoutes()
 	return g
 }
@@ -36,15 +59,46 @@ func NewGateway(serviceLayer *service.ServiceLayer, cloudManager *cloudprovider.
 // setupRoutes configures all REST API routes
 func (g *Gateway) setupRoutes() {
 	// API v1 routes
-	api := g.router.PathPrefix("/api/v1").Subrouter()
+	api := g.router.PathPrefix(apiPrefix).Subrouter()
 
 	// Subnet endpoints
 	api.HandleFunc("/subnets", g.handleCreateSubnetRepository).Methods(http.MethodPost, http.MethodOptions)
 	api.HandleFunc("/subnets", g.handleListSubnetsRepository).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/facets", g.handleSubnetFacets).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/bulk", g.handleBulkCreateSubnets).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/export", g.handleExportSubnets).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/lookup", g.handleLookupSubnets).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/find-batch", g.handleFindBatch).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/utilization", g.handleBulkUpdateUtilization).Methods(http.MethodPost, http.MethodOptions)
 	api.HandleFunc("/subnets/{id}", g.handleGetSubnet).Methods(http.MethodGet, http.MethodOptions)
 	api.HandleFunc("/subnets/{id}", g.handleUpdateSubnet).Methods(http.MethodPut, http.MethodOptions)
 	api.HandleFunc("/subnets/{id}", g.handleDeleteSubnet).Methods(http.MethodDelete, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/restore", g.handleRestoreSubnet).Methods(http.MethodPost, http.MethodOptions)
 	api.HandleFunc("/subnets/{id}/children", g.handleGetSubnetChildren).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/siblings", g.handleGetSubnetSiblings).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/connections", g.handleListSubnetConnections).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/path", g.handleGetSubnetPath).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/tree", g.handleGetSubnetTree).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/next-available", g.handleNextAvailableSubnet).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/split", g.handleSplitSubnet).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/split-preview", g.handleSplitPreview).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/validate-tiling", g.handleValidateTiling).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/renumber", g.handleRenumberSubnet).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/notes", g.handleCreateSubnetNote).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/notes", g.handleListSubnetNotes).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/notes/{noteId}", g.handleGetSubnetNote).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/allocations", g.handleCreateAllocation).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/allocations", g.handleListAllocations).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/allocations/{ip}", g.handleGetAllocation).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/allocations/{ip}", g.handleReleaseAllocation).Methods(http.MethodDelete, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/reservations", g.handleCreateReservation).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/reservations", g.handleListReservations).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/reservations/{reservationId}", g.handleGetReservation).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/reservations/{reservationId}", g.handleDeleteReservation).Methods(http.MethodDelete, http.MethodOptions)
+	api.HandleFunc("/subnets/{id}/utilization/history", g.handleUtilizationHistory).Methods(http.MethodGet, http.MethodOptions)
+
+	// IP allocations across subnets
+	api.HandleFunc("/ips", g.handleListAllIPAllocations).Methods(http.MethodGet, http.MethodOptions)
 
 	// Connection endpoints
 	api.HandleFunc("/connections", g.handleCreateConnection).Methods(http.MethodPost, http.MethodOptions)
@@ -53,28 +107,111 @@ func (g *Gateway) setupRoutes() {
 	api.HandleFunc("/connections/{id}", g.handleUpdateConnection).Methods(http.MethodPut, http.MethodOptions)
 	api.HandleFunc("/connections/{id}", g.handleDeleteConnection).Methods(http.MethodDelete, http.MethodOptions)
 
+	// CIDR tool endpoints
+	api.HandleFunc("/cidr/subtract", g.handleSubtractCIDR).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/calculate", g.handleCalculate).Methods(http.MethodPost, http.MethodOptions)
+
 	// Cloud provider endpoints
 	api.HandleFunc("/cloud/sync", g.HandleCloudSync).Methods(http.MethodPost, http.MethodOptions)
 	api.HandleFunc("/cloud/status", g.HandleCloudStatus).Methods(http.MethodGet, http.MethodOptions)
 	api.HandleFunc("/cloud/utilization/update", g.HandleUpdateUtilization).Methods(http.MethodPost, http.MethodOptions)
 
+	// Change event stream
+	api.HandleFunc("/events", g.handleEvents).Methods(http.MethodGet, http.MethodOptions)
+
+	// Statistics endpoints
+	api.HandleFunc("/stats/by-prefix-length", g.handleStatsByPrefixLength).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/stats/efficiency", g.handleStatsEfficiency).Methods(http.MethodGet, http.MethodOptions)
+
+	// Feature discovery
+	api.HandleFunc("/capabilities", g.handleCapabilities).Methods(http.MethodGet, http.MethodOptions)
+
+	// Admin endpoints
+	api.HandleFunc("/admin/config", g.requireAdmin(g.handleAdminConfig)).Methods(http.MethodGet, http.MethodOptions)
+
 	// Health check endpoints
 	g.router.HandleFunc("/health", g.handleHealth).Methods(http.MethodGet)
 	g.router.HandleFunc("/ready", g.handleReady).Methods(http.MethodGet)
+
+	// Prometheus metrics
+	g.router.Handle("/metrics", g.metrics.Handler()).Methods(http.MethodGet)
 }
 
 // Handler returns the HTTP handler with CORS middleware
 func (g *Gateway) Handler() http.Handler {
-	return g.corsMiddleware(g.router)
+	return g.corsMiddleware(g.limitRequestBody(g.router))
+}
+
+// DefaultMaxRequestBodyBytes is the request body limit used when none is configured
+const DefaultMaxRequestBodyBytes = 1 << 20
+
+// maxRequestBodyBytes returns the configured request body limit
+func (g *Gateway) maxRequestBodyBytes() int64 {
+	if g.config != nil && g.config.Server.MaxRequestBodyBytes > 0 {
+		return int64(g.config.Server.MaxRequestBodyBytes)
+	}
+	return DefaultMaxRequestBodyBytes
+}
+
+// limitRequestBody caps the size of every request body, so an oversized
+// payload fails while it is read instead of exhausting memory
+func (g *Gateway) limitRequestBody(next http.Handler) http.Handler {
+	limit := g.maxRequestBodyBytes()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before forwarding it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush forwards to the underlying writer so streaming handlers can flush
+// through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// routeLabel returns the path template of the route matching r, so that
+// request counters are not split by subnet or connection ID
+func (g *Gateway) routeLabel(r *http.Request) string {
+	var match mux.RouteMatch
+	if !g.router.Match(r, &match) || match.Route == nil {
+		return "unmatched"
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+	return template
 }
 
-// corsMiddleware adds CORS headers to responses
+// corsMiddleware adds CORS headers to responses and counts requests by route
+// and status code
 func (g *Gateway) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() { g.metrics.ObserveRequest(g.routeLabel(r), recorder.status) }()
+		w = recorder
+
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, If-Match, "+idempotencyKeyHeader)
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Location")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		// Handle preflight requests
@@ -92,9 +229,37 @@ func (g *Gateway) handleHealth(w http.ResponseWriter, r *http.Request) {
 	g.writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
 }
 
-// handleReady returns the readiness status of the service
+// readyCheckTimeout bounds how long /ready waits for the database
+const readyCheckTimeout = 2 * time.Second
+
+// ReadinessJSON reports whether the service can serve requests. Database
+// holds "ok" or the ping error; Cloud is set when cloud providers are enabled
+// and is informational only.
+type ReadinessJSON struct {
+	Status   string               `json:"status"`
+	Database string               `json:"database"`
+	Cloud    *CloudStatusResponse `json:"cloud,omitempty"`
+}
+
+// handleReady returns the readiness status of the service: 503 when the
+// database cannot be reached. /health stays a liveness check.
 func (g *Gateway) handleReady(w http.ResponseWriter, r *http.Request) {
-	g.writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	resp := &ReadinessJSON{Status: "ready", Database: "ok"}
+	status := http.StatusOK
+	if err := g.serviceLayer.Ping(ctx); err != nil {
+		log.Printf("Readiness check failed: database unreachable: %v", err)
+		resp.Status = "not_ready"
+		resp.Database = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+	if g.cloudManager != nil && g.cloudManager.IsEnabled() {
+		resp.Cloud = g.cloudStatus()
+	}
+
+	g.writeJSON(w, status, resp)
 }
 
 // writeJSON writes a JSON response with the given status code
@@ -106,6 +271,64 @@ func (g *Gateway) writeJSON(w http.ResponseWriter, status int, data interface{})
 	}
 }
 
+// writeCreated writes a 201 response with the Location of the new resource and its full body
+func (g *Gateway) writeCreated(w http.ResponseWriter, location string, data interface{}) {
+	w.Header().Set("Location", location)
+	g.writeJSON(w, http.StatusCreated, data)
+}
+
+// newRequestDecoder returns a JSON decoder for a request body that rejects
+// unknown fields when strict JSON is configured. Nesting needs no separate
+// guard: the body size limit bounds it, as does encoding/json's depth limit.
+func (g *Gateway) newRequestDecoder(body io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(body)
+	if g.config != nil && g.config.Server.StrictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder
+}
+
+// decodeRequest unmarshals a JSON request body into v like json.Unmarshal,
+// rejecting unknown fields when strict JSON is configured
+func (g *Gateway) decodeRequest(body []byte, v interface{}) error {
+	decoder := g.newRequestDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// writeReadBodyError reports a request body that could not be read, with 413
+// when it exceeded the size limit
+func (g *Gateway) writeReadBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		g.writeErrorResponse(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE",
+			fmt.Sprintf("Request body exceeds the limit of %d bytes", tooLarge.Limit), nil)
+		return
+	}
+	g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body", err)
+}
+
+// writeDecodeError reports a request body that does not decode into the
+// endpoint's JSON model, with UNKNOWN_FIELD for fields strict JSON rejected
+func (g *Gateway) writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		g.writeReadBodyError(w, err)
+	case errors.Is(err, io.EOF):
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		g.writeErrorResponse(w, http.StatusBadRequest, "UNKNOWN_FIELD", err.Error(), nil)
+	default:
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_MESSAGE_FORMAT", err.Error(), err)
+	}
+}
+
 // writeErrorResponse writes an error response in JSON format
 func (g *Gateway) writeErrorResponse(w http.ResponseWriter, status int, code, message string, err error) {
 	if err != nil {
@@ -124,7 +347,7 @@ func (g *Gateway) writeErrorResponse(w http.ResponseWriter, status int, code, me
 
 // writeProtobufError writes a Protobuf error as JSON response
 func (g *Gateway) writeProtobufError(w http.ResponseWriter, pbErr *pb.Error) {
-	status := g.errorCodeToHTTPStatus(pbErr.Code)
+	status := errorCodeToHTTPStatus(pbErr.Code)
 	errResp := &ErrorResponse{
 		Error: &ErrorDetail{
 			Code:      pbErr.Code,
@@ -136,24 +359,6 @@ func (g *Gateway) writeProtobufError(w http.ResponseWriter, pbErr *pb.Error) {
 	g.writeJSON(w, status, errResp)
 }
 
-// errorCodeToHTTPStatus maps error codes to HTTP status codes
-func (g *Gateway) errorCodeToHTTPStatus(code string) int {
-	switch code {
-	case "INVALID_CIDR", "INVALID_IP", "INVALID_REQUEST", "MISSING_FIELD", "INVALID_MESSAGE_FORMAT":
-		return http.StatusBadRequest
-	case "SUBNET_NOT_FOUND":
-		return http.StatusNotFound
-	case "DUPLICATE_SUBNET":
-		return http.StatusConflict
-	case "DB_ERROR", "DB_CONNECTION_ERROR", "CALCULATION_ERROR":
-		return http.StatusInternalServerError
-	case "PROVIDER_UNAVAILABLE", "PROVIDER_AUTH_FAILED", "PROVIDER_RATE_LIMITED":
-		return http.StatusServiceUnavailable
-	default:
-		return http.StatusInternalServerError
-	}
-}
-
 // Subnet handlers (copied from handlers.go and adapted)
 
 // handleCreateSubnet handles POST /api/v1/subnets
@@ -164,7 +369,7 @@ func (g *Gateway) handleCreateSubnet(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("[CreateSubnet] Failed to read body: %v", err)
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body", err)
+		g.writeReadBodyError(w, err)
 		return
 	}
 	defer r.Body.Close()
@@ -215,7 +420,7 @@ func (g *Gateway) handleCreateSubnet(w http.ResponseWriter, r *http.Request) {
 
 	// Convert response to JSON and send
 	jsonSubnet := SubnetToJSON(resp.Subnet)
-	g.writeJSON(w, http.StatusCreated, jsonSubnet)
+	g.writeCreated(w, resourcePath("subnets", resp.Subnet.Id), jsonSubnet)
 }
 
 // handleListSubnets handles GET /api/v1/subnets
@@ -253,6 +458,8 @@ func (g *Gateway) handleListSubnets(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleGetSubnet handles GET /api/v1/subnets/{id}
+// ?include=children,connections embeds the direct children and connections.
+// The ETag header identifies the version read, for If-Match on a later PUT.
 func (g *Gateway) handleGetSubnet(w http.ResponseWriter, r *http.Request) {
 	// Extract subnet ID from URL
 	vars := mux.Vars(r)
@@ -263,12 +470,22 @@ func (g *Gateway) handleGetSubnet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	includes, err := parseIncludes(r.URL.Query()["include"])
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error(), err)
+		return
+	}
+
 	req := &pb.GetSubnetRequest{
 		Id: id,
 	}
 
-	// Call service layer
-	resp, err := g.serviceLayer.GetSubnet(r.Context(), req)
+	// Call service layer; ?fresh=true recomputes details from the CIDR
+	getSubnet := g.serviceLayer.GetSubnet
+	if r.URL.Query().Get("fresh") == "true" {
+		getSubnet = g.serviceLayer.GetSubnetFresh
+	}
+	resp, err := getSubnet(r.Context(), req)
 	if err != nil {
 		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
 		return
@@ -282,10 +499,69 @@ func (g *Gateway) handleGetSubnet(w http.ResponseWriter, r *http.Request) {
 
 	// Convert response to JSON and send
 	jsonSubnet := SubnetToJSON(resp.Subnet)
-	g.writeJSON(w, http.StatusOK, jsonSubnet)
+	g.fillStoredFields(r.Context(), jsonSubnet)
+
+	response := &SubnetWithIncludesJSON{SubnetJSON: jsonSubnet}
+	if includes["children"] {
+		children, err := g.serviceLayer.GetSubnetChildren(r.Context(), id)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+			return
+		}
+		jsonChildren := RepositorySubnetsToJSON(children)
+		response.Children = &jsonChildren
+	}
+	if includes["connections"] {
+		connections, err := g.serviceLayer.ListSubnetConnections(r.Context(), id)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+			return
+		}
+		jsonConnections := RepositoryConnectionsToJSON(connections)
+		response.Connections = &jsonConnections
+	}
+	w.Header().Set("ETag", service.SubnetETag(jsonSubnet.ID, jsonSubnet.UpdatedAt))
+	g.writeJSON(w, http.StatusOK, response)
+}
+
+// subnetIncludes lists the related resources ?include can embed in a subnet response
+var subnetIncludes = map[string]bool{"children": true, "connections": true}
+
+// parseIncludes reads the comma-separated or repeated ?include parameter,
+// rejecting resources that cannot be embedded
+func parseIncludes(values []string) (map[string]bool, error) {
+	includes := make(map[string]bool)
+	for _, value := range values {
+		for _, include := range strings.Split(value, ",") {
+			include = strings.TrimSpace(include)
+			if include == "" {
+				continue
+			}
+			if !subnetIncludes[include] {
+				return nil, fmt.Errorf("unsupported include %q (must be children or connections)", include)
+			}
+			includes[include] = true
+		}
+	}
+	return includes, nil
+}
+
+// fillStoredFields copies the environment, DHCP range and DNS zone, which the
+// Protobuf model lacks, onto a subnet response, along with the stored updated_at
+// since setting those fields moves it
+func (g *Gateway) fillStoredFields(ctx context.Context, subnet *SubnetJSON) {
+	if stored, err := g.serviceLayer.GetSubnetRepository(ctx, subnet.ID); err == nil {
+		subnet.Environment = stored.Environment
+		subnet.DHCPRangeStart = stored.DHCPRangeStart
+		subnet.DHCPRangeEnd = stored.DHCPRangeEnd
+		subnet.DNSZone = stored.DNSZone
+		subnet.UpdatedAt = stored.UpdatedAt.Unix()
+	}
 }
 
 // handleUpdateSubnet handles PUT /api/v1/subnets/{id}
+// An If-Match header makes the update conditional on the subnet still having
+// that ETag; a subnet changed since answers 412 Precondition Failed.
 func (g *Gateway) handleUpdateSubnet(w http.ResponseWriter, r *http.Request) {
 	// Extract subnet ID from URL
 	vars := mux.Vars(r)
@@ -299,7 +575,7 @@ func (g *Gateway) handleUpdateSubnet(w http.ResponseWriter, r *http.Request) {
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body", err)
+		g.writeReadBodyError(w, err)
 		return
 	}
 	defer r.Body.Close()
@@ -311,14 +587,27 @@ func (g *Gateway) handleUpdateSubnet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert JSON to Protobuf request
-	req, err := JSONToUpdateSubnetRequest(id, body)
-	if err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_MESSAGE_FORMAT", err.Error(), err)
+	var jsonReq UpdateSubnetJSON
+	if err := g.decodeRequest(body, &jsonReq); err != nil {
+		g.writeDecodeError(w, err)
 		return
 	}
+	req, opts := UpdateSubnetJSONToRequest(id, &jsonReq)
+
+	// ?force=true allows a CIDR change that leaves existing children outside the subnet
+	if value := r.URL.Query().Get("force"); value != "" {
+		opts.Force, err = strconv.ParseBool(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "force must be true or false", err)
+			return
+		}
+	}
+
+	opts.IfMatch = r.Header.Get("If-Match")
 
 	// Call service layer
-	resp, err := g.serviceLayer.UpdateSubnet(r.Context(), req)
+	ctx := r.Context()
+	resp, err := g.serviceLayer.UpdateSubnetWithOptions(ctx, req, opts)
 	if err != nil {
 		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
 		return
@@ -332,10 +621,16 @@ func (g *Gateway) handleUpdateSubnet(w http.ResponseWriter, r *http.Request) {
 
 	// Convert response to JSON and send
 	jsonSubnet := SubnetToJSON(resp.Subnet)
+	g.fillStoredFields(ctx, jsonSubnet)
+	w.Header().Set("ETag", service.SubnetETag(jsonSubnet.ID, jsonSubnet.UpdatedAt))
 	g.writeJSON(w, http.StatusOK, jsonSubnet)
 }
 
 // handleDeleteSubnet handles DELETE /api/v1/subnets/{id}
+// Subnets are soft-deleted and can be restored; ?purge=true removes the
+// subnet and everything attached to it for good and requires the admin token.
+// ?idempotent=true answers 204 No Content whether or not the subnet still
+// existed, so clients can retry a delete safely; without it a missing subnet is a 404.
 func (g *Gateway) handleDeleteSubnet(w http.ResponseWriter, r *http.Request) {
 	// Extract subnet ID from URL
 	vars := mux.Vars(r)
@@ -346,17 +641,69 @@ func (g *Gateway) handleDeleteSubnet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	purge := false
+	if value := r.URL.Query().Get("purge"); value != "" {
+		var err error
+		purge, err = strconv.ParseBool(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "purge must be true or false", err)
+			return
+		}
+	}
+
+	cascade := false
+	if value := r.URL.Query().Get("cascade"); value != "" {
+		var err error
+		cascade, err = strconv.ParseBool(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "cascade must be true or false", err)
+			return
+		}
+	}
+
+	idempotent := false
+	if value := r.URL.Query().Get("idempotent"); value != "" {
+		var err error
+		idempotent, err = strconv.ParseBool(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "idempotent must be true or false", err)
+			return
+		}
+	}
+
+	if purge {
+		if !g.authorizeAdmin(w, r) {
+			return
+		}
+		err := g.serviceLayer.PurgeSubnet(r.Context(), id)
+		if idempotent && (err == nil || errors.Is(err, repository.ErrNotFound)) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			g.writeSubnetLookupError(w, err)
+			return
+		}
+		g.writeJSON(w, http.StatusOK, &DeleteResponseJSON{Success: true})
+		return
+	}
+
 	req := &pb.DeleteSubnetRequest{
 		Id: id,
 	}
 
 	// Call service layer
-	resp, err := g.serviceLayer.DeleteSubnet(r.Context(), req)
+	resp, err := g.serviceLayer.DeleteSubnetWithOptions(r.Context(), req, service.DeleteSubnetOptions{Cascade: cascade})
 	if err != nil {
 		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
 		return
 	}
 
+	if idempotent && (resp.Error == nil || resp.Error.Code == "SUBNET_NOT_FOUND") {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	// Check for service-level errors
 	if resp.Error != nil {
 		g.writeProtobufError(w, resp.Error)
@@ -367,6 +714,19 @@ func (g *Gateway) handleDeleteSubnet(w http.ResponseWriter, r *http.Request) {
 	g.writeJSON(w, http.StatusOK, &DeleteResponseJSON{Success: resp.Success})
 }
 
+// handleRestoreSubnet handles POST /api/v1/subnets/{id}/restore
+func (g *Gateway) handleRestoreSubnet(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	subnet, err := g.serviceLayer.RestoreSubnet(r.Context(), id)
+	if err != nil {
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, RepositorySubnetToJSON(subnet))
+}
+
 // handleGetSubnetChildren handles GET /api/v1/subnets/{id}/children
 func (g *Gateway) handleGetSubnetChildren(w http.ResponseWriter, r *http.Request) {
 	// Extract subnet ID from URL
@@ -394,168 +754,1550 @@ func (g *Gateway) handleGetSubnetChildren(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// handleListSubnetsRepository handles GET /api/v1/subnets using repository models
-func (g *Gateway) handleListSubnetsRepository(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
+// handleGetSubnetSiblings handles GET /api/v1/subnets/{id}/siblings
+// Siblings are the other subnets under the same parent, ordered by CIDR and
+// paged by page/page_size. Top-level subnets are siblings of each other.
+func (g *Gateway) handleGetSubnetSiblings(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 	query := r.URL.Query()
 
-	filters := repository.SubnetFilters{
-		LocationFilter:      query.Get("location"),
-		CloudProviderFilter: query.Get("cloud_provider"),
-		SearchQuery:         query.Get("search"),
-		Page:                parseIntParam(query.Get("page"), 0),
-		PageSize:            parseIntParam(query.Get("page_size"), 50),
-	}
-
-	ctx := r.Context()
-
-	// Use repository directly to get enhanced data
-	result, err := g.serviceLayer.ListSubnetsRepository(ctx, filters)
+	result, err := g.serviceLayer.GetSubnetSiblings(r.Context(), id,
+		parseIntParam(query.Get("page"), 0), parseIntParam(query.Get("page_size"), 50))
 	if err != nil {
-		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		g.writeSubnetLookupError(w, err)
 		return
 	}
 
-	// Convert repository models to JSON
-	jsonSubnets := RepositorySubnetsToJSON(result.Subnets)
-
-	jsonResp := &ListSubnetsResponseJSON{
-		Subnets:    jsonSubnets,
+	g.writeJSON(w, http.StatusOK, &ListSubnetsResponseJSON{
+		Subnets:    RepositorySubnetsToJSON(result.Subnets),
 		TotalCount: result.TotalCount,
-	}
-	g.writeJSON(w, http.StatusOK, jsonResp)
+	})
 }
 
-// handleCreateSubnetRepository handles POST /api/v1/subnets using repository models
-func (g *Gateway) handleCreateSubnetRepository(w http.ResponseWriter, r *http.Request) {
-	log.Println("[CreateSubnetRepository] Received request")
+// handleListSubnetConnections handles GET /api/v1/subnets/{id}/connections
+// Every connection the subnet is the source or target of is returned, newest
+// first, with its direction relative to the subnet.
+func (g *Gateway) handleListSubnetConnections(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	connections, err := g.serviceLayer.ListSubnetConnections(r.Context(), id)
 	if err != nil {
-		log.Printf("[CreateSubnetRepository] Failed to read body: %v", err)
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body", err)
+		g.writeSubnetLookupError(w, err)
 		return
 	}
-	defer r.Body.Close()
 
-	log.Printf("[CreateSubnetRepository] Request body: %s", string(body))
+	resp := &SubnetConnectionsResponseJSON{
+		Connections: make([]*SubnetConnectionJSON, len(connections)),
+		TotalCount:  int32(len(connections)),
+	}
+	for i, connection := range connections {
+		direction := "target"
+		if connection.SourceSubnetID == id {
+			direction = "source"
+		}
+		resp.Connections[i] = &SubnetConnectionJSON{
+			ConnectionJSON: RepositoryConnectionToJSON(connection),
+			Direction:      direction,
+		}
+	}
 
-	// Validate request body is not empty
-	if len(body) == 0 {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+	g.writeJSON(w, http.StatusOK, resp)
+}
+
+// exportPageSize is the number of subnets read per repository page while exporting
+const exportPageSize = 500
+
+// handleExportSubnets handles GET /api/v1/subnets/export?format=csv|json|netbox
+// The export is streamed page by page and flushed as it goes, so large
+// inventories are never held in memory. format=json produces NDJSON;
+// format=netbox produces a JSON array of NetBox prefixes for its bulk import.
+func (g *Gateway) handleExportSubnets(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	var startRows, flushRows func() error
+	var writeRow func(*repository.Subnet) error
+	closeRows := func() error { return nil }
+	switch format {
+	case "csv":
+		csvWriter := csv.NewWriter(w)
+		startRows = func() error {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="subnets.csv"`)
+			return csvWriter.Write(SubnetExportColumns)
+		}
+		writeRow = func(subnet *repository.Subnet) error {
+			return csvWriter.Write(RepositorySubnetToExportJSON(subnet).CSVRecord())
+		}
+		flushRows = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	case "json":
+		startRows = func() error {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="subnets.ndjson"`)
+			return nil
+		}
+		encoder := json.NewEncoder(w)
+		writeRow = func(subnet *repository.Subnet) error { return encoder.Encode(RepositorySubnetToExportJSON(subnet)) }
+		flushRows = func() error { return nil }
+	case "netbox":
+		startRows = func() error {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", `attachment; filename="subnets-netbox.json"`)
+			return nil
+		}
+		encoder := json.NewEncoder(w)
+		separator := "["
+		writeRow = func(subnet *repository.Subnet) error {
+			if _, err := io.WriteString(w, separator); err != nil {
+				return err
+			}
+			separator = ","
+			return encoder.Encode(RepositorySubnetToNetBoxJSON(subnet))
+		}
+		flushRows = func() error { return nil }
+		closeRows = func() error {
+			// An empty export never wrote the opening bracket
+			if separator == "[" {
+				_, err := io.WriteString(w, "[]\n")
+				return err
+			}
+			_, err := io.WriteString(w, "]\n")
+			return err
+		}
+	default:
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "format must be csv, json or netbox", nil)
 		return
 	}
 
-	// Parse JSON directly to repository model
-	var subnetData struct {
-		CIDR         string         `json:"cidr"`
-		Name         string         `json:"name"`
-		Description  string         `json:"description,omitempty"`
-		Location     string         `json:"location,omitempty"`
-		LocationType string         `json:"location_type,omitempty"`
-		CloudInfo    *CloudInfoJSON `json:"cloud_info,omitempty"`
-		ParentID     string         `json:"parent_id,omitempty"`
+	// Nothing is written until the first page has been read, so a failing
+	// repository still gets a proper error response
+	started := false
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		return startRows()
 	}
 
-	if err := json.Unmarshal(body, &subnetData); err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_MESSAGE_FORMAT", err.Error(), err)
+	flusher, _ := w.(http.Flusher)
+	err := g.serviceLayer.WalkSubnets(r.Context(), exportPageSize, func(page []*repository.Subnet) error {
+		if err := start(); err != nil {
+			return err
+		}
+		for _, subnet := range page {
+			if err := writeRow(subnet); err != nil {
+				return err
+			}
+		}
+		if err := flushRows(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to export subnets", err)
 		return
 	}
-
-	// Validate required fields
-	if subnetData.CIDR == "" {
-		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "CIDR is required", nil)
-		return
+	if err == nil {
+		// An empty inventory never reached the page callback
+		err = start()
 	}
-	if subnetData.Name == "" {
-		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Name is required", nil)
-		return
+	if err == nil {
+		err = flushRows()
 	}
+	if err == nil {
+		err = closeRows()
+	}
+	if err != nil {
+		// The status line has already been sent, so the truncated body is all
+		// the client gets; log the cause for the operator
+		log.Printf("Error streaming subnet export: %v", err)
+	}
+}
 
-	// Create repository subnet model
-	subnet := &repository.Subnet{
-		ID:           uuid.New().String(),
-		Name:         subnetData.Name,
-		CIDR:         subnetData.CIDR,
-		Location:     subnetData.Location,
-		LocationType: subnetData.LocationType,
-		ParentID:     subnetData.ParentID,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+// handleLookupSubnets handles GET /api/v1/subnets/lookup
+// ?ip= returns the most specific subnet containing the address and its
+// parents; ?cidr= returns every subnet within the block.
+func (g *Gateway) handleLookupSubnets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ip, cidr := query.Get("ip"), query.Get("cidr")
+	if (ip == "") == (cidr == "") {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "exactly one of ip or cidr is required", nil)
+		return
 	}
 
-	// Add cloud info if provided
-	if subnetData.CloudInfo != nil {
-		subnet.CloudInfo = &repository.CloudInfo{
-			Provider:     subnetData.CloudInfo.Provider,
-			Region:       subnetData.CloudInfo.Region,
-			AccountID:    subnetData.CloudInfo.AccountID,
-			ResourceType: subnetData.CloudInfo.ResourceType,
-			VPCId:        subnetData.CloudInfo.VPCId,
-			SubnetId:     subnetData.CloudInfo.SubnetId,
+	ctx := r.Context()
+	if ip != "" {
+		lookup, err := g.serviceLayer.LookupByIP(ctx, ip)
+		if err != nil {
+			g.writeLookupError(w, err)
+			return
+		}
+		parents := make([]*SubnetJSON, 0, len(lookup.Ancestors))
+		for _, parent := range lookup.Ancestors {
+			parents = append(parents, RepositorySubnetToJSON(parent))
 		}
+		g.writeJSON(w, http.StatusOK, &SubnetLookupJSON{
+			IP:      ip,
+			Subnet:  RepositorySubnetToJSON(lookup.Subnet),
+			Parents: parents,
+		})
+		return
 	}
 
-	log.Printf("[CreateSubnetRepository] Repository model: %+v", subnet)
+	subnets, err := g.serviceLayer.FindContainedSubnets(ctx, cidr)
+	if err != nil {
+		g.writeLookupError(w, err)
+		return
+	}
+	result := &ContainedSubnetsJSON{CIDR: cidr, Subnets: make([]*SubnetJSON, 0, len(subnets))}
+	for _, subnet := range subnets {
+		result.Subnets = append(result.Subnets, RepositorySubnetToJSON(subnet))
+	}
+	g.writeJSON(w, http.StatusOK, result)
+}
 
-	// Create subnet using service layer (which will calculate details and create in repository)
-	ctx := r.Context()
-	err = g.serviceLayer.CreateSubnetRepository(ctx, subnet)
+// handleFindBatch handles POST /api/v1/subnets/find-batch
+// Each IP is resolved to its most specific containing subnet, or null.
+func (g *Gateway) handleFindBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("[CreateSubnetRepository] Service layer error: %v", err)
-		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		g.writeReadBodyError(w, err)
 		return
 	}
+	defer r.Body.Close()
 
-	// Retrieve the created subnet with calculated details
-	createdSubnet, err := g.serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+	var req FindBatchRequestJSON
+	if err := g.decodeRequest(body, &req); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+	if len(req.IPs) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "At least one IP is required", nil)
+		return
+	}
+
+	subnets, err := g.serviceLayer.FindSubnetsForIPs(r.Context(), req.IPs)
 	if err != nil {
-		log.Printf("[CreateSubnetRepository] Failed to retrieve created subnet: %v", err)
-		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve created subnet", err)
+		g.writeLookupError(w, err)
 		return
 	}
 
-	log.Printf("[CreateSubnetRepository] Successfully created subnet: %s", subnet.ID)
+	resp := &FindBatchResponseJSON{Results: make([]*FindBatchResultJSON, len(req.IPs))}
+	for i, ip := range req.IPs {
+		result := &FindBatchResultJSON{IP: ip}
+		if subnets[i] != nil {
+			result.Subnet = RepositorySubnetToJSON(subnets[i])
+		}
+		resp.Results[i] = result
+	}
+	g.writeJSON(w, http.StatusOK, resp)
+}
 
-	// Convert to JSON response
-	jsonSubnet := RepositorySubnetToJSON(createdSubnet)
-	g.writeJSON(w, http.StatusCreated, jsonSubnet)
+// writeLookupError maps address lookup errors to 400 for malformed input and
+// 404 when nothing matches
+func (g *Gateway) writeLookupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidIP):
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_IP", err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidCIDR):
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_CIDR", err.Error(), nil)
+	default:
+		g.writeSubnetLookupError(w, err)
+	}
 }
 
-// Connection handlers
+// handleGetSubnetTree handles GET /api/v1/subnets/{id}/tree
+// max_depth limits how many levels of children are nested; omitted means all.
+func (g *Gateway) handleGetSubnetTree(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-// handleCreateConnection handles POST /api/v1/connections
-func (g *Gateway) handleCreateConnection(w http.ResponseWriter, r *http.Request) {
-	log.Println("[CreateConnection] Received request")
+	maxDepth := -1
+	if value := r.URL.Query().Get("max_depth"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "max_depth must be a non-negative integer", nil)
+			return
+		}
+		maxDepth = depth
+	}
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	tree, err := g.serviceLayer.GetSubnetTree(r.Context(), id)
 	if err != nil {
-		log.Printf("[CreateConnection] Failed to read body: %v", err)
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body", err)
+		g.writeSubnetLookupError(w, err)
 		return
 	}
-	defer r.Body.Close()
 
-	log.Printf("[CreateConnection] Request body: %s", string(body))
+	g.writeJSON(w, http.StatusOK, SubnetTreeToJSON(tree, maxDepth))
+}
 
-	// Validate request body is not empty
-	if len(body) == 0 {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+// handleGetSubnetPath handles GET /api/v1/subnets/{id}/path
+func (g *Gateway) handleGetSubnetPath(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	path, err := g.serviceLayer.GetSubnetPath(r.Context(), id)
+	if err != nil {
+		g.writeSubnetLookupError(w, err)
 		return
 	}
 
-	// Parse JSON directly to connection data
-	var connectionData CreateConnectionJSON
-	if err := json.Unmarshal(body, &connectionData); err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_MESSAGE_FORMAT", err.Error(), err)
+	g.writeJSON(w, http.StatusOK, &SubnetPathJSON{SubnetID: id, Path: emptyIfNil(path)})
+}
+
+// handleNextAvailableSubnet handles GET /api/v1/subnets/{id}/next-available
+func (g *Gateway) handleNextAvailableSubnet(w http.ResponseWriter, r *http.Request) {
+	// Extract subnet ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
 		return
 	}
 
-	// Validate required fields
-	if connectionData.SourceSubnetID == "" {
-		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Source subnet ID is required", nil)
+	prefixParam := r.URL.Query().Get("prefix")
+	if prefixParam == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Prefix length is required", nil)
+		return
+	}
+	prefixLen, err := strconv.Atoi(prefixParam)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Prefix length must be an integer", nil)
+		return
+	}
+
+	ctx := r.Context()
+	cidr, err := g.serviceLayer.FindNextAvailableSubnet(ctx, id, prefixLen)
+	var prefixErr *service.PrefixLengthError
+	switch {
+	case errors.As(err, &prefixErr):
+		g.writePrefixLengthError(w, prefixErr)
+		return
+	case errors.Is(err, service.ErrNoSpaceAvailable):
+		g.writeErrorResponse(w, http.StatusConflict, "NO_SPACE_AVAILABLE", err.Error(), nil)
+		return
+	case err != nil:
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &NextAvailableSubnetJSON{
+		ParentID:     id,
+		PrefixLength: prefixLen,
+		CIDR:         cidr,
+	})
+}
+
+// writePrefixLengthError writes a 400 INVALID_PREFIX_LENGTH with the reason and parent CIDR
+func (g *Gateway) writePrefixLengthError(w http.ResponseWriter, err *service.PrefixLengthError) {
+	g.writeProtobufError(w, &pb.Error{
+		Code:      "INVALID_PREFIX_LENGTH",
+		Message:   err.Error(),
+		Details:   map[string]string{"reason": err.Reason, "parent_cidr": err.Parent.String()},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// handleSplitSubnet handles POST /api/v1/subnets/{id}/split
+func (g *Gateway) handleSplitSubnet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var req SplitSubnetJSON
+	if err := g.decodeRequest(body, &req); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+	if req.Prefix == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Prefix length is required", nil)
+		return
+	}
+
+	subnets, err := g.serviceLayer.SplitSubnet(r.Context(), id, req.Prefix)
+	if err != nil {
+		g.writeSplitError(w, err)
+		return
+	}
+
+	g.writeCreated(w, resourcePath("subnets", id, "children"), &SplitSubnetResponseJSON{
+		ParentID:     id,
+		PrefixLength: req.Prefix,
+		Subnets:      RepositorySubnetsToJSON(subnets),
+		Count:        len(subnets),
+	})
+}
+
+// handleSplitPreview handles GET /api/v1/subnets/{id}/split-preview
+// It returns the child CIDRs a split to prefix_length would create, without
+// creating them.
+func (g *Gateway) handleSplitPreview(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	prefixParam := r.URL.Query().Get("prefix_length")
+	if prefixParam == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Prefix length is required", nil)
+		return
+	}
+	prefixLen, err := strconv.Atoi(prefixParam)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Prefix length must be an integer", nil)
+		return
+	}
+
+	cidrs, err := g.serviceLayer.PreviewSplit(r.Context(), id, prefixLen)
+	if err != nil {
+		g.writeSplitError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &SplitPreviewJSON{
+		ParentID:     id,
+		PrefixLength: prefixLen,
+		CIDRs:        emptyIfNil(cidrs),
+		Count:        len(cidrs),
+	})
+}
+
+// handleValidateTiling handles POST /api/v1/subnets/{id}/validate-tiling
+// It reports whether the candidate CIDRs exactly cover the subnet, listing
+// the gaps and overlaps found, without creating them.
+func (g *Gateway) handleValidateTiling(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var req ValidateTilingJSON
+	if err := g.decodeRequest(body, &req); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+	if len(req.CIDRs) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "At least one CIDR is required", nil)
+		return
+	}
+
+	result, err := g.serviceLayer.ValidateTiling(r.Context(), id, req.CIDRs)
+	if err != nil {
+		g.writeLookupError(w, err)
+		return
+	}
+
+	resp := &TilingValidationJSON{
+		ParentID:   id,
+		ParentCIDR: result.ParentCIDR,
+		Valid:      result.Valid,
+		Gaps:       emptyIfNil(result.Gaps),
+		Overlaps:   make([]*TilingOverlapJSON, len(result.Overlaps)),
+		Outside:    emptyIfNil(result.Outside),
+	}
+	for i, overlap := range result.Overlaps {
+		resp.Overlaps[i] = &TilingOverlapJSON{CIDRs: overlap.CIDRs, Overlap: overlap.Overlap}
+	}
+	g.writeJSON(w, http.StatusOK, resp)
+}
+
+// writeSplitError maps SplitSubnet and PreviewSplit errors to HTTP responses
+func (g *Gateway) writeSplitError(w http.ResponseWriter, err error) {
+	var prefixErr *service.PrefixLengthError
+	switch {
+	case errors.As(err, &prefixErr):
+		g.writePrefixLengthError(w, prefixErr)
+	case errors.Is(err, service.ErrNoSpaceAvailable):
+		g.writeErrorResponse(w, http.StatusConflict, "NO_SPACE_AVAILABLE", err.Error(), nil)
+	default:
+		status, detail := createSubnetErrorDetail(err)
+		g.writeJSON(w, status, &ErrorResponse{Error: detail})
+	}
+}
+
+// handleRenumberSubnet handles POST /api/v1/subnets/{id}/renumber
+// It moves the subnet to a new base CIDR of the same prefix length and shifts
+// its descendants by the same offset.
+func (g *Gateway) handleRenumberSubnet(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var req RenumberSubnetJSON
+	if err := g.decodeRequest(body, &req); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+	if req.CIDR == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "CIDR is required", nil)
+		return
+	}
+
+	subnets, err := g.serviceLayer.RenumberSubnet(r.Context(), id, req.CIDR)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRenumber) {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_RENUMBER", err.Error(), nil)
+			return
+		}
+		status, detail := createSubnetErrorDetail(err)
+		g.writeJSON(w, status, &ErrorResponse{Error: detail})
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &RenumberSubnetResponseJSON{
+		Subnets: RepositorySubnetsToJSON(subnets),
+		Count:   len(subnets),
+	})
+}
+
+// handleListSubnetsRepository handles GET /api/v1/subnets using repository models.
+// Pages are selected either by page/page_size or by the cursor returned as
+// next_cursor on the previous page; cursor takes precedence when both are set.
+func (g *Gateway) handleListSubnetsRepository(w http.ResponseWriter, r *http.Request) {
+	// Parse query parameters
+	query := r.URL.Query()
+
+	filters := repository.SubnetFilters{
+		LocationFilter:      query.Get("location"),
+		CloudProviderFilter: query.Get("cloud_provider"),
+		SearchQuery:         query.Get("search"),
+		CIDRPrefix:          query.Get("cidr_prefix"),
+		Environment:         query.Get("environment"),
+		ManagedBy:           query.Get("managed_by"),
+		Page:                parseIntParam(query.Get("page"), 0),
+		PageSize:            parseIntParam(query.Get("page_size"), 50),
+	}
+
+	switch filters.ManagedBy {
+	case "", repository.ManagedByCloud, repository.ManagedByManual:
+	default:
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "managed_by must be cloud or manual", nil)
+		return
+	}
+
+	// Each tag=key:value narrows the results; a subnet must match them all
+	for _, tag := range query["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || key == "" {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("tag %q must have the form key:value", tag), nil)
+			return
+		}
+		if filters.TagFilter == nil {
+			filters.TagFilter = make(map[string]string)
+		}
+		if existing, dup := filters.TagFilter[key]; dup && existing != value {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("tag %q is filtered on more than one value", key), nil)
+			return
+		}
+		filters.TagFilter[key] = value
+	}
+
+	if value := query.Get("is_public"); value != "" {
+		isPublic, err := strconv.ParseBool(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "is_public must be a boolean", err)
+			return
+		}
+		filters.IsPublic = &isPublic
+	}
+
+	// ?prefix=24 keeps only /24 subnets
+	if value := query.Get("prefix"); value != "" {
+		prefixLength, err := strconv.Atoi(strings.TrimPrefix(value, "/"))
+		if err != nil || prefixLength < 0 || prefixLength > 128 {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "prefix must be a prefix length between 0 and 128", err)
+			return
+		}
+		filters.PrefixLength = &prefixLength
+	}
+
+	includeRollup := false
+	if value := query.Get("include_rollup"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "include_rollup must be a boolean", err)
+			return
+		}
+		includeRollup = parsed
+	}
+
+	if filters.CIDRPrefix != "" {
+		if _, err := repository.ParseCIDRPrefix(filters.CIDRPrefix); err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_CIDR", err.Error(), err)
+			return
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := repository.DecodeSubnetCursor(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error(), err)
+			return
+		}
+		filters.After = cursor
+	}
+
+	ctx := r.Context()
+
+	// Use repository directly to get enhanced data
+	result, err := g.serviceLayer.ListSubnetsRepository(ctx, filters)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		return
+	}
+
+	// Convert repository models to JSON
+	jsonSubnets := RepositorySubnetsToJSON(result.Subnets)
+
+	if includeRollup {
+		rollups, err := g.serviceLayer.GetChildRollups(ctx, result.Subnets)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+			return
+		}
+		for _, subnet := range jsonSubnets {
+			subnet.ChildRollup = ChildRollupToJSON(rollups[subnet.ID])
+		}
+	}
+
+	jsonResp := &ListSubnetsResponseJSON{
+		Subnets:    jsonSubnets,
+		TotalCount: result.TotalCount,
+		NextCursor: result.NextCursor,
+	}
+	g.writeJSON(w, http.StatusOK, jsonResp)
+}
+
+// handleSubnetFacets handles GET /api/v1/subnets/facets
+func (g *Gateway) handleSubnetFacets(w http.ResponseWriter, r *http.Request) {
+	environments, err := g.serviceLayer.CountSubnetsByEnvironment(r.Context())
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &SubnetFacetsJSON{Environment: environments})
+}
+
+// handleStatsByPrefixLength handles GET /api/v1/stats/by-prefix-length
+func (g *Gateway) handleStatsByPrefixLength(w http.ResponseWriter, r *http.Request) {
+	counts, err := g.serviceLayer.CountSubnetsByPrefixLength(r.Context())
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		return
+	}
+
+	resp := &PrefixLengthStatsJSON{PrefixLengths: make([]*PrefixLengthCountJSON, len(counts))}
+	for i, count := range counts {
+		resp.PrefixLengths[i] = &PrefixLengthCountJSON{PrefixLength: count.PrefixLength, Count: count.Count}
+		resp.TotalCount += count.Count
+	}
+
+	g.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleStatsEfficiency handles GET /api/v1/stats/efficiency
+func (g *Gateway) handleStatsEfficiency(w http.ResponseWriter, r *http.Request) {
+	stats, err := g.serviceLayer.GetEfficiencyStats(r.Context())
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, EfficiencyStatsToJSON(stats))
+}
+
+// handleCreateSubnetRepository handles POST /api/v1/subnets using repository models
+func (g *Gateway) handleCreateSubnetRepository(w http.ResponseWriter, r *http.Request) {
+	log.Println("[CreateSubnetRepository] Received request")
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[CreateSubnetRepository] Failed to read body: %v", err)
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	log.Printf("[CreateSubnetRepository] Request body: %s", string(body))
+
+	// Validate request body is not empty
+	if len(body) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+		return
+	}
+
+	// Parse JSON directly to repository model
+	var subnetData CreateSubnetRepositoryJSON
+	if err := g.decodeRequest(body, &subnetData); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+
+	// Validate required fields
+	if msg := subnetData.missingField(); msg != "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", msg, nil)
+		return
+	}
+
+	opts, err := parseCreateSubnetOptions(r)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error(), nil)
+		return
+	}
+
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength), nil)
+		return
+	}
+
+	// Create repository subnet model
+	subnet := subnetData.toRepositorySubnet()
+
+	log.Printf("[CreateSubnetRepository] Repository model: %+v", subnet)
+
+	// Create subnet using service layer (which will calculate details and create in repository)
+	ctx := r.Context()
+	previous, replayed, err := g.serviceLayer.CreateSubnetIdempotent(ctx, createSubnetIdempotencyScope, idempotencyKey, subnet, opts)
+	if err != nil {
+		log.Printf("[CreateSubnetRepository] Service layer error: %v", err)
+		status, detail := createSubnetErrorDetail(err)
+		g.writeJSON(w, status, &ErrorResponse{Error: detail})
+		return
+	}
+
+	// A retried request gets the subnet its first attempt created
+	if replayed {
+		log.Printf("[CreateSubnetRepository] Replaying subnet %s for idempotency key %q", previous.ID, idempotencyKey)
+		g.writeJSON(w, http.StatusOK, RepositorySubnetToJSON(previous))
+		return
+	}
+
+	// Retrieve the created subnet with calculated details
+	createdSubnet, err := g.serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+	if err != nil {
+		log.Printf("[CreateSubnetRepository] Failed to retrieve created subnet: %v", err)
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve created subnet", err)
+		return
+	}
+
+	log.Printf("[CreateSubnetRepository] Successfully created subnet: %s", subnet.ID)
+
+	// Convert to JSON response
+	jsonSubnet := RepositorySubnetToJSON(createdSubnet)
+	g.writeCreated(w, resourcePath("subnets", createdSubnet.ID), jsonSubnet)
+}
+
+// idempotencyKeyHeader lets clients retry a create without creating twice
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the idempotency keys stored per request
+const maxIdempotencyKeyLength = 255
+
+// createSubnetIdempotencyScope scopes idempotency keys of subnet creates, so
+// the same key sent to another endpoint does not replay a subnet
+const createSubnetIdempotencyScope = "POST /api/v1/subnets"
+
+// parseCreateSubnetOptions reads the create options from the query string;
+// ?skip_details=true stores the provided details instead of calculating them
+// and ?ttl=<duration> makes the subnets expire that long after creation
+func parseCreateSubnetOptions(r *http.Request) (service.CreateSubnetOptions, error) {
+	var opts service.CreateSubnetOptions
+	query := r.URL.Query()
+	if value := query.Get("skip_details"); value != "" {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("skip_details must be true or false")
+		}
+		opts.SkipDetails = skip
+	}
+	if value := query.Get("ttl"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return opts, fmt.Errorf("ttl must be a positive duration such as 30m or 24h")
+		}
+		opts.TTL = ttl
+	}
+	return opts, nil
+}
+
+// createSubnetErrorDetail maps a subnet create error to its HTTP status and error body
+func createSubnetErrorDetail(err error) (int, *ErrorDetail) {
+	detail := &ErrorDetail{Message: err.Error(), Timestamp: time.Now().Unix()}
+
+	var overlapErr *service.OverlapError
+	var siblingErr *service.SiblingOverlapError
+	var limitErr *service.LimitError
+	switch {
+	case errors.As(err, &siblingErr):
+		detail.Code = "SIBLING_OVERLAP"
+		detail.Details = map[string]string{
+			"parent_id":  siblingErr.ParentID,
+			"subnet_ids": strings.Join(siblingErr.SubnetIDs, ","),
+		}
+		return http.StatusConflict, detail
+	case errors.As(err, &overlapErr):
+		detail.Code = "OVERLAPPING_CIDR"
+		detail.Details = map[string]string{"subnet_ids": strings.Join(overlapErr.SubnetIDs, ",")}
+		return http.StatusConflict, detail
+	case errors.As(err, &limitErr):
+		detail.Code = "LIMIT_EXCEEDED"
+		detail.Details = map[string]string{
+			"field": limitErr.Field,
+			"count": strconv.Itoa(limitErr.Count),
+			"max":   strconv.Itoa(limitErr.Max),
+		}
+		return http.StatusBadRequest, detail
+	case errors.Is(err, service.ErrInvalidEnvironment):
+		detail.Code = "INVALID_ENVIRONMENT"
+		return http.StatusBadRequest, detail
+	case errors.Is(err, service.ErrInvalidDHCPRange):
+		detail.Code = "INVALID_DHCP_RANGE"
+		return http.StatusBadRequest, detail
+	case errors.Is(err, service.ErrChildNotContained):
+		detail.Code = "CHILD_NOT_CONTAINED"
+		return http.StatusBadRequest, detail
+	case errors.Is(err, service.ErrBatchRolledBack):
+		detail.Code = "BATCH_ROLLED_BACK"
+		return http.StatusConflict, detail
+	case strings.Contains(err.Error(), "invalid CIDR notation"):
+		detail.Code = "INVALID_CIDR"
+		return http.StatusBadRequest, detail
+	case errors.Is(err, repository.ErrNotFound):
+		detail.Code = "SUBNET_NOT_FOUND"
+		return http.StatusNotFound, detail
+	case errors.Is(err, repository.ErrDuplicate):
+		detail.Code = "DUPLICATE_SUBNET"
+		return http.StatusConflict, detail
+	case errors.Is(err, repository.ErrConflict):
+		detail.Code = "CONFLICT"
+		return http.StatusConflict, detail
+	default:
+		detail.Code = "INTERNAL_ERROR"
+		return http.StatusInternalServerError, detail
+	}
+}
+
+// handleBulkCreateSubnets handles POST /api/v1/subnets/bulk
+func (g *Gateway) handleBulkCreateSubnets(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var items []CreateSubnetRepositoryJSON
+	if err := g.decodeRequest(body, &items); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+
+	opts, err := parseCreateSubnetOptions(r)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error(), nil)
+		return
+	}
+	if len(items) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "At least one subnet is required", nil)
+		return
+	}
+
+	// Missing fields are reported per item without reaching the service layer
+	response := &BulkCreateSubnetsResponseJSON{Results: make([]*BulkCreateSubnetResultJSON, len(items))}
+	subnets := make([]*repository.Subnet, len(items))
+	invalid := false
+	for i, item := range items {
+		response.Results[i] = &BulkCreateSubnetResultJSON{Index: i, CIDR: item.CIDR}
+		if msg := item.missingField(); msg != "" {
+			response.Results[i].Error = &ErrorDetail{Code: "MISSING_FIELD", Message: msg, Timestamp: time.Now().Unix()}
+			invalid = true
+			continue
+		}
+		subnets[i] = item.toRepositorySubnet()
+	}
+	if invalid {
+		for _, result := range response.Results {
+			if result.Error == nil {
+				_, result.Error = createSubnetErrorDetail(service.ErrBatchRolledBack)
+			}
+		}
+		g.writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	results, err := g.serviceLayer.BulkCreateSubnetsWithOptions(r.Context(), subnets, opts)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create subnets", err)
+		return
+	}
+
+	// The batch status is that of the first item that failed on its own account
+	status := http.StatusCreated
+	for i, result := range results {
+		if result.Err == nil {
+			response.Results[i].Success = true
+			response.Results[i].ID = result.Subnet.ID
+			continue
+		}
+		itemStatus, detail := createSubnetErrorDetail(result.Err)
+		response.Results[i].Error = detail
+		if status == http.StatusCreated && !errors.Is(result.Err, service.ErrBatchRolledBack) {
+			status = itemStatus
+		}
+	}
+
+	response.Success = status == http.StatusCreated
+	if response.Success {
+		response.Created = int32(len(results))
+		g.writeCreated(w, resourcePath("subnets"), response)
+		return
+	}
+	g.writeJSON(w, status, response)
+}
+
+// handleBulkUpdateUtilization handles POST /api/v1/subnets/utilization
+func (g *Gateway) handleBulkUpdateUtilization(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var items []UtilizationReportJSON
+	if err := g.decodeRequest(body, &items); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+	if len(items) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "At least one utilization report is required", nil)
+		return
+	}
+
+	reports := make([]*service.UtilizationReport, len(items))
+	for i, item := range items {
+		if item.SubnetID == "" {
+			g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", fmt.Sprintf("Item %d: subnet_id is required", i), nil)
+			return
+		}
+		if item.AllocatedIPs == nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", fmt.Sprintf("Item %d: allocated_ips is required", i), nil)
+			return
+		}
+		reports[i] = &service.UtilizationReport{SubnetID: item.SubnetID, AllocatedIPs: *item.AllocatedIPs}
+	}
+
+	if err := g.serviceLayer.BulkUpdateUtilization(r.Context(), reports); err != nil {
+		var bulkErr *repository.BulkUpdateError
+		if !errors.As(err, &bulkErr) {
+			g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update utilization", err)
+			return
+		}
+
+		var status int
+		detail := &ErrorDetail{Message: bulkErr.Err.Error(), Timestamp: time.Now().Unix()}
+		switch {
+		case errors.Is(err, service.ErrInvalidUtilization):
+			status, detail.Code = http.StatusBadRequest, "INVALID_UTILIZATION"
+		case errors.Is(err, repository.ErrNotFound):
+			status, detail.Code = http.StatusNotFound, "SUBNET_NOT_FOUND"
+		default:
+			log.Printf("Error: Failed to update utilization - %v", err)
+			status, detail.Code = http.StatusInternalServerError, "INTERNAL_ERROR"
+		}
+		detail.Details = map[string]string{
+			"index":     strconv.Itoa(bulkErr.Index),
+			"subnet_id": bulkErr.SubnetID,
+		}
+		g.writeJSON(w, status, &ErrorResponse{Error: detail})
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &BulkUpdateUtilizationResponseJSON{Success: true, Updated: int32(len(reports))})
+}
+
+// handleUtilizationHistory handles GET /api/v1/subnets/{id}/utilization/history.
+// The optional from and to parameters bound the series as RFC 3339 times or
+// Unix seconds; from is inclusive and to exclusive.
+func (g *Gateway) handleUtilizationHistory(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var bounds [2]time.Time
+	for i, name := range []string{"from", "to"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		at, err := parseTimeParam(value)
+		if err != nil {
+			g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("Invalid %s: %v", name, err), nil)
+			return
+		}
+		bounds[i] = at
+	}
+	from, to := bounds[0], bounds[1]
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "from must be before to", nil)
+		return
+	}
+
+	samples, err := g.serviceLayer.ListUtilizationHistory(r.Context(), id, from, to)
+	if err != nil {
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &UtilizationHistoryResponseJSON{
+		SubnetID: id,
+		Samples:  RepositoryUtilizationSamplesToJSON(samples),
+	})
+}
+
+// parseTimeParam parses a query parameter given as RFC 3339 or Unix seconds
+func parseTimeParam(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 time or Unix seconds, got %q", value)
+	}
+	return at, nil
+}
+
+// Note handlers
+
+// noteAuthorHeader carries the authenticated user set by the fronting auth proxy
+const noteAuthorHeader = "X-Forwarded-User"
+
+// handleCreateSubnetNote handles POST /api/v1/subnets/{id}/notes
+func (g *Gateway) handleCreateSubnetNote(w http.ResponseWriter, r *http.Request) {
+	// Extract subnet ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(body) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+		return
+	}
+
+	var noteData CreateNoteJSON
+	if err := g.decodeRequest(body, &noteData); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+
+	if strings.TrimSpace(noteData.Text) == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Note text is required", nil)
+		return
+	}
+
+	// Author comes from the auth proxy; unauthenticated requests are recorded as anonymous
+	author := r.Header.Get(noteAuthorHeader)
+	if author == "" {
+		author = "anonymous"
+	}
+
+	ctx := r.Context()
+	note, err := g.serviceLayer.AddSubnetNote(ctx, id, author, noteData.Text)
+	if err != nil {
+		log.Printf("[CreateSubnetNote] Service layer error: %v", err)
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeCreated(w, resourcePath("subnets", id, "notes", note.ID), RepositoryNoteToJSON(note))
+}
+
+// handleListSubnetNotes handles GET /api/v1/subnets/{id}/notes
+func (g *Gateway) handleListSubnetNotes(w http.ResponseWriter, r *http.Request) {
+	// Extract subnet ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	notes, err := g.serviceLayer.ListSubnetNotes(ctx, id)
+	if err != nil {
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &ListNotesResponseJSON{
+		Notes:      RepositoryNotesToJSON(notes),
+		TotalCount: int32(len(notes)),
+	})
+}
+
+// handleGetSubnetNote handles GET /api/v1/subnets/{id}/notes/{noteId}
+func (g *Gateway) handleGetSubnetNote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	noteID := vars["noteId"]
+
+	if id == "" || noteID == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID and note ID are required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	note, err := g.serviceLayer.GetSubnetNote(ctx, id, noteID)
+	if err != nil {
+		if strings.Contains(err.Error(), "note not found") {
+			g.writeErrorResponse(w, http.StatusNotFound, "NOTE_NOT_FOUND", err.Error(), nil)
+			return
+		}
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, RepositoryNoteToJSON(note))
+}
+
+// IP allocation handlers
+
+// handleCreateAllocation handles POST /api/v1/subnets/{id}/allocations
+func (g *Gateway) handleCreateAllocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	// An empty body allocates the next free address without a description
+	var allocationData CreateAllocationJSON
+	if len(body) > 0 {
+		if err := g.decodeRequest(body, &allocationData); err != nil {
+			g.writeDecodeError(w, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	var allocation *repository.IPAllocation
+	if allocationData.IP != "" {
+		allocation, err = g.serviceLayer.AllocateIP(ctx, id, allocationData.IP, allocationData.Hostname, allocationData.Description)
+	} else {
+		allocation, err = g.serviceLayer.AllocateNextIP(ctx, id, allocationData.Hostname, allocationData.Description)
+	}
+	if err != nil {
+		log.Printf("[CreateAllocation] Service layer error: %v", err)
+		g.writeAllocationError(w, err)
+		return
+	}
+
+	g.writeCreated(w, resourcePath("subnets", id, "allocations", allocation.IP), RepositoryAllocationToJSON(allocation))
+}
+
+// handleListAllocations handles GET /api/v1/subnets/{id}/allocations
+func (g *Gateway) handleListAllocations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	allocations, err := g.serviceLayer.ListAllocations(ctx, id)
+	if err != nil {
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &ListAllocationsResponseJSON{
+		Allocations: RepositoryAllocationsToJSON(allocations),
+		TotalCount:  int32(len(allocations)),
+	})
+}
+
+// handleListAllIPAllocations handles GET /api/v1/ips
+func (g *Gateway) handleListAllIPAllocations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filters := repository.IPAllocationFilters{
+		SubnetID:    query.Get("subnet_id"),
+		Hostname:    query.Get("hostname"),
+		SearchQuery: query.Get("search"),
+		Page:        parseIntParam(query.Get("page"), 0),
+		PageSize:    parseIntParam(query.Get("page_size"), 50),
+	}
+
+	result, err := g.serviceLayer.ListAllIPAllocations(r.Context(), filters)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &ListAllocationsResponseJSON{
+		Allocations: RepositoryAllocationsToJSON(result.Allocations),
+		TotalCount:  result.TotalCount,
+	})
+}
+
+// handleGetAllocation handles GET /api/v1/subnets/{id}/allocations/{ip}
+func (g *Gateway) handleGetAllocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	ip := vars["ip"]
+
+	if id == "" || ip == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID and IP are required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	allocation, err := g.serviceLayer.GetAllocation(ctx, id, ip)
+	if err != nil {
+		g.writeAllocationError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, RepositoryAllocationToJSON(allocation))
+}
+
+// handleReleaseAllocation handles DELETE /api/v1/subnets/{id}/allocations/{ip}
+func (g *Gateway) handleReleaseAllocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	ip := vars["ip"]
+
+	if id == "" || ip == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID and IP are required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	if err := g.serviceLayer.ReleaseIP(ctx, id, ip); err != nil {
+		g.writeAllocationError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &DeleteResponseJSON{Success: true})
+}
+
+// Reserved range handlers
+
+// handleCreateReservation handles POST /api/v1/subnets/{id}/reservations
+func (g *Gateway) handleCreateReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(body) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+		return
+	}
+
+	var reservationData CreateReservationJSON
+	if err := g.decodeRequest(body, &reservationData); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+
+	if reservationData.StartIP == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "start_ip is required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	reservation, err := g.serviceLayer.ReserveRange(ctx, id, reservationData.StartIP, reservationData.EndIP, reservationData.Reason)
+	if err != nil {
+		log.Printf("[CreateReservation] Service layer error: %v", err)
+		g.writeAllocationError(w, err)
+		return
+	}
+
+	g.writeCreated(w, resourcePath("subnets", id, "reservations", reservation.ID), RepositoryReservationToJSON(reservation))
+}
+
+// handleListReservations handles GET /api/v1/subnets/{id}/reservations
+func (g *Gateway) handleListReservations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID is required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	reservations, err := g.serviceLayer.ListReservations(ctx, id)
+	if err != nil {
+		g.writeSubnetLookupError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &ListReservationsResponseJSON{
+		Reservations: RepositoryReservationsToJSON(reservations),
+		TotalCount:   int32(len(reservations)),
+	})
+}
+
+// handleGetReservation handles GET /api/v1/subnets/{id}/reservations/{reservationId}
+func (g *Gateway) handleGetReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	reservationID := vars["reservationId"]
+
+	if id == "" || reservationID == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID and reservation ID are required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	reservation, err := g.serviceLayer.GetReservation(ctx, id, reservationID)
+	if err != nil {
+		g.writeAllocationError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, RepositoryReservationToJSON(reservation))
+}
+
+// handleDeleteReservation handles DELETE /api/v1/subnets/{id}/reservations/{reservationId}
+func (g *Gateway) handleDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	reservationID := vars["reservationId"]
+
+	if id == "" || reservationID == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Subnet ID and reservation ID are required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	if err := g.serviceLayer.DeleteReservation(ctx, id, reservationID); err != nil {
+		g.writeAllocationError(w, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &DeleteResponseJSON{Success: true})
+}
+
+// writeAllocationError maps IP allocation service errors to HTTP responses
+func (g *Gateway) writeAllocationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidIP):
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_IP", err.Error(), nil)
+	case errors.Is(err, service.ErrIPOutOfRange):
+		g.writeErrorResponse(w, http.StatusBadRequest, "IP_OUT_OF_RANGE", err.Error(), nil)
+	case errors.Is(err, service.ErrIPAlreadyAllocated), errors.Is(err, repository.ErrDuplicate):
+		g.writeErrorResponse(w, http.StatusConflict, "IP_ALREADY_ALLOCATED", err.Error(), nil)
+	case errors.Is(err, service.ErrIPReserved):
+		g.writeErrorResponse(w, http.StatusConflict, "IP_RESERVED", err.Error(), nil)
+	case errors.Is(err, service.ErrNoSpaceAvailable):
+		g.writeErrorResponse(w, http.StatusConflict, "NO_SPACE_AVAILABLE", err.Error(), nil)
+	case strings.Contains(err.Error(), "allocation not found"):
+		g.writeErrorResponse(w, http.StatusNotFound, "ALLOCATION_NOT_FOUND", err.Error(), nil)
+	case errors.Is(err, service.ErrReservationNotFound):
+		g.writeErrorResponse(w, http.StatusNotFound, "RESERVATION_NOT_FOUND", err.Error(), nil)
+	default:
+		g.writeSubnetLookupError(w, err)
+	}
+}
+
+// writeSubnetLookupError maps a repository subnet lookup error to a 404 or 500 response
+func (g *Gateway) writeSubnetLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		g.writeErrorResponse(w, http.StatusNotFound, "SUBNET_NOT_FOUND", err.Error(), nil)
+		return
+	}
+	g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+}
+
+// writeConnectionError maps connection service errors to HTTP responses
+func (g *Gateway) writeConnectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSameSubnet):
+		g.writeErrorResponse(w, http.StatusBadRequest, "SAME_SUBNET", err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidConnectionMetadata):
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_METADATA", err.Error(), nil)
+	case errors.Is(err, service.ErrDuplicateConnection):
+		g.writeErrorResponse(w, http.StatusConflict, "DUPLICATE_CONNECTION", err.Error(), nil)
+	case strings.Contains(err.Error(), "connection not found"):
+		g.writeErrorResponse(w, http.StatusNotFound, "CONNECTION_NOT_FOUND", err.Error(), nil)
+	default:
+		g.writeSubnetLookupError(w, err)
+	}
+}
+
+// CIDR tool handlers
+
+// handleSubtractCIDR handles POST /api/v1/cidr/subtract
+func (g *Gateway) handleSubtractCIDR(w http.ResponseWriter, r *http.Request) {
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(body) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+		return
+	}
+
+	var req SubtractCIDRJSON
+	if err := g.decodeRequest(body, &req); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+
+	if req.From == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "From CIDR is required", nil)
+		return
+	}
+
+	remaining, err := g.serviceLayer.SubtractCIDRs(req.From, req.Subtract)
+	if err != nil {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_CIDR", err.Error(), nil)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, &SubtractCIDRResponseJSON{
+		From:      req.From,
+		Subtract:  emptyIfNil(req.Subtract),
+		Remaining: emptyIfNil(remaining),
+	})
+}
+
+// handleCalculate handles POST /api/v1/calculate
+// Details are computed for each CIDR without storing anything; an invalid
+// CIDR gets an error in its result instead of failing the whole request.
+func (g *Gateway) handleCalculate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var req CalculateRequestJSON
+	if err := g.decodeRequest(body, &req); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+	if len(req.CIDRs) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "At least one CIDR is required", nil)
+		return
+	}
+
+	resp := &CalculateResponseJSON{Results: make([]*CalculateResultJSON, len(req.CIDRs))}
+	for i, cidr := range req.CIDRs {
+		result := &CalculateResultJSON{CIDR: cidr}
+		if details, err := g.serviceLayer.CalculateSubnetDetails(cidr); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Details = SubnetDetailsToJSON(details)
+		}
+		resp.Results[i] = result
+	}
+	g.writeJSON(w, http.StatusOK, resp)
+}
+
+// Connection handlers
+
+// handleCreateConnection handles POST /api/v1/connections
+func (g *Gateway) handleCreateConnection(w http.ResponseWriter, r *http.Request) {
+	log.Println("[CreateConnection] Received request")
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[CreateConnection] Failed to read body: %v", err)
+		g.writeReadBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	log.Printf("[CreateConnection] Request body: %s", string(body))
+
+	// Validate request body is not empty
+	if len(body) == 0 {
+		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Request body is required", nil)
+		return
+	}
+
+	// Parse JSON directly to connection data
+	var connectionData CreateConnectionJSON
+	if err := g.decodeRequest(body, &connectionData); err != nil {
+		g.writeDecodeError(w, err)
+		return
+	}
+
+	// Validate required fields
+	if connectionData.SourceSubnetID == "" {
+		g.writeErrorResponse(w, http.StatusBadRequest, "MISSING_FIELD", "Source subnet ID is required", nil)
 		return
 	}
 	if connectionData.TargetSubnetID == "" {
@@ -577,7 +2319,7 @@ func (g *Gateway) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 		SourceSubnetID: connectionData.SourceSubnetID,
 		TargetSubnetID: connectionData.TargetSubnetID,
 		ConnectionType: connectionData.ConnectionType,
-		Status:         "active", // Default status
+		Status:         connectionData.Status, // Service defaults to active
 		Name:           connectionData.Name,
 		Description:    connectionData.Description,
 		Bandwidth:      connectionData.Bandwidth,
@@ -593,7 +2335,7 @@ func (g *Gateway) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 	err = g.serviceLayer.CreateConnection(ctx, connection)
 	if err != nil {
 		log.Printf("[CreateConnection] Service layer error: %v", err)
-		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		g.writeConnectionError(w, err)
 		return
 	}
 
@@ -601,7 +2343,7 @@ func (g *Gateway) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 
 	// Convert to JSON response
 	jsonConnection := RepositoryConnectionToJSON(connection)
-	g.writeJSON(w, http.StatusCreated, jsonConnection)
+	g.writeCreated(w, resourcePath("connections", connection.ID), jsonConnection)
 }
 
 // handleListConnections handles GET /api/v1/connections
@@ -651,7 +2393,7 @@ func (g *Gateway) handleGetConnection(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	connection, err := g.serviceLayer.GetConnection(ctx, id)
 	if err != nil {
-		g.writeErrorResponse(w, http.StatusNotFound, "CONNECTION_NOT_FOUND", err.Error(), err)
+		g.writeConnectionError(w, err)
 		return
 	}
 
@@ -674,7 +2416,7 @@ func (g *Gateway) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body", err)
+		g.writeReadBodyError(w, err)
 		return
 	}
 	defer r.Body.Close()
@@ -687,8 +2429,8 @@ func (g *Gateway) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 
 	// Parse JSON to update data
 	var updateData UpdateConnectionJSON
-	if err := json.Unmarshal(body, &updateData); err != nil {
-		g.writeErrorResponse(w, http.StatusBadRequest, "INVALID_MESSAGE_FORMAT", err.Error(), err)
+	if err := g.decodeRequest(body, &updateData); err != nil {
+		g.writeDecodeError(w, err)
 		return
 	}
 
@@ -707,7 +2449,7 @@ func (g *Gateway) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	err = g.serviceLayer.UpdateConnection(ctx, id, connection)
 	if err != nil {
-		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		g.writeConnectionError(w, err)
 		return
 	}
 
@@ -737,7 +2479,7 @@ func (g *Gateway) handleDeleteConnection(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	err := g.serviceLayer.DeleteConnection(ctx, id)
 	if err != nil {
-		g.writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error(), err)
+		g.writeConnectionError(w, err)
 		return
 	}
 
@@ -0,0 +1,2588 @@
+package gateway
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/cloudprovider"
+	"github.com/bananaops/ipam-bananaops/internal/config"
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"github.com/bananaops/ipam-bananaops/internal/service"
+)
+
+// newTestServiceLayer creates a service layer backed by a temporary SQLite database
+func newTestServiceLayer(t *testing.T) *service.ServiceLayer {
+	t.Helper()
+
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return service.NewServiceLayer(repo, service.NewGoIPAMService(), nil)
+}
+
+// doRequest sends a request through handler and returns the recorded response
+func doRequest(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// assertCreated checks the 201 status and Location header, decodes the body into
+// out, and verifies that the Location resolves to the created resource
+func assertCreated(t *testing.T, handler http.Handler, rec *httptest.ResponseRecorder, wantLocation string, out interface{}) {
+	t.Helper()
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Location"); got != wantLocation {
+		t.Errorf("Expected Location %s, got %q", wantLocation, got)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+
+	if get := doRequest(handler, http.MethodGet, wantLocation, ""); get.Code != http.StatusOK {
+		t.Errorf("Expected GET %s to return 200, got %d", wantLocation, get.Code)
+	}
+}
+
+func TestCreateEndpointsReturnLocation(t *testing.T) {
+	serviceLayer := newTestServiceLayer(t)
+	handler := NewGateway(serviceLayer, nil).Handler()
+
+	var sourceID string
+	t.Run("subnet", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+			`{"cidr": "10.0.0.0/24", "name": "Source", "location": "datacenter-1", "location_type": "DATACENTER"}`)
+
+		sourceID = extractID(t, rec)
+
+		var subnet SubnetJSON
+		assertCreated(t, handler, rec, "/api/v1/subnets/"+sourceID, &subnet)
+		if subnet.CIDR != "10.0.0.0/24" || subnet.Name != "Source" {
+			t.Errorf("Unexpected subnet body: %+v", subnet)
+		}
+		if subnet.Details == nil || subnet.Details.HostsPerNet != 254 {
+			t.Errorf("Expected calculated details in body, got %+v", subnet.Details)
+		}
+	})
+
+	if sourceID == "" {
+		t.Fatal("Subnet creation failed, skipping dependent endpoints")
+	}
+
+	t.Run("note", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+sourceID+"/notes", `{"text": "Reserved for VPN"}`)
+
+		var note NoteJSON
+		assertCreated(t, handler, rec, "/api/v1/subnets/"+sourceID+"/notes/"+extractID(t, rec), &note)
+		if note.Text != "Reserved for VPN" || note.SubnetID != sourceID {
+			t.Errorf("Unexpected note body: %+v", note)
+		}
+	})
+
+	t.Run("allocation", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+sourceID+"/allocations", `{"description": "Gateway"}`)
+
+		var allocation AllocationJSON
+		assertCreated(t, handler, rec, "/api/v1/subnets/"+sourceID+"/allocations/10.0.0.1", &allocation)
+		if allocation.IP != "10.0.0.1" || allocation.Description != "Gateway" {
+			t.Errorf("Unexpected allocation body: %+v", allocation)
+		}
+	})
+
+	t.Run("connection", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/connections",
+			`{"source_subnet_id": "`+sourceID+`", "target_subnet_id": "internet", "connection_type": "nat_gateway", "name": "Egress"}`)
+
+		var connection ConnectionJSON
+		assertCreated(t, handler, rec, "/api/v1/connections/"+extractID(t, rec), &connection)
+		if connection.SourceSubnetID != sourceID || connection.Status != "active" {
+			t.Errorf("Unexpected connection body: %+v", connection)
+		}
+	})
+}
+
+func TestRESTGatewayCreateReturnsLocation(t *testing.T) {
+	handler := NewRESTGateway(newTestServiceLayer(t)).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "192.168.0.0/24", "name": "Legacy", "location": "datacenter-1", "location_type": "DATACENTER"}`)
+
+	var subnet SubnetJSON
+	assertCreated(t, handler, rec, "/api/v1/subnets/"+extractID(t, rec), &subnet)
+	if subnet.CIDR != "192.168.0.0/24" {
+		t.Errorf("Unexpected subnet body: %+v", subnet)
+	}
+}
+
+func TestGatewaysShareErrorStatuses(t *testing.T) {
+	serviceLayer := newTestServiceLayer(t)
+	handlers := map[string]http.Handler{
+		"v2":     NewGateway(serviceLayer, nil).Handler(),
+		"legacy": NewRESTGateway(serviceLayer).Handler(),
+	}
+
+	parentID := extractID(t, doRequest(handlers["v2"], http.MethodPost, "/api/v1/subnets", `{"cidr": "10.71.0.0/16", "name": "Parent"}`))
+	doRequest(handlers["v2"], http.MethodPost, "/api/v1/subnets", `{"cidr": "10.71.200.0/24", "name": "Child", "parent_id": "`+parentID+`"}`)
+
+	tests := []struct {
+		body string
+		want int
+		code string
+	}{
+		{body: `{"cidr": "10.71.0.0/17"}`, want: http.StatusConflict, code: "CHILDREN_OUT_OF_RANGE"},
+		{body: `{"environment": "nowhere"}`, want: http.StatusBadRequest, code: "INVALID_ENVIRONMENT"},
+	}
+	for name, handler := range handlers {
+		for _, tt := range tests {
+			rec := doRequest(handler, http.MethodPut, "/api/v1/subnets/"+parentID, tt.body)
+			if rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.code) {
+				t.Errorf("%s PUT %s: expected %d %s, got %d: %s", name, tt.body, tt.want, tt.code, rec.Code, rec.Body.String())
+			}
+		}
+	}
+}
+
+// extractID reads the id field from a JSON response body
+func extractID(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.ID == "" {
+		t.Fatalf("Expected an id in the response body, got %s", rec.Body.String())
+	}
+	return body.ID
+}
+
+func TestCORSPreflightAllowsRequestHeaders(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodOptions, "/api/v1/subnets", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	allowed := rec.Header().Get("Access-Control-Allow-Headers")
+	for _, header := range []string{"Content-Type", "If-Match", "Idempotency-Key"} {
+		if !strings.Contains(allowed, header) {
+			t.Errorf("Expected %s in Access-Control-Allow-Headers, got %q", header, allowed)
+		}
+	}
+	exposed := rec.Header().Get("Access-Control-Expose-Headers")
+	for _, header := range []string{"ETag", "Location"} {
+		if !strings.Contains(exposed, header) {
+			t.Errorf("Expected %s in Access-Control-Expose-Headers, got %q", header, exposed)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.1.0.0/24", "name": "Metrics", "location": "datacenter-1", "location_type": "DATACENTER"}`)
+	doRequest(handler, http.MethodGet, "/api/v1/subnets/"+extractID(t, rec), "")
+	doRequest(handler, http.MethodGet, "/api/v1/subnets/missing", "")
+
+	metrics := doRequest(handler, http.MethodGet, "/metrics", "")
+	if metrics.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", metrics.Code)
+	}
+
+	body := metrics.Body.String()
+	for _, line := range []string{
+		`ipam_subnets 1`,
+		`ipam_subnets_by_location_type{location_type="DATACENTER"} 1`,
+		`ipam_http_requests_total{code="201",handler="/api/v1/subnets"} 1`,
+		`ipam_http_requests_total{code="200",handler="/api/v1/subnets/{id}"} 1`,
+		`ipam_http_requests_total{code="404",handler="/api/v1/subnets/{id}"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestListSubnetsIncludeRollup(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	create := func(cidr, name, parentID string) string {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+			`{"cidr": "`+cidr+`", "name": "`+name+`", "parent_id": "`+parentID+`", "location": "datacenter-1", "location_type": "DATACENTER"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Failed to create %s: %d %s", cidr, rec.Code, rec.Body.String())
+		}
+		return extractID(t, rec)
+	}
+
+	parentID := create("10.2.0.0/16", "Parent", "")
+	childID := create("10.2.0.0/24", "Child A", parentID)
+	create("10.2.1.0/24", "Child B", parentID)
+	create("10.2.0.0/28", "Grandchild", childID)
+
+	for i := 0; i < 4; i++ {
+		if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+childID+"/allocations", `{}`); rec.Code != http.StatusCreated {
+			t.Fatalf("Failed to allocate IP: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	list := func(query string) map[string]*SubnetJSON {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		byID := make(map[string]*SubnetJSON)
+		for _, subnet := range resp.Subnets {
+			byID[subnet.ID] = subnet
+		}
+		return byID
+	}
+
+	if subnet := list("")[parentID]; subnet.ChildRollup != nil {
+		t.Errorf("Expected no rollup without include_rollup, got %+v", subnet.ChildRollup)
+	}
+
+	subnets := list("?include_rollup=true")
+
+	// Direct children only: the grandchild counts towards Child A, not Parent
+	parent := subnets[parentID].ChildRollup
+	if parent == nil || parent.ChildCount != 2 || parent.TotalIPs != 508 || parent.AllocatedIPs != 4 {
+		t.Errorf("Unexpected parent rollup: %+v", parent)
+	}
+	child := subnets[childID].ChildRollup
+	if child == nil || child.ChildCount != 1 || child.TotalIPs != 14 || child.AllocatedIPs != 0 {
+		t.Errorf("Unexpected child rollup: %+v", child)
+	}
+	for id, subnet := range subnets {
+		if subnet.ChildRollup == nil {
+			t.Errorf("Expected a rollup block for subnet %s", id)
+		}
+	}
+
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?include_rollup=maybe", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid include_rollup, got %d", rec.Code)
+	}
+}
+
+func TestCreateSubnetTagLimit(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	serviceLayer := service.NewServiceLayerWithOptions(repo, service.NewGoIPAMService(), nil, service.ServiceOptions{MaxTagsPerSubnet: 1})
+	handler := NewGateway(serviceLayer, nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.3.0.0/24", "name": "Tagged", "tags": {"env": "prod", "team": "netops"}}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if resp.Error.Code != "LIMIT_EXCEEDED" || resp.Error.Details["field"] != "tags" || resp.Error.Details["max"] != "1" {
+		t.Errorf("Unexpected error body: %+v", resp.Error)
+	}
+}
+
+func TestCreateSubnetChildNotContained(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "192.168.0.0/16", "name": "Parent"}`)
+	parentID := extractID(t, rec)
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.5.0.0/24", "name": "Stray", "parent_id": "`+parentID+`"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "CHILD_NOT_CONTAINED") {
+		t.Errorf("Expected 400 CHILD_NOT_CONTAINED, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.5.0.0/24", "name": "Orphan", "parent_id": "missing"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown parent, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateSubnetSiblingOverlap(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.0.0.0/16", "name": "Parent", "location": "eu-west"}`))
+	childID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.0.0.0/25", "name": "First", "location": "eu-west", "parent_id": "`+parentID+`"}`))
+
+	// Siblings conflict across locations, which the location overlap check does not cover
+	for _, location := range []string{"eu-west", "us-east"} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+			`{"cidr": "10.0.0.0/26", "name": "Nested", "location": "`+location+`", "parent_id": "`+parentID+`"}`)
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "SIBLING_OVERLAP") || !strings.Contains(rec.Body.String(), childID) {
+			t.Errorf("Expected 409 SIBLING_OVERLAP naming %s in %s, got %d: %s", childID, location, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.0.0.128/25", "name": "Second", "location": "us-east", "parent_id": "`+parentID+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected a non-overlapping sibling to be created, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/bulk", `[
+		{"cidr": "10.0.1.0/24", "name": "Third", "location": "eu-west", "parent_id": "`+parentID+`"},
+		{"cidr": "10.0.1.0/25", "name": "Fourth", "location": "us-east", "parent_id": "`+parentID+`"}
+	]`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "SIBLING_OVERLAP") {
+		t.Errorf("Expected 409 SIBLING_OVERLAP for overlapping siblings in one batch, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSubnetEnvironmentEndpoints(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.4.0.0/24", "name": "Bad", "environment": "qa"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_ENVIRONMENT") {
+		t.Fatalf("Expected 400 INVALID_ENVIRONMENT, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.4.0.0/24", "name": "Web", "environment": "prod"}`)
+	webID := extractID(t, rec)
+	doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.4.1.0/24", "name": "Lab", "environment": "dev"}`)
+	doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.4.2.0/24", "name": "Unset"}`)
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+webID, `{"environment": "production"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid environment update, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+webID, `{"name": "Web", "environment": "staging"}`)
+	var updated SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil || rec.Code != http.StatusOK || updated.Environment != "staging" {
+		t.Fatalf("Expected environment updated to staging, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets?environment=staging", "")
+	var list ListSubnetsResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if list.TotalCount != 1 || list.Subnets[0].ID != webID {
+		t.Errorf("Expected only the staging subnet, got %s", rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/facets", "")
+	var facets SubnetFacetsJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &facets); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Failed to get facets: %d %s", rec.Code, rec.Body.String())
+	}
+	if facets.Environment["staging"] != 1 || facets.Environment["dev"] != 1 || facets.Environment[""] != 1 {
+		t.Errorf("Unexpected environment facet: %v", facets.Environment)
+	}
+}
+
+func TestSubnetDHCPRangeEndpoints(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	for _, body := range []string{
+		`{"cidr": "10.5.0.0/24", "name": "Outside", "dhcp_range_start": "10.5.0.10", "dhcp_range_end": "10.6.0.10"}`,
+		`{"cidr": "10.5.0.0/24", "name": "Reversed", "dhcp_range_start": "10.5.0.200", "dhcp_range_end": "10.5.0.10"}`,
+	} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_DHCP_RANGE") {
+			t.Errorf("Expected 400 INVALID_DHCP_RANGE, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.5.0.0/24", "name": "Office", "dhcp_range_start": "10.5.0.100", "dhcp_range_end": "10.5.0.200"}`)
+	var created SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("Failed to create subnet: %d %s", rec.Code, rec.Body.String())
+	}
+	if created.DHCPRangeStart != "10.5.0.100" || created.DHCPRangeEnd != "10.5.0.200" {
+		t.Errorf("Expected the DHCP range in the response, got %s", rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+created.ID, `{"dhcp_range_end": "10.5.1.1"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_DHCP_RANGE") {
+		t.Errorf("Expected 400 INVALID_DHCP_RANGE on update, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+created.ID, `{"dhcp_range_start": "10.5.0.150"}`)
+	var updated SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Failed to update subnet: %d %s", rec.Code, rec.Body.String())
+	}
+	if updated.DHCPRangeStart != "10.5.0.150" || updated.DHCPRangeEnd != "10.5.0.200" {
+		t.Errorf("Expected range 10.5.0.150-10.5.0.200, got %s", rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/"+created.ID, "")
+	var fetched SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &fetched); err != nil || fetched.DHCPRangeStart != "10.5.0.150" {
+		t.Errorf("Expected the DHCP range on GET, got %s", rec.Body.String())
+	}
+}
+
+func TestSubnetDNSZoneEndpoints(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.7.0.0/16", "name": "Campus", "dns_zone": "7.10.in-addr.arpa"}`)
+	var created SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("Failed to create subnet: %d %s", rec.Code, rec.Body.String())
+	}
+	if created.DNSZone != "7.10.in-addr.arpa" {
+		t.Errorf("Expected the DNS zone in the response, got %s", rec.Body.String())
+	}
+	doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.8.0.0/16", "name": "Lab"}`)
+
+	search := func(query string) []string {
+		t.Helper()
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?search="+query, "")
+		var list ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("Failed to search subnets: %d %s", rec.Code, rec.Body.String())
+		}
+		var names []string
+		for _, subnet := range list.Subnets {
+			names = append(names, subnet.Name)
+		}
+		return names
+	}
+	if names := search("in-addr.arpa"); !reflect.DeepEqual(names, []string{"Campus"}) {
+		t.Errorf("Expected the search to match the DNS zone of Campus only, got %v", names)
+	}
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+created.ID, `{"dns_zone": "campus.example.com"}`)
+	var updated SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Failed to update subnet: %d %s", rec.Code, rec.Body.String())
+	}
+	if updated.DNSZone != "campus.example.com" || updated.Name != "Campus" {
+		t.Errorf("Expected only the DNS zone to change, got %s", rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/"+created.ID, "")
+	var fetched SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &fetched); err != nil || fetched.DNSZone != "campus.example.com" {
+		t.Errorf("Expected the DNS zone on GET, got %s", rec.Body.String())
+	}
+	if names := search("in-addr.arpa"); len(names) != 0 {
+		t.Errorf("Expected the old DNS zone to no longer match, got %v", names)
+	}
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+created.ID, `{"dns_zone": ""}`)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "dns_zone") {
+		t.Errorf("Expected an empty dns_zone to clear it, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBulkUpdateUtilizationEndpoint(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	first := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.6.0.0/24", "name": "First"}`))
+	second := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.6.1.0/24", "name": "Second"}`))
+
+	utilization := func(id string) *UtilizationJSON {
+		t.Helper()
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, "")
+		var subnet SubnetJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &subnet); err != nil || subnet.Utilization == nil {
+			t.Fatalf("Failed to get subnet %s: %d %s", id, rec.Code, rec.Body.String())
+		}
+		return subnet.Utilization
+	}
+
+	body := `[{"subnet_id": "` + first + `", "allocated_ips": 127}, {"subnet_id": "` + second + `", "allocated_ips": 0}]`
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/utilization", body)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"updated":2`) {
+		t.Fatalf("Expected 200 with 2 updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := utilization(first); got.AllocatedIPs != 127 || got.AvailableIPs != 127 || got.UtilizationPercent != 50 {
+		t.Errorf("Expected 127 allocated and 127 available at 50%%, got %+v", got)
+	}
+	if got := utilization(second); got.TotalIPs != 254 || got.AvailableIPs != 254 {
+		t.Errorf("Expected all 254 addresses available, got %+v", got)
+	}
+
+	body = `[{"subnet_id": "` + second + `", "allocated_ips": 10}, {"subnet_id": "` + first + `", "allocated_ips": 300}]`
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/utilization", body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_UTILIZATION") || !strings.Contains(rec.Body.String(), `"index":"1"`) {
+		t.Errorf("Expected 400 INVALID_UTILIZATION for item 1, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := utilization(second); got.AllocatedIPs != 0 {
+		t.Errorf("Expected the rejected batch to leave the second subnet unchanged, got %+v", got)
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/utilization", `[{"subnet_id": "missing", "allocated_ips": 1}]`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/utilization", `[{"subnet_id": "`+first+`"}]`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "MISSING_FIELD") {
+		t.Errorf("Expected 400 MISSING_FIELD without allocated_ips, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReadinessChecksDatabase(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	handler := NewGateway(service.NewServiceLayer(repo, service.NewGoIPAMService(), nil), nil).Handler()
+
+	rec := doRequest(handler, http.MethodGet, "/ready", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"database":"ok"`) {
+		t.Errorf("Expected 200 with a reachable database, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), `"cloud"`) {
+		t.Errorf("Expected no cloud status without cloud providers, got %s", rec.Body.String())
+	}
+
+	repo.Close()
+
+	rec = doRequest(handler, http.MethodGet, "/ready", "")
+	var readiness ReadinessJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || readiness.Status != "not_ready" || readiness.Database == "ok" {
+		t.Errorf("Expected 503 with a closed database, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected /health to stay healthy, got %d", rec.Code)
+	}
+}
+
+func TestReadinessReportsCloudStatus(t *testing.T) {
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	handler := NewGateway(newTestServiceLayer(t), cloudprovider.NewManager(cfg, nil)).Handler()
+
+	rec := doRequest(handler, http.MethodGet, "/ready", "")
+	var readiness ReadinessJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Failed to get readiness: %d %s", rec.Code, rec.Body.String())
+	}
+	if readiness.Cloud == nil || !readiness.Cloud.Enabled || len(readiness.Cloud.Providers) == 0 {
+		t.Errorf("Expected the cloud provider status, got %s", rec.Body.String())
+	}
+}
+
+func TestCloudStatusReportsImplementedProviders(t *testing.T) {
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	handler := NewGateway(newTestServiceLayer(t), cloudprovider.NewManager(cfg, nil)).Handler()
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/cloud/status", "")
+	var status CloudStatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Failed to get cloud status: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, implemented := range []string{"aws", "azure", "gcp"} {
+		if !status.Providers[implemented].Implemented {
+			t.Errorf("Expected %s to report implemented, got %+v", implemented, status.Providers[implemented])
+		}
+	}
+	for _, stub := range []string{"scaleway", "ovh"} {
+		info, ok := status.Providers[stub]
+		if !ok || info.Implemented {
+			t.Errorf("Expected %s to be listed as not implemented, got %+v", stub, info)
+		}
+	}
+}
+
+// staticProvider is a cloud provider returning a fixed list of subnets
+type staticProvider struct {
+	subnets []*cloudprovider.CloudSubnet
+}
+
+func (p *staticProvider) GetName() string                          { return "Static" }
+func (p *staticProvider) GetType() cloudprovider.CloudProviderType { return "static" }
+func (p *staticProvider) GetRegions() []string                     { return []string{"region-1"} }
+func (p *staticProvider) Implemented() bool                        { return true }
+
+func (p *staticProvider) FetchSubnets(ctx context.Context, credentials cloudprovider.CloudCredentials) ([]*cloudprovider.CloudSubnet, error) {
+	return p.subnets, nil
+}
+
+func (p *staticProvider) ValidateCredentials(ctx context.Context, credentials cloudprovider.CloudCredentials) error {
+	return nil
+}
+
+// rejectingRepository fails to create subnets with the listed CIDRs
+type rejectingRepository struct {
+	repository.SubnetRepository
+	reject map[string]bool
+}
+
+func (r *rejectingRepository) CreateSubnet(ctx context.Context, subnet *repository.Subnet) error {
+	if r.reject[subnet.CIDR] {
+		return errors.New("disk full")
+	}
+	return r.SubnetRepository.CreateSubnet(ctx, subnet)
+}
+
+func TestCloudSyncReportsPartialFailures(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "cloud.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := cloudprovider.NewManager(cfg, &rejectingRepository{SubnetRepository: repo, reject: map[string]bool{"10.70.2.0/24": true}})
+	provider := &staticProvider{subnets: []*cloudprovider.CloudSubnet{
+		{ID: "subnet-1", CIDR: "10.70.1.0/24", Region: "region-1"},
+		{ID: "subnet-2", CIDR: "10.70.2.0/24", Region: "region-1"},
+	}}
+	if err := manager.RegisterProvider(provider, cloudprovider.CloudCredentials{Provider: "static", Region: "region-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+	handler := NewGateway(newTestServiceLayer(t), manager).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/cloud/sync", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp CloudSyncResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+
+	if resp.Success || resp.Synced != 1 || resp.Failed != 1 || resp.Stats.Errors != 1 {
+		t.Errorf("Expected 1 synced and 1 failed, got %+v", resp)
+	}
+	want := []*SyncFailureJSON{{Provider: "static", Region: "region-1", ResourceID: "subnet-2", CIDR: "10.70.2.0/24", Error: "disk full"}}
+	if !reflect.DeepEqual(resp.Errors, want) {
+		t.Errorf("Expected errors %+v, got %+v", want[0], resp.Errors)
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/metrics", "")
+	if !strings.Contains(rec.Body.String(), `ipam_cloud_sync_resource_failures_total{provider="static"} 1`) {
+		t.Errorf("Expected the failure to be counted in metrics, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestCloudSyncSingleProvider(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "cloud.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := cloudprovider.NewManager(cfg, repo)
+	provider := &staticProvider{subnets: []*cloudprovider.CloudSubnet{{ID: "subnet-1", CIDR: "10.72.1.0/24", Region: "region-1"}}}
+	if err := manager.RegisterProvider(provider, cloudprovider.CloudCredentials{Provider: "static", Region: "region-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+	handler := NewGateway(newTestServiceLayer(t), manager).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/cloud/sync", `{"provider": "static"}`)
+	var resp CloudSyncResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !resp.Success || resp.Synced != 1 || resp.Message != "All static regions synchronized successfully" {
+		t.Errorf("Expected the static provider to be synced, got %+v", resp)
+	}
+
+	for _, tc := range []struct{ body, code string }{
+		{`{"provider": "azure"}`, "UNSUPPORTED_PROVIDER"},
+		{`{"provider": "static", "region": "region-1"}`, "INVALID_REQUEST"},
+	} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/cloud/sync", tc.body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("%s: expected 400 %s, got %d: %s", tc.body, tc.code, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// blockingProvider is a static provider whose fetch waits until release is closed
+type blockingProvider struct {
+	staticProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProvider) FetchSubnets(ctx context.Context, credentials cloudprovider.CloudCredentials) ([]*cloudprovider.CloudSubnet, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return p.subnets, nil
+}
+
+func TestCloudSyncRejectsOverlappingRuns(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "cloud.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := cloudprovider.NewManager(cfg, repo)
+	provider := &blockingProvider{started: make(chan struct{}, 1), release: make(chan struct{})}
+	if err := manager.RegisterProvider(provider, cloudprovider.CloudCredentials{Provider: "static", Region: "region-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+	handler := NewGateway(newTestServiceLayer(t), manager).Handler()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.SyncAll(context.Background())
+		done <- err
+	}()
+	<-provider.started
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/cloud/sync", `{}`)
+	var errResp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || rec.Code != http.StatusConflict || errResp.Error == nil || errResp.Error.Code != "SYNC_IN_PROGRESS" {
+		t.Errorf("Expected 409 SYNC_IN_PROGRESS, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var status CloudStatusResponse
+	rec = doRequest(handler, http.MethodGet, "/api/v1/cloud/status", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || !status.InProgress || status.LastSyncStarted == 0 {
+		t.Errorf("Expected status to report a running sync, got %s", rec.Body.String())
+	}
+
+	close(provider.release)
+	if err := <-done; err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/cloud/status", "")
+	status = CloudStatusResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || status.InProgress || status.LastSyncCompleted == 0 {
+		t.Errorf("Expected status to report a completed sync, got %s", rec.Body.String())
+	}
+}
+
+func TestCloudEndpointsWriteJSONHeaders(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "cloud.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{CloudProviders: config.CloudProvidersConfig{Enabled: true}}
+	manager := cloudprovider.NewManager(cfg, repo)
+	provider := &staticProvider{subnets: []*cloudprovider.CloudSubnet{{ID: "subnet-1", CIDR: "10.71.1.0/24", Region: "region-1"}}}
+	if err := manager.RegisterProvider(provider, cloudprovider.CloudCredentials{Provider: "static", Region: "region-1"}); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+	handler := NewGateway(newTestServiceLayer(t), manager).Handler()
+
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/v1/cloud/sync", `{}`},
+		{http.MethodGet, "/api/v1/cloud/status", ""},
+		{http.MethodPost, "/api/v1/cloud/utilization/update", ""},
+	} {
+		rec := doRequest(handler, tc.method, tc.path, tc.body)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s: expected status 200, got %d: %s", tc.method, tc.path, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s %s: expected Content-Type application/json, got %q", tc.method, tc.path, got)
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("%s %s: expected a JSON body, got %s", tc.method, tc.path, rec.Body.String())
+		}
+	}
+}
+
+func TestDeleteSubnetWithChildrenEndpoint(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.8.0.0/16", "name": "VPC"}`))
+	childID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.8.0.0/20", "name": "Tier", "parent_id": "`+parentID+`"}`))
+	grandchildID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.8.1.0/24", "name": "App", "parent_id": "`+childID+`"}`))
+
+	rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/"+parentID, "")
+	var errResp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || rec.Code != http.StatusConflict {
+		t.Fatalf("Expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if errResp.Error.Code != "HAS_CHILDREN" || errResp.Error.Details["subnet_ids"] != childID {
+		t.Errorf("Expected HAS_CHILDREN naming %s, got %+v", childID, errResp.Error)
+	}
+
+	rec = doRequest(handler, http.MethodDelete, "/api/v1/subnets/"+parentID+"?cascade=true", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected cascading delete to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, id := range []string{parentID, childID, grandchildID} {
+		if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected %s to be deleted, got %d", id, rec.Code)
+		}
+	}
+}
+
+func TestBulkCreateSubnets(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.9.0.0/16", "name": "Parent"}`)
+	parentID := extractID(t, rec)
+
+	countSubnets := func() int32 {
+		t.Helper()
+		var list ListSubnetsResponseJSON
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		return list.TotalCount
+	}
+
+	bulkCreate := func(t *testing.T, body string, wantStatus int) BulkCreateSubnetsResponseJSON {
+		t.Helper()
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/bulk", body)
+		var response BulkCreateSubnetsResponseJSON
+		if wantStatus == http.StatusCreated {
+			assertCreated(t, handler, rec, "/api/v1/subnets", &response)
+			return response
+		}
+		if rec.Code != wantStatus {
+			t.Fatalf("Expected status %d, got %d: %s", wantStatus, rec.Code, rec.Body.String())
+		}
+		if location := rec.Header().Get("Location"); location != "" {
+			t.Errorf("Expected no Location on a failed batch, got %q", location)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		return response
+	}
+
+	t.Run("creates every subnet", func(t *testing.T) {
+		response := bulkCreate(t, `[
+			{"cidr": "10.9.1.0/24", "name": "A", "parent_id": "`+parentID+`"},
+			{"cidr": "10.9.2.0/24", "name": "B", "parent_id": "`+parentID+`"}
+		]`, http.StatusCreated)
+
+		if !response.Success || response.Created != 2 || len(response.Results) != 2 {
+			t.Fatalf("Unexpected response: %+v", response)
+		}
+		for _, result := range response.Results {
+			if !result.Success || result.ID == "" {
+				t.Errorf("Expected item %d to succeed, got %+v", result.Index, result)
+			}
+		}
+		if got := countSubnets(); got != 3 {
+			t.Errorf("Expected 3 subnets, got %d", got)
+		}
+	})
+
+	t.Run("creates nothing when an item is invalid", func(t *testing.T) {
+		response := bulkCreate(t, `[
+			{"cidr": "10.9.3.0/24", "name": "C", "parent_id": "`+parentID+`"},
+			{"cidr": "10.8.0.0/24", "name": "Stray", "parent_id": "`+parentID+`"},
+			{"cidr": "10.9.4.0/24", "name": "D", "environment": "qa", "parent_id": "`+parentID+`"}
+		]`, http.StatusBadRequest)
+
+		wantCodes := []string{"BATCH_ROLLED_BACK", "CHILD_NOT_CONTAINED", "INVALID_ENVIRONMENT"}
+		for i, result := range response.Results {
+			if result.Index != i || result.Success || result.Error == nil || result.Error.Code != wantCodes[i] {
+				t.Errorf("Expected item %d to fail with %s, got %+v", i, wantCodes[i], result)
+			}
+		}
+		if response.Results[1].CIDR != "10.8.0.0/24" {
+			t.Errorf("Expected failing item CIDR 10.8.0.0/24, got %s", response.Results[1].CIDR)
+		}
+		if got := countSubnets(); got != 3 {
+			t.Errorf("Expected no subnets created, got %d total", got)
+		}
+	})
+
+	t.Run("rejects items overlapping each other", func(t *testing.T) {
+		response := bulkCreate(t, `[
+			{"cidr": "172.16.0.0/24", "name": "E"},
+			{"cidr": "172.16.0.128/25", "name": "F"}
+		]`, http.StatusConflict)
+
+		if response.Results[1].Error == nil || response.Results[1].Error.Code != "OVERLAPPING_CIDR" {
+			t.Errorf("Expected item 1 to fail with OVERLAPPING_CIDR, got %+v", response.Results[1])
+		}
+		if got := countSubnets(); got != 3 {
+			t.Errorf("Expected no subnets created, got %d total", got)
+		}
+	})
+
+	t.Run("rolls back on a duplicate CIDR", func(t *testing.T) {
+		response := bulkCreate(t, `[
+			{"cidr": "10.9.5.0/24", "name": "G", "parent_id": "`+parentID+`"},
+			{"cidr": "10.9.1.0/24", "name": "Duplicate", "parent_id": "`+parentID+`"}
+		]`, http.StatusConflict)
+
+		if response.Results[0].Error == nil || response.Results[0].Error.Code != "BATCH_ROLLED_BACK" {
+			t.Errorf("Expected item 0 to be rolled back, got %+v", response.Results[0])
+		}
+		if response.Results[1].Error == nil || response.Results[1].Error.Code != "DUPLICATE_SUBNET" {
+			t.Errorf("Expected item 1 to fail with DUPLICATE_SUBNET, got %+v", response.Results[1])
+		}
+		if got := countSubnets(); got != 3 {
+			t.Errorf("Expected no subnets created, got %d total", got)
+		}
+	})
+}
+
+func TestRepositoryErrorStatuses(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	body := `{"cidr": "10.92.0.0/24", "name": "Original", "location": "datacenter-1"}`
+	extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", body)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "DUPLICATE_SUBNET") {
+		t.Errorf("Expected 409 DUPLICATE_SUBNET for a repeated CIDR, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, req := range []struct{ method, body string }{
+		{http.MethodGet, ""},
+		{http.MethodPut, `{"name": "Renamed"}`},
+		{http.MethodDelete, ""},
+	} {
+		rec := doRequest(handler, req.method, "/api/v1/subnets/missing", req.body)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "SUBNET_NOT_FOUND") {
+			t.Errorf("%s of an unknown subnet: expected 404 SUBNET_NOT_FOUND, got %d: %s", req.method, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestStatsByPrefixLength(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	for _, cidr := range []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/26", "172.16.0.0/16"} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "`+cidr+`", "name": "`+cidr+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Failed to create %s: %d %s", cidr, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/stats/by-prefix-length", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var stats PrefixLengthStatsJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+
+	want := []PrefixLengthCountJSON{{PrefixLength: 16, Count: 1}, {PrefixLength: 24, Count: 2}, {PrefixLength: 26, Count: 1}}
+	if len(stats.PrefixLengths) != len(want) {
+		t.Fatalf("Expected %d prefix lengths, got %+v", len(want), stats.PrefixLengths)
+	}
+	for i, count := range stats.PrefixLengths {
+		if *count != want[i] {
+			t.Errorf("Expected %+v at position %d, got %+v", want[i], i, *count)
+		}
+	}
+	if stats.TotalCount != 4 {
+		t.Errorf("Expected total count 4, got %d", stats.TotalCount)
+	}
+}
+
+func TestStatsEfficiency(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/stats/efficiency", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"pools":[]}` {
+		t.Fatalf("Expected empty stats, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	poolID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.20.0.0/22", "name": "Pool"}`))
+	for _, cidr := range []string{"10.20.0.0/24", "10.20.2.0/25"} {
+		doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "`+cidr+`", "name": "`+cidr+`", "parent_id": "`+poolID+`"}`)
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/stats/efficiency", "")
+	var stats EfficiencyStatsJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Failed to get efficiency stats: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 10.20.1.0/24 and 10.20.2.128/25 lie between the children, 10.20.3.0/24 after them
+	wantPool := PoolEfficiencyJSON{SubnetID: poolID, Name: "Pool", CIDR: "10.20.0.0/22", TotalAddresses: 1024, AllocatedAddresses: 384, FreeAddresses: 640, FreeBlocks: 3, LargestFreeBlock: "10.20.1.0/24"}
+	if len(stats.Pools) != 1 || *stats.Pools[0] != wantPool {
+		t.Errorf("Expected pool %+v, got %s", wantPool, rec.Body.String())
+	}
+	wantTotals := EfficiencyTotalsJSON{Pools: 1, TotalAddresses: 1024, AllocatedAddresses: 384, FreeAddresses: 640, FreeBlocks: 3}
+	if stats.IPv4 == nil || *stats.IPv4 != wantTotals || stats.IPv6 != nil {
+		t.Errorf("Expected IPv4 totals %+v only, got %s", wantTotals, rec.Body.String())
+	}
+}
+
+func TestSubnetReservations(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	subnetID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.60.0.0/24", "name": "Hosts"}`))
+	base := "/api/v1/subnets/" + subnetID + "/reservations"
+
+	rec := doRequest(handler, http.MethodPost, base, `{"start_ip": "10.60.0.1", "end_ip": "10.60.0.10", "reason": "network gear"}`)
+	var reservation ReservationJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &reservation); err != nil || reservation.ID == "" {
+		t.Fatalf("Failed to decode reservation: %d %s", rec.Code, rec.Body.String())
+	}
+	assertCreated(t, handler, rec, base+"/"+reservation.ID, &reservation)
+	if reservation.StartIP != "10.60.0.1" || reservation.EndIP != "10.60.0.10" || reservation.Reason != "network gear" {
+		t.Errorf("Unexpected reservation %+v", reservation)
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/"+subnetID+"/allocations", `{}`)
+	var allocation AllocationJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &allocation); err != nil || allocation.IP != "10.60.0.11" {
+		t.Errorf("Expected the first allocation to be 10.60.0.11, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/"+subnetID+"/allocations", `{"ip": "10.60.0.3"}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "IP_RESERVED") {
+		t.Errorf("Expected 409 IP_RESERVED, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, base, `{"start_ip": "10.61.0.1"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "IP_OUT_OF_RANGE") {
+		t.Errorf("Expected 400 IP_OUT_OF_RANGE, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPost, base, `{"reason": "missing start"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "MISSING_FIELD") {
+		t.Errorf("Expected 400 MISSING_FIELD, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(handler, http.MethodDelete, base+"/"+reservation.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 deleting the reservation, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodGet, base+"/"+reservation.ID, ""); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "RESERVATION_NOT_FOUND") {
+		t.Errorf("Expected 404 RESERVATION_NOT_FOUND for a deleted reservation, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodDelete, base+"/"+reservation.ID, ""); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "RESERVATION_NOT_FOUND") {
+		t.Errorf("Expected 404 RESERVATION_NOT_FOUND deleting twice, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/missing/reservations/"+reservation.ID, ""); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "SUBNET_NOT_FOUND") {
+		t.Errorf("Expected 404 SUBNET_NOT_FOUND for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	doRequest(handler, http.MethodPost, base, `{"start_ip": "10.60.0.200"}`)
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+subnetID, `{"cidr": "10.60.0.0/25", "name": "Hosts"}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "RESERVATIONS_OUT_OF_RANGE") {
+		t.Errorf("Expected 409 RESERVATIONS_OUT_OF_RANGE, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListAllIPAllocations(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	subnetA := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.62.0.0/24", "name": "A"}`))
+	subnetB := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.63.0.0/24", "name": "B"}`))
+	for _, req := range []struct{ subnetID, body string }{
+		{subnetA, `{"hostname": "web-01", "description": "frontend"}`},
+		{subnetA, `{"hostname": "db-01", "description": "database"}`},
+		{subnetB, `{"ip": "10.63.0.20", "hostname": "web-01"}`},
+	} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+req.subnetID+"/allocations", req.body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	list := func(query string) *ListAllocationsResponseJSON {
+		t.Helper()
+		rec := doRequest(handler, http.MethodGet, "/api/v1/ips"+query, "")
+		var resp ListAllocationsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("Failed to list IPs with %q: %d %s", query, rec.Code, rec.Body.String())
+		}
+		return &resp
+	}
+
+	resp := list("?hostname=web-01")
+	if resp.TotalCount != 2 || len(resp.Allocations) != 2 ||
+		resp.Allocations[0].SubnetID != subnetA || resp.Allocations[0].IP != "10.62.0.1" || resp.Allocations[0].Hostname != "web-01" ||
+		resp.Allocations[1].SubnetID != subnetB || resp.Allocations[1].IP != "10.63.0.20" {
+		t.Errorf("Expected web-01 in both subnets, got %+v", resp.Allocations)
+	}
+
+	if resp := list("?hostname=web-01&subnet_id=" + subnetB); resp.TotalCount != 1 || resp.Allocations[0].IP != "10.63.0.20" {
+		t.Errorf("Expected web-01 in subnet B only, got %+v", resp.Allocations)
+	}
+	if resp := list("?search=data"); resp.TotalCount != 1 || resp.Allocations[0].Hostname != "db-01" {
+		t.Errorf("Expected the search to match the description, got %+v", resp.Allocations)
+	}
+	if resp := list("?page=1&page_size=2"); resp.TotalCount != 3 || len(resp.Allocations) != 1 {
+		t.Errorf("Expected 1 allocation on the second page of 3, got %+v", resp)
+	}
+	if resp := list("?hostname=missing"); resp.TotalCount != 0 || resp.Allocations == nil {
+		t.Errorf("Expected an empty allocations array, got %+v", resp)
+	}
+}
+
+func TestSplitSubnet(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.40.0.0/23", "name": "Parent"}`)
+	parentID := extractID(t, rec)
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/"+parentID+"/split", `{"prefix": 23}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_PREFIX_LENGTH") {
+		t.Errorf("Expected 400 INVALID_PREFIX_LENGTH, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/"+parentID+"/split-preview?prefix_length=24", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var preview SplitPreviewJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/"+parentID+"/split", `{"prefix": 24}`)
+	var split SplitSubnetResponseJSON
+	assertCreated(t, handler, rec, "/api/v1/subnets/"+parentID+"/children", &split)
+	if split.Count != 2 || split.Subnets[0].CIDR != "10.40.0.0/24" || split.Subnets[1].CIDR != "10.40.1.0/24" {
+		t.Errorf("Unexpected split result: %+v", split)
+	}
+	if preview.Count != split.Count || strings.Join(preview.CIDRs, ",") != "10.40.0.0/24,10.40.1.0/24" {
+		t.Errorf("Preview %+v does not match the split", preview)
+	}
+
+	for query, status := range map[string]int{
+		"":                 http.StatusBadRequest,
+		"prefix_length=xx": http.StatusBadRequest,
+		"prefix_length=22": http.StatusBadRequest,
+		"prefix_length=24": http.StatusConflict,
+	} {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+parentID+"/split-preview?"+query, "")
+		if rec.Code != status {
+			t.Errorf("split-preview?%s: expected %d, got %d: %s", query, status, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/missing/split", `{"prefix": 24}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListSubnetsManagedBy(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.50.0.0/24", "name": "Manual"}`)
+	doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.51.0.0/24", "name": "Synced", "cloud_info": {"provider": "aws", "vpc_id": "vpc-1"}}`)
+
+	for managedBy, want := range map[string]string{"manual": "10.50.0.0/24", "cloud": "10.51.0.0/24"} {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?managed_by="+managedBy, "")
+		var list ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		if list.TotalCount != 1 || list.Subnets[0].CIDR != want {
+			t.Errorf("managed_by=%s: expected only %s, got %s", managedBy, want, rec.Body.String())
+		}
+	}
+
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?managed_by=terraform", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid managed_by, got %d", rec.Code)
+	}
+}
+
+func TestListSubnetsTagFilter(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	for _, body := range []string{
+		`{"cidr": "10.60.0.0/24", "name": "Prod net", "tags": {"Environment": "prod", "Team": "net"}}`,
+		`{"cidr": "10.61.0.0/24", "name": "Prod web", "tags": {"Environment": "prod", "Team": "web"}}`,
+		`{"cidr": "10.62.0.0/24", "name": "Dev net", "tags": {"Environment": "dev", "Team": "net"}}`,
+	} {
+		extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+	}
+
+	for query, want := range map[string][]string{
+		"tag=Environment:prod":              {"10.60.0.0/24", "10.61.0.0/24"},
+		"tag=Team:net":                      {"10.60.0.0/24", "10.62.0.0/24"},
+		"tag=Environment:prod&tag=Team:net": {"10.60.0.0/24"},
+		"tag=Environment:staging":           {},
+	} {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var list ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		got := make([]string, 0, len(list.Subnets))
+		for _, subnet := range list.Subnets {
+			got = append(got, subnet.CIDR)
+		}
+		// Subnets created within the same second have no guaranteed order
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") || int(list.TotalCount) != len(want) {
+			t.Errorf("%s: expected %v, got %v (total %d)", query, want, got, list.TotalCount)
+		}
+	}
+
+	for _, query := range []string{"tag=Environment", "tag=:prod", "tag=Environment:prod&tag=Environment:dev"} {
+		if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestListSubnetsPublicAndPrefixFilters(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	for _, cidr := range []string{"10.70.0.0/24", "10.70.1.0/25", "8.8.8.0/24", "1.1.1.0/25"} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "`+cidr+`", "name": "`+cidr+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	for query, want := range map[string][]string{
+		"is_public=true":            {"1.1.1.0/25", "8.8.8.0/24"},
+		"is_public=false":           {"10.70.0.0/24", "10.70.1.0/25"},
+		"prefix=24":                 {"10.70.0.0/24", "8.8.8.0/24"},
+		"prefix=/25":                {"1.1.1.0/25", "10.70.1.0/25"},
+		"prefix=16":                 {},
+		"is_public=true&prefix=24":  {"8.8.8.0/24"},
+		"is_public=false&prefix=25": {"10.70.1.0/25"},
+	} {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var list ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		got := make([]string, 0, len(list.Subnets))
+		for _, subnet := range list.Subnets {
+			got = append(got, subnet.CIDR)
+		}
+		// Subnets created within the same second have no guaranteed order
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") || int(list.TotalCount) != len(want) {
+			t.Errorf("%s: expected %v, got %v (total %d)", query, want, got, list.TotalCount)
+		}
+	}
+
+	for _, query := range []string{"is_public=maybe", "prefix=abc", "prefix=129", "prefix=-1"} {
+		if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestListSubnetsCursor(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	for _, cidr := range []string{"10.60.0.0/24", "10.60.1.0/24", "10.60.2.0/24"} {
+		doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "`+cidr+`", "name": "`+cidr+`"}`)
+	}
+
+	seen := make(map[string]bool)
+	path := "/api/v1/subnets?page_size=2"
+	for page := 0; page < 3; page++ {
+		rec := doRequest(handler, http.MethodGet, path, "")
+		var list ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		for _, subnet := range list.Subnets {
+			if seen[subnet.ID] {
+				t.Errorf("Subnet %s returned twice", subnet.ID)
+			}
+			seen[subnet.ID] = true
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		path = "/api/v1/subnets?page_size=2&cursor=" + list.NextCursor
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected all 3 subnets across pages, got %d", len(seen))
+	}
+
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?cursor=garbage", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid cursor, got %d", rec.Code)
+	}
+}
+
+func TestSoftDeleteRestoreAndPurgeSubnet(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{AdminToken: "admin-secret"}}
+	handler := NewGatewayWithConfig(newTestServiceLayer(t), nil, cfg).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.50.0.0/24", "name": "Doomed"}`)
+	id := extractID(t, rec)
+
+	if rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/"+id, ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on delete, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected soft-deleted subnet to return 404, got %d", rec.Code)
+	}
+
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/"+id+"/restore", "")
+	if rec.Code != http.StatusOK || extractID(t, rec) != id {
+		t.Fatalf("Expected restored subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+id+"/restore", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 restoring a live subnet, got %d", rec.Code)
+	}
+
+	purge := func(query, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/subnets/"+id+query, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := purge("?purge=maybe", "Bearer admin-secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid purge value, got %d", rec.Code)
+	}
+	if rec := purge("?purge=true", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 purging without the admin token, got %d", rec.Code)
+	}
+	if rec := purge("?purge=true", "Bearer admin-secret"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on purge, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+id+"/restore", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a purged subnet not to be restorable, got %d", rec.Code)
+	}
+}
+
+func TestIdempotentDeleteSubnet(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+	id := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.51.0.0/24", "name": "Retried"}`))
+
+	t.Run("idempotent", func(t *testing.T) {
+		// A retried delete answers the same as the first one
+		for attempt := 0; attempt < 2; attempt++ {
+			rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/"+id+"?idempotent=true", "")
+			if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+				t.Errorf("Attempt %d: expected 204 with no body, got %d: %s", attempt, rec.Code, rec.Body.String())
+			}
+		}
+		if rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/never-existed?idempotent=true", ""); rec.Code != http.StatusNoContent {
+			t.Errorf("Expected 204 for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		for _, query := range []string{"", "?idempotent=false"} {
+			rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/"+id+query, "")
+			if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "SUBNET_NOT_FOUND") {
+				t.Errorf("Expected 404 SUBNET_NOT_FOUND for %q, got %d: %s", query, rec.Code, rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("other errors are still reported", func(t *testing.T) {
+		parentID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.52.0.0/16", "name": "Parent"}`))
+		doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.52.1.0/24", "name": "Child", "parent_id": "`+parentID+`"}`)
+
+		rec := doRequest(handler, http.MethodDelete, "/api/v1/subnets/"+parentID+"?idempotent=true", "")
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Expected 409 HAS_CHILDREN, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestUpdateSubnetChildrenOutOfRange(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.70.0.0/16", "name": "Parent"}`)
+	parentID := extractID(t, rec)
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.70.200.0/24", "name": "Child", "parent_id": "`+parentID+`"}`)
+	childID := extractID(t, rec)
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+parentID, `{"cidr": "10.70.0.0/17"}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "CHILDREN_OUT_OF_RANGE") || !strings.Contains(rec.Body.String(), childID) {
+		t.Errorf("Expected 409 CHILDREN_OUT_OF_RANGE naming the child, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+parentID+"?force=true", `{"cidr": "10.70.0.0/17"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected forced update to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateSubnetClearFields(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.91.0.0/24", "name": "Named", "location": "datacenter-1", "location_type": "DATACENTER"}`)
+	id := extractID(t, rec)
+
+	tests := []struct {
+		body string
+		want [3]string
+	}{
+		{body: `{"description": "Described", "location_type": "DATACENTER"}`, want: [3]string{"Named", "Described", "datacenter-1"}},
+		{body: `{"location_type": "DATACENTER"}`, want: [3]string{"Named", "Described", "datacenter-1"}},
+		{body: `{"description": "", "location_type": "DATACENTER"}`, want: [3]string{"Named", "", "datacenter-1"}},
+		{body: `{"location": "", "location_type": "DATACENTER"}`, want: [3]string{"Named", "", ""}},
+	}
+	for _, tt := range tests {
+		rec := doRequest(handler, http.MethodPut, "/api/v1/subnets/"+id, tt.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s: expected 200, got %d: %s", tt.body, rec.Code, rec.Body.String())
+		}
+		var subnet SubnetJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &subnet); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		if got := [3]string{subnet.Name, subnet.Description, subnet.Location}; got != tt.want {
+			t.Errorf("PUT %s: expected name/description/location %q, got %q", tt.body, tt.want, got)
+		}
+	}
+
+	// The name is required, so it cannot be cleared
+	rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+id, `{"name": "", "location_type": "DATACENTER"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "MISSING_FIELD") {
+		t.Errorf("Expected 400 MISSING_FIELD for an empty name, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateSubnetIfMatch(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+	id := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.9.0.0/24", "name": "Web"}`))
+
+	put := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/subnets/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	etag := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected GET to return an ETag")
+	}
+
+	rec := put(etag, `{"name": "Frontend"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the matching update to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	current := rec.Header().Get("ETag")
+	if current == "" || current == etag {
+		t.Fatalf("Expected the update to return a new ETag, got %q", current)
+	}
+	if got := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, "").Header().Get("ETag"); got != current {
+		t.Errorf("Expected GET to return the ETag of the update %s, got %s", current, got)
+	}
+
+	// A second operator still holding the first ETag is turned away
+	rec = put(etag, `{"name": "Backend"}`)
+	var errResp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || rec.Code != http.StatusPreconditionFailed || errResp.Error == nil || errResp.Error.Code != "PRECONDITION_FAILED" {
+		t.Fatalf("Expected 412 PRECONDITION_FAILED, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var subnet SubnetJSON
+	if err := json.Unmarshal(doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, "").Body.Bytes(), &subnet); err != nil || subnet.Name != "Frontend" {
+		t.Errorf("Expected the stale update to be rejected, got %+v (%v)", subnet, err)
+	}
+
+	// Without If-Match the update is unconditional
+	if rec := put("", `{"name": "Backend"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected an update without If-Match to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGetSubnetPath(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := ""
+	var leafID string
+	for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"} {
+		body := `{"cidr": "` + cidr + `", "name": "` + cidr + `", "parent_id": "` + parentID + `"}`
+		leafID = extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+		parentID = leafID
+	}
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+leafID+"/path", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var path SubnetPathJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &path); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if got := strings.Join(path.Path, ","); got != "10.0.0.0/8,10.1.0.0/16,10.1.2.0/24" {
+		t.Errorf("Unexpected path %s", got)
+	}
+
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/missing/path", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d", rec.Code)
+	}
+}
+
+func TestLookupSubnets(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := ""
+	for _, cidr := range []string{"10.0.0.0/8", "10.2.0.0/16", "10.2.3.0/24"} {
+		body := `{"cidr": "` + cidr + `", "name": "` + cidr + `", "parent_id": "` + parentID + `"}`
+		parentID = extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+	}
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/lookup?ip=10.2.3.4", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var lookup SubnetLookupJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &lookup); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if lookup.Subnet == nil || lookup.Subnet.CIDR != "10.2.3.0/24" || len(lookup.Parents) != 2 || lookup.Parents[0].CIDR != "10.2.0.0/16" {
+		t.Errorf("Unexpected lookup result %s", rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/lookup?cidr=10.2.0.0/20", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var contained ContainedSubnetsJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &contained); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if len(contained.Subnets) != 1 || contained.Subnets[0].CIDR != "10.2.3.0/24" {
+		t.Errorf("Unexpected contained subnets %s", rec.Body.String())
+	}
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{query: "ip=192.168.1.1", status: http.StatusNotFound},
+		{query: "cidr=172.16.0.0/12", status: http.StatusNotFound},
+		{query: "ip=not-an-ip", status: http.StatusBadRequest},
+		{query: "cidr=10.0.0.0/33", status: http.StatusBadRequest},
+		{query: "", status: http.StatusBadRequest},
+		{query: "ip=10.2.3.4&cidr=10.2.0.0/20", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/lookup?"+tt.query, ""); rec.Code != tt.status {
+			t.Errorf("lookup?%s: expected %d, got %d", tt.query, tt.status, rec.Code)
+		}
+	}
+}
+
+// failingListRepository fails every subnet listing
+type failingListRepository struct {
+	repository.SubnetRepository
+}
+
+func (r *failingListRepository) ListSubnets(ctx context.Context, filters repository.SubnetFilters) (*repository.SubnetList, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestExportSubnets(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	for _, cidr := range []string{"10.80.1.0/24", "10.80.2.0/24"} {
+		extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "`+cidr+`", "name": "Export `+cidr+`", "location": "dc-1"}`))
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=csv", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got != "text/csv" {
+			t.Errorf("Expected text/csv, got %q", got)
+		}
+
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse CSV: %v", err)
+		}
+		if len(records) != 3 {
+			t.Fatalf("Expected a header and 2 rows, got %d records", len(records))
+		}
+		if strings.Join(records[0], ",") != strings.Join(SubnetExportColumns, ",") {
+			t.Errorf("Unexpected header %v", records[0])
+		}
+		for _, record := range records[1:] {
+			if !strings.HasPrefix(record[1], "10.80.") || record[3] != "dc-1" || len(record) != len(SubnetExportColumns) {
+				t.Errorf("Unexpected row %v", record)
+			}
+		}
+	})
+
+	t.Run("csv escapes formulas", func(t *testing.T) {
+		handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+		extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.81.0.0/24", "name": "=HYPERLINK(\"http://evil\")", "location": "@dc"}`))
+
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=csv", "")
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil || len(records) != 2 {
+			t.Fatalf("Expected a header and 1 row, got %v (%v)", records, err)
+		}
+		if records[1][2] != `'=HYPERLINK("http://evil")` || records[1][3] != "'@dc" {
+			t.Errorf("Expected formula cells to be escaped, got %v", records[1])
+		}
+	})
+
+	t.Run("list failure returns an error response", func(t *testing.T) {
+		repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "export.db"))
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		serviceLayer := service.NewServiceLayer(&failingListRepository{SubnetRepository: repo}, service.NewGoIPAMService(), nil)
+		handler := NewGateway(serviceLayer, nil).Handler()
+
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=csv", "")
+		if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "INTERNAL_ERROR") {
+			t.Errorf("Expected 500 INTERNAL_ERROR, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got == "text/csv" {
+			t.Errorf("Expected no CSV content type on failure, got %q", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=json", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		decoder := json.NewDecoder(rec.Body)
+		var cidrs []string
+		for decoder.More() {
+			var row SubnetExportJSON
+			if err := decoder.Decode(&row); err != nil {
+				t.Fatalf("Failed to decode NDJSON row: %v", err)
+			}
+			cidrs = append(cidrs, row.CIDR)
+		}
+		sort.Strings(cidrs)
+		if strings.Join(cidrs, ",") != "10.80.1.0/24,10.80.2.0/24" {
+			t.Errorf("Unexpected exported CIDRs %v", cidrs)
+		}
+	})
+
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=xml", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", rec.Code)
+	}
+}
+
+func TestExportSubnetsNetBox(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	t.Run("empty inventory", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=netbox", "")
+		if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+			t.Errorf("Expected an empty array, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	id := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.60.0.0/24", "name": "Web Tier", "location": "dc-1", "environment": "prod", "tags": {"Team": "Platform Ops", "app": "web"}}`))
+	extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.61.0.0/24", "name": "Other"}`))
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/export?format=netbox", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected application/json, got %q", got)
+	}
+
+	// Every prefix must only carry writable fields of NetBox's prefix model
+	// with the types NetBox expects
+	var prefixes []map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &prefixes); err != nil {
+		t.Fatalf("Expected a JSON array, got %v: %s", err, rec.Body.String())
+	}
+	if len(prefixes) != 2 {
+		t.Fatalf("Expected 2 prefixes, got %d", len(prefixes))
+	}
+	schemaFields := []string{"custom_fields", "description", "is_pool", "prefix", "status", "tags"}
+	netBoxStatuses := map[string]bool{"container": true, "active": true, "reserved": true, "deprecated": true}
+	slugPattern := regexp.MustCompile(`^[-a-zA-Z0-9_]+$`)
+	customFieldPattern := regexp.MustCompile(`^[a-z0-9_]+$`)
+
+	for _, raw := range prefixes {
+		fields := make([]string, 0, len(raw))
+		for field := range raw {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		if strings.Join(fields, ",") != strings.Join(schemaFields, ",") {
+			t.Errorf("Expected fields %v, got %v", schemaFields, fields)
+		}
+	}
+
+	var typed []*NetBoxPrefixJSON
+	decoder := json.NewDecoder(strings.NewReader(rec.Body.String()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&typed); err != nil {
+		t.Fatalf("Prefixes do not match the NetBox schema: %v", err)
+	}
+
+	var sample *NetBoxPrefixJSON
+	for _, prefix := range typed {
+		if _, err := netip.ParsePrefix(prefix.Prefix); err != nil {
+			t.Errorf("Expected a CIDR prefix, got %q", prefix.Prefix)
+		}
+		if !netBoxStatuses[prefix.Status] {
+			t.Errorf("Unexpected NetBox status %q", prefix.Status)
+		}
+		if len(prefix.Description) > 200 {
+			t.Errorf("Description exceeds NetBox's 200 characters: %q", prefix.Description)
+		}
+		for _, tag := range prefix.Tags {
+			if tag.Name == "" || !slugPattern.MatchString(tag.Slug) {
+				t.Errorf("Invalid NetBox tag %+v", tag)
+			}
+		}
+		for name := range prefix.CustomFields {
+			if !customFieldPattern.MatchString(name) {
+				t.Errorf("Invalid NetBox custom field name %q", name)
+			}
+		}
+		if prefix.Prefix == "10.60.0.0/24" {
+			sample = prefix
+		}
+	}
+
+	if sample == nil {
+		t.Fatal("Expected the sample subnet in the export")
+	}
+	if sample.Status != "active" || sample.Description != "Web Tier" || sample.IsPool {
+		t.Errorf("Unexpected sample prefix %+v", sample)
+	}
+	wantTags := []*NetBoxTagJSON{
+		{Name: "Team:Platform Ops", Slug: "team-platform-ops"},
+		{Name: "app:web", Slug: "app-web"},
+	}
+	if !reflect.DeepEqual(sample.Tags, wantTags) {
+		t.Errorf("Expected tags %+v, got %+v", wantTags, sample.Tags)
+	}
+	wantFields := map[string]string{
+		"ipam_id":          id,
+		"ipam_location":    "dc-1",
+		"ipam_environment": "prod",
+	}
+	for name, want := range wantFields {
+		if got := sample.CustomFields[name]; got != want {
+			t.Errorf("Expected custom field %s=%q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestGetSubnetTree(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := ""
+	var rootID string
+	for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"} {
+		body := `{"cidr": "` + cidr + `", "name": "` + cidr + `", "parent_id": "` + parentID + `"}`
+		parentID = extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+		if rootID == "" {
+			rootID = parentID
+		}
+	}
+
+	getTree := func(query string) *SubnetTreeJSON {
+		t.Helper()
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+rootID+"/tree"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var tree SubnetTreeJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &tree); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		return &tree
+	}
+
+	tree := getTree("")
+	if tree.CIDR != "10.0.0.0/8" || tree.DescendantCount != 2 || len(tree.Children) != 1 {
+		t.Fatalf("Unexpected root node: %+v", tree)
+	}
+	if leaf := tree.Children[0].Children; len(leaf) != 1 || leaf[0].CIDR != "10.1.2.0/24" || leaf[0].Children == nil {
+		t.Errorf("Expected the /24 as an empty-children leaf, got %+v", leaf)
+	}
+
+	tree = getTree("?max_depth=1")
+	if len(tree.Children) != 1 || len(tree.Children[0].Children) != 0 || tree.Children[0].DescendantCount != 1 {
+		t.Errorf("Expected max_depth=1 to stop after the /16 but keep its count, got %+v", tree.Children[0])
+	}
+
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+rootID+"/tree?max_depth=-1", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative max_depth, got %d", rec.Code)
+	}
+	if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/missing/tree", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d", rec.Code)
+	}
+}
+
+func TestSubnetHostCount(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	id := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "2001:db8:1::/64", "name": "IPv6"}`))
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var subnet SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &subnet); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if subnet.Details == nil || subnet.Details.HostCount != "18446744073709551616" {
+		t.Errorf("Expected an exact host_count of 2^64, got %+v", subnet.Details)
+	}
+}
+
+func TestFindBatch(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := ""
+	for _, cidr := range []string{"10.0.0.0/8", "10.2.0.0/16", "10.2.3.0/24"} {
+		body := `{"cidr": "` + cidr + `", "name": "` + cidr + `", "parent_id": "` + parentID + `"}`
+		parentID = extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+	}
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/find-batch", `{"ips": ["10.2.3.4", "10.2.4.1", "192.168.1.1"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp FindBatchResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %s", rec.Body.String())
+	}
+	if resp.Results[0].Subnet == nil || resp.Results[0].Subnet.CIDR != "10.2.3.0/24" {
+		t.Errorf("Expected 10.2.3.4 in 10.2.3.0/24, got %s", rec.Body.String())
+	}
+	if resp.Results[1].Subnet == nil || resp.Results[1].Subnet.CIDR != "10.2.0.0/16" {
+		t.Errorf("Expected 10.2.4.1 in 10.2.0.0/16, got %s", rec.Body.String())
+	}
+	if resp.Results[2].IP != "192.168.1.1" || resp.Results[2].Subnet != nil {
+		t.Errorf("Expected a null subnet for 192.168.1.1, got %s", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"subnet":null`) {
+		t.Errorf("Expected unmatched IPs to carry a null subnet, got %s", rec.Body.String())
+	}
+
+	for _, body := range []string{`{"ips": []}`, `{"ips": ["10.2.3"]}`, `not json`} {
+		if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/find-batch", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestCalculateEndpoint(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	rec := doRequest(handler, http.MethodPost, "/api/v1/calculate", `{"cidrs": ["10.0.0.0/24", "2001:db8::/48", "10.0.0.300/24", "10.0.0.5/24"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp CalculateResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %s", rec.Body.String())
+	}
+
+	v4 := resp.Results[0]
+	want := &SubnetDetailsJSON{
+		Address: "10.0.0.0", Netmask: "255.255.255.0", Wildcard: "0.0.0.255", Network: "10.0.0.0/24",
+		Type: "IPv4", Broadcast: "10.0.0.255", HostMin: "10.0.0.1", HostMax: "10.0.0.254",
+		HostsPerNet: 254, HostCount: "254", IsPublic: false,
+	}
+	if v4.CIDR != "10.0.0.0/24" || v4.Error != "" || !reflect.DeepEqual(v4.Details, want) {
+		t.Errorf("Expected details %+v, got %+v (%s)", want, v4.Details, v4.Error)
+	}
+
+	v6 := resp.Results[1]
+	if v6.Error != "" || v6.Details == nil || v6.Details.Type != "IPv6" || v6.Details.Address != "2001:db8::" || v6.Details.HostMin != "2001:db8::" {
+		t.Errorf("Expected IPv6 details, got %+v (%s)", v6.Details, v6.Error)
+	}
+
+	for _, invalid := range resp.Results[2:] {
+		if invalid.Details != nil || !strings.Contains(invalid.Error, "invalid CIDR") {
+			t.Errorf("%s: expected a validation error, got %+v", invalid.CIDR, invalid)
+		}
+	}
+
+	for _, body := range []string{`{"cidrs": []}`, `not json`} {
+		if rec := doRequest(handler, http.MethodPost, "/api/v1/calculate", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	var list ListSubnetsResponseJSON
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || list.TotalCount != 0 {
+		t.Errorf("Expected calculating to store nothing, got %s", rec.Body.String())
+	}
+}
+
+func TestGetSubnetInclude(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	parentID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.40.0.0/16", "name": "Parent"}`))
+	childID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets",
+		`{"cidr": "10.40.1.0/24", "name": "Child", "parent_id": "`+parentID+`"}`))
+	peerID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.41.0.0/16", "name": "Peer"}`))
+	for _, pair := range [][2]string{{parentID, peerID}, {peerID, parentID}} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/connections",
+			`{"source_subnet_id": "`+pair[0]+`", "target_subnet_id": "`+pair[1]+`", "connection_type": "vpc_peering", "name": "Peering"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	getFields := func(t *testing.T, query string) map[string]json.RawMessage {
+		t.Helper()
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+parentID+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		return fields
+	}
+
+	base := getFields(t, "")
+	if _, ok := base["children"]; ok {
+		t.Error("Expected no children without include")
+	}
+	if _, ok := base["connections"]; ok {
+		t.Error("Expected no connections without include")
+	}
+
+	t.Run("children", func(t *testing.T) {
+		fields := getFields(t, "?include=children")
+		var children []*SubnetJSON
+		if err := json.Unmarshal(fields["children"], &children); err != nil {
+			t.Fatalf("Failed to decode children: %v", err)
+		}
+		if len(children) != 1 || children[0].ID != childID {
+			t.Errorf("Expected the direct child, got %s", fields["children"])
+		}
+		if _, ok := fields["connections"]; ok {
+			t.Error("Expected no connections when only children are included")
+		}
+
+		// The subnet itself is unchanged by the include
+		delete(fields, "children")
+		if len(fields) != len(base) {
+			t.Errorf("Expected the base fields %d, got %d", len(base), len(fields))
+		}
+		for key, value := range base {
+			if string(fields[key]) != string(value) {
+				t.Errorf("Expected %s to be %s, got %s", key, value, fields[key])
+			}
+		}
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		fields := getFields(t, "?include=connections")
+		var connections []*ConnectionJSON
+		if err := json.Unmarshal(fields["connections"], &connections); err != nil {
+			t.Fatalf("Failed to decode connections: %v", err)
+		}
+		if len(connections) != 2 {
+			t.Errorf("Expected the connections from and to the subnet, got %s", fields["connections"])
+		}
+		if _, ok := fields["children"]; ok {
+			t.Error("Expected no children when only connections are included")
+		}
+	})
+
+	t.Run("both", func(t *testing.T) {
+		fields := getFields(t, "?include=children,connections")
+		if _, ok := fields["children"]; !ok {
+			t.Error("Expected children")
+		}
+		if _, ok := fields["connections"]; !ok {
+			t.Error("Expected connections")
+		}
+	})
+
+	t.Run("empty includes are arrays", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+childID+"?include=children&include=connections", "")
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		if string(fields["children"]) != "[]" || string(fields["connections"]) != "[]" {
+			t.Errorf("Expected empty arrays, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("unknown include", func(t *testing.T) {
+		if rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+parentID+"?include=notes", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unsupported include, got %d", rec.Code)
+		}
+	})
+}
+
+func TestCreateDuplicateConnection(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	sourceID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.54.0.0/16", "name": "Source"}`))
+	targetID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.55.0.0/16", "name": "Target"}`))
+	connect := func(connectionType string) *httptest.ResponseRecorder {
+		return doRequest(handler, http.MethodPost, "/api/v1/connections",
+			`{"source_subnet_id": "`+sourceID+`", "target_subnet_id": "`+targetID+`", "connection_type": "`+connectionType+`", "name": "Link"}`)
+	}
+
+	if rec := connect("vpn_site_to_site"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := connect("vpn_site_to_site"); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "DUPLICATE_CONNECTION") {
+		t.Errorf("Expected 409 DUPLICATE_CONNECTION, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := connect("firewall"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected a connection of another type to be created, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListSubnetConnections(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	create := func(cidr string) string {
+		t.Helper()
+		return extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "`+cidr+`", "name": "Subnet"}`))
+	}
+	hubID, spokeID, edgeID, otherID := create("10.50.0.0/16"), create("10.51.0.0/16"), create("10.52.0.0/16"), create("10.53.0.0/16")
+	connect := func(source, target string) string {
+		t.Helper()
+		rec := doRequest(handler, http.MethodPost, "/api/v1/connections",
+			`{"source_subnet_id": "`+source+`", "target_subnet_id": "`+target+`", "connection_type": "vpc_peering", "name": "Peering"}`)
+		return extractID(t, rec)
+	}
+	outgoingID := connect(hubID, spokeID)
+	incomingID := connect(edgeID, hubID)
+	connect(spokeID, otherID)
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+hubID+"/connections", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result SubnetConnectionsResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+
+	directions := make(map[string]string)
+	for _, connection := range result.Connections {
+		directions[connection.ID] = connection.Direction
+	}
+	if want := map[string]string{outgoingID: "source", incomingID: "target"}; !reflect.DeepEqual(directions, want) || result.TotalCount != 2 {
+		t.Errorf("Expected connections %v, got %v (total %d)", want, directions, result.TotalCount)
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/"+otherID+"/connections", "")
+	if !strings.Contains(rec.Body.String(), `"direction":"target"`) {
+		t.Errorf("Expected the other subnet to be the target of one connection, got %s", rec.Body.String())
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/missing/connections", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestValidateTiling(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+	parentID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.86.0.0/24", "name": "Plan"}`))
+
+	validate := func(body string) (*httptest.ResponseRecorder, *TilingValidationJSON) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+parentID+"/validate-tiling", body)
+		var result TilingValidationJSON
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+		}
+		return rec, &result
+	}
+
+	if rec, result := validate(`{"cidrs": ["10.86.0.0/25", "10.86.0.128/25"]}`); rec.Code != http.StatusOK || !result.Valid {
+		t.Errorf("Expected a valid tiling, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec, result := validate(`{"cidrs": ["10.86.0.0/25", "10.86.0.64/26", "10.86.0.192/26"]}`)
+	if rec.Code != http.StatusOK || result.Valid {
+		t.Fatalf("Expected an invalid tiling, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !reflect.DeepEqual(result.Gaps, []string{"10.86.0.128/26"}) || len(result.Overlaps) != 1 || result.Overlaps[0].Overlap != "10.86.0.64/26" {
+		t.Errorf("Expected the gap 10.86.0.128/26 and the overlap 10.86.0.64/26, got %s", rec.Body.String())
+	}
+
+	if rec, _ := validate(`{"cidrs": ["10.86.0.0/33"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid CIDR, got %d", rec.Code)
+	}
+	if rec, _ := validate(`{"cidrs": []}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without CIDRs, got %d", rec.Code)
+	}
+	rec = doRequest(handler, http.MethodPost, "/api/v1/subnets/missing/validate-tiling", `{"cidrs": ["10.0.0.0/24"]}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d", rec.Code)
+	}
+}
+
+func TestUtilizationHistory(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+	subnetID := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.87.0.0/24", "name": "Trend"}`))
+
+	for i := 0; i < 3; i++ {
+		if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/"+subnetID+"/allocations", `{}`); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+subnetID+"/utilization/history?from=2020-01-01T00:00:00Z", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var history UtilizationHistoryResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if len(history.Samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %s", rec.Body.String())
+	}
+	for i, sample := range history.Samples {
+		if sample.AllocatedIPs != int32(i+1) || sample.TotalIPs != 254 {
+			t.Errorf("Sample %d: expected %d of 254 allocated, got %+v", i, i+1, sample)
+		}
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/"+subnetID+"/utilization/history?to=2020-01-01T00:00:00Z", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "recorded_at") {
+		t.Errorf("Expected no samples before 2020, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, query := range []string{"?from=yesterday", "?from=200&to=100"} {
+		rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/"+subnetID+"/utilization/history"+query, "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+
+	rec = doRequest(handler, http.MethodGet, "/api/v1/subnets/missing/utilization/history", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d", rec.Code)
+	}
+}
+
+func TestCreateSubnetSkipDetails(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	decode := func(t *testing.T, rec *httptest.ResponseRecorder) *SubnetJSON {
+		t.Helper()
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var subnet SubnetJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &subnet); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		return &subnet
+	}
+
+	t.Run("details are calculated by default", func(t *testing.T) {
+		subnet := decode(t, doRequest(handler, http.MethodPost, "/api/v1/subnets",
+			`{"cidr": "10.80.0.0/24", "name": "Calculated", "details": {"netmask": "255.0.0.0"}}`))
+		if subnet.Details == nil || subnet.Details.Netmask != "255.255.255.0" || subnet.Details.HostsPerNet != 254 {
+			t.Errorf("Expected calculated details, got %+v", subnet.Details)
+		}
+	})
+
+	t.Run("provided details are stored as-is", func(t *testing.T) {
+		subnet := decode(t, doRequest(handler, http.MethodPost, "/api/v1/subnets?skip_details=true",
+			`{"cidr": "10.81.0.0/24", "name": "Provided", "details": {"address": "10.81.0.0", "netmask": "255.255.255.0", "hosts_per_net": 250}}`))
+		if subnet.Details == nil || subnet.Details.HostsPerNet != 250 || subnet.Details.HostMin != "" {
+			t.Errorf("Expected the provided details, got %+v", subnet.Details)
+		}
+	})
+
+	t.Run("bulk creates leave details empty", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets/bulk?skip_details=true",
+			`[{"cidr": "10.82.0.0/24", "name": "Bulk"}]`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(handler, http.MethodGet, "/api/v1/subnets?cidr_prefix=10.82.0.0/24", "")
+		var list ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		if len(list.Subnets) != 1 {
+			t.Fatalf("Expected the bulk created subnet, got %s", rec.Body.String())
+		}
+		if details := list.Subnets[0].Details; details != nil && (details.Netmask != "" || details.HostsPerNet != 0) {
+			t.Errorf("Expected empty details, got %+v", details)
+		}
+	})
+
+	if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets?skip_details=maybe", `{"cidr": "10.83.0.0/24", "name": "Invalid"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid skip_details, got %d", rec.Code)
+	}
+}
+
+func TestCreateSubnetTTL(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	before := time.Now().Add(2 * time.Hour).Unix()
+	rec := doRequest(handler, http.MethodPost, "/api/v1/subnets?ttl=2h", `{"cidr": "10.84.0.0/24", "name": "Temporary"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var subnet SubnetJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &subnet); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if subnet.ExpiresAt < before || subnet.ExpiresAt > time.Now().Add(2*time.Hour).Unix() {
+		t.Errorf("Expected expires_at two hours from now, got %d", subnet.ExpiresAt)
+	}
+
+	for _, ttl := range []string{"soon", "-1h", "0s"} {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets?ttl="+ttl, `{"cidr": "10.85.0.0/24", "name": "Invalid"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for ttl %q, got %d", ttl, rec.Code)
+		}
+	}
+}
+
+func TestCreateSubnetIdempotencyKey(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subnets", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	payload := `{"cidr": "10.90.0.0/24", "name": "Idempotent", "location": "eu-west"}`
+	first := post("create-1", payload)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", first.Code, first.Body.String())
+	}
+	firstID := extractID(t, first)
+
+	second := post("create-1", payload)
+	if second.Code != http.StatusOK {
+		t.Fatalf("Expected the retry to return 200, got %d: %s", second.Code, second.Body.String())
+	}
+	if id := extractID(t, second); id != firstID {
+		t.Errorf("Expected the retry to return subnet %s, got %s", firstID, id)
+	}
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets?cidr_prefix=10.90.0.0/24", "")
+	var list ListSubnetsResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if list.TotalCount != 1 {
+		t.Errorf("Expected one subnet to be created, got %d", list.TotalCount)
+	}
+
+	if rec := post("create-2", `{"cidr": "10.91.0.0/24", "name": "Other", "location": "eu-west"}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected another key to create, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := post(strings.Repeat("k", maxIdempotencyKeyLength+1), payload); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an oversized key to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestRequestBodyLimits(t *testing.T) {
+	errorCode := func(t *testing.T, rec *httptest.ResponseRecorder) string {
+		t.Helper()
+		var body ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error == nil {
+			t.Fatalf("Expected an error body, got %s", rec.Body.String())
+		}
+		return body.Error.Code
+	}
+
+	cfg := &config.Config{Server: config.ServerConfig{MaxRequestBodyBytes: 1024}}
+	handler := NewGatewayWithConfig(newTestServiceLayer(t), nil, cfg).Handler()
+	oversized := `{"cidr": "10.70.0.0/24", "name": "` + strings.Repeat("x", 2048) + `"}`
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/subnets"},
+		{http.MethodPut, "/api/v1/subnets/some-id"},
+		{http.MethodPost, "/api/v1/cloud/sync"},
+	} {
+		rec := doRequest(handler, tt.method, tt.path, oversized)
+		if rec.Code != http.StatusRequestEntityTooLarge || errorCode(t, rec) != "REQUEST_TOO_LARGE" {
+			t.Errorf("%s %s: expected 413 REQUEST_TOO_LARGE, got %d: %s", tt.method, tt.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.70.0.0/24", "name": "Small"}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected a body under the limit to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	t.Run("unknown fields are ignored by default", func(t *testing.T) {
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.71.0.0/24", "name": "Lenient", "colour": "blue"}`)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("strict JSON rejects unknown fields", func(t *testing.T) {
+		strict := &config.Config{Server: config.ServerConfig{StrictJSON: true}}
+		handler := NewGatewayWithConfig(newTestServiceLayer(t), nil, strict).Handler()
+
+		rec := doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.72.0.0/24", "name": "Strict", "colour": "blue"}`)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "UNKNOWN_FIELD" {
+			t.Errorf("Expected 400 UNKNOWN_FIELD, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		id := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.72.0.0/24", "name": "Strict"}`))
+		rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+id, `{"name": "Renamed", "colour": "blue"}`)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "UNKNOWN_FIELD" {
+			t.Errorf("Expected 400 UNKNOWN_FIELD on update, got %d: %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(handler, http.MethodPut, "/api/v1/subnets/"+id+"?force=maybe", `{"name": "Renamed", "colour": "blue"}`)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "UNKNOWN_FIELD" {
+			t.Errorf("Expected the body to be rejected before the query, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestRenumberSubnet(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	create := func(body string) string {
+		t.Helper()
+		return extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+	}
+	parentID := create(`{"cidr": "10.0.0.0/16", "name": "Parent", "location": "eu-west"}`)
+	firstID := create(`{"cidr": "10.0.1.0/24", "name": "First", "location": "eu-west", "parent_id": "` + parentID + `",
+		"dhcp_range_start": "10.0.1.10", "dhcp_range_end": "10.0.1.99"}`)
+	secondID := create(`{"cidr": "10.0.128.0/20", "name": "Second", "location": "eu-west", "parent_id": "` + parentID + `"}`)
+	create(`{"cidr": "10.20.0.0/16", "name": "Neighbour", "location": "eu-west"}`)
+	create(`{"cidr": "10.30.5.0/24", "name": "Island", "location": "eu-west"}`)
+
+	renumber := func(id, cidr string) *httptest.ResponseRecorder {
+		return doRequest(handler, http.MethodPost, "/api/v1/subnets/"+id+"/renumber", `{"cidr": "`+cidr+`"}`)
+	}
+
+	for _, tc := range []struct {
+		cidr string
+		code string
+	}{
+		{"10.10.0.0/20", "INVALID_RENUMBER"},
+		{"10.0.0.0/16", "INVALID_RENUMBER"},
+		{"10.10.0.1/16", "INVALID_CIDR"},
+		{"10.20.0.0/16", "DUPLICATE_SUBNET"},
+		{"10.30.0.0/16", "OVERLAPPING_CIDR"},
+	} {
+		rec := renumber(parentID, tc.cidr)
+		if !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("Renumbering to %s: expected %s, got %d: %s", tc.cidr, tc.code, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := renumber(parentID, "10.10.0.0/16")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result RenumberSubnetResponseJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if result.Count != 3 {
+		t.Errorf("Expected the parent and two children to be renumbered, got %d", result.Count)
+	}
+
+	for id, want := range map[string]string{
+		parentID: "10.10.0.0/16",
+		firstID:  "10.10.1.0/24",
+		secondID: "10.10.128.0/20",
+	} {
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id, "")
+		var subnet SubnetJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &subnet); err != nil {
+			t.Fatalf("Failed to get subnet %s: %d %s", id, rec.Code, rec.Body.String())
+		}
+		if subnet.CIDR != want {
+			t.Errorf("Expected subnet %s to be renumbered to %s, got %s", id, want, subnet.CIDR)
+		}
+		if subnet.Details == nil || subnet.Details.Network != want {
+			t.Errorf("Expected the details of %s to be recalculated, got %+v", id, subnet.Details)
+		}
+		if id == firstID && (subnet.DHCPRangeStart != "10.10.1.10" || subnet.DHCPRangeEnd != "10.10.1.99") {
+			t.Errorf("Expected the DHCP range to move with the subnet, got %s-%s", subnet.DHCPRangeStart, subnet.DHCPRangeEnd)
+		}
+	}
+
+	if rec := renumber(secondID, "10.10.1.0/20"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a misaligned base to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := renumber(secondID, "10.20.16.0/20"); !strings.Contains(rec.Body.String(), "CHILD_NOT_CONTAINED") {
+		t.Errorf("Expected a base outside the parent to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := renumber("missing", "10.30.0.0/16"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGetSubnetSiblings(t *testing.T) {
+	handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+	create := func(body string) string {
+		t.Helper()
+		return extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", body))
+	}
+	parentID := create(`{"cidr": "10.0.0.0/16", "name": "Parent", "location": "eu-west"}`)
+	child := func(cidr string) string {
+		return create(`{"cidr": "` + cidr + `", "name": "Child", "location": "eu-west", "parent_id": "` + parentID + `"}`)
+	}
+	firstID := child("10.0.1.0/24")
+	child("10.0.2.0/24")
+	child("10.0.3.0/24")
+	child("10.0.4.0/24")
+	otherID := create(`{"cidr": "10.1.0.0/16", "name": "Other", "location": "eu-west"}`)
+	create(`{"cidr": "10.1.1.0/24", "name": "Cousin", "location": "eu-west", "parent_id": "` + otherID + `"}`)
+
+	siblings := func(id, query string) ListSubnetsResponseJSON {
+		t.Helper()
+		rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/"+id+"/siblings"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result ListSubnetsResponseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		return result
+	}
+	cidrs := func(subnets []*SubnetJSON) []string {
+		var out []string
+		for _, subnet := range subnets {
+			out = append(out, subnet.CIDR)
+		}
+		return out
+	}
+
+	result := siblings(firstID, "")
+	if want := []string{"10.0.2.0/24", "10.0.3.0/24", "10.0.4.0/24"}; !reflect.DeepEqual(cidrs(result.Subnets), want) || result.TotalCount != 3 {
+		t.Errorf("Expected siblings %v, got %v (total %d)", want, cidrs(result.Subnets), result.TotalCount)
+	}
+
+	result = siblings(firstID, "?page=1&page_size=2")
+	if want := []string{"10.0.4.0/24"}; !reflect.DeepEqual(cidrs(result.Subnets), want) || result.TotalCount != 3 {
+		t.Errorf("Expected second page %v, got %v (total %d)", want, cidrs(result.Subnets), result.TotalCount)
+	}
+
+	// Top-level subnets are siblings of each other
+	result = siblings(parentID, "")
+	if want := []string{"10.1.0.0/16"}; !reflect.DeepEqual(cidrs(result.Subnets), want) {
+		t.Errorf("Expected top-level siblings %v, got %v", want, cidrs(result.Subnets))
+	}
+
+	rec := doRequest(handler, http.MethodGet, "/api/v1/subnets/missing/siblings", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown subnet, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestEmptyListsSerializeAsArrays(t *testing.T) {
+	t.Run("converters", func(t *testing.T) {
+		for name, value := range map[string]interface{}{
+			"subnets":            SubnetsToJSON(nil),
+			"repository subnets": RepositorySubnetsToJSON(nil),
+			"connections":        RepositoryConnectionsToJSON(nil),
+			"notes":              RepositoryNotesToJSON(nil),
+			"allocations":        RepositoryAllocationsToJSON(nil),
+			"reservations":       RepositoryReservationsToJSON(nil),
+			"passed through":     emptyIfNil[string](nil),
+		} {
+			body, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("Failed to encode %s: %v", name, err)
+			}
+			if string(body) != "[]" {
+				t.Errorf("Expected empty %s to encode as [], got %s", name, body)
+			}
+		}
+	})
+
+	t.Run("endpoints", func(t *testing.T) {
+		handler := NewGateway(newTestServiceLayer(t), nil).Handler()
+
+		get := func(path, want string) {
+			t.Helper()
+			rec := doRequest(handler, http.MethodGet, path, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200 for %s, got %d: %s", path, rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), want) || strings.Contains(rec.Body.String(), "null") {
+				t.Errorf("Expected %s in %s, got %s", want, path, rec.Body.String())
+			}
+		}
+
+		get("/api/v1/subnets", `"subnets":[]`)
+		get("/api/v1/connections", `"connections":[]`)
+
+		id := extractID(t, doRequest(handler, http.MethodPost, "/api/v1/subnets", `{"cidr": "10.88.0.0/24", "name": "Leaf"}`))
+		get("/api/v1/subnets?location=missing", `"subnets":[]`)
+		get("/api/v1/subnets/"+id+"/children", `"children":[]`)
+		get("/api/v1/subnets/"+id+"/siblings", `"subnets":[]`)
+		get("/api/v1/subnets/"+id+"/connections", `"connections":[]`)
+		get("/api/v1/subnets/"+id+"/reservations", `"reservations":[]`)
+		get("/api/v1/subnets/"+id+"?include=children,connections", `"children":[],"connections":[]`)
+	})
+}
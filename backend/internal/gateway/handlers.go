@@ -69,7 +69,7 @@ func (g *RESTGateway) handleCreateSubnet(w http.ResponseWriter, r *http.Request)
 
 	// Convert response to JSON and send
 	jsonSubnet := SubnetToJSON(resp.Subnet)
-	g.writeJSON(w, http.StatusCreated, jsonSubnet)
+	g.writeCreated(w, resourcePath("subnets", resp.Subnet.Id), jsonSubnet)
 }
 
 // handleListSubnets handles GET /api/v1/subnets
@@ -165,14 +165,14 @@ func (g *RESTGateway) handleUpdateSubnet(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Convert JSON to Protobuf request
-	req, err := JSONToUpdateSubnetRequest(id, body)
+	req, opts, err := JSONToUpdateSubnetRequest(id, body)
 	if err != nil {
 		g.writeError(w, http.StatusBadRequest, "INVALID_MESSAGE_FORMAT", err.Error())
 		return
 	}
 
 	// Call service layer
-	resp, err := g.serviceLayer.UpdateSubnet(r.Context(), req)
+	resp, err := g.serviceLayer.UpdateSubnetWithOptions(r.Context(), req, opts)
 	if err != nil {
 		g.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
@@ -0,0 +1,195 @@
+// Package metrics exposes IPAM inventory and request metrics in Prometheus format
+package metrics
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "ipam"
+
+	// inventoryPageSize is large enough to read the whole inventory in one query
+	inventoryPageSize = 1000000
+
+	// refreshTimeout bounds the inventory queries run on each scrape
+	refreshTimeout = 10 * time.Second
+)
+
+// Inventory is the subset of the service layer used to compute inventory gauges
+type Inventory interface {
+	ListSubnetsRepository(ctx context.Context, filters repository.SubnetFilters) (*repository.SubnetList, error)
+	ListConnections(ctx context.Context, filters repository.ConnectionFilters) (*repository.ConnectionList, error)
+}
+
+// Metrics holds the collectors exposed on the /metrics endpoint
+type Metrics struct {
+	registry     *prometheus.Registry
+	httpRequests *prometheus.CounterVec
+	cloudSyncs   *prometheus.CounterVec
+
+	cloudSyncFailures *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them on a dedicated registry. The
+// inventory gauges are refreshed from inventory each time the registry is scraped.
+func New(inventory Inventory) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests by route and status code.",
+		}, []string{"handler", "code"}),
+		cloudSyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cloud_sync_total",
+			Help:      "Total number of cloud provider synchronizations by provider and result.",
+		}, []string{"provider", "result"}),
+		cloudSyncFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cloud_sync_resource_failures_total",
+			Help:      "Total number of resources cloud provider synchronizations failed to store, by provider.",
+		}, []string{"provider"}),
+	}
+
+	m.registry.MustRegister(m.httpRequests, m.cloudSyncs, m.cloudSyncFailures, newInventoryCollector(inventory))
+	return m
+}
+
+// Handler returns the HTTP handler serving the registry in Prometheus format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest counts a completed HTTP request
+func (m *Metrics) ObserveRequest(handler string, code int) {
+	m.httpRequests.WithLabelValues(handler, strconv.Itoa(code)).Inc()
+}
+
+// ObserveCloudSync counts a cloud provider synchronization as a success, a
+// failure, or partial when it completed but failed to store some resources
+func (m *Metrics) ObserveCloudSync(provider string, failed int, err error) {
+	result := "success"
+	switch {
+	case err != nil:
+		result = "failure"
+	case failed > 0:
+		result = "partial"
+	}
+	m.cloudSyncs.WithLabelValues(provider, result).Inc()
+	if failed > 0 {
+		m.cloudSyncFailures.WithLabelValues(provider).Add(float64(failed))
+	}
+}
+
+// inventorySnapshot is the last successfully computed set of inventory values
+type inventorySnapshot struct {
+	subnets         int
+	byCloudProvider map[string]int
+	byLocationType  map[string]int
+	connections     int
+}
+
+// inventoryCollector computes the subnet and connection gauges lazily on scrape
+type inventoryCollector struct {
+	inventory Inventory
+
+	subnetsDesc         *prometheus.Desc
+	byCloudProviderDesc *prometheus.Desc
+	byLocationTypeDesc  *prometheus.Desc
+	connectionsDesc     *prometheus.Desc
+
+	mu       sync.Mutex
+	snapshot inventorySnapshot
+}
+
+func newInventoryCollector(inventory Inventory) *inventoryCollector {
+	return &inventoryCollector{
+		inventory: inventory,
+		subnetsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "subnets"),
+			"Total number of subnets.", nil, nil),
+		byCloudProviderDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "subnets_by_cloud_provider"),
+			"Number of subnets by cloud provider.", []string{"provider"}, nil),
+		byLocationTypeDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "subnets_by_location_type"),
+			"Number of subnets by location type.", []string{"location_type"}, nil),
+		connectionsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "connections"),
+			"Total number of connections.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.subnetsDesc
+	ch <- c.byCloudProviderDesc
+	ch <- c.byLocationTypeDesc
+	ch <- c.connectionsDesc
+}
+
+// Collect implements prometheus.Collector. When the inventory cannot be read
+// the values from the previous successful scrape are reported again.
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if snapshot, err := c.load(); err != nil {
+		log.Printf("Failed to refresh inventory metrics, keeping stale values: %v", err)
+	} else {
+		c.snapshot = snapshot
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.subnetsDesc, prometheus.GaugeValue, float64(c.snapshot.subnets))
+	for provider, count := range c.snapshot.byCloudProvider {
+		ch <- prometheus.MustNewConstMetric(c.byCloudProviderDesc, prometheus.GaugeValue, float64(count), provider)
+	}
+	for locationType, count := range c.snapshot.byLocationType {
+		ch <- prometheus.MustNewConstMetric(c.byLocationTypeDesc, prometheus.GaugeValue, float64(count), locationType)
+	}
+	ch <- prometheus.MustNewConstMetric(c.connectionsDesc, prometheus.GaugeValue, float64(c.snapshot.connections))
+}
+
+// load reads the current inventory counts
+func (c *inventoryCollector) load() (inventorySnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	subnets, err := c.inventory.ListSubnetsRepository(ctx, repository.SubnetFilters{PageSize: inventoryPageSize})
+	if err != nil {
+		return inventorySnapshot{}, err
+	}
+
+	connections, err := c.inventory.ListConnections(ctx, repository.ConnectionFilters{PageSize: inventoryPageSize})
+	if err != nil {
+		return inventorySnapshot{}, err
+	}
+
+	snapshot := inventorySnapshot{
+		subnets:         int(subnets.TotalCount),
+		byCloudProvider: make(map[string]int),
+		byLocationType:  make(map[string]int),
+		connections:     int(connections.TotalCount),
+	}
+	for _, subnet := range subnets.Subnets {
+		provider := "none"
+		if subnet.CloudInfo != nil && subnet.CloudInfo.Provider != "" {
+			provider = subnet.CloudInfo.Provider
+		}
+		snapshot.byCloudProvider[provider]++
+
+		locationType := subnet.LocationType
+		if locationType == "" {
+			locationType = "unknown"
+		}
+		snapshot.byLocationType[locationType]++
+	}
+
+	return snapshot, nil
+}
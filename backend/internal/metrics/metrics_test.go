@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+// fakeInventory serves a fixed inventory, or err when set
+type fakeInventory struct {
+	subnets     []*repository.Subnet
+	connections int32
+	err         error
+}
+
+func (f *fakeInventory) ListSubnetsRepository(ctx context.Context, filters repository.SubnetFilters) (*repository.SubnetList, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &repository.SubnetList{Subnets: f.subnets, TotalCount: int32(len(f.subnets))}, nil
+}
+
+func (f *fakeInventory) ListConnections(ctx context.Context, filters repository.ConnectionFilters) (*repository.ConnectionList, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &repository.ConnectionList{TotalCount: f.connections}, nil
+}
+
+// scrape returns the text exposition of m
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func assertContains(t *testing.T, body string, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	inventory := &fakeInventory{
+		subnets: []*repository.Subnet{
+			{ID: "1", LocationType: "CLOUD", CloudInfo: &repository.CloudInfo{Provider: "aws"}},
+			{ID: "2", LocationType: "CLOUD", CloudInfo: &repository.CloudInfo{Provider: "aws"}},
+			{ID: "3", LocationType: "DATACENTER"},
+		},
+		connections: 2,
+	}
+	m := New(inventory)
+
+	m.ObserveRequest("/api/v1/subnets/{id}", http.StatusOK)
+	m.ObserveRequest("/api/v1/subnets/{id}", http.StatusOK)
+	m.ObserveRequest("/api/v1/subnets/{id}", http.StatusNotFound)
+	m.ObserveCloudSync("aws", 0, nil)
+	m.ObserveCloudSync("aws", 0, errors.New("throttled"))
+	m.ObserveCloudSync("aws", 2, nil)
+
+	assertContains(t, scrape(t, m),
+		`ipam_subnets 3`,
+		`ipam_subnets_by_cloud_provider{provider="aws"} 2`,
+		`ipam_subnets_by_cloud_provider{provider="none"} 1`,
+		`ipam_subnets_by_location_type{location_type="CLOUD"} 2`,
+		`ipam_subnets_by_location_type{location_type="DATACENTER"} 1`,
+		`ipam_connections 2`,
+		`ipam_http_requests_total{code="200",handler="/api/v1/subnets/{id}"} 2`,
+		`ipam_http_requests_total{code="404",handler="/api/v1/subnets/{id}"} 1`,
+		`ipam_cloud_sync_total{provider="aws",result="success"} 1`,
+		`ipam_cloud_sync_total{provider="aws",result="failure"} 1`,
+		`ipam_cloud_sync_total{provider="aws",result="partial"} 1`,
+		`ipam_cloud_sync_resource_failures_total{provider="aws"} 2`,
+	)
+
+	t.Run("keeps stale values when the inventory query fails", func(t *testing.T) {
+		inventory.subnets = nil
+		inventory.err = errors.New("database is locked")
+
+		assertContains(t, scrape(t, m),
+			`ipam_subnets 3`,
+			`ipam_subnets_by_cloud_provider{provider="aws"} 2`,
+			`ipam_connections 2`,
+		)
+	})
+}
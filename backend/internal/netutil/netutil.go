@@ -0,0 +1,23 @@
+// Package netutil holds address helpers shared by the cloud provider syncs
+package netutil
+
+import (
+	"log"
+	"net/netip"
+)
+
+// NormalizeCIDR masks a CIDR reported by a cloud provider to its network
+// address, the form subnet validation requires, and logs when host bits were
+// set. A CIDR that does not parse is returned unchanged so storing it fails
+// and is reported like any other invalid resource.
+func NormalizeCIDR(provider, resourceID, cidr string) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr
+	}
+	normalized := prefix.Masked().String()
+	if normalized != cidr {
+		log.Printf("Normalized %s resource %s CIDR %s to its network address %s", provider, resourceID, cidr, normalized)
+	}
+	return normalized
+}
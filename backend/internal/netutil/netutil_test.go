@@ -0,0 +1,17 @@
+package netutil
+
+import "testing"
+
+func TestNormalizeCIDR(t *testing.T) {
+	tests := []struct{ cidr, want string }{
+		{"10.0.0.0/24", "10.0.0.0/24"},
+		{"10.0.0.5/24", "10.0.0.0/24"},
+		{"2001:db8::1/64", "2001:db8::/64"},
+		{"not-a-cidr", "not-a-cidr"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeCIDR("aws", "resource", tt.cidr); got != tt.want {
+			t.Errorf("NormalizeCIDR(%q) = %q, want %q", tt.cidr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// encryptedValuePrefix marks tag values stored as ciphertext, so values written
+// before a key was designated for encryption are still read as plaintext
+const encryptedValuePrefix = "enc:v1:"
+
+// FieldEncryptor encrypts the values of designated tag keys with AES-GCM
+type FieldEncryptor struct {
+	aead cipher.AEAD
+	keys map[string]bool
+}
+
+// NewFieldEncryptor creates an encryptor for the given tag keys. key is the
+// base64 encoding of a 16, 24 or 32 byte AES key.
+func NewFieldEncryptor(key string, tagKeys []string) (*FieldEncryptor, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64 encoded: %w", err)
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	keys := make(map[string]bool, len(tagKeys))
+	for _, tagKey := range tagKeys {
+		keys[tagKey] = true
+	}
+
+	return &FieldEncryptor{aead: aead, keys: keys}, nil
+}
+
+// EncryptTags returns a copy of tags with the designated values encrypted
+func (e *FieldEncryptor) EncryptTags(tags map[string]string) (map[string]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	encrypted := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if !e.keys[key] || strings.HasPrefix(value, encryptedValuePrefix) {
+			encrypted[key] = value
+			continue
+		}
+
+		nonce := make([]byte, e.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		// The tag key is authenticated so a value cannot be moved to another key
+		sealed := e.aead.Seal(nonce, nonce, []byte(value), []byte(key))
+		encrypted[key] = encryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+
+	return encrypted, nil
+}
+
+// DecryptTags returns a copy of tags with every encrypted value decrypted
+func (e *FieldEncryptor) DecryptTags(tags map[string]string) (map[string]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	decrypted := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if !strings.HasPrefix(value, encryptedValuePrefix) {
+			decrypted[key] = value
+			continue
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedValuePrefix))
+		if err != nil || len(sealed) < e.aead.NonceSize() {
+			return nil, fmt.Errorf("malformed encrypted value for tag %q", key)
+		}
+		nonce, ciphertext := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+		plaintext, err := e.aead.Open(nil, nonce, ciphertext, []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt tag %q: %w", key, err)
+		}
+		decrypted[key] = string(plaintext)
+	}
+
+	return decrypted, nil
+}
+
+// encryptingRepository encrypts designated subnet tags before they reach the
+// wrapped repository and decrypts them on the way back
+type encryptingRepository struct {
+	SubnetRepository
+	encryptor *FieldEncryptor
+}
+
+// NewEncryptingRepository wraps repo so the tag keys designated in encryptor
+// are only ever stored as ciphertext. Tag filters cannot match encrypted values.
+func NewEncryptingRepository(repo SubnetRepository, encryptor *FieldEncryptor) SubnetRepository {
+	return &encryptingRepository{SubnetRepository: repo, encryptor: encryptor}
+}
+
+// encrypt returns a shallow copy of subnet with its tags encrypted, leaving the
+// caller's subnet in plaintext
+func (r *encryptingRepository) encrypt(subnet *Subnet) (*Subnet, error) {
+	tags, err := r.encryptor.EncryptTags(subnet.Tags)
+	if err != nil {
+		return nil, err
+	}
+	stored := *subnet
+	stored.Tags = tags
+	return &stored, nil
+}
+
+// decrypt replaces the tags of each subnet with their plaintext
+func (r *encryptingRepository) decrypt(subnets ...*Subnet) error {
+	for _, subnet := range subnets {
+		if subnet == nil {
+			continue
+		}
+		tags, err := r.encryptor.DecryptTags(subnet.Tags)
+		if err != nil {
+			return fmt.Errorf("subnet %s: %w", subnet.ID, err)
+		}
+		subnet.Tags = tags
+	}
+	return nil
+}
+
+func (r *encryptingRepository) CreateSubnet(ctx context.Context, subnet *Subnet) error {
+	stored, err := r.encrypt(subnet)
+	if err != nil {
+		return err
+	}
+	return r.SubnetRepository.CreateSubnet(ctx, stored)
+}
+
+func (r *encryptingRepository) BulkCreateSubnets(ctx context.Context, subnets []*Subnet) error {
+	stored := make([]*Subnet, len(subnets))
+	for i, subnet := range subnets {
+		var err error
+		if stored[i], err = r.encrypt(subnet); err != nil {
+			return &BulkCreateError{Index: i, CIDR: subnet.CIDR, Err: err}
+		}
+	}
+	return r.SubnetRepository.BulkCreateSubnets(ctx, stored)
+}
+
+func (r *encryptingRepository) UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error {
+	stored, err := r.encrypt(subnet)
+	if err != nil {
+		return err
+	}
+	return r.SubnetRepository.UpdateSubnet(ctx, id, stored)
+}
+
+func (r *encryptingRepository) GetSubnetByCIDR(ctx context.Context, cidr string) (*Subnet, error) {
+	subnet, err := r.SubnetRepository.GetSubnetByCIDR(ctx, cidr)
+	if err != nil {
+		return nil, err
+	}
+	return subnet, r.decrypt(subnet)
+}
+
+func (r *encryptingRepository) GetSubnetByID(ctx context.Context, id string) (*Subnet, error) {
+	subnet, err := r.SubnetRepository.GetSubnetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return subnet, r.decrypt(subnet)
+}
+
+func (r *encryptingRepository) ListSubnets(ctx context.Context, filters SubnetFilters) (*SubnetList, error) {
+	list, err := r.SubnetRepository.ListSubnets(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return list, r.decrypt(list.Subnets...)
+}
+
+func (r *encryptingRepository) GetSubnetChildren(ctx context.Context, parentID string) ([]*Subnet, error) {
+	children, err := r.SubnetRepository.GetSubnetChildren(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return children, r.decrypt(children...)
+}
+
+func (r *encryptingRepository) GetSubnetSiblings(ctx context.Context, id, parentID string, page, pageSize int32) (*SubnetList, error) {
+	list, err := r.SubnetRepository.GetSubnetSiblings(ctx, id, parentID, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return list, r.decrypt(list.Subnets...)
+}
+
+func (r *encryptingRepository) FindOverlappingSubnets(ctx context.Context, cidr, location string) ([]*Subnet, error) {
+	subnets, err := r.SubnetRepository.FindOverlappingSubnets(ctx, cidr, location)
+	if err != nil {
+		return nil, err
+	}
+	return subnets, r.decrypt(subnets...)
+}
+
+func (r *encryptingRepository) ListStaleCloudSubnets(ctx context.Context, seenBefore time.Time) ([]*Subnet, error) {
+	subnets, err := r.SubnetRepository.ListStaleCloudSubnets(ctx, seenBefore)
+	if err != nil {
+		return nil, err
+	}
+	return subnets, r.decrypt(subnets...)
+}
+
+func (r *encryptingRepository) ListExpiredSubnets(ctx context.Context, now time.Time) ([]*Subnet, error) {
+	subnets, err := r.SubnetRepository.ListExpiredSubnets(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	return subnets, r.decrypt(subnets...)
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memorySubnetStore keeps subnets exactly as written, exposing what the
+// wrapped repository would persist
+type memorySubnetStore struct {
+	SubnetRepository
+	subnets map[string]*Subnet
+}
+
+func (m *memorySubnetStore) CreateSubnet(ctx context.Context, subnet *Subnet) error {
+	stored := *subnet
+	m.subnets[subnet.ID] = &stored
+	return nil
+}
+
+func (m *memorySubnetStore) UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error {
+	if _, ok := m.subnets[id]; !ok {
+		return ErrNotFound
+	}
+	stored := *subnet
+	m.subnets[id] = &stored
+	return nil
+}
+
+func (m *memorySubnetStore) GetSubnetByID(ctx context.Context, id string) (*Subnet, error) {
+	subnet, ok := m.subnets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *subnet
+	return &found, nil
+}
+
+func (m *memorySubnetStore) ListSubnets(ctx context.Context, filters SubnetFilters) (*SubnetList, error) {
+	list := &SubnetList{}
+	for _, subnet := range m.subnets {
+		found := *subnet
+		list.Subnets = append(list.Subnets, &found)
+	}
+	list.TotalCount = int32(len(list.Subnets))
+	return list, nil
+}
+
+func (m *memorySubnetStore) ListStaleCloudSubnets(ctx context.Context, seenBefore time.Time) ([]*Subnet, error) {
+	list, err := m.ListSubnets(ctx, SubnetFilters{})
+	return list.Subnets, err
+}
+
+func (m *memorySubnetStore) ListExpiredSubnets(ctx context.Context, now time.Time) ([]*Subnet, error) {
+	list, err := m.ListSubnets(ctx, SubnetFilters{})
+	return list.Subnets, err
+}
+
+func testEncryptionKey() string {
+	return base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+}
+
+func TestEncryptingRepository(t *testing.T) {
+	ctx := context.Background()
+	store := &memorySubnetStore{subnets: make(map[string]*Subnet)}
+	encryptor, err := NewFieldEncryptor(testEncryptionKey(), []string{"contact_email"})
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	repo := NewEncryptingRepository(store, encryptor)
+
+	subnet := &Subnet{
+		ID:   "subnet-1",
+		CIDR: "10.0.0.0/24",
+		Tags: map[string]string{"contact_email": "ops@example.com", "team": "network"},
+	}
+	if err := repo.CreateSubnet(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	t.Run("stored value is ciphertext", func(t *testing.T) {
+		stored := store.subnets["subnet-1"].Tags
+		if !strings.HasPrefix(stored["contact_email"], encryptedValuePrefix) {
+			t.Errorf("Expected an encrypted value, got %q", stored["contact_email"])
+		}
+		if strings.Contains(stored["contact_email"], "ops@example.com") {
+			t.Errorf("Expected no plaintext in the stored value, got %q", stored["contact_email"])
+		}
+		if stored["team"] != "network" {
+			t.Errorf("Expected undesignated tags in plaintext, got %q", stored["team"])
+		}
+	})
+
+	t.Run("caller's subnet is not modified", func(t *testing.T) {
+		if subnet.Tags["contact_email"] != "ops@example.com" {
+			t.Errorf("Expected the caller's tags to stay plaintext, got %q", subnet.Tags["contact_email"])
+		}
+	})
+
+	t.Run("reads return plaintext", func(t *testing.T) {
+		found, err := repo.GetSubnetByID(ctx, "subnet-1")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if found.Tags["contact_email"] != "ops@example.com" || found.Tags["team"] != "network" {
+			t.Errorf("Expected decrypted tags, got %v", found.Tags)
+		}
+
+		list, err := repo.ListSubnets(ctx, SubnetFilters{})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		if len(list.Subnets) != 1 || list.Subnets[0].Tags["contact_email"] != "ops@example.com" {
+			t.Errorf("Expected decrypted tags in the list, got %+v", list.Subnets)
+		}
+
+		for name, listFn := range map[string]func(context.Context, time.Time) ([]*Subnet, error){
+			"stale cloud subnets": repo.ListStaleCloudSubnets,
+			"expired subnets":     repo.ListExpiredSubnets,
+		} {
+			subnets, err := listFn(ctx, time.Now())
+			if err != nil {
+				t.Fatalf("Failed to list %s: %v", name, err)
+			}
+			if len(subnets) != 1 || subnets[0].Tags["contact_email"] != "ops@example.com" {
+				t.Errorf("Expected decrypted tags in %s, got %+v", name, subnets)
+			}
+		}
+	})
+
+	t.Run("updates are encrypted", func(t *testing.T) {
+		update := &Subnet{ID: "subnet-1", CIDR: "10.0.0.0/24", Tags: map[string]string{"contact_email": "noc@example.com"}}
+		if err := repo.UpdateSubnet(ctx, "subnet-1", update); err != nil {
+			t.Fatalf("Failed to update subnet: %v", err)
+		}
+		if stored := store.subnets["subnet-1"].Tags["contact_email"]; !strings.HasPrefix(stored, encryptedValuePrefix) {
+			t.Errorf("Expected an encrypted value after update, got %q", stored)
+		}
+		found, err := repo.GetSubnetByID(ctx, "subnet-1")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if found.Tags["contact_email"] != "noc@example.com" {
+			t.Errorf("Expected the updated plaintext, got %q", found.Tags["contact_email"])
+		}
+	})
+
+	t.Run("plaintext written before encryption is still readable", func(t *testing.T) {
+		store.subnets["subnet-2"] = &Subnet{ID: "subnet-2", Tags: map[string]string{"contact_email": "legacy@example.com"}}
+		found, err := repo.GetSubnetByID(ctx, "subnet-2")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if found.Tags["contact_email"] != "legacy@example.com" {
+			t.Errorf("Expected the legacy plaintext, got %q", found.Tags["contact_email"])
+		}
+	})
+}
+
+func TestFieldEncryptor(t *testing.T) {
+	t.Run("invalid keys are rejected", func(t *testing.T) {
+		for _, key := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+			if _, err := NewFieldEncryptor(key, []string{"secret"}); err == nil {
+				t.Errorf("Expected an error for key %q", key)
+			}
+		}
+	})
+
+	t.Run("a different key cannot decrypt", func(t *testing.T) {
+		encryptor, err := NewFieldEncryptor(testEncryptionKey(), []string{"secret"})
+		if err != nil {
+			t.Fatalf("Failed to create encryptor: %v", err)
+		}
+		other, err := NewFieldEncryptor(base64.StdEncoding.EncodeToString([]byte("fedcba9876543210")), []string{"secret"})
+		if err != nil {
+			t.Fatalf("Failed to create encryptor: %v", err)
+		}
+
+		encrypted, err := encryptor.EncryptTags(map[string]string{"secret": "hunter2"})
+		if err != nil {
+			t.Fatalf("Failed to encrypt tags: %v", err)
+		}
+		if _, err := other.DecryptTags(encrypted); err == nil {
+			t.Error("Expected decryption with the wrong key to fail")
+		}
+	})
+
+	t.Run("values cannot be moved between keys", func(t *testing.T) {
+		encryptor, err := NewFieldEncryptor(testEncryptionKey(), []string{"secret", "other"})
+		if err != nil {
+			t.Fatalf("Failed to create encryptor: %v", err)
+		}
+		encrypted, err := encryptor.EncryptTags(map[string]string{"secret": "hunter2"})
+		if err != nil {
+			t.Fatalf("Failed to encrypt tags: %v", err)
+		}
+		if _, err := encryptor.DecryptTags(map[string]string{"other": encrypted["secret"]}); err == nil {
+			t.Error("Expected a value moved to another key to fail authentication")
+		}
+	})
+}
@@ -10,9 +10,16 @@ import (
 func NewRepository(cfg *config.DatabaseConfig) (SubnetRepository, error) {
 	switch cfg.Type {
 	case "sqlite":
-		return NewSQLiteRepository(cfg.Path)
+		return NewSQLiteRepositoryWithOptions(cfg.Path, SQLiteOptions{TablePrefix: cfg.TablePrefix})
 	case "mongodb":
-		return NewMongoDBRepository(cfg.ConnectionString)
+		return NewMongoDBRepository(cfg.ConnectionString, MongoDBOptions{
+			Database:              cfg.Database,
+			Collection:            cfg.Collection,
+			ConnectionsCollection: cfg.ConnectionsCollection,
+			CollectionPrefix:      cfg.TablePrefix,
+		})
+	case "postgres":
+		return NewPostgresRepository(cfg.ConnectionString)
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", cfg.Type)
 	}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// migration upgrades a SQL schema by one version. Migrations run in version
+// order on startup, each in its own transaction, and are recorded in the
+// schema_migrations table so they are applied exactly once.
+type migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrationDialect holds the schema_migrations statements that differ between
+// SQL databases
+type migrationDialect struct {
+	// createTable creates the schema_migrations table if it does not exist
+	createTable string
+
+	// lock runs first in each migration transaction to serialize concurrent
+	// runners, such as replicas starting together; empty skips it
+	lock string
+
+	// applied selects a row for the version bound as its only argument
+	applied string
+
+	// record inserts the version, description and applied_at time
+	record string
+}
+
+// sqliteMigrationDialect records the versions of the SQLite schema named by t
+func sqliteMigrationDialect(t sqliteTables) migrationDialect {
+	return migrationDialect{
+		createTable: `
+			CREATE TABLE IF NOT EXISTS ` + t.schemaMigrations + ` (
+				version INTEGER PRIMARY KEY,
+				description TEXT NOT NULL,
+				applied_at INTEGER NOT NULL
+			)
+		`,
+		applied: "SELECT 1 FROM " + t.schemaMigrations + " WHERE version = ?",
+		record:  "INSERT INTO " + t.schemaMigrations + " (version, description, applied_at) VALUES (?, ?, ?)",
+	}
+}
+
+// postgresMigrationLockID is the advisory lock key held while a migration runs
+const postgresMigrationLockID = 7263540010
+
+var postgresMigrationDialect = migrationDialect{
+	createTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		)
+	`,
+	lock:    fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", postgresMigrationLockID),
+	applied: "SELECT 1 FROM schema_migrations WHERE version = $1",
+	record:  "INSERT INTO schema_migrations (version, description, applied_at) VALUES ($1, $2, $3)",
+}
+
+// runMigrations applies the migrations that have not been recorded yet.
+// Versions must start at 1 and increase by one, so appending a migration is
+// the only way to change a schema that has shipped.
+func runMigrations(ctx context.Context, db *sql.DB, dialect migrationDialect, migrations []migration) error {
+	if _, err := db.ExecContext(ctx, dialect.createTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, expected %d", m.Description, m.Version, i+1)
+		}
+		if err := applyMigration(ctx, db, dialect, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs one migration and records it in the same transaction,
+// unless it has already been applied
+func applyMigration(ctx context.Context, db *sql.DB, dialect migrationDialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if dialect.lock != "" {
+		if _, err := tx.ExecContext(ctx, dialect.lock); err != nil {
+			return fmt.Errorf("failed to lock schema_migrations: %w", err)
+		}
+	}
+
+	// Checked inside the transaction so a runner that waited for the lock
+	// sees the version another runner just applied
+	var applied int
+	err = tx.QueryRowContext(ctx, dialect.applied, m.Version).Scan(&applied)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check schema version: %w", err)
+	}
+
+	if err := m.Up(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, dialect.record, m.Version, m.Description, time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// columnExists reports whether table has the named column
+func columnExists(t *testing.T, db *sql.DB, table, column string) bool {
+	t.Helper()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count); err != nil {
+		t.Fatalf("Failed to inspect %s: %v", table, err)
+	}
+	return count > 0
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// Build a database with the subnets table of an early release, before
+	// soft deletes and schema versioning
+	old, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := old.Exec(`
+		CREATE TABLE subnets (
+			id TEXT PRIMARY KEY,
+			cidr TEXT UNIQUE NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT,
+			location TEXT,
+			location_type TEXT,
+			cloud_provider TEXT,
+			cloud_region TEXT,
+			cloud_account_id TEXT,
+			cloud_resource_type TEXT,
+			cloud_vpc_id TEXT,
+			cloud_subnet_id TEXT,
+			parent_id TEXT,
+			address TEXT,
+			netmask TEXT,
+			wildcard TEXT,
+			network TEXT,
+			type TEXT,
+			broadcast TEXT,
+			host_min TEXT,
+			host_max TEXT,
+			hosts_per_net INTEGER,
+			is_public INTEGER,
+			total_ips INTEGER,
+			allocated_ips INTEGER,
+			utilization_percent REAL,
+			created_at INTEGER,
+			updated_at INTEGER
+		);
+		INSERT INTO subnets (id, cidr, name, location, location_type, created_at, updated_at)
+		VALUES ('legacy', '10.1.0.0/24', 'Legacy', 'dc-1', 'DATACENTER', 1700000000, 1700000000);
+	`); err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+	old.Close()
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate old database: %v", err)
+	}
+	defer repo.Close()
+
+	for _, column := range []string{"environment", "deleted_at", "cloud_last_seen_at"} {
+		if !columnExists(t, repo.db, "subnets", column) {
+			t.Errorf("Expected migration 1 to add subnets.%s", column)
+		}
+	}
+	if _, err := repo.GetSubnetByID(ctx, "legacy"); err != nil {
+		t.Errorf("Expected the existing subnet to survive the migration: %v", err)
+	}
+
+	if !columnExists(t, repo.db, "subnets", "expires_at") {
+		t.Error("Expected migration 2 to add subnets.expires_at")
+	}
+
+	tables := newSQLiteTables("")
+	latest := len(sqliteMigrations(tables))
+	var version int
+	if err := repo.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil || version != latest {
+		t.Fatalf("Expected schema version %d, got %d, %v", latest, version, err)
+	}
+
+	// A migration appended to the list runs once on the next start
+	runs := 0
+	migrations := append(sqliteMigrations(tables), migration{
+		Version:     latest + 1,
+		Description: "add subnets.owner",
+		Up: func(ctx context.Context, tx *sql.Tx) error {
+			runs++
+			_, err := tx.ExecContext(ctx, "ALTER TABLE subnets ADD COLUMN owner TEXT")
+			return err
+		},
+	})
+	for range 2 {
+		if err := runMigrations(ctx, repo.db, sqliteMigrationDialect(tables), migrations); err != nil {
+			t.Fatalf("Failed to run migrations: %v", err)
+		}
+	}
+	if runs != 1 || !columnExists(t, repo.db, "subnets", "owner") {
+		t.Errorf("Expected the appended migration to add subnets.owner exactly once, ran %d time(s)", runs)
+	}
+
+	// A failing migration is rolled back and left unrecorded
+	failure := errors.New("boom")
+	migrations = append(migrations, migration{
+		Version:     latest + 2,
+		Description: "add subnets.team, then fail",
+		Up: func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "ALTER TABLE subnets ADD COLUMN team TEXT"); err != nil {
+				return err
+			}
+			return failure
+		},
+	})
+	if err := runMigrations(ctx, repo.db, sqliteMigrationDialect(tables), migrations); !errors.Is(err, failure) {
+		t.Fatalf("Expected the failing migration's error, got %v", err)
+	}
+	if columnExists(t, repo.db, "subnets", "team") {
+		t.Error("Expected the failed migration to be rolled back")
+	}
+	if err := repo.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil || version != latest+1 {
+		t.Errorf("Expected schema version %d after the failure, got %d, %v", latest+1, version, err)
+	}
+
+	// Versions must be contiguous
+	gap := []migration{{Version: 2, Description: "gap", Up: migrations[1].Up}}
+	if err := runMigrations(ctx, repo.db, sqliteMigrationDialect(tables), gap); err == nil {
+		t.Error("Expected a list not starting at version 1 to be rejected")
+	}
+}
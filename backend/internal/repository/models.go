@@ -6,18 +6,32 @@ import (
 
 // Subnet represents a subnet in the repository layer
 type Subnet struct {
-	ID           string            `json:"id"`
-	Name         string            `json:"name"`
-	CIDR         string            `json:"cidr"`
-	Location     string            `json:"location"`
-	LocationType string            `json:"location_type"`
-	CloudInfo    *CloudInfo        `json:"cloud_info,omitempty"`
-	Details      *SubnetDetails    `json:"details,omitempty"`
-	Utilization  *Utilization      `json:"utilization,omitempty"`
-	Tags         map[string]string `json:"tags,omitempty"`
-	ParentID     string            `json:"parent_id,omitempty"` // ID du réseau parent
-	CreatedAt    time.Time         `json:"created_at"`
-	UpdatedAt    time.Time         `json:"updated_at"`
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	CIDR           string            `json:"cidr"`
+	Location       string            `json:"location"`
+	LocationType   string            `json:"location_type"`
+	Environment    string            `json:"environment,omitempty"`
+	DHCPRangeStart string            `json:"dhcp_range_start,omitempty"` // DHCP pool start; set together with DHCPRangeEnd
+	DHCPRangeEnd   string            `json:"dhcp_range_end,omitempty"`
+	DNSZone        string            `json:"dns_zone,omitempty"` // Zone naming hint such as 10.in-addr.arpa
+	CloudInfo      *CloudInfo        `json:"cloud_info,omitempty"`
+	Details        *SubnetDetails    `json:"details,omitempty"`
+	Utilization    *Utilization      `json:"utilization,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	ParentID       string            `json:"parent_id,omitempty"`  // ID du réseau parent
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty"` // Deleted by the expiry reconciler once passed; nil never expires
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// StoredFields holds the subnet fields the Protobuf model does not carry, so
+// an update can write them in the same statement as the Protobuf fields
+type StoredFields struct {
+	Environment    string
+	DHCPRangeStart string
+	DHCPRangeEnd   string
+	DNSZone        string
 }
 
 // SubnetDetails represents calculated subnet information
@@ -46,10 +60,32 @@ type CloudInfo struct {
 
 // Utilization represents subnet utilization information
 type Utilization struct {
-	TotalIPs           int32     `json:"total_ips"`
-	AllocatedIPs       int32     `json:"allocated_ips"`
-	UtilizationPercent float64   `json:"utilization_percent"`
-	LastUpdated        time.Time `json:"last_updated"`
+	TotalIPs                 int32     `json:"total_ips"`
+	AllocatedIPs             int32     `json:"allocated_ips"`
+	UtilizationPercent       float64   `json:"utilization_percent"`        // Share of addresses allocated
+	PrefixUtilizationPercent float64   `json:"prefix_utilization_percent"` // Share of address space covered by child subnets
+	LastUpdated              time.Time `json:"last_updated"`
+}
+
+// ChildRollup aggregates the utilization of a subnet's direct children
+type ChildRollup struct {
+	ChildCount         int32   `json:"child_count"`
+	TotalIPs           int64   `json:"total_ips"`
+	AllocatedIPs       int64   `json:"allocated_ips"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+// newChildRollup builds a rollup from summed child counters
+func newChildRollup(childCount int32, totalIPs, allocatedIPs int64) *ChildRollup {
+	rollup := &ChildRollup{
+		ChildCount:   childCount,
+		TotalIPs:     totalIPs,
+		AllocatedIPs: allocatedIPs,
+	}
+	if totalIPs > 0 {
+		rollup.UtilizationPercent = float64(allocatedIPs) / float64(totalIPs) * 100
+	}
+	return rollup
 }
 
 // SubnetFilters contains filtering criteria for subnet queries
@@ -57,15 +93,30 @@ type SubnetFilters struct {
 	LocationFilter      string
 	CloudProviderFilter string
 	SearchQuery         string
+	CIDRPrefix          string // Matches subnets containing or contained in this (partial) CIDR
+	Environment         string
+	ManagedBy           string            // ManagedByCloud or ManagedByManual; empty matches both
+	TagFilter           map[string]string // Matches subnets carrying every key with the given value
+	IsPublic            *bool             // Matches public or private subnets; nil matches both
+	PrefixLength        *int              // Matches subnets with this CIDR prefix length; nil matches all
+	After               *SubnetCursor     // Keyset pagination; when set, Page is ignored
 	Page                int32
 	PageSize            int32
 	CloudProvider       string // For cloud provider specific filtering
 }
 
+// Values of SubnetFilters.ManagedBy. Cloud sync always records the provider's
+// VPC ID, so subnets carrying one are cloud-managed and the rest are manual.
+const (
+	ManagedByCloud  = "cloud"
+	ManagedByManual = "manual"
+)
+
 // SubnetList represents a list of subnets with pagination
 type SubnetList struct {
 	Subnets    []*Subnet `json:"subnets"`
 	TotalCount int32     `json:"total_count"`
+	NextCursor string    `json:"next_cursor,omitempty"` // Set when the page is full
 }
 
 // Connection represents a connection between subnets
@@ -100,3 +151,68 @@ type ConnectionList struct {
 	Connections []*Connection `json:"connections"`
 	TotalCount  int32         `json:"total_count"`
 }
+
+// SubnetNote represents a freeform operational note attached to a subnet
+type SubnetNote struct {
+	ID        string    `json:"id"`
+	SubnetID  string    `json:"subnet_id"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IPAllocation represents a single IP address allocated inside a subnet
+type IPAllocation struct {
+	SubnetID    string    `json:"subnet_id"`
+	IP          string    `json:"ip"`
+	Hostname    string    `json:"hostname,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IPAllocationFilters contains filtering criteria for listing allocations
+// across subnets
+type IPAllocationFilters struct {
+	SubnetID    string
+	Hostname    string
+	SearchQuery string // Matches the IP, hostname or description
+	Page        int32
+	PageSize    int32
+}
+
+// IPAllocationList represents a page of IP allocations
+type IPAllocationList struct {
+	Allocations []*IPAllocation `json:"allocations"`
+	TotalCount  int32           `json:"total_count"`
+}
+
+// ReservedRange is a span of subnet addresses, from StartIP to EndIP
+// inclusive, that IP allocation never hands out
+type ReservedRange struct {
+	ID        string    `json:"id"`
+	SubnetID  string    `json:"subnet_id"`
+	StartIP   string    `json:"start_ip"`
+	EndIP     string    `json:"end_ip"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UtilizationSample represents a point-in-time utilization reading of a subnet
+type UtilizationSample struct {
+	SubnetID     string    `json:"subnet_id"`
+	Percent      float64   `json:"percent"`
+	TotalIPs     int32     `json:"total_ips"`
+	AllocatedIPs int32     `json:"allocated_ips"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// IdempotentResult records the resource a request carrying a client-supplied
+// idempotency key created, so a retry of the request can return it instead of
+// creating another. Keys are scoped per endpoint.
+type IdempotentResult struct {
+	Scope      string    `json:"scope"`
+	Key        string    `json:"key"`
+	ResourceID string    `json:"resource_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
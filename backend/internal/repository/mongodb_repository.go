@@ -2,19 +2,28 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	pb "github.com/bananaops/ipam-bananaops/proto"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MongoDBRepository implements SubnetRepository using MongoDB
 type MongoDBRepository struct {
-	client     *mongo.Client
-	collection *mongo.Collection
+	client                 *mongo.Client
+	subnetsCollection      *mongo.Collection
+	connectionsCollection  *mongo.Collection
+	notesCollection        *mongo.Collection
+	historyCollection      *mongo.Collection
+	allocationsCollection  *mongo.Collection
+	reservationsCollection *mongo.Collection
+	idempotencyCollection  *mongo.Collection
 }
 
 // subnetDocument represents the MongoDB document structure
@@ -30,6 +39,13 @@ type subnetDocument struct {
 	Utilization  *utilizationDocument   `bson:"utilization"`
 	CreatedAt    int64                  `bson:"createdAt"`
 	UpdatedAt    int64                  `bson:"updatedAt"`
+
+	// Fields outside the Protobuf model, only written by
+	// UpdateWithStoredFields; nil leaves the stored value unchanged
+	Environment    *string `bson:"environment,omitempty"`
+	DHCPRangeStart *string `bson:"dhcpRangeStart,omitempty"`
+	DHCPRangeEnd   *string `bson:"dhcpRangeEnd,omitempty"`
+	DNSZone        *string `bson:"dnsZone,omitempty"`
 }
 
 type cloudInfoDocument struct {
@@ -57,8 +73,43 @@ type utilizationDocument struct {
 	UtilizationPercent float32 `bson:"utilizationPercent"`
 }
 
-// NewMongoDBRepository creates a new MongoDB repository
-func NewMongoDBRepository(connectionString string) (*MongoDBRepository, error) {
+const (
+	defaultMongoDatabase              = "ipam"
+	defaultMongoCollection            = "subnets"
+	defaultMongoConnectionsCollection = "connections"
+)
+
+// MongoDBOptions names the database and collections the repository uses, so
+// several environments can share a cluster. Empty fields use the defaults.
+type MongoDBOptions struct {
+	Database              string // Defaults to "ipam"
+	Collection            string // Subnet collection; defaults to "subnets"
+	ConnectionsCollection string // Defaults to "connections"
+	CollectionPrefix      string // Prepended to every collection name
+}
+
+// withDefaults fills in the default names for empty fields
+func (o MongoDBOptions) withDefaults() MongoDBOptions {
+	if o.Database == "" {
+		o.Database = defaultMongoDatabase
+	}
+	if o.Collection == "" {
+		o.Collection = defaultMongoCollection
+	}
+	if o.ConnectionsCollection == "" {
+		o.ConnectionsCollection = defaultMongoConnectionsCollection
+	}
+	return o
+}
+
+// NewMongoDBRepository creates a new MongoDB repository that stores all
+// subnets in a single collection
+func NewMongoDBRepository(connectionString string, opts MongoDBOptions) (*MongoDBRepository, error) {
+	opts = opts.withDefaults()
+	if err := validateTablePrefix(opts.CollectionPrefix); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -73,13 +124,7 @@ func NewMongoDBRepository(connectionString string) (*MongoDBRepository, error) {
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	// Get collection
-	collection := client.Database("ipam").Collection("subnets")
-
-	repo := &MongoDBRepository{
-		client:     client,
-		collection: collection,
-	}
+	repo := newMongoDBRepository(client, opts)
 
 	// Create indexes
 	if err := repo.createIndexes(ctx); err != nil {
@@ -90,6 +135,32 @@ func NewMongoDBRepository(connectionString string) (*MongoDBRepository, error) {
 	return repo, nil
 }
 
+// newMongoDBRepository binds the repository to the collections opts names in
+// client, without touching the server
+func newMongoDBRepository(client *mongo.Client, opts MongoDBOptions) *MongoDBRepository {
+	db := client.Database(opts.Database)
+	prefix := opts.CollectionPrefix
+	return &MongoDBRepository{
+		client:                 client,
+		subnetsCollection:      db.Collection(prefix + opts.Collection),
+		connectionsCollection:  db.Collection(prefix + opts.ConnectionsCollection),
+		notesCollection:        db.Collection(prefix + "subnet_notes"),
+		historyCollection:      db.Collection(prefix + "utilization_history"),
+		allocationsCollection:  db.Collection(prefix + "ip_allocations"),
+		reservationsCollection: db.Collection(prefix + "reserved_ranges"),
+		idempotencyCollection:  db.Collection(prefix + "idempotency_keys"),
+	}
+}
+
+// subnetCollection returns the collection subnets are stored in. Every query
+// goes through here, and every subnet, whatever its location type, lives in
+// this one collection: reads, counts and aggregates never need to fan out or
+// merge results. To spread subnets over several servers, shard this
+// collection (for example on locationType) instead of splitting it.
+func (r *MongoDBRepository) subnetCollection() *mongo.Collection {
+	return r.subnetsCollection
+}
+
 // createIndexes creates necessary indexes for the collection
 func (r *MongoDBRepository) createIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
@@ -105,20 +176,143 @@ func (r *MongoDBRepository) createIndexes(ctx context.Context) error {
 			Keys:    bson.D{{Key: "cidr", Value: 1}},
 			Options: options.Index().SetUnique(true).SetName("idx_cidr_unique"),
 		},
+		{
+			Keys:    bson.D{{Key: "environment", Value: 1}},
+			Options: options.Index().SetName("idx_environment"),
+		},
+	}
+
+	if err := ensureIndexes(ctx, r.subnetCollection(), indexes); err != nil {
+		return err
+	}
+
+	connectionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "sourceSubnetId", Value: 1}},
+			Options: options.Index().SetName("idx_connections_source"),
+		},
+		{
+			Keys:    bson.D{{Key: "targetSubnetId", Value: 1}},
+			Options: options.Index().SetName("idx_connections_target"),
+		},
+		{
+			Keys:    bson.D{{Key: "connectionType", Value: 1}},
+			Options: options.Index().SetName("idx_connections_type"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}},
+			Options: options.Index().SetName("idx_connections_status"),
+		},
+		{
+			Keys:    bson.D{{Key: "sourceSubnetId", Value: 1}, {Key: "targetSubnetId", Value: 1}, {Key: "connectionType", Value: 1}},
+			Options: options.Index().SetName("idx_connections_pair"),
+		},
+	}
+
+	if err := ensureIndexes(ctx, r.connectionsCollection, connectionIndexes); err != nil {
+		return err
+	}
+
+	allocationIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "subnetId", Value: 1}, {Key: "ip", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("idx_allocations_subnet_ip_unique"),
+	}
+
+	if err := ensureIndexes(ctx, r.allocationsCollection, []mongo.IndexModel{allocationIndex}); err != nil {
+		return err
+	}
+
+	reservationIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "subnetId", Value: 1}},
+		Options: options.Index().SetName("idx_reserved_ranges_subnet"),
+	}
+
+	if err := ensureIndexes(ctx, r.reservationsCollection, []mongo.IndexModel{reservationIndex}); err != nil {
+		return err
+	}
+
+	// Expired idempotency keys are removed by MongoDB's TTL monitor
+	idempotencyIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "scope", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_idempotency_scope_key_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_idempotency_expires"),
+		},
+	}
+
+	return ensureIndexes(ctx, r.idempotencyCollection, idempotencyIndexes)
+}
+
+// MongoDB server error codes returned when an index already exists under
+// another name or with different options
+const (
+	mongoIndexAlreadyExists    = 68
+	mongoIndexOptionsConflict  = 85
+	mongoIndexKeySpecsConflict = 86
+)
+
+// ensureIndexes creates each index on its own so that one conflicting index
+// does not prevent the others from being created. Conflicts with an existing
+// index are logged and left for an operator to resolve rather than aborting
+// startup.
+func ensureIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) error {
+	for _, index := range indexes {
+		_, err := collection.Indexes().CreateOne(ctx, index)
+		if err == nil {
+			continue
+		}
+		if isIndexConflict(err) {
+			log.Printf("Keeping existing index on %s that conflicts with %s: %v", collection.Name(), indexName(index), err)
+			continue
+		}
+		return fmt.Errorf("failed to create index %s on %s: %w", indexName(index), collection.Name(), err)
+	}
+	return nil
+}
+
+// isIndexConflict reports whether err means an equivalent index already exists
+// with a different name or options
+func isIndexConflict(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
 	}
+	return serverErr.HasErrorCode(mongoIndexAlreadyExists) ||
+		serverErr.HasErrorCode(mongoIndexOptionsConflict) ||
+		serverErr.HasErrorCode(mongoIndexKeySpecsConflict)
+}
 
-	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+// wrapMongoError tags duplicate key errors with ErrDuplicate
+func wrapMongoError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	}
 	return err
 }
 
+// indexName returns the configured name of an index model, if any
+func indexName(index mongo.IndexModel) string {
+	if index.Options != nil && index.Options.Name != nil {
+		return *index.Options.Name
+	}
+	return fmt.Sprintf("%v", index.Keys)
+}
+
 // Create inserts a new subnet into the database
 func (r *MongoDBRepository) Create(ctx context.Context, subnet *pb.Subnet) error {
+	if err := r.purgeDeletedCIDRs(ctx, []string{subnet.Cidr}); err != nil {
+		return err
+	}
+
 	doc := r.toDocument(subnet)
 
-	_, err := r.collection.InsertOne(ctx, doc)
+	_, err := r.subnetCollection().InsertOne(ctx, doc)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return fmt.Errorf("subnet with CIDR %s already exists", subnet.Cidr)
+			return fmt.Errorf("subnet with CIDR %s %w", subnet.Cidr, ErrDuplicate)
 		}
 		return fmt.Errorf("failed to create subnet: %w", err)
 	}
@@ -128,12 +322,12 @@ func (r *MongoDBRepository) Create(ctx context.Context, subnet *pb.Subnet) error
 
 // FindByID retrieves a subnet by its ID
 func (r *MongoDBRepository) FindByID(ctx context.Context, id string) (*pb.Subnet, error) {
-	filter := bson.M{"_id": id}
+	filter := bson.M{"_id": id, "deletedAt": nil}
 
 	var doc subnetDocument
-	err := r.collection.FindOne(ctx, filter).Decode(&doc)
+	err := r.subnetCollection().FindOne(ctx, filter).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("subnet not found")
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
@@ -144,7 +338,7 @@ func (r *MongoDBRepository) FindByID(ctx context.Context, id string) (*pb.Subnet
 
 // FindAll retrieves all subnets with optional filtering
 func (r *MongoDBRepository) FindAll(ctx context.Context, filters *SubnetFilters) ([]*pb.Subnet, error) {
-	filter := bson.M{}
+	filter := bson.M{"deletedAt": nil}
 
 	// Apply filters
 	if filters != nil {
@@ -160,6 +354,7 @@ func (r *MongoDBRepository) FindAll(ctx context.Context, filters *SubnetFilters)
 				{"cidr": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
 				{"description": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
 				{"location": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
+				{"dnsZone": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
 			}
 		}
 	}
@@ -173,7 +368,7 @@ func (r *MongoDBRepository) FindAll(ctx context.Context, filters *SubnetFilters)
 		opts.SetSkip(int64(filters.Page * filters.PageSize))
 	}
 
-	cursor, err := r.collection.Find(ctx, filter, opts)
+	cursor, err := r.subnetCollection().Find(ctx, filter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query subnets: %w", err)
 	}
@@ -197,40 +392,153 @@ func (r *MongoDBRepository) FindAll(ctx context.Context, filters *SubnetFilters)
 
 // Update modifies an existing subnet
 func (r *MongoDBRepository) Update(ctx context.Context, subnet *pb.Subnet) error {
-	filter := bson.M{"_id": subnet.Id}
+	return r.UpdateWithStoredFields(ctx, subnet, nil)
+}
+
+// UpdateWithStoredFields modifies an existing subnet like Update and, when
+// stored is non-nil, writes its fields in the same update
+func (r *MongoDBRepository) UpdateWithStoredFields(ctx context.Context, subnet *pb.Subnet, stored *StoredFields) error {
+	filter := bson.M{"_id": subnet.Id, "deletedAt": nil}
 	doc := r.toDocument(subnet)
+	if stored != nil {
+		doc.Environment = &stored.Environment
+		doc.DHCPRangeStart = &stored.DHCPRangeStart
+		doc.DHCPRangeEnd = &stored.DHCPRangeEnd
+		doc.DNSZone = &stored.DNSZone
+	}
 
 	// Remove _id from update document
 	update := bson.M{"$set": doc}
 
-	result, err := r.collection.UpdateOne(ctx, filter, update)
+	result, err := r.subnetCollection().UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to update subnet: %w", err)
+		return fmt.Errorf("failed to update subnet: %w", wrapMongoError(err))
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("subnet not found")
+		return fmt.Errorf("subnet %w", ErrNotFound)
 	}
 
 	return nil
 }
 
-// Delete removes a subnet from the database
+// Delete soft-deletes a subnet by setting deletedAt. The document and its
+// dependents are kept so RestoreSubnet can bring it back.
 func (r *MongoDBRepository) Delete(ctx context.Context, id string) error {
-	filter := bson.M{"_id": id}
+	filter := bson.M{"_id": id, "deletedAt": nil}
+	update := bson.M{"$set": bson.M{"deletedAt": time.Now().Unix()}}
 
-	result, err := r.collection.DeleteOne(ctx, filter)
+	result, err := r.subnetCollection().UpdateOne(ctx, filter, update)
 	if err != nil {
 		return fmt.Errorf("failed to delete subnet: %w", err)
 	}
 
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// RestoreSubnet clears deletedAt on a soft-deleted subnet
+func (r *MongoDBRepository) RestoreSubnet(ctx context.Context, id string) error {
+	filter := bson.M{"_id": id, "deletedAt": bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{"deletedAt": ""}}
+
+	result, err := r.subnetCollection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to restore subnet: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// PurgeSubnet permanently removes a subnet, live or soft-deleted, together
+// with its connections, notes, allocations and utilization history
+func (r *MongoDBRepository) PurgeSubnet(ctx context.Context, id string) error {
+	result, err := r.subnetCollection().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to purge subnet: %w", err)
+	}
+
 	if result.DeletedCount == 0 {
-		return fmt.Errorf("subnet not found")
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return r.purgeSubnetDependents(ctx, []string{id})
+}
+
+// purgeDeletedCIDRs permanently removes soft-deleted subnets holding any of
+// cidrs so the CIDRs can be reused; the unique cidr index would otherwise
+// reject them.
+func (r *MongoDBRepository) purgeDeletedCIDRs(ctx context.Context, cidrs []string) error {
+	filter := bson.M{"cidr": bson.M{"$in": cidrs}, "deletedAt": bson.M{"$ne": nil}}
+
+	values, err := r.subnetCollection().Distinct(ctx, "_id", filter)
+	if err != nil {
+		return fmt.Errorf("failed to find deleted subnets: %w", err)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	if _, err := r.subnetCollection().DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return fmt.Errorf("failed to purge deleted subnets: %w", err)
+	}
+
+	return r.purgeSubnetDependents(ctx, ids)
+}
+
+// purgeSubnetDependents deletes the documents referencing purged subnets.
+// MongoDB has no cascading deletes, so each collection is cleaned up in turn.
+func (r *MongoDBRepository) purgeSubnetDependents(ctx context.Context, ids []string) error {
+	in := bson.M{"$in": ids}
+
+	if _, err := r.connectionsCollection.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"sourceSubnetId": in},
+		bson.M{"targetSubnetId": in},
+	}}); err != nil {
+		return fmt.Errorf("failed to purge subnet connections: %w", err)
+	}
+
+	for _, collection := range []*mongo.Collection{r.notesCollection, r.allocationsCollection, r.reservationsCollection, r.historyCollection} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"subnetId": in}); err != nil {
+			return fmt.Errorf("failed to purge subnet %s: %w", collection.Name(), err)
+		}
 	}
 
 	return nil
 }
 
+// liveConnectionFilter hides connections touching a soft-deleted subnet.
+// They are kept so that restoring the subnet brings them back.
+func (r *MongoDBRepository) liveConnectionFilter(ctx context.Context) (bson.M, error) {
+	deleted, err := r.subnetCollection().Distinct(ctx, "_id", bson.M{"deletedAt": bson.M{"$ne": nil}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deleted subnets: %w", err)
+	}
+	if len(deleted) == 0 {
+		return bson.M{}, nil
+	}
+
+	in := bson.M{"$in": deleted}
+	return bson.M{"$nor": bson.A{
+		bson.M{"sourceSubnetId": in},
+		bson.M{"targetSubnetId": in},
+	}}, nil
+}
+
 // Close closes the database connection
 func (r *MongoDBRepository) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -238,25 +546,272 @@ func (r *MongoDBRepository) Close() error {
 	return r.client.Disconnect(ctx)
 }
 
-// Connection methods - Not implemented for MongoDB yet
+// Ping verifies that the MongoDB server is reachable
+func (r *MongoDBRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx, nil)
+}
+
+// connectionDocument represents the MongoDB document structure for a connection
+type connectionDocument struct {
+	ID             string  `bson:"_id"`
+	SourceSubnetID string  `bson:"sourceSubnetId"`
+	TargetSubnetID string  `bson:"targetSubnetId"`
+	ConnectionType string  `bson:"connectionType"`
+	Status         string  `bson:"status"`
+	Name           string  `bson:"name"`
+	Description    string  `bson:"description"`
+	Bandwidth      string  `bson:"bandwidth"`
+	Latency        int32   `bson:"latency"`
+	Cost           float64 `bson:"cost"`
+	Metadata       bson.M  `bson:"metadata,omitempty"`
+	CreatedAt      int64   `bson:"createdAt"`
+	UpdatedAt      int64   `bson:"updatedAt"`
+}
+
+// toConnectionDocument converts a Connection to a MongoDB document
+func toConnectionDocument(id string, connection *Connection) *connectionDocument {
+	doc := &connectionDocument{
+		ID:             id,
+		SourceSubnetID: connection.SourceSubnetID,
+		TargetSubnetID: connection.TargetSubnetID,
+		ConnectionType: connection.ConnectionType,
+		Status:         connection.Status,
+		Name:           connection.Name,
+		Description:    connection.Description,
+		Bandwidth:      connection.Bandwidth,
+		Latency:        connection.Latency,
+		Cost:           connection.Cost,
+		CreatedAt:      connection.CreatedAt.UnixNano(),
+		UpdatedAt:      connection.UpdatedAt.UnixNano(),
+	}
+
+	if connection.Metadata != nil {
+		doc.Metadata = bson.M(connection.Metadata)
+	}
+
+	return doc
+}
+
+// fromConnectionDocument converts a MongoDB document to a Connection
+func fromConnectionDocument(doc *connectionDocument) *Connection {
+	connection := &Connection{
+		ID:             doc.ID,
+		SourceSubnetID: doc.SourceSubnetID,
+		TargetSubnetID: doc.TargetSubnetID,
+		ConnectionType: doc.ConnectionType,
+		Status:         doc.Status,
+		Name:           doc.Name,
+		Description:    doc.Description,
+		Bandwidth:      doc.Bandwidth,
+		Latency:        doc.Latency,
+		Cost:           doc.Cost,
+		CreatedAt:      time.Unix(0, doc.CreatedAt),
+		UpdatedAt:      time.Unix(0, doc.UpdatedAt),
+	}
+
+	if doc.Metadata != nil {
+		connection.Metadata = normalizeBSONValue(doc.Metadata).(map[string]interface{})
+	}
+
+	return connection
+}
+
+// normalizeBSONValue converts decoded nested documents and arrays into plain
+// maps and slices so metadata looks the same regardless of the backend
+func normalizeBSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = normalizeBSONValue(item)
+		}
+		return m
+	case primitive.D:
+		m := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			m[elem.Key] = normalizeBSONValue(elem.Value)
+		}
+		return m
+	case primitive.A:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeBSONValue(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+// CreateConnection inserts a new connection into the database
 func (r *MongoDBRepository) CreateConnection(ctx context.Context, connection *Connection) error {
-	return fmt.Errorf("connection methods not implemented for MongoDB repository")
+	if _, err := r.connectionsCollection.InsertOne(ctx, toConnectionDocument(connection.ID, connection)); err != nil {
+		return fmt.Errorf("failed to create connection: %w", wrapMongoError(err))
+	}
+
+	return nil
 }
 
+// GetConnectionByID retrieves a connection by its ID
 func (r *MongoDBRepository) GetConnectionByID(ctx context.Context, id string) (*Connection, error) {
-	return nil, fmt.Errorf("connection methods not implemented for MongoDB repository")
+	filter, err := r.liveConnectionFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = id
+
+	var doc connectionDocument
+	err = r.connectionsCollection.FindOne(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("connection %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find connection: %w", err)
+	}
+
+	return fromConnectionDocument(&doc), nil
 }
 
+// UpdateConnection updates an existing connection
 func (r *MongoDBRepository) UpdateConnection(ctx context.Context, id string, connection *Connection) error {
-	return fmt.Errorf("connection methods not implemented for MongoDB repository")
+	update := bson.M{
+		"$set": bson.M{
+			"sourceSubnetId": connection.SourceSubnetID,
+			"targetSubnetId": connection.TargetSubnetID,
+			"connectionType": connection.ConnectionType,
+			"status":         connection.Status,
+			"name":           connection.Name,
+			"description":    connection.Description,
+			"bandwidth":      connection.Bandwidth,
+			"latency":        connection.Latency,
+			"cost":           connection.Cost,
+			"metadata":       connection.Metadata,
+			"updatedAt":      time.Now().UnixNano(),
+		},
+	}
+
+	result, err := r.connectionsCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update connection: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("connection %w", ErrNotFound)
+	}
+
+	return nil
 }
 
+// DeleteConnection removes a connection from the database
 func (r *MongoDBRepository) DeleteConnection(ctx context.Context, id string) error {
-	return fmt.Errorf("connection methods not implemented for MongoDB repository")
+	result, err := r.connectionsCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete connection: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("connection %w", ErrNotFound)
+	}
+
+	return nil
 }
 
+// ListConnections retrieves connections with optional filtering
 func (r *MongoDBRepository) ListConnections(ctx context.Context, filters ConnectionFilters) (*ConnectionList, error) {
-	return nil, fmt.Errorf("connection methods not implemented for MongoDB repository")
+	filter, err := r.liveConnectionFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.SourceSubnetID != "" {
+		filter["sourceSubnetId"] = filters.SourceSubnetID
+	}
+	if filters.TargetSubnetID != "" {
+		filter["targetSubnetId"] = filters.TargetSubnetID
+	}
+	if filters.ConnectionType != "" {
+		filter["connectionType"] = filters.ConnectionType
+	}
+	if filters.Status != "" {
+		filter["status"] = filters.Status
+	}
+
+	// Count total records
+	totalCount, err := r.connectionsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count connections: %w", err)
+	}
+
+	limit := filters.PageSize
+	if limit <= 0 {
+		limit = 50 // Default page size
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(filters.Page * limit))
+
+	cursor, err := r.connectionsCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query connections: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var connections []*Connection
+	for cursor.Next(ctx) {
+		var doc connectionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode connection: %w", err)
+		}
+		connections = append(connections, fromConnectionDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return &ConnectionList{
+		Connections: connections,
+		TotalCount:  int32(totalCount),
+	}, nil
+}
+
+// ListConnectionsForSubnet retrieves every connection the subnet is the
+// source or target of, newest first
+func (r *MongoDBRepository) ListConnectionsForSubnet(ctx context.Context, subnetID string) ([]*Connection, error) {
+	filter, err := r.liveConnectionFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter["$or"] = bson.A{
+		bson.M{"sourceSubnetId": subnetID},
+		bson.M{"targetSubnetId": subnetID},
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := r.connectionsCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnet connections: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var connections []*Connection
+	for cursor.Next(ctx) {
+		var doc connectionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode connection: %w", err)
+		}
+		connections = append(connections, fromConnectionDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return connections, nil
 }
 
 // toDocument converts a Protobuf Subnet to a MongoDB document
@@ -357,55 +912,327 @@ func (r *MongoDBRepository) toProto(doc *subnetDocument) *pb.Subnet {
 
 // CreateSubnet creates a new subnet using the repository model
 func (r *MongoDBRepository) CreateSubnet(ctx context.Context, subnet *Subnet) error {
+	if err := r.purgeDeletedCIDRs(ctx, []string{subnet.CIDR}); err != nil {
+		return err
+	}
+
 	doc := r.toRepositoryDocument(subnet)
 
-	_, err := r.collection.InsertOne(ctx, doc)
+	_, err := r.subnetCollection().InsertOne(ctx, doc)
 	if err != nil {
-		return fmt.Errorf("failed to create subnet: %w", err)
+		return fmt.Errorf("failed to create subnet: %w", wrapMongoError(err))
 	}
 
 	return nil
 }
 
-// GetSubnetByCIDR retrieves a subnet by its CIDR
-func (r *MongoDBRepository) GetSubnetByCIDR(ctx context.Context, cidr string) (*Subnet, error) {
-	filter := bson.M{"cidr": cidr}
+// BulkCreateSubnets inserts all subnets with one ordered InsertMany. Standalone
+// MongoDB has no multi-document transactions, so when an insert fails the
+// documents already written by the batch are deleted again.
+func (r *MongoDBRepository) BulkCreateSubnets(ctx context.Context, subnets []*Subnet) error {
+	if len(subnets) == 0 {
+		return nil
+	}
 
-	var doc subnetRepositoryDocument
-	err := r.collection.FindOne(ctx, filter).Decode(&doc)
-	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("subnet not found")
+	docs := make([]interface{}, len(subnets))
+	ids := make([]string, len(subnets))
+	cidrs := make([]string, len(subnets))
+	for i, subnet := range subnets {
+		docs[i] = r.toRepositoryDocument(subnet)
+		ids[i] = subnet.ID
+		cidrs[i] = subnet.CIDR
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to find subnet: %w", err)
+
+	if err := r.purgeDeletedCIDRs(ctx, cidrs); err != nil {
+		return err
 	}
 
-	return r.fromRepositoryDocument(&doc), nil
-}
+	_, err := r.subnetCollection().InsertMany(ctx, docs, options.InsertMany().SetOrdered(true))
+	if err == nil {
+		return nil
+	}
 
-// UpdateSubnet updates an existing subnet using the repository model
-func (r *MongoDBRepository) UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error {
-	filter := bson.M{"_id": id}
-	doc := r.toRepositoryDocument(subnet)
+	// Ordered inserts stop at the first failure, so everything before it was written
+	failed := 0
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		failed = bulkErr.WriteErrors[0].Index
+	}
+	if failed > 0 {
+		if _, cleanupErr := r.subnetCollection().DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids[:failed]}}); cleanupErr != nil {
+			return fmt.Errorf("failed to roll back bulk insert after %v: %w", err, cleanupErr)
+		}
+	}
 
-	// Remove _id from update document
-	update := bson.M{"$set": doc}
+	return &BulkCreateError{Index: failed, CIDR: subnets[failed].CIDR, Err: fmt.Errorf("failed to create subnet: %w", wrapMongoError(err))}
+}
 
-	result, err := r.collection.UpdateOne(ctx, filter, update)
+// UpdatePrefixUtilization records the share of a subnet's address space
+// covered by its children. It is kept outside the utilization subdocument,
+// which the Protobuf update path replaces wholesale.
+func (r *MongoDBRepository) UpdatePrefixUtilization(ctx context.Context, id string, percent float64, updatedAt time.Time) error {
+	update := bson.M{"$set": bson.M{"prefixUtilizationPercent": percent, "updatedAt": unixOrNow(updatedAt)}}
+	result, err := r.subnetCollection().UpdateOne(ctx, bson.M{"_id": id, "deletedAt": nil}, update)
 	if err != nil {
-		return fmt.Errorf("failed to update subnet: %w", err)
+		return fmt.Errorf("failed to update prefix utilization: %w", err)
 	}
-
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("subnet not found")
+		return fmt.Errorf("subnet %w", ErrNotFound)
 	}
+	return nil
+}
 
+// MarkSubnetSeen records when a cloud sync last reported a subnet. It leaves
+// updatedAt alone, since being seen again is not a modification.
+func (r *MongoDBRepository) MarkSubnetSeen(ctx context.Context, id string, seenAt time.Time) error {
+	update := bson.M{"$set": bson.M{"lastSeenAt": unixOrNow(seenAt)}}
+	result, err := r.subnetCollection().UpdateOne(ctx, bson.M{"_id": id, "deletedAt": nil}, update)
+	if err != nil {
+		return fmt.Errorf("failed to mark subnet seen: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
 	return nil
 }
 
-// ListSubnets retrieves subnets with filtering using the repository model
-func (r *MongoDBRepository) ListSubnets(ctx context.Context, filters SubnetFilters) (*SubnetList, error) {
-	filter := bson.M{}
+// ListStaleCloudSubnets retrieves the synced cloud subnets last seen before
+// seenBefore. Subnets synced before sightings were tracked fall back to their
+// update time.
+func (r *MongoDBRepository) ListStaleCloudSubnets(ctx context.Context, seenBefore time.Time) ([]*Subnet, error) {
+	before := seenBefore.Unix()
+	filter := bson.M{
+		"deletedAt":              nil,
+		"locationType":           "cloud",
+		"cloudInfo.resourceType": "subnet",
+		"$or": bson.A{
+			bson.M{"lastSeenAt": bson.M{"$lt": before}},
+			bson.M{"lastSeenAt": bson.M{"$exists": false}, "updatedAt": bson.M{"$lt": before}},
+		},
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "cidr", Value: 1}})
+
+	cursor, err := r.subnetCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale cloud subnets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subnets []*Subnet
+	for cursor.Next(ctx) {
+		var doc subnetRepositoryDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode subnet: %w", err)
+		}
+		subnets = append(subnets, r.fromRepositoryDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return subnets, nil
+}
+
+// ListExpiredSubnets retrieves the subnets whose expiry is at or before now
+func (r *MongoDBRepository) ListExpiredSubnets(ctx context.Context, now time.Time) ([]*Subnet, error) {
+	filter := bson.M{
+		"deletedAt": nil,
+		"expiresAt": bson.M{"$ne": nil, "$lte": now.Unix()},
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "cidr", Value: 1}})
+
+	cursor, err := r.subnetCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired subnets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subnets []*Subnet
+	for cursor.Next(ctx) {
+		var doc subnetRepositoryDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode subnet: %w", err)
+		}
+		subnets = append(subnets, r.fromRepositoryDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return subnets, nil
+}
+
+// BulkUpdateUtilization sets allocated IPs and utilization for several subnets.
+// MongoDB has no transaction here, so updates that were applied before a
+// failure are restored to their previous values.
+func (r *MongoDBRepository) BulkUpdateUtilization(ctx context.Context, updates []*UtilizationUpdate) error {
+	previous := make([]*utilizationRepositoryDocument, len(updates))
+	for i, update := range updates {
+		var doc subnetRepositoryDocument
+		err := r.subnetCollection().FindOne(ctx, bson.M{"_id": update.SubnetID, "deletedAt": nil}).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("subnet %w", ErrNotFound)}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find subnet: %w", err)
+		}
+		previous[i] = doc.Utilization
+		if previous[i] == nil {
+			previous[i] = &utilizationRepositoryDocument{}
+		}
+	}
+
+	for i, update := range updates {
+		now := unixOrNow(update.UpdatedAt)
+		set := bson.M{
+			"utilization.allocatedIps":       update.AllocatedIPs,
+			"utilization.utilizationPercent": update.UtilizationPercent,
+			"utilization.lastUpdated":        now,
+			"updatedAt":                      now,
+		}
+		result, err := r.subnetCollection().UpdateOne(ctx, bson.M{"_id": update.SubnetID, "deletedAt": nil}, bson.M{"$set": set})
+		if err == nil && result.MatchedCount == 0 {
+			err = fmt.Errorf("subnet %w", ErrNotFound)
+		}
+		if err == nil {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			restore := bson.M{
+				"utilization.allocatedIps":       previous[j].AllocatedIPs,
+				"utilization.utilizationPercent": previous[j].UtilizationPercent,
+				"utilization.lastUpdated":        previous[j].LastUpdated,
+			}
+			if _, cleanupErr := r.subnetCollection().UpdateOne(ctx, bson.M{"_id": updates[j].SubnetID}, bson.M{"$set": restore}); cleanupErr != nil {
+				return fmt.Errorf("failed to roll back utilization update after %v: %w", err, cleanupErr)
+			}
+		}
+		return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: err}
+	}
+
+	return nil
+}
+
+// RenumberSubnets moves several subnets to new CIDRs. MongoDB has no
+// transaction here, so subnets moved before a failure are put back at their
+// previous CIDR.
+func (r *MongoDBRepository) RenumberSubnets(ctx context.Context, updates []*CIDRUpdate) error {
+	previous := make([]bson.M, len(updates))
+	for i, update := range updates {
+		var doc subnetRepositoryDocument
+		err := r.subnetCollection().FindOne(ctx, bson.M{"_id": update.SubnetID, "deletedAt": nil}).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("subnet %w", ErrNotFound)}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find subnet: %w", err)
+		}
+		previous[i] = bson.M{
+			"cidr":           doc.CIDR,
+			"details":        doc.Details,
+			"dhcpRangeStart": doc.DHCPRangeStart,
+			"dhcpRangeEnd":   doc.DHCPRangeEnd,
+			"updatedAt":      doc.UpdatedAt,
+		}
+	}
+
+	cidrs := make([]string, len(updates))
+	for i, update := range updates {
+		cidrs[i] = update.CIDR
+	}
+	if err := r.purgeDeletedCIDRs(ctx, cidrs); err != nil {
+		return err
+	}
+
+	for i, update := range updates {
+		set := bson.M{
+			"cidr":           update.CIDR,
+			"dhcpRangeStart": update.DHCPRangeStart,
+			"dhcpRangeEnd":   update.DHCPRangeEnd,
+			"updatedAt":      unixOrNow(update.UpdatedAt),
+		}
+		if update.Details != nil {
+			set["details"] = &subnetDetailsRepositoryDocument{
+				Address:     update.Details.Address,
+				Netmask:     update.Details.Netmask,
+				Wildcard:    update.Details.Wildcard,
+				Network:     update.Details.Network,
+				Type:        update.Details.Type,
+				Broadcast:   update.Details.Broadcast,
+				HostMin:     update.Details.HostMin,
+				HostMax:     update.Details.HostMax,
+				HostsPerNet: update.Details.HostsPerNet,
+				IsPublic:    update.Details.IsPublic,
+			}
+		}
+		result, err := r.subnetCollection().UpdateOne(ctx, bson.M{"_id": update.SubnetID, "deletedAt": nil}, bson.M{"$set": set})
+		if err != nil {
+			err = fmt.Errorf("failed to renumber subnet: %w", wrapMongoError(err))
+		} else if result.MatchedCount == 0 {
+			err = fmt.Errorf("subnet %w", ErrNotFound)
+		}
+		if err == nil {
+			continue
+		}
+
+		// Restore in reverse so each previous CIDR is free again when it is written back
+		for j := i - 1; j >= 0; j-- {
+			if _, cleanupErr := r.subnetCollection().UpdateOne(ctx, bson.M{"_id": updates[j].SubnetID}, bson.M{"$set": previous[j]}); cleanupErr != nil {
+				return fmt.Errorf("failed to roll back renumbering after %v: %w", err, cleanupErr)
+			}
+		}
+		return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: err}
+	}
+
+	return nil
+}
+
+// GetSubnetByCIDR retrieves a subnet by its CIDR
+func (r *MongoDBRepository) GetSubnetByCIDR(ctx context.Context, cidr string) (*Subnet, error) {
+	filter := bson.M{"cidr": cidr, "deletedAt": nil}
+
+	var doc subnetRepositoryDocument
+	err := r.subnetCollection().FindOne(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	return r.fromRepositoryDocument(&doc), nil
+}
+
+// UpdateSubnet updates an existing subnet using the repository model
+func (r *MongoDBRepository) UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error {
+	filter := bson.M{"_id": id, "deletedAt": nil}
+	doc := r.toRepositoryDocument(subnet)
+
+	// Remove _id from update document
+	update := bson.M{"$set": doc}
+
+	result, err := r.subnetCollection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update subnet: %w", wrapMongoError(err))
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListSubnets retrieves subnets with filtering using the repository model
+func (r *MongoDBRepository) ListSubnets(ctx context.Context, filters SubnetFilters) (*SubnetList, error) {
+	filter := bson.M{"deletedAt": nil}
 
 	// Apply filters
 	if filters.LocationFilter != "" {
@@ -417,32 +1244,65 @@ func (r *MongoDBRepository) ListSubnets(ctx context.Context, filters SubnetFilte
 	if filters.CloudProvider != "" {
 		filter["cloudInfo.provider"] = filters.CloudProvider
 	}
+	if filters.Environment != "" {
+		filter["environment"] = filters.Environment
+	}
+	switch filters.ManagedBy {
+	case ManagedByCloud:
+		filter["cloudInfo.vpcId"] = bson.M{"$nin": bson.A{nil, ""}}
+	case ManagedByManual:
+		filter["cloudInfo.vpcId"] = bson.M{"$in": bson.A{nil, ""}}
+	}
 	if filters.SearchQuery != "" {
 		filter["$or"] = []bson.M{
 			{"name": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
 			{"cidr": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
 			{"description": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
 			{"location": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
+			{"dnsZone": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
+		}
+	}
+	for key, value := range filters.TagFilter {
+		filter["tags."+key] = value
+	}
+	if filters.IsPublic != nil {
+		if *filters.IsPublic {
+			filter["details.isPublic"] = true
+		} else {
+			// Subnets stored without details count as private
+			filter["details.isPublic"] = bson.M{"$ne": true}
 		}
 	}
+	if filters.PrefixLength != nil {
+		filter["cidr"] = bson.M{"$regex": fmt.Sprintf("/%d$", *filters.PrefixLength)}
+	}
 
 	// Count total records
-	totalCount, err := r.collection.CountDocuments(ctx, filter)
+	totalCount, err := r.subnetCollection().CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count subnets: %w", err)
 	}
 
 	// Build find options
 	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{"createdAt", -1}})
-
-	// Apply pagination
-	if filters.PageSize > 0 {
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}})
+
+	// Apply pagination; CIDR prefix matching happens in Go, so it paginates afterwards
+	if filters.After != nil && filters.CIDRPrefix == "" {
+		createdAt := filters.After.CreatedAt.Unix()
+		filter["$and"] = bson.A{bson.M{"$or": bson.A{
+			bson.M{"createdAt": bson.M{"$lt": createdAt}},
+			bson.M{"createdAt": createdAt, "_id": bson.M{"$lt": filters.After.ID}},
+		}}}
+	}
+	if filters.PageSize > 0 && filters.CIDRPrefix == "" {
 		findOptions.SetLimit(int64(filters.PageSize))
-		findOptions.SetSkip(int64(filters.Page * filters.PageSize))
+		if filters.After == nil {
+			findOptions.SetSkip(int64(filters.Page * filters.PageSize))
+		}
 	}
 
-	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	cursor, err := r.subnetCollection().Find(ctx, filter, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query subnets: %w", err)
 	}
@@ -461,26 +1321,46 @@ func (r *MongoDBRepository) ListSubnets(ctx context.Context, filters SubnetFilte
 		return nil, fmt.Errorf("cursor error: %w", err)
 	}
 
+	if filters.CIDRPrefix != "" {
+		matched, err := filterByCIDRPrefix(subnets, filters.CIDRPrefix)
+		if err != nil {
+			return nil, err
+		}
+		if filters.After != nil {
+			subnets = pageAfterCursor(matched, filters.After, filters.PageSize)
+		} else {
+			subnets = paginateSubnets(matched, filters.Page, filters.PageSize)
+		}
+		totalCount = int64(len(matched))
+	}
+
 	return &SubnetList{
 		Subnets:    subnets,
 		TotalCount: int32(totalCount),
+		NextCursor: nextSubnetCursor(subnets, filters.PageSize),
 	}, nil
 }
 
 // subnetRepositoryDocument represents the MongoDB document structure for repository model
 type subnetRepositoryDocument struct {
-	ID           string                           `bson:"_id"`
-	CIDR         string                           `bson:"cidr"`
-	Name         string                           `bson:"name"`
-	Location     string                           `bson:"location"`
-	LocationType string                           `bson:"locationType"`
-	CloudInfo    *cloudInfoRepositoryDocument     `bson:"cloudInfo,omitempty"`
-	Details      *subnetDetailsRepositoryDocument `bson:"details,omitempty"`
-	Utilization  *utilizationRepositoryDocument   `bson:"utilization,omitempty"`
-	Tags         map[string]string                `bson:"tags,omitempty"`
-	ParentID     string                           `bson:"parentId,omitempty"`
-	CreatedAt    int64                            `bson:"createdAt"`
-	UpdatedAt    int64                            `bson:"updatedAt"`
+	ID                       string                           `bson:"_id"`
+	CIDR                     string                           `bson:"cidr"`
+	Name                     string                           `bson:"name"`
+	Location                 string                           `bson:"location"`
+	LocationType             string                           `bson:"locationType"`
+	Environment              string                           `bson:"environment"`
+	DHCPRangeStart           string                           `bson:"dhcpRangeStart"`
+	DHCPRangeEnd             string                           `bson:"dhcpRangeEnd"`
+	DNSZone                  string                           `bson:"dnsZone"`
+	CloudInfo                *cloudInfoRepositoryDocument     `bson:"cloudInfo,omitempty"`
+	Details                  *subnetDetailsRepositoryDocument `bson:"details,omitempty"`
+	Utilization              *utilizationRepositoryDocument   `bson:"utilization,omitempty"`
+	PrefixUtilizationPercent float64                          `bson:"prefixUtilizationPercent,omitempty"`
+	Tags                     map[string]string                `bson:"tags,omitempty"`
+	ParentID                 string                           `bson:"parentId,omitempty"`
+	ExpiresAt                *int64                           `bson:"expiresAt,omitempty"`
+	CreatedAt                int64                            `bson:"createdAt"`
+	UpdatedAt                int64                            `bson:"updatedAt"`
 }
 
 type cloudInfoRepositoryDocument struct {
@@ -515,15 +1395,24 @@ type utilizationRepositoryDocument struct {
 // toRepositoryDocument converts a repository Subnet to a MongoDB document
 func (r *MongoDBRepository) toRepositoryDocument(subnet *Subnet) *subnetRepositoryDocument {
 	doc := &subnetRepositoryDocument{
-		ID:           subnet.ID,
-		CIDR:         subnet.CIDR,
-		Name:         subnet.Name,
-		Location:     subnet.Location,
-		LocationType: subnet.LocationType,
-		Tags:         subnet.Tags,
-		ParentID:     subnet.ParentID,
-		CreatedAt:    subnet.CreatedAt.Unix(),
-		UpdatedAt:    subnet.UpdatedAt.Unix(),
+		ID:             subnet.ID,
+		CIDR:           subnet.CIDR,
+		Name:           subnet.Name,
+		Location:       subnet.Location,
+		LocationType:   subnet.LocationType,
+		Environment:    subnet.Environment,
+		DHCPRangeStart: subnet.DHCPRangeStart,
+		DHCPRangeEnd:   subnet.DHCPRangeEnd,
+		DNSZone:        subnet.DNSZone,
+		Tags:           subnet.Tags,
+		ParentID:       subnet.ParentID,
+		CreatedAt:      subnet.CreatedAt.Unix(),
+		UpdatedAt:      subnet.UpdatedAt.Unix(),
+	}
+
+	if subnet.ExpiresAt != nil {
+		expiresAt := subnet.ExpiresAt.Unix()
+		doc.ExpiresAt = &expiresAt
 	}
 
 	if subnet.CloudInfo != nil {
@@ -559,6 +1448,7 @@ func (r *MongoDBRepository) toRepositoryDocument(subnet *Subnet) *subnetReposito
 			UtilizationPercent: subnet.Utilization.UtilizationPercent,
 			LastUpdated:        subnet.Utilization.LastUpdated.Unix(),
 		}
+		doc.PrefixUtilizationPercent = subnet.Utilization.PrefixUtilizationPercent
 	}
 
 	return doc
@@ -567,15 +1457,24 @@ func (r *MongoDBRepository) toRepositoryDocument(subnet *Subnet) *subnetReposito
 // fromRepositoryDocument converts a MongoDB document to a repository Subnet
 func (r *MongoDBRepository) fromRepositoryDocument(doc *subnetRepositoryDocument) *Subnet {
 	subnet := &Subnet{
-		ID:           doc.ID,
-		CIDR:         doc.CIDR,
-		Name:         doc.Name,
-		Location:     doc.Location,
-		LocationType: doc.LocationType,
-		Tags:         doc.Tags,
-		ParentID:     doc.ParentID,
-		CreatedAt:    time.Unix(doc.CreatedAt, 0),
-		UpdatedAt:    time.Unix(doc.UpdatedAt, 0),
+		ID:             doc.ID,
+		CIDR:           doc.CIDR,
+		Name:           doc.Name,
+		Location:       doc.Location,
+		LocationType:   doc.LocationType,
+		Environment:    doc.Environment,
+		DHCPRangeStart: doc.DHCPRangeStart,
+		DHCPRangeEnd:   doc.DHCPRangeEnd,
+		DNSZone:        doc.DNSZone,
+		Tags:           doc.Tags,
+		ParentID:       doc.ParentID,
+		CreatedAt:      time.Unix(doc.CreatedAt, 0),
+		UpdatedAt:      time.Unix(doc.UpdatedAt, 0),
+	}
+
+	if doc.ExpiresAt != nil {
+		expiresAt := time.Unix(*doc.ExpiresAt, 0)
+		subnet.ExpiresAt = &expiresAt
 	}
 
 	if doc.CloudInfo != nil {
@@ -612,18 +1511,24 @@ func (r *MongoDBRepository) fromRepositoryDocument(doc *subnetRepositoryDocument
 			LastUpdated:        time.Unix(doc.Utilization.LastUpdated, 0),
 		}
 	}
+	if doc.PrefixUtilizationPercent != 0 {
+		if subnet.Utilization == nil {
+			subnet.Utilization = &Utilization{}
+		}
+		subnet.Utilization.PrefixUtilizationPercent = doc.PrefixUtilizationPercent
+	}
 
 	return subnet
 }
 
 // GetSubnetChildren retrieves child subnets for a given parent subnet ID
 func (r *MongoDBRepository) GetSubnetChildren(ctx context.Context, parentID string) ([]*Subnet, error) {
-	filter := bson.M{"parentId": parentID}
+	filter := bson.M{"parentId": parentID, "deletedAt": nil}
 
 	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{"cidr", 1}})
+	findOptions.SetSort(bson.D{{Key: "cidr", Value: 1}})
 
-	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	cursor, err := r.subnetCollection().Find(ctx, filter, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query child subnets: %w", err)
 	}
@@ -645,14 +1550,213 @@ func (r *MongoDBRepository) GetSubnetChildren(ctx context.Context, parentID stri
 	return subnets, nil
 }
 
+// GetSubnetSiblings retrieves a page of the subnets sharing parentID with the
+// subnet id, excluding that subnet. An empty parentID lists top-level subnets.
+func (r *MongoDBRepository) GetSubnetSiblings(ctx context.Context, id, parentID string, page, pageSize int32) (*SubnetList, error) {
+	filter := bson.M{"_id": bson.M{"$ne": id}, "deletedAt": nil}
+	if parentID == "" {
+		// Top-level subnets are stored without a parentId
+		filter["parentId"] = bson.M{"$in": bson.A{nil, ""}}
+	} else {
+		filter["parentId"] = parentID
+	}
+
+	totalCount, err := r.subnetCollection().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sibling subnets: %w", err)
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "cidr", Value: 1}, {Key: "_id", Value: 1}})
+	if pageSize > 0 {
+		findOptions.SetLimit(int64(pageSize))
+		findOptions.SetSkip(int64(page * pageSize))
+	}
+
+	cursor, err := r.subnetCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sibling subnets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subnets []*Subnet
+	for cursor.Next(ctx) {
+		var doc subnetRepositoryDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode sibling subnet: %w", err)
+		}
+		subnets = append(subnets, r.fromRepositoryDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return &SubnetList{Subnets: subnets, TotalCount: int32(totalCount)}, nil
+}
+
+// GetChildRollups aggregates the utilization of the direct children of each
+// parent in a single grouped query. Parents without children are omitted.
+func (r *MongoDBRepository) GetChildRollups(ctx context.Context, parentIDs []string) (map[string]*ChildRollup, error) {
+	rollups := make(map[string]*ChildRollup)
+	if len(parentIDs) == 0 {
+		return rollups, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"parentId": bson.M{"$in": parentIDs}, "deletedAt": nil}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          "$parentId",
+			"childCount":   bson.M{"$sum": 1},
+			"totalIps":     bson.M{"$sum": bson.M{"$ifNull": bson.A{"$utilization.totalIps", 0}}},
+			"allocatedIps": bson.M{"$sum": bson.M{"$ifNull": bson.A{"$utilization.allocatedIps", 0}}},
+		}}},
+	}
+
+	cursor, err := r.subnetCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child rollups: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ParentID     string `bson:"_id"`
+			ChildCount   int32  `bson:"childCount"`
+			TotalIPs     int64  `bson:"totalIps"`
+			AllocatedIPs int64  `bson:"allocatedIps"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode child rollup: %w", err)
+		}
+		rollups[doc.ParentID] = newChildRollup(doc.ChildCount, doc.TotalIPs, doc.AllocatedIPs)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return rollups, nil
+}
+
+// CountSubnetsByEnvironment counts subnets per environment. Subnets without an
+// environment are counted under the empty string.
+func (r *MongoDBRepository) CountSubnetsByEnvironment(ctx context.Context) (map[string]int32, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deletedAt": nil}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{"$environment", ""}},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := r.subnetCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets by environment: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int32)
+	for cursor.Next(ctx) {
+		var doc struct {
+			Environment string `bson:"_id"`
+			Count       int32  `bson:"count"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode environment count: %w", err)
+		}
+		counts[doc.Environment] += doc.Count
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CountSubnetsByPrefixLength counts subnets per CIDR prefix length. Documents
+// whose CIDR has no prefix length are skipped.
+func (r *MongoDBRepository) CountSubnetsByPrefixLength(ctx context.Context) (map[int32]int32, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deletedAt": nil}}},
+		{{Key: "$project", Value: bson.M{
+			"prefixLength": bson.M{"$convert": bson.M{
+				"input":   bson.M{"$arrayElemAt": bson.A{bson.M{"$split": bson.A{"$cidr", "/"}}, 1}},
+				"to":      "int",
+				"onError": nil,
+				"onNull":  nil,
+			}},
+		}}},
+		{{Key: "$match", Value: bson.M{"prefixLength": bson.M{"$ne": nil}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$prefixLength",
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := r.subnetCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets by prefix length: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[int32]int32)
+	for cursor.Next(ctx) {
+		var doc struct {
+			PrefixLength int32 `bson:"_id"`
+			Count        int32 `bson:"count"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode prefix length count: %w", err)
+		}
+		counts[doc.PrefixLength] = doc.Count
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return counts, nil
+}
+
+// FindOverlappingSubnets retrieves subnets in a location whose CIDR overlaps the given CIDR
+func (r *MongoDBRepository) FindOverlappingSubnets(ctx context.Context, cidr, location string) ([]*Subnet, error) {
+	filter := bson.M{"location": location, "deletedAt": nil}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "cidr", Value: 1}})
+
+	cursor, err := r.subnetCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subnets []*Subnet
+	for cursor.Next(ctx) {
+		var doc subnetRepositoryDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode subnet: %w", err)
+		}
+		subnets = append(subnets, r.fromRepositoryDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return filterOverlapping(subnets, cidr)
+}
+
 // GetSubnetByID retrieves a subnet by its ID using repository models
 func (r *MongoDBRepository) GetSubnetByID(ctx context.Context, id string) (*Subnet, error) {
-	filter := bson.M{"_id": id}
+	filter := bson.M{"_id": id, "deletedAt": nil}
 
 	var doc subnetRepositoryDocument
-	err := r.collection.FindOne(ctx, filter).Decode(&doc)
+	err := r.subnetCollection().FindOne(ctx, filter).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("subnet not found")
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
@@ -660,3 +1764,504 @@ func (r *MongoDBRepository) GetSubnetByID(ctx context.Context, id string) (*Subn
 
 	return r.fromRepositoryDocument(&doc), nil
 }
+
+// subnetNoteDocument represents the MongoDB document structure for a subnet note
+type subnetNoteDocument struct {
+	ID        string `bson:"_id"`
+	SubnetID  string `bson:"subnetId"`
+	Author    string `bson:"author"`
+	Text      string `bson:"text"`
+	CreatedAt int64  `bson:"createdAt"`
+}
+
+// CreateSubnetNote appends a note to a subnet
+func (r *MongoDBRepository) CreateSubnetNote(ctx context.Context, note *SubnetNote) error {
+	doc := &subnetNoteDocument{
+		ID:        note.ID,
+		SubnetID:  note.SubnetID,
+		Author:    note.Author,
+		Text:      note.Text,
+		CreatedAt: note.CreatedAt.UnixNano(),
+	}
+
+	if _, err := r.notesCollection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("failed to create subnet note: %w", err)
+	}
+
+	return nil
+}
+
+// ListSubnetNotes retrieves the notes of a subnet in the order they were added
+func (r *MongoDBRepository) ListSubnetNotes(ctx context.Context, subnetID string) ([]*SubnetNote, error) {
+	filter := bson.M{"subnetId": subnetID}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := r.notesCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnet notes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var notes []*SubnetNote
+	for cursor.Next(ctx) {
+		var doc subnetNoteDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode subnet note: %w", err)
+		}
+		notes = append(notes, &SubnetNote{
+			ID:        doc.ID,
+			SubnetID:  doc.SubnetID,
+			Author:    doc.Author,
+			Text:      doc.Text,
+			CreatedAt: time.Unix(0, doc.CreatedAt),
+		})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return notes, nil
+}
+
+// ipAllocationDocument represents the MongoDB document structure for an IP allocation
+type ipAllocationDocument struct {
+	SubnetID    string `bson:"subnetId"`
+	IP          string `bson:"ip"`
+	Hostname    string `bson:"hostname,omitempty"`
+	Description string `bson:"description,omitempty"`
+	CreatedAt   int64  `bson:"createdAt"`
+}
+
+// AllocateIP records an IP address as allocated inside a subnet
+func (r *MongoDBRepository) AllocateIP(ctx context.Context, subnetID, ip, hostname, description string) (*IPAllocation, error) {
+	allocation := &IPAllocation{
+		SubnetID:    subnetID,
+		IP:          ip,
+		Hostname:    hostname,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+
+	doc := &ipAllocationDocument{
+		SubnetID:    allocation.SubnetID,
+		IP:          allocation.IP,
+		Hostname:    allocation.Hostname,
+		Description: allocation.Description,
+		CreatedAt:   allocation.CreatedAt.UnixNano(),
+	}
+
+	if _, err := r.allocationsCollection.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("IP %s is already allocated in subnet %s: %w", ip, subnetID, ErrDuplicate)
+		}
+		return nil, fmt.Errorf("failed to allocate IP: %w", err)
+	}
+
+	return allocation, nil
+}
+
+// ReleaseIP removes an IP allocation from a subnet
+func (r *MongoDBRepository) ReleaseIP(ctx context.Context, subnetID, ip string) error {
+	result, err := r.allocationsCollection.DeleteOne(ctx, bson.M{"subnetId": subnetID, "ip": ip})
+	if err != nil {
+		return fmt.Errorf("failed to release IP: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("allocation %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListAllocations retrieves the IP allocations of a subnet in the order they were made
+func (r *MongoDBRepository) ListAllocations(ctx context.Context, subnetID string) ([]*IPAllocation, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	return r.findAllocations(ctx, bson.M{"subnetId": subnetID}, findOptions)
+}
+
+// ListAllIPAllocations retrieves a page of IP allocations across subnets in
+// the order they were made
+func (r *MongoDBRepository) ListAllIPAllocations(ctx context.Context, filters IPAllocationFilters) (*IPAllocationList, error) {
+	// Allocations of soft-deleted subnets are kept so that restoring the
+	// subnet brings them back
+	deleted, err := r.subnetCollection().Distinct(ctx, "_id", bson.M{"deletedAt": bson.M{"$ne": nil}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deleted subnets: %w", err)
+	}
+	subnetFilter := bson.M{}
+	if len(deleted) > 0 {
+		subnetFilter["$nin"] = deleted
+	}
+	if filters.SubnetID != "" {
+		subnetFilter["$eq"] = filters.SubnetID
+	}
+
+	filter := bson.M{}
+	if len(subnetFilter) > 0 {
+		filter["subnetId"] = subnetFilter
+	}
+	if filters.Hostname != "" {
+		filter["hostname"] = filters.Hostname
+	}
+	if filters.SearchQuery != "" {
+		filter["$or"] = []bson.M{
+			{"ip": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
+			{"hostname": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
+			{"description": bson.M{"$regex": filters.SearchQuery, "$options": "i"}},
+		}
+	}
+
+	totalCount, err := r.allocationsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count IP allocations: %w", err)
+	}
+
+	limit := filters.PageSize
+	if limit <= 0 {
+		limit = 50 // Default page size
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(filters.Page * limit))
+
+	allocations, err := r.findAllocations(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPAllocationList{
+		Allocations: allocations,
+		TotalCount:  int32(totalCount),
+	}, nil
+}
+
+// findAllocations decodes the IP allocation documents matching filter
+func (r *MongoDBRepository) findAllocations(ctx context.Context, filter bson.M, findOptions *options.FindOptions) ([]*IPAllocation, error) {
+	cursor, err := r.allocationsCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IP allocations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var allocations []*IPAllocation
+	for cursor.Next(ctx) {
+		var doc ipAllocationDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode IP allocation: %w", err)
+		}
+		allocations = append(allocations, &IPAllocation{
+			SubnetID:    doc.SubnetID,
+			IP:          doc.IP,
+			Hostname:    doc.Hostname,
+			Description: doc.Description,
+			CreatedAt:   time.Unix(0, doc.CreatedAt),
+		})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return allocations, nil
+}
+
+// reservedRangeDocument represents the MongoDB document structure for a reserved range
+type reservedRangeDocument struct {
+	ID        string `bson:"_id"`
+	SubnetID  string `bson:"subnetId"`
+	StartIP   string `bson:"startIp"`
+	EndIP     string `bson:"endIp"`
+	Reason    string `bson:"reason,omitempty"`
+	CreatedAt int64  `bson:"createdAt"`
+}
+
+// CreateReservedRange stores an address range excluded from IP allocation
+func (r *MongoDBRepository) CreateReservedRange(ctx context.Context, reservation *ReservedRange) error {
+	doc := &reservedRangeDocument{
+		ID:        reservation.ID,
+		SubnetID:  reservation.SubnetID,
+		StartIP:   reservation.StartIP,
+		EndIP:     reservation.EndIP,
+		Reason:    reservation.Reason,
+		CreatedAt: reservation.CreatedAt.UnixNano(),
+	}
+
+	if _, err := r.reservationsCollection.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("reserved range %s: %w", reservation.ID, ErrDuplicate)
+		}
+		return fmt.Errorf("failed to create reserved range: %w", err)
+	}
+
+	return nil
+}
+
+// ListReservedRanges retrieves the reserved ranges of a subnet in the order they were created
+func (r *MongoDBRepository) ListReservedRanges(ctx context.Context, subnetID string) ([]*ReservedRange, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := r.reservationsCollection.Find(ctx, bson.M{"subnetId": subnetID}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reserved ranges: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var reservations []*ReservedRange
+	for cursor.Next(ctx) {
+		var doc reservedRangeDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode reserved range: %w", err)
+		}
+		reservations = append(reservations, &ReservedRange{
+			ID:        doc.ID,
+			SubnetID:  doc.SubnetID,
+			StartIP:   doc.StartIP,
+			EndIP:     doc.EndIP,
+			Reason:    doc.Reason,
+			CreatedAt: time.Unix(0, doc.CreatedAt),
+		})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return reservations, nil
+}
+
+// DeleteReservedRange removes a reserved range from a subnet
+func (r *MongoDBRepository) DeleteReservedRange(ctx context.Context, subnetID, id string) error {
+	result, err := r.reservationsCollection.DeleteOne(ctx, bson.M{"_id": id, "subnetId": subnetID})
+	if err != nil {
+		return fmt.Errorf("failed to delete reserved range: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("reserved range %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// utilizationSampleDocument represents the MongoDB document structure for a utilization sample
+type utilizationSampleDocument struct {
+	SubnetID     string  `bson:"subnetId"`
+	Percent      float64 `bson:"percent"`
+	TotalIPs     int32   `bson:"totalIps"`
+	AllocatedIPs int32   `bson:"allocatedIps"`
+	RecordedAt   int64   `bson:"recordedAt"`
+}
+
+func toUtilizationSampleDocument(subnetID string, sample *UtilizationSample) *utilizationSampleDocument {
+	return &utilizationSampleDocument{
+		SubnetID:     subnetID,
+		Percent:      sample.Percent,
+		TotalIPs:     sample.TotalIPs,
+		AllocatedIPs: sample.AllocatedIPs,
+		RecordedAt:   sample.RecordedAt.Unix(),
+	}
+}
+
+// CreateUtilizationSample appends a utilization sample to a subnet's history
+func (r *MongoDBRepository) CreateUtilizationSample(ctx context.Context, sample *UtilizationSample) error {
+	if _, err := r.historyCollection.InsertOne(ctx, toUtilizationSampleDocument(sample.SubnetID, sample)); err != nil {
+		return fmt.Errorf("failed to create utilization sample: %w", err)
+	}
+
+	return nil
+}
+
+// ListUtilizationHistory retrieves a subnet's samples recorded in [from, to), oldest first.
+// A zero from or to leaves that end of the range open.
+func (r *MongoDBRepository) ListUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time) ([]*UtilizationSample, error) {
+	filter := bson.M{"subnetId": subnetID}
+
+	recordedAt := bson.M{}
+	if !from.IsZero() {
+		recordedAt["$gte"] = from.Unix()
+	}
+	if !to.IsZero() {
+		recordedAt["$lt"] = to.Unix()
+	}
+	if len(recordedAt) > 0 {
+		filter["recordedAt"] = recordedAt
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "recordedAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.historyCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utilization history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var samples []*UtilizationSample
+	for cursor.Next(ctx) {
+		var doc utilizationSampleDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode utilization sample: %w", err)
+		}
+		samples = append(samples, &UtilizationSample{
+			SubnetID:     doc.SubnetID,
+			Percent:      doc.Percent,
+			TotalIPs:     doc.TotalIPs,
+			AllocatedIPs: doc.AllocatedIPs,
+			RecordedAt:   time.Unix(doc.RecordedAt, 0),
+		})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return samples, nil
+}
+
+// ListUtilizationHistorySubnetIDs retrieves the IDs of all subnets that have recorded history
+func (r *MongoDBRepository) ListUtilizationHistorySubnetIDs(ctx context.Context) ([]string, error) {
+	values, err := r.historyCollection.Distinct(ctx, "subnetId", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utilization history subnets: %w", err)
+	}
+
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// ReplaceUtilizationHistory replaces a subnet's samples recorded in [from, to).
+// Standalone MongoDB has no multi-document transactions, so the delete and
+// insert are not atomic; a failed insert leaves the range empty.
+func (r *MongoDBRepository) ReplaceUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time, samples []*UtilizationSample) error {
+	filter := bson.M{
+		"subnetId":   subnetID,
+		"recordedAt": bson.M{"$gte": from.Unix(), "$lt": to.Unix()},
+	}
+
+	if _, err := r.historyCollection.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete utilization history: %w", err)
+	}
+
+	if len(samples) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(samples))
+	for i, sample := range samples {
+		docs[i] = toUtilizationSampleDocument(subnetID, sample)
+	}
+
+	if _, err := r.historyCollection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to insert utilization history: %w", err)
+	}
+
+	return nil
+}
+
+// PruneUtilizationHistory deletes a subnet's oldest samples so at most keep remain
+func (r *MongoDBRepository) PruneUtilizationHistory(ctx context.Context, subnetID string, keep int) error {
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "recordedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(keep)).
+		SetProjection(bson.M{"_id": 1})
+
+	cursor, err := r.historyCollection.Find(ctx, bson.M{"subnetId": subnetID}, findOptions)
+	if err != nil {
+		return fmt.Errorf("failed to query utilization history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var ids []interface{}
+	for cursor.Next(ctx) {
+		ids = append(ids, cursor.Current.Lookup("_id"))
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("cursor error: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := r.historyCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return fmt.Errorf("failed to prune utilization history: %w", err)
+	}
+
+	return nil
+}
+
+// idempotentResultDocument represents the MongoDB document structure for an
+// idempotency key. ExpiresAt is a BSON date so a TTL index can expire it.
+type idempotentResultDocument struct {
+	Scope      string    `bson:"scope"`
+	Key        string    `bson:"key"`
+	ResourceID string    `bson:"resourceId"`
+	CreatedAt  int64     `bson:"createdAt"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+// GetIdempotentResult returns the unexpired result saved for an idempotency key
+func (r *MongoDBRepository) GetIdempotentResult(ctx context.Context, scope, key string, now time.Time) (*IdempotentResult, error) {
+	filter := bson.M{"scope": scope, "key": key, "expiresAt": bson.M{"$gt": now}}
+
+	var doc idempotentResultDocument
+	err := r.idempotencyCollection.FindOne(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("idempotency key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return &IdempotentResult{
+		Scope:      doc.Scope,
+		Key:        doc.Key,
+		ResourceID: doc.ResourceID,
+		CreatedAt:  time.Unix(doc.CreatedAt, 0),
+		ExpiresAt:  doc.ExpiresAt,
+	}, nil
+}
+
+// SaveIdempotentResult stores the result of a request made with an
+// idempotency key, replacing a result that has expired but that the TTL
+// monitor has not removed yet
+func (r *MongoDBRepository) SaveIdempotentResult(ctx context.Context, result *IdempotentResult) error {
+	createdAt := unixOrNow(result.CreatedAt)
+
+	expired := bson.M{"scope": result.Scope, "key": result.Key, "expiresAt": bson.M{"$lte": time.Unix(createdAt, 0)}}
+	if _, err := r.idempotencyCollection.DeleteOne(ctx, expired); err != nil {
+		return fmt.Errorf("failed to purge expired idempotency key: %w", err)
+	}
+
+	doc := &idempotentResultDocument{
+		Scope:      result.Scope,
+		Key:        result.Key,
+		ResourceID: result.ResourceID,
+		CreatedAt:  createdAt,
+		ExpiresAt:  result.ExpiresAt,
+	}
+
+	if _, err := r.idempotencyCollection.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("idempotency key %q is already in use: %w", result.Key, ErrDuplicate)
+		}
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	return nil
+}
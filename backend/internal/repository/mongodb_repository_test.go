@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestConnectionDocumentRoundTrip(t *testing.T) {
+	connection := &Connection{
+		ID:             "conn-1",
+		SourceSubnetID: "subnet-a",
+		TargetSubnetID: "subnet-b",
+		ConnectionType: "vpn",
+		Status:         "active",
+		Name:           "Site link",
+		Latency:        12,
+		Cost:           3.5,
+		Metadata: map[string]interface{}{
+			"owner": "netops",
+			"peer": map[string]interface{}{
+				"asn":   int32(65001),
+				"hosts": []interface{}{"a", "b"},
+			},
+		},
+		CreatedAt: time.Unix(1700000000, 0),
+		UpdatedAt: time.Unix(1700000060, 0),
+	}
+
+	raw, err := bson.Marshal(toConnectionDocument(connection.ID, connection))
+	if err != nil {
+		t.Fatalf("Failed to marshal connection: %v", err)
+	}
+
+	// Metadata is stored as a native document, not a JSON string
+	var stored bson.M
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatalf("Failed to unmarshal raw document: %v", err)
+	}
+	if _, ok := stored["metadata"].(bson.M); !ok {
+		t.Errorf("Expected metadata stored as a document, got %T", stored["metadata"])
+	}
+
+	var doc connectionDocument
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Failed to unmarshal connection: %v", err)
+	}
+
+	got := fromConnectionDocument(&doc)
+	if !reflect.DeepEqual(got, connection) {
+		t.Errorf("Round trip mismatch:\ngot  %+v\nwant %+v", got, connection)
+	}
+}
+
+func TestSubnetCollection(t *testing.T) {
+	// Connect does not dial the server, so no MongoDB is needed here
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	repo := newMongoDBRepository(client, MongoDBOptions{}.withDefaults())
+
+	collection := repo.subnetCollection()
+	if collection.Name() != "subnets" || collection.Database().Name() != "ipam" {
+		t.Errorf("Expected ipam.subnets, got %s.%s", collection.Database().Name(), collection.Name())
+	}
+}
+
+func TestMongoDBOptionsDefaults(t *testing.T) {
+	got := MongoDBOptions{Database: "ipam_staging"}.withDefaults()
+	want := MongoDBOptions{Database: "ipam_staging", Collection: "subnets", ConnectionsCollection: "connections"}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	repo := newMongoDBRepository(client, MongoDBOptions{Database: "ipam_staging", CollectionPrefix: "staging_"}.withDefaults())
+	collection := repo.subnetCollection()
+	if collection.Name() != "staging_subnets" || collection.Database().Name() != "ipam_staging" {
+		t.Errorf("Expected ipam_staging.staging_subnets, got %s.%s", collection.Database().Name(), collection.Name())
+	}
+}
+
+// TestMongoDBRepository_CustomNames needs a MongoDB server in
+// IPAM_TEST_MONGODB_URL and is skipped otherwise
+func TestMongoDBRepository_CustomNames(t *testing.T) {
+	connectionString := os.Getenv("IPAM_TEST_MONGODB_URL")
+	if connectionString == "" {
+		t.Skip("IPAM_TEST_MONGODB_URL not set, skipping MongoDB integration test")
+	}
+
+	opts := MongoDBOptions{
+		Database:              "ipam_test_custom_names",
+		Collection:            "custom_subnets",
+		ConnectionsCollection: "custom_connections",
+	}
+	repo, err := NewMongoDBRepository(connectionString, opts)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	db := repo.client.Database(opts.Database)
+	defer db.Drop(ctx)
+
+	for _, subnet := range []*Subnet{
+		{ID: "custom-a", CIDR: "10.90.0.0/24", Name: "A", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ID: "custom-b", CIDR: "10.90.1.0/24", Name: "B", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	} {
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+	connection := &Connection{ID: "custom-conn", SourceSubnetID: "custom-a", TargetSubnetID: "custom-b", ConnectionType: "vpn", Status: "active", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := repo.CreateConnection(ctx, connection); err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+
+	if count, err := db.Collection("custom_subnets").CountDocuments(ctx, bson.M{}); err != nil || count != 2 {
+		t.Errorf("Expected 2 subnets in %s.custom_subnets, got %d (%v)", opts.Database, count, err)
+	}
+	if count, err := db.Collection("custom_connections").CountDocuments(ctx, bson.M{}); err != nil || count != 1 {
+		t.Errorf("Expected 1 connection in %s.custom_connections, got %d (%v)", opts.Database, count, err)
+	}
+	if count, err := repo.client.Database("ipam").Collection("subnets").CountDocuments(ctx, bson.M{"_id": "custom-a"}); err != nil || count != 0 {
+		t.Errorf("Expected nothing written to ipam.subnets, got %d (%v)", count, err)
+	}
+}
+
+// TestMongoDBRepository_CollectionPrefix needs a MongoDB server in
+// IPAM_TEST_MONGODB_URL and is skipped otherwise
+func TestMongoDBRepository_CollectionPrefix(t *testing.T) {
+	connectionString := os.Getenv("IPAM_TEST_MONGODB_URL")
+	if connectionString == "" {
+		t.Skip("IPAM_TEST_MONGODB_URL not set, skipping MongoDB integration test")
+	}
+
+	ctx := context.Background()
+	repos := make(map[string]*MongoDBRepository)
+	for _, prefix := range []string{"dev_", "prod_"} {
+		repo, err := NewMongoDBRepository(connectionString, MongoDBOptions{Database: "ipam_test_collection_prefix", CollectionPrefix: prefix})
+		if err != nil {
+			t.Fatalf("Failed to create %s repository: %v", prefix, err)
+		}
+		defer repo.Close()
+		repos[prefix] = repo
+	}
+	db := repos["dev_"].client.Database("ipam_test_collection_prefix")
+	defer db.Drop(ctx)
+
+	// The same ID and CIDR would collide if the environments shared collections
+	for prefix, repo := range repos {
+		subnet := &Subnet{ID: "web", CIDR: "10.91.0.0/24", Name: prefix, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s subnet: %v", prefix, err)
+		}
+	}
+
+	for prefix, repo := range repos {
+		if subnet, err := repo.GetSubnetByID(ctx, "web"); err != nil || subnet.Name != prefix {
+			t.Errorf("Expected %s to read its own subnet, got %+v (%v)", prefix, subnet, err)
+		}
+		if count, err := db.Collection(prefix+"subnets").CountDocuments(ctx, bson.M{}); err != nil || count != 1 {
+			t.Errorf("Expected 1 subnet in %ssubnets, got %d (%v)", prefix, count, err)
+		}
+	}
+}
+
+func TestIsIndexConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"options conflict", mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}, true},
+		{"key specs conflict", mongo.CommandError{Code: 86, Name: "IndexKeySpecsConflict"}, true},
+		{"already exists", mongo.CommandError{Code: 68, Name: "IndexAlreadyExists"}, true},
+		{"unauthorized", mongo.CommandError{Code: 13, Name: "Unauthorized"}, false},
+		{"not a server error", errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIndexConflict(tt.err); got != tt.want {
+				t.Errorf("isIndexConflict(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMongoDBRepository_ReopenWithConflictingIndex needs a MongoDB server in
+// IPAM_TEST_MONGODB_URL and is skipped otherwise
+func TestMongoDBRepository_ReopenWithConflictingIndex(t *testing.T) {
+	connectionString := os.Getenv("IPAM_TEST_MONGODB_URL")
+	if connectionString == "" {
+		t.Skip("IPAM_TEST_MONGODB_URL not set, skipping MongoDB integration test")
+	}
+
+	first, err := NewMongoDBRepository(connectionString, MongoDBOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer first.Close()
+
+	// Same keys as idx_location under another name, as left by an older release
+	ctx := context.Background()
+	indexes := first.subnetCollection().Indexes()
+	if _, err := indexes.DropOne(ctx, "idx_location"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	legacy := mongo.IndexModel{Keys: bson.D{{Key: "location", Value: 1}}, Options: options.Index().SetName("location_legacy")}
+	if _, err := indexes.CreateOne(ctx, legacy); err != nil {
+		t.Fatalf("Failed to create legacy index: %v", err)
+	}
+	defer func() {
+		indexes.DropOne(ctx, "location_legacy")
+		indexes.CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "location", Value: 1}}, Options: options.Index().SetName("idx_location")})
+	}()
+
+	second, err := NewMongoDBRepository(connectionString, MongoDBOptions{})
+	if err != nil {
+		t.Fatalf("Expected reopening with a conflicting index to succeed, got %v", err)
+	}
+	second.Close()
+}
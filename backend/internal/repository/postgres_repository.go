@@ -0,0 +1,2082 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/bananaops/ipam-bananaops/proto"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgreSQL error codes for constraint violations
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// PostgresRepository implements SubnetRepository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgreSQL repository
+func NewPostgresRepository(connectionString string) (*PostgresRepository, error) {
+	// Open database connection
+	db, err := sql.Open("pgx", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	repo := &PostgresRepository{db: db}
+
+	// Initialize schema
+	if err := repo.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return repo, nil
+}
+
+// postgresMigrations upgrade the PostgreSQL schema in order, mirroring
+// sqliteMigrations. Change the schema by appending a migration with the next
+// version; never edit one that has shipped.
+var postgresMigrations = []migration{
+	{Version: 1, Description: "initial schema", Up: postgresInitialSchema},
+	{Version: 2, Description: "subnet expiry", Up: postgresSubnetExpiry},
+	{Version: 3, Description: "connection pair index", Up: postgresConnectionPairIndex},
+	{Version: 4, Description: "reserved ranges", Up: postgresReservedRanges},
+	{Version: 5, Description: "subnet DNS zone", Up: postgresSubnetDNSZone},
+	{Version: 6, Description: "IP allocation hostname", Up: postgresAllocationHostname},
+}
+
+// initSchema brings the database schema up to date
+func (r *PostgresRepository) initSchema() error {
+	return runMigrations(context.Background(), r.db, postgresMigrationDialect, postgresMigrations)
+}
+
+// postgresInitialSchema creates the schema as it stood when migrations were
+// introduced; databases created before then only gain what is missing. It
+// mirrors the SQLite schema; parent_id is not a foreign key because SQLite
+// does not enforce it either.
+func postgresInitialSchema(ctx context.Context, tx *sql.Tx) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS subnets (
+		id TEXT PRIMARY KEY,
+		cidr TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT,
+		location TEXT,
+		location_type TEXT,
+		cloud_provider TEXT,
+		cloud_region TEXT,
+		cloud_account_id TEXT,
+		cloud_resource_type TEXT,
+		cloud_vpc_id TEXT,
+		cloud_subnet_id TEXT,
+		parent_id TEXT,
+		environment TEXT,
+		dhcp_range_start TEXT,
+		dhcp_range_end TEXT,
+		address TEXT,
+		netmask TEXT,
+		wildcard TEXT,
+		network TEXT,
+		type TEXT,
+		broadcast TEXT,
+		host_min TEXT,
+		host_max TEXT,
+		hosts_per_net INTEGER,
+		is_public INTEGER,
+		total_ips INTEGER,
+		allocated_ips INTEGER,
+		utilization_percent DOUBLE PRECISION,
+		created_at BIGINT,
+		updated_at BIGINT
+	);
+
+	CREATE TABLE IF NOT EXISTS connections (
+		id TEXT PRIMARY KEY,
+		source_subnet_id TEXT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+		target_subnet_id TEXT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+		connection_type TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'active',
+		name TEXT NOT NULL,
+		description TEXT,
+		bandwidth TEXT,
+		latency INTEGER,
+		cost DOUBLE PRECISION,
+		metadata TEXT, -- JSON string for additional metadata
+		created_at BIGINT,
+		updated_at BIGINT
+	);
+
+	CREATE TABLE IF NOT EXISTS subnet_notes (
+		seq BIGSERIAL,
+		id TEXT PRIMARY KEY,
+		subnet_id TEXT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+		author TEXT NOT NULL,
+		text TEXT NOT NULL,
+		created_at BIGINT
+	);
+
+	CREATE TABLE IF NOT EXISTS ip_allocations (
+		seq BIGSERIAL,
+		subnet_id TEXT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+		ip TEXT NOT NULL,
+		description TEXT,
+		created_at BIGINT,
+		PRIMARY KEY (subnet_id, ip)
+	);
+
+	CREATE TABLE IF NOT EXISTS subnet_tags (
+		subnet_id TEXT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (subnet_id, key)
+	);
+
+	CREATE TABLE IF NOT EXISTS utilization_history (
+		seq BIGSERIAL,
+		subnet_id TEXT NOT NULL,
+		percent DOUBLE PRECISION NOT NULL,
+		total_ips INTEGER,
+		allocated_ips INTEGER,
+		recorded_at BIGINT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		scope TEXT NOT NULL,
+		key TEXT NOT NULL,
+		resource_id TEXT NOT NULL,
+		created_at BIGINT,
+		expires_at BIGINT NOT NULL,
+		PRIMARY KEY (scope, key)
+	);
+
+	-- Columns added after the first release
+	ALTER TABLE subnets ADD COLUMN IF NOT EXISTS environment TEXT;
+	ALTER TABLE subnets ADD COLUMN IF NOT EXISTS deleted_at BIGINT;
+	ALTER TABLE subnets ADD COLUMN IF NOT EXISTS dhcp_range_start TEXT;
+	ALTER TABLE subnets ADD COLUMN IF NOT EXISTS dhcp_range_end TEXT;
+	ALTER TABLE subnets ADD COLUMN IF NOT EXISTS prefix_utilization_percent DOUBLE PRECISION;
+	ALTER TABLE subnets ADD COLUMN IF NOT EXISTS cloud_last_seen_at BIGINT;
+
+	CREATE INDEX IF NOT EXISTS idx_subnets_location ON subnets(location);
+	CREATE INDEX IF NOT EXISTS idx_subnets_cloud_provider ON subnets(cloud_provider);
+	CREATE INDEX IF NOT EXISTS idx_subnets_cidr ON subnets(cidr);
+	CREATE INDEX IF NOT EXISTS idx_subnets_parent_id ON subnets(parent_id);
+	CREATE INDEX IF NOT EXISTS idx_subnets_deleted_at ON subnets(deleted_at);
+	CREATE INDEX IF NOT EXISTS idx_subnets_cloud_resource_type ON subnets(cloud_resource_type);
+	CREATE INDEX IF NOT EXISTS idx_subnets_environment ON subnets(environment);
+
+	CREATE INDEX IF NOT EXISTS idx_connections_source ON connections(source_subnet_id);
+	CREATE INDEX IF NOT EXISTS idx_connections_target ON connections(target_subnet_id);
+	CREATE INDEX IF NOT EXISTS idx_connections_type ON connections(connection_type);
+	CREATE INDEX IF NOT EXISTS idx_connections_status ON connections(status);
+
+	CREATE INDEX IF NOT EXISTS idx_subnet_notes_subnet ON subnet_notes(subnet_id);
+	CREATE INDEX IF NOT EXISTS idx_subnet_tags_key_value ON subnet_tags(key, value);
+
+	CREATE INDEX IF NOT EXISTS idx_utilization_history_subnet ON utilization_history(subnet_id, recorded_at);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+	`
+
+	_, err := tx.ExecContext(ctx, schema)
+	return err
+}
+
+// postgresSubnetExpiry adds the time after which a subnet is deleted
+func postgresSubnetExpiry(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE subnets ADD COLUMN IF NOT EXISTS expires_at BIGINT;
+		CREATE INDEX IF NOT EXISTS idx_subnets_expires_at ON subnets(expires_at);
+	`)
+	return err
+}
+
+// postgresConnectionPairIndex backs the duplicate check made before creating a connection
+func postgresConnectionPairIndex(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_connections_pair
+		ON connections(source_subnet_id, target_subnet_id, connection_type)
+	`)
+	return err
+}
+
+// postgresReservedRanges stores the address ranges excluded from IP allocation
+func postgresReservedRanges(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS reserved_ranges (
+			id TEXT PRIMARY KEY,
+			subnet_id TEXT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+			start_ip TEXT NOT NULL,
+			end_ip TEXT NOT NULL,
+			reason TEXT,
+			created_at BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_reserved_ranges_subnet ON reserved_ranges(subnet_id);
+	`)
+	return err
+}
+
+// postgresSubnetDNSZone adds the DNS zone operators annotate subnets with
+func postgresSubnetDNSZone(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "ALTER TABLE subnets ADD COLUMN IF NOT EXISTS dns_zone TEXT")
+	return err
+}
+
+// postgresAllocationHostname adds the hostname an IP address is allocated to
+func postgresAllocationHostname(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "ALTER TABLE ip_allocations ADD COLUMN IF NOT EXISTS hostname TEXT")
+	return err
+}
+
+// queryArgs collects positional arguments for queries built incrementally and
+// returns the matching $N placeholder for each
+type queryArgs []interface{}
+
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// Create inserts a new subnet into the database
+func (r *PostgresRepository) Create(ctx context.Context, subnet *pb.Subnet) error {
+	if err := purgeDeletedPostgresCIDR(ctx, r.db, subnet.Cidr); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO subnets (
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id,
+			address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			total_ips, allocated_ips, utilization_percent,
+			created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6,
+			$7, $8, $9,
+			$10, $11, $12, $13, $14, $15,
+			$16, $17, $18, $19,
+			$20, $21, $22,
+			$23, $24
+		)
+		ON CONFLICT (cidr) DO NOTHING
+	`
+
+	cloudProvider := ""
+	cloudRegion := ""
+	cloudAccountID := ""
+	if subnet.CloudInfo != nil {
+		cloudProvider = subnet.CloudInfo.Provider
+		cloudRegion = subnet.CloudInfo.Region
+		cloudAccountID = subnet.CloudInfo.AccountId
+	}
+
+	isPublic := 0
+	if subnet.Details != nil && subnet.Details.IsPublic {
+		isPublic = 1
+	}
+
+	result, err := r.db.ExecContext(ctx, query,
+		subnet.Id, subnet.Cidr, subnet.Name, subnet.Description,
+		subnet.Location, subnet.LocationType.String(),
+		cloudProvider, cloudRegion, cloudAccountID,
+		subnet.Details.Address, subnet.Details.Netmask, subnet.Details.Wildcard,
+		subnet.Details.Network, subnet.Details.Type, subnet.Details.Broadcast,
+		subnet.Details.HostMin, subnet.Details.HostMax, subnet.Details.HostsPerNet,
+		isPublic,
+		subnet.Utilization.TotalIps, subnet.Utilization.AllocatedIps,
+		subnet.Utilization.UtilizationPercent,
+		subnet.CreatedAt, subnet.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create subnet: %w", wrapPostgresError(err))
+	}
+
+	return checkCIDRInserted(result, subnet.Cidr)
+}
+
+// wrapPostgresError tags constraint violations with ErrDuplicate or ErrConflict
+func wrapPostgresError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	case pgForeignKeyViolation:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	default:
+		return err
+	}
+}
+
+// checkCIDRInserted turns an insert skipped by ON CONFLICT (cidr) into the duplicate error
+func checkCIDRInserted(result sql.Result, cidr string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("failed to create subnet: subnet with CIDR %s %w", cidr, ErrDuplicate)
+	}
+
+	return nil
+}
+
+// FindByID retrieves a subnet by its ID
+func (r *PostgresRepository) FindByID(ctx context.Context, id string) (*pb.Subnet, error) {
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id,
+			address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			total_ips, allocated_ips, utilization_percent,
+			created_at, updated_at
+		FROM subnets
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	var subnet pb.Subnet
+	var locationType string
+	var cloudProvider, cloudRegion, cloudAccountID sql.NullString
+	var isPublic int
+
+	subnet.Details = &pb.SubnetDetails{}
+	subnet.Utilization = &pb.UtilizationInfo{}
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&subnet.Id, &subnet.Cidr, &subnet.Name, &subnet.Description,
+		&subnet.Location, &locationType,
+		&cloudProvider, &cloudRegion, &cloudAccountID,
+		&subnet.Details.Address, &subnet.Details.Netmask, &subnet.Details.Wildcard,
+		&subnet.Details.Network, &subnet.Details.Type, &subnet.Details.Broadcast,
+		&subnet.Details.HostMin, &subnet.Details.HostMax, &subnet.Details.HostsPerNet,
+		&isPublic,
+		&subnet.Utilization.TotalIps, &subnet.Utilization.AllocatedIps,
+		&subnet.Utilization.UtilizationPercent,
+		&subnet.CreatedAt, &subnet.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	// Parse location type
+	subnet.LocationType = parseLocationType(locationType)
+
+	// Parse cloud info
+	if cloudProvider.Valid {
+		subnet.CloudInfo = &pb.CloudInfo{
+			Provider:  cloudProvider.String,
+			Region:    cloudRegion.String,
+			AccountId: cloudAccountID.String,
+		}
+	}
+
+	subnet.Details.IsPublic = isPublic == 1
+
+	return &subnet, nil
+}
+
+// FindAll retrieves all subnets with optional filtering
+func (r *PostgresRepository) FindAll(ctx context.Context, filters *SubnetFilters) ([]*pb.Subnet, error) {
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id,
+			address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			total_ips, allocated_ips, utilization_percent,
+			created_at, updated_at
+		FROM subnets
+		WHERE deleted_at IS NULL
+	`
+
+	var args queryArgs
+
+	// Apply filters; ILIKE keeps the case-insensitive matching of SQLite's LIKE
+	if filters != nil {
+		if filters.LocationFilter != "" {
+			query += " AND location ILIKE " + args.add("%"+filters.LocationFilter+"%")
+		}
+		if filters.CloudProviderFilter != "" {
+			query += " AND cloud_provider = " + args.add(filters.CloudProviderFilter)
+		}
+		if filters.SearchQuery != "" {
+			p := args.add("%" + filters.SearchQuery + "%")
+			query += fmt.Sprintf(" AND (name ILIKE %s OR cidr ILIKE %s OR description ILIKE %s OR location ILIKE %s OR dns_zone ILIKE %s)", p, p, p, p, p)
+		}
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	// Apply pagination
+	if filters != nil && filters.PageSize > 0 {
+		query += " LIMIT " + args.add(filters.PageSize)
+		query += " OFFSET " + args.add(filters.Page*filters.PageSize)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnets: %w", err)
+	}
+	defer rows.Close()
+
+	var subnets []*pb.Subnet
+
+	for rows.Next() {
+		var subnet pb.Subnet
+		var locationType string
+		var cloudProvider, cloudRegion, cloudAccountID sql.NullString
+		var isPublic int
+
+		subnet.Details = &pb.SubnetDetails{}
+		subnet.Utilization = &pb.UtilizationInfo{}
+
+		err := rows.Scan(
+			&subnet.Id, &subnet.Cidr, &subnet.Name, &subnet.Description,
+			&subnet.Location, &locationType,
+			&cloudProvider, &cloudRegion, &cloudAccountID,
+			&subnet.Details.Address, &subnet.Details.Netmask, &subnet.Details.Wildcard,
+			&subnet.Details.Network, &subnet.Details.Type, &subnet.Details.Broadcast,
+			&subnet.Details.HostMin, &subnet.Details.HostMax, &subnet.Details.HostsPerNet,
+			&isPublic,
+			&subnet.Utilization.TotalIps, &subnet.Utilization.AllocatedIps,
+			&subnet.Utilization.UtilizationPercent,
+			&subnet.CreatedAt, &subnet.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subnet: %w", err)
+		}
+
+		// Parse location type
+		subnet.LocationType = parseLocationType(locationType)
+
+		// Parse cloud info
+		if cloudProvider.Valid {
+			subnet.CloudInfo = &pb.CloudInfo{
+				Provider:  cloudProvider.String,
+				Region:    cloudRegion.String,
+				AccountId: cloudAccountID.String,
+			}
+		}
+
+		subnet.Details.IsPublic = isPublic == 1
+
+		subnets = append(subnets, &subnet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return subnets, nil
+}
+
+// Update modifies an existing subnet
+func (r *PostgresRepository) Update(ctx context.Context, subnet *pb.Subnet) error {
+	return r.UpdateWithStoredFields(ctx, subnet, nil)
+}
+
+// UpdateWithStoredFields modifies an existing subnet like Update and, when
+// stored is non-nil, writes its fields in the same statement
+func (r *PostgresRepository) UpdateWithStoredFields(ctx context.Context, subnet *pb.Subnet, stored *StoredFields) error {
+	storedColumns := ""
+	if stored != nil {
+		storedColumns = ", environment = $24, dhcp_range_start = $25, dhcp_range_end = $26, dns_zone = $27"
+	}
+	query := `
+		UPDATE subnets SET
+			cidr = $1, name = $2, description = $3, location = $4, location_type = $5,
+			cloud_provider = $6, cloud_region = $7, cloud_account_id = $8,
+			address = $9, netmask = $10, wildcard = $11, network = $12, type = $13, broadcast = $14,
+			host_min = $15, host_max = $16, hosts_per_net = $17, is_public = $18,
+			total_ips = $19, allocated_ips = $20, utilization_percent = $21,
+			updated_at = $22` + storedColumns + `
+		WHERE id = $23 AND deleted_at IS NULL
+	`
+
+	cloudProvider := ""
+	cloudRegion := ""
+	cloudAccountID := ""
+	if subnet.CloudInfo != nil {
+		cloudProvider = subnet.CloudInfo.Provider
+		cloudRegion = subnet.CloudInfo.Region
+		cloudAccountID = subnet.CloudInfo.AccountId
+	}
+
+	isPublic := 0
+	if subnet.Details != nil && subnet.Details.IsPublic {
+		isPublic = 1
+	}
+
+	args := []any{
+		subnet.Cidr, subnet.Name, subnet.Description,
+		subnet.Location, subnet.LocationType.String(),
+		cloudProvider, cloudRegion, cloudAccountID,
+		subnet.Details.Address, subnet.Details.Netmask, subnet.Details.Wildcard,
+		subnet.Details.Network, subnet.Details.Type, subnet.Details.Broadcast,
+		subnet.Details.HostMin, subnet.Details.HostMax, subnet.Details.HostsPerNet,
+		isPublic,
+		subnet.Utilization.TotalIps, subnet.Utilization.AllocatedIps,
+		subnet.Utilization.UtilizationPercent,
+		subnet.UpdatedAt,
+		subnet.Id,
+	}
+	if stored != nil {
+		args = append(args, stored.Environment, stored.DHCPRangeStart, stored.DHCPRangeEnd, stored.DNSZone)
+	}
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return fmt.Errorf("failed to update subnet: %w", wrapPostgresError(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// Delete soft-deletes a subnet by setting deleted_at. The row and its
+// dependents are kept so RestoreSubnet can bring it back.
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	query := "UPDATE subnets SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL"
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().Unix(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subnet: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// RestoreSubnet clears deleted_at on a soft-deleted subnet
+func (r *PostgresRepository) RestoreSubnet(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE subnets SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to restore subnet: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// PurgeSubnet permanently removes a subnet, live or soft-deleted. Connections,
+// notes, allocations and reserved ranges go with it through ON DELETE CASCADE.
+func (r *PostgresRepository) PurgeSubnet(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM subnets WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to purge subnet: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM utilization_history WHERE subnet_id = $1", id); err != nil {
+		return fmt.Errorf("failed to purge subnet utilization_history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnet purge: %w", err)
+	}
+
+	return nil
+}
+
+// purgeDeletedPostgresCIDR permanently removes a soft-deleted subnet holding
+// cidr so the CIDR can be reused; the UNIQUE constraint would otherwise
+// reject it.
+func purgeDeletedPostgresCIDR(ctx context.Context, exec sqlExecer, cidr string) error {
+	if _, err := exec.ExecContext(ctx, "DELETE FROM utilization_history WHERE subnet_id IN (SELECT id FROM subnets WHERE cidr = $1 AND deleted_at IS NOT NULL)", cidr); err != nil {
+		return fmt.Errorf("failed to purge deleted subnet history: %w", err)
+	}
+	if _, err := exec.ExecContext(ctx, "DELETE FROM subnets WHERE cidr = $1 AND deleted_at IS NOT NULL", cidr); err != nil {
+		return fmt.Errorf("failed to purge deleted subnet: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (r *PostgresRepository) Close() error {
+	return r.db.Close()
+}
+
+// Ping verifies that the database is reachable
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Connection methods
+
+// CreateConnection inserts a new connection into the database
+func (r *PostgresRepository) CreateConnection(ctx context.Context, connection *Connection) error {
+	query := `
+		INSERT INTO connections (
+			id, source_subnet_id, target_subnet_id, connection_type, status,
+			name, description, bandwidth, latency, cost, metadata,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+
+	metadataJSON, err := marshalConnectionMetadata(connection.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query,
+		connection.ID,
+		connection.SourceSubnetID,
+		connection.TargetSubnetID,
+		connection.ConnectionType,
+		connection.Status,
+		connection.Name,
+		connection.Description,
+		connection.Bandwidth,
+		connection.Latency,
+		connection.Cost,
+		metadataJSON,
+		connection.CreatedAt.Unix(),
+		connection.UpdatedAt.Unix(),
+	)
+
+	return wrapPostgresError(err)
+}
+
+// GetConnectionByID retrieves a connection by its ID
+func (r *PostgresRepository) GetConnectionByID(ctx context.Context, id string) (*Connection, error) {
+	query := `
+		SELECT id, source_subnet_id, target_subnet_id, connection_type, status,
+			   name, description, bandwidth, latency, cost, metadata,
+			   created_at, updated_at
+		FROM connections
+		WHERE id = $1 AND ` + liveConnectionCondition("subnets", "connections") + `
+	`
+
+	row := r.db.QueryRowContext(ctx, query, id)
+
+	connection := &Connection{}
+	var metadataJSON string
+	var createdAt, updatedAt int64
+
+	err := row.Scan(
+		&connection.ID,
+		&connection.SourceSubnetID,
+		&connection.TargetSubnetID,
+		&connection.ConnectionType,
+		&connection.Status,
+		&connection.Name,
+		&connection.Description,
+		&connection.Bandwidth,
+		&connection.Latency,
+		&connection.Cost,
+		&metadataJSON,
+		&createdAt,
+		&updatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("connection %w", ErrNotFound)
+		}
+		return nil, err
+	}
+
+	connection.CreatedAt = time.Unix(createdAt, 0)
+	connection.UpdatedAt = time.Unix(updatedAt, 0)
+
+	connection.Metadata, err = unmarshalConnectionMetadata(metadataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+// UpdateConnection updates an existing connection
+func (r *PostgresRepository) UpdateConnection(ctx context.Context, id string, connection *Connection) error {
+	query := `
+		UPDATE connections SET
+			source_subnet_id = $1, target_subnet_id = $2, connection_type = $3, status = $4,
+			name = $5, description = $6, bandwidth = $7, latency = $8, cost = $9,
+			metadata = $10, updated_at = $11
+		WHERE id = $12
+	`
+
+	metadataJSON, err := marshalConnectionMetadata(connection.Metadata)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, query,
+		connection.SourceSubnetID,
+		connection.TargetSubnetID,
+		connection.ConnectionType,
+		connection.Status,
+		connection.Name,
+		connection.Description,
+		connection.Bandwidth,
+		connection.Latency,
+		connection.Cost,
+		metadataJSON,
+		time.Now().Unix(),
+		id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("connection %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// DeleteConnection removes a connection from the database
+func (r *PostgresRepository) DeleteConnection(ctx context.Context, id string) error {
+	query := `DELETE FROM connections WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("connection %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListConnections retrieves connections with optional filtering
+func (r *PostgresRepository) ListConnections(ctx context.Context, filters ConnectionFilters) (*ConnectionList, error) {
+	// Build WHERE clause
+	var conditions []string
+	var args queryArgs
+
+	if filters.SourceSubnetID != "" {
+		conditions = append(conditions, "source_subnet_id = "+args.add(filters.SourceSubnetID))
+	}
+
+	if filters.TargetSubnetID != "" {
+		conditions = append(conditions, "target_subnet_id = "+args.add(filters.TargetSubnetID))
+	}
+
+	if filters.ConnectionType != "" {
+		conditions = append(conditions, "connection_type = "+args.add(filters.ConnectionType))
+	}
+
+	if filters.Status != "" {
+		conditions = append(conditions, "status = "+args.add(filters.Status))
+	}
+
+	conditions = append(conditions, liveConnectionCondition("subnets", "connections"))
+	whereClause := "WHERE " + strings.Join(conditions, " AND ")
+
+	// Count total records
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM connections %s", whereClause)
+	var totalCount int32
+	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add pagination parameters
+	limit := filters.PageSize
+	if limit <= 0 {
+		limit = 50 // Default page size
+	}
+	offset := filters.Page * limit
+
+	// Build main query with pagination
+	query := fmt.Sprintf(`
+		SELECT id, source_subnet_id, target_subnet_id, connection_type, status,
+			   name, description, bandwidth, latency, cost, metadata,
+			   created_at, updated_at
+		FROM connections
+		%s
+		ORDER BY created_at DESC
+		LIMIT %s OFFSET %s
+	`, whereClause, args.add(limit), args.add(offset))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections, err := scanConnections(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnectionList{
+		Connections: connections,
+		TotalCount:  totalCount,
+	}, nil
+}
+
+// ListConnectionsForSubnet retrieves every connection the subnet is the
+// source or target of, newest first
+func (r *PostgresRepository) ListConnectionsForSubnet(ctx context.Context, subnetID string) ([]*Connection, error) {
+	query := `
+		SELECT id, source_subnet_id, target_subnet_id, connection_type, status,
+			   name, description, bandwidth, latency, cost, metadata,
+			   created_at, updated_at
+		FROM connections
+		WHERE (source_subnet_id = $1 OR target_subnet_id = $1) AND ` + liveConnectionCondition("subnets", "connections") + `
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnet connections: %w", err)
+	}
+	defer rows.Close()
+
+	return scanConnections(rows)
+}
+
+// Note methods
+
+// CreateSubnetNote appends a note to a subnet
+func (r *PostgresRepository) CreateSubnetNote(ctx context.Context, note *SubnetNote) error {
+	query := `
+		INSERT INTO subnet_notes (id, subnet_id, author, text, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		note.ID, note.SubnetID, note.Author, note.Text, note.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create subnet note: %w", err)
+	}
+
+	return nil
+}
+
+// ListSubnetNotes retrieves the notes of a subnet in the order they were added
+func (r *PostgresRepository) ListSubnetNotes(ctx context.Context, subnetID string) ([]*SubnetNote, error) {
+	query := `
+		SELECT id, subnet_id, author, text, created_at
+		FROM subnet_notes
+		WHERE subnet_id = $1
+		ORDER BY created_at ASC, seq ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnet notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []*SubnetNote
+	for rows.Next() {
+		note := &SubnetNote{}
+		var createdAt int64
+
+		if err := rows.Scan(&note.ID, &note.SubnetID, &note.Author, &note.Text, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subnet note: %w", err)
+		}
+
+		note.CreatedAt = time.Unix(createdAt, 0)
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating subnet note rows: %w", err)
+	}
+
+	return notes, nil
+}
+
+// IP allocation methods
+
+// AllocateIP records an IP address as allocated inside a subnet
+func (r *PostgresRepository) AllocateIP(ctx context.Context, subnetID, ip, hostname, description string) (*IPAllocation, error) {
+	allocation := &IPAllocation{
+		SubnetID:    subnetID,
+		IP:          ip,
+		Hostname:    hostname,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+
+	query := `
+		INSERT INTO ip_allocations (subnet_id, ip, hostname, description, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (subnet_id, ip) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		allocation.SubnetID, allocation.IP, allocation.Hostname, allocation.Description, allocation.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate IP: %w", err)
+	}
+
+	if err := checkAllocationInserted(result, subnetID, ip); err != nil {
+		return nil, err
+	}
+
+	return allocation, nil
+}
+
+// ReleaseIP removes an IP allocation from a subnet
+func (r *PostgresRepository) ReleaseIP(ctx context.Context, subnetID, ip string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM ip_allocations WHERE subnet_id = $1 AND ip = $2", subnetID, ip)
+	if err != nil {
+		return fmt.Errorf("failed to release IP: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("allocation %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListAllocations retrieves the IP allocations of a subnet in the order they were made
+func (r *PostgresRepository) ListAllocations(ctx context.Context, subnetID string) ([]*IPAllocation, error) {
+	query := `
+		SELECT subnet_id, ip, hostname, description, created_at
+		FROM ip_allocations
+		WHERE subnet_id = $1
+		ORDER BY created_at ASC, seq ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IP allocations: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAllocations(rows)
+}
+
+// ListAllIPAllocations retrieves a page of IP allocations across subnets in
+// the order they were made
+func (r *PostgresRepository) ListAllIPAllocations(ctx context.Context, filters IPAllocationFilters) (*IPAllocationList, error) {
+	conditions := []string{liveAllocationCondition("subnets")}
+	var args queryArgs
+
+	if filters.SubnetID != "" {
+		conditions = append(conditions, "subnet_id = "+args.add(filters.SubnetID))
+	}
+
+	if filters.Hostname != "" {
+		conditions = append(conditions, "hostname = "+args.add(filters.Hostname))
+	}
+
+	if filters.SearchQuery != "" {
+		pattern := args.add("%" + filters.SearchQuery + "%")
+		conditions = append(conditions, fmt.Sprintf("(ip ILIKE %s OR hostname ILIKE %s OR description ILIKE %s)", pattern, pattern, pattern))
+	}
+
+	whereClause := "WHERE " + strings.Join(conditions, " AND ")
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM ip_allocations %s", whereClause)
+	var totalCount int32
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount); err != nil {
+		return nil, fmt.Errorf("failed to count IP allocations: %w", err)
+	}
+
+	limit := filters.PageSize
+	if limit <= 0 {
+		limit = 50 // Default page size
+	}
+	offset := filters.Page * limit
+
+	query := fmt.Sprintf(`
+		SELECT subnet_id, ip, hostname, description, created_at
+		FROM ip_allocations
+		%s
+		ORDER BY created_at ASC, seq ASC
+		LIMIT %s OFFSET %s
+	`, whereClause, args.add(limit), args.add(offset))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IP allocations: %w", err)
+	}
+	defer rows.Close()
+
+	allocations, err := scanAllocations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPAllocationList{
+		Allocations: allocations,
+		TotalCount:  totalCount,
+	}, nil
+}
+
+// Reserved range methods
+
+// CreateReservedRange stores an address range excluded from IP allocation
+func (r *PostgresRepository) CreateReservedRange(ctx context.Context, reservation *ReservedRange) error {
+	query := `
+		INSERT INTO reserved_ranges (id, subnet_id, start_ip, end_ip, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		reservation.ID, reservation.SubnetID, reservation.StartIP, reservation.EndIP, reservation.Reason, reservation.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create reserved range: %w", err)
+	}
+
+	return nil
+}
+
+// ListReservedRanges retrieves the reserved ranges of a subnet in the order they were created
+func (r *PostgresRepository) ListReservedRanges(ctx context.Context, subnetID string) ([]*ReservedRange, error) {
+	query := `
+		SELECT id, subnet_id, start_ip, end_ip, reason, created_at
+		FROM reserved_ranges
+		WHERE subnet_id = $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reserved ranges: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReservedRanges(rows)
+}
+
+// DeleteReservedRange removes a reserved range from a subnet
+func (r *PostgresRepository) DeleteReservedRange(ctx context.Context, subnetID, id string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM reserved_ranges WHERE subnet_id = $1 AND id = $2", subnetID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete reserved range: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("reserved range %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// Utilization history methods
+
+// CreateUtilizationSample appends a utilization sample to a subnet's history
+func (r *PostgresRepository) CreateUtilizationSample(ctx context.Context, sample *UtilizationSample) error {
+	query := `
+		INSERT INTO utilization_history (subnet_id, percent, total_ips, allocated_ips, recorded_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		sample.SubnetID, sample.Percent, sample.TotalIPs, sample.AllocatedIPs, sample.RecordedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create utilization sample: %w", err)
+	}
+
+	return nil
+}
+
+// ListUtilizationHistory retrieves a subnet's samples recorded in [from, to), oldest first.
+// A zero from or to leaves that end of the range open.
+func (r *PostgresRepository) ListUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time) ([]*UtilizationSample, error) {
+	var args queryArgs
+	query := `
+		SELECT subnet_id, percent, total_ips, allocated_ips, recorded_at
+		FROM utilization_history
+		WHERE subnet_id = ` + args.add(subnetID)
+
+	if !from.IsZero() {
+		query += " AND recorded_at >= " + args.add(from.Unix())
+	}
+	if !to.IsZero() {
+		query += " AND recorded_at < " + args.add(to.Unix())
+	}
+	query += " ORDER BY recorded_at ASC, seq ASC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utilization history: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []*UtilizationSample
+	for rows.Next() {
+		sample := &UtilizationSample{}
+		var recordedAt int64
+
+		if err := rows.Scan(&sample.SubnetID, &sample.Percent, &sample.TotalIPs, &sample.AllocatedIPs, &recordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan utilization sample: %w", err)
+		}
+
+		sample.RecordedAt = time.Unix(recordedAt, 0)
+		samples = append(samples, sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating utilization history rows: %w", err)
+	}
+
+	return samples, nil
+}
+
+// ListUtilizationHistorySubnetIDs retrieves the IDs of all subnets that have recorded history
+func (r *PostgresRepository) ListUtilizationHistorySubnetIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT subnet_id FROM utilization_history ORDER BY subnet_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utilization history subnets: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan subnet ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating utilization history rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ReplaceUtilizationHistory atomically replaces a subnet's samples recorded in [from, to)
+func (r *PostgresRepository) ReplaceUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time, samples []*UtilizationSample) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM utilization_history WHERE subnet_id = $1 AND recorded_at >= $2 AND recorded_at < $3",
+		subnetID, from.Unix(), to.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete utilization history: %w", err)
+	}
+
+	for _, sample := range samples {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO utilization_history (subnet_id, percent, total_ips, allocated_ips, recorded_at) VALUES ($1, $2, $3, $4, $5)",
+			subnetID, sample.Percent, sample.TotalIPs, sample.AllocatedIPs, sample.RecordedAt.Unix(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert utilization sample: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit utilization history: %w", err)
+	}
+
+	return nil
+}
+
+// PruneUtilizationHistory deletes a subnet's oldest samples so at most keep remain
+func (r *PostgresRepository) PruneUtilizationHistory(ctx context.Context, subnetID string, keep int) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM utilization_history
+		WHERE subnet_id = $1 AND seq NOT IN (
+			SELECT seq FROM utilization_history
+			WHERE subnet_id = $1
+			ORDER BY recorded_at DESC, seq DESC
+			LIMIT $2
+		)`,
+		subnetID, keep,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune utilization history: %w", err)
+	}
+
+	return nil
+}
+
+// Extended methods for cloud provider integration
+
+// CreateSubnet creates a new subnet using the repository model
+func (r *PostgresRepository) CreateSubnet(ctx context.Context, subnet *Subnet) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertPostgresSubnet(ctx, tx, subnet); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnet: %w", err)
+	}
+
+	return nil
+}
+
+// BulkCreateSubnets inserts all subnets in a single transaction. If any insert
+// fails the whole batch is rolled back and a *BulkCreateError identifies the
+// offending subnet.
+func (r *PostgresRepository) BulkCreateSubnets(ctx context.Context, subnets []*Subnet) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, subnet := range subnets {
+		if err := insertPostgresSubnet(ctx, tx, subnet); err != nil {
+			return &BulkCreateError{Index: i, CIDR: subnet.CIDR, Err: err}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnets: %w", err)
+	}
+
+	return nil
+}
+
+// UpdatePrefixUtilization records the share of a subnet's address space
+// covered by its children
+func (r *PostgresRepository) UpdatePrefixUtilization(ctx context.Context, id string, percent float64, updatedAt time.Time) error {
+	query := "UPDATE subnets SET prefix_utilization_percent = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL"
+	result, err := r.db.ExecContext(ctx, query, percent, unixOrNow(updatedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to update prefix utilization: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// MarkSubnetSeen records when a cloud sync last reported a subnet. It leaves
+// updated_at alone, since being seen again is not a modification.
+func (r *PostgresRepository) MarkSubnetSeen(ctx context.Context, id string, seenAt time.Time) error {
+	query := "UPDATE subnets SET cloud_last_seen_at = $1 WHERE id = $2 AND deleted_at IS NULL"
+	result, err := r.db.ExecContext(ctx, query, unixOrNow(seenAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark subnet seen: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListStaleCloudSubnets retrieves the synced cloud subnets last seen before
+// seenBefore. Subnets synced before sightings were tracked fall back to their
+// update time.
+func (r *PostgresRepository) ListStaleCloudSubnets(ctx context.Context, seenBefore time.Time) ([]*Subnet, error) {
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM subnets
+		WHERE location_type = 'cloud' AND cloud_resource_type = 'subnet'
+			AND COALESCE(cloud_last_seen_at, updated_at) < $1 AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, seenBefore.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale cloud subnets: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubnetSummaries(rows)
+}
+
+// ListExpiredSubnets retrieves the subnets whose expiry is at or before now
+func (r *PostgresRepository) ListExpiredSubnets(ctx context.Context, now time.Time) ([]*Subnet, error) {
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM subnets
+		WHERE expires_at IS NOT NULL AND expires_at <= $1 AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired subnets: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubnetSummaries(rows)
+}
+
+// GetIdempotentResult returns the unexpired result saved for an idempotency key
+func (r *PostgresRepository) GetIdempotentResult(ctx context.Context, scope, key string, now time.Time) (*IdempotentResult, error) {
+	query := `
+		SELECT resource_id, created_at, expires_at
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND expires_at > $3
+	`
+
+	result := &IdempotentResult{Scope: scope, Key: key}
+	var createdAt, expiresAt int64
+	err := r.db.QueryRowContext(ctx, query, scope, key, now.Unix()).Scan(&result.ResourceID, &createdAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("idempotency key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	result.CreatedAt = time.Unix(createdAt, 0)
+	result.ExpiresAt = time.Unix(expiresAt, 0)
+	return result, nil
+}
+
+// SaveIdempotentResult stores the result of a request made with an
+// idempotency key, replacing a result that has expired. Expired keys are
+// purged on the way.
+func (r *PostgresRepository) SaveIdempotentResult(ctx context.Context, result *IdempotentResult) error {
+	createdAt := unixOrNow(result.CreatedAt)
+
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", createdAt); err != nil {
+		return fmt.Errorf("failed to purge expired idempotency keys: %w", err)
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (scope, key, resource_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, key) DO NOTHING
+	`
+
+	res, err := r.db.ExecContext(ctx, query, result.Scope, result.Key, result.ResourceID, createdAt, result.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	return checkIdempotentResultInserted(res, result.Key)
+}
+
+// BulkUpdateUtilization sets allocated IPs and utilization for several subnets
+// in one transaction; nothing is written if any subnet is missing
+func (r *PostgresRepository) BulkUpdateUtilization(ctx context.Context, updates []*UtilizationUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE subnets SET allocated_ips = $1, utilization_percent = $2, updated_at = $3
+		WHERE id = $4 AND deleted_at IS NULL
+	`
+	for i, update := range updates {
+		result, err := tx.ExecContext(ctx, query, update.AllocatedIPs, update.UtilizationPercent, unixOrNow(update.UpdatedAt), update.SubnetID)
+		if err != nil {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("failed to update utilization: %w", err)}
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("subnet %w", ErrNotFound)}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit utilization: %w", err)
+	}
+
+	return nil
+}
+
+// RenumberSubnets moves several subnets to new CIDRs in one transaction;
+// nothing is written if any subnet is missing or a new CIDR is taken
+func (r *PostgresRepository) RenumberSubnets(ctx context.Context, updates []*CIDRUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE subnets SET
+			cidr = $1, address = $2, netmask = $3, wildcard = $4, network = $5, type = $6, broadcast = $7,
+			host_min = $8, host_max = $9, hosts_per_net = $10, is_public = $11,
+			dhcp_range_start = $12, dhcp_range_end = $13, updated_at = $14
+		WHERE id = $15 AND deleted_at IS NULL
+	`
+	for i, update := range updates {
+		if err := purgeDeletedPostgresCIDR(ctx, tx, update.CIDR); err != nil {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: err}
+		}
+
+		details := update.Details
+		if details == nil {
+			details = &SubnetDetails{}
+		}
+		result, err := tx.ExecContext(ctx, query,
+			update.CIDR, details.Address, details.Netmask, details.Wildcard, details.Network, details.Type, details.Broadcast,
+			details.HostMin, details.HostMax, details.HostsPerNet, boolToInt(details.IsPublic),
+			update.DHCPRangeStart, update.DHCPRangeEnd, unixOrNow(update.UpdatedAt),
+			update.SubnetID,
+		)
+		if err != nil {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("failed to renumber subnet: %w", wrapPostgresError(err))}
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("subnet %w", ErrNotFound)}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit renumbering: %w", err)
+	}
+
+	return nil
+}
+
+// insertPostgresSubnet inserts a repository subnet using exec
+func insertPostgresSubnet(ctx context.Context, exec sqlExecer, subnet *Subnet) error {
+	if err := purgeDeletedPostgresCIDR(ctx, exec, subnet.CIDR); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO subnets (
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			total_ips, allocated_ips, utilization_percent, environment, dhcp_range_start, dhcp_range_end, dns_zone, expires_at, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+			$15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33
+		)
+		ON CONFLICT (cidr) DO NOTHING
+	`
+
+	cloudProvider := ""
+	cloudRegion := ""
+	cloudAccountID := ""
+	cloudResourceType := ""
+	cloudVPCId := ""
+	cloudSubnetId := ""
+	if subnet.CloudInfo != nil {
+		cloudProvider = subnet.CloudInfo.Provider
+		cloudRegion = subnet.CloudInfo.Region
+		cloudAccountID = subnet.CloudInfo.AccountID
+		cloudResourceType = subnet.CloudInfo.ResourceType
+		cloudVPCId = subnet.CloudInfo.VPCId
+		cloudSubnetId = subnet.CloudInfo.SubnetId
+	}
+
+	// Subnet details
+	address := ""
+	netmask := ""
+	wildcard := ""
+	network := ""
+	subnetType := ""
+	broadcast := ""
+	hostMin := ""
+	hostMax := ""
+	var hostsPerNet int32 = 0
+	isPublic := 0
+	if subnet.Details != nil {
+		address = subnet.Details.Address
+		netmask = subnet.Details.Netmask
+		wildcard = subnet.Details.Wildcard
+		network = subnet.Details.Network
+		subnetType = subnet.Details.Type
+		broadcast = subnet.Details.Broadcast
+		hostMin = subnet.Details.HostMin
+		hostMax = subnet.Details.HostMax
+		hostsPerNet = subnet.Details.HostsPerNet
+		if subnet.Details.IsPublic {
+			isPublic = 1
+		}
+	}
+
+	// Utilization
+	var totalIPs int32 = 0
+	var allocatedIPs int32 = 0
+	utilizationPercent := 0.0
+	if subnet.Utilization != nil {
+		totalIPs = subnet.Utilization.TotalIPs
+		allocatedIPs = subnet.Utilization.AllocatedIPs
+		utilizationPercent = subnet.Utilization.UtilizationPercent
+	}
+
+	result, err := exec.ExecContext(ctx, query,
+		subnet.ID, subnet.CIDR, subnet.Name, "",
+		subnet.Location, subnet.LocationType,
+		cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId,
+		subnet.ParentID, address, netmask, wildcard, network, subnetType, broadcast,
+		hostMin, hostMax, hostsPerNet, isPublic,
+		totalIPs, allocatedIPs, utilizationPercent, subnet.Environment, subnet.DHCPRangeStart, subnet.DHCPRangeEnd, subnet.DNSZone,
+		nullableUnix(subnet.ExpiresAt), subnet.CreatedAt.Unix(), subnet.UpdatedAt.Unix(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create subnet: %w", wrapPostgresError(err))
+	}
+
+	if err := checkCIDRInserted(result, subnet.CIDR); err != nil {
+		return err
+	}
+
+	return replacePostgresSubnetTags(ctx, exec, subnet.ID, subnet.Tags)
+}
+
+// replacePostgresSubnetTags replaces every tag row of a subnet with tags
+func replacePostgresSubnetTags(ctx context.Context, exec sqlExecer, subnetID string, tags map[string]string) error {
+	if _, err := exec.ExecContext(ctx, "DELETE FROM subnet_tags WHERE subnet_id = $1", subnetID); err != nil {
+		return fmt.Errorf("failed to clear subnet tags: %w", err)
+	}
+	for key, value := range tags {
+		if _, err := exec.ExecContext(ctx, "INSERT INTO subnet_tags (subnet_id, key, value) VALUES ($1, $2, $3)", subnetID, key, value); err != nil {
+			return fmt.Errorf("failed to write subnet tag %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// GetSubnetByCIDR retrieves a subnet by its CIDR
+func (r *PostgresRepository) GetSubnetByCIDR(ctx context.Context, cidr string) (*Subnet, error) {
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM subnets
+		WHERE cidr = $1 AND deleted_at IS NULL
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, cidr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+	defer rows.Close()
+
+	subnets, err := scanSubnetSummaries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return subnets[0], nil
+}
+
+// UpdateSubnet updates an existing subnet using the repository model
+func (r *PostgresRepository) UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error {
+	query := `
+		UPDATE subnets SET
+			cidr = $1, name = $2, location = $3, location_type = $4,
+			cloud_provider = $5, cloud_region = $6, cloud_account_id = $7,
+			environment = $8, dhcp_range_start = $9, dhcp_range_end = $10, dns_zone = $11,
+			utilization_percent = $12, updated_at = $13
+		WHERE id = $14 AND deleted_at IS NULL
+	`
+
+	cloudProvider := ""
+	cloudRegion := ""
+	cloudAccountID := ""
+	if subnet.CloudInfo != nil {
+		cloudProvider = subnet.CloudInfo.Provider
+		cloudRegion = subnet.CloudInfo.Region
+		cloudAccountID = subnet.CloudInfo.AccountID
+	}
+
+	utilizationPercent := 0.0
+	if subnet.Utilization != nil {
+		utilizationPercent = subnet.Utilization.UtilizationPercent
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query,
+		subnet.CIDR, subnet.Name, subnet.Location, subnet.LocationType,
+		cloudProvider, cloudRegion, cloudAccountID,
+		subnet.Environment, subnet.DHCPRangeStart, subnet.DHCPRangeEnd, subnet.DNSZone, utilizationPercent, subnet.UpdatedAt.Unix(),
+		id,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update subnet: %w", wrapPostgresError(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	// Nil tags leave the stored tags unchanged, as in MongoDB
+	if subnet.Tags != nil {
+		if err := replacePostgresSubnetTags(ctx, tx, id, subnet.Tags); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnet update: %w", err)
+	}
+
+	return nil
+}
+
+// ListSubnets retrieves subnets with filtering using the repository model
+func (r *PostgresRepository) ListSubnets(ctx context.Context, filters SubnetFilters) (*SubnetList, error) {
+	baseQuery := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, expires_at, created_at, updated_at
+		FROM subnets
+		WHERE deleted_at IS NULL
+	`
+
+	whereClause := ""
+	var args queryArgs
+
+	// Apply filters
+	if filters.LocationFilter != "" {
+		whereClause += " AND location ILIKE " + args.add("%"+filters.LocationFilter+"%")
+	}
+	if filters.CloudProviderFilter != "" {
+		whereClause += " AND cloud_provider = " + args.add(filters.CloudProviderFilter)
+	}
+	if filters.CloudProvider != "" {
+		whereClause += " AND cloud_provider = " + args.add(filters.CloudProvider)
+	}
+	if filters.Environment != "" {
+		whereClause += " AND environment = " + args.add(filters.Environment)
+	}
+	switch filters.ManagedBy {
+	case ManagedByCloud:
+		whereClause += " AND COALESCE(cloud_vpc_id, '') <> ''"
+	case ManagedByManual:
+		whereClause += " AND COALESCE(cloud_vpc_id, '') = ''"
+	}
+	if filters.SearchQuery != "" {
+		p := args.add("%" + filters.SearchQuery + "%")
+		whereClause += fmt.Sprintf(" AND (name ILIKE %s OR cidr ILIKE %s OR description ILIKE %s OR location ILIKE %s OR dns_zone ILIKE %s)", p, p, p, p, p)
+	}
+	for _, key := range sortedTagKeys(filters.TagFilter) {
+		whereClause += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM subnet_tags WHERE subnet_tags.subnet_id = subnets.id AND subnet_tags.key = %s AND subnet_tags.value = %s)",
+			args.add(key), args.add(filters.TagFilter[key]))
+	}
+	if filters.IsPublic != nil {
+		whereClause += " AND COALESCE(is_public, 0) = " + args.add(boolToInt(*filters.IsPublic))
+	}
+	if filters.PrefixLength != nil {
+		whereClause += " AND cidr LIKE " + args.add(prefixLengthPattern(*filters.PrefixLength))
+	}
+
+	// Count total records (filter arguments only)
+	countQuery := "SELECT COUNT(*) FROM subnets WHERE deleted_at IS NULL" + whereClause
+	var totalCount int32
+	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets: %w", err)
+	}
+
+	finalQuery := baseQuery + whereClause
+
+	// Apply pagination; CIDR prefix matching happens in Go, so it paginates afterwards
+	paginate := filters.PageSize > 0 && filters.CIDRPrefix == ""
+	if filters.After != nil && filters.CIDRPrefix == "" {
+		finalQuery += fmt.Sprintf(" AND (created_at, id) < (%s, %s)",
+			args.add(filters.After.CreatedAt.Unix()), args.add(filters.After.ID))
+	}
+	finalQuery += " ORDER BY created_at DESC, id DESC"
+	if paginate {
+		finalQuery += " LIMIT " + args.add(filters.PageSize)
+		if filters.After == nil {
+			finalQuery += " OFFSET " + args.add(filters.Page*filters.PageSize)
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, finalQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnets: %w", err)
+	}
+	defer rows.Close()
+
+	subnets, err := scanListedSubnets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.CIDRPrefix != "" {
+		matched, err := filterByCIDRPrefix(subnets, filters.CIDRPrefix)
+		if err != nil {
+			return nil, err
+		}
+		if filters.After != nil {
+			subnets = pageAfterCursor(matched, filters.After, filters.PageSize)
+		} else {
+			subnets = paginateSubnets(matched, filters.Page, filters.PageSize)
+		}
+		totalCount = int32(len(matched))
+	}
+
+	return &SubnetList{
+		Subnets:    subnets,
+		TotalCount: totalCount,
+		NextCursor: nextSubnetCursor(subnets, filters.PageSize),
+	}, nil
+}
+
+// GetSubnetChildren retrieves child subnets for a given parent subnet ID
+func (r *PostgresRepository) GetSubnetChildren(ctx context.Context, parentID string) ([]*Subnet, error) {
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM subnets
+		WHERE parent_id = $1 AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child subnets: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubnetSummaries(rows)
+}
+
+// GetSubnetSiblings retrieves a page of the subnets sharing parentID with the
+// subnet id, excluding that subnet. An empty parentID lists top-level subnets.
+func (r *PostgresRepository) GetSubnetSiblings(ctx context.Context, id, parentID string, page, pageSize int32) (*SubnetList, error) {
+	whereClause := " WHERE COALESCE(parent_id, '') = $1 AND id != $2 AND deleted_at IS NULL"
+	args := []interface{}{parentID, id}
+
+	var totalCount int32
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM subnets"+whereClause, args...).Scan(&totalCount); err != nil {
+		return nil, fmt.Errorf("failed to count sibling subnets: %w", err)
+	}
+
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM subnets` + whereClause + `
+		ORDER BY cidr, id
+	`
+	if pageSize > 0 {
+		query += " LIMIT $3 OFFSET $4"
+		args = append(args, pageSize, page*pageSize)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sibling subnets: %w", err)
+	}
+	defer rows.Close()
+
+	siblings, err := scanSubnetSummaries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubnetList{Subnets: siblings, TotalCount: totalCount}, nil
+}
+
+// GetChildRollups aggregates the utilization of the direct children of each
+// parent in a single grouped query. Parents without children are omitted.
+func (r *PostgresRepository) GetChildRollups(ctx context.Context, parentIDs []string) (map[string]*ChildRollup, error) {
+	if len(parentIDs) == 0 {
+		return map[string]*ChildRollup{}, nil
+	}
+
+	query := `
+		SELECT parent_id, COUNT(*), COALESCE(SUM(total_ips), 0), COALESCE(SUM(allocated_ips), 0)
+		FROM subnets
+		WHERE parent_id = ANY($1) AND deleted_at IS NULL
+		GROUP BY parent_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, parentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child rollups: %w", err)
+	}
+	defer rows.Close()
+
+	return scanChildRollups(rows)
+}
+
+// CountSubnetsByEnvironment counts subnets per environment. Subnets without an
+// environment are counted under the empty string.
+func (r *PostgresRepository) CountSubnetsByEnvironment(ctx context.Context) (map[string]int32, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT COALESCE(environment, ''), COUNT(*) FROM subnets WHERE deleted_at IS NULL GROUP BY COALESCE(environment, '')")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets by environment: %w", err)
+	}
+	defer rows.Close()
+
+	return scanEnvironmentCounts(rows)
+}
+
+// CountSubnetsByPrefixLength counts subnets per CIDR prefix length. Rows whose
+// CIDR has no prefix length are skipped.
+func (r *PostgresRepository) CountSubnetsByPrefixLength(ctx context.Context) (map[int32]int32, error) {
+	query := `
+		SELECT split_part(cidr, '/', 2)::int AS prefix_length, COUNT(*)
+		FROM subnets
+		WHERE split_part(cidr, '/', 2) ~ '^[0-9]+$' AND deleted_at IS NULL
+		GROUP BY prefix_length
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets by prefix length: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPrefixLengthCounts(rows)
+}
+
+// FindOverlappingSubnets retrieves subnets in a location whose CIDR overlaps the given CIDR
+func (r *PostgresRepository) FindOverlappingSubnets(ctx context.Context, cidr, location string) ([]*Subnet, error) {
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM subnets
+		WHERE location = $1 AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnets: %w", err)
+	}
+	defer rows.Close()
+
+	subnets, err := scanSubnetSummaries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterOverlapping(subnets, cidr)
+}
+
+// GetSubnetByID retrieves a subnet by its ID using repository models
+func (r *PostgresRepository) GetSubnetByID(ctx context.Context, id string) (*Subnet, error) {
+	query := `
+		SELECT
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			total_ips, allocated_ips, utilization_percent, prefix_utilization_percent, environment, dhcp_range_start, dhcp_range_end, dns_zone, expires_at, created_at, updated_at
+		FROM subnets
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	var subnet Subnet
+	var description sql.NullString
+	var cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId sql.NullString
+	var parentID, environment, dhcpRangeStart, dhcpRangeEnd, dnsZone sql.NullString
+	var address, netmask, wildcard, network, subnetType, broadcast sql.NullString
+	var hostMin, hostMax sql.NullString
+	var hostsPerNet sql.NullInt32
+	var isPublic sql.NullInt32
+	var totalIPs, allocatedIPs sql.NullInt32
+	var utilizationPercent, prefixUtilizationPercent sql.NullFloat64
+	var expiresAt sql.NullInt64
+	var createdAt, updatedAt int64
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&subnet.ID, &subnet.CIDR, &subnet.Name, &description,
+		&subnet.Location, &subnet.LocationType,
+		&cloudProvider, &cloudRegion, &cloudAccountID, &cloudResourceType, &cloudVPCId, &cloudSubnetId,
+		&parentID, &address, &netmask, &wildcard, &network, &subnetType, &broadcast,
+		&hostMin, &hostMax, &hostsPerNet, &isPublic,
+		&totalIPs, &allocatedIPs, &utilizationPercent, &prefixUtilizationPercent, &environment, &dhcpRangeStart, &dhcpRangeEnd, &dnsZone, &expiresAt, &createdAt, &updatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	// Parse cloud info
+	if cloudProvider.Valid {
+		subnet.CloudInfo = &CloudInfo{
+			Provider:     cloudProvider.String,
+			Region:       cloudRegion.String,
+			AccountID:    cloudAccountID.String,
+			ResourceType: cloudResourceType.String,
+			VPCId:        cloudVPCId.String,
+			SubnetId:     cloudSubnetId.String,
+		}
+	}
+
+	// Parse subnet details
+	if address.Valid {
+		subnet.Details = &SubnetDetails{
+			Address:     address.String,
+			Netmask:     netmask.String,
+			Wildcard:    wildcard.String,
+			Network:     network.String,
+			Type:        subnetType.String,
+			Broadcast:   broadcast.String,
+			HostMin:     hostMin.String,
+			HostMax:     hostMax.String,
+			HostsPerNet: hostsPerNet.Int32,
+			IsPublic:    isPublic.Int32 == 1,
+		}
+	}
+
+	// Parse utilization
+	if utilizationPercent.Valid {
+		subnet.Utilization = &Utilization{
+			TotalIPs:                 totalIPs.Int32,
+			AllocatedIPs:             allocatedIPs.Int32,
+			UtilizationPercent:       utilizationPercent.Float64,
+			PrefixUtilizationPercent: prefixUtilizationPercent.Float64,
+			LastUpdated:              time.Unix(updatedAt, 0),
+		}
+	}
+
+	if parentID.Valid {
+		subnet.ParentID = parentID.String
+	}
+	subnet.Environment = environment.String
+	subnet.DHCPRangeStart = dhcpRangeStart.String
+	subnet.DHCPRangeEnd = dhcpRangeEnd.String
+	subnet.DNSZone = dnsZone.String
+	subnet.ExpiresAt = unixTimeOrNil(expiresAt)
+
+	subnet.CreatedAt = time.Unix(createdAt, 0)
+	subnet.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &subnet, nil
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/bananaops/ipam-bananaops/proto"
+)
+
+// newTestPostgresRepository connects to the database in IPAM_TEST_POSTGRES_URL
+// and empties the IPAM tables. The test is skipped when the variable is unset.
+func newTestPostgresRepository(t *testing.T) *PostgresRepository {
+	t.Helper()
+
+	connectionString := os.Getenv("IPAM_TEST_POSTGRES_URL")
+	if connectionString == "" {
+		t.Skip("IPAM_TEST_POSTGRES_URL not set, skipping PostgreSQL integration test")
+	}
+
+	repo, err := NewPostgresRepository(connectionString)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	if _, err := repo.db.Exec("TRUNCATE subnets, connections, subnet_notes, ip_allocations, utilization_history"); err != nil {
+		t.Fatalf("Failed to reset tables: %v", err)
+	}
+
+	return repo
+}
+
+func TestPostgresRepository_Integration(t *testing.T) {
+	repo := newTestPostgresRepository(t)
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+
+	parent := &Subnet{
+		ID:           "parent",
+		CIDR:         "10.0.0.0/16",
+		Name:         "Parent",
+		Location:     "datacenter-1",
+		LocationType: "datacenter",
+		Details:      &SubnetDetails{Address: "10.0.0.0", Type: "IPv4", HostsPerNet: 65534},
+		CreatedAt:    base,
+		UpdatedAt:    base,
+	}
+	child := &Subnet{
+		ID:           "child",
+		CIDR:         "10.0.1.0/24",
+		Name:         "Child",
+		Location:     "datacenter-1",
+		LocationType: "datacenter",
+		ParentID:     "parent",
+		CloudInfo:    &CloudInfo{Provider: "aws", Region: "eu-west-1", AccountID: "123456789012"},
+		CreatedAt:    base.Add(time.Minute),
+		UpdatedAt:    base.Add(time.Minute),
+	}
+
+	for _, subnet := range []*Subnet{parent, child} {
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	t.Run("duplicate CIDR", func(t *testing.T) {
+		duplicate := *parent
+		duplicate.ID = "duplicate"
+		err := repo.CreateSubnet(ctx, &duplicate)
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected duplicate CIDR error, got %v", err)
+		}
+	})
+
+	t.Run("get by ID and CIDR", func(t *testing.T) {
+		got, err := repo.GetSubnetByID(ctx, "parent")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if got.CIDR != parent.CIDR || got.Details == nil || got.Details.HostsPerNet != 65534 {
+			t.Errorf("Unexpected subnet: %+v", got)
+		}
+
+		byCIDR, err := repo.GetSubnetByCIDR(ctx, "10.0.1.0/24")
+		if err != nil {
+			t.Fatalf("Failed to get subnet by CIDR: %v", err)
+		}
+		if byCIDR.CloudInfo == nil || byCIDR.CloudInfo.AccountID != "123456789012" {
+			t.Errorf("Expected cloud info to round-trip, got %+v", byCIDR.CloudInfo)
+		}
+
+		if _, err := repo.GetSubnetByID(ctx, "missing"); err == nil || err.Error() != "subnet not found" {
+			t.Errorf("Expected subnet not found, got %v", err)
+		}
+	})
+
+	t.Run("list and children", func(t *testing.T) {
+		result, err := repo.ListSubnets(ctx, SubnetFilters{SearchQuery: "CHILD", PageSize: 10})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		if result.TotalCount != 1 || len(result.Subnets) != 1 || result.Subnets[0].ID != "child" {
+			t.Errorf("Expected only child to match, got %d subnets", result.TotalCount)
+		}
+
+		children, err := repo.GetSubnetChildren(ctx, "parent")
+		if err != nil {
+			t.Fatalf("Failed to get children: %v", err)
+		}
+		if len(children) != 1 || children[0].ID != "child" {
+			t.Errorf("Expected child under parent, got %d children", len(children))
+		}
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		connection := &Connection{
+			ID:             "conn-1",
+			SourceSubnetID: "parent",
+			TargetSubnetID: "child",
+			ConnectionType: "vpn",
+			Status:         "active",
+			Name:           "Link",
+			CreatedAt:      base,
+			UpdatedAt:      base,
+		}
+		if err := repo.CreateConnection(ctx, connection); err != nil {
+			t.Fatalf("Failed to create connection: %v", err)
+		}
+
+		list, err := repo.ListConnections(ctx, ConnectionFilters{SourceSubnetID: "parent"})
+		if err != nil {
+			t.Fatalf("Failed to list connections: %v", err)
+		}
+		if list.TotalCount != 1 || len(list.Connections) != 1 {
+			t.Errorf("Expected 1 connection, got %d", list.TotalCount)
+		}
+
+		if err := repo.DeleteConnection(ctx, "conn-1"); err != nil {
+			t.Fatalf("Failed to delete connection: %v", err)
+		}
+		if _, err := repo.GetConnectionByID(ctx, "conn-1"); err == nil {
+			t.Error("Expected connection to be deleted")
+		}
+	})
+
+	t.Run("protobuf subnets", func(t *testing.T) {
+		subnet := &pb.Subnet{
+			Id:           "pb-subnet",
+			Cidr:         "192.168.1.0/24",
+			Name:         "Protobuf Subnet",
+			Location:     "datacenter-2",
+			LocationType: pb.LocationType_DATACENTER,
+			Details:      &pb.SubnetDetails{Address: "192.168.1.0", HostsPerNet: 254, IsPublic: false},
+			Utilization:  &pb.UtilizationInfo{TotalIps: 256},
+			CreatedAt:    base.Unix(),
+			UpdatedAt:    base.Unix(),
+		}
+		if err := repo.Create(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet: %v", err)
+		}
+		if err := repo.Create(ctx, subnet); err == nil {
+			t.Error("Expected duplicate CIDR error")
+		}
+
+		found, err := repo.FindByID(ctx, "pb-subnet")
+		if err != nil {
+			t.Fatalf("Failed to find subnet: %v", err)
+		}
+		if found.Details.HostsPerNet != 254 || found.Utilization.TotalIps != 256 {
+			t.Errorf("Unexpected subnet: %+v", found)
+		}
+
+		if err := repo.Delete(ctx, "pb-subnet"); err != nil {
+			t.Fatalf("Failed to delete subnet: %v", err)
+		}
+	})
+}
@@ -2,26 +2,77 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	pb "github.com/bananaops/ipam-bananaops/proto"
 )
 
+// Errors wrapped by every repository implementation, so callers can tell
+// failures apart with errors.Is instead of matching messages
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a record with the same unique key already exists
+	ErrDuplicate = errors.New("already exists")
+	// ErrConflict is returned when a write conflicts with related records,
+	// such as a reference to a subnet that does not exist
+	ErrConflict = errors.New("conflicts with existing data")
+)
+
 // SubnetRepository defines the interface for subnet data access
 type SubnetRepository interface {
 	Create(ctx context.Context, subnet *pb.Subnet) error
 	FindByID(ctx context.Context, id string) (*pb.Subnet, error)
 	FindAll(ctx context.Context, filters *SubnetFilters) ([]*pb.Subnet, error)
 	Update(ctx context.Context, subnet *pb.Subnet) error
+	UpdateWithStoredFields(ctx context.Context, subnet *pb.Subnet, stored *StoredFields) error
 	Delete(ctx context.Context, id string) error
 	Close() error
 
+	// Ping verifies that the backing database is reachable, for readiness checks
+	Ping(ctx context.Context) error
+
+	// Soft-delete recovery: Delete only marks a subnet deleted
+	RestoreSubnet(ctx context.Context, id string) error
+	PurgeSubnet(ctx context.Context, id string) error
+
 	// Extended methods for cloud provider integration
 	CreateSubnet(ctx context.Context, subnet *Subnet) error
+	BulkCreateSubnets(ctx context.Context, subnets []*Subnet) error
 	GetSubnetByCIDR(ctx context.Context, cidr string) (*Subnet, error)
 	GetSubnetByID(ctx context.Context, id string) (*Subnet, error)
 	UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error
 	ListSubnets(ctx context.Context, filters SubnetFilters) (*SubnetList, error)
 	GetSubnetChildren(ctx context.Context, parentID string) ([]*Subnet, error)
+	GetSubnetSiblings(ctx context.Context, id, parentID string, page, pageSize int32) (*SubnetList, error)
+	GetChildRollups(ctx context.Context, parentIDs []string) (map[string]*ChildRollup, error)
+	CountSubnetsByEnvironment(ctx context.Context) (map[string]int32, error)
+	CountSubnetsByPrefixLength(ctx context.Context) (map[int32]int32, error)
+	FindOverlappingSubnets(ctx context.Context, cidr, location string) ([]*Subnet, error)
+	BulkUpdateUtilization(ctx context.Context, updates []*UtilizationUpdate) error
+	RenumberSubnets(ctx context.Context, updates []*CIDRUpdate) error
+	UpdatePrefixUtilization(ctx context.Context, id string, percent float64, updatedAt time.Time) error
+
+	// Cloud sync tracking: syncs record when they last reported a subnet
+	MarkSubnetSeen(ctx context.Context, id string, seenAt time.Time) error
+	ListStaleCloudSubnets(ctx context.Context, seenBefore time.Time) ([]*Subnet, error)
+
+	// Subnet expiry: subnets created with a TTL are deleted once it passes
+	ListExpiredSubnets(ctx context.Context, now time.Time) ([]*Subnet, error)
+
+	// Idempotency keys: results expire at their ExpiresAt. Saving a key that
+	// has an unexpired result returns ErrDuplicate.
+	GetIdempotentResult(ctx context.Context, scope, key string, now time.Time) (*IdempotentResult, error)
+	SaveIdempotentResult(ctx context.Context, result *IdempotentResult) error
 
 	// Connection methods
 	CreateConnection(ctx context.Context, connection *Connection) error
@@ -29,4 +80,315 @@ type SubnetRepository interface {
 	UpdateConnection(ctx context.Context, id string, connection *Connection) error
 	DeleteConnection(ctx context.Context, id string) error
 	ListConnections(ctx context.Context, filters ConnectionFilters) (*ConnectionList, error)
+	ListConnectionsForSubnet(ctx context.Context, subnetID string) ([]*Connection, error)
+
+	// Note methods
+	CreateSubnetNote(ctx context.Context, note *SubnetNote) error
+	ListSubnetNotes(ctx context.Context, subnetID string) ([]*SubnetNote, error)
+
+	// IP allocation methods
+	AllocateIP(ctx context.Context, subnetID, ip, hostname, description string) (*IPAllocation, error)
+	ReleaseIP(ctx context.Context, subnetID, ip string) error
+	ListAllocations(ctx context.Context, subnetID string) ([]*IPAllocation, error)
+	ListAllIPAllocations(ctx context.Context, filters IPAllocationFilters) (*IPAllocationList, error)
+
+	// Reserved range methods
+	CreateReservedRange(ctx context.Context, reservation *ReservedRange) error
+	ListReservedRanges(ctx context.Context, subnetID string) ([]*ReservedRange, error)
+	DeleteReservedRange(ctx context.Context, subnetID, id string) error
+
+	// Utilization history methods
+	CreateUtilizationSample(ctx context.Context, sample *UtilizationSample) error
+	ListUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time) ([]*UtilizationSample, error)
+	ListUtilizationHistorySubnetIDs(ctx context.Context) ([]string, error)
+	ReplaceUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time, samples []*UtilizationSample) error
+	PruneUtilizationHistory(ctx context.Context, subnetID string, keep int) error
+}
+
+// BulkCreateError identifies the subnet that caused a bulk insert to be rolled back
+type BulkCreateError struct {
+	Index int
+	CIDR  string
+	Err   error
+}
+
+func (e *BulkCreateError) Error() string {
+	return fmt.Sprintf("subnet %d (%s): %v", e.Index, e.CIDR, e.Err)
+}
+
+func (e *BulkCreateError) Unwrap() error {
+	return e.Err
+}
+
+// UtilizationUpdate carries externally computed utilization for one subnet
+type UtilizationUpdate struct {
+	SubnetID           string
+	AllocatedIPs       int32
+	UtilizationPercent float64
+	UpdatedAt          time.Time // Zero uses the current time
+}
+
+// CIDRUpdate moves one subnet to a new CIDR as part of a renumbering. Details
+// and the DHCP range are rewritten for the new addresses; other fields are
+// left unchanged.
+type CIDRUpdate struct {
+	SubnetID       string
+	CIDR           string
+	Details        *SubnetDetails
+	DHCPRangeStart string
+	DHCPRangeEnd   string
+	UpdatedAt      time.Time // Zero uses the current time
+}
+
+// sortedTagKeys returns the keys of a tag filter in a stable order, so the
+// generated queries do not depend on map iteration
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unixOrNow returns t as Unix seconds, or the current time when t is zero
+func unixOrNow(t time.Time) int64 {
+	if t.IsZero() {
+		return time.Now().Unix()
+	}
+	return t.Unix()
+}
+
+// nullableUnix converts an optional time to a nullable Unix timestamp column value
+func nullableUnix(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Unix()
+}
+
+// unixTimeOrNil converts a nullable Unix timestamp column to an optional time
+func unixTimeOrNil(value sql.NullInt64) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := time.Unix(value.Int64, 0)
+	return &t
+}
+
+// BulkUpdateError identifies the subnet that caused a bulk update to be rolled back
+type BulkUpdateError struct {
+	Index    int
+	SubnetID string
+	Err      error
+}
+
+func (e *BulkUpdateError) Error() string {
+	return fmt.Sprintf("subnet %d (%s): %v", e.Index, e.SubnetID, e.Err)
+}
+
+func (e *BulkUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// filterOverlapping keeps the subnets whose CIDR overlaps the given CIDR.
+// Rows with an unparseable CIDR are skipped rather than failing the check.
+func filterOverlapping(subnets []*Subnet, cidr string) ([]*Subnet, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	var overlapping []*Subnet
+	for _, subnet := range subnets {
+		existing, err := netip.ParsePrefix(subnet.CIDR)
+		if err != nil {
+			continue
+		}
+		if existing.Masked().Overlaps(prefix) {
+			overlapping = append(overlapping, subnet)
+		}
+	}
+
+	return overlapping, nil
+}
+
+// ParseCIDRPrefix parses a cidr_prefix search value. Besides full CIDRs and
+// addresses it accepts partial IPv4 addresses, so "10.0" is read as 10.0.0.0/16.
+func ParseCIDRPrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return netip.Prefix{}, fmt.Errorf("empty CIDR prefix")
+	}
+
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR prefix %q: %w", value, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	if strings.Contains(value, ":") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR prefix %q: %w", value, err)
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	octets := strings.Split(strings.TrimSuffix(value, "."), ".")
+	if len(octets) > 4 {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR prefix %q: too many octets", value)
+	}
+
+	var addr [4]byte
+	for i, octet := range octets {
+		n, err := strconv.ParseUint(octet, 10, 8)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR prefix %q: bad octet %q", value, octet)
+		}
+		addr[i] = byte(n)
+	}
+
+	return netip.PrefixFrom(netip.AddrFrom4(addr), 8*len(octets)), nil
+}
+
+// filterByCIDRPrefix keeps the subnets that contain or are contained in the
+// cidr_prefix search value
+func filterByCIDRPrefix(subnets []*Subnet, value string) ([]*Subnet, error) {
+	prefix, err := ParseCIDRPrefix(value)
+	if err != nil {
+		return nil, err
+	}
+	// Two prefixes overlap exactly when one contains the other
+	return filterOverlapping(subnets, prefix.String())
+}
+
+// boolToInt converts a boolean to the 0/1 integer stored in SQL columns such as is_public
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// prefixLengthPattern returns the LIKE pattern matching CIDRs with the given prefix length
+func prefixLengthPattern(length int) string {
+	return fmt.Sprintf("%%/%d", length)
+}
+
+// paginateSubnets returns one page of an already filtered and ordered slice
+func paginateSubnets(subnets []*Subnet, page, pageSize int32) []*Subnet {
+	if pageSize <= 0 {
+		return subnets
+	}
+
+	start := int(page) * int(pageSize)
+	if start >= len(subnets) {
+		return nil
+	}
+	end := start + int(pageSize)
+	if end > len(subnets) {
+		end = len(subnets)
+	}
+
+	return subnets[start:end]
+}
+
+// SubnetCursor marks the last subnet of a page for keyset pagination. Subnets
+// are listed newest first, with the ID breaking ties between subnets created
+// in the same second.
+type SubnetCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque cursor string handed to API clients
+func (c *SubnetCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.CreatedAt.Unix(), 10) + ":" + c.ID))
+}
+
+// DecodeSubnetCursor parses a cursor string produced by Encode
+func DecodeSubnetCursor(value string) (*SubnetCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), ":")
+	if !found || id == "" {
+		return nil, fmt.Errorf("invalid cursor: missing subnet ID")
+	}
+	seconds, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return &SubnetCursor{CreatedAt: time.Unix(seconds, 0), ID: id}, nil
+}
+
+// precedes reports whether subnet is listed before the cursor position
+func (c *SubnetCursor) precedes(subnet *Subnet) bool {
+	createdAt := subnet.CreatedAt.Unix()
+	if createdAt != c.CreatedAt.Unix() {
+		return createdAt > c.CreatedAt.Unix()
+	}
+	return subnet.ID >= c.ID
+}
+
+// pageAfterCursor returns up to pageSize subnets following the cursor in an
+// already filtered and ordered slice
+func pageAfterCursor(subnets []*Subnet, after *SubnetCursor, pageSize int32) []*Subnet {
+	start := 0
+	for start < len(subnets) && after.precedes(subnets[start]) {
+		start++
+	}
+	subnets = subnets[start:]
+
+	if pageSize > 0 && len(subnets) > int(pageSize) {
+		subnets = subnets[:pageSize]
+	}
+	return subnets
+}
+
+// nextSubnetCursor returns the cursor continuing after a full page, or "" when
+// the page is short and therefore the last one
+func nextSubnetCursor(subnets []*Subnet, pageSize int32) string {
+	if pageSize <= 0 || len(subnets) < int(pageSize) {
+		return ""
+	}
+	last := subnets[len(subnets)-1]
+	return (&SubnetCursor{CreatedAt: last.CreatedAt, ID: last.ID}).Encode()
+}
+
+// marshalConnectionMetadata encodes connection metadata for a TEXT column.
+// Nil metadata is stored as an empty string.
+func marshalConnectionMetadata(metadata map[string]interface{}) (string, error) {
+	if metadata == nil {
+		return "", nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal connection metadata: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// unmarshalConnectionMetadata decodes connection metadata stored by
+// marshalConnectionMetadata, returning a nil map for an empty string
+func unmarshalConnectionMetadata(data string) (map[string]interface{}, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal connection metadata: %w", err)
+	}
+
+	return metadata, nil
 }
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,24 +11,43 @@ import (
 	"time"
 
 	pb "github.com/bananaops/ipam-bananaops/proto"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // SQLiteRepository implements SubnetRepository using SQLite
 type SQLiteRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	tables sqliteTables
+}
+
+// SQLiteOptions configures a SQLite repository
+type SQLiteOptions struct {
+	// TablePrefix is prepended to every table and index name, so several
+	// environments can share one database file
+	TablePrefix string
 }
 
 // NewSQLiteRepository creates a new SQLite repository
 func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
+	return NewSQLiteRepositoryWithOptions(dbPath, SQLiteOptions{})
+}
+
+// NewSQLiteRepositoryWithOptions creates a new SQLite repository configured by opts
+func NewSQLiteRepositoryWithOptions(dbPath string, opts SQLiteOptions) (*SQLiteRepository, error) {
+	if err := validateTablePrefix(opts.TablePrefix); err != nil {
+		return nil, err
+	}
+
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	// Open database connection
-	db, err := sql.Open("sqlite", dbPath)
+	// Open database connection. The busy timeout makes concurrent writers, such as
+	// a cloud sync and an API edit, wait for the write lock instead of failing.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -37,7 +57,7 @@ func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	repo := &SQLiteRepository{db: db}
+	repo := &SQLiteRepository{db: db, tables: newSQLiteTables(opts.TablePrefix)}
 
 	// Initialize schema
 	if err := repo.initSchema(); err != nil {
@@ -48,10 +68,31 @@ func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
 	return repo, nil
 }
 
-// initSchema creates the database schema
+// sqliteMigrations upgrade the SQLite schema named by t in order. Change the
+// schema by appending a migration with the next version; never edit one that
+// has shipped.
+func sqliteMigrations(t sqliteTables) []migration {
+	return []migration{
+		{Version: 1, Description: "initial schema", Up: t.migrateInitialSchema},
+		{Version: 2, Description: "subnet expiry", Up: t.migrateSubnetExpiry},
+		{Version: 3, Description: "connection pair index", Up: t.migrateConnectionPairIndex},
+		{Version: 4, Description: "reserved ranges", Up: t.migrateReservedRanges},
+		{Version: 5, Description: "subnet DNS zone", Up: t.migrateSubnetDNSZone},
+		{Version: 6, Description: "IP allocation hostname", Up: t.migrateAllocationHostname},
+	}
+}
+
+// initSchema brings the database schema up to date
 func (r *SQLiteRepository) initSchema() error {
+	return runMigrations(context.Background(), r.db, sqliteMigrationDialect(r.tables), sqliteMigrations(r.tables))
+}
+
+// migrateInitialSchema creates the schema as it stood when migrations were
+// introduced. Databases created before then have tables but no recorded
+// version, so it only adds what is missing.
+func (t sqliteTables) migrateInitialSchema(ctx context.Context, tx *sql.Tx) error {
 	schema := `
-	CREATE TABLE IF NOT EXISTS subnets (
+	CREATE TABLE IF NOT EXISTS ` + t.subnets + ` (
 		id TEXT PRIMARY KEY,
 		cidr TEXT UNIQUE NOT NULL,
 		name TEXT NOT NULL,
@@ -65,6 +106,9 @@ func (r *SQLiteRepository) initSchema() error {
 		cloud_vpc_id TEXT,
 		cloud_subnet_id TEXT,
 		parent_id TEXT,
+		environment TEXT,
+		dhcp_range_start TEXT,
+		dhcp_range_end TEXT,
 		address TEXT,
 		netmask TEXT,
 		wildcard TEXT,
@@ -80,10 +124,10 @@ func (r *SQLiteRepository) initSchema() error {
 		utilization_percent REAL,
 		created_at INTEGER,
 		updated_at INTEGER,
-		FOREIGN KEY (parent_id) REFERENCES subnets(id)
+		FOREIGN KEY (parent_id) REFERENCES ` + t.subnets + `(id)
 	);
 
-	CREATE TABLE IF NOT EXISTS connections (
+	CREATE TABLE IF NOT EXISTS ` + t.connections + ` (
 		id TEXT PRIMARY KEY,
 		source_subnet_id TEXT NOT NULL,
 		target_subnet_id TEXT NOT NULL,
@@ -97,30 +141,182 @@ func (r *SQLiteRepository) initSchema() error {
 		metadata TEXT, -- JSON string for additional metadata
 		created_at INTEGER,
 		updated_at INTEGER,
-		FOREIGN KEY (source_subnet_id) REFERENCES subnets(id) ON DELETE CASCADE,
-		FOREIGN KEY (target_subnet_id) REFERENCES subnets(id) ON DELETE CASCADE
+		FOREIGN KEY (source_subnet_id) REFERENCES ` + t.subnets + `(id) ON DELETE CASCADE,
+		FOREIGN KEY (target_subnet_id) REFERENCES ` + t.subnets + `(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS ` + t.subnetNotes + ` (
+		id TEXT PRIMARY KEY,
+		subnet_id TEXT NOT NULL,
+		author TEXT NOT NULL,
+		text TEXT NOT NULL,
+		created_at INTEGER,
+		FOREIGN KEY (subnet_id) REFERENCES ` + t.subnets + `(id) ON DELETE CASCADE
 	);
 
-	CREATE INDEX IF NOT EXISTS idx_subnets_location ON subnets(location);
-	CREATE INDEX IF NOT EXISTS idx_subnets_cloud_provider ON subnets(cloud_provider);
-	CREATE INDEX IF NOT EXISTS idx_subnets_cidr ON subnets(cidr);
-	CREATE INDEX IF NOT EXISTS idx_subnets_parent_id ON subnets(parent_id);
-	CREATE INDEX IF NOT EXISTS idx_subnets_cloud_resource_type ON subnets(cloud_resource_type);
+	CREATE TABLE IF NOT EXISTS ` + t.ipAllocations + ` (
+		subnet_id TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		description TEXT,
+		created_at INTEGER,
+		PRIMARY KEY (subnet_id, ip),
+		FOREIGN KEY (subnet_id) REFERENCES ` + t.subnets + `(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS ` + t.subnetTags + ` (
+		subnet_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (subnet_id, key),
+		FOREIGN KEY (subnet_id) REFERENCES ` + t.subnets + `(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS ` + t.utilizationHistory + ` (
+		subnet_id TEXT NOT NULL,
+		percent REAL NOT NULL,
+		total_ips INTEGER,
+		allocated_ips INTEGER,
+		recorded_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS ` + t.idempotencyKeys + ` (
+		scope TEXT NOT NULL,
+		key TEXT NOT NULL,
+		resource_id TEXT NOT NULL,
+		created_at INTEGER,
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY (scope, key)
+	);
+
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnets_location ON ` + t.subnets + `(location);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnets_cloud_provider ON ` + t.subnets + `(cloud_provider);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnets_cidr ON ` + t.subnets + `(cidr);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnets_parent_id ON ` + t.subnets + `(parent_id);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnets_cloud_resource_type ON ` + t.subnets + `(cloud_resource_type);
 	
-	CREATE INDEX IF NOT EXISTS idx_connections_source ON connections(source_subnet_id);
-	CREATE INDEX IF NOT EXISTS idx_connections_target ON connections(target_subnet_id);
-	CREATE INDEX IF NOT EXISTS idx_connections_type ON connections(connection_type);
-	CREATE INDEX IF NOT EXISTS idx_connections_status ON connections(status);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_connections_source ON ` + t.connections + `(source_subnet_id);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_connections_target ON ` + t.connections + `(target_subnet_id);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_connections_type ON ` + t.connections + `(connection_type);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_connections_status ON ` + t.connections + `(status);
+
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnet_notes_subnet ON ` + t.subnetNotes + `(subnet_id);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_subnet_tags_key_value ON ` + t.subnetTags + `(key, value);
+
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_utilization_history_subnet ON ` + t.utilizationHistory + `(subnet_id, recorded_at);
+	CREATE INDEX IF NOT EXISTS ` + t.prefix + `idx_idempotency_keys_expires ON ` + t.idempotencyKeys + `(expires_at);
 	`
 
-	_, err := r.db.Exec(schema)
+	if _, err := tx.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+
+	// Columns added after the first release; SQLite has no ADD COLUMN IF NOT EXISTS
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "environment", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "deleted_at", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "dhcp_range_start", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "dhcp_range_end", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "prefix_utilization_percent", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "cloud_last_seen_at", "INTEGER"); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS `+t.prefix+`idx_subnets_environment ON `+t.subnets+`(environment);
+		CREATE INDEX IF NOT EXISTS `+t.prefix+`idx_subnets_deleted_at ON `+t.subnets+`(deleted_at);
+	`)
+	return err
+}
+
+// migrateSubnetExpiry adds the time after which a subnet is deleted
+func (t sqliteTables) migrateSubnetExpiry(ctx context.Context, tx *sql.Tx) error {
+	if err := addColumnIfMissing(ctx, tx, t.subnets, "expires_at", "INTEGER"); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS "+t.prefix+"idx_subnets_expires_at ON "+t.subnets+"(expires_at)")
+	return err
+}
+
+// migrateConnectionPairIndex backs the duplicate check made before creating a connection
+func (t sqliteTables) migrateConnectionPairIndex(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS `+t.prefix+`idx_connections_pair
+		ON `+t.connections+`(source_subnet_id, target_subnet_id, connection_type)
+	`)
+	return err
+}
+
+// migrateReservedRanges stores the address ranges excluded from IP allocation
+func (t sqliteTables) migrateReservedRanges(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+t.reservedRanges+` (
+			id TEXT PRIMARY KEY,
+			subnet_id TEXT NOT NULL,
+			start_ip TEXT NOT NULL,
+			end_ip TEXT NOT NULL,
+			reason TEXT,
+			created_at INTEGER,
+			FOREIGN KEY (subnet_id) REFERENCES `+t.subnets+`(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS `+t.prefix+`idx_reserved_ranges_subnet ON `+t.reservedRanges+`(subnet_id);
+	`)
 	return err
 }
 
+// migrateSubnetDNSZone adds the DNS zone operators annotate subnets with
+func (t sqliteTables) migrateSubnetDNSZone(ctx context.Context, tx *sql.Tx) error {
+	return addColumnIfMissing(ctx, tx, t.subnets, "dns_zone", "TEXT")
+}
+
+// migrateAllocationHostname adds the hostname an IP address is allocated to
+func (t sqliteTables) migrateAllocationHostname(ctx context.Context, tx *sql.Tx) error {
+	return addColumnIfMissing(ctx, tx, t.ipAllocations, "hostname", "TEXT")
+}
+
+// addColumnIfMissing adds a column to a table created by an older schema version
+func addColumnIfMissing(ctx context.Context, tx *sql.Tx, table, column, columnType string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan column name: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 // Create inserts a new subnet into the database
 func (r *SQLiteRepository) Create(ctx context.Context, subnet *pb.Subnet) error {
+	if err := r.purgeDeletedCIDR(ctx, r.db, subnet.Cidr); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO subnets (
+		INSERT INTO ` + r.tables.subnets + ` (
 			id, cidr, name, description, location, location_type,
 			cloud_provider, cloud_region, cloud_account_id,
 			address, netmask, wildcard, network, type, broadcast,
@@ -165,7 +361,7 @@ func (r *SQLiteRepository) Create(ctx context.Context, subnet *pb.Subnet) error
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to create subnet: %w", err)
+		return fmt.Errorf("failed to create subnet: %w", wrapSQLiteError(err))
 	}
 
 	return nil
@@ -181,8 +377,8 @@ func (r *SQLiteRepository) FindByID(ctx context.Context, id string) (*pb.Subnet,
 			host_min, host_max, hosts_per_net, is_public,
 			total_ips, allocated_ips, utilization_percent,
 			created_at, updated_at
-		FROM subnets
-		WHERE id = ?
+		FROM ` + r.tables.subnets + `
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	var subnet pb.Subnet
@@ -207,7 +403,7 @@ func (r *SQLiteRepository) FindByID(ctx context.Context, id string) (*pb.Subnet,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("subnet not found")
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
@@ -240,8 +436,8 @@ func (r *SQLiteRepository) FindAll(ctx context.Context, filters *SubnetFilters)
 			host_min, host_max, hosts_per_net, is_public,
 			total_ips, allocated_ips, utilization_percent,
 			created_at, updated_at
-		FROM subnets
-		WHERE 1=1
+		FROM ` + r.tables.subnets + `
+		WHERE deleted_at IS NULL
 	`
 
 	args := []interface{}{}
@@ -258,9 +454,9 @@ func (r *SQLiteRepository) FindAll(ctx context.Context, filters *SubnetFilters)
 			args = append(args, filters.CloudProviderFilter)
 		}
 		if filters.SearchQuery != "" {
-			query += " AND (name LIKE ? OR cidr LIKE ? OR description LIKE ? OR location LIKE ?)"
+			query += " AND (name LIKE ? OR cidr LIKE ? OR description LIKE ? OR location LIKE ? OR dns_zone LIKE ?)"
 			searchPattern := "%" + filters.SearchQuery + "%"
-			args = append(args, searchPattern, searchPattern, searchPattern, searchPattern)
+			args = append(args, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
 		}
 	}
 
@@ -332,15 +528,25 @@ func (r *SQLiteRepository) FindAll(ctx context.Context, filters *SubnetFilters)
 
 // Update modifies an existing subnet
 func (r *SQLiteRepository) Update(ctx context.Context, subnet *pb.Subnet) error {
+	return r.UpdateWithStoredFields(ctx, subnet, nil)
+}
+
+// UpdateWithStoredFields modifies an existing subnet like Update and, when
+// stored is non-nil, writes its fields in the same statement
+func (r *SQLiteRepository) UpdateWithStoredFields(ctx context.Context, subnet *pb.Subnet, stored *StoredFields) error {
+	storedColumns := ""
+	if stored != nil {
+		storedColumns = ", environment = ?, dhcp_range_start = ?, dhcp_range_end = ?, dns_zone = ?"
+	}
 	query := `
-		UPDATE subnets SET
+		UPDATE ` + r.tables.subnets + ` SET
 			cidr = ?, name = ?, description = ?, location = ?, location_type = ?,
 			cloud_provider = ?, cloud_region = ?, cloud_account_id = ?,
 			address = ?, netmask = ?, wildcard = ?, network = ?, type = ?, broadcast = ?,
 			host_min = ?, host_max = ?, hosts_per_net = ?, is_public = ?,
 			total_ips = ?, allocated_ips = ?, utilization_percent = ?,
-			updated_at = ?
-		WHERE id = ?
+			updated_at = ?` + storedColumns + `
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	cloudProvider := ""
@@ -357,7 +563,7 @@ func (r *SQLiteRepository) Update(ctx context.Context, subnet *pb.Subnet) error
 		isPublic = 1
 	}
 
-	result, err := r.db.ExecContext(ctx, query,
+	args := []any{
 		subnet.Cidr, subnet.Name, subnet.Description,
 		subnet.Location, subnet.LocationType.String(),
 		cloudProvider, cloudRegion, cloudAccountID,
@@ -368,11 +574,16 @@ func (r *SQLiteRepository) Update(ctx context.Context, subnet *pb.Subnet) error
 		subnet.Utilization.TotalIps, subnet.Utilization.AllocatedIps,
 		subnet.Utilization.UtilizationPercent,
 		subnet.UpdatedAt,
-		subnet.Id,
-	)
+	}
+	if stored != nil {
+		args = append(args, stored.Environment, stored.DHCPRangeStart, stored.DHCPRangeEnd, stored.DNSZone)
+	}
+	args = append(args, subnet.Id)
+
+	result, err := r.db.ExecContext(ctx, query, args...)
 
 	if err != nil {
-		return fmt.Errorf("failed to update subnet: %w", err)
+		return fmt.Errorf("failed to update subnet: %w", wrapSQLiteError(err))
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -381,17 +592,18 @@ func (r *SQLiteRepository) Update(ctx context.Context, subnet *pb.Subnet) error
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("subnet not found")
+		return fmt.Errorf("subnet %w", ErrNotFound)
 	}
 
 	return nil
 }
 
-// Delete removes a subnet from the database
+// Delete soft-deletes a subnet by setting deleted_at. The row, its notes,
+// allocations and connections are kept so RestoreSubnet can bring it back.
 func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
-	query := "DELETE FROM subnets WHERE id = ?"
+	query := "UPDATE " + r.tables.subnets + " SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL"
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.db.ExecContext(ctx, query, time.Now().Unix(), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete subnet: %w", err)
 	}
@@ -402,9 +614,97 @@ func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("subnet not found")
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// RestoreSubnet clears deleted_at on a soft-deleted subnet
+func (r *SQLiteRepository) RestoreSubnet(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE "+r.tables.subnets+" SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to restore subnet: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// PurgeSubnet permanently removes a subnet, live or soft-deleted, together
+// with its connections, notes and allocations
+func (r *SQLiteRepository) PurgeSubnet(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM "+r.tables.subnets+" WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to purge subnet: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	if err := r.purgeSubnetDependents(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnet purge: %w", err)
+	}
+
+	return nil
+}
+
+// purgeSubnetDependents deletes the rows referencing a purged subnet. SQLite
+// foreign keys are not enforced, so ON DELETE CASCADE cannot be relied on.
+func (r *SQLiteRepository) purgeSubnetDependents(ctx context.Context, exec sqlExecer, id string) error {
+	return r.purgeDependentsWhere(ctx, exec, "(?)", id)
+}
+
+// purgeDeletedCIDR permanently removes a soft-deleted subnet holding cidr so
+// the CIDR can be reused; the UNIQUE constraint would otherwise reject it.
+func (r *SQLiteRepository) purgeDeletedCIDR(ctx context.Context, exec sqlExecer, cidr string) error {
+	if err := r.purgeDependentsWhere(ctx, exec, "(SELECT id FROM "+r.tables.subnets+" WHERE cidr = ? AND deleted_at IS NOT NULL)", cidr); err != nil {
+		return err
+	}
+	if _, err := exec.ExecContext(ctx, "DELETE FROM "+r.tables.subnets+" WHERE cidr = ? AND deleted_at IS NOT NULL", cidr); err != nil {
+		return fmt.Errorf("failed to purge deleted subnet: %w", err)
 	}
+	return nil
+}
 
+// purgeDependentsWhere deletes connections, notes, allocations, reserved
+// ranges, tags and history whose subnet id is in idList, a parenthesized list
+// bound to arg
+func (r *SQLiteRepository) purgeDependentsWhere(ctx context.Context, exec sqlExecer, idList string, arg string) error {
+	connectionsQuery := fmt.Sprintf("DELETE FROM %[1]s WHERE source_subnet_id IN %[2]s OR target_subnet_id IN %[2]s", r.tables.connections, idList)
+	if _, err := exec.ExecContext(ctx, connectionsQuery, arg, arg); err != nil {
+		return fmt.Errorf("failed to purge subnet connections: %w", err)
+	}
+	for _, table := range []string{r.tables.subnetNotes, r.tables.ipAllocations, r.tables.reservedRanges, r.tables.subnetTags, r.tables.utilizationHistory} {
+		query := fmt.Sprintf("DELETE FROM %s WHERE subnet_id IN %s", table, idList)
+		if _, err := exec.ExecContext(ctx, query, arg); err != nil {
+			return fmt.Errorf("failed to purge subnet %s: %w", table, err)
+		}
+	}
 	return nil
 }
 
@@ -413,26 +713,29 @@ func (r *SQLiteRepository) Close() error {
 	return r.db.Close()
 }
 
+// Ping verifies that the database is reachable
+func (r *SQLiteRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
 // Connection methods
 
 // CreateConnection inserts a new connection into the database
 func (r *SQLiteRepository) CreateConnection(ctx context.Context, connection *Connection) error {
 	query := `
-		INSERT INTO connections (
+		INSERT INTO ` + r.tables.connections + ` (
 			id, source_subnet_id, target_subnet_id, connection_type, status,
 			name, description, bandwidth, latency, cost, metadata,
 			created_at, updated_at
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	metadataJSON := ""
-	if connection.Metadata != nil {
-		// Convert metadata to JSON string
-		// For simplicity, we'll skip JSON marshaling for now
-		// In a real implementation, you'd use json.Marshal
+	metadataJSON, err := marshalConnectionMetadata(connection.Metadata)
+	if err != nil {
+		return err
 	}
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err = r.db.ExecContext(ctx, query,
 		connection.ID,
 		connection.SourceSubnetID,
 		connection.TargetSubnetID,
@@ -448,7 +751,22 @@ func (r *SQLiteRepository) CreateConnection(ctx context.Context, connection *Con
 		connection.UpdatedAt.Unix(),
 	)
 
-	return err
+	return wrapSQLiteError(err)
+}
+
+// liveAllocationCondition hides IP allocations of a soft-deleted subnet in
+// the subnets table. They are kept so that restoring the subnet brings them back.
+func liveAllocationCondition(subnets string) string {
+	return `subnet_id IN (SELECT id FROM ` + subnets + ` WHERE deleted_at IS NULL)`
+}
+
+// liveConnectionCondition hides rows of the connections table touching a
+// soft-deleted subnet. They are kept so that restoring the subnet brings them back.
+func liveConnectionCondition(subnets, connections string) string {
+	return `NOT EXISTS (
+	SELECT 1 FROM ` + subnets + ` s
+	WHERE s.id IN (` + connections + `.source_subnet_id, ` + connections + `.target_subnet_id) AND s.deleted_at IS NOT NULL
+)`
 }
 
 // GetConnectionByID retrieves a connection by its ID
@@ -457,8 +775,8 @@ func (r *SQLiteRepository) GetConnectionByID(ctx context.Context, id string) (*C
 		SELECT id, source_subnet_id, target_subnet_id, connection_type, status,
 			   name, description, bandwidth, latency, cost, metadata,
 			   created_at, updated_at
-		FROM connections
-		WHERE id = ?
+		FROM ` + r.tables.connections + `
+		WHERE id = ? AND ` + liveConnectionCondition(r.tables.subnets, r.tables.connections) + `
 	`
 
 	row := r.db.QueryRowContext(ctx, query, id)
@@ -485,7 +803,7 @@ func (r *SQLiteRepository) GetConnectionByID(ctx context.Context, id string) (*C
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("connection not found")
+			return nil, fmt.Errorf("connection %w", ErrNotFound)
 		}
 		return nil, err
 	}
@@ -493,10 +811,9 @@ func (r *SQLiteRepository) GetConnectionByID(ctx context.Context, id string) (*C
 	connection.CreatedAt = time.Unix(createdAt, 0)
 	connection.UpdatedAt = time.Unix(updatedAt, 0)
 
-	// Parse metadata JSON if needed
-	if metadataJSON != "" {
-		// In a real implementation, you'd use json.Unmarshal
-		connection.Metadata = make(map[string]interface{})
+	connection.Metadata, err = unmarshalConnectionMetadata(metadataJSON)
+	if err != nil {
+		return nil, err
 	}
 
 	return connection, nil
@@ -505,17 +822,16 @@ func (r *SQLiteRepository) GetConnectionByID(ctx context.Context, id string) (*C
 // UpdateConnection updates an existing connection
 func (r *SQLiteRepository) UpdateConnection(ctx context.Context, id string, connection *Connection) error {
 	query := `
-		UPDATE connections SET
+		UPDATE ` + r.tables.connections + ` SET
 			source_subnet_id = ?, target_subnet_id = ?, connection_type = ?, status = ?,
 			name = ?, description = ?, bandwidth = ?, latency = ?, cost = ?,
 			metadata = ?, updated_at = ?
 		WHERE id = ?
 	`
 
-	metadataJSON := ""
-	if connection.Metadata != nil {
-		// Convert metadata to JSON string
-		// For simplicity, we'll skip JSON marshaling for now
+	metadataJSON, err := marshalConnectionMetadata(connection.Metadata)
+	if err != nil {
+		return err
 	}
 
 	result, err := r.db.ExecContext(ctx, query,
@@ -543,7 +859,7 @@ func (r *SQLiteRepository) UpdateConnection(ctx context.Context, id string, conn
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("connection not found")
+		return fmt.Errorf("connection %w", ErrNotFound)
 	}
 
 	return nil
@@ -551,7 +867,7 @@ func (r *SQLiteRepository) UpdateConnection(ctx context.Context, id string, conn
 
 // DeleteConnection removes a connection from the database
 func (r *SQLiteRepository) DeleteConnection(ctx context.Context, id string) error {
-	query := `DELETE FROM connections WHERE id = ?`
+	query := `DELETE FROM ` + r.tables.connections + ` WHERE id = ?`
 
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -564,7 +880,7 @@ func (r *SQLiteRepository) DeleteConnection(ctx context.Context, id string) erro
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("connection not found")
+		return fmt.Errorf("connection %w", ErrNotFound)
 	}
 
 	return nil
@@ -596,13 +912,11 @@ func (r *SQLiteRepository) ListConnections(ctx context.Context, filters Connecti
 		args = append(args, filters.Status)
 	}
 
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = "WHERE " + strings.Join(conditions, " AND ")
-	}
+	conditions = append(conditions, liveConnectionCondition(r.tables.subnets, r.tables.connections))
+	whereClause := "WHERE " + strings.Join(conditions, " AND ")
 
 	// Count total records
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM connections %s", whereClause)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s %s", r.tables.connections, whereClause)
 	var totalCount int32
 	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
 	if err != nil {
@@ -614,7 +928,7 @@ func (r *SQLiteRepository) ListConnections(ctx context.Context, filters Connecti
 		SELECT id, source_subnet_id, target_subnet_id, connection_type, status,
 			   name, description, bandwidth, latency, cost, metadata,
 			   created_at, updated_at
-		FROM connections
+		FROM `+r.tables.connections+`
 		%s
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
@@ -635,6 +949,41 @@ func (r *SQLiteRepository) ListConnections(ctx context.Context, filters Connecti
 	}
 	defer rows.Close()
 
+	connections, err := scanConnections(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnectionList{
+		Connections: connections,
+		TotalCount:  totalCount,
+	}, nil
+}
+
+// ListConnectionsForSubnet retrieves every connection the subnet is the
+// source or target of, newest first
+func (r *SQLiteRepository) ListConnectionsForSubnet(ctx context.Context, subnetID string) ([]*Connection, error) {
+	query := `
+		SELECT id, source_subnet_id, target_subnet_id, connection_type, status,
+			   name, description, bandwidth, latency, cost, metadata,
+			   created_at, updated_at
+		FROM ` + r.tables.connections + `
+		WHERE (source_subnet_id = ? OR target_subnet_id = ?) AND ` + liveConnectionCondition(r.tables.subnets, r.tables.connections) + `
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnet connections: %w", err)
+	}
+	defer rows.Close()
+
+	return scanConnections(rows)
+}
+
+// scanConnections reads connection rows selected with the column list used by
+// ListConnections
+func scanConnections(rows *sql.Rows) ([]*Connection, error) {
 	var connections []*Connection
 	for rows.Next() {
 		connection := &Connection{}
@@ -656,7 +1005,6 @@ func (r *SQLiteRepository) ListConnections(ctx context.Context, filters Connecti
 			&createdAt,
 			&updatedAt,
 		)
-
 		if err != nil {
 			return nil, err
 		}
@@ -664,74 +1012,809 @@ func (r *SQLiteRepository) ListConnections(ctx context.Context, filters Connecti
 		connection.CreatedAt = time.Unix(createdAt, 0)
 		connection.UpdatedAt = time.Unix(updatedAt, 0)
 
-		// Parse metadata JSON if needed
-		if metadataJSON != "" {
-			connection.Metadata = make(map[string]interface{})
+		connection.Metadata, err = unmarshalConnectionMetadata(metadataJSON)
+		if err != nil {
+			return nil, err
 		}
 
 		connections = append(connections, connection)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	return connections, rows.Err()
+}
+
+// Note methods
+
+// CreateSubnetNote appends a note to a subnet
+func (r *SQLiteRepository) CreateSubnetNote(ctx context.Context, note *SubnetNote) error {
+	query := `
+		INSERT INTO ` + r.tables.subnetNotes + ` (id, subnet_id, author, text, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		note.ID, note.SubnetID, note.Author, note.Text, note.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create subnet note: %w", err)
 	}
 
-	return &ConnectionList{
-		Connections: connections,
-		TotalCount:  totalCount,
-	}, nil
+	return nil
 }
 
-// parseLocationType converts a string to LocationType enum
-func parseLocationType(s string) pb.LocationType {
-	s = strings.ToUpper(s)
-	switch s {
-	case "DATACENTER":
-		return pb.LocationType_DATACENTER
-	case "SITE":
-		return pb.LocationType_SITE
-	case "CLOUD":
-		return pb.LocationType_CLOUD
-	default:
-		return pb.LocationType_DATACENTER
+// ListSubnetNotes retrieves the notes of a subnet in the order they were added
+func (r *SQLiteRepository) ListSubnetNotes(ctx context.Context, subnetID string) ([]*SubnetNote, error) {
+	query := `
+		SELECT id, subnet_id, author, text, created_at
+		FROM ` + r.tables.subnetNotes + `
+		WHERE subnet_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnet notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []*SubnetNote
+	for rows.Next() {
+		note := &SubnetNote{}
+		var createdAt int64
+
+		if err := rows.Scan(&note.ID, &note.SubnetID, &note.Author, &note.Text, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subnet note: %w", err)
+		}
+
+		note.CreatedAt = time.Unix(createdAt, 0)
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating subnet note rows: %w", err)
 	}
+
+	return notes, nil
 }
 
-// Extended methods for cloud provider integration
+// IP allocation methods
+
+// AllocateIP records an IP address as allocated inside a subnet
+func (r *SQLiteRepository) AllocateIP(ctx context.Context, subnetID, ip, hostname, description string) (*IPAllocation, error) {
+	allocation := &IPAllocation{
+		SubnetID:    subnetID,
+		IP:          ip,
+		Hostname:    hostname,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
 
-// CreateSubnet creates a new subnet using the repository model
-func (r *SQLiteRepository) CreateSubnet(ctx context.Context, subnet *Subnet) error {
 	query := `
-		INSERT INTO subnets (
-			id, cidr, name, description, location, location_type,
-			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
-			parent_id, address, netmask, wildcard, network, type, broadcast,
-			host_min, host_max, hosts_per_net, is_public,
-			total_ips, allocated_ips, utilization_percent, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO ` + r.tables.ipAllocations + ` (subnet_id, ip, hostname, description, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (subnet_id, ip) DO NOTHING
 	`
 
-	cloudProvider := ""
-	cloudRegion := ""
-	cloudAccountID := ""
-	cloudResourceType := ""
-	cloudVPCId := ""
-	cloudSubnetId := ""
-	if subnet.CloudInfo != nil {
-		cloudProvider = subnet.CloudInfo.Provider
-		cloudRegion = subnet.CloudInfo.Region
-		cloudAccountID = subnet.CloudInfo.AccountID
-		cloudResourceType = subnet.CloudInfo.ResourceType
-		cloudVPCId = subnet.CloudInfo.VPCId
-		cloudSubnetId = subnet.CloudInfo.SubnetId
+	result, err := r.db.ExecContext(ctx, query,
+		allocation.SubnetID, allocation.IP, allocation.Hostname, allocation.Description, allocation.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate IP: %w", err)
 	}
 
-	// Subnet details
-	address := ""
-	netmask := ""
-	wildcard := ""
-	network := ""
-	subnetType := ""
+	if err := checkAllocationInserted(result, subnetID, ip); err != nil {
+		return nil, err
+	}
+
+	return allocation, nil
+}
+
+// checkAllocationInserted turns an insert skipped by ON CONFLICT into the
+// already allocated error
+func checkAllocationInserted(result sql.Result, subnetID, ip string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("IP %s is already allocated in subnet %s: %w", ip, subnetID, ErrDuplicate)
+	}
+	return nil
+}
+
+// ReleaseIP removes an IP allocation from a subnet
+func (r *SQLiteRepository) ReleaseIP(ctx context.Context, subnetID, ip string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM "+r.tables.ipAllocations+" WHERE subnet_id = ? AND ip = ?", subnetID, ip)
+	if err != nil {
+		return fmt.Errorf("failed to release IP: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("allocation %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListAllocations retrieves the IP allocations of a subnet in the order they were made
+func (r *SQLiteRepository) ListAllocations(ctx context.Context, subnetID string) ([]*IPAllocation, error) {
+	query := `
+		SELECT subnet_id, ip, hostname, description, created_at
+		FROM ` + r.tables.ipAllocations + `
+		WHERE subnet_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IP allocations: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAllocations(rows)
+}
+
+// ListAllIPAllocations retrieves a page of IP allocations across subnets in
+// the order they were made
+func (r *SQLiteRepository) ListAllIPAllocations(ctx context.Context, filters IPAllocationFilters) (*IPAllocationList, error) {
+	conditions := []string{liveAllocationCondition(r.tables.subnets)}
+	var args []interface{}
+
+	if filters.SubnetID != "" {
+		conditions = append(conditions, "subnet_id = ?")
+		args = append(args, filters.SubnetID)
+	}
+
+	if filters.Hostname != "" {
+		conditions = append(conditions, "hostname = ?")
+		args = append(args, filters.Hostname)
+	}
+
+	if filters.SearchQuery != "" {
+		conditions = append(conditions, "(ip LIKE ? OR hostname LIKE ? OR description LIKE ?)")
+		pattern := "%" + filters.SearchQuery + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	whereClause := "WHERE " + strings.Join(conditions, " AND ")
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s %s", r.tables.ipAllocations, whereClause)
+	var totalCount int32
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount); err != nil {
+		return nil, fmt.Errorf("failed to count IP allocations: %w", err)
+	}
+
+	limit := filters.PageSize
+	if limit <= 0 {
+		limit = 50 // Default page size
+	}
+	offset := filters.Page * limit
+
+	query := fmt.Sprintf(`
+		SELECT subnet_id, ip, hostname, description, created_at
+		FROM `+r.tables.ipAllocations+`
+		%s
+		ORDER BY created_at ASC, rowid ASC
+		LIMIT ? OFFSET ?
+	`, whereClause)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IP allocations: %w", err)
+	}
+	defer rows.Close()
+
+	allocations, err := scanAllocations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPAllocationList{
+		Allocations: allocations,
+		TotalCount:  totalCount,
+	}, nil
+}
+
+// scanAllocations reads IP allocation rows selected as
+// subnet_id, ip, hostname, description, created_at
+func scanAllocations(rows *sql.Rows) ([]*IPAllocation, error) {
+	var allocations []*IPAllocation
+	for rows.Next() {
+		allocation := &IPAllocation{}
+		var hostname, description sql.NullString
+		var createdAt int64
+
+		if err := rows.Scan(&allocation.SubnetID, &allocation.IP, &hostname, &description, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan IP allocation: %w", err)
+		}
+
+		allocation.Hostname = hostname.String
+		allocation.Description = description.String
+		allocation.CreatedAt = time.Unix(createdAt, 0)
+		allocations = append(allocations, allocation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating IP allocation rows: %w", err)
+	}
+
+	return allocations, nil
+}
+
+// Reserved range methods
+
+// CreateReservedRange stores an address range excluded from IP allocation
+func (r *SQLiteRepository) CreateReservedRange(ctx context.Context, reservation *ReservedRange) error {
+	query := `
+		INSERT INTO ` + r.tables.reservedRanges + ` (id, subnet_id, start_ip, end_ip, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		reservation.ID, reservation.SubnetID, reservation.StartIP, reservation.EndIP, reservation.Reason, reservation.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create reserved range: %w", wrapSQLiteError(err))
+	}
+
+	return nil
+}
+
+// ListReservedRanges retrieves the reserved ranges of a subnet in the order they were created
+func (r *SQLiteRepository) ListReservedRanges(ctx context.Context, subnetID string) ([]*ReservedRange, error) {
+	query := `
+		SELECT id, subnet_id, start_ip, end_ip, reason, created_at
+		FROM ` + r.tables.reservedRanges + `
+		WHERE subnet_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reserved ranges: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReservedRanges(rows)
+}
+
+// DeleteReservedRange removes a reserved range from a subnet
+func (r *SQLiteRepository) DeleteReservedRange(ctx context.Context, subnetID, id string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM "+r.tables.reservedRanges+" WHERE subnet_id = ? AND id = ?", subnetID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete reserved range: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("reserved range %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanReservedRanges reads reserved range rows selected as
+// id, subnet_id, start_ip, end_ip, reason, created_at
+func scanReservedRanges(rows *sql.Rows) ([]*ReservedRange, error) {
+	var reservations []*ReservedRange
+	for rows.Next() {
+		reservation := &ReservedRange{}
+		var reason sql.NullString
+		var createdAt int64
+
+		if err := rows.Scan(&reservation.ID, &reservation.SubnetID, &reservation.StartIP, &reservation.EndIP, &reason, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reserved range: %w", err)
+		}
+
+		reservation.Reason = reason.String
+		reservation.CreatedAt = time.Unix(createdAt, 0)
+		reservations = append(reservations, reservation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reserved range rows: %w", err)
+	}
+
+	return reservations, nil
+}
+
+// Utilization history methods
+
+// CreateUtilizationSample appends a utilization sample to a subnet's history
+func (r *SQLiteRepository) CreateUtilizationSample(ctx context.Context, sample *UtilizationSample) error {
+	query := `
+		INSERT INTO ` + r.tables.utilizationHistory + ` (subnet_id, percent, total_ips, allocated_ips, recorded_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		sample.SubnetID, sample.Percent, sample.TotalIPs, sample.AllocatedIPs, sample.RecordedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create utilization sample: %w", err)
+	}
+
+	return nil
+}
+
+// ListUtilizationHistory retrieves a subnet's samples recorded in [from, to), oldest first.
+// A zero from or to leaves that end of the range open.
+func (r *SQLiteRepository) ListUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time) ([]*UtilizationSample, error) {
+	query := `
+		SELECT subnet_id, percent, total_ips, allocated_ips, recorded_at
+		FROM ` + r.tables.utilizationHistory + `
+		WHERE subnet_id = ?
+	`
+	args := []interface{}{subnetID}
+
+	if !from.IsZero() {
+		query += " AND recorded_at >= ?"
+		args = append(args, from.Unix())
+	}
+	if !to.IsZero() {
+		query += " AND recorded_at < ?"
+		args = append(args, to.Unix())
+	}
+	query += " ORDER BY recorded_at ASC, rowid ASC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utilization history: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []*UtilizationSample
+	for rows.Next() {
+		sample := &UtilizationSample{}
+		var recordedAt int64
+
+		if err := rows.Scan(&sample.SubnetID, &sample.Percent, &sample.TotalIPs, &sample.AllocatedIPs, &recordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan utilization sample: %w", err)
+		}
+
+		sample.RecordedAt = time.Unix(recordedAt, 0)
+		samples = append(samples, sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating utilization history rows: %w", err)
+	}
+
+	return samples, nil
+}
+
+// ListUtilizationHistorySubnetIDs retrieves the IDs of all subnets that have recorded history
+func (r *SQLiteRepository) ListUtilizationHistorySubnetIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT subnet_id FROM "+r.tables.utilizationHistory+" ORDER BY subnet_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utilization history subnets: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan subnet ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating utilization history rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ReplaceUtilizationHistory atomically replaces a subnet's samples recorded in [from, to)
+func (r *SQLiteRepository) ReplaceUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time, samples []*UtilizationSample) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM "+r.tables.utilizationHistory+" WHERE subnet_id = ? AND recorded_at >= ? AND recorded_at < ?",
+		subnetID, from.Unix(), to.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete utilization history: %w", err)
+	}
+
+	for _, sample := range samples {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO "+r.tables.utilizationHistory+" (subnet_id, percent, total_ips, allocated_ips, recorded_at) VALUES (?, ?, ?, ?, ?)",
+			subnetID, sample.Percent, sample.TotalIPs, sample.AllocatedIPs, sample.RecordedAt.Unix(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert utilization sample: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit utilization history: %w", err)
+	}
+
+	return nil
+}
+
+// PruneUtilizationHistory deletes a subnet's oldest samples so at most keep remain
+func (r *SQLiteRepository) PruneUtilizationHistory(ctx context.Context, subnetID string, keep int) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM `+r.tables.utilizationHistory+`
+		WHERE subnet_id = ? AND rowid NOT IN (
+			SELECT rowid FROM `+r.tables.utilizationHistory+`
+			WHERE subnet_id = ?
+			ORDER BY recorded_at DESC, rowid DESC
+			LIMIT ?
+		)`,
+		subnetID, subnetID, keep,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune utilization history: %w", err)
+	}
+
+	return nil
+}
+
+// parseLocationType converts a string to LocationType enum
+func parseLocationType(s string) pb.LocationType {
+	s = strings.ToUpper(s)
+	switch s {
+	case "DATACENTER":
+		return pb.LocationType_DATACENTER
+	case "SITE":
+		return pb.LocationType_SITE
+	case "CLOUD":
+		return pb.LocationType_CLOUD
+	default:
+		return pb.LocationType_DATACENTER
+	}
+}
+
+// Extended methods for cloud provider integration
+
+// CreateSubnet creates a new subnet using the repository model
+func (r *SQLiteRepository) CreateSubnet(ctx context.Context, subnet *Subnet) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := r.insertSubnet(ctx, tx, subnet); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnet: %w", err)
+	}
+
+	return nil
+}
+
+// BulkCreateSubnets inserts all subnets in a single transaction. If any insert
+// fails the whole batch is rolled back and a *BulkCreateError identifies the
+// offending subnet.
+func (r *SQLiteRepository) BulkCreateSubnets(ctx context.Context, subnets []*Subnet) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, subnet := range subnets {
+		if err := r.insertSubnet(ctx, tx, subnet); err != nil {
+			return &BulkCreateError{Index: i, CIDR: subnet.CIDR, Err: err}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnets: %w", err)
+	}
+
+	return nil
+}
+
+// UpdatePrefixUtilization records the share of a subnet's address space
+// covered by its children
+func (r *SQLiteRepository) UpdatePrefixUtilization(ctx context.Context, id string, percent float64, updatedAt time.Time) error {
+	query := "UPDATE " + r.tables.subnets + " SET prefix_utilization_percent = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL"
+	result, err := r.db.ExecContext(ctx, query, percent, unixOrNow(updatedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to update prefix utilization: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// MarkSubnetSeen records when a cloud sync last reported a subnet. It leaves
+// updated_at alone, since being seen again is not a modification.
+func (r *SQLiteRepository) MarkSubnetSeen(ctx context.Context, id string, seenAt time.Time) error {
+	query := "UPDATE " + r.tables.subnets + " SET cloud_last_seen_at = ? WHERE id = ? AND deleted_at IS NULL"
+	result, err := r.db.ExecContext(ctx, query, unixOrNow(seenAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark subnet seen: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListStaleCloudSubnets retrieves the synced cloud subnets last seen before
+// seenBefore. Subnets synced before sightings were tracked fall back to their
+// update time.
+func (r *SQLiteRepository) ListStaleCloudSubnets(ctx context.Context, seenBefore time.Time) ([]*Subnet, error) {
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE location_type = 'cloud' AND cloud_resource_type = 'subnet'
+			AND COALESCE(cloud_last_seen_at, updated_at) < ? AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, seenBefore.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale cloud subnets: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubnetSummaries(rows)
+}
+
+// ListExpiredSubnets retrieves the subnets whose expiry is at or before now
+func (r *SQLiteRepository) ListExpiredSubnets(ctx context.Context, now time.Time) ([]*Subnet, error) {
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE expires_at IS NOT NULL AND expires_at <= ? AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired subnets: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubnetSummaries(rows)
+}
+
+// GetIdempotentResult returns the unexpired result saved for an idempotency key
+func (r *SQLiteRepository) GetIdempotentResult(ctx context.Context, scope, key string, now time.Time) (*IdempotentResult, error) {
+	query := `
+		SELECT resource_id, created_at, expires_at
+		FROM ` + r.tables.idempotencyKeys + `
+		WHERE scope = ? AND key = ? AND expires_at > ?
+	`
+
+	result := &IdempotentResult{Scope: scope, Key: key}
+	var createdAt, expiresAt int64
+	err := r.db.QueryRowContext(ctx, query, scope, key, now.Unix()).Scan(&result.ResourceID, &createdAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("idempotency key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	result.CreatedAt = time.Unix(createdAt, 0)
+	result.ExpiresAt = time.Unix(expiresAt, 0)
+	return result, nil
+}
+
+// SaveIdempotentResult stores the result of a request made with an
+// idempotency key, replacing a result that has expired. Expired keys are
+// purged on the way.
+func (r *SQLiteRepository) SaveIdempotentResult(ctx context.Context, result *IdempotentResult) error {
+	createdAt := unixOrNow(result.CreatedAt)
+
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM "+r.tables.idempotencyKeys+" WHERE expires_at <= ?", createdAt); err != nil {
+		return fmt.Errorf("failed to purge expired idempotency keys: %w", err)
+	}
+
+	query := `
+		INSERT INTO ` + r.tables.idempotencyKeys + ` (scope, key, resource_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (scope, key) DO NOTHING
+	`
+
+	res, err := r.db.ExecContext(ctx, query, result.Scope, result.Key, result.ResourceID, createdAt, result.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	return checkIdempotentResultInserted(res, result.Key)
+}
+
+// checkIdempotentResultInserted turns an insert skipped by ON CONFLICT into
+// the duplicate key error
+func checkIdempotentResultInserted(res sql.Result, key string) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("idempotency key %q is already in use: %w", key, ErrDuplicate)
+	}
+	return nil
+}
+
+// BulkUpdateUtilization sets allocated IPs and utilization for several subnets
+// in one transaction; nothing is written if any subnet is missing
+func (r *SQLiteRepository) BulkUpdateUtilization(ctx context.Context, updates []*UtilizationUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE ` + r.tables.subnets + ` SET allocated_ips = ?, utilization_percent = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+	for i, update := range updates {
+		result, err := tx.ExecContext(ctx, query, update.AllocatedIPs, update.UtilizationPercent, unixOrNow(update.UpdatedAt), update.SubnetID)
+		if err != nil {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("failed to update utilization: %w", err)}
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("subnet %w", ErrNotFound)}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit utilization: %w", err)
+	}
+
+	return nil
+}
+
+// RenumberSubnets moves several subnets to new CIDRs in one transaction;
+// nothing is written if any subnet is missing or a new CIDR is taken
+func (r *SQLiteRepository) RenumberSubnets(ctx context.Context, updates []*CIDRUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE ` + r.tables.subnets + ` SET
+			cidr = ?, address = ?, netmask = ?, wildcard = ?, network = ?, type = ?, broadcast = ?,
+			host_min = ?, host_max = ?, hosts_per_net = ?, is_public = ?,
+			dhcp_range_start = ?, dhcp_range_end = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+	for i, update := range updates {
+		if err := r.purgeDeletedCIDR(ctx, tx, update.CIDR); err != nil {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: err}
+		}
+
+		details := update.Details
+		if details == nil {
+			details = &SubnetDetails{}
+		}
+		result, err := tx.ExecContext(ctx, query,
+			update.CIDR, details.Address, details.Netmask, details.Wildcard, details.Network, details.Type, details.Broadcast,
+			details.HostMin, details.HostMax, details.HostsPerNet, boolToInt(details.IsPublic),
+			update.DHCPRangeStart, update.DHCPRangeEnd, unixOrNow(update.UpdatedAt),
+			update.SubnetID,
+		)
+		if err != nil {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("failed to renumber subnet: %w", wrapSQLiteError(err))}
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return &BulkUpdateError{Index: i, SubnetID: update.SubnetID, Err: fmt.Errorf("subnet %w", ErrNotFound)}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit renumbering: %w", err)
+	}
+
+	return nil
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// wrapSQLiteError tags constraint violations with ErrDuplicate or ErrConflict
+func wrapSQLiteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	default:
+		return err
+	}
+}
+
+// insertSubnet inserts a repository subnet using exec
+func (r *SQLiteRepository) insertSubnet(ctx context.Context, exec sqlExecer, subnet *Subnet) error {
+	if err := r.purgeDeletedCIDR(ctx, exec, subnet.CIDR); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO ` + r.tables.subnets + ` (
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			total_ips, allocated_ips, utilization_percent, environment, dhcp_range_start, dhcp_range_end, dns_zone, expires_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	cloudProvider := ""
+	cloudRegion := ""
+	cloudAccountID := ""
+	cloudResourceType := ""
+	cloudVPCId := ""
+	cloudSubnetId := ""
+	if subnet.CloudInfo != nil {
+		cloudProvider = subnet.CloudInfo.Provider
+		cloudRegion = subnet.CloudInfo.Region
+		cloudAccountID = subnet.CloudInfo.AccountID
+		cloudResourceType = subnet.CloudInfo.ResourceType
+		cloudVPCId = subnet.CloudInfo.VPCId
+		cloudSubnetId = subnet.CloudInfo.SubnetId
+	}
+
+	// Subnet details
+	address := ""
+	netmask := ""
+	wildcard := ""
+	network := ""
+	subnetType := ""
 	broadcast := ""
 	hostMin := ""
 	hostMax := ""
@@ -762,18 +1845,75 @@ func (r *SQLiteRepository) CreateSubnet(ctx context.Context, subnet *Subnet) err
 		utilizationPercent = subnet.Utilization.UtilizationPercent
 	}
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := exec.ExecContext(ctx, query,
 		subnet.ID, subnet.CIDR, subnet.Name, "",
 		subnet.Location, subnet.LocationType,
 		cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId,
 		subnet.ParentID, address, netmask, wildcard, network, subnetType, broadcast,
 		hostMin, hostMax, hostsPerNet, isPublic,
-		totalIPs, allocatedIPs, utilizationPercent,
-		subnet.CreatedAt.Unix(), subnet.UpdatedAt.Unix(),
+		totalIPs, allocatedIPs, utilizationPercent, subnet.Environment, subnet.DHCPRangeStart, subnet.DHCPRangeEnd, subnet.DNSZone,
+		nullableUnix(subnet.ExpiresAt), subnet.CreatedAt.Unix(), subnet.UpdatedAt.Unix(),
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to create subnet: %w", err)
+		return fmt.Errorf("failed to create subnet: %w", wrapSQLiteError(err))
+	}
+
+	return r.replaceSubnetTags(ctx, exec, subnet.ID, subnet.Tags)
+}
+
+// replaceSubnetTags replaces every tag row of a subnet with tags
+func (r *SQLiteRepository) replaceSubnetTags(ctx context.Context, exec sqlExecer, subnetID string, tags map[string]string) error {
+	if _, err := exec.ExecContext(ctx, "DELETE FROM "+r.tables.subnetTags+" WHERE subnet_id = ?", subnetID); err != nil {
+		return fmt.Errorf("failed to clear subnet tags: %w", err)
+	}
+	for key, value := range tags {
+		if _, err := exec.ExecContext(ctx, "INSERT INTO "+r.tables.subnetTags+" (subnet_id, key, value) VALUES (?, ?, ?)", subnetID, key, value); err != nil {
+			return fmt.Errorf("failed to write subnet tag %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// subnetTagsBatchSize bounds the ids per query so large lists stay under
+// SQLite's bound-parameter limit
+const subnetTagsBatchSize = 500
+
+// loadSubnetTags fills the Tags map of each subnet from the subnet_tags table.
+// Subnets without tags keep a nil map.
+func (r *SQLiteRepository) loadSubnetTags(ctx context.Context, subnets ...*Subnet) error {
+	byID := make(map[string]*Subnet, len(subnets))
+	ids := make([]interface{}, 0, len(subnets))
+	for _, subnet := range subnets {
+		byID[subnet.ID] = subnet
+		ids = append(ids, subnet.ID)
+	}
+
+	for start := 0; start < len(ids); start += subnetTagsBatchSize {
+		batch := ids[start:min(start+subnetTagsBatchSize, len(ids))]
+		query := "SELECT subnet_id, key, value FROM " + r.tables.subnetTags + " WHERE subnet_id IN (?" + strings.Repeat(", ?", len(batch)-1) + ")"
+
+		rows, err := r.db.QueryContext(ctx, query, batch...)
+		if err != nil {
+			return fmt.Errorf("failed to query subnet tags: %w", err)
+		}
+		for rows.Next() {
+			var subnetID, key, value string
+			if err := rows.Scan(&subnetID, &key, &value); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan subnet tag: %w", err)
+			}
+			subnet := byID[subnetID]
+			if subnet.Tags == nil {
+				subnet.Tags = make(map[string]string)
+			}
+			subnet.Tags[key] = value
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("error iterating subnet tag rows: %w", err)
+		}
 	}
 
 	return nil
@@ -785,27 +1925,27 @@ func (r *SQLiteRepository) GetSubnetByCIDR(ctx context.Context, cidr string) (*S
 		SELECT 
 			id, cidr, name, description, location, location_type,
 			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
-			parent_id, utilization_percent, created_at, updated_at
-		FROM subnets
-		WHERE cidr = ?
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE cidr = ? AND deleted_at IS NULL
 	`
 
 	var subnet Subnet
 	var description sql.NullString
 	var cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId sql.NullString
-	var parentID sql.NullString
-	var utilizationPercent sql.NullFloat64
+	var parentID, environment, dhcpRangeStart, dhcpRangeEnd, dnsZone sql.NullString
+	var utilizationPercent, prefixUtilizationPercent sql.NullFloat64
 	var createdAt, updatedAt int64
 
 	err := r.db.QueryRowContext(ctx, query, cidr).Scan(
 		&subnet.ID, &subnet.CIDR, &subnet.Name, &description,
 		&subnet.Location, &subnet.LocationType,
 		&cloudProvider, &cloudRegion, &cloudAccountID, &cloudResourceType, &cloudVPCId, &cloudSubnetId,
-		&parentID, &utilizationPercent, &createdAt, &updatedAt,
+		&parentID, &environment, &dhcpRangeStart, &dhcpRangeEnd, &dnsZone, &utilizationPercent, &prefixUtilizationPercent, &createdAt, &updatedAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("subnet not found")
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
@@ -826,29 +1966,38 @@ func (r *SQLiteRepository) GetSubnetByCIDR(ctx context.Context, cidr string) (*S
 	// Parse utilization
 	if utilizationPercent.Valid {
 		subnet.Utilization = &Utilization{
-			UtilizationPercent: utilizationPercent.Float64,
-			LastUpdated:        time.Unix(updatedAt, 0),
+			UtilizationPercent:       utilizationPercent.Float64,
+			PrefixUtilizationPercent: prefixUtilizationPercent.Float64,
+			LastUpdated:              time.Unix(updatedAt, 0),
 		}
 	}
 
 	if parentID.Valid {
 		subnet.ParentID = parentID.String
 	}
+	subnet.Environment = environment.String
+	subnet.DHCPRangeStart = dhcpRangeStart.String
+	subnet.DHCPRangeEnd = dhcpRangeEnd.String
+	subnet.DNSZone = dnsZone.String
 
 	subnet.CreatedAt = time.Unix(createdAt, 0)
 	subnet.UpdatedAt = time.Unix(updatedAt, 0)
 
+	if err := r.loadSubnetTags(ctx, &subnet); err != nil {
+		return nil, err
+	}
+
 	return &subnet, nil
 }
 
 // UpdateSubnet updates an existing subnet using the repository model
 func (r *SQLiteRepository) UpdateSubnet(ctx context.Context, id string, subnet *Subnet) error {
 	query := `
-		UPDATE subnets SET
+		UPDATE ` + r.tables.subnets + ` SET
 			cidr = ?, name = ?, location = ?, location_type = ?,
 			cloud_provider = ?, cloud_region = ?, cloud_account_id = ?,
-			utilization_percent = ?, updated_at = ?
-		WHERE id = ?
+			environment = ?, dhcp_range_start = ?, dhcp_range_end = ?, dns_zone = ?, utilization_percent = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	cloudProvider := ""
@@ -865,15 +2014,21 @@ func (r *SQLiteRepository) UpdateSubnet(ctx context.Context, id string, subnet *
 		utilizationPercent = subnet.Utilization.UtilizationPercent
 	}
 
-	result, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query,
 		subnet.CIDR, subnet.Name, subnet.Location, subnet.LocationType,
 		cloudProvider, cloudRegion, cloudAccountID,
-		utilizationPercent, subnet.UpdatedAt.Unix(),
+		subnet.Environment, subnet.DHCPRangeStart, subnet.DHCPRangeEnd, subnet.DNSZone, utilizationPercent, subnet.UpdatedAt.Unix(),
 		id,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to update subnet: %w", err)
+		return fmt.Errorf("failed to update subnet: %w", wrapSQLiteError(err))
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -882,7 +2037,18 @@ func (r *SQLiteRepository) UpdateSubnet(ctx context.Context, id string, subnet *
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("subnet not found")
+		return fmt.Errorf("subnet %w", ErrNotFound)
+	}
+
+	// Nil tags leave the stored tags unchanged, as in MongoDB
+	if subnet.Tags != nil {
+		if err := r.replaceSubnetTags(ctx, tx, id, subnet.Tags); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subnet update: %w", err)
 	}
 
 	return nil
@@ -894,72 +2060,355 @@ func (r *SQLiteRepository) ListSubnets(ctx context.Context, filters SubnetFilter
 		SELECT 
 			id, cidr, name, description, location, location_type,
 			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
-			parent_id, utilization_percent, created_at, updated_at
-		FROM subnets
-		WHERE 1=1
+			parent_id, address, netmask, wildcard, network, type, broadcast,
+			host_min, host_max, hosts_per_net, is_public,
+			environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, expires_at, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE deleted_at IS NULL
 	`
 
 	whereClause := ""
-	args := []interface{}{}
+	filterArgs := []interface{}{}
 
 	// Apply filters
 	if filters.LocationFilter != "" {
 		whereClause += " AND location LIKE ?"
-		args = append(args, "%"+filters.LocationFilter+"%")
+		filterArgs = append(filterArgs, "%"+filters.LocationFilter+"%")
 	}
 	if filters.CloudProviderFilter != "" {
 		whereClause += " AND cloud_provider = ?"
-		args = append(args, filters.CloudProviderFilter)
+		filterArgs = append(filterArgs, filters.CloudProviderFilter)
 	}
 	if filters.CloudProvider != "" {
 		whereClause += " AND cloud_provider = ?"
-		args = append(args, filters.CloudProvider)
+		filterArgs = append(filterArgs, filters.CloudProvider)
+	}
+	if filters.Environment != "" {
+		whereClause += " AND environment = ?"
+		filterArgs = append(filterArgs, filters.Environment)
+	}
+	switch filters.ManagedBy {
+	case ManagedByCloud:
+		whereClause += " AND COALESCE(cloud_vpc_id, '') <> ''"
+	case ManagedByManual:
+		whereClause += " AND COALESCE(cloud_vpc_id, '') = ''"
 	}
 	if filters.SearchQuery != "" {
-		whereClause += " AND (name LIKE ? OR cidr LIKE ? OR description LIKE ? OR location LIKE ?)"
+		whereClause += " AND (name LIKE ? OR cidr LIKE ? OR description LIKE ? OR location LIKE ? OR dns_zone LIKE ?)"
 		searchPattern := "%" + filters.SearchQuery + "%"
-		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern)
+		filterArgs = append(filterArgs, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
+	}
+	for _, key := range sortedTagKeys(filters.TagFilter) {
+		whereClause += " AND EXISTS (SELECT 1 FROM " + r.tables.subnetTags + " t WHERE t.subnet_id = " + r.tables.subnets + ".id AND t.key = ? AND t.value = ?)"
+		filterArgs = append(filterArgs, key, filters.TagFilter[key])
+	}
+	if filters.IsPublic != nil {
+		whereClause += " AND COALESCE(is_public, 0) = ?"
+		filterArgs = append(filterArgs, boolToInt(*filters.IsPublic))
+	}
+	if filters.PrefixLength != nil {
+		whereClause += " AND cidr LIKE ?"
+		filterArgs = append(filterArgs, prefixLengthPattern(*filters.PrefixLength))
 	}
 
-	// Count total records
-	countQuery := "SELECT COUNT(*) FROM subnets WHERE 1=1" + whereClause
+	// Count total records (filter arguments only)
+	countQuery := "SELECT COUNT(*) FROM " + r.tables.subnets + " WHERE deleted_at IS NULL" + whereClause
 	var totalCount int32
-	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
+	err := r.db.QueryRowContext(ctx, countQuery, filterArgs...).Scan(&totalCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count subnets: %w", err)
 	}
 
-	// Build final query
-	finalQuery := baseQuery + whereClause + " ORDER BY created_at DESC"
-
-	// Apply pagination
-	if filters.PageSize > 0 {
+	// Build final query with its own argument slice so pagination
+	// arguments never leak into (or depend on) the count query
+	finalQuery := baseQuery + whereClause
+	queryArgs := make([]interface{}, len(filterArgs), len(filterArgs)+5)
+	copy(queryArgs, filterArgs)
+
+	// Apply pagination; CIDR prefix matching happens in Go, so it paginates afterwards
+	paginate := filters.PageSize > 0 && filters.CIDRPrefix == ""
+	if filters.After != nil && filters.CIDRPrefix == "" {
+		createdAt := filters.After.CreatedAt.Unix()
+		finalQuery += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		queryArgs = append(queryArgs, createdAt, createdAt, filters.After.ID)
+	}
+	finalQuery += " ORDER BY created_at DESC, id DESC"
+	if paginate && filters.After != nil {
+		finalQuery += " LIMIT ?"
+		queryArgs = append(queryArgs, filters.PageSize)
+	} else if paginate {
 		finalQuery += " LIMIT ? OFFSET ?"
 		offset := filters.Page * filters.PageSize
-		args = append(args, filters.PageSize, offset)
+		queryArgs = append(queryArgs, filters.PageSize, offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, finalQuery, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subnets: %w", err)
+	}
+	defer rows.Close()
+
+	subnets, err := scanListedSubnets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.CIDRPrefix != "" {
+		matched, err := filterByCIDRPrefix(subnets, filters.CIDRPrefix)
+		if err != nil {
+			return nil, err
+		}
+		if filters.After != nil {
+			subnets = pageAfterCursor(matched, filters.After, filters.PageSize)
+		} else {
+			subnets = paginateSubnets(matched, filters.Page, filters.PageSize)
+		}
+		totalCount = int32(len(matched))
+	}
+
+	if err := r.loadSubnetTags(ctx, subnets...); err != nil {
+		return nil, err
+	}
+
+	return &SubnetList{
+		Subnets:    subnets,
+		TotalCount: totalCount,
+		NextCursor: nextSubnetCursor(subnets, filters.PageSize),
+	}, nil
+}
+
+// GetSubnetChildren retrieves child subnets for a given parent subnet ID
+func (r *SQLiteRepository) GetSubnetChildren(ctx context.Context, parentID string) ([]*Subnet, error) {
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE parent_id = ? AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child subnets: %w", err)
+	}
+	defer rows.Close()
+
+	children, err := scanSubnetSummaries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadSubnetTags(ctx, children...); err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
+
+// GetSubnetSiblings retrieves a page of the subnets sharing parentID with the
+// subnet id, excluding that subnet. An empty parentID lists top-level subnets.
+func (r *SQLiteRepository) GetSubnetSiblings(ctx context.Context, id, parentID string, page, pageSize int32) (*SubnetList, error) {
+	whereClause := " WHERE COALESCE(parent_id, '') = ? AND id != ? AND deleted_at IS NULL"
+	args := []interface{}{parentID, id}
+
+	var totalCount int32
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+r.tables.subnets+whereClause, args...).Scan(&totalCount); err != nil {
+		return nil, fmt.Errorf("failed to count sibling subnets: %w", err)
+	}
+
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM ` + r.tables.subnets + whereClause + `
+		ORDER BY cidr, id
+	`
+	if pageSize > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, pageSize, page*pageSize)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sibling subnets: %w", err)
+	}
+	defer rows.Close()
+
+	siblings, err := scanSubnetSummaries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadSubnetTags(ctx, siblings...); err != nil {
+		return nil, err
+	}
+
+	return &SubnetList{Subnets: siblings, TotalCount: totalCount}, nil
+}
+
+// GetChildRollups aggregates the utilization of the direct children of each
+// parent in a single grouped query. Parents without children are omitted.
+func (r *SQLiteRepository) GetChildRollups(ctx context.Context, parentIDs []string) (map[string]*ChildRollup, error) {
+	if len(parentIDs) == 0 {
+		return map[string]*ChildRollup{}, nil
+	}
+
+	args := make([]interface{}, len(parentIDs))
+	for i, id := range parentIDs {
+		args[i] = id
+	}
+
+	query := `
+		SELECT parent_id, COUNT(*), COALESCE(SUM(total_ips), 0), COALESCE(SUM(allocated_ips), 0)
+		FROM ` + r.tables.subnets + `
+		WHERE parent_id IN (?` + strings.Repeat(", ?", len(parentIDs)-1) + `) AND deleted_at IS NULL
+		GROUP BY parent_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child rollups: %w", err)
+	}
+	defer rows.Close()
+
+	return scanChildRollups(rows)
+}
+
+// scanChildRollups reads (parent_id, count, total_ips, allocated_ips) rows
+func scanChildRollups(rows *sql.Rows) (map[string]*ChildRollup, error) {
+	rollups := make(map[string]*ChildRollup)
+	for rows.Next() {
+		var parentID string
+		var childCount int32
+		var totalIPs, allocatedIPs int64
+		if err := rows.Scan(&parentID, &childCount, &totalIPs, &allocatedIPs); err != nil {
+			return nil, fmt.Errorf("failed to scan child rollup: %w", err)
+		}
+		rollups[parentID] = newChildRollup(childCount, totalIPs, allocatedIPs)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating child rollup rows: %w", err)
+	}
+
+	return rollups, nil
+}
+
+// CountSubnetsByEnvironment counts subnets per environment. Subnets without an
+// environment are counted under the empty string.
+func (r *SQLiteRepository) CountSubnetsByEnvironment(ctx context.Context) (map[string]int32, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT COALESCE(environment, ''), COUNT(*) FROM "+r.tables.subnets+" WHERE deleted_at IS NULL GROUP BY COALESCE(environment, '')")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets by environment: %w", err)
+	}
+	defer rows.Close()
+
+	return scanEnvironmentCounts(rows)
+}
+
+// scanEnvironmentCounts reads (environment, count) rows
+func scanEnvironmentCounts(rows *sql.Rows) (map[string]int32, error) {
+	counts := make(map[string]int32)
+	for rows.Next() {
+		var environment string
+		var count int32
+		if err := rows.Scan(&environment, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan environment count: %w", err)
+		}
+		counts[environment] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating environment count rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CountSubnetsByPrefixLength counts subnets per CIDR prefix length. Rows whose
+// CIDR has no prefix length are skipped.
+func (r *SQLiteRepository) CountSubnetsByPrefixLength(ctx context.Context) (map[int32]int32, error) {
+	query := `
+		SELECT CAST(substr(cidr, instr(cidr, '/') + 1) AS INTEGER) AS prefix_length, COUNT(*)
+		FROM ` + r.tables.subnets + `
+		WHERE instr(cidr, '/') > 0 AND deleted_at IS NULL
+		GROUP BY prefix_length
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subnets by prefix length: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPrefixLengthCounts(rows)
+}
+
+// scanPrefixLengthCounts reads (prefix_length, count) rows
+func scanPrefixLengthCounts(rows *sql.Rows) (map[int32]int32, error) {
+	counts := make(map[int32]int32)
+	for rows.Next() {
+		var prefixLength, count int32
+		if err := rows.Scan(&prefixLength, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan prefix length count: %w", err)
+		}
+		counts[prefixLength] = count
 	}
 
-	rows, err := r.db.QueryContext(ctx, finalQuery, args...)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating prefix length count rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// FindOverlappingSubnets retrieves subnets in a location whose CIDR overlaps the given CIDR
+func (r *SQLiteRepository) FindOverlappingSubnets(ctx context.Context, cidr, location string) ([]*Subnet, error) {
+	query := `
+		SELECT 
+			id, cidr, name, description, location, location_type,
+			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
+			parent_id, environment, dhcp_range_start, dhcp_range_end, dns_zone, utilization_percent, prefix_utilization_percent, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE location = ? AND deleted_at IS NULL
+		ORDER BY cidr
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, location)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query subnets: %w", err)
 	}
 	defer rows.Close()
 
+	subnets, err := scanSubnetSummaries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterOverlapping(subnets, cidr)
+}
+
+// scanSubnetSummaries scans rows selected with the column list shared by
+// GetSubnetChildren, FindOverlappingSubnets and ListStaleCloudSubnets
+func scanSubnetSummaries(rows *sql.Rows) ([]*Subnet, error) {
 	var subnets []*Subnet
 
 	for rows.Next() {
 		var subnet Subnet
 		var description sql.NullString
 		var cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId sql.NullString
-		var parentID sql.NullString
-		var utilizationPercent sql.NullFloat64
+		var parentID, environment, dhcpRangeStart, dhcpRangeEnd, dnsZone sql.NullString
+		var utilizationPercent, prefixUtilizationPercent sql.NullFloat64
 		var createdAt, updatedAt int64
 
 		err := rows.Scan(
 			&subnet.ID, &subnet.CIDR, &subnet.Name, &description,
 			&subnet.Location, &subnet.LocationType,
 			&cloudProvider, &cloudRegion, &cloudAccountID, &cloudResourceType, &cloudVPCId, &cloudSubnetId,
-			&parentID, &utilizationPercent, &createdAt, &updatedAt,
+			&parentID, &environment, &dhcpRangeStart, &dhcpRangeEnd, &dnsZone, &utilizationPercent, &prefixUtilizationPercent, &createdAt, &updatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan subnet: %w", err)
@@ -980,14 +2429,19 @@ func (r *SQLiteRepository) ListSubnets(ctx context.Context, filters SubnetFilter
 		// Parse utilization
 		if utilizationPercent.Valid {
 			subnet.Utilization = &Utilization{
-				UtilizationPercent: utilizationPercent.Float64,
-				LastUpdated:        time.Unix(updatedAt, 0),
+				UtilizationPercent:       utilizationPercent.Float64,
+				PrefixUtilizationPercent: prefixUtilizationPercent.Float64,
+				LastUpdated:              time.Unix(updatedAt, 0),
 			}
 		}
 
 		if parentID.Valid {
 			subnet.ParentID = parentID.String
 		}
+		subnet.Environment = environment.String
+		subnet.DHCPRangeStart = dhcpRangeStart.String
+		subnet.DHCPRangeEnd = dhcpRangeEnd.String
+		subnet.DNSZone = dnsZone.String
 
 		subnet.CreatedAt = time.Unix(createdAt, 0)
 		subnet.UpdatedAt = time.Unix(updatedAt, 0)
@@ -996,51 +2450,39 @@ func (r *SQLiteRepository) ListSubnets(ctx context.Context, filters SubnetFilter
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return nil, fmt.Errorf("error iterating subnet rows: %w", err)
 	}
 
-	return &SubnetList{
-		Subnets:    subnets,
-		TotalCount: totalCount,
-	}, nil
+	return subnets, nil
 }
 
-// GetSubnetChildren retrieves child subnets for a given parent subnet ID
-func (r *SQLiteRepository) GetSubnetChildren(ctx context.Context, parentID string) ([]*Subnet, error) {
-	query := `
-		SELECT 
-			id, cidr, name, description, location, location_type,
-			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
-			parent_id, utilization_percent, created_at, updated_at
-		FROM subnets
-		WHERE parent_id = ?
-		ORDER BY cidr
-	`
-
-	rows, err := r.db.QueryContext(ctx, query, parentID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query child subnets: %w", err)
-	}
-	defer rows.Close()
-
+// scanListedSubnets scans rows selected with the column list of ListSubnets,
+// which adds the calculated details to the summary columns
+func scanListedSubnets(rows *sql.Rows) ([]*Subnet, error) {
 	var subnets []*Subnet
 
 	for rows.Next() {
 		var subnet Subnet
 		var description sql.NullString
 		var cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId sql.NullString
-		var parentID sql.NullString
-		var utilizationPercent sql.NullFloat64
+		var parentID, environment, dhcpRangeStart, dhcpRangeEnd, dnsZone sql.NullString
+		var address, netmask, wildcard, network, subnetType, broadcast sql.NullString
+		var hostMin, hostMax sql.NullString
+		var hostsPerNet, isPublic sql.NullInt32
+		var utilizationPercent, prefixUtilizationPercent sql.NullFloat64
+		var expiresAt sql.NullInt64
 		var createdAt, updatedAt int64
 
 		err := rows.Scan(
 			&subnet.ID, &subnet.CIDR, &subnet.Name, &description,
 			&subnet.Location, &subnet.LocationType,
 			&cloudProvider, &cloudRegion, &cloudAccountID, &cloudResourceType, &cloudVPCId, &cloudSubnetId,
-			&parentID, &utilizationPercent, &createdAt, &updatedAt,
+			&parentID, &address, &netmask, &wildcard, &network, &subnetType, &broadcast,
+			&hostMin, &hostMax, &hostsPerNet, &isPublic,
+			&environment, &dhcpRangeStart, &dhcpRangeEnd, &dnsZone, &utilizationPercent, &prefixUtilizationPercent, &expiresAt, &createdAt, &updatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan child subnet: %w", err)
+			return nil, fmt.Errorf("failed to scan subnet: %w", err)
 		}
 
 		// Parse cloud info
@@ -1055,17 +2497,39 @@ func (r *SQLiteRepository) GetSubnetChildren(ctx context.Context, parentID strin
 			}
 		}
 
+		// Parse subnet details
+		if address.Valid {
+			subnet.Details = &SubnetDetails{
+				Address:     address.String,
+				Netmask:     netmask.String,
+				Wildcard:    wildcard.String,
+				Network:     network.String,
+				Type:        subnetType.String,
+				Broadcast:   broadcast.String,
+				HostMin:     hostMin.String,
+				HostMax:     hostMax.String,
+				HostsPerNet: hostsPerNet.Int32,
+				IsPublic:    isPublic.Int32 == 1,
+			}
+		}
+
 		// Parse utilization
 		if utilizationPercent.Valid {
 			subnet.Utilization = &Utilization{
-				UtilizationPercent: utilizationPercent.Float64,
-				LastUpdated:        time.Unix(updatedAt, 0),
+				UtilizationPercent:       utilizationPercent.Float64,
+				PrefixUtilizationPercent: prefixUtilizationPercent.Float64,
+				LastUpdated:              time.Unix(updatedAt, 0),
 			}
 		}
 
 		if parentID.Valid {
 			subnet.ParentID = parentID.String
 		}
+		subnet.Environment = environment.String
+		subnet.DHCPRangeStart = dhcpRangeStart.String
+		subnet.DHCPRangeEnd = dhcpRangeEnd.String
+		subnet.DNSZone = dnsZone.String
+		subnet.ExpiresAt = unixTimeOrNil(expiresAt)
 
 		subnet.CreatedAt = time.Unix(createdAt, 0)
 		subnet.UpdatedAt = time.Unix(updatedAt, 0)
@@ -1074,7 +2538,7 @@ func (r *SQLiteRepository) GetSubnetChildren(ctx context.Context, parentID strin
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating child subnet rows: %w", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
 	return subnets, nil
@@ -1088,21 +2552,22 @@ func (r *SQLiteRepository) GetSubnetByID(ctx context.Context, id string) (*Subne
 			cloud_provider, cloud_region, cloud_account_id, cloud_resource_type, cloud_vpc_id, cloud_subnet_id,
 			parent_id, address, netmask, wildcard, network, type, broadcast,
 			host_min, host_max, hosts_per_net, is_public,
-			total_ips, allocated_ips, utilization_percent, created_at, updated_at
-		FROM subnets
-		WHERE id = ?
+			total_ips, allocated_ips, utilization_percent, prefix_utilization_percent, environment, dhcp_range_start, dhcp_range_end, dns_zone, expires_at, created_at, updated_at
+		FROM ` + r.tables.subnets + `
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	var subnet Subnet
 	var description sql.NullString
 	var cloudProvider, cloudRegion, cloudAccountID, cloudResourceType, cloudVPCId, cloudSubnetId sql.NullString
-	var parentID sql.NullString
+	var parentID, environment, dhcpRangeStart, dhcpRangeEnd, dnsZone sql.NullString
 	var address, netmask, wildcard, network, subnetType, broadcast sql.NullString
 	var hostMin, hostMax sql.NullString
 	var hostsPerNet sql.NullInt32
 	var isPublic sql.NullInt32
 	var totalIPs, allocatedIPs sql.NullInt32
-	var utilizationPercent sql.NullFloat64
+	var utilizationPercent, prefixUtilizationPercent sql.NullFloat64
+	var expiresAt sql.NullInt64
 	var createdAt, updatedAt int64
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
@@ -1111,11 +2576,11 @@ func (r *SQLiteRepository) GetSubnetByID(ctx context.Context, id string) (*Subne
 		&cloudProvider, &cloudRegion, &cloudAccountID, &cloudResourceType, &cloudVPCId, &cloudSubnetId,
 		&parentID, &address, &netmask, &wildcard, &network, &subnetType, &broadcast,
 		&hostMin, &hostMax, &hostsPerNet, &isPublic,
-		&totalIPs, &allocatedIPs, &utilizationPercent, &createdAt, &updatedAt,
+		&totalIPs, &allocatedIPs, &utilizationPercent, &prefixUtilizationPercent, &environment, &dhcpRangeStart, &dhcpRangeEnd, &dnsZone, &expiresAt, &createdAt, &updatedAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("subnet not found")
+		return nil, fmt.Errorf("subnet %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
@@ -1152,19 +2617,29 @@ func (r *SQLiteRepository) GetSubnetByID(ctx context.Context, id string) (*Subne
 	// Parse utilization
 	if utilizationPercent.Valid {
 		subnet.Utilization = &Utilization{
-			TotalIPs:           totalIPs.Int32,
-			AllocatedIPs:       allocatedIPs.Int32,
-			UtilizationPercent: utilizationPercent.Float64,
-			LastUpdated:        time.Unix(updatedAt, 0),
+			TotalIPs:                 totalIPs.Int32,
+			AllocatedIPs:             allocatedIPs.Int32,
+			UtilizationPercent:       utilizationPercent.Float64,
+			PrefixUtilizationPercent: prefixUtilizationPercent.Float64,
+			LastUpdated:              time.Unix(updatedAt, 0),
 		}
 	}
 
 	if parentID.Valid {
 		subnet.ParentID = parentID.String
 	}
+	subnet.Environment = environment.String
+	subnet.DHCPRangeStart = dhcpRangeStart.String
+	subnet.DHCPRangeEnd = dhcpRangeEnd.String
+	subnet.DNSZone = dnsZone.String
+	subnet.ExpiresAt = unixTimeOrNil(expiresAt)
 
 	subnet.CreatedAt = time.Unix(createdAt, 0)
 	subnet.UpdatedAt = time.Unix(updatedAt, 0)
 
+	if err := r.loadSubnetTags(ctx, &subnet); err != nil {
+		return nil, err
+	}
+
 	return &subnet, nil
 }
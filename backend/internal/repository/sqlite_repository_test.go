@@ -2,9 +2,15 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	pb "github.com/bananaops/ipam-bananaops/proto"
 )
@@ -250,3 +256,1490 @@ func TestSQLiteRepository_DatabasePath(t *testing.T) {
 		t.Error("Database file was not created")
 	}
 }
+
+func TestSQLiteRepository_ListSubnetsFiltersWithPagination(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+
+	// Five subnets in datacenter-1 and two elsewhere
+	subnets := []struct {
+		id       string
+		cidr     string
+		location string
+	}{
+		{"dc1-a", "10.0.1.0/24", "datacenter-1"},
+		{"dc1-b", "10.0.2.0/24", "datacenter-1"},
+		{"dc1-c", "10.0.3.0/24", "datacenter-1"},
+		{"dc1-d", "10.0.4.0/24", "datacenter-1"},
+		{"dc1-e", "10.0.5.0/24", "datacenter-1"},
+		{"dc2-a", "10.1.1.0/24", "datacenter-2"},
+		{"dc2-b", "10.1.2.0/24", "datacenter-2"},
+	}
+
+	for i, s := range subnets {
+		subnet := &Subnet{
+			ID:           s.id,
+			CIDR:         s.cidr,
+			Name:         s.id,
+			Location:     s.location,
+			LocationType: "datacenter",
+			CreatedAt:    base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:    base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", s.id, err)
+		}
+	}
+
+	filters := SubnetFilters{
+		LocationFilter: "datacenter-1",
+		SearchQuery:    "10.0",
+		Page:           1,
+		PageSize:       2,
+	}
+
+	result, err := repo.ListSubnets(ctx, filters)
+	if err != nil {
+		t.Fatalf("Failed to list subnets: %v", err)
+	}
+
+	if result.TotalCount != 5 {
+		t.Errorf("Expected total count 5, got %d", result.TotalCount)
+	}
+
+	// Ordered by created_at DESC: e, d | c, b | a
+	if len(result.Subnets) != 2 {
+		t.Fatalf("Expected 2 subnets on page 1, got %d", len(result.Subnets))
+	}
+	if result.Subnets[0].ID != "dc1-c" || result.Subnets[1].ID != "dc1-b" {
+		t.Errorf("Expected [dc1-c dc1-b], got [%s %s]", result.Subnets[0].ID, result.Subnets[1].ID)
+	}
+
+	// Last, partial page
+	filters.Page = 2
+	result, err = repo.ListSubnets(ctx, filters)
+	if err != nil {
+		t.Fatalf("Failed to list subnets: %v", err)
+	}
+	if result.TotalCount != 5 {
+		t.Errorf("Expected total count 5 on last page, got %d", result.TotalCount)
+	}
+	if len(result.Subnets) != 1 || result.Subnets[0].ID != "dc1-a" {
+		t.Errorf("Expected only dc1-a on last page, got %d subnets", len(result.Subnets))
+	}
+}
+
+func TestSQLiteRepository_ListSubnetsCIDRPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+
+	subnets := []struct {
+		id   string
+		cidr string
+	}{
+		{"ten-8", "10.0.0.0/8"},
+		{"ten-zero-16", "10.0.0.0/16"},
+		{"ten-zero-24", "10.0.1.0/24"},
+		{"ten-one-16", "10.1.0.0/16"},
+		{"hundred-ten", "110.0.0.0/16"},
+		{"ten-ten", "10.10.0.0/16"},
+	}
+
+	for i, s := range subnets {
+		subnet := &Subnet{
+			ID:           s.id,
+			CIDR:         s.cidr,
+			Name:         s.id,
+			Location:     "datacenter-1",
+			LocationType: "datacenter",
+			CreatedAt:    base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:    base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", s.id, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		cidrPrefix string
+		want       []string
+	}{
+		// Ordered by created_at DESC
+		{"partial prefix", "10.0", []string{"ten-zero-24", "ten-zero-16", "ten-8"}},
+		{"partial prefix with trailing dot", "10.0.", []string{"ten-zero-24", "ten-zero-16", "ten-8"}},
+		{"full CIDR", "10.0.0.0/16", []string{"ten-zero-24", "ten-zero-16", "ten-8"}},
+		{"containing CIDR", "10.0.1.0/24", []string{"ten-zero-24", "ten-zero-16", "ten-8"}},
+		{"single address", "10.1.2.3", []string{"ten-one-16", "ten-8"}},
+		{"other first octet", "110", []string{"hundred-ten"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.ListSubnets(ctx, SubnetFilters{CIDRPrefix: tt.cidrPrefix})
+			if err != nil {
+				t.Fatalf("Failed to list subnets: %v", err)
+			}
+
+			var got []string
+			for _, subnet := range result.Subnets {
+				got = append(got, subnet.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if result.TotalCount != int32(len(tt.want)) {
+				t.Errorf("Expected total count %d, got %d", len(tt.want), result.TotalCount)
+			}
+		})
+	}
+
+	t.Run("paginates after matching", func(t *testing.T) {
+		result, err := repo.ListSubnets(ctx, SubnetFilters{CIDRPrefix: "10.0", Page: 1, PageSize: 2})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		if result.TotalCount != 3 {
+			t.Errorf("Expected total count 3, got %d", result.TotalCount)
+		}
+		if len(result.Subnets) != 1 || result.Subnets[0].ID != "ten-8" {
+			t.Errorf("Expected only ten-8 on page 1, got %d subnets", len(result.Subnets))
+		}
+	})
+
+	t.Run("invalid prefix", func(t *testing.T) {
+		for _, value := range []string{"10.256", "10.0.0.0.0", "abc", "10.0.0.0/40"} {
+			if _, err := repo.ListSubnets(ctx, SubnetFilters{CIDRPrefix: value}); err == nil {
+				t.Errorf("Expected error for cidr_prefix %q", value)
+			}
+		}
+	})
+}
+
+func TestSQLiteRepository_SubnetNotes(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	for _, s := range []*Subnet{
+		{ID: "subnet-1", CIDR: "10.0.1.0/24", Name: "Subnet 1", CreatedAt: now, UpdatedAt: now},
+		{ID: "subnet-2", CIDR: "10.0.2.0/24", Name: "Subnet 2", CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := repo.CreateSubnet(ctx, s); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", s.ID, err)
+		}
+	}
+
+	// The last two notes share a timestamp and must keep insertion order
+	notes := []*SubnetNote{
+		{ID: "note-1", SubnetID: "subnet-1", Author: "alice", Text: "Reserved for the payments team", CreatedAt: now},
+		{ID: "note-2", SubnetID: "subnet-2", Author: "bob", Text: "Unrelated", CreatedAt: now},
+		{ID: "note-3", SubnetID: "subnet-1", Author: "bob", Text: "Gateway moved to .254", CreatedAt: now.Add(time.Minute)},
+		{ID: "note-4", SubnetID: "subnet-1", Author: "anonymous", Text: "Pending decommission", CreatedAt: now.Add(time.Minute)},
+	}
+	for _, n := range notes {
+		if err := repo.CreateSubnetNote(ctx, n); err != nil {
+			t.Fatalf("Failed to create note %s: %v", n.ID, err)
+		}
+	}
+
+	found, err := repo.ListSubnetNotes(ctx, "subnet-1")
+	if err != nil {
+		t.Fatalf("Failed to list notes: %v", err)
+	}
+
+	expected := []string{"note-1", "note-3", "note-4"}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d notes, got %d", len(expected), len(found))
+	}
+	for i, id := range expected {
+		if found[i].ID != id {
+			t.Errorf("Expected note %d to be %s, got %s", i, id, found[i].ID)
+		}
+	}
+	if found[1].Author != "bob" || found[1].Text != "Gateway moved to .254" {
+		t.Errorf("Unexpected note content: %+v", found[1])
+	}
+	if !found[1].CreatedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected created_at %v, got %v", now.Add(time.Minute), found[1].CreatedAt)
+	}
+
+	// A subnet without notes lists nothing
+	found, err = repo.ListSubnetNotes(ctx, "subnet-3")
+	if err != nil {
+		t.Fatalf("Failed to list notes: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("Expected no notes, got %d", len(found))
+	}
+}
+
+func TestSQLiteRepository_SoftDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	for _, subnet := range []*Subnet{
+		{ID: "subnet-a", CIDR: "10.0.1.0/24", Name: "a", Location: "dc-1", CreatedAt: now, UpdatedAt: now},
+		{ID: "subnet-b", CIDR: "10.0.2.0/24", Name: "b", Location: "dc-1", CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet: %v", err)
+		}
+	}
+	connection := &Connection{
+		ID:             "conn-ab",
+		SourceSubnetID: "subnet-a",
+		TargetSubnetID: "subnet-b",
+		ConnectionType: "vpn",
+		Status:         "active",
+		Name:           "a to b",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := repo.CreateConnection(ctx, connection); err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+
+	countConnections := func() int32 {
+		t.Helper()
+		list, err := repo.ListConnections(ctx, ConnectionFilters{})
+		if err != nil {
+			t.Fatalf("Failed to list connections: %v", err)
+		}
+		return list.TotalCount
+	}
+
+	if err := repo.Delete(ctx, "subnet-a"); err != nil {
+		t.Fatalf("Failed to delete subnet: %v", err)
+	}
+
+	t.Run("hides the subnet and its connections", func(t *testing.T) {
+		if _, err := repo.GetSubnetByID(ctx, "subnet-a"); err == nil {
+			t.Error("Expected soft-deleted subnet to be hidden")
+		}
+		list, err := repo.ListSubnets(ctx, SubnetFilters{})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		if list.TotalCount != 1 || len(list.Subnets) != 1 {
+			t.Errorf("Expected 1 listed subnet, got %d (%d returned)", list.TotalCount, len(list.Subnets))
+		}
+		if _, err := repo.GetConnectionByID(ctx, "conn-ab"); err == nil {
+			t.Error("Expected connection to a soft-deleted subnet to be hidden")
+		}
+		if n := countConnections(); n != 0 {
+			t.Errorf("Expected 0 listed connections, got %d", n)
+		}
+		if err := repo.Delete(ctx, "subnet-a"); err == nil {
+			t.Error("Expected deleting a soft-deleted subnet again to fail")
+		}
+	})
+
+	t.Run("restore brings back the subnet and its connections", func(t *testing.T) {
+		if err := repo.RestoreSubnet(ctx, "subnet-a"); err != nil {
+			t.Fatalf("Failed to restore subnet: %v", err)
+		}
+		if _, err := repo.GetSubnetByID(ctx, "subnet-a"); err != nil {
+			t.Errorf("Expected restored subnet to be found: %v", err)
+		}
+		if n := countConnections(); n != 1 {
+			t.Errorf("Expected 1 listed connection, got %d", n)
+		}
+		if err := repo.RestoreSubnet(ctx, "subnet-a"); err == nil {
+			t.Error("Expected restoring a live subnet to fail")
+		}
+	})
+
+	t.Run("recreating a deleted CIDR replaces the deleted row", func(t *testing.T) {
+		if err := repo.Delete(ctx, "subnet-b"); err != nil {
+			t.Fatalf("Failed to delete subnet: %v", err)
+		}
+		replacement := &Subnet{ID: "subnet-b2", CIDR: "10.0.2.0/24", Name: "b2", Location: "dc-1", CreatedAt: now, UpdatedAt: now}
+		if err := repo.CreateSubnet(ctx, replacement); err != nil {
+			t.Fatalf("Failed to recreate subnet with a deleted CIDR: %v", err)
+		}
+		if err := repo.RestoreSubnet(ctx, "subnet-b"); err == nil {
+			t.Error("Expected the replaced subnet to be gone")
+		}
+		if _, err := repo.GetConnectionByID(ctx, "conn-ab"); err == nil {
+			t.Error("Expected connections of the replaced subnet to be purged")
+		}
+	})
+
+	t.Run("purge removes the subnet for good", func(t *testing.T) {
+		if _, err := repo.AllocateIP(ctx, "subnet-a", "10.0.1.10", "", "web"); err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+		if err := repo.PurgeSubnet(ctx, "subnet-a"); err != nil {
+			t.Fatalf("Failed to purge subnet: %v", err)
+		}
+		if err := repo.RestoreSubnet(ctx, "subnet-a"); err == nil {
+			t.Error("Expected a purged subnet not to be restorable")
+		}
+		allocations, err := repo.ListAllocations(ctx, "subnet-a")
+		if err != nil {
+			t.Fatalf("Failed to list allocations: %v", err)
+		}
+		if len(allocations) != 0 {
+			t.Errorf("Expected allocations to be purged, got %d", len(allocations))
+		}
+		if err := repo.PurgeSubnet(ctx, "subnet-a"); err == nil {
+			t.Error("Expected purging a missing subnet to fail")
+		}
+	})
+}
+
+func TestSQLiteRepository_ConnectionMetadataRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	// JSON decodes numbers as float64, so the expected values use them too
+	metadata := map[string]interface{}{
+		"owner": "netops",
+		"peer": map[string]interface{}{
+			"asn":   float64(65001),
+			"hosts": []interface{}{"edge-1", "edge-2"},
+		},
+		"redundant": true,
+	}
+
+	withMetadata := &Connection{
+		ID:             "conn-meta",
+		SourceSubnetID: "subnet-a",
+		TargetSubnetID: "subnet-b",
+		ConnectionType: "vpn",
+		Status:         "active",
+		Name:           "With metadata",
+		Metadata:       metadata,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	withoutMetadata := &Connection{
+		ID:             "conn-plain",
+		SourceSubnetID: "subnet-a",
+		TargetSubnetID: "subnet-c",
+		ConnectionType: "vpn",
+		Status:         "active",
+		Name:           "Without metadata",
+		CreatedAt:      now.Add(time.Minute),
+		UpdatedAt:      now.Add(time.Minute),
+	}
+
+	for _, connection := range []*Connection{withMetadata, withoutMetadata} {
+		if err := repo.CreateConnection(ctx, connection); err != nil {
+			t.Fatalf("Failed to create connection %s: %v", connection.ID, err)
+		}
+	}
+
+	got, err := repo.GetConnectionByID(ctx, "conn-meta")
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	if !reflect.DeepEqual(got.Metadata, metadata) {
+		t.Errorf("Expected metadata %v, got %v", metadata, got.Metadata)
+	}
+
+	plain, err := repo.GetConnectionByID(ctx, "conn-plain")
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	if plain.Metadata != nil {
+		t.Errorf("Expected nil metadata, got %v", plain.Metadata)
+	}
+
+	// Updates replace the stored metadata
+	withMetadata.Metadata = map[string]interface{}{"owner": "platform"}
+	if err := repo.UpdateConnection(ctx, "conn-meta", withMetadata); err != nil {
+		t.Fatalf("Failed to update connection: %v", err)
+	}
+
+	list, err := repo.ListConnections(ctx, ConnectionFilters{SourceSubnetID: "subnet-a"})
+	if err != nil {
+		t.Fatalf("Failed to list connections: %v", err)
+	}
+	for _, connection := range list.Connections {
+		switch connection.ID {
+		case "conn-meta":
+			if !reflect.DeepEqual(connection.Metadata, withMetadata.Metadata) {
+				t.Errorf("Expected updated metadata %v, got %v", withMetadata.Metadata, connection.Metadata)
+			}
+		case "conn-plain":
+			if connection.Metadata != nil {
+				t.Errorf("Expected nil metadata in list, got %v", connection.Metadata)
+			}
+		}
+	}
+}
+
+func TestSQLiteRepository_ListConnectionsForSubnet(t *testing.T) {
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	for i, pair := range [][2]string{{"subnet-a", "subnet-b"}, {"subnet-c", "subnet-a"}, {"subnet-b", "subnet-c"}} {
+		connection := &Connection{
+			ID:             fmt.Sprintf("conn-%d", i),
+			SourceSubnetID: pair[0],
+			TargetSubnetID: pair[1],
+			ConnectionType: "vpn",
+			Status:         "active",
+			Name:           "Link",
+			CreatedAt:      now.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:      now,
+		}
+		if err := repo.CreateConnection(ctx, connection); err != nil {
+			t.Fatalf("Failed to create connection %s: %v", connection.ID, err)
+		}
+	}
+
+	connections, err := repo.ListConnectionsForSubnet(ctx, "subnet-a")
+	if err != nil {
+		t.Fatalf("Failed to list connections: %v", err)
+	}
+	var ids []string
+	for _, connection := range connections {
+		ids = append(ids, connection.ID)
+	}
+	if want := []string{"conn-1", "conn-0"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected connections %v newest first, got %v", want, ids)
+	}
+}
+
+func TestSQLiteRepository_IPAllocations(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	if err := repo.CreateSubnet(ctx, &Subnet{ID: "subnet-1", CIDR: "10.0.1.0/24", Name: "Subnet 1", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	for _, ip := range []string{"10.0.1.1", "10.0.1.2"} {
+		if _, err := repo.AllocateIP(ctx, "subnet-1", ip, "", "host "+ip); err != nil {
+			t.Fatalf("Failed to allocate %s: %v", ip, err)
+		}
+	}
+
+	if _, err := repo.AllocateIP(ctx, "subnet-1", "10.0.1.1", "", "duplicate"); err == nil || !strings.Contains(err.Error(), "already allocated") {
+		t.Errorf("Expected already allocated error, got %v", err)
+	}
+
+	if err := repo.ReleaseIP(ctx, "subnet-1", "10.0.1.1"); err != nil {
+		t.Fatalf("Failed to release IP: %v", err)
+	}
+	if err := repo.ReleaseIP(ctx, "subnet-1", "10.0.1.1"); err == nil || err.Error() != "allocation not found" {
+		t.Errorf("Expected allocation not found, got %v", err)
+	}
+
+	allocations, err := repo.ListAllocations(ctx, "subnet-1")
+	if err != nil {
+		t.Fatalf("Failed to list allocations: %v", err)
+	}
+	if len(allocations) != 1 || allocations[0].IP != "10.0.1.2" || allocations[0].Description != "host 10.0.1.2" {
+		t.Errorf("Expected only 10.0.1.2 to remain allocated, got %+v", allocations)
+	}
+}
+
+func TestSQLiteRepository_ListAllIPAllocations(t *testing.T) {
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	for _, subnet := range []*Subnet{
+		{ID: "subnet-a", CIDR: "10.0.1.0/24", Name: "A", CreatedAt: now, UpdatedAt: now},
+		{ID: "subnet-b", CIDR: "10.0.2.0/24", Name: "B", CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+	for _, a := range []struct{ subnetID, ip, hostname, description string }{
+		{"subnet-a", "10.0.1.10", "web-01", "frontend"},
+		{"subnet-a", "10.0.1.11", "db-01", "primary database"},
+		{"subnet-b", "10.0.2.10", "web-01", "frontend standby"},
+		{"subnet-b", "10.0.2.11", "", "printer"},
+	} {
+		if _, err := repo.AllocateIP(ctx, a.subnetID, a.ip, a.hostname, a.description); err != nil {
+			t.Fatalf("Failed to allocate %s: %v", a.ip, err)
+		}
+	}
+
+	ips := func(filters IPAllocationFilters) ([]string, int32) {
+		t.Helper()
+		list, err := repo.ListAllIPAllocations(ctx, filters)
+		if err != nil {
+			t.Fatalf("ListAllIPAllocations(%+v) failed: %v", filters, err)
+		}
+		result := []string{}
+		for _, allocation := range list.Allocations {
+			result = append(result, allocation.IP)
+		}
+		return result, list.TotalCount
+	}
+
+	tests := []struct {
+		name    string
+		filters IPAllocationFilters
+		want    []string
+	}{
+		{"all", IPAllocationFilters{}, []string{"10.0.1.10", "10.0.1.11", "10.0.2.10", "10.0.2.11"}},
+		{"hostname", IPAllocationFilters{Hostname: "web-01"}, []string{"10.0.1.10", "10.0.2.10"}},
+		{"hostname in subnet", IPAllocationFilters{Hostname: "web-01", SubnetID: "subnet-b"}, []string{"10.0.2.10"}},
+		{"search description", IPAllocationFilters{SearchQuery: "database"}, []string{"10.0.1.11"}},
+		{"search hostname", IPAllocationFilters{SearchQuery: "WEB"}, []string{"10.0.1.10", "10.0.2.10"}},
+		{"no match", IPAllocationFilters{Hostname: "web"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := ips(tt.filters)
+			if !reflect.DeepEqual(got, tt.want) || total != int32(len(tt.want)) {
+				t.Errorf("Expected %v, got %v (total %d)", tt.want, got, total)
+			}
+		})
+	}
+
+	got, total := ips(IPAllocationFilters{Page: 1, PageSize: 3})
+	if !reflect.DeepEqual(got, []string{"10.0.2.11"}) || total != 4 {
+		t.Errorf("Expected the second page to hold the last allocation out of 4, got %v (total %d)", got, total)
+	}
+
+	allocations, err := repo.ListAllocations(ctx, "subnet-a")
+	if err != nil || len(allocations) != 2 || allocations[0].Hostname != "web-01" {
+		t.Errorf("Expected the hostname to round-trip, got %+v (%v)", allocations, err)
+	}
+
+	// Allocations of a soft-deleted subnet drop out until it is restored
+	if err := repo.Delete(ctx, "subnet-b"); err != nil {
+		t.Fatalf("Failed to delete subnet: %v", err)
+	}
+	if got, total := ips(IPAllocationFilters{Hostname: "web-01"}); !reflect.DeepEqual(got, []string{"10.0.1.10"}) || total != 1 {
+		t.Errorf("Expected only the live subnet's allocation, got %v (total %d)", got, total)
+	}
+	if got, total := ips(IPAllocationFilters{SubnetID: "subnet-b"}); len(got) != 0 || total != 0 {
+		t.Errorf("Expected no allocations for the deleted subnet, got %v (total %d)", got, total)
+	}
+	if err := repo.RestoreSubnet(ctx, "subnet-b"); err != nil {
+		t.Fatalf("Failed to restore subnet: %v", err)
+	}
+	if _, total := ips(IPAllocationFilters{}); total != 4 {
+		t.Errorf("Expected all 4 allocations after restoring, got %d", total)
+	}
+}
+
+func TestSQLiteRepository_ReservedRanges(t *testing.T) {
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	if err := repo.CreateSubnet(ctx, &Subnet{ID: "subnet-1", CIDR: "10.0.1.0/24", Name: "Subnet 1", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	for _, reservation := range []*ReservedRange{
+		{ID: "r-1", SubnetID: "subnet-1", StartIP: "10.0.1.1", EndIP: "10.0.1.10", Reason: "network gear", CreatedAt: now},
+		{ID: "r-2", SubnetID: "subnet-1", StartIP: "10.0.1.254", EndIP: "10.0.1.254", CreatedAt: now},
+	} {
+		if err := repo.CreateReservedRange(ctx, reservation); err != nil {
+			t.Fatalf("Failed to create reserved range %s: %v", reservation.ID, err)
+		}
+	}
+
+	if err := repo.CreateReservedRange(ctx, &ReservedRange{ID: "r-1", SubnetID: "subnet-1", StartIP: "10.0.1.20", EndIP: "10.0.1.20", CreatedAt: now}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for a reused ID, got %v", err)
+	}
+
+	if err := repo.DeleteReservedRange(ctx, "subnet-1", "r-2"); err != nil {
+		t.Fatalf("Failed to delete reserved range: %v", err)
+	}
+	if err := repo.DeleteReservedRange(ctx, "subnet-1", "r-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	reservations, err := repo.ListReservedRanges(ctx, "subnet-1")
+	if err != nil {
+		t.Fatalf("Failed to list reserved ranges: %v", err)
+	}
+	want := &ReservedRange{ID: "r-1", SubnetID: "subnet-1", StartIP: "10.0.1.1", EndIP: "10.0.1.10", Reason: "network gear", CreatedAt: now}
+	if len(reservations) != 1 || *reservations[0] != *want {
+		t.Errorf("Expected only %+v, got %+v", want, reservations)
+	}
+
+	if err := repo.PurgeSubnet(ctx, "subnet-1"); err != nil {
+		t.Fatalf("Failed to purge subnet: %v", err)
+	}
+	if reservations, err := repo.ListReservedRanges(ctx, "subnet-1"); err != nil || len(reservations) != 0 {
+		t.Errorf("Expected purge to remove reserved ranges, got %+v (%v)", reservations, err)
+	}
+}
+
+func TestSQLiteRepository_GetChildRollups(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	subnets := []*Subnet{
+		{ID: "root", CIDR: "10.0.0.0/16", Name: "Root"},
+		{ID: "child-a", CIDR: "10.0.0.0/24", Name: "Child A", ParentID: "root",
+			Utilization: &Utilization{TotalIPs: 256, AllocatedIPs: 64}},
+		{ID: "child-b", CIDR: "10.0.1.0/24", Name: "Child B", ParentID: "root",
+			Utilization: &Utilization{TotalIPs: 256, AllocatedIPs: 192}},
+		{ID: "grandchild", CIDR: "10.0.0.0/26", Name: "Grandchild", ParentID: "child-a",
+			Utilization: &Utilization{TotalIPs: 64, AllocatedIPs: 16}},
+		{ID: "leaf", CIDR: "10.1.0.0/24", Name: "Leaf"},
+	}
+	for _, subnet := range subnets {
+		subnet.CreatedAt, subnet.UpdatedAt = now, now
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	rollups, err := repo.GetChildRollups(ctx, []string{"root", "child-a", "leaf"})
+	if err != nil {
+		t.Fatalf("Failed to get child rollups: %v", err)
+	}
+
+	// Only direct children count, so the grandchild is excluded from root
+	want := map[string]*ChildRollup{
+		"root":    {ChildCount: 2, TotalIPs: 512, AllocatedIPs: 256, UtilizationPercent: 50},
+		"child-a": {ChildCount: 1, TotalIPs: 64, AllocatedIPs: 16, UtilizationPercent: 25},
+	}
+	if !reflect.DeepEqual(rollups, want) {
+		t.Errorf("Unexpected rollups:\ngot  %+v\nwant %+v", rollups, want)
+	}
+
+	empty, err := repo.GetChildRollups(ctx, nil)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("Expected no rollups for no parents, got %v, %v", empty, err)
+	}
+}
+
+func TestSQLiteRepository_Environment(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	subnets := []*Subnet{
+		{ID: "prod-1", CIDR: "10.0.1.0/24", Name: "Prod 1", Environment: "prod"},
+		{ID: "prod-2", CIDR: "10.0.2.0/24", Name: "Prod 2", Environment: "prod"},
+		{ID: "dev-1", CIDR: "10.0.3.0/24", Name: "Dev 1", Environment: "dev"},
+		{ID: "unset", CIDR: "10.0.4.0/24", Name: "Unset"},
+	}
+	for _, subnet := range subnets {
+		subnet.CreatedAt, subnet.UpdatedAt = now, now
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	list, err := repo.ListSubnets(ctx, SubnetFilters{Environment: "prod"})
+	if err != nil {
+		t.Fatalf("Failed to list subnets: %v", err)
+	}
+	if list.TotalCount != 2 || len(list.Subnets) != 2 {
+		t.Fatalf("Expected 2 prod subnets, got %d", list.TotalCount)
+	}
+	for _, subnet := range list.Subnets {
+		if subnet.Environment != "prod" {
+			t.Errorf("Expected prod subnet, got %s in %q", subnet.ID, subnet.Environment)
+		}
+	}
+
+	dev, err := repo.GetSubnetByID(ctx, "dev-1")
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	dev.Environment = "test"
+	if err := repo.UpdateSubnet(ctx, dev.ID, dev); err != nil {
+		t.Fatalf("Failed to update subnet: %v", err)
+	}
+
+	counts, err := repo.CountSubnetsByEnvironment(ctx)
+	if err != nil {
+		t.Fatalf("Failed to count subnets: %v", err)
+	}
+	want := map[string]int32{"prod": 2, "test": 1, "": 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("Expected counts %v, got %v", want, counts)
+	}
+}
+
+func TestSQLiteRepository_DNSZone(t *testing.T) {
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	for _, subnet := range []*Subnet{
+		{ID: "reverse", CIDR: "10.0.0.0/16", Name: "Reverse", DNSZone: "0.10.in-addr.arpa"},
+		{ID: "plain", CIDR: "10.1.0.0/16", Name: "Plain"},
+	} {
+		subnet.CreatedAt, subnet.UpdatedAt = now, now
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	subnet, err := repo.GetSubnetByID(ctx, "reverse")
+	if err != nil || subnet.DNSZone != "0.10.in-addr.arpa" {
+		t.Fatalf("Expected the DNS zone to round-trip, got %+v (%v)", subnet, err)
+	}
+
+	list, err := repo.ListSubnets(ctx, SubnetFilters{SearchQuery: "in-addr.arpa"})
+	if err != nil {
+		t.Fatalf("Failed to list subnets: %v", err)
+	}
+	if len(list.Subnets) != 1 || list.Subnets[0].ID != "reverse" || list.Subnets[0].DNSZone != "0.10.in-addr.arpa" {
+		t.Errorf("Expected the search to match the DNS zone, got %+v", list.Subnets)
+	}
+
+	subnet.DNSZone = "corp.example.com"
+	if err := repo.UpdateSubnet(ctx, subnet.ID, subnet); err != nil {
+		t.Fatalf("Failed to update subnet: %v", err)
+	}
+	if subnet, err := repo.GetSubnetByCIDR(ctx, "10.0.0.0/16"); err != nil || subnet.DNSZone != "corp.example.com" {
+		t.Errorf("Expected the updated DNS zone, got %+v (%v)", subnet, err)
+	}
+}
+
+func TestSQLiteRepository_AddsEnvironmentColumnToExistingDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	// Simulate a database created before the environment column and schema versioning existed
+	legacy, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if _, err := legacy.db.Exec("DROP INDEX idx_subnets_environment; ALTER TABLE subnets DROP COLUMN environment; DROP TABLE schema_migrations"); err != nil {
+		t.Fatalf("Failed to drop environment column: %v", err)
+	}
+	legacy.Close()
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen legacy database: %v", err)
+	}
+	defer repo.Close()
+
+	now := time.Unix(1700000000, 0)
+	subnet := &Subnet{ID: "s1", CIDR: "10.9.0.0/24", Name: "S1", Environment: "staging", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateSubnet(context.Background(), subnet); err != nil {
+		t.Fatalf("Failed to create subnet after upgrade: %v", err)
+	}
+	found, err := repo.GetSubnetByID(context.Background(), "s1")
+	if err != nil || found.Environment != "staging" {
+		t.Errorf("Expected staging environment after upgrade, got %+v, %v", found, err)
+	}
+}
+
+func TestSQLiteRepository_BulkCreateSubnets(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	newSubnets := func(cidrs ...string) []*Subnet {
+		subnets := make([]*Subnet, len(cidrs))
+		for i, cidr := range cidrs {
+			subnets[i] = &Subnet{ID: cidr, CIDR: cidr, Name: cidr, CreatedAt: now, UpdatedAt: now}
+		}
+		return subnets
+	}
+
+	if err := repo.BulkCreateSubnets(ctx, newSubnets("10.0.1.0/24", "10.0.2.0/24")); err != nil {
+		t.Fatalf("Failed to bulk create subnets: %v", err)
+	}
+
+	t.Run("rolls back the whole batch on a failed insert", func(t *testing.T) {
+		err := repo.BulkCreateSubnets(ctx, newSubnets("10.0.3.0/24", "10.0.1.0/24", "10.0.4.0/24"))
+
+		var bulkErr *BulkCreateError
+		if !errors.As(err, &bulkErr) {
+			t.Fatalf("Expected a BulkCreateError, got %v", err)
+		}
+		if bulkErr.Index != 1 || bulkErr.CIDR != "10.0.1.0/24" {
+			t.Errorf("Expected failure at index 1 (10.0.1.0/24), got %d (%s)", bulkErr.Index, bulkErr.CIDR)
+		}
+
+		if _, err := repo.GetSubnetByID(ctx, "10.0.3.0/24"); err == nil {
+			t.Error("Expected subnet inserted before the failure to be rolled back")
+		}
+	})
+
+	list, err := repo.ListSubnets(ctx, SubnetFilters{})
+	if err != nil {
+		t.Fatalf("Failed to list subnets: %v", err)
+	}
+	if list.TotalCount != 2 {
+		t.Errorf("Expected 2 subnets, got %d", list.TotalCount)
+	}
+}
+
+func TestSQLiteRepository_TypedErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	if err := repo.CreateSubnet(ctx, &Subnet{ID: "a", CIDR: "10.0.1.0/24", Name: "A", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	err = repo.CreateSubnet(ctx, &Subnet{ID: "b", CIDR: "10.0.1.0/24", Name: "B", CreatedAt: now, UpdatedAt: now})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for a repeated CIDR, got %v", err)
+	}
+	if _, err := repo.AllocateIP(ctx, "a", "10.0.1.5", "", ""); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if _, err := repo.AllocateIP(ctx, "a", "10.0.1.5", "", ""); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for a repeated allocation, got %v", err)
+	}
+
+	if _, err := repo.GetSubnetByID(ctx, "missing"); !errors.Is(err, ErrNotFound) || err.Error() != "subnet not found" {
+		t.Errorf("Expected ErrNotFound reading as \"subnet not found\", got %v", err)
+	}
+	if err := repo.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting an unknown subnet, got %v", err)
+	}
+	if _, err := repo.GetConnectionByID(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown connection, got %v", err)
+	}
+}
+
+func TestSQLiteRepository_CountSubnetsByPrefixLength(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	cidrs := []string{"10.0.0.0/8", "10.1.0.0/24", "10.2.0.0/24", "10.3.0.0/24", "10.4.0.0/26", "10.4.0.64/26", "2001:db8::/64"}
+	for _, cidr := range cidrs {
+		subnet := &Subnet{ID: cidr, CIDR: cidr, Name: cidr, CreatedAt: now, UpdatedAt: now}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", cidr, err)
+		}
+	}
+
+	counts, err := repo.CountSubnetsByPrefixLength(ctx)
+	if err != nil {
+		t.Fatalf("Failed to count subnets by prefix length: %v", err)
+	}
+
+	want := map[int32]int32{8: 1, 24: 3, 26: 2, 64: 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("Expected counts %v, got %v", want, counts)
+	}
+}
+
+func TestSQLiteRepository_ListSubnetsCursorPagination(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+
+	// Pairs of subnets share a creation second so the ID has to break ties
+	for i := 0; i < 6; i++ {
+		createdAt := base.Add(time.Duration(i/2) * time.Second)
+		subnet := &Subnet{
+			ID:        fmt.Sprintf("subnet-%d", i),
+			CIDR:      fmt.Sprintf("10.0.%d.0/24", i),
+			Name:      fmt.Sprintf("Subnet %d", i),
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet: %v", err)
+		}
+	}
+
+	// listAll walks every page from the first one, inserting a newer subnet
+	// after the first page to show it does not shift the following pages
+	listAll := func(filters SubnetFilters, insert *Subnet) []string {
+		t.Helper()
+
+		var ids []string
+		for page := 0; ; page++ {
+			list, err := repo.ListSubnets(ctx, filters)
+			if err != nil {
+				t.Fatalf("Failed to list subnets: %v", err)
+			}
+			for _, subnet := range list.Subnets {
+				ids = append(ids, subnet.ID)
+			}
+			if list.NextCursor == "" {
+				return ids
+			}
+			if page > 10 {
+				t.Fatal("Pagination did not terminate")
+			}
+
+			if page == 0 && insert != nil {
+				if err := repo.CreateSubnet(ctx, insert); err != nil {
+					t.Fatalf("Failed to create subnet: %v", err)
+				}
+			}
+
+			cursor, err := DecodeSubnetCursor(list.NextCursor)
+			if err != nil {
+				t.Fatalf("Failed to decode cursor: %v", err)
+			}
+			filters.After = cursor
+		}
+	}
+
+	newest := &Subnet{ID: "newest", CIDR: "10.0.9.0/24", Name: "Newest", CreatedAt: base.Add(time.Hour), UpdatedAt: base.Add(time.Hour)}
+	got := listAll(SubnetFilters{PageSize: 4}, newest)
+	want := []string{"subnet-5", "subnet-4", "subnet-3", "subnet-2", "subnet-1", "subnet-0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	t.Run("cursor takes precedence over page", func(t *testing.T) {
+		cursor := &SubnetCursor{CreatedAt: base.Add(time.Second), ID: "subnet-3"}
+		list, err := repo.ListSubnets(ctx, SubnetFilters{After: cursor, Page: 5, PageSize: 2})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		if len(list.Subnets) != 2 || list.Subnets[0].ID != "subnet-2" || list.Subnets[1].ID != "subnet-1" {
+			t.Errorf("Expected subnet-2 and subnet-1 after the cursor, got %+v", list.Subnets)
+		}
+		if list.TotalCount != 7 {
+			t.Errorf("Expected total count of every subnet, got %d", list.TotalCount)
+		}
+	})
+
+	t.Run("with cidr_prefix", func(t *testing.T) {
+		got := listAll(SubnetFilters{CIDRPrefix: "10.0", PageSize: 3}, nil)
+		want := []string{"newest", "subnet-5", "subnet-4", "subnet-3", "subnet-2", "subnet-1", "subnet-0"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+}
+
+func TestDecodeSubnetCursor(t *testing.T) {
+	cursor := &SubnetCursor{CreatedAt: time.Unix(1700000000, 0), ID: "subnet:1"}
+	decoded, err := DecodeSubnetCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("Round trip mismatch: got %+v, want %+v", decoded, cursor)
+	}
+
+	for _, value := range []string{"not base64!", "MTcwMDAwMDAwMA", "YWJjOmlk"} {
+		if _, err := DecodeSubnetCursor(value); err == nil {
+			t.Errorf("Expected an error decoding %q", value)
+		}
+	}
+}
+
+func TestSQLiteRepository_ListSubnetsTagFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+
+	subnets := []struct {
+		id   string
+		cidr string
+		tags map[string]string
+	}{
+		{"prod-net", "10.0.1.0/24", map[string]string{"Environment": "prod", "Team": "net"}},
+		{"prod-web", "10.0.2.0/24", map[string]string{"Environment": "prod", "Team": "web"}},
+		{"dev-net", "10.0.3.0/24", map[string]string{"Environment": "dev", "Team": "net"}},
+		{"untagged", "10.0.4.0/24", nil},
+	}
+	for i, s := range subnets {
+		subnet := &Subnet{
+			ID:           s.id,
+			CIDR:         s.cidr,
+			Name:         s.id,
+			Location:     "datacenter-1",
+			LocationType: "datacenter",
+			Tags:         s.tags,
+			CreatedAt:    base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:    base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", s.id, err)
+		}
+	}
+
+	listIDs := func(t *testing.T, tags map[string]string) []string {
+		t.Helper()
+		list, err := repo.ListSubnets(ctx, SubnetFilters{TagFilter: tags})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		ids := make([]string, 0, len(list.Subnets))
+		for _, subnet := range list.Subnets {
+			ids = append(ids, subnet.ID)
+		}
+		if int(list.TotalCount) != len(ids) {
+			t.Errorf("Expected total count %d, got %d", len(ids), list.TotalCount)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name string
+		tags map[string]string
+		want []string
+	}{
+		{"single tag", map[string]string{"Environment": "prod"}, []string{"prod-web", "prod-net"}},
+		{"multiple tags are combined with AND", map[string]string{"Environment": "prod", "Team": "net"}, []string{"prod-net"}},
+		{"no match", map[string]string{"Environment": "staging"}, []string{}},
+		{"unknown key", map[string]string{"Owner": "net"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listIDs(t, tt.tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("updates replace tags", func(t *testing.T) {
+		subnet, err := repo.GetSubnetByID(ctx, "dev-net")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		subnet.Tags = map[string]string{"Environment": "prod"}
+		if err := repo.UpdateSubnet(ctx, "dev-net", subnet); err != nil {
+			t.Fatalf("Failed to update subnet: %v", err)
+		}
+		if got := listIDs(t, map[string]string{"Environment": "prod"}); len(got) != 3 {
+			t.Errorf("Expected three prod subnets after the update, got %v", got)
+		}
+		if got := listIDs(t, map[string]string{"Team": "net"}); !reflect.DeepEqual(got, []string{"prod-net"}) {
+			t.Errorf("Expected the replaced Team tag to be gone, got %v", got)
+		}
+	})
+
+	t.Run("purge removes tags", func(t *testing.T) {
+		if err := repo.PurgeSubnet(ctx, "prod-web"); err != nil {
+			t.Fatalf("Failed to purge subnet: %v", err)
+		}
+		var count int
+		if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM subnet_tags WHERE subnet_id = ?", "prod-web").Scan(&count); err != nil {
+			t.Fatalf("Failed to count tags: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("Expected purged subnet tags to be removed, got %d", count)
+		}
+	})
+}
+
+func TestSQLiteRepository_SubnetTagsRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	tags := map[string]string{"Environment": "prod", "Team": "network", "CostCenter": "cc-42"}
+
+	parent := &Subnet{ID: "parent", CIDR: "10.20.0.0/16", Name: "Parent", Location: "datacenter-1", LocationType: "datacenter"}
+	if err := repo.CreateSubnet(ctx, parent); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+	subnet := &Subnet{
+		ID:           "tagged",
+		CIDR:         "10.20.1.0/24",
+		Name:         "Tagged",
+		Location:     "datacenter-1",
+		LocationType: "datacenter",
+		ParentID:     "parent",
+		Tags:         tags,
+	}
+	if err := repo.CreateSubnet(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	t.Run("GetSubnetByID", func(t *testing.T) {
+		got, err := repo.GetSubnetByID(ctx, "tagged")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if !reflect.DeepEqual(got.Tags, tags) {
+			t.Errorf("Expected tags %v, got %v", tags, got.Tags)
+		}
+	})
+
+	t.Run("GetSubnetByCIDR", func(t *testing.T) {
+		got, err := repo.GetSubnetByCIDR(ctx, "10.20.1.0/24")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if !reflect.DeepEqual(got.Tags, tags) {
+			t.Errorf("Expected tags %v, got %v", tags, got.Tags)
+		}
+	})
+
+	t.Run("ListSubnets", func(t *testing.T) {
+		list, err := repo.ListSubnets(ctx, SubnetFilters{})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		for _, got := range list.Subnets {
+			switch got.ID {
+			case "tagged":
+				if !reflect.DeepEqual(got.Tags, tags) {
+					t.Errorf("Expected tags %v, got %v", tags, got.Tags)
+				}
+			case "parent":
+				if got.Tags != nil {
+					t.Errorf("Expected no tags on the parent, got %v", got.Tags)
+				}
+			}
+		}
+	})
+
+	t.Run("GetSubnetChildren", func(t *testing.T) {
+		children, err := repo.GetSubnetChildren(ctx, "parent")
+		if err != nil {
+			t.Fatalf("Failed to get children: %v", err)
+		}
+		if len(children) != 1 || !reflect.DeepEqual(children[0].Tags, tags) {
+			t.Errorf("Expected one child with tags %v, got %+v", tags, children)
+		}
+	})
+
+	t.Run("updates without tags keep them", func(t *testing.T) {
+		got, err := repo.GetSubnetByID(ctx, "tagged")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		got.Name = "Renamed"
+		got.Tags = nil
+		if err := repo.UpdateSubnet(ctx, "tagged", got); err != nil {
+			t.Fatalf("Failed to update subnet: %v", err)
+		}
+		got, err = repo.GetSubnetByID(ctx, "tagged")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if !reflect.DeepEqual(got.Tags, tags) {
+			t.Errorf("Expected tags %v to survive the update, got %v", tags, got.Tags)
+		}
+	})
+}
+
+func TestSQLiteRepository_ListSubnetsPublicAndPrefixFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	for _, s := range []struct {
+		id       string
+		cidr     string
+		details  bool
+		isPublic bool
+	}{
+		{"private-24", "10.0.1.0/24", true, false},
+		{"private-25", "10.0.2.0/25", true, false},
+		{"public-24", "8.8.8.0/24", true, true},
+		{"public-25", "1.1.1.0/25", true, true},
+		{"no-details-24", "10.0.3.0/24", false, false},
+	} {
+		subnet := &Subnet{ID: s.id, CIDR: s.cidr, Name: s.id, Location: "datacenter-1", LocationType: "datacenter"}
+		if s.details {
+			subnet.Details = &SubnetDetails{Address: s.cidr, IsPublic: s.isPublic}
+		}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", s.id, err)
+		}
+	}
+
+	boolPtr := func(b bool) *bool { return &b }
+	intPtr := func(i int) *int { return &i }
+
+	tests := []struct {
+		name    string
+		filters SubnetFilters
+		want    []string
+	}{
+		{"public", SubnetFilters{IsPublic: boolPtr(true)}, []string{"public-24", "public-25"}},
+		{"private includes subnets without details", SubnetFilters{IsPublic: boolPtr(false)}, []string{"no-details-24", "private-24", "private-25"}},
+		{"prefix length", SubnetFilters{PrefixLength: intPtr(24)}, []string{"no-details-24", "private-24", "public-24"}},
+		{"prefix length without match", SubnetFilters{PrefixLength: intPtr(2)}, []string{}},
+		{"combined", SubnetFilters{IsPublic: boolPtr(true), PrefixLength: intPtr(25)}, []string{"public-25"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := repo.ListSubnets(ctx, tt.filters)
+			if err != nil {
+				t.Fatalf("Failed to list subnets: %v", err)
+			}
+			got := make([]string, 0, len(list.Subnets))
+			for _, subnet := range list.Subnets {
+				got = append(got, subnet.ID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) || int(list.TotalCount) != len(tt.want) {
+				t.Errorf("Expected %v, got %v (total %d)", tt.want, got, list.TotalCount)
+			}
+		})
+	}
+
+	t.Run("listed subnets carry details", func(t *testing.T) {
+		list, err := repo.ListSubnets(ctx, SubnetFilters{IsPublic: boolPtr(true)})
+		if err != nil {
+			t.Fatalf("Failed to list subnets: %v", err)
+		}
+		for _, subnet := range list.Subnets {
+			if subnet.Details == nil || !subnet.Details.IsPublic {
+				t.Errorf("Expected public details on %s, got %+v", subnet.ID, subnet.Details)
+			}
+		}
+	})
+}
+
+func TestSQLiteRepository_IdempotentResults(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	result := &IdempotentResult{
+		Scope:      "POST /api/v1/subnets",
+		Key:        "key-1",
+		ResourceID: "subnet-1",
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+	if err := repo.SaveIdempotentResult(ctx, result); err != nil {
+		t.Fatalf("Failed to save idempotent result: %v", err)
+	}
+
+	got, err := repo.GetIdempotentResult(ctx, result.Scope, result.Key, now.Add(time.Minute))
+	if err != nil || got.ResourceID != "subnet-1" {
+		t.Fatalf("Expected subnet-1, got %+v (%v)", got, err)
+	}
+
+	if _, err := repo.GetIdempotentResult(ctx, "POST /api/v1/connections", result.Key, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected keys to be scoped per endpoint, got %v", err)
+	}
+
+	if err := repo.SaveIdempotentResult(ctx, result); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for an unexpired key, got %v", err)
+	}
+
+	later := now.Add(2 * time.Hour)
+	if _, err := repo.GetIdempotentResult(ctx, result.Scope, result.Key, later); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an expired key to be not found, got %v", err)
+	}
+
+	reused := &IdempotentResult{
+		Scope:      result.Scope,
+		Key:        result.Key,
+		ResourceID: "subnet-2",
+		CreatedAt:  later,
+		ExpiresAt:  later.Add(time.Hour),
+	}
+	if err := repo.SaveIdempotentResult(ctx, reused); err != nil {
+		t.Fatalf("Expected an expired key to be reusable, got %v", err)
+	}
+	if got, err := repo.GetIdempotentResult(ctx, result.Scope, result.Key, later); err != nil || got.ResourceID != "subnet-2" {
+		t.Errorf("Expected subnet-2, got %+v (%v)", got, err)
+	}
+}
+
+func TestSQLiteRepository_TablePrefix(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "shared.db")
+
+	dev, err := NewSQLiteRepositoryWithOptions(dbPath, SQLiteOptions{TablePrefix: "dev_"})
+	if err != nil {
+		t.Fatalf("Failed to create dev repository: %v", err)
+	}
+	defer dev.Close()
+	prod, err := NewSQLiteRepositoryWithOptions(dbPath, SQLiteOptions{TablePrefix: "prod_"})
+	if err != nil {
+		t.Fatalf("Failed to create prod repository: %v", err)
+	}
+	defer prod.Close()
+
+	// The same ID and CIDR would collide if the environments shared tables
+	for name, repo := range map[string]*SQLiteRepository{"dev": dev, "prod": prod} {
+		subnet := &Subnet{ID: "web", CIDR: "10.0.0.0/24", Name: name, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s subnet: %v", name, err)
+		}
+	}
+	if err := dev.CreateSubnet(ctx, &Subnet{ID: "db", CIDR: "10.0.1.0/24", Name: "dev", CreatedAt: time.Now(), UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to create dev subnet: %v", err)
+	}
+
+	if subnet, err := prod.GetSubnetByID(ctx, "web"); err != nil || subnet.Name != "prod" {
+		t.Errorf("Expected prod to read its own subnet, got %+v (%v)", subnet, err)
+	}
+	if list, err := prod.ListSubnets(ctx, SubnetFilters{}); err != nil || list.TotalCount != 1 {
+		t.Errorf("Expected 1 subnet in prod, got %+v (%v)", list, err)
+	}
+	if list, err := dev.ListSubnets(ctx, SubnetFilters{}); err != nil || list.TotalCount != 2 {
+		t.Errorf("Expected 2 subnets in dev, got %+v (%v)", list, err)
+	}
+
+	if err := dev.Delete(ctx, "web"); err != nil {
+		t.Fatalf("Failed to delete dev subnet: %v", err)
+	}
+	if _, err := prod.GetSubnetByID(ctx, "web"); err != nil {
+		t.Errorf("Expected deleting in dev to leave prod untouched: %v", err)
+	}
+
+	// Both environments keep their own schema version and indexes
+	for _, name := range []string{"dev_schema_migrations", "prod_schema_migrations", "dev_idx_subnets_cidr", "prod_idx_subnets_cidr"} {
+		var count int
+		if err := dev.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = ?", name).Scan(&count); err != nil || count != 1 {
+			t.Errorf("Expected %s to exist, got %d (%v)", name, count, err)
+		}
+	}
+	var count int
+	if err := dev.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'subnets'").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected no unprefixed subnets table, got %d (%v)", count, err)
+	}
+
+	if _, err := NewSQLiteRepositoryWithOptions(dbPath, SQLiteOptions{TablePrefix: "dev; DROP TABLE dev_subnets; --"}); err == nil {
+		t.Error("Expected an invalid prefix to be rejected")
+	}
+}
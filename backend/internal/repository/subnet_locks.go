@@ -0,0 +1,41 @@
+package repository
+
+import "sync"
+
+// subnetLock is a mutex shared by every writer currently working on one subnet
+type subnetLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+var (
+	subnetLocksMu sync.Mutex
+	subnetLocks   = make(map[string]*subnetLock)
+)
+
+// LockSubnet serializes read-modify-write cycles on a single subnet, such as a
+// manual edit and a cloud utilization refresh. Callers must re-read the subnet
+// after acquiring the lock and call the returned function to release it.
+func LockSubnet(id string) (unlock func()) {
+	subnetLocksMu.Lock()
+	lock, ok := subnetLocks[id]
+	if !ok {
+		lock = &subnetLock{}
+		subnetLocks[id] = lock
+	}
+	lock.waiters++
+	subnetLocksMu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		subnetLocksMu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(subnetLocks, id)
+		}
+		subnetLocksMu.Unlock()
+	}
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/bananaops/ipam-bananaops/internal/config"
+)
+
+// validateTablePrefix rejects prefixes that could not be spliced into SQL
+// statements or collection names as is
+func validateTablePrefix(prefix string) error {
+	if prefix != "" && !config.TablePrefixPattern.MatchString(prefix) {
+		return fmt.Errorf("invalid table prefix %q: use letters, digits and underscores, starting with a letter", prefix)
+	}
+	return nil
+}
+
+// sqliteTables names the tables a SQLite repository uses. Every statement is
+// built from these fields, so several environments can share one database
+// file by giving each its own prefix.
+type sqliteTables struct {
+	// prefix is also prepended to index names, which SQLite requires to be
+	// unique across the whole database, not just per table
+	prefix             string
+	subnets            string
+	connections        string
+	subnetNotes        string
+	ipAllocations      string
+	subnetTags         string
+	utilizationHistory string
+	idempotencyKeys    string
+	reservedRanges     string
+	schemaMigrations   string
+}
+
+// newSQLiteTables returns the table names with prefix prepended
+func newSQLiteTables(prefix string) sqliteTables {
+	return sqliteTables{
+		prefix:             prefix,
+		subnets:            prefix + "subnets",
+		connections:        prefix + "connections",
+		subnetNotes:        prefix + "subnet_notes",
+		ipAllocations:      prefix + "ip_allocations",
+		subnetTags:         prefix + "subnet_tags",
+		utilizationHistory: prefix + "utilization_history",
+		idempotencyKeys:    prefix + "idempotency_keys",
+		reservedRanges:     prefix + "reserved_ranges",
+		schemaMigrations:   prefix + "schema_migrations",
+	}
+}
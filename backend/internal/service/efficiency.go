@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"go4.org/netipx"
+)
+
+// EfficiencyTotals sums the address space of the top-level pools of one
+// address family. Allocated space is the part covered by the pools' direct
+// children; the rest is free.
+type EfficiencyTotals struct {
+	Pools              int
+	TotalAddresses     float64
+	AllocatedAddresses float64
+	FreeAddresses      float64
+	FreeBlocks         int
+}
+
+// PoolEfficiency reports how the address space of one top-level subnet is
+// used. Free blocks are the maximal aligned CIDR blocks left between its
+// children, so many small ones point at a fragmented pool.
+type PoolEfficiency struct {
+	SubnetID           string
+	Name               string
+	CIDR               string
+	TotalAddresses     float64
+	AllocatedAddresses float64
+	FreeAddresses      float64
+	FreeBlocks         int
+	LargestFreeBlock   string // Empty when the pool is fully allocated
+}
+
+// EfficiencyStats reports address space usage across the inventory. Totals
+// are kept per address family since IPv6 pools would dwarf IPv4 ones.
+type EfficiencyStats struct {
+	IPv4  *EfficiencyTotals // Nil without IPv4 pools
+	IPv6  *EfficiencyTotals // Nil without IPv6 pools
+	Pools []*PoolEfficiency // Ordered by address
+}
+
+// GetEfficiencyStats computes how much of each top-level subnet is covered by
+// its direct children. Subnets whose parent no longer exists count as top-level.
+func (s *ServiceLayer) GetEfficiencyStats(ctx context.Context) (*EfficiencyStats, error) {
+	list, err := s.subnetRepo.ListSubnets(ctx, repository.SubnetFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
+	}
+
+	known := make(map[string]bool, len(list.Subnets))
+	for _, subnet := range list.Subnets {
+		known[subnet.ID] = true
+	}
+
+	var pools []*repository.Subnet
+	children := make(map[string][]*repository.Subnet)
+	for _, subnet := range list.Subnets {
+		if subnet.ParentID == "" || !known[subnet.ParentID] {
+			pools = append(pools, subnet)
+		} else {
+			children[subnet.ParentID] = append(children[subnet.ParentID], subnet)
+		}
+	}
+	sortSubnetsByAddress(pools)
+
+	stats := &EfficiencyStats{Pools: []*PoolEfficiency{}}
+	for _, pool := range pools {
+		prefix, err := netip.ParsePrefix(pool.CIDR)
+		if err != nil {
+			continue
+		}
+
+		efficiency, err := poolEfficiency(prefix.Masked(), children[pool.ID])
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute efficiency of subnet %s: %w", pool.ID, err)
+		}
+		efficiency.SubnetID = pool.ID
+		efficiency.Name = pool.Name
+		stats.Pools = append(stats.Pools, efficiency)
+
+		totals := &stats.IPv4
+		if prefix.Addr().Is6() {
+			totals = &stats.IPv6
+		}
+		if *totals == nil {
+			*totals = &EfficiencyTotals{}
+		}
+		(*totals).Pools++
+		(*totals).TotalAddresses += efficiency.TotalAddresses
+		(*totals).AllocatedAddresses += efficiency.AllocatedAddresses
+		(*totals).FreeAddresses += efficiency.FreeAddresses
+		(*totals).FreeBlocks += efficiency.FreeBlocks
+	}
+
+	return stats, nil
+}
+
+// poolEfficiency measures the space of pool left free by children. Overlapping
+// children are counted once and space outside the pool is ignored.
+func poolEfficiency(pool netip.Prefix, children []*repository.Subnet) (*PoolEfficiency, error) {
+	var b netipx.IPSetBuilder
+	b.AddPrefix(pool)
+	for _, child := range children {
+		prefix, err := netip.ParsePrefix(child.CIDR)
+		if err != nil {
+			continue
+		}
+		b.RemovePrefix(prefix.Masked())
+	}
+	free, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build free address set: %w", err)
+	}
+
+	efficiency := &PoolEfficiency{CIDR: pool.String(), TotalAddresses: prefixSize(pool)}
+
+	// Prefixes come in address order, so the first of the shortest length
+	// is the lowest of the largest free blocks
+	var largest netip.Prefix
+	for _, block := range free.Prefixes() {
+		efficiency.FreeAddresses += prefixSize(block)
+		efficiency.FreeBlocks++
+		if !largest.IsValid() || block.Bits() < largest.Bits() {
+			largest = block
+		}
+	}
+	if largest.IsValid() {
+		efficiency.LargestFreeBlock = largest.String()
+	}
+	efficiency.AllocatedAddresses = efficiency.TotalAddresses - efficiency.FreeAddresses
+
+	return efficiency, nil
+}
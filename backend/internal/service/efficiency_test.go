@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+func TestGetEfficiencyStats(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "pool-a", CIDR: "10.0.0.0/24", Name: "Pool A"},
+		{ID: "a-low", CIDR: "10.0.0.0/26", ParentID: "pool-a"},
+		{ID: "a-high", CIDR: "10.0.0.128/26", ParentID: "pool-a"},
+		{ID: "a-low-nested", CIDR: "10.0.0.0/28", ParentID: "a-low"}, // Already covered by a-low
+		{ID: "pool-b", CIDR: "10.1.0.0/16", Name: "Pool B"},
+		{ID: "orphan", CIDR: "192.168.0.0/30", ParentID: "deleted-parent"},
+		{ID: "pool-v6", CIDR: "fd00::/64", Name: "Pool v6"},
+		{ID: "v6-half", CIDR: "fd00::/65", ParentID: "pool-v6"},
+	} {
+		subnet.CreatedAt, subnet.UpdatedAt = time.Now(), time.Now()
+		if err := repo.CreateSubnet(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	stats, err := serviceLayer.GetEfficiencyStats(ctx)
+	if err != nil {
+		t.Fatalf("GetEfficiencyStats failed: %v", err)
+	}
+
+	wantPools := []*PoolEfficiency{
+		{SubnetID: "pool-a", Name: "Pool A", CIDR: "10.0.0.0/24", TotalAddresses: 256, AllocatedAddresses: 128, FreeAddresses: 128, FreeBlocks: 2, LargestFreeBlock: "10.0.0.64/26"},
+		{SubnetID: "pool-b", Name: "Pool B", CIDR: "10.1.0.0/16", TotalAddresses: 65536, FreeAddresses: 65536, FreeBlocks: 1, LargestFreeBlock: "10.1.0.0/16"},
+		{SubnetID: "orphan", CIDR: "192.168.0.0/30", TotalAddresses: 4, FreeAddresses: 4, FreeBlocks: 1, LargestFreeBlock: "192.168.0.0/30"},
+		{SubnetID: "pool-v6", Name: "Pool v6", CIDR: "fd00::/64", TotalAddresses: math.Ldexp(1, 64), AllocatedAddresses: math.Ldexp(1, 63), FreeAddresses: math.Ldexp(1, 63), FreeBlocks: 1, LargestFreeBlock: "fd00::8000:0:0:0/65"},
+	}
+	if !reflect.DeepEqual(stats.Pools, wantPools) {
+		for i, pool := range stats.Pools {
+			t.Logf("pool %d: %+v", i, pool)
+		}
+		t.Errorf("Unexpected pools")
+	}
+
+	wantIPv4 := &EfficiencyTotals{Pools: 3, TotalAddresses: 65796, AllocatedAddresses: 128, FreeAddresses: 65668, FreeBlocks: 4}
+	if !reflect.DeepEqual(stats.IPv4, wantIPv4) {
+		t.Errorf("Expected IPv4 totals %+v, got %+v", wantIPv4, stats.IPv4)
+	}
+	wantIPv6 := &EfficiencyTotals{Pools: 1, TotalAddresses: math.Ldexp(1, 64), AllocatedAddresses: math.Ldexp(1, 63), FreeAddresses: math.Ldexp(1, 63), FreeBlocks: 1}
+	if !reflect.DeepEqual(stats.IPv6, wantIPv6) {
+		t.Errorf("Expected IPv6 totals %+v, got %+v", wantIPv6, stats.IPv6)
+	}
+}
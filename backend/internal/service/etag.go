@@ -0,0 +1,39 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubnetETag returns the entity tag of a subnet version. It changes whenever
+// the subnet's updated_at does, which every edit moves forward.
+func SubnetETag(id string, updatedAt int64) string {
+	sum := sha256.Sum256([]byte(id + "@" + strconv.FormatInt(updatedAt, 10)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-Match header value names etag. "*"
+// matches any version; weak tags never match, as If-Match compares strongly.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// nextUpdatedAt returns the updated_at to stamp on an edited subnet: now, or
+// one second past previous when the clock has not moved past it yet, so two
+// edits within the same second still get different ETags
+func (s *ServiceLayer) nextUpdatedAt(previous time.Time) time.Time {
+	now := s.now()
+	if next := previous.Truncate(time.Second).Add(time.Second); now.Before(next) {
+		return next
+	}
+	return now
+}
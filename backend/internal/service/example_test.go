@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"testing"
 
 	"github.com/bananaops/ipam-bananaops/internal/repository"
@@ -174,8 +175,11 @@ func TestServiceLayerWithIPService(t *testing.T) {
 	t.Log("ServiceLayer integration with IPService test passed successfully")
 }
 
-// mockSubnetRepository is a simple in-memory repository for testing
+// mockSubnetRepository is a simple in-memory repository for testing.
+// Methods it does not override fall through to the embedded nil interface
+// and panic, so tests only exercise the Protobuf CRUD path.
 type mockSubnetRepository struct {
+	repository.SubnetRepository
 	subnets map[string]*pb.Subnet
 }
 
@@ -205,11 +209,32 @@ func (m *mockSubnetRepository) Update(ctx context.Context, subnet *pb.Subnet) er
 	return nil
 }
 
+func (m *mockSubnetRepository) UpdateWithStoredFields(ctx context.Context, subnet *pb.Subnet, stored *repository.StoredFields) error {
+	return m.Update(ctx, subnet)
+}
+
 func (m *mockSubnetRepository) Delete(ctx context.Context, id string) error {
 	delete(m.subnets, id)
 	return nil
 }
 
+func (m *mockSubnetRepository) FindOverlappingSubnets(ctx context.Context, cidr, location string) ([]*repository.Subnet, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*repository.Subnet
+	for _, subnet := range m.subnets {
+		existing, err := netip.ParsePrefix(subnet.Cidr)
+		if err != nil || subnet.Location != location || !existing.Overlaps(prefix) {
+			continue
+		}
+		result = append(result, &repository.Subnet{ID: subnet.Id, CIDR: subnet.Cidr, Location: subnet.Location})
+	}
+	return result, nil
+}
+
 func (m *mockSubnetRepository) Close() error {
 	return nil
 }
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+// DeleteExpiredSubnets deletes every subnet whose TTL has passed, together
+// with its descendants, and returns how many subnets were deleted
+func (s *ServiceLayer) DeleteExpiredSubnets(ctx context.Context) (int, error) {
+	expired, err := s.subnetRepo.ListExpiredSubnets(ctx, s.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired subnets: %w", err)
+	}
+
+	visited := make(map[string]bool)
+	for _, subnet := range expired {
+		// An expired ancestor earlier in the list already took this one along
+		if visited[subnet.ID] {
+			continue
+		}
+		before := len(visited)
+		if err := s.deleteSubtree(ctx, []*repository.Subnet{subnet}, visited); err != nil {
+			return len(visited), err
+		}
+		log.Printf("Deleted expired subnet %s (%s) and %d descendant(s)", subnet.ID, subnet.CIDR, len(visited)-before-1)
+		s.refreshParentUtilization(ctx, subnet.ParentID)
+	}
+	return len(visited), nil
+}
+
+// ExpiryReconciler periodically deletes expired subnets in the background
+type ExpiryReconciler struct {
+	service  *ServiceLayer
+	interval time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewExpiryReconciler creates a new subnet expiry reconciler
+func NewExpiryReconciler(service *ServiceLayer, interval time.Duration) *ExpiryReconciler {
+	return &ExpiryReconciler{
+		service:  service,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start runs the reconciliation loop until Stop is called
+func (r *ExpiryReconciler) Start(ctx context.Context) {
+	log.Printf("Starting subnet expiry reconciliation with interval: %v", r.interval)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.service.DeleteExpiredSubnets(ctx); err != nil {
+					log.Printf("Subnet expiry reconciliation failed: %v", err)
+				}
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully stops the reconciliation loop
+func (r *ExpiryReconciler) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
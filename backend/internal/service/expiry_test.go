@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+func TestDeleteExpiredSubnets(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	clock := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		Clock: func() time.Time { return clock },
+	})
+	ctx := context.Background()
+
+	create := func(id, cidr, parentID string, ttl time.Duration) {
+		t.Helper()
+		subnet := &repository.Subnet{
+			ID:           id,
+			CIDR:         cidr,
+			Name:         id,
+			Location:     "datacenter-1",
+			LocationType: "datacenter",
+			ParentID:     parentID,
+		}
+		if err := serviceLayer.CreateSubnetRepositoryWithOptions(ctx, subnet, CreateSubnetOptions{TTL: ttl}); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", id, err)
+		}
+	}
+	create("parent", "10.60.0.0/16", "", 0)
+	create("temporary", "10.60.1.0/24", "parent", time.Hour)
+	create("temporary-child", "10.60.1.0/26", "temporary", 0)
+	create("permanent", "10.60.2.0/24", "parent", 0)
+
+	temporary, err := serviceLayer.GetSubnetRepository(ctx, "temporary")
+	if err != nil {
+		t.Fatalf("Failed to get subnet: %v", err)
+	}
+	if temporary.ExpiresAt == nil || !temporary.ExpiresAt.Equal(clock.Add(time.Hour)) {
+		t.Fatalf("Expected the subnet to expire at %s, got %v", clock.Add(time.Hour), temporary.ExpiresAt)
+	}
+
+	clock = clock.Add(59 * time.Minute)
+	if deleted, err := serviceLayer.DeleteExpiredSubnets(ctx); err != nil || deleted != 0 {
+		t.Fatalf("Expected nothing to expire before the TTL, got %d deleted (%v)", deleted, err)
+	}
+
+	clock = clock.Add(time.Minute)
+	deleted, err := serviceLayer.DeleteExpiredSubnets(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSubnets failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected the expired subnet and its child to be deleted, got %d", deleted)
+	}
+
+	for _, id := range []string{"temporary", "temporary-child"} {
+		if _, err := serviceLayer.GetSubnetRepository(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Expected subnet %s to be deleted, got %v", id, err)
+		}
+	}
+	for _, id := range []string{"parent", "permanent"} {
+		if _, err := serviceLayer.GetSubnetRepository(ctx, id); err != nil {
+			t.Errorf("Expected subnet %s to remain, got %v", id, err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"net"
 	"net/netip"
 
@@ -10,13 +12,27 @@ import (
 )
 
 // GoIPAMService implements IPService using go-ipam for IP calculations
-type GoIPAMService struct{}
+type GoIPAMService struct {
+	options IPServiceOptions
+}
+
+// IPServiceOptions controls how GoIPAMService computes allocatable addresses
+type IPServiceOptions struct {
+	// IncludeNetworkBroadcast makes the network and broadcast addresses of
+	// IPv4 subnets larger than /31 allocatable
+	IncludeNetworkBroadcast bool
+}
 
 // NewGoIPAMService creates a new IPService instance
 func NewGoIPAMService() *GoIPAMService {
 	return &GoIPAMService{}
 }
 
+// NewGoIPAMServiceWithOptions creates a new IPService instance with the given options
+func NewGoIPAMServiceWithOptions(options IPServiceOptions) *GoIPAMService {
+	return &GoIPAMService{options: options}
+}
+
 // ValidateCIDR validates a CIDR notation string
 func (s *GoIPAMService) ValidateCIDR(cidr string) error {
 	if cidr == "" {
@@ -54,7 +70,6 @@ func (s *GoIPAMService) CalculateSubnetDetails(cidr string) (*pb.SubnetDetails,
 
 	// Calculate network properties
 	networkAddr := prefix.Addr()
-	bits := prefix.Bits()
 
 	// Calculate netmask
 	netmask := netmaskFromPrefix(prefix)
@@ -76,49 +91,17 @@ func (s *GoIPAMService) CalculateSubnetDetails(cidr string) (*pb.SubnetDetails,
 		broadcast = "N/A (IPv6)"
 	}
 
-	// Calculate host range
-	var hostMin, hostMax string
-	var hostsPerNet int32
-
-	if networkAddr.Is4() {
-		// For IPv4
-		if bits == 32 {
-			// /32 - single host
-			hostMin = networkAddr.String()
-			hostMax = networkAddr.String()
-			hostsPerNet = 1
-		} else if bits == 31 {
-			// /31 - point-to-point link (RFC 3021)
-			hostMin = ipRange.From().String()
-			hostMax = ipRange.To().String()
-			hostsPerNet = 2
-		} else {
-			// Normal subnet - exclude network and broadcast
-			hostMin = ipRange.From().Next().String()
-			hostMax = ipRange.To().Prev().String()
-
-			// Calculate total hosts (2^(32-bits) - 2)
-			totalAddresses := uint64(1) << (32 - bits)
-			hostsPerNet = int32(totalAddresses - 2)
-		}
-	} else {
-		// For IPv6
-		hostMin = ipRange.From().String()
-		hostMax = ipRange.To().String()
-
-		// For IPv6, calculate available addresses
-		// Note: For large subnets, this might overflow, so we cap it
-		if bits >= 64 {
-			totalAddresses := uint64(1) << (128 - bits)
-			if totalAddresses > uint64(2147483647) {
-				hostsPerNet = 2147483647 // Max int32
-			} else {
-				hostsPerNet = int32(totalAddresses)
-			}
-		} else {
-			// For very large IPv6 subnets, just use max int32
-			hostsPerNet = 2147483647
-		}
+	// The host range is the allocatable range: for IPv4 it excludes the
+	// network and broadcast addresses, IPv6 uses the whole prefix
+	usable := s.AllocatableRange(prefix)
+	hostMin := usable.From().String()
+	hostMax := usable.To().String()
+
+	// HostsPerNet is an int32 in the protobuf model, so large IPv4 and most
+	// IPv6 subnets saturate at MaxInt32; HostCount keeps the exact value
+	hostsPerNet := int32(math.MaxInt32)
+	if count := s.HostCount(prefix); count.IsInt64() && count.Int64() <= math.MaxInt32 {
+		hostsPerNet = int32(count.Int64())
 	}
 
 	// Determine if the subnet is public or private
@@ -138,6 +121,37 @@ func (s *GoIPAMService) CalculateSubnetDetails(cidr string) (*pb.SubnetDetails,
 	}, nil
 }
 
+// HostCount returns the exact number of allocatable addresses in prefix,
+// 2^(128-bits) for IPv6, which does not fit any fixed-size integer for large
+// prefixes
+func (s *GoIPAMService) HostCount(prefix netip.Prefix) *big.Int {
+	usable := s.AllocatableRange(prefix)
+	return RangeSize(usable.From(), usable.To())
+}
+
+// RangeSize returns the number of addresses from from to to, inclusive
+func RangeSize(from, to netip.Addr) *big.Int {
+	first := new(big.Int).SetBytes(from.AsSlice())
+	size := new(big.Int).SetBytes(to.AsSlice())
+	size.Sub(size, first)
+	return size.Add(size, big.NewInt(1))
+}
+
+// AllocatableRange returns the addresses of a prefix that may be allocated.
+// The network and broadcast addresses of IPv4 subnets larger than /31 are
+// excluded unless IncludeNetworkBroadcast is set; /31 point-to-point links
+// (RFC 3021), /32 hosts and IPv6 subnets use every address.
+func (s *GoIPAMService) AllocatableRange(prefix netip.Prefix) netipx.IPRange {
+	prefix = prefix.Masked()
+	ipRange := netipx.RangeOfPrefix(prefix)
+
+	if prefix.Addr().Is4() && prefix.Bits() < 31 && !s.options.IncludeNetworkBroadcast {
+		return netipx.IPRangeFrom(ipRange.From().Next(), ipRange.To().Prev())
+	}
+
+	return ipRange
+}
+
 // CalculateUtilization calculates the utilization percentage for a subnet
 func (s *GoIPAMService) CalculateUtilization(totalIPs, allocatedIPs int32) float32 {
 	if totalIPs == 0 {
@@ -146,6 +160,43 @@ func (s *GoIPAMService) CalculateUtilization(totalIPs, allocatedIPs int32) float
 	return (float32(allocatedIPs) / float32(totalIPs)) * 100.0
 }
 
+// SubtractCIDRs removes the given carve-outs from a parent CIDR and returns
+// the remaining address space as the minimal set of CIDRs
+func (s *GoIPAMService) SubtractCIDRs(from string, subtract []string) ([]string, error) {
+	parent, err := netip.ParsePrefix(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR notation %q: %w", from, err)
+	}
+	parent = parent.Masked()
+
+	var b netipx.IPSetBuilder
+	b.AddPrefix(parent)
+
+	for _, cidr := range subtract {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR notation %q: %w", cidr, err)
+		}
+		if prefix.Addr().Is4() != parent.Addr().Is4() {
+			return nil, fmt.Errorf("address family mismatch: cannot subtract %s from %s", cidr, from)
+		}
+		b.RemovePrefix(prefix.Masked())
+	}
+
+	set, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build IP set: %w", err)
+	}
+
+	prefixes := set.Prefixes()
+	remaining := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		remaining[i] = prefix.String()
+	}
+
+	return remaining, nil
+}
+
 // netmaskFromPrefix converts a prefix to a netmask string
 func netmaskFromPrefix(prefix netip.Prefix) string {
 	bits := prefix.Bits()
@@ -188,6 +239,13 @@ func wildcardFromNetmask(netmask string) string {
 	return wildcard.String()
 }
 
+// documentationPrefixes4 holds the RFC 5737 IPv4 documentation ranges
+var documentationPrefixes4 = []netip.Prefix{
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+}
+
 // isPublicIP determines if an IP address is public or private
 func isPublicIP(addr netip.Addr) bool {
 	// Check for private IPv4 ranges
@@ -212,6 +270,20 @@ func isPublicIP(addr netip.Addr) bool {
 		if addr.As4()[0] == 169 && addr.As4()[1] == 254 {
 			return false
 		}
+		// 100.64.0.0/10 (RFC 6598 CGNAT shared address space)
+		if addr.As4()[0] == 100 && addr.As4()[1]&0xc0 == 64 {
+			return false
+		}
+		// 192.0.2.0/24, 198.51.100.0/24, 203.0.113.0/24 (RFC 5737 documentation)
+		for _, prefix := range documentationPrefixes4 {
+			if prefix.Contains(addr) {
+				return false
+			}
+		}
+		// 0.0.0.0/8 ("this network")
+		if addr.As4()[0] == 0 {
+			return false
+		}
 	}
 
 	// Check for private IPv6 ranges
@@ -230,8 +302,9 @@ func isPublicIP(addr netip.Addr) bool {
 		}
 	}
 
-	// Check for loopback and other special addresses
-	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() {
+	// Check for loopback and other special addresses; multicast covers
+	// 224.0.0.0/4 and ff00::/8
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsMulticast() {
 		return false
 	}
 
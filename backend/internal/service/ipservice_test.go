@@ -1,6 +1,7 @@
 package service
 
 import (
+	"math"
 	"net/netip"
 	"testing"
 )
@@ -119,11 +120,20 @@ func TestCalculateSubnetDetails(t *testing.T) {
 			wantIsPublic:    true,
 		},
 		{
-			name:         "IPv6 /64 network",
-			cidr:         "2001:db8::/64",
-			wantAddress:  "2001:db8::",
-			wantType:     "IPv6",
-			wantIsPublic: true,
+			name:            "IPv6 /64 network",
+			cidr:            "2001:db8::/64",
+			wantAddress:     "2001:db8::",
+			wantType:        "IPv6",
+			wantHostsPerNet: math.MaxInt32,
+			wantIsPublic:    true,
+		},
+		{
+			name:            "IPv6 /120 network",
+			cidr:            "2001:db8::/120",
+			wantAddress:     "2001:db8::",
+			wantType:        "IPv6",
+			wantHostsPerNet: 256,
+			wantIsPublic:    true,
 		},
 		{
 			name:    "invalid CIDR",
@@ -184,6 +194,107 @@ func TestCalculateSubnetDetails(t *testing.T) {
 	}
 }
 
+func TestNetworkBroadcastAllocation(t *testing.T) {
+	tests := []struct {
+		name                    string
+		cidr                    string
+		includeNetworkBroadcast bool
+		wantHostMin             string
+		wantHostMax             string
+		wantHostsPerNet         int32
+	}{
+		{
+			name:            "/31 has both addresses usable",
+			cidr:            "10.0.0.0/31",
+			wantHostMin:     "10.0.0.0",
+			wantHostMax:     "10.0.0.1",
+			wantHostsPerNet: 2,
+		},
+		{
+			name:            "/24 excludes network and broadcast by default",
+			cidr:            "192.168.1.0/24",
+			wantHostMin:     "192.168.1.1",
+			wantHostMax:     "192.168.1.254",
+			wantHostsPerNet: 254,
+		},
+		{
+			name:                    "/24 includes network and broadcast when enabled",
+			cidr:                    "192.168.1.0/24",
+			includeNetworkBroadcast: true,
+			wantHostMin:             "192.168.1.0",
+			wantHostMax:             "192.168.1.255",
+			wantHostsPerNet:         256,
+		},
+		{
+			name:                    "/31 is unaffected when enabled",
+			cidr:                    "10.0.0.0/31",
+			includeNetworkBroadcast: true,
+			wantHostMin:             "10.0.0.0",
+			wantHostMax:             "10.0.0.1",
+			wantHostsPerNet:         2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewGoIPAMServiceWithOptions(IPServiceOptions{
+				IncludeNetworkBroadcast: tt.includeNetworkBroadcast,
+			})
+
+			details, err := service.CalculateSubnetDetails(tt.cidr)
+			if err != nil {
+				t.Fatalf("CalculateSubnetDetails() unexpected error = %v", err)
+			}
+
+			if details.HostMin != tt.wantHostMin {
+				t.Errorf("HostMin = %v, want %v", details.HostMin, tt.wantHostMin)
+			}
+			if details.HostMax != tt.wantHostMax {
+				t.Errorf("HostMax = %v, want %v", details.HostMax, tt.wantHostMax)
+			}
+			if details.HostsPerNet != tt.wantHostsPerNet {
+				t.Errorf("HostsPerNet = %v, want %v", details.HostsPerNet, tt.wantHostsPerNet)
+			}
+
+			allocatable := service.AllocatableRange(netip.MustParsePrefix(tt.cidr))
+			if allocatable.From().String() != tt.wantHostMin || allocatable.To().String() != tt.wantHostMax {
+				t.Errorf("AllocatableRange() = %v, want %s-%s", allocatable, tt.wantHostMin, tt.wantHostMax)
+			}
+		})
+	}
+}
+
+func TestHostCount(t *testing.T) {
+	tests := []struct {
+		name                    string
+		cidr                    string
+		includeNetworkBroadcast bool
+		want                    string
+	}{
+		{name: "IPv4 /24", cidr: "192.168.1.0/24", want: "254"},
+		{name: "IPv4 /24 with network and broadcast", cidr: "192.168.1.0/24", includeNetworkBroadcast: true, want: "256"},
+		{name: "IPv4 /31", cidr: "10.0.0.0/31", want: "2"},
+		{name: "IPv4 /32", cidr: "10.0.0.1/32", want: "1"},
+		{name: "IPv4 /0", cidr: "0.0.0.0/0", want: "4294967294"},
+		{name: "IPv6 /128", cidr: "2001:db8::1/128", want: "1"},
+		{name: "IPv6 /64", cidr: "2001:db8::/64", want: "18446744073709551616"},
+		{name: "IPv6 /48", cidr: "2001:db8::/48", want: "1208925819614629174706176"},
+		{name: "IPv6 /0", cidr: "::/0", want: "340282366920938463463374607431768211456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewGoIPAMServiceWithOptions(IPServiceOptions{
+				IncludeNetworkBroadcast: tt.includeNetworkBroadcast,
+			})
+
+			if got := service.HostCount(netip.MustParsePrefix(tt.cidr)).String(); got != tt.want {
+				t.Errorf("HostCount(%s) = %s, want %s", tt.cidr, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestCalculateUtilization(t *testing.T) {
 	service := NewGoIPAMService()
 
@@ -249,17 +360,31 @@ func TestIsPublicIP(t *testing.T) {
 		{name: "127.0.0.0/8 loopback", ip: "127.0.0.1", want: false},
 		{name: "169.254.0.0/16 link-local", ip: "169.254.1.1", want: false},
 
+		// Special-use IPv4 ranges
+		{name: "100.64.0.0/10 CGNAT start", ip: "100.64.0.1", want: false},
+		{name: "100.127.255.254 CGNAT end", ip: "100.127.255.254", want: false},
+		{name: "192.0.2.0/24 TEST-NET-1", ip: "192.0.2.10", want: false},
+		{name: "198.51.100.0/24 TEST-NET-2", ip: "198.51.100.10", want: false},
+		{name: "203.0.113.0/24 TEST-NET-3", ip: "203.0.113.10", want: false},
+		{name: "0.0.0.0/8 this network", ip: "0.1.2.3", want: false},
+		{name: "224.0.0.0/4 multicast", ip: "239.1.1.1", want: false},
+
 		// Public IPv4
 		{name: "8.8.8.8 public", ip: "8.8.8.8", want: true},
 		{name: "1.1.1.1 public", ip: "1.1.1.1", want: true},
 		{name: "172.15.0.1 public", ip: "172.15.0.1", want: true},
 		{name: "172.32.0.1 public", ip: "172.32.0.1", want: true},
+		{name: "100.63.255.255 below CGNAT", ip: "100.63.255.255", want: true},
+		{name: "100.128.0.1 above CGNAT", ip: "100.128.0.1", want: true},
+		{name: "192.0.3.1 next to TEST-NET-1", ip: "192.0.3.1", want: true},
+		{name: "223.255.255.254 below multicast", ip: "223.255.255.254", want: true},
 
 		// Private IPv6 ranges
 		{name: "fc00::/7 ULA", ip: "fc00::1", want: false},
 		{name: "fd00::/7 ULA", ip: "fd00::1", want: false},
 		{name: "fe80::/10 link-local", ip: "fe80::1", want: false},
 		{name: "::1 loopback", ip: "::1", want: false},
+		{name: "ff00::/8 multicast", ip: "ff0e::1", want: false},
 
 		// Public IPv6
 		{name: "2001:db8:: public", ip: "2001:db8::1", want: true},
@@ -285,3 +410,93 @@ func TestIsPublicIP(t *testing.T) {
 func parseIP(ip string) (addr netip.Addr, err error) {
 	return netip.ParseAddr(ip)
 }
+
+func TestSubtractCIDRs(t *testing.T) {
+	service := NewGoIPAMService()
+
+	tests := []struct {
+		name     string
+		from     string
+		subtract []string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "subtract one range",
+			from:     "10.0.0.0/24",
+			subtract: []string{"10.0.0.0/26"},
+			want:     []string{"10.0.0.64/26", "10.0.0.128/25"},
+		},
+		{
+			name:     "subtract multiple ranges",
+			from:     "10.0.0.0/24",
+			subtract: []string{"10.0.0.0/26", "10.0.0.128/27", "10.0.0.255/32"},
+			want: []string{
+				"10.0.0.64/26",
+				"10.0.0.160/27",
+				"10.0.0.192/27",
+				"10.0.0.224/28",
+				"10.0.0.240/29",
+				"10.0.0.248/30",
+				"10.0.0.252/31",
+				"10.0.0.254/32",
+			},
+		},
+		{
+			name:     "subtract nothing",
+			from:     "192.168.0.0/16",
+			subtract: nil,
+			want:     []string{"192.168.0.0/16"},
+		},
+		{
+			name:     "subtract everything",
+			from:     "10.0.0.0/24",
+			subtract: []string{"10.0.0.0/23"},
+			want:     []string{},
+		},
+		{
+			name:     "subtract IPv6 range",
+			from:     "2001:db8::/32",
+			subtract: []string{"2001:db8::/33"},
+			want:     []string{"2001:db8:8000::/33"},
+		},
+		{
+			name:     "mismatched address families",
+			from:     "10.0.0.0/24",
+			subtract: []string{"2001:db8::/64"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid parent CIDR",
+			from:     "10.0.0.0",
+			subtract: []string{"10.0.0.0/26"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid carve-out CIDR",
+			from:     "10.0.0.0/24",
+			subtract: []string{"not-a-cidr"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.SubtractCIDRs(tt.from, tt.subtract)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubtractCIDRs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("SubtractCIDRs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("SubtractCIDRs()[%d] = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	"github.com/google/uuid"
+	"go4.org/netipx"
+)
+
+// ReserveRange excludes the addresses from startIP to endIP, inclusive, of a
+// subnet from IP allocation. An empty endIP reserves startIP alone. Addresses
+// already allocated in the range keep their allocation.
+func (s *ServiceLayer) ReserveRange(ctx context.Context, subnetID, startIP, endIP, reason string) (*repository.ReservedRange, error) {
+	if endIP == "" {
+		endIP = startIP
+	}
+
+	start, err := netip.ParseAddr(startIP)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidIP, startIP)
+	}
+	end, err := netip.ParseAddr(endIP)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidIP, endIP)
+	}
+	start, end = start.Unmap(), end.Unmap()
+
+	reserved := netipx.IPRangeFrom(start, end)
+	if !reserved.IsValid() {
+		return nil, fmt.Errorf("%w: %s-%s is not a valid range", ErrInvalidIP, start, end)
+	}
+
+	unlock := repository.LockSubnet(subnetID)
+	defer unlock()
+
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidCIDR, subnet.CIDR)
+	}
+	prefix = prefix.Masked()
+	if !prefix.Contains(start) || !prefix.Contains(end) {
+		return nil, fmt.Errorf("%w: %s-%s is not within %s", ErrIPOutOfRange, start, end, prefix)
+	}
+
+	reservation := &repository.ReservedRange{
+		ID:        uuid.New().String(),
+		SubnetID:  subnetID,
+		StartIP:   start.String(),
+		EndIP:     end.String(),
+		Reason:    reason,
+		CreatedAt: s.now(),
+	}
+
+	if err := s.subnetRepo.CreateReservedRange(ctx, reservation); err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// ListReservations retrieves the reserved ranges of a subnet, oldest first
+func (s *ServiceLayer) ListReservations(ctx context.Context, subnetID string) ([]*repository.ReservedRange, error) {
+	// Validate that the subnet exists
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	reservations, err := s.subnetRepo.ListReservedRanges(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	if reservations == nil {
+		reservations = []*repository.ReservedRange{}
+	}
+	return reservations, nil
+}
+
+// GetReservation retrieves a single reserved range of a subnet
+func (s *ServiceLayer) GetReservation(ctx context.Context, subnetID, reservationID string) (*repository.ReservedRange, error) {
+	reservations, err := s.ListReservations(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, reservation := range reservations {
+		if reservation.ID == reservationID {
+			return reservation, nil
+		}
+	}
+
+	return nil, ErrReservationNotFound
+}
+
+// DeleteReservation returns a reserved range of a subnet to allocation
+func (s *ServiceLayer) DeleteReservation(ctx context.Context, subnetID, reservationID string) error {
+	unlock := repository.LockSubnet(subnetID)
+	defer unlock()
+
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return err
+	}
+
+	err := s.subnetRepo.DeleteReservedRange(ctx, subnetID, reservationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrReservationNotFound
+	}
+	return err
+}
+
+// reservedAddresses returns the set of addresses reserved in a subnet.
+// Stored ranges that no longer parse are ignored.
+func (s *ServiceLayer) reservedAddresses(ctx context.Context, subnetID string) (*netipx.IPSet, error) {
+	reservations, err := s.subnetRepo.ListReservedRanges(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var b netipx.IPSetBuilder
+	for _, reservation := range reservations {
+		start, errStart := netip.ParseAddr(reservation.StartIP)
+		end, errEnd := netip.ParseAddr(reservation.EndIP)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		b.AddRange(netipx.IPRangeFrom(start, end))
+	}
+
+	reserved, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build reserved address set: %w", err)
+	}
+	return reserved, nil
+}
+
+// reservationsOutOfRange returns the IDs of a subnet's reserved ranges that do
+// not lie entirely within cidr
+func (s *ServiceLayer) reservationsOutOfRange(ctx context.Context, subnetID, cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	reservations, err := s.subnetRepo.ListReservedRanges(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var outOfRange []string
+	for _, reservation := range reservations {
+		start, errStart := netip.ParseAddr(reservation.StartIP)
+		end, errEnd := netip.ParseAddr(reservation.EndIP)
+		if errStart != nil || errEnd != nil || !prefix.Contains(start.Unmap()) || !prefix.Contains(end.Unmap()) {
+			outOfRange = append(outOfRange, reservation.ID)
+		}
+	}
+	return outOfRange, nil
+}
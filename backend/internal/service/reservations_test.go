@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+	pb "github.com/bananaops/ipam-bananaops/proto"
+)
+
+func TestReservedRangesAreSkippedByAllocation(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	subnet := &repository.Subnet{ID: "hosts", CIDR: "10.20.30.0/24", Name: "Hosts"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	t.Run("first allocation follows the reserved range", func(t *testing.T) {
+		reservation, err := serviceLayer.ReserveRange(ctx, subnet.ID, "10.20.30.1", "10.20.30.10", "network gear")
+		if err != nil {
+			t.Fatalf("ReserveRange failed: %v", err)
+		}
+		if reservation.StartIP != "10.20.30.1" || reservation.EndIP != "10.20.30.10" || reservation.ID == "" {
+			t.Errorf("Unexpected reservation %+v", reservation)
+		}
+
+		allocation, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", "")
+		if err != nil {
+			t.Fatalf("AllocateNextIP failed: %v", err)
+		}
+		if allocation.IP != "10.20.30.11" {
+			t.Errorf("Expected 10.20.30.11, got %s", allocation.IP)
+		}
+	})
+
+	t.Run("single address reservation", func(t *testing.T) {
+		reservation, err := serviceLayer.ReserveRange(ctx, subnet.ID, "10.20.30.12", "", "")
+		if err != nil {
+			t.Fatalf("ReserveRange failed: %v", err)
+		}
+		if reservation.EndIP != "10.20.30.12" {
+			t.Errorf("Expected a single address reservation, got %+v", reservation)
+		}
+
+		allocation, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", "")
+		if err != nil {
+			t.Fatalf("AllocateNextIP failed: %v", err)
+		}
+		if allocation.IP != "10.20.30.13" {
+			t.Errorf("Expected 10.20.30.13, got %s", allocation.IP)
+		}
+	})
+
+	t.Run("reserved addresses cannot be allocated explicitly", func(t *testing.T) {
+		if _, err := serviceLayer.AllocateIP(ctx, subnet.ID, "10.20.30.5", "", ""); !errors.Is(err, ErrIPReserved) {
+			t.Errorf("Expected ErrIPReserved, got %v", err)
+		}
+	})
+
+	t.Run("reject invalid and out of subnet ranges", func(t *testing.T) {
+		tests := []struct {
+			start, end string
+			wantErr    error
+		}{
+			{"not-an-ip", "", ErrInvalidIP},
+			{"10.20.30.20", "10.20.30.10", ErrInvalidIP},
+			{"10.20.30.250", "10.20.31.5", ErrIPOutOfRange},
+			{"192.168.0.1", "", ErrIPOutOfRange},
+		}
+		for _, tt := range tests {
+			if _, err := serviceLayer.ReserveRange(ctx, subnet.ID, tt.start, tt.end, ""); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReserveRange(%s, %s): expected %v, got %v", tt.start, tt.end, tt.wantErr, err)
+			}
+		}
+	})
+
+	t.Run("deleting a reservation frees its addresses", func(t *testing.T) {
+		reservations, err := serviceLayer.ListReservations(ctx, subnet.ID)
+		if err != nil {
+			t.Fatalf("ListReservations failed: %v", err)
+		}
+		if len(reservations) != 2 {
+			t.Fatalf("Expected 2 reservations, got %d", len(reservations))
+		}
+
+		if err := serviceLayer.DeleteReservation(ctx, subnet.ID, reservations[0].ID); err != nil {
+			t.Fatalf("DeleteReservation failed: %v", err)
+		}
+		if err := serviceLayer.DeleteReservation(ctx, subnet.ID, reservations[0].ID); !errors.Is(err, ErrReservationNotFound) {
+			t.Errorf("Expected ErrReservationNotFound deleting twice, got %v", err)
+		}
+
+		allocation, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", "")
+		if err != nil {
+			t.Fatalf("AllocateNextIP failed: %v", err)
+		}
+		if allocation.IP != "10.20.30.1" {
+			t.Errorf("Expected 10.20.30.1, got %s", allocation.IP)
+		}
+	})
+}
+
+func TestCIDRChangesKeepReservedRanges(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	subnet := &repository.Subnet{ID: "hosts", CIDR: "10.20.30.0/24", Name: "Hosts"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+	reservation, err := serviceLayer.ReserveRange(ctx, subnet.ID, "10.20.30.200", "10.20.30.210", "")
+	if err != nil {
+		t.Fatalf("ReserveRange failed: %v", err)
+	}
+
+	t.Run("shrinking past a reservation is rejected", func(t *testing.T) {
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: subnet.ID, Cidr: "10.20.30.0/25"}, UpdateSubnetOptions{Force: true})
+		if err != nil {
+			t.Fatalf("UpdateSubnetWithOptions failed: %v", err)
+		}
+		if resp.Error == nil || resp.Error.Code != "RESERVATIONS_OUT_OF_RANGE" || resp.Error.Details["reservation_ids"] != reservation.ID {
+			t.Fatalf("Expected RESERVATIONS_OUT_OF_RANGE naming the reservation, got %+v", resp.Error)
+		}
+	})
+
+	t.Run("growing around a reservation is allowed", func(t *testing.T) {
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: subnet.ID, Cidr: "10.20.30.0/23"}, UpdateSubnetOptions{})
+		if err != nil {
+			t.Fatalf("UpdateSubnetWithOptions failed: %v", err)
+		}
+		if resp.Error != nil {
+			t.Fatalf("Expected the update to succeed, got %+v", resp.Error)
+		}
+	})
+
+	t.Run("renumbering is rejected", func(t *testing.T) {
+		if _, err := serviceLayer.RenumberSubnet(ctx, subnet.ID, "10.20.40.0/23"); !errors.Is(err, ErrInvalidRenumber) {
+			t.Errorf("Expected ErrInvalidRenumber, got %v", err)
+		}
+	})
+}
@@ -2,18 +2,30 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/bananaops/ipam-bananaops/internal/events"
 	"github.com/bananaops/ipam-bananaops/internal/repository"
 	pb "github.com/bananaops/ipam-bananaops/proto"
 	"github.com/google/uuid"
+	"go4.org/netipx"
 )
 
 // IPService defines the interface for IP calculations
 type IPService interface {
 	CalculateSubnetDetails(cidr string) (*pb.SubnetDetails, error)
 	ValidateCIDR(cidr string) error
+	SubtractCIDRs(from string, subtract []string) ([]string, error)
 }
 
 // CloudProviderManager defines the interface for cloud provider operations
@@ -21,19 +33,333 @@ type CloudProviderManager interface {
 	// Future implementation for cloud provider integration
 }
 
+// ErrNoSpaceAvailable is returned when a parent subnet has no free block of the requested size
+var ErrNoSpaceAvailable = errors.New("no space available")
+
+// ErrInvalidPrefixLength is returned when a requested prefix length cannot be carved from a parent
+var ErrInvalidPrefixLength = errors.New("invalid prefix length")
+
+// ErrInvalidIP is returned when an IP address cannot be parsed
+var ErrInvalidIP = errors.New("invalid IP address")
+
+// ErrInvalidCIDR is returned when a CIDR block cannot be parsed
+var ErrInvalidCIDR = errors.New("invalid CIDR")
+
+// ErrIPOutOfRange is returned when an IP address lies outside a subnet's host range
+var ErrIPOutOfRange = errors.New("IP address outside subnet host range")
+
+// ErrIPAlreadyAllocated is returned when an IP address is already allocated in a subnet
+var ErrIPAlreadyAllocated = errors.New("IP address already allocated")
+
+// ErrIPReserved is returned when an IP address lies in a reserved range of a subnet
+var ErrIPReserved = errors.New("IP address reserved")
+
+// ErrReservationNotFound is returned when a reserved range does not exist in a subnet
+var ErrReservationNotFound = fmt.Errorf("reserved range %w", repository.ErrNotFound)
+
+// ErrSameSubnet is returned when a connection would link a subnet to itself
+var ErrSameSubnet = errors.New("source and target subnets cannot be the same")
+
+// ErrDuplicateConnection is returned when a connection of the same type
+// already links the same pair of subnets
+var ErrDuplicateConnection = errors.New("duplicate connection")
+
+// ErrInvalidConnectionMetadata is returned when connection metadata does not
+// match the configured schema
+var ErrInvalidConnectionMetadata = errors.New("invalid connection metadata")
+
+// Reasons reported by PrefixLengthError
+const (
+	PrefixExceedsFamilyMax    = "exceeds_family_max"
+	PrefixNotLongerThanParent = "not_longer_than_parent"
+)
+
+// PrefixLengthError reports a child prefix length that cannot be carved from a parent
+type PrefixLengthError struct {
+	PrefixLength int
+	Parent       netip.Prefix
+	Reason       string
+}
+
+func (e *PrefixLengthError) Error() string {
+	switch e.Reason {
+	case PrefixExceedsFamilyMax:
+		return fmt.Sprintf("prefix length /%d is outside the valid range 0-%d for %s",
+			e.PrefixLength, e.Parent.Addr().BitLen(), addressFamily(e.Parent.Addr()))
+	default:
+		return fmt.Sprintf("prefix length /%d must be longer than the parent prefix %s", e.PrefixLength, e.Parent)
+	}
+}
+
+// Unwrap lets callers match any PrefixLengthError with errors.Is(err, ErrInvalidPrefixLength)
+func (e *PrefixLengthError) Unwrap() error {
+	return ErrInvalidPrefixLength
+}
+
+// validateChildPrefixLength checks that prefixLen is valid for the parent's
+// address family and strictly longer than the parent prefix
+func validateChildPrefixLength(parent netip.Prefix, prefixLen int) error {
+	if prefixLen < 0 || prefixLen > parent.Addr().BitLen() {
+		return &PrefixLengthError{PrefixLength: prefixLen, Parent: parent, Reason: PrefixExceedsFamilyMax}
+	}
+	if prefixLen <= parent.Bits() {
+		return &PrefixLengthError{PrefixLength: prefixLen, Parent: parent, Reason: PrefixNotLongerThanParent}
+	}
+	return nil
+}
+
+// addressFamily returns the display name of an address's family
+func addressFamily(addr netip.Addr) string {
+	if addr.Is4() {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// ErrChildNotContained is returned when a child subnet does not fall strictly inside its parent
+var ErrChildNotContained = errors.New("child subnet not contained in parent")
+
+// ErrInvalidEnvironment is returned when a subnet environment is not in the allowed set
+var ErrInvalidEnvironment = errors.New("invalid environment")
+
+// ErrInvalidDHCPRange is returned when a DHCP range is incomplete, reversed or outside its subnet
+var ErrInvalidDHCPRange = errors.New("invalid DHCP range")
+
+// ErrInvalidUtilization is returned when reported allocated IPs are negative,
+// exceed the subnet size or name the same subnet twice
+var ErrInvalidUtilization = errors.New("invalid utilization")
+
+// ErrInvalidRenumber is returned when a subnet cannot be moved to the
+// requested base CIDR
+var ErrInvalidRenumber = errors.New("invalid renumber")
+
+// ErrBatchRolledBack is reported for bulk create items that were valid but not
+// created because another item in the same batch failed
+var ErrBatchRolledBack = errors.New("not created because another subnet in the batch failed")
+
+// DefaultEnvironments is the allowed environment set used when none is configured
+var DefaultEnvironments = []string{"prod", "staging", "dev", "test"}
+
+// ErrLimitExceeded is returned when a subnet exceeds a configured per-subnet cap
+var ErrLimitExceeded = errors.New("subnet limit exceeded")
+
+// LimitError reports which per-subnet cap a create or update exceeded
+type LimitError struct {
+	Field string
+	Count int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("subnet has %d %s, exceeding the maximum of %d", e.Count, e.Field, e.Max)
+}
+
+// Unwrap lets callers match any LimitError with errors.Is(err, ErrLimitExceeded)
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// OverlapError reports that a CIDR overlaps existing subnets in the same location
+type OverlapError struct {
+	CIDR      string
+	SubnetIDs []string
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("CIDR %s overlaps existing subnets: %s", e.CIDR, strings.Join(e.SubnetIDs, ", "))
+}
+
+// SiblingOverlapError reports that a child CIDR overlaps other children of
+// the same parent, whatever their location
+type SiblingOverlapError struct {
+	CIDR      string
+	ParentID  string
+	SubnetIDs []string
+}
+
+func (e *SiblingOverlapError) Error() string {
+	return fmt.Sprintf("CIDR %s overlaps sibling subnets under parent %s: %s", e.CIDR, e.ParentID, strings.Join(e.SubnetIDs, ", "))
+}
+
+// Unwrap lets callers handling any overlap match a sibling overlap as an *OverlapError
+func (e *SiblingOverlapError) Unwrap() error {
+	return &OverlapError{CIDR: e.CIDR, SubnetIDs: e.SubnetIDs}
+}
+
 // ServiceLayer implements the business logic using Protobuf messages
 type ServiceLayer struct {
 	subnetRepo   repository.SubnetRepository
 	ipService    IPService
 	cloudManager CloudProviderManager
+	options      ServiceOptions
+
+	// idempotencyMu serializes creates made with an idempotency key
+	idempotencyMu sync.Mutex
+
+	// events receives a notification after each successful mutation
+	events *events.Hub
+}
+
+// ServiceOptions controls the per-subnet limits enforced by the service layer
+type ServiceOptions struct {
+	// MaxTagsPerSubnet caps the number of tags a subnet may carry; zero disables the cap
+	MaxTagsPerSubnet int
+
+	// AllowedEnvironments lists the values accepted for a subnet's environment;
+	// empty falls back to DefaultEnvironments
+	AllowedEnvironments []string
+
+	// MaxSplitSubnets caps the number of blocks a single split may produce;
+	// zero falls back to DefaultMaxSplitSubnets
+	MaxSplitSubnets int
+
+	// Clock supplies the time stamped on created and updated records; nil
+	// uses time.Now
+	Clock func() time.Time
+
+	// IdempotencyKeyTTL is how long a create made with an idempotency key
+	// returns its original subnet; zero falls back to DefaultIdempotencyKeyTTL
+	IdempotencyKeyTTL time.Duration
+
+	// ConnectionMetadataSchema maps each allowed connection metadata key to
+	// its type: string, number, boolean, object, array or any. Nil accepts
+	// any metadata.
+	ConnectionMetadataSchema map[string]string
+
+	// AllowSiblingOverlap accepts a child overlapping other children of its
+	// parent that live in another location. Overlaps within a location are
+	// rejected regardless.
+	AllowSiblingOverlap bool
+
+	// UndirectedConnectionTypes lists the connection types that link both
+	// ways, so A to B duplicates an existing B to A. Other types are directed.
+	UndirectedConnectionTypes []string
+
+	// MaxUtilizationSamples caps the utilization history kept per subnet,
+	// pruning the oldest samples first; zero keeps every sample
+	MaxUtilizationSamples int
 }
 
-// NewServiceLayer creates a new service layer instance
+// DefaultMaxSplitSubnets is the split cap used when none is configured
+const DefaultMaxSplitSubnets = 1024
+
+// DefaultIdempotencyKeyTTL is how long idempotency keys are remembered when
+// no TTL is configured
+const DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+// NewServiceLayer creates a new service layer instance without per-subnet limits
 func NewServiceLayer(repo repository.SubnetRepository, ipService IPService, cloudManager CloudProviderManager) *ServiceLayer {
+	return NewServiceLayerWithOptions(repo, ipService, cloudManager, ServiceOptions{})
+}
+
+// NewServiceLayerWithOptions creates a new service layer instance with the given options
+func NewServiceLayerWithOptions(repo repository.SubnetRepository, ipService IPService, cloudManager CloudProviderManager, options ServiceOptions) *ServiceLayer {
 	return &ServiceLayer{
 		subnetRepo:   repo,
 		ipService:    ipService,
 		cloudManager: cloudManager,
+		options:      options,
+		events:       events.NewHub(),
+	}
+}
+
+// Events returns the hub subnet and connection changes are published to
+func (s *ServiceLayer) Events() *events.Hub {
+	return s.events
+}
+
+// Ping verifies that the repository backing the service is reachable
+func (s *ServiceLayer) Ping(ctx context.Context) error {
+	return s.subnetRepo.Ping(ctx)
+}
+
+// publish notifies subscribers of a change to the subnet or connection id
+func (s *ServiceLayer) publish(eventType events.Type, id string) {
+	s.events.Publish(events.Event{Type: eventType, ID: id, Time: s.now()})
+}
+
+// now returns the current time from the configured clock
+func (s *ServiceLayer) now() time.Time {
+	if s.options.Clock != nil {
+		return s.options.Clock()
+	}
+	return time.Now()
+}
+
+// ValidateEnvironment checks that environment is empty or one of the allowed values
+func (s *ServiceLayer) ValidateEnvironment(environment string) error {
+	if environment == "" {
+		return nil
+	}
+
+	allowed := s.options.AllowedEnvironments
+	if len(allowed) == 0 {
+		allowed = DefaultEnvironments
+	}
+	for _, value := range allowed {
+		if value == environment {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q must be one of %s", ErrInvalidEnvironment, environment, strings.Join(allowed, ", "))
+}
+
+// validateDHCPRange checks that a DHCP range is either unset or has both ends
+// inside the subnet with the start not after the end
+func validateDHCPRange(cidr, start, end string) error {
+	if start == "" && end == "" {
+		return nil
+	}
+	if start == "" || end == "" {
+		return fmt.Errorf("%w: start and end must be set together", ErrInvalidDHCPRange)
+	}
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCIDR, err)
+	}
+	prefix = prefix.Masked()
+
+	startAddr, err := netip.ParseAddr(start)
+	if err != nil {
+		return fmt.Errorf("%w: start %q is not an IP address", ErrInvalidDHCPRange, start)
+	}
+	endAddr, err := netip.ParseAddr(end)
+	if err != nil {
+		return fmt.Errorf("%w: end %q is not an IP address", ErrInvalidDHCPRange, end)
+	}
+
+	if !prefix.Contains(startAddr) || !prefix.Contains(endAddr) {
+		return fmt.Errorf("%w: %s-%s is not inside %s", ErrInvalidDHCPRange, startAddr, endAddr, prefix)
+	}
+	if startAddr.Compare(endAddr) > 0 {
+		return fmt.Errorf("%w: start %s is after end %s", ErrInvalidDHCPRange, startAddr, endAddr)
+	}
+
+	return nil
+}
+
+// validateSubnetLimits checks a subnet against the configured per-subnet caps
+func (s *ServiceLayer) validateSubnetLimits(subnet *repository.Subnet) error {
+	if max := s.options.MaxTagsPerSubnet; max > 0 && len(subnet.Tags) > max {
+		return &LimitError{Field: "tags", Count: len(subnet.Tags), Max: max}
+	}
+	return nil
+}
+
+// repositoryErrorCode maps a repository error to the Protobuf error code it
+// surfaces as, so not-found and duplicate failures are not reported as DB_ERROR
+func repositoryErrorCode(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return "SUBNET_NOT_FOUND"
+	case errors.Is(err, repository.ErrDuplicate):
+		return "DUPLICATE_SUBNET"
+	case errors.Is(err, repository.ErrConflict):
+		return "CONFLICT"
+	default:
+		return "DB_ERROR"
 	}
 }
 
@@ -50,6 +376,25 @@ func (s *ServiceLayer) CreateSubnet(ctx context.Context, req *pb.CreateSubnetReq
 		}, nil
 	}
 
+	// Reject CIDRs overlapping existing subnets in the same location
+	if err := s.checkOverlap(ctx, req.Cidr, req.Location, ""); err != nil {
+		code := repositoryErrorCode(err)
+		var details map[string]string
+		var overlapErr *OverlapError
+		if errors.As(err, &overlapErr) {
+			code = "OVERLAPPING_CIDR"
+			details = map[string]string{"subnet_ids": strings.Join(overlapErr.SubnetIDs, ",")}
+		}
+		return &pb.CreateSubnetResponse{
+			Error: &pb.Error{
+				Code:      code,
+				Message:   err.Error(),
+				Details:   details,
+				Timestamp: time.Now().Unix(),
+			},
+		}, nil
+	}
+
 	// Calculate subnet details
 	details, err := s.ipService.CalculateSubnetDetails(req.Cidr)
 	if err != nil {
@@ -77,21 +422,22 @@ func (s *ServiceLayer) CreateSubnet(ctx context.Context, req *pb.CreateSubnetReq
 			AllocatedIps:       0,
 			UtilizationPercent: 0.0,
 		},
-		CreatedAt: time.Now().Unix(),
-		UpdatedAt: time.Now().Unix(),
+		CreatedAt: s.now().Unix(),
+		UpdatedAt: s.now().Unix(),
 	}
 
 	// Persist to repository
 	if err := s.subnetRepo.Create(ctx, subnet); err != nil {
 		return &pb.CreateSubnetResponse{
 			Error: &pb.Error{
-				Code:      "DB_ERROR",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Failed to create subnet: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
 		}, nil
 	}
 
+	s.publish(events.SubnetCreated, subnet.Id)
 	return &pb.CreateSubnetResponse{
 		Subnet: subnet,
 	}, nil
@@ -118,7 +464,7 @@ func (s *ServiceLayer) ListSubnets(ctx context.Context, req *pb.ListSubnetsReque
 	if err != nil {
 		return &pb.ListSubnetsResponse{
 			Error: &pb.Error{
-				Code:      "DB_ERROR",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Failed to retrieve subnets: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
@@ -147,7 +493,7 @@ func (s *ServiceLayer) GetSubnet(ctx context.Context, req *pb.GetSubnetRequest)
 	if err != nil {
 		return &pb.GetSubnetResponse{
 			Error: &pb.Error{
-				Code:      "SUBNET_NOT_FOUND",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Subnet not found: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
@@ -159,8 +505,72 @@ func (s *ServiceLayer) GetSubnet(ctx context.Context, req *pb.GetSubnetRequest)
 	}, nil
 }
 
+// GetSubnetFresh retrieves a subnet like GetSubnet but recomputes its details
+// from the stored CIDR instead of returning the stored, possibly stale, values
+func (s *ServiceLayer) GetSubnetFresh(ctx context.Context, req *pb.GetSubnetRequest) (*pb.GetSubnetResponse, error) {
+	resp, err := s.GetSubnet(ctx, req)
+	if err != nil || resp.Error != nil {
+		return resp, err
+	}
+
+	details, err := s.ipService.CalculateSubnetDetails(resp.Subnet.Cidr)
+	if err != nil {
+		return &pb.GetSubnetResponse{
+			Error: &pb.Error{
+				Code:      "CALCULATION_ERROR",
+				Message:   fmt.Sprintf("Failed to calculate subnet details: %v", err),
+				Timestamp: time.Now().Unix(),
+			},
+		}, nil
+	}
+	resp.Subnet.Details = details
+
+	return resp, nil
+}
+
+// UpdateSubnetRequest fields whose presence is tracked. Description and
+// location can be explicitly set to ""; an explicitly empty name is rejected.
+const (
+	UpdateFieldName        = "name"
+	UpdateFieldDescription = "description"
+	UpdateFieldLocation    = "location"
+)
+
+// UpdateFieldSet names the optional fields present in an update request
+type UpdateFieldSet map[string]bool
+
+// UpdateSubnetOptions adjusts the checks UpdateSubnetWithOptions applies
+type UpdateSubnetOptions struct {
+	// Force allows a CIDR change that leaves existing children outside the subnet
+	Force bool
+	// SetFields marks fields that were provided explicitly and are applied
+	// even when empty; other fields are only applied when non-empty
+	SetFields UpdateFieldSet
+	// DHCPRangeStart and DHCPRangeEnd replace that end of the DHCP range when
+	// non-nil; "" clears it. The resulting range is checked against the new CIDR.
+	DHCPRangeStart *string
+	DHCPRangeEnd   *string
+	// DNSZone replaces the subnet's DNS zone when non-nil; "" clears it
+	DNSZone *string
+	// Environment replaces the subnet's environment when non-nil; "" clears it
+	Environment *string
+	// IfMatch, when set, holds the If-Match header of the request. The update
+	// is rejected with PRECONDITION_FAILED unless it names the subnet's
+	// current ETag, so an edit based on a stale read cannot clobber a newer one.
+	IfMatch string
+}
+
 // UpdateSubnet updates an existing subnet and recalculates properties if CIDR changed
 func (s *ServiceLayer) UpdateSubnet(ctx context.Context, req *pb.UpdateSubnetRequest) (*pb.UpdateSubnetResponse, error) {
+	return s.UpdateSubnetWithOptions(ctx, req, UpdateSubnetOptions{})
+}
+
+// UpdateSubnetWithOptions updates an existing subnet like UpdateSubnet. A CIDR
+// change that would orphan existing children is rejected with
+// CHILDREN_OUT_OF_RANGE unless opts.Force is set, and one that would leave a
+// reserved range outside the new block is always rejected with
+// RESERVATIONS_OUT_OF_RANGE.
+func (s *ServiceLayer) UpdateSubnetWithOptions(ctx context.Context, req *pb.UpdateSubnetRequest, opts UpdateSubnetOptions) (*pb.UpdateSubnetResponse, error) {
 	if req.Id == "" {
 		return &pb.UpdateSubnetResponse{
 			Error: &pb.Error{
@@ -170,21 +580,59 @@ func (s *ServiceLayer) UpdateSubnet(ctx context.Context, req *pb.UpdateSubnetReq
 			},
 		}, nil
 	}
+	if req.Name == "" && opts.SetFields[UpdateFieldName] {
+		return &pb.UpdateSubnetResponse{
+			Error: &pb.Error{
+				Code:      "MISSING_FIELD",
+				Message:   "Name cannot be empty",
+				Timestamp: time.Now().Unix(),
+			},
+		}, nil
+	}
+	if opts.Environment != nil {
+		if err := s.ValidateEnvironment(*opts.Environment); err != nil {
+			return &pb.UpdateSubnetResponse{
+				Error: &pb.Error{
+					Code:      "INVALID_ENVIRONMENT",
+					Message:   err.Error(),
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+	}
+
+	// Hold the subnet lock so a concurrent utilization refresh cannot clobber this edit
+	unlock := repository.LockSubnet(req.Id)
+	defer unlock()
 
 	// Retrieve existing subnet
 	existing, err := s.subnetRepo.FindByID(ctx, req.Id)
 	if err != nil {
 		return &pb.UpdateSubnetResponse{
 			Error: &pb.Error{
-				Code:      "SUBNET_NOT_FOUND",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Subnet not found: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
 		}, nil
 	}
 
+	if opts.IfMatch != "" {
+		if etag := SubnetETag(existing.Id, existing.UpdatedAt); !etagMatches(opts.IfMatch, etag) {
+			return &pb.UpdateSubnetResponse{
+				Error: &pb.Error{
+					Code:      "PRECONDITION_FAILED",
+					Message:   "Subnet has been modified since it was read; fetch it again and retry",
+					Details:   map[string]string{"etag": etag},
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+	}
+
 	// Check if CIDR changed and recalculate if needed
 	var details *pb.SubnetDetails
+	var utilizationChanged bool
 	if req.Cidr != "" && req.Cidr != existing.Cidr {
 		// Validate new CIDR
 		if err := s.ipService.ValidateCIDR(req.Cidr); err != nil {
@@ -197,6 +645,52 @@ func (s *ServiceLayer) UpdateSubnet(ctx context.Context, req *pb.UpdateSubnetReq
 			}, nil
 		}
 
+		if !opts.Force {
+			outOfRange, err := s.childrenOutOfRange(ctx, req.Id, req.Cidr)
+			if err != nil {
+				return &pb.UpdateSubnetResponse{
+					Error: &pb.Error{
+						Code:      repositoryErrorCode(err),
+						Message:   fmt.Sprintf("Failed to check child subnets: %v", err),
+						Timestamp: time.Now().Unix(),
+					},
+				}, nil
+			}
+			if len(outOfRange) > 0 {
+				return &pb.UpdateSubnetResponse{
+					Error: &pb.Error{
+						Code:      "CHILDREN_OUT_OF_RANGE",
+						Message:   fmt.Sprintf("%d child subnet(s) would fall outside %s; retry with force to change the CIDR anyway", len(outOfRange), req.Cidr),
+						Details:   map[string]string{"subnet_ids": strings.Join(outOfRange, ",")},
+						Timestamp: time.Now().Unix(),
+					},
+				}, nil
+			}
+		}
+
+		// Reserved ranges are stored as absolute addresses and are never
+		// carried along, so the new CIDR must still cover every one of them
+		reservationsOutside, err := s.reservationsOutOfRange(ctx, req.Id, req.Cidr)
+		if err != nil {
+			return &pb.UpdateSubnetResponse{
+				Error: &pb.Error{
+					Code:      repositoryErrorCode(err),
+					Message:   fmt.Sprintf("Failed to check reserved ranges: %v", err),
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+		if len(reservationsOutside) > 0 {
+			return &pb.UpdateSubnetResponse{
+				Error: &pb.Error{
+					Code:      "RESERVATIONS_OUT_OF_RANGE",
+					Message:   fmt.Sprintf("%d reserved range(s) would fall outside %s; delete them before changing the CIDR", len(reservationsOutside), req.Cidr),
+					Details:   map[string]string{"reservation_ids": strings.Join(reservationsOutside, ",")},
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+
 		// Recalculate subnet details
 		details, err = s.ipService.CalculateSubnetDetails(req.Cidr)
 		if err != nil {
@@ -216,16 +710,17 @@ func (s *ServiceLayer) UpdateSubnet(ctx context.Context, req *pb.UpdateSubnetReq
 		if existing.Utilization.AllocatedIps > 0 {
 			existing.Utilization.UtilizationPercent = float32(existing.Utilization.AllocatedIps) / float32(details.HostsPerNet) * 100
 		}
+		utilizationChanged = true
 	}
 
 	// Update other fields
 	if req.Name != "" {
 		existing.Name = req.Name
 	}
-	if req.Description != "" {
+	if req.Description != "" || opts.SetFields[UpdateFieldDescription] {
 		existing.Description = req.Description
 	}
-	if req.Location != "" {
+	if req.Location != "" || opts.SetFields[UpdateFieldLocation] {
 		existing.Location = req.Location
 	}
 
@@ -245,26 +740,98 @@ func (s *ServiceLayer) UpdateSubnet(ctx context.Context, req *pb.UpdateSubnetReq
 		}
 	}
 
-	existing.UpdatedAt = time.Now().Unix()
+	existing.UpdatedAt = s.nextUpdatedAt(time.Unix(existing.UpdatedAt, 0)).Unix()
+
+	// The environment, DHCP range and DNS zone are not part of the Protobuf
+	// model; they are written in the same statement as the Protobuf fields.
+	// The DHCP range is checked before anything is written, and a CIDR change
+	// re-checks the stored range against the new block.
+	dhcpRangeChanged := opts.DHCPRangeStart != nil || opts.DHCPRangeEnd != nil
+	var storedFields *repository.StoredFields
+	if dhcpRangeChanged || utilizationChanged || opts.DNSZone != nil || opts.Environment != nil {
+		stored, err := s.subnetRepo.GetSubnetByID(ctx, req.Id)
+		if err != nil {
+			return &pb.UpdateSubnetResponse{
+				Error: &pb.Error{
+					Code:      repositoryErrorCode(err),
+					Message:   fmt.Sprintf("Failed to load stored fields: %v", err),
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+
+		storedFields = &repository.StoredFields{
+			Environment:    stored.Environment,
+			DHCPRangeStart: stored.DHCPRangeStart,
+			DHCPRangeEnd:   stored.DHCPRangeEnd,
+			DNSZone:        stored.DNSZone,
+		}
+		if opts.Environment != nil {
+			storedFields.Environment = *opts.Environment
+		}
+		if opts.DHCPRangeStart != nil {
+			storedFields.DHCPRangeStart = *opts.DHCPRangeStart
+		}
+		if opts.DHCPRangeEnd != nil {
+			storedFields.DHCPRangeEnd = *opts.DHCPRangeEnd
+		}
+		if opts.DNSZone != nil {
+			storedFields.DNSZone = *opts.DNSZone
+		}
+		if err := validateDHCPRange(existing.Cidr, storedFields.DHCPRangeStart, storedFields.DHCPRangeEnd); err != nil {
+			return &pb.UpdateSubnetResponse{
+				Error: &pb.Error{
+					Code:      "INVALID_DHCP_RANGE",
+					Message:   err.Error(),
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+	}
 
 	// Persist changes
-	if err := s.subnetRepo.Update(ctx, existing); err != nil {
+	if err := s.subnetRepo.UpdateWithStoredFields(ctx, existing, storedFields); err != nil {
 		return &pb.UpdateSubnetResponse{
 			Error: &pb.Error{
-				Code:      "DB_ERROR",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Failed to update subnet: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
 		}, nil
 	}
 
+	if utilizationChanged {
+		s.recordUtilization(ctx, &repository.UtilizationSample{
+			SubnetID:     req.Id,
+			Percent:      float64(existing.Utilization.UtilizationPercent),
+			TotalIPs:     existing.Utilization.TotalIps,
+			AllocatedIPs: existing.Utilization.AllocatedIps,
+		})
+	}
+
+	s.publish(events.SubnetUpdated, req.Id)
 	return &pb.UpdateSubnetResponse{
 		Subnet: existing,
 	}, nil
 }
 
-// DeleteSubnet removes a subnet from the system
+// DeleteSubnetOptions adjusts how DeleteSubnetWithOptions treats child subnets
+type DeleteSubnetOptions struct {
+	// Cascade deletes the whole subtree below the subnet instead of refusing
+	// to delete a subnet that still has children
+	Cascade bool
+}
+
+// DeleteSubnet removes a subnet from the system. A subnet with children is
+// rejected with HAS_CHILDREN.
 func (s *ServiceLayer) DeleteSubnet(ctx context.Context, req *pb.DeleteSubnetRequest) (*pb.DeleteSubnetResponse, error) {
+	return s.DeleteSubnetWithOptions(ctx, req, DeleteSubnetOptions{})
+}
+
+// DeleteSubnetWithOptions removes a subnet like DeleteSubnet. With Cascade set,
+// its descendants are deleted first, deepest level first, so a failure part
+// way never leaves a child pointing at a deleted parent.
+func (s *ServiceLayer) DeleteSubnetWithOptions(ctx context.Context, req *pb.DeleteSubnetRequest, opts DeleteSubnetOptions) (*pb.DeleteSubnetResponse, error) {
 	if req.Id == "" {
 		return &pb.DeleteSubnetResponse{
 			Success: false,
@@ -277,62 +844,581 @@ func (s *ServiceLayer) DeleteSubnet(ctx context.Context, req *pb.DeleteSubnetReq
 	}
 
 	// Check if subnet exists
-	_, err := s.subnetRepo.FindByID(ctx, req.Id)
+	existing, err := s.subnetRepo.GetSubnetByID(ctx, req.Id)
 	if err != nil {
 		return &pb.DeleteSubnetResponse{
 			Success: false,
 			Error: &pb.Error{
-				Code:      "SUBNET_NOT_FOUND",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Subnet not found: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
 		}, nil
 	}
 
+	children, err := s.subnetRepo.GetSubnetChildren(ctx, req.Id)
+	if err != nil {
+		return &pb.DeleteSubnetResponse{
+			Success: false,
+			Error: &pb.Error{
+				Code:      repositoryErrorCode(err),
+				Message:   fmt.Sprintf("Failed to check child subnets: %v", err),
+				Timestamp: time.Now().Unix(),
+			},
+		}, nil
+	}
+
+	if len(children) > 0 {
+		if !opts.Cascade {
+			childIDs := make([]string, len(children))
+			for i, child := range children {
+				childIDs[i] = child.ID
+			}
+			return &pb.DeleteSubnetResponse{
+				Success: false,
+				Error: &pb.Error{
+					Code:      "HAS_CHILDREN",
+					Message:   fmt.Sprintf("Subnet has %d child subnet(s); delete them first or retry with cascade", len(children)),
+					Details:   map[string]string{"subnet_ids": strings.Join(childIDs, ",")},
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+
+		if err := s.deleteSubtree(ctx, children, map[string]bool{req.Id: true}); err != nil {
+			return &pb.DeleteSubnetResponse{
+				Success: false,
+				Error: &pb.Error{
+					Code:      repositoryErrorCode(err),
+					Message:   fmt.Sprintf("Failed to delete child subnets: %v", err),
+					Timestamp: time.Now().Unix(),
+				},
+			}, nil
+		}
+	}
+
 	// Delete subnet
 	if err := s.subnetRepo.Delete(ctx, req.Id); err != nil {
 		return &pb.DeleteSubnetResponse{
 			Success: false,
 			Error: &pb.Error{
-				Code:      "DB_ERROR",
+				Code:      repositoryErrorCode(err),
 				Message:   fmt.Sprintf("Failed to delete subnet: %v", err),
 				Timestamp: time.Now().Unix(),
 			},
 		}, nil
 	}
 
+	s.publish(events.SubnetDeleted, req.Id)
+	s.refreshParentUtilization(ctx, existing.ParentID)
+
 	return &pb.DeleteSubnetResponse{
 		Success: true,
 	}, nil
 }
 
-// GetSubnetChildren retrieves child subnets for a given parent subnet ID
-func (s *ServiceLayer) GetSubnetChildren(ctx context.Context, parentID string) ([]*repository.Subnet, error) {
-	return s.subnetRepo.GetSubnetChildren(ctx, parentID)
+// RestoreSubnet brings back a soft-deleted subnet along with its hidden
+// connections, and recalculates its parent's utilization
+func (s *ServiceLayer) RestoreSubnet(ctx context.Context, id string) (*repository.Subnet, error) {
+	if err := s.subnetRepo.RestoreSubnet(ctx, id); err != nil {
+		return nil, err
+	}
+
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// A restored subnet reappears in listings as if newly created
+	s.publish(events.SubnetCreated, id)
+	s.refreshParentUtilization(ctx, subnet.ParentID)
+	return subnet, nil
 }
 
-// ListSubnetsRepository retrieves subnets using repository models with enhanced cloud info
-func (s *ServiceLayer) ListSubnetsRepository(ctx context.Context, filters repository.SubnetFilters) (*repository.SubnetList, error) {
-	return s.subnetRepo.ListSubnets(ctx, filters)
+// deleteSubtree deletes subnets after their own descendants. visited guards
+// against a corrupted hierarchy looping back on itself.
+func (s *ServiceLayer) deleteSubtree(ctx context.Context, subnets []*repository.Subnet, visited map[string]bool) error {
+	for _, subnet := range subnets {
+		if visited[subnet.ID] {
+			continue
+		}
+		visited[subnet.ID] = true
+
+		children, err := s.subnetRepo.GetSubnetChildren(ctx, subnet.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get children of subnet %s: %w", subnet.ID, err)
+		}
+		if err := s.deleteSubtree(ctx, children, visited); err != nil {
+			return err
+		}
+		if err := s.subnetRepo.Delete(ctx, subnet.ID); err != nil {
+			return fmt.Errorf("failed to delete subnet %s: %w", subnet.ID, err)
+		}
+		s.publish(events.SubnetDeleted, subnet.ID)
+	}
+	return nil
 }
 
-// CreateSubnetRepository creates a subnet using repository models
-func (s *ServiceLayer) CreateSubnetRepository(ctx context.Context, subnet *repository.Subnet) error {
-	// Validate CIDR
-	if err := s.ipService.ValidateCIDR(subnet.CIDR); err != nil {
-		return fmt.Errorf("invalid CIDR notation: %w", err)
+// PurgeSubnet permanently removes a subnet, whether live or soft-deleted,
+// together with its connections, notes and allocations
+func (s *ServiceLayer) PurgeSubnet(ctx context.Context, id string) error {
+	// A soft-deleted subnet no longer counts towards its parent, so only a
+	// live one needs the parent refreshed afterwards
+	existing, lookupErr := s.subnetRepo.GetSubnetByID(ctx, id)
+
+	if err := s.subnetRepo.PurgeSubnet(ctx, id); err != nil {
+		return err
 	}
 
-	// Calculate subnet details using IP service
-	details, err := s.ipService.CalculateSubnetDetails(subnet.CIDR)
-	if err != nil {
-		return fmt.Errorf("failed to calculate subnet details: %w", err)
+	// A soft-deleted subnet was already reported deleted
+	if lookupErr == nil {
+		s.publish(events.SubnetDeleted, id)
+		s.refreshParentUtilization(ctx, existing.ParentID)
 	}
+	return nil
+}
 
-	// Add calculated details to subnet
-	subnet.Details = &repository.SubnetDetails{
-		Address:     details.Address,
-		Netmask:     details.Netmask,
+// GetSubnetChildren retrieves child subnets for a given parent subnet ID
+func (s *ServiceLayer) GetSubnetChildren(ctx context.Context, parentID string) ([]*repository.Subnet, error) {
+	return s.subnetRepo.GetSubnetChildren(ctx, parentID)
+}
+
+// GetSubnetSiblings retrieves a page of the subnets sharing the parent of the
+// given subnet, excluding the subnet itself
+func (s *ServiceLayer) GetSubnetSiblings(ctx context.Context, id string, page, pageSize int32) (*repository.SubnetList, error) {
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.subnetRepo.GetSubnetSiblings(ctx, subnet.ID, subnet.ParentID, page, pageSize)
+}
+
+// RecalculateParentUtilization sets a parent subnet's prefix utilization to
+// the share of its address space covered by its children. Overlapping
+// children are counted once and address space outside the parent is ignored.
+//
+// The result goes to Utilization.PrefixUtilizationPercent, reported as
+// prefix_utilization_percent, rather than Utilization.UtilizationPercent:
+// that field is the share of allocated IPs, which every child change would
+// otherwise overwrite. Both figures are kept side by side.
+func (s *ServiceLayer) RecalculateParentUtilization(ctx context.Context, parentID string) error {
+	unlock := repository.LockSubnet(parentID)
+	defer unlock()
+
+	parent, err := s.subnetRepo.GetSubnetByID(ctx, parentID)
+	if err != nil {
+		return err
+	}
+
+	parentPrefix, err := netip.ParsePrefix(parent.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid parent CIDR %s: %w", parent.CIDR, err)
+	}
+	parentPrefix = parentPrefix.Masked()
+
+	children, err := s.subnetRepo.GetSubnetChildren(ctx, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to get children of subnet %s: %w", parentID, err)
+	}
+
+	var childSpace netipx.IPSetBuilder
+	for _, child := range children {
+		prefix, err := netip.ParsePrefix(child.CIDR)
+		if err != nil {
+			continue
+		}
+		childSpace.AddPrefix(prefix.Masked())
+	}
+
+	used, err := childSpace.IPSet()
+	if err != nil {
+		return fmt.Errorf("failed to build child address set: %w", err)
+	}
+
+	// Prefixes either nest or are disjoint, so each one of the union lies
+	// inside the parent, covers it entirely, or lies outside it
+	var usedAddresses float64
+	for _, prefix := range used.Prefixes() {
+		switch {
+		case !prefix.Overlaps(parentPrefix):
+		case prefix.Bits() >= parentPrefix.Bits():
+			usedAddresses += prefixSize(prefix)
+		default:
+			usedAddresses += prefixSize(parentPrefix)
+		}
+	}
+
+	percent := usedAddresses / prefixSize(parentPrefix) * 100
+	if err := s.subnetRepo.UpdatePrefixUtilization(ctx, parentID, percent, s.now()); err != nil {
+		return fmt.Errorf("failed to update parent utilization: %w", err)
+	}
+
+	return nil
+}
+
+// refreshParentUtilization recalculates the utilization of parentID after one
+// of its children changed. Failures are logged since the child change itself
+// already succeeded.
+func (s *ServiceLayer) refreshParentUtilization(ctx context.Context, parentID string) {
+	if parentID == "" {
+		return
+	}
+	if err := s.RecalculateParentUtilization(ctx, parentID); err != nil {
+		log.Printf("Failed to recalculate utilization of parent subnet %s: %v", parentID, err)
+	}
+}
+
+// prefixSize returns the number of addresses in a prefix. A float keeps
+// IPv6 prefixes from overflowing.
+func prefixSize(prefix netip.Prefix) float64 {
+	return math.Ldexp(1, prefix.Addr().BitLen()-prefix.Bits())
+}
+
+// ListSubnetsRepository retrieves subnets using repository models with enhanced cloud info
+func (s *ServiceLayer) ListSubnetsRepository(ctx context.Context, filters repository.SubnetFilters) (*repository.SubnetList, error) {
+	return s.subnetRepo.ListSubnets(ctx, filters)
+}
+
+// WalkSubnets calls fn with successive pages of every subnet, newest first,
+// until all subnets have been visited or fn returns an error. Pages follow a
+// keyset cursor so subnets created during the walk do not shift later pages.
+func (s *ServiceLayer) WalkSubnets(ctx context.Context, pageSize int32, fn func([]*repository.Subnet) error) error {
+	filters := repository.SubnetFilters{PageSize: pageSize}
+	for {
+		list, err := s.subnetRepo.ListSubnets(ctx, filters)
+		if err != nil {
+			return err
+		}
+		if len(list.Subnets) > 0 {
+			if err := fn(list.Subnets); err != nil {
+				return err
+			}
+		}
+		if list.NextCursor == "" {
+			return nil
+		}
+
+		cursor, err := repository.DecodeSubnetCursor(list.NextCursor)
+		if err != nil {
+			return err
+		}
+		filters.After = cursor
+	}
+}
+
+// GetChildRollups aggregates direct child utilization for each of the given
+// parent subnets. Subnets without children get an empty rollup.
+func (s *ServiceLayer) GetChildRollups(ctx context.Context, subnets []*repository.Subnet) (map[string]*repository.ChildRollup, error) {
+	parentIDs := make([]string, len(subnets))
+	for i, subnet := range subnets {
+		parentIDs[i] = subnet.ID
+	}
+
+	rollups, err := s.subnetRepo.GetChildRollups(ctx, parentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range parentIDs {
+		if _, ok := rollups[id]; !ok {
+			rollups[id] = &repository.ChildRollup{}
+		}
+	}
+
+	return rollups, nil
+}
+
+// CreateSubnetOptions controls how new subnets are prepared
+type CreateSubnetOptions struct {
+	// SkipDetails stores the subnet's details as provided, possibly empty,
+	// instead of calculating them, for trusted bulk loads of validated data
+	SkipDetails bool
+
+	// TTL, when positive, makes the subnet expire that long after creation;
+	// the expiry reconciler then deletes it
+	TTL time.Duration
+}
+
+// CreateSubnetRepository creates a subnet using repository models
+func (s *ServiceLayer) CreateSubnetRepository(ctx context.Context, subnet *repository.Subnet) error {
+	return s.CreateSubnetRepositoryWithOptions(ctx, subnet, CreateSubnetOptions{})
+}
+
+// CreateSubnetRepositoryWithOptions creates a subnet like CreateSubnetRepository,
+// skipping the details calculation when opts.SkipDetails is set
+func (s *ServiceLayer) CreateSubnetRepositoryWithOptions(ctx context.Context, subnet *repository.Subnet, opts CreateSubnetOptions) error {
+	if err := s.prepareSubnet(ctx, subnet, opts); err != nil {
+		return err
+	}
+
+	if err := s.subnetRepo.CreateSubnet(ctx, subnet); err != nil {
+		return err
+	}
+
+	s.publish(events.SubnetCreated, subnet.ID)
+	s.refreshParentUtilization(ctx, subnet.ParentID)
+	return nil
+}
+
+// CreateSubnetIdempotent creates a subnet like CreateSubnetRepositoryWithOptions
+// unless an earlier request in scope carrying the same idempotency key already
+// created one, in which case that subnet is returned with replayed set. An
+// empty key always creates. Keyed creates are serialized so that concurrent
+// retries of a request create its subnet once.
+func (s *ServiceLayer) CreateSubnetIdempotent(ctx context.Context, scope, key string, subnet *repository.Subnet, opts CreateSubnetOptions) (result *repository.Subnet, replayed bool, err error) {
+	if key == "" {
+		if err := s.CreateSubnetRepositoryWithOptions(ctx, subnet, opts); err != nil {
+			return nil, false, err
+		}
+		return subnet, false, nil
+	}
+
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	previous, err := s.subnetRepo.GetIdempotentResult(ctx, scope, key, s.now())
+	if err == nil {
+		existing, err := s.subnetRepo.GetSubnetByID(ctx, previous.ResourceID)
+		if err != nil {
+			return nil, false, fmt.Errorf("subnet created with idempotency key %q: %w", key, err)
+		}
+		return existing, true, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, false, err
+	}
+
+	if err := s.CreateSubnetRepositoryWithOptions(ctx, subnet, opts); err != nil {
+		return nil, false, err
+	}
+
+	now := s.now()
+	saved := &repository.IdempotentResult{
+		Scope:      scope,
+		Key:        key,
+		ResourceID: subnet.ID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.idempotencyKeyTTL()),
+	}
+	if err := s.subnetRepo.SaveIdempotentResult(ctx, saved); err != nil {
+		// The subnet exists, so the request succeeded; only a retry could duplicate it
+		log.Printf("Failed to save idempotency key %q for subnet %s: %v", key, subnet.ID, err)
+	}
+
+	return subnet, false, nil
+}
+
+// idempotencyKeyTTL returns how long idempotency keys are remembered
+func (s *ServiceLayer) idempotencyKeyTTL() time.Duration {
+	if s.options.IdempotencyKeyTTL > 0 {
+		return s.options.IdempotencyKeyTTL
+	}
+	return DefaultIdempotencyKeyTTL
+}
+
+// BulkCreateResult reports the outcome of one subnet in a bulk create
+type BulkCreateResult struct {
+	Index  int
+	CIDR   string
+	Subnet *repository.Subnet
+	Err    error
+}
+
+// BulkCreateSubnets validates every subnet and calculates its details, then
+// inserts the whole batch in a single repository transaction. Nothing is
+// created unless every subnet is valid and inserted; the returned results
+// carry the per-subnet error when the batch fails. Parents must already exist,
+// and subnets in the same location may not overlap each other.
+func (s *ServiceLayer) BulkCreateSubnets(ctx context.Context, subnets []*repository.Subnet) ([]*BulkCreateResult, error) {
+	return s.BulkCreateSubnetsWithOptions(ctx, subnets, CreateSubnetOptions{})
+}
+
+// BulkCreateSubnetsWithOptions creates subnets like BulkCreateSubnets,
+// skipping the details calculation when opts.SkipDetails is set
+func (s *ServiceLayer) BulkCreateSubnetsWithOptions(ctx context.Context, subnets []*repository.Subnet, opts CreateSubnetOptions) ([]*BulkCreateResult, error) {
+	results := make([]*BulkCreateResult, len(subnets))
+	failed := false
+	for i, subnet := range subnets {
+		results[i] = &BulkCreateResult{Index: i, CIDR: subnet.CIDR, Subnet: subnet}
+		if err := s.prepareSubnet(ctx, subnet, opts); err != nil {
+			results[i].Err = err
+			failed = true
+		}
+	}
+
+	// Items were only checked against stored subnets, so check them against each other
+	for i, subnet := range subnets {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := s.checkBatchSiblingOverlap(subnets[:i], subnet); err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		if err := checkBatchOverlap(subnets[:i], subnet); err != nil {
+			results[i].Err = err
+			failed = true
+		}
+	}
+
+	if failed {
+		markRolledBack(results)
+		return results, nil
+	}
+
+	if err := s.subnetRepo.BulkCreateSubnets(ctx, subnets); err != nil {
+		var bulkErr *repository.BulkCreateError
+		if !errors.As(err, &bulkErr) || bulkErr.Index >= len(results) {
+			return nil, err
+		}
+		results[bulkErr.Index].Err = bulkErr.Err
+		markRolledBack(results)
+		return results, nil
+	}
+
+	refreshed := make(map[string]bool)
+	for _, subnet := range subnets {
+		s.publish(events.SubnetCreated, subnet.ID)
+		if subnet.ParentID != "" && !refreshed[subnet.ParentID] {
+			refreshed[subnet.ParentID] = true
+			s.refreshParentUtilization(ctx, subnet.ParentID)
+		}
+	}
+
+	return results, nil
+}
+
+// checkBatchOverlap rejects a subnet overlapping an earlier subnet of the same
+// batch in the same location
+func checkBatchOverlap(earlier []*repository.Subnet, subnet *repository.Subnet) error {
+	prefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	var conflicts []string
+	for _, other := range earlier {
+		if other.Location != subnet.Location {
+			continue
+		}
+		otherPrefix, err := netip.ParsePrefix(other.CIDR)
+		if err != nil {
+			continue
+		}
+		if otherPrefix.Masked().Overlaps(prefix) {
+			conflicts = append(conflicts, other.ID)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	return &OverlapError{CIDR: subnet.CIDR, SubnetIDs: conflicts}
+}
+
+// checkBatchSiblingOverlap rejects a child overlapping an earlier subnet of
+// the same batch under the same parent, unless sibling overlaps are allowed
+func (s *ServiceLayer) checkBatchSiblingOverlap(earlier []*repository.Subnet, subnet *repository.Subnet) error {
+	if subnet.ParentID == "" || s.options.AllowSiblingOverlap {
+		return nil
+	}
+
+	var siblings []*repository.Subnet
+	for _, other := range earlier {
+		if other.ParentID == subnet.ParentID {
+			siblings = append(siblings, other)
+		}
+	}
+	return siblingOverlap(siblings, subnet)
+}
+
+// markRolledBack flags every result without its own error as rolled back
+func markRolledBack(results []*BulkCreateResult) {
+	for _, result := range results {
+		if result.Err == nil {
+			result.Err = ErrBatchRolledBack
+		}
+	}
+}
+
+// prepareSubnet validates a new subnet against the stored inventory and fills
+// in its calculated details, unless opts.SkipDetails is set, and its initial
+// utilization
+func (s *ServiceLayer) prepareSubnet(ctx context.Context, subnet *repository.Subnet, opts CreateSubnetOptions) error {
+	// Validate CIDR
+	if err := s.ipService.ValidateCIDR(subnet.CIDR); err != nil {
+		return fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+
+	if err := s.ValidateEnvironment(subnet.Environment); err != nil {
+		return err
+	}
+
+	if err := validateDHCPRange(subnet.CIDR, subnet.DHCPRangeStart, subnet.DHCPRangeEnd); err != nil {
+		return err
+	}
+
+	if err := s.validateSubnetLimits(subnet); err != nil {
+		return err
+	}
+
+	if subnet.ParentID != "" {
+		if err := s.validateChildContainment(ctx, subnet); err != nil {
+			return err
+		}
+		if err := s.checkSiblingOverlap(ctx, subnet); err != nil {
+			return err
+		}
+	}
+
+	// Reject CIDRs overlapping existing subnets in the same location
+	if err := s.checkOverlap(ctx, subnet.CIDR, subnet.Location, subnet.ParentID); err != nil {
+		return err
+	}
+
+	if !opts.SkipDetails {
+		details, err := s.calculateDetails(subnet.CIDR)
+		if err != nil {
+			return err
+		}
+		subnet.Details = details
+	}
+
+	if opts.TTL > 0 {
+		expiresAt := s.now().Add(opts.TTL)
+		subnet.ExpiresAt = &expiresAt
+	}
+
+	// Initialize utilization; skipped details leave the total to the provided details, if any
+	if subnet.Utilization == nil {
+		var totalIPs int32
+		if subnet.Details != nil {
+			totalIPs = subnet.Details.HostsPerNet
+		}
+		subnet.Utilization = &repository.Utilization{
+			TotalIPs:           totalIPs,
+			AllocatedIPs:       0,
+			UtilizationPercent: 0.0,
+			LastUpdated:        s.now(),
+		}
+	}
+
+	return nil
+}
+
+// calculateDetails computes the repository details of a CIDR using the IP service
+func (s *ServiceLayer) calculateDetails(cidr string) (*repository.SubnetDetails, error) {
+	details, err := s.ipService.CalculateSubnetDetails(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate subnet details: %w", err)
+	}
+
+	return &repository.SubnetDetails{
+		Address:     details.Address,
+		Netmask:     details.Netmask,
 		Wildcard:    details.Wildcard,
 		Network:     details.Network,
 		Type:        details.Type,
@@ -341,24 +1427,873 @@ func (s *ServiceLayer) CreateSubnetRepository(ctx context.Context, subnet *repos
 		HostMax:     details.HostMax,
 		HostsPerNet: details.HostsPerNet,
 		IsPublic:    details.IsPublic,
+	}, nil
+}
+
+// checkSiblingOverlap returns a *SiblingOverlapError when a child overlaps
+// the stored children of its parent, unless sibling overlaps are allowed
+func (s *ServiceLayer) checkSiblingOverlap(ctx context.Context, subnet *repository.Subnet) error {
+	if s.options.AllowSiblingOverlap {
+		return nil
+	}
+
+	siblings, err := s.subnetRepo.GetSubnetChildren(ctx, subnet.ParentID)
+	if err != nil {
+		return fmt.Errorf("failed to load sibling subnets: %w", err)
+	}
+	return siblingOverlap(siblings, subnet)
+}
+
+// siblingOverlap returns a *SiblingOverlapError listing the siblings whose
+// CIDR overlaps the subnet's. An identical CIDR is left to the repository so
+// it keeps surfacing as a duplicate.
+func siblingOverlap(siblings []*repository.Subnet, subnet *repository.Subnet) error {
+	prefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	var conflicts []string
+	for _, sibling := range siblings {
+		siblingPrefix, err := netip.ParsePrefix(sibling.CIDR)
+		if err != nil || sibling.ID == subnet.ID {
+			continue
+		}
+		siblingPrefix = siblingPrefix.Masked()
+		if siblingPrefix != prefix && siblingPrefix.Overlaps(prefix) {
+			conflicts = append(conflicts, sibling.ID)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	return &SiblingOverlapError{CIDR: subnet.CIDR, ParentID: subnet.ParentID, SubnetIDs: conflicts}
+}
+
+// childrenOutOfRange returns the IDs of the direct children of parentID that
+// would not lie strictly inside cidr
+func (s *ServiceLayer) childrenOutOfRange(ctx context.Context, parentID, cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	children, err := s.subnetRepo.GetSubnetChildren(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var outOfRange []string
+	for _, child := range children {
+		childPrefix, err := netip.ParsePrefix(child.CIDR)
+		if err != nil {
+			continue
+		}
+		childPrefix = childPrefix.Masked()
+		if !prefix.Contains(childPrefix.Addr()) || childPrefix.Bits() <= prefix.Bits() {
+			outOfRange = append(outOfRange, child.ID)
+		}
+	}
+	return outOfRange, nil
+}
+
+// validateChildContainment checks that a subnet's CIDR lies inside its parent's
+// CIDR with a strictly longer prefix
+func (s *ServiceLayer) validateChildContainment(ctx context.Context, subnet *repository.Subnet) error {
+	parent, err := s.subnetRepo.GetSubnetByID(ctx, subnet.ParentID)
+	if err != nil {
+		return fmt.Errorf("failed to load parent subnet: %w", err)
+	}
+
+	parentPrefix, err := netip.ParsePrefix(parent.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid parent CIDR: %w", err)
+	}
+	childPrefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	parentPrefix, childPrefix = parentPrefix.Masked(), childPrefix.Masked()
+
+	if !parentPrefix.Contains(childPrefix.Addr()) || childPrefix.Bits() < parentPrefix.Bits() {
+		return fmt.Errorf("%w: %s is outside parent %s", ErrChildNotContained, childPrefix, parentPrefix)
+	}
+	if childPrefix.Bits() == parentPrefix.Bits() {
+		return fmt.Errorf("%w: %s must have a longer prefix than parent %s", ErrChildNotContained, childPrefix, parentPrefix)
+	}
+
+	return nil
+}
+
+// SetSubnetEnvironment changes a subnet's environment; an empty value clears it
+func (s *ServiceLayer) SetSubnetEnvironment(ctx context.Context, id, environment string) error {
+	if err := s.ValidateEnvironment(environment); err != nil {
+		return err
+	}
+
+	unlock := repository.LockSubnet(id)
+	defer unlock()
+
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	subnet.Environment = environment
+	subnet.UpdatedAt = s.nextUpdatedAt(subnet.UpdatedAt)
+	if err := s.subnetRepo.UpdateSubnet(ctx, id, subnet); err != nil {
+		return err
+	}
+
+	s.publish(events.SubnetUpdated, id)
+	return nil
+}
+
+// SetSubnetTags replaces a subnet's tags, leaving its other fields unchanged
+func (s *ServiceLayer) SetSubnetTags(ctx context.Context, id string, tags map[string]string) error {
+	unlock := repository.LockSubnet(id)
+	defer unlock()
+
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	subnet.Tags = tags
+	if err := s.validateSubnetLimits(subnet); err != nil {
+		return err
+	}
+
+	subnet.UpdatedAt = s.nextUpdatedAt(subnet.UpdatedAt)
+	if err := s.subnetRepo.UpdateSubnet(ctx, id, subnet); err != nil {
+		return err
+	}
+
+	s.publish(events.SubnetUpdated, id)
+	return nil
+}
+
+// CountSubnetsByEnvironment returns the environment facet: subnet counts keyed
+// by environment, with unassigned subnets under the empty string
+func (s *ServiceLayer) CountSubnetsByEnvironment(ctx context.Context) (map[string]int32, error) {
+	return s.subnetRepo.CountSubnetsByEnvironment(ctx)
+}
+
+// PrefixLengthCount is the number of subnets with a given CIDR prefix length
+type PrefixLengthCount struct {
+	PrefixLength int32
+	Count        int32
+}
+
+// CountSubnetsByPrefixLength returns subnet counts per CIDR prefix length,
+// ordered from the shortest prefix to the longest
+func (s *ServiceLayer) CountSubnetsByPrefixLength(ctx context.Context) ([]*PrefixLengthCount, error) {
+	counts, err := s.subnetRepo.CountSubnetsByPrefixLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*PrefixLengthCount, 0, len(counts))
+	for prefixLength, count := range counts {
+		result = append(result, &PrefixLengthCount{PrefixLength: prefixLength, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PrefixLength < result[j].PrefixLength
+	})
+
+	return result, nil
+}
+
+// GetSubnetRepository retrieves a subnet by ID using repository models
+func (s *ServiceLayer) GetSubnetRepository(ctx context.Context, id string) (*repository.Subnet, error) {
+	return s.subnetRepo.GetSubnetByID(ctx, id)
+}
+
+// CalculateSubnetDetails validates a CIDR and computes its subnet details
+// without storing anything
+func (s *ServiceLayer) CalculateSubnetDetails(cidr string) (*pb.SubnetDetails, error) {
+	if err := s.ipService.ValidateCIDR(cidr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCIDR, err)
+	}
+	return s.ipService.CalculateSubnetDetails(cidr)
+}
+
+// SubtractCIDRs returns the ranges of a parent CIDR left after removing the carve-outs
+func (s *ServiceLayer) SubtractCIDRs(from string, subtract []string) ([]string, error) {
+	return s.ipService.SubtractCIDRs(from, subtract)
+}
+
+// OverlapCheck returns the existing subnets in a location whose CIDR overlaps the given CIDR
+func (s *ServiceLayer) OverlapCheck(ctx context.Context, cidr, location string) ([]*repository.Subnet, error) {
+	return s.subnetRepo.FindOverlappingSubnets(ctx, cidr, location)
+}
+
+// ancestorChain walks parent links upwards from parentID and returns the
+// ancestors nearest first. The walk stops at a missing parent or when a
+// subnet repeats, including subnetID itself, so cyclic parent links cannot
+// loop forever.
+func (s *ServiceLayer) ancestorChain(ctx context.Context, subnetID, parentID string) []*repository.Subnet {
+	visited := map[string]bool{subnetID: true}
+	var chain []*repository.Subnet
+	for id := parentID; id != "" && !visited[id]; {
+		visited[id] = true
+		parent, err := s.subnetRepo.GetSubnetByID(ctx, id)
+		if err != nil {
+			break
+		}
+		chain = append(chain, parent)
+		id = parent.ParentID
+	}
+	return chain
+}
+
+// SubnetTreeNode is a subnet with its recursively nested children
+type SubnetTreeNode struct {
+	Subnet          *repository.Subnet
+	Children        []*SubnetTreeNode
+	DescendantCount int
+}
+
+// GetSubnetTree returns the subnet rootID with all of its descendants nested
+// under it. Every subnet is loaded with a single ListSubnets call and linked by
+// ParentID in memory; a subnet reached twice through cyclic parent links is
+// only placed once. Children are ordered by address.
+func (s *ServiceLayer) GetSubnetTree(ctx context.Context, rootID string) (*SubnetTreeNode, error) {
+	list, err := s.subnetRepo.ListSubnets(ctx, repository.SubnetFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
+	}
+
+	var root *repository.Subnet
+	children := make(map[string][]*repository.Subnet)
+	for _, subnet := range list.Subnets {
+		if subnet.ID == rootID {
+			root = subnet
+		}
+		if subnet.ParentID != "" {
+			children[subnet.ParentID] = append(children[subnet.ParentID], subnet)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("subnet %w", repository.ErrNotFound)
+	}
+
+	visited := make(map[string]bool)
+	var build func(subnet *repository.Subnet) *SubnetTreeNode
+	build = func(subnet *repository.Subnet) *SubnetTreeNode {
+		visited[subnet.ID] = true
+		node := &SubnetTreeNode{Subnet: subnet}
+
+		kids := children[subnet.ID]
+		sortSubnetsByAddress(kids)
+		for _, child := range kids {
+			if visited[child.ID] {
+				log.Printf("Subnet %s is part of a parent cycle; not nesting it again under %s", child.ID, subnet.ID)
+				continue
+			}
+			childNode := build(child)
+			node.Children = append(node.Children, childNode)
+			node.DescendantCount += childNode.DescendantCount + 1
+		}
+		return node
+	}
+
+	return build(root), nil
+}
+
+// sortSubnetsByAddress orders subnets by network address, then prefix length.
+// Unparseable CIDRs sort after valid ones by their text.
+func sortSubnetsByAddress(subnets []*repository.Subnet) {
+	sort.SliceStable(subnets, func(i, j int) bool {
+		a, errA := netip.ParsePrefix(subnets[i].CIDR)
+		b, errB := netip.ParsePrefix(subnets[j].CIDR)
+		switch {
+		case errA != nil || errB != nil:
+			if (errA == nil) != (errB == nil) {
+				return errA == nil
+			}
+			return subnets[i].CIDR < subnets[j].CIDR
+		case a.Addr() != b.Addr():
+			return a.Addr().Less(b.Addr())
+		default:
+			return a.Bits() < b.Bits()
+		}
+	})
+}
+
+// GetSubnetPath returns the CIDRs from the root of a subnet's hierarchy down
+// to the subnet itself, for breadcrumb display
+func (s *ServiceLayer) GetSubnetPath(ctx context.Context, id string) ([]string, error) {
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors := s.ancestorChain(ctx, subnet.ID, subnet.ParentID)
+	path := make([]string, 0, len(ancestors)+1)
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		path = append(path, ancestors[i].CIDR)
+	}
+	return append(path, subnet.CIDR), nil
+}
+
+// SubnetLookup is the most specific subnet containing an address, with its
+// ancestors nearest first
+type SubnetLookup struct {
+	Subnet    *repository.Subnet
+	Ancestors []*repository.Subnet
+}
+
+// LookupByIP returns the most specific subnet whose CIDR contains ip, along
+// with its parent chain. It returns a "subnet not found" error when no subnet
+// contains the address.
+func (s *ServiceLayer) LookupByIP(ctx context.Context, ip string) (*SubnetLookup, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidIP, ip)
+	}
+	addr = addr.Unmap()
+
+	list, err := s.subnetRepo.ListSubnets(ctx, repository.SubnetFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
+	}
+
+	var best *repository.Subnet
+	bestBits := -1
+	for _, subnet := range list.Subnets {
+		prefix, err := netip.ParsePrefix(subnet.CIDR)
+		if err != nil || !prefix.Contains(addr) {
+			continue
+		}
+		if prefix.Bits() > bestBits {
+			best, bestBits = subnet, prefix.Bits()
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("subnet %w: no subnet contains %s", repository.ErrNotFound, addr)
+	}
+
+	return &SubnetLookup{
+		Subnet:    best,
+		Ancestors: s.ancestorChain(ctx, best.ID, best.ParentID),
+	}, nil
+}
+
+// prefixIndex answers containment queries against a fixed set of subnets. The
+// prefixes are sorted by start address, widest first on ties, so the prefixes
+// containing an address are always the nearest prefix starting at or before it
+// and that prefix's enclosing chain.
+type prefixIndex struct {
+	prefixes  []netip.Prefix
+	subnets   []*repository.Subnet
+	enclosing []int // index of the nearest prefix containing each prefix, or -1
+}
+
+// newPrefixIndex builds an index over subnets, skipping unparsable CIDRs
+func newPrefixIndex(subnets []*repository.Subnet) *prefixIndex {
+	index := &prefixIndex{}
+	for _, subnet := range subnets {
+		prefix, err := netip.ParsePrefix(subnet.CIDR)
+		if err != nil {
+			continue
+		}
+		index.prefixes = append(index.prefixes, prefix.Masked())
+		index.subnets = append(index.subnets, subnet)
+	}
+	sort.Sort(index)
+
+	// CIDR blocks either nest or are disjoint, so a stack of open blocks
+	// yields each prefix's nearest enclosing one
+	index.enclosing = make([]int, len(index.prefixes))
+	var open []int
+	for i, prefix := range index.prefixes {
+		for len(open) > 0 && !index.prefixes[open[len(open)-1]].Contains(prefix.Addr()) {
+			open = open[:len(open)-1]
+		}
+		index.enclosing[i] = -1
+		if len(open) > 0 {
+			index.enclosing[i] = open[len(open)-1]
+		}
+		open = append(open, i)
+	}
+
+	return index
+}
+
+func (x *prefixIndex) Len() int { return len(x.prefixes) }
+
+func (x *prefixIndex) Less(i, j int) bool {
+	if c := x.prefixes[i].Addr().Compare(x.prefixes[j].Addr()); c != 0 {
+		return c < 0
+	}
+	return x.prefixes[i].Bits() < x.prefixes[j].Bits()
+}
+
+func (x *prefixIndex) Swap(i, j int) {
+	x.prefixes[i], x.prefixes[j] = x.prefixes[j], x.prefixes[i]
+	x.subnets[i], x.subnets[j] = x.subnets[j], x.subnets[i]
+}
+
+// lookup returns the most specific subnet containing addr, or nil
+func (x *prefixIndex) lookup(addr netip.Addr) *repository.Subnet {
+	// Last prefix starting at or before addr
+	i := sort.Search(len(x.prefixes), func(i int) bool {
+		return x.prefixes[i].Addr().Compare(addr) > 0
+	}) - 1
+	for ; i >= 0; i = x.enclosing[i] {
+		if x.prefixes[i].Contains(addr) {
+			return x.subnets[i]
+		}
+	}
+	return nil
+}
+
+// FindSubnetsForIPs returns the most specific subnet containing each of ips,
+// in the same order, with nil for addresses no subnet contains. The subnets are
+// indexed once, so each address costs a binary search rather than a scan.
+func (s *ServiceLayer) FindSubnetsForIPs(ctx context.Context, ips []string) ([]*repository.Subnet, error) {
+	addrs := make([]netip.Addr, len(ips))
+	for i, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q at index %d", ErrInvalidIP, ip, i)
+		}
+		addrs[i] = addr.Unmap()
+	}
+
+	list, err := s.subnetRepo.ListSubnets(ctx, repository.SubnetFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
+	}
+	index := newPrefixIndex(list.Subnets)
+
+	results := make([]*repository.Subnet, len(addrs))
+	for i, addr := range addrs {
+		results[i] = index.lookup(addr)
+	}
+	return results, nil
+}
+
+// FindContainedSubnets returns every subnet that lies entirely within the
+// block cidr, including one equal to it, ordered by address. It returns a
+// "subnet not found" error when the block contains no subnets.
+func (s *ServiceLayer) FindContainedSubnets(ctx context.Context, cidr string) ([]*repository.Subnet, error) {
+	block, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidCIDR, cidr)
+	}
+	block = block.Masked()
+
+	list, err := s.subnetRepo.ListSubnets(ctx, repository.SubnetFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %w", err)
+	}
+
+	var contained []*repository.Subnet
+	for _, subnet := range list.Subnets {
+		prefix, err := netip.ParsePrefix(subnet.CIDR)
+		if err != nil || prefix.Bits() < block.Bits() || !block.Contains(prefix.Addr()) {
+			continue
+		}
+		contained = append(contained, subnet)
+	}
+	if len(contained) == 0 {
+		return nil, fmt.Errorf("subnet %w: no subnets within %s", repository.ErrNotFound, block)
+	}
+
+	sortSubnetsByAddress(contained)
+	return contained, nil
+}
+
+// checkOverlap returns an *OverlapError when cidr overlaps existing subnets in
+// the location. The parent chain starting at parentID is expected to contain
+// the new subnet and is ignored, and an identical CIDR is left to the
+// repository so it keeps surfacing as a duplicate.
+func (s *ServiceLayer) checkOverlap(ctx context.Context, cidr, location, parentID string) error {
+	overlapping, err := s.OverlapCheck(ctx, cidr, location)
+	if err != nil {
+		return fmt.Errorf("failed to check for overlapping subnets: %w", err)
+	}
+	if len(overlapping) == 0 {
+		return nil
+	}
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	ancestors := make(map[string]bool)
+	for _, ancestor := range s.ancestorChain(ctx, "", parentID) {
+		ancestors[ancestor.ID] = true
+	}
+
+	var conflicts []string
+	for _, existing := range overlapping {
+		if existingPrefix, err := netip.ParsePrefix(existing.CIDR); err == nil && existingPrefix.Masked() == prefix {
+			return nil
+		}
+		if ancestors[existing.ID] {
+			continue
+		}
+		conflicts = append(conflicts, existing.ID)
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	return &OverlapError{CIDR: cidr, SubnetIDs: conflicts}
+}
+
+// FindNextAvailableSubnet returns the lowest CIDR block of the given prefix
+// length inside the parent subnet that does not overlap any of its children
+func (s *ServiceLayer) FindNextAvailableSubnet(ctx context.Context, parentID string, prefixLen int) (string, error) {
+	parent, err := s.subnetRepo.GetSubnetByID(ctx, parentID)
+	if err != nil {
+		return "", err
+	}
+
+	parentPrefix, err := netip.ParsePrefix(parent.CIDR)
+	if err != nil {
+		return "", fmt.Errorf("invalid parent CIDR %s: %w", parent.CIDR, err)
+	}
+	parentPrefix = parentPrefix.Masked()
+
+	if err := validateChildPrefixLength(parentPrefix, prefixLen); err != nil {
+		return "", err
+	}
+
+	children, err := s.subnetRepo.GetSubnetChildren(ctx, parentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load child subnets: %w", err)
+	}
+
+	var b netipx.IPSetBuilder
+	b.AddPrefix(parentPrefix)
+	for _, child := range children {
+		childPrefix, err := netip.ParsePrefix(child.CIDR)
+		if err != nil {
+			continue
+		}
+		b.RemovePrefix(childPrefix.Masked())
+	}
+
+	free, err := b.IPSet()
+	if err != nil {
+		return "", fmt.Errorf("failed to build free address set: %w", err)
+	}
+
+	// Prefixes are the maximal aligned blocks of the free space in address
+	// order, so the first one large enough starts with the block we want
+	for _, block := range free.Prefixes() {
+		if block.Bits() <= prefixLen {
+			return netip.PrefixFrom(block.Addr(), prefixLen).String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no free /%d in %s", ErrNoSpaceAvailable, prefixLen, parentPrefix)
+}
+
+// planSplit returns the parent subnet and the free /newPrefix blocks SplitSubnet
+// would create in it, without writing anything
+func (s *ServiceLayer) planSplit(ctx context.Context, parentID string, newPrefix int) (*repository.Subnet, []netip.Prefix, error) {
+	parent, err := s.subnetRepo.GetSubnetByID(ctx, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parentPrefix, err := netip.ParsePrefix(parent.CIDR)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid parent CIDR %s: %w", parent.CIDR, err)
+	}
+	parentPrefix = parentPrefix.Masked()
+
+	if err := validateChildPrefixLength(parentPrefix, newPrefix); err != nil {
+		return nil, nil, err
+	}
+
+	maxBlocks := s.options.MaxSplitSubnets
+	if maxBlocks <= 0 {
+		maxBlocks = DefaultMaxSplitSubnets
+	}
+	if blocks := splitBlockCount(parentPrefix, newPrefix); blocks > maxBlocks {
+		return nil, nil, &LimitError{Field: "split subnets", Count: blocks, Max: maxBlocks}
+	}
+
+	children, err := s.subnetRepo.GetSubnetChildren(ctx, parentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load child subnets: %w", err)
+	}
+	var taken netipx.IPSetBuilder
+	for _, child := range children {
+		childPrefix, err := netip.ParsePrefix(child.CIDR)
+		if err != nil {
+			continue
+		}
+		taken.AddPrefix(childPrefix.Masked())
+	}
+	takenSet, err := taken.IPSet()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build child address set: %w", err)
+	}
+
+	var blocks []netip.Prefix
+	for addr := parentPrefix.Addr(); addr.IsValid() && parentPrefix.Contains(addr); {
+		block := netip.PrefixFrom(addr, newPrefix)
+		if !takenSet.OverlapsPrefix(block) {
+			blocks = append(blocks, block)
+		}
+		addr = netipx.PrefixLastIP(block).Next()
+	}
+
+	if len(blocks) == 0 {
+		return nil, nil, fmt.Errorf("%w: every /%d in %s overlaps an existing child", ErrNoSpaceAvailable, newPrefix, parentPrefix)
+	}
+	return parent, blocks, nil
+}
+
+// PreviewSplit returns the child CIDRs SplitSubnet would create for the same
+// arguments, without persisting them
+func (s *ServiceLayer) PreviewSplit(ctx context.Context, parentID string, newPrefix int) ([]string, error) {
+	_, blocks, err := s.planSplit(ctx, parentID, newPrefix)
+	if err != nil {
+		return nil, err
+	}
+	cidrs := make([]string, len(blocks))
+	for i, block := range blocks {
+		cidrs[i] = block.String()
+	}
+	return cidrs, nil
+}
+
+// SplitSubnet carves the parent subnet into every block of length newPrefix it
+// contains and creates them as its children in a single transaction. Blocks
+// overlapping existing children are skipped. The split is rejected when it
+// would cover more blocks than the configured cap.
+func (s *ServiceLayer) SplitSubnet(ctx context.Context, parentID string, newPrefix int) ([]*repository.Subnet, error) {
+	parent, blocks, err := s.planSplit(ctx, parentID, newPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	subnets := make([]*repository.Subnet, 0, len(blocks))
+	for _, block := range blocks {
+		subnets = append(subnets, &repository.Subnet{
+			ID:           uuid.New().String(),
+			Name:         block.String(),
+			CIDR:         block.String(),
+			Location:     parent.Location,
+			LocationType: parent.LocationType,
+			Environment:  parent.Environment,
+			ParentID:     parent.ID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		})
+	}
+
+	for _, subnet := range subnets {
+		if err := s.prepareSubnet(ctx, subnet, CreateSubnetOptions{}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.subnetRepo.BulkCreateSubnets(ctx, subnets); err != nil {
+		return nil, err
+	}
+
+	for _, subnet := range subnets {
+		s.publish(events.SubnetCreated, subnet.ID)
+	}
+	s.refreshParentUtilization(ctx, parent.ID)
+	return subnets, nil
+}
+
+// splitBlockCount returns the number of /prefixLen blocks in parent, saturating
+// at math.MaxInt for splits too large to count
+func splitBlockCount(parent netip.Prefix, prefixLen int) int {
+	shift := prefixLen - parent.Bits()
+	if shift >= bits.UintSize-1 {
+		return math.MaxInt
+	}
+	return 1 << shift
+}
+
+// RenumberSubnet moves a subnet to newCIDR, a block of the same prefix length,
+// and shifts every subnet below it, and their DHCP ranges, by the same offset.
+// All subnets are updated together. The renumbering is rejected when the new
+// block overlaps other subnets in the location, falls outside the subnet's
+// parent, or any subnet in the tree has allocated addresses or reserved ranges
+// that would be left behind. It returns the renumbered subnets, starting with the subnet itself.
+func (s *ServiceLayer) RenumberSubnet(ctx context.Context, id, newCIDR string) ([]*repository.Subnet, error) {
+	unlock := repository.LockSubnet(id)
+	defer unlock()
+
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	// Initialize utilization
-	if subnet.Utilization == nil {
-		subnet.Utilization = &repository.Utilization{
-			TotalIPs:           details.HostsPerNet,
-			AllocatedIPs:       0,
-			UtilizationPercent: 0.0,
-			LastUpdated:        time.Now(),
+	if err := s.ipService.ValidateCIDR(newCIDR); err != nil {
+		return nil, fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	newBase, err := netip.ParsePrefix(newCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR notation: %w", err)
+	}
+	oldBase, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet CIDR %s: %w", subnet.CIDR, err)
+	}
+	newBase, oldBase = newBase.Masked(), oldBase.Masked()
+
+	switch {
+	case oldBase.Addr().Is4() != newBase.Addr().Is4():
+		return nil, fmt.Errorf("%w: %s and %s are different address families", ErrInvalidRenumber, oldBase, newBase)
+	case oldBase.Bits() != newBase.Bits():
+		return nil, fmt.Errorf("%w: %s must have the same prefix length as %s", ErrInvalidRenumber, newBase, oldBase)
+	case oldBase == newBase:
+		return nil, fmt.Errorf("%w: subnet is already %s", ErrInvalidRenumber, newBase)
+	}
+
+	if subnet.ParentID != "" {
+		moved := *subnet
+		moved.CIDR = newBase.String()
+		if err := s.validateChildContainment(ctx, &moved); err != nil {
+			return nil, err
+		}
+	}
+
+	// Blocks of equal length are either identical or disjoint, so the tree
+	// cannot overlap itself and only other subnets need checking
+	if err := s.checkOverlap(ctx, newBase.String(), subnet.Location, subnet.ParentID); err != nil {
+		return nil, err
+	}
+
+	tree, err := s.collectSubtree(ctx, subnet, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	updates := make([]*repository.CIDRUpdate, 0, len(tree))
+	for _, member := range tree {
+		allocations, err := s.subnetRepo.ListAllocations(ctx, member.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list allocations of subnet %s: %w", member.ID, err)
+		}
+		if len(allocations) > 0 {
+			return nil, fmt.Errorf("%w: subnet %s has %d allocated address(es); release them before renumbering", ErrInvalidRenumber, member.ID, len(allocations))
+		}
+		reservations, err := s.subnetRepo.ListReservedRanges(ctx, member.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list reserved ranges of subnet %s: %w", member.ID, err)
+		}
+		if len(reservations) > 0 {
+			return nil, fmt.Errorf("%w: subnet %s has %d reserved range(s); delete them before renumbering", ErrInvalidRenumber, member.ID, len(reservations))
+		}
+
+		prefix, err := netip.ParsePrefix(member.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s on subnet %s: %w", member.CIDR, member.ID, err)
 		}
+		prefix = prefix.Masked()
+		if !oldBase.Contains(prefix.Addr()) {
+			return nil, fmt.Errorf("%w: subnet %s (%s) lies outside %s", ErrInvalidRenumber, member.ID, prefix, oldBase)
+		}
+
+		member.CIDR = netip.PrefixFrom(rebaseAddr(prefix.Addr(), newBase), prefix.Bits()).String()
+		if member.Details, err = s.calculateDetails(member.CIDR); err != nil {
+			return nil, err
+		}
+		if member.DHCPRangeStart != "" && member.DHCPRangeEnd != "" {
+			start, startErr := netip.ParseAddr(member.DHCPRangeStart)
+			end, endErr := netip.ParseAddr(member.DHCPRangeEnd)
+			if startErr == nil && endErr == nil {
+				member.DHCPRangeStart = rebaseAddr(start, newBase).String()
+				member.DHCPRangeEnd = rebaseAddr(end, newBase).String()
+			}
+		}
+		member.UpdatedAt = now
+
+		updates = append(updates, &repository.CIDRUpdate{
+			SubnetID:       member.ID,
+			CIDR:           member.CIDR,
+			Details:        member.Details,
+			DHCPRangeStart: member.DHCPRangeStart,
+			DHCPRangeEnd:   member.DHCPRangeEnd,
+			UpdatedAt:      now,
+		})
+	}
+
+	if err := s.subnetRepo.RenumberSubnets(ctx, updates); err != nil {
+		return nil, err
 	}
 
-	return s.subnetRepo.CreateSubnet(ctx, subnet)
+	// Child summaries omit some fields, so return the stored subnets where they can be read
+	for i, member := range tree {
+		s.publish(events.SubnetUpdated, member.ID)
+		if stored, err := s.subnetRepo.GetSubnetByID(ctx, member.ID); err == nil {
+			tree[i] = stored
+		}
+	}
+	return tree, nil
 }
 
-// GetSubnetRepository retrieves a subnet by ID using repository models
-func (s *ServiceLayer) GetSubnetRepository(ctx context.Context, id string) (*repository.Subnet, error) {
-	return s.subnetRepo.GetSubnetByID(ctx, id)
+// collectSubtree returns subnet followed by all of its descendants. visited
+// guards against a corrupted hierarchy looping back on itself.
+func (s *ServiceLayer) collectSubtree(ctx context.Context, subnet *repository.Subnet, visited map[string]bool) ([]*repository.Subnet, error) {
+	if visited[subnet.ID] {
+		return nil, nil
+	}
+	visited[subnet.ID] = true
+
+	children, err := s.subnetRepo.GetSubnetChildren(ctx, subnet.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get children of subnet %s: %w", subnet.ID, err)
+	}
+
+	tree := []*repository.Subnet{subnet}
+	for _, child := range children {
+		descendants, err := s.collectSubtree(ctx, child, visited)
+		if err != nil {
+			return nil, err
+		}
+		tree = append(tree, descendants...)
+	}
+	return tree, nil
+}
+
+// rebaseAddr replaces the leading bits of addr with those of base, moving an
+// address from one block to the same offset in another block of equal length
+func rebaseAddr(addr netip.Addr, base netip.Prefix) netip.Addr {
+	bytes, baseBytes := addr.As16(), base.Addr().As16()
+	bits := base.Bits()
+	if addr.Is4() {
+		bits += 96 // Skip the IPv4-mapped prefix
+	}
+
+	for i := 0; bits > 0; i++ {
+		mask := byte(0xff)
+		if bits < 8 {
+			mask <<= 8 - bits
+		}
+		bytes[i] = baseBytes[i]&mask | bytes[i]&^mask
+		bits -= 8
+	}
+
+	rebased := netip.AddrFrom16(bytes)
+	if addr.Is4() {
+		return rebased.Unmap()
+	}
+	return rebased
 }
 
 // isSpecialDestination checks if a target subnet ID is a special destination (not a real subnet)
@@ -381,6 +2316,15 @@ func isSpecialDestination(targetID string) bool {
 
 // CreateConnection creates a new connection between subnets
 func (s *ServiceLayer) CreateConnection(ctx context.Context, connection *repository.Connection) error {
+	// Validate that source and target are different
+	if connection.SourceSubnetID == connection.TargetSubnetID {
+		return ErrSameSubnet
+	}
+
+	if err := s.validateConnectionMetadata(connection.Metadata); err != nil {
+		return err
+	}
+
 	// Validate that source subnet exists
 	_, err := s.subnetRepo.GetSubnetByID(ctx, connection.SourceSubnetID)
 	if err != nil {
@@ -395,13 +2339,12 @@ func (s *ServiceLayer) CreateConnection(ctx context.Context, connection *reposit
 		}
 	}
 
-	// Validate that source and target are different
-	if connection.SourceSubnetID == connection.TargetSubnetID {
-		return fmt.Errorf("source and target subnets cannot be the same")
+	if err := s.checkDuplicateConnection(ctx, connection.SourceSubnetID, connection.TargetSubnetID, connection.ConnectionType, ""); err != nil {
+		return err
 	}
 
 	// Set timestamps
-	now := time.Now()
+	now := s.now()
 	connection.CreatedAt = now
 	connection.UpdatedAt = now
 
@@ -410,7 +2353,12 @@ func (s *ServiceLayer) CreateConnection(ctx context.Context, connection *reposit
 		connection.Status = "active"
 	}
 
-	return s.subnetRepo.CreateConnection(ctx, connection)
+	if err := s.subnetRepo.CreateConnection(ctx, connection); err != nil {
+		return err
+	}
+
+	s.publish(events.ConnectionCreated, connection.ID)
+	return nil
 }
 
 // GetConnection retrieves a connection by ID
@@ -455,15 +2403,114 @@ func (s *ServiceLayer) UpdateConnection(ctx context.Context, id string, connecti
 	}
 
 	if sourceID == targetID {
-		return fmt.Errorf("source and target subnets cannot be the same")
+		return ErrSameSubnet
+	}
+
+	if err := s.validateConnectionMetadata(connection.Metadata); err != nil {
+		return err
+	}
+
+	connectionType := connection.ConnectionType
+	if connectionType == "" {
+		connectionType = existing.ConnectionType
+	}
+	if sourceID != existing.SourceSubnetID || targetID != existing.TargetSubnetID || connectionType != existing.ConnectionType {
+		if err := s.checkDuplicateConnection(ctx, sourceID, targetID, connectionType, id); err != nil {
+			return err
+		}
 	}
 
 	// Update timestamp
-	connection.UpdatedAt = time.Now()
+	connection.UpdatedAt = s.now()
 
 	return s.subnetRepo.UpdateConnection(ctx, id, connection)
 }
 
+// checkDuplicateConnection rejects a connection of connectionType from
+// sourceID to targetID when another one, other than ignoreID, already links
+// the pair. Undirected types also match the reverse direction.
+func (s *ServiceLayer) checkDuplicateConnection(ctx context.Context, sourceID, targetID, connectionType, ignoreID string) error {
+	pairs := [][2]string{{sourceID, targetID}}
+	if slices.Contains(s.options.UndirectedConnectionTypes, connectionType) {
+		pairs = append(pairs, [2]string{targetID, sourceID})
+	}
+
+	for _, pair := range pairs {
+		list, err := s.subnetRepo.ListConnections(ctx, repository.ConnectionFilters{
+			SourceSubnetID: pair[0],
+			TargetSubnetID: pair[1],
+			ConnectionType: connectionType,
+			PageSize:       2,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check for duplicate connections: %w", err)
+		}
+		for _, existing := range list.Connections {
+			if existing.ID != ignoreID && existing.ConnectionType == connectionType {
+				return fmt.Errorf("%w: %s connection %s already links %s and %s",
+					ErrDuplicateConnection, connectionType, existing.ID, existing.SourceSubnetID, existing.TargetSubnetID)
+			}
+		}
+	}
+	return nil
+}
+
+// validateConnectionMetadata checks connection metadata against the
+// configured schema, reporting the first offending key in sorted order
+func (s *ServiceLayer) validateConnectionMetadata(metadata map[string]interface{}) error {
+	schema := s.options.ConnectionMetadataSchema
+	if schema == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyType, ok := schema[key]
+		if !ok {
+			return fmt.Errorf("%w: key %q is not allowed", ErrInvalidConnectionMetadata, key)
+		}
+		if !metadataValueHasType(metadata[key], keyType) {
+			return fmt.Errorf("%w: key %q must be of type %s", ErrInvalidConnectionMetadata, key, keyType)
+		}
+	}
+
+	return nil
+}
+
+// metadataValueHasType reports whether a metadata value, as decoded from
+// JSON, is of a schema type
+func metadataValueHasType(value interface{}, keyType string) bool {
+	switch keyType {
+	case "any":
+		return true
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		switch value.(type) {
+		case float64, float32, int, int32, int64:
+			return true
+		}
+		return false
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	default:
+		return false
+	}
+}
+
 // DeleteConnection removes a connection
 func (s *ServiceLayer) DeleteConnection(ctx context.Context, id string) error {
 	return s.subnetRepo.DeleteConnection(ctx, id)
@@ -473,3 +2520,369 @@ func (s *ServiceLayer) DeleteConnection(ctx context.Context, id string) error {
 func (s *ServiceLayer) ListConnections(ctx context.Context, filters repository.ConnectionFilters) (*repository.ConnectionList, error) {
 	return s.subnetRepo.ListConnections(ctx, filters)
 }
+
+// ListSubnetConnections retrieves every connection where the subnet is the
+// source or the target, newest first
+func (s *ServiceLayer) ListSubnetConnections(ctx context.Context, subnetID string) ([]*repository.Connection, error) {
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	connections, err := s.subnetRepo.ListConnectionsForSubnet(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	if connections == nil {
+		connections = []*repository.Connection{}
+	}
+	return connections, nil
+}
+
+// Note methods
+
+// AddSubnetNote appends a timestamped note to a subnet
+func (s *ServiceLayer) AddSubnetNote(ctx context.Context, subnetID, author, text string) (*repository.SubnetNote, error) {
+	// Validate that the subnet exists
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("note text is required")
+	}
+
+	note := &repository.SubnetNote{
+		ID:        uuid.New().String(),
+		SubnetID:  subnetID,
+		Author:    author,
+		Text:      text,
+		CreatedAt: s.now(),
+	}
+
+	if err := s.subnetRepo.CreateSubnetNote(ctx, note); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// ListSubnetNotes retrieves the notes attached to a subnet, oldest first
+func (s *ServiceLayer) ListSubnetNotes(ctx context.Context, subnetID string) ([]*repository.SubnetNote, error) {
+	// Validate that the subnet exists
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	return s.subnetRepo.ListSubnetNotes(ctx, subnetID)
+}
+
+// GetSubnetNote retrieves a single note attached to a subnet
+func (s *ServiceLayer) GetSubnetNote(ctx context.Context, subnetID, noteID string) (*repository.SubnetNote, error) {
+	notes, err := s.ListSubnetNotes(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, note := range notes {
+		if note.ID == noteID {
+			return note, nil
+		}
+	}
+
+	return nil, fmt.Errorf("note %w", repository.ErrNotFound)
+}
+
+// IP allocation methods
+
+// AllocateIP records a specific IP address as allocated inside a subnet
+func (s *ServiceLayer) AllocateIP(ctx context.Context, subnetID, ip, hostname, description string) (*repository.IPAllocation, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidIP, ip)
+	}
+
+	unlock := repository.LockSubnet(subnetID)
+	defer unlock()
+
+	hostRange, allocated, err := s.subnetAllocations(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hostRange.Contains(addr) {
+		return nil, fmt.Errorf("%w: %s is not between %s and %s", ErrIPOutOfRange, addr, hostRange.From(), hostRange.To())
+	}
+	if allocated[addr] {
+		return nil, fmt.Errorf("%w: %s", ErrIPAlreadyAllocated, addr)
+	}
+
+	reserved, err := s.reservedAddresses(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	if reserved.Contains(addr) {
+		return nil, fmt.Errorf("%w: %s", ErrIPReserved, addr)
+	}
+
+	return s.recordAllocation(ctx, subnetID, addr, hostname, description)
+}
+
+// AllocateNextIP allocates the lowest free host address of a subnet, skipping
+// reserved ranges
+func (s *ServiceLayer) AllocateNextIP(ctx context.Context, subnetID, hostname, description string) (*repository.IPAllocation, error) {
+	unlock := repository.LockSubnet(subnetID)
+	defer unlock()
+
+	hostRange, allocated, err := s.subnetAllocations(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := s.reservedAddresses(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var b netipx.IPSetBuilder
+	b.AddRange(hostRange)
+	b.RemoveSet(reserved)
+	unreserved, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build free address set: %w", err)
+	}
+
+	// At most len(allocated) addresses are skipped before a free one is found
+	for _, r := range unreserved.Ranges() {
+		addr := r.From()
+		for allocated[addr] && addr != r.To() {
+			addr = addr.Next()
+		}
+		if !allocated[addr] {
+			return s.recordAllocation(ctx, subnetID, addr, hostname, description)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: every unreserved host address of subnet %s is allocated", ErrNoSpaceAvailable, subnetID)
+}
+
+// ReleaseIP frees an allocated IP address of a subnet
+func (s *ServiceLayer) ReleaseIP(ctx context.Context, subnetID, ip string) error {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrInvalidIP, ip)
+	}
+
+	unlock := repository.LockSubnet(subnetID)
+	defer unlock()
+
+	if err := s.subnetRepo.ReleaseIP(ctx, subnetID, addr.String()); err != nil {
+		return err
+	}
+
+	return s.refreshAllocatedIPs(ctx, subnetID)
+}
+
+// ListAllocations retrieves the IP allocations of a subnet
+func (s *ServiceLayer) ListAllocations(ctx context.Context, subnetID string) ([]*repository.IPAllocation, error) {
+	// Validate that the subnet exists
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	return s.subnetRepo.ListAllocations(ctx, subnetID)
+}
+
+// ListAllIPAllocations retrieves a page of IP allocations across all subnets
+func (s *ServiceLayer) ListAllIPAllocations(ctx context.Context, filters repository.IPAllocationFilters) (*repository.IPAllocationList, error) {
+	return s.subnetRepo.ListAllIPAllocations(ctx, filters)
+}
+
+// GetAllocation retrieves a single IP allocation of a subnet
+func (s *ServiceLayer) GetAllocation(ctx context.Context, subnetID, ip string) (*repository.IPAllocation, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidIP, ip)
+	}
+
+	allocations, err := s.ListAllocations(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, allocation := range allocations {
+		if allocation.IP == addr.String() {
+			return allocation, nil
+		}
+	}
+
+	return nil, fmt.Errorf("allocation %w", repository.ErrNotFound)
+}
+
+// subnetAllocations returns the host range of a subnet, from HostMin to HostMax,
+// and the set of addresses already allocated in it
+func (s *ServiceLayer) subnetAllocations(ctx context.Context, subnetID string) (netipx.IPRange, map[netip.Addr]bool, error) {
+	subnet, err := s.subnetRepo.GetSubnetByID(ctx, subnetID)
+	if err != nil {
+		return netipx.IPRange{}, nil, err
+	}
+
+	details, err := s.ipService.CalculateSubnetDetails(subnet.CIDR)
+	if err != nil {
+		return netipx.IPRange{}, nil, fmt.Errorf("failed to calculate subnet details: %w", err)
+	}
+
+	hostMin, errMin := netip.ParseAddr(details.HostMin)
+	hostMax, errMax := netip.ParseAddr(details.HostMax)
+	if errMin != nil || errMax != nil {
+		return netipx.IPRange{}, nil, fmt.Errorf("invalid host range %s-%s for subnet %s", details.HostMin, details.HostMax, subnetID)
+	}
+
+	allocations, err := s.subnetRepo.ListAllocations(ctx, subnetID)
+	if err != nil {
+		return netipx.IPRange{}, nil, err
+	}
+
+	allocated := make(map[netip.Addr]bool, len(allocations))
+	for _, allocation := range allocations {
+		if addr, err := netip.ParseAddr(allocation.IP); err == nil {
+			allocated[addr] = true
+		}
+	}
+
+	return netipx.IPRangeFrom(hostMin, hostMax), allocated, nil
+}
+
+// recordAllocation stores an allocation and refreshes the subnet's utilization.
+// Callers must hold the subnet lock.
+func (s *ServiceLayer) recordAllocation(ctx context.Context, subnetID string, addr netip.Addr, hostname, description string) (*repository.IPAllocation, error) {
+	allocation, err := s.subnetRepo.AllocateIP(ctx, subnetID, addr.String(), hostname, description)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.refreshAllocatedIPs(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	return allocation, nil
+}
+
+// UtilizationReport is an externally computed allocated IP count for one subnet
+type UtilizationReport struct {
+	SubnetID     string
+	AllocatedIPs int32
+}
+
+// BulkUpdateUtilization stores externally computed allocated IP counts and the
+// resulting utilization percentages. Every report is validated against its
+// subnet's total before anything is written, and the batch is applied in a
+// single repository transaction. Failures are returned as a
+// *repository.BulkUpdateError naming the offending report.
+func (s *ServiceLayer) BulkUpdateUtilization(ctx context.Context, reports []*UtilizationReport) error {
+	seen := make(map[string]bool, len(reports))
+	ids := make([]string, 0, len(reports))
+	for i, report := range reports {
+		if seen[report.SubnetID] {
+			return &repository.BulkUpdateError{Index: i, SubnetID: report.SubnetID, Err: fmt.Errorf("%w: subnet reported more than once", ErrInvalidUtilization)}
+		}
+		seen[report.SubnetID] = true
+		ids = append(ids, report.SubnetID)
+	}
+
+	// Lock in a stable order so concurrent batches cannot deadlock
+	sort.Strings(ids)
+	for _, id := range ids {
+		unlock := repository.LockSubnet(id)
+		defer unlock()
+	}
+
+	now := s.now()
+	updates := make([]*repository.UtilizationUpdate, len(reports))
+	var samples []*repository.UtilizationSample
+	for i, report := range reports {
+		subnet, err := s.subnetRepo.GetSubnetByID(ctx, report.SubnetID)
+		if err != nil {
+			return &repository.BulkUpdateError{Index: i, SubnetID: report.SubnetID, Err: err}
+		}
+
+		var total int32
+		if subnet.Utilization != nil {
+			total = subnet.Utilization.TotalIPs
+		}
+		if total == 0 && subnet.Details != nil {
+			total = subnet.Details.HostsPerNet
+		}
+		if report.AllocatedIPs < 0 || report.AllocatedIPs > total {
+			return &repository.BulkUpdateError{Index: i, SubnetID: report.SubnetID, Err: fmt.Errorf("%w: %d allocated IPs for a subnet with %d total", ErrInvalidUtilization, report.AllocatedIPs, total)}
+		}
+
+		update := &repository.UtilizationUpdate{SubnetID: report.SubnetID, AllocatedIPs: report.AllocatedIPs, UpdatedAt: now}
+		if total > 0 {
+			update.UtilizationPercent = float64(report.AllocatedIPs) / float64(total) * 100
+		}
+		updates[i] = update
+
+		if subnet.Utilization == nil || subnet.Utilization.AllocatedIPs != report.AllocatedIPs || subnet.Utilization.TotalIPs != total {
+			samples = append(samples, &repository.UtilizationSample{
+				SubnetID:     report.SubnetID,
+				Percent:      update.UtilizationPercent,
+				TotalIPs:     total,
+				AllocatedIPs: report.AllocatedIPs,
+			})
+		}
+	}
+
+	if err := s.subnetRepo.BulkUpdateUtilization(ctx, updates); err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		s.recordUtilization(ctx, sample)
+	}
+
+	return nil
+}
+
+// refreshAllocatedIPs recomputes AllocatedIps and UtilizationPercent of a subnet
+// from its recorded allocations. Callers must hold the subnet lock.
+func (s *ServiceLayer) refreshAllocatedIPs(ctx context.Context, subnetID string) error {
+	allocations, err := s.subnetRepo.ListAllocations(ctx, subnetID)
+	if err != nil {
+		return err
+	}
+
+	subnet, err := s.subnetRepo.FindByID(ctx, subnetID)
+	if err != nil {
+		return err
+	}
+
+	if subnet.Utilization == nil {
+		subnet.Utilization = &pb.UtilizationInfo{}
+	}
+	previousAllocated, previousTotal := subnet.Utilization.AllocatedIps, subnet.Utilization.TotalIps
+	if subnet.Details != nil && subnet.Details.HostsPerNet > 0 {
+		subnet.Utilization.TotalIps = subnet.Details.HostsPerNet
+	}
+
+	subnet.Utilization.AllocatedIps = int32(len(allocations))
+	subnet.Utilization.UtilizationPercent = 0
+	if subnet.Utilization.TotalIps > 0 {
+		subnet.Utilization.UtilizationPercent = float32(subnet.Utilization.AllocatedIps) / float32(subnet.Utilization.TotalIps) * 100
+	}
+	subnet.UpdatedAt = s.now().Unix()
+
+	if err := s.subnetRepo.Update(ctx, subnet); err != nil {
+		return fmt.Errorf("failed to update subnet utilization: %w", err)
+	}
+
+	if previousAllocated != subnet.Utilization.AllocatedIps || previousTotal != subnet.Utilization.TotalIps {
+		s.recordUtilization(ctx, &repository.UtilizationSample{
+			SubnetID:     subnetID,
+			Percent:      float64(subnet.Utilization.UtilizationPercent),
+			TotalIPs:     subnet.Utilization.TotalIps,
+			AllocatedIPs: subnet.Utilization.AllocatedIps,
+		})
+	}
+
+	return nil
+}
@@ -2,8 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bananaops/ipam-bananaops/internal/repository"
 	pb "github.com/bananaops/ipam-bananaops/proto"
@@ -213,6 +219,59 @@ func TestServiceLayerFullIntegration(t *testing.T) {
 		}
 	})
 
+	// Test 4b: Fresh details are recomputed from the CIDR, not read from storage
+	t.Run("GetSubnetFresh", func(t *testing.T) {
+		createResp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{
+			Cidr:         "10.30.0.0/24",
+			Name:         "Stale Details Subnet",
+			Location:     "datacenter-3",
+			LocationType: pb.LocationType_DATACENTER,
+		})
+		if err != nil || createResp.Error != nil {
+			t.Fatal("Failed to create subnet for fresh test")
+		}
+
+		// Corrupt the stored details
+		stale := createResp.Subnet
+		stale.Details.Netmask = "255.255.0.0"
+		stale.Details.Broadcast = "10.30.255.255"
+		stale.Details.HostsPerNet = 65534
+		if err := repo.Update(ctx, stale); err != nil {
+			t.Fatalf("Failed to store stale details: %v", err)
+		}
+
+		getReq := &pb.GetSubnetRequest{Id: stale.Id}
+		storedResp, err := serviceLayer.GetSubnet(ctx, getReq)
+		if err != nil || storedResp.Error != nil {
+			t.Fatal("GetSubnet failed")
+		}
+		if storedResp.Subnet.Details.Netmask != "255.255.0.0" {
+			t.Fatalf("Expected stored stale netmask, got %s", storedResp.Subnet.Details.Netmask)
+		}
+
+		freshResp, err := serviceLayer.GetSubnetFresh(ctx, getReq)
+		if err != nil {
+			t.Fatalf("GetSubnetFresh failed: %v", err)
+		}
+		if freshResp.Error != nil {
+			t.Fatalf("GetSubnetFresh returned error: %s", freshResp.Error.Message)
+		}
+
+		details := freshResp.Subnet.Details
+		if details.Netmask != "255.255.255.0" {
+			t.Errorf("Expected netmask 255.255.255.0, got %s", details.Netmask)
+		}
+		if details.Broadcast != "10.30.0.255" {
+			t.Errorf("Expected broadcast 10.30.0.255, got %s", details.Broadcast)
+		}
+		if details.HostsPerNet != 254 {
+			t.Errorf("Expected 254 hosts, got %d", details.HostsPerNet)
+		}
+		if freshResp.Subnet.Name != "Stale Details Subnet" {
+			t.Errorf("Expected stored fields to be kept, got name %s", freshResp.Subnet.Name)
+		}
+	})
+
 	// Test 5: Get non-existent subnet
 	t.Run("GetSubnetNotFound", func(t *testing.T) {
 		getReq := &pb.GetSubnetRequest{Id: "non-existent-id"}
@@ -432,4 +491,1877 @@ func TestServiceLayerFullIntegration(t *testing.T) {
 			t.Error("Expected private subnet")
 		}
 	})
+
+	// Test 11: Reject CIDRs overlapping an existing subnet in the same location
+	t.Run("CreateSubnetOverlapping", func(t *testing.T) {
+		resp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{
+			Cidr:         "10.10.1.0/24",
+			Name:         "Existing Subnet",
+			Location:     "datacenter-7",
+			LocationType: pb.LocationType_DATACENTER,
+		})
+		if err != nil || resp.Error != nil {
+			t.Fatalf("Failed to create existing subnet: %v %v", err, resp.Error)
+		}
+		existingID := resp.Subnet.Id
+
+		tests := []struct {
+			name     string
+			cidr     string
+			location string
+			wantCode string
+		}{
+			{"host inside existing /24", "10.10.1.42/32", "datacenter-7", "OVERLAPPING_CIDR"},
+			{"supernet of existing /24", "10.10.0.0/16", "datacenter-7", "OVERLAPPING_CIDR"},
+			{"identical CIDR is a duplicate", "10.10.1.0/24", "datacenter-7", "DUPLICATE_SUBNET"},
+			{"adjacent CIDR", "10.10.2.0/24", "datacenter-7", ""},
+			{"same CIDR in another location", "10.10.1.0/25", "datacenter-8", ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{
+					Cidr:         tt.cidr,
+					Name:         tt.name,
+					Location:     tt.location,
+					LocationType: pb.LocationType_DATACENTER,
+				})
+				if err != nil {
+					t.Fatalf("CreateSubnet failed: %v", err)
+				}
+
+				if tt.wantCode == "" {
+					if resp.Error != nil {
+						t.Fatalf("CreateSubnet returned error: %s", resp.Error.Message)
+					}
+					return
+				}
+
+				if resp.Error == nil {
+					t.Fatalf("Expected error code %s, got none", tt.wantCode)
+				}
+				if resp.Error.Code != tt.wantCode {
+					t.Errorf("Expected error code %s, got %s", tt.wantCode, resp.Error.Code)
+				}
+				if tt.wantCode == "OVERLAPPING_CIDR" && resp.Error.Details["subnet_ids"] != existingID {
+					t.Errorf("Expected offending subnet %s, got %q", existingID, resp.Error.Details["subnet_ids"])
+				}
+			})
+		}
+	})
+
+	// Test 12: Children created under their parent are not flagged against it
+	t.Run("CreateSubnetRepositoryInsideParent", func(t *testing.T) {
+		parent := &repository.Subnet{ID: "overlap-parent", CIDR: "10.20.0.0/16", Name: "Parent", Location: "datacenter-9"}
+		if err := serviceLayer.CreateSubnetRepository(ctx, parent); err != nil {
+			t.Fatalf("Failed to create parent: %v", err)
+		}
+
+		child := &repository.Subnet{ID: "overlap-child", CIDR: "10.20.1.0/24", Name: "Child", Location: "datacenter-9", ParentID: parent.ID}
+		if err := serviceLayer.CreateSubnetRepository(ctx, child); err != nil {
+			t.Fatalf("Failed to create child inside parent: %v", err)
+		}
+
+		sibling := &repository.Subnet{ID: "overlap-sibling", CIDR: "10.20.1.128/25", Name: "Sibling", Location: "datacenter-9", ParentID: parent.ID}
+		err := serviceLayer.CreateSubnetRepository(ctx, sibling)
+		var overlapErr *OverlapError
+		if !errors.As(err, &overlapErr) {
+			t.Fatalf("Expected OverlapError, got %v", err)
+		}
+		if len(overlapErr.SubnetIDs) != 1 || overlapErr.SubnetIDs[0] != child.ID {
+			t.Errorf("Expected offending subnet %s, got %v", child.ID, overlapErr.SubnetIDs)
+		}
+	})
+}
+
+// TestFindNextAvailableSubnet tests carving free child blocks out of a parent subnet
+func TestFindNextAvailableSubnet(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	subnets := []*repository.Subnet{
+		{ID: "parent", CIDR: "10.0.0.0/16", Name: "Parent"},
+		{ID: "child-a", CIDR: "10.0.0.0/24", Name: "Child A", ParentID: "parent"},
+		{ID: "child-b", CIDR: "10.0.1.0/24", Name: "Child B", ParentID: "parent"},
+		{ID: "child-c", CIDR: "10.0.3.0/24", Name: "Child C", ParentID: "parent"},
+		{ID: "full", CIDR: "192.168.0.0/24", Name: "Full"},
+		{ID: "full-low", CIDR: "192.168.0.0/25", Name: "Full Low", ParentID: "full"},
+		{ID: "full-high", CIDR: "192.168.0.128/25", Name: "Full High", ParentID: "full"},
+	}
+	for _, subnet := range subnets {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		parentID  string
+		prefixLen int
+		want      string
+		wantErr   error
+	}{
+		{"first gap between children", "parent", 24, "10.0.2.0/24", nil},
+		{"larger block skips the gap", "parent", 23, "10.0.4.0/23", nil},
+		{"small block fills the gap", "parent", 28, "10.0.2.0/28", nil},
+		{"parent without space", "full", 26, "", ErrNoSpaceAvailable},
+		{"prefix equal to parent", "parent", 16, "", ErrInvalidPrefixLength},
+		{"prefix beyond address length", "parent", 33, "", ErrInvalidPrefixLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serviceLayer.FindNextAvailableSubnet(ctx, tt.parentID, tt.prefixLen)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindNextAvailableSubnet failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := serviceLayer.FindNextAvailableSubnet(ctx, "missing", 24); err == nil {
+		t.Error("Expected error for missing parent, got nil")
+	}
+}
+
+// TestConnectionValidation tests the checks applied before connections are stored
+func TestConnectionValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "subnet-a", CIDR: "10.0.0.0/24", Name: "A"},
+		{ID: "subnet-b", CIDR: "10.0.1.0/24", Name: "B"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	t.Run("same source and target", func(t *testing.T) {
+		err := serviceLayer.CreateConnection(ctx, &repository.Connection{
+			ID: "conn-same", SourceSubnetID: "subnet-a", TargetSubnetID: "subnet-a", ConnectionType: "vpn", Name: "Loop",
+		})
+		if !errors.Is(err, ErrSameSubnet) {
+			t.Errorf("Expected ErrSameSubnet, got %v", err)
+		}
+	})
+
+	t.Run("missing target subnet", func(t *testing.T) {
+		err := serviceLayer.CreateConnection(ctx, &repository.Connection{
+			ID: "conn-missing", SourceSubnetID: "subnet-a", TargetSubnetID: "missing", ConnectionType: "vpn", Name: "Missing",
+		})
+		if err == nil || !strings.Contains(err.Error(), "subnet not found") {
+			t.Errorf("Expected subnet not found error, got %v", err)
+		}
+	})
+
+	t.Run("create with default status", func(t *testing.T) {
+		connection := &repository.Connection{
+			ID: "conn-1", SourceSubnetID: "subnet-a", TargetSubnetID: "subnet-b", ConnectionType: "vpn", Name: "Link",
+		}
+		if err := serviceLayer.CreateConnection(ctx, connection); err != nil {
+			t.Fatalf("Failed to create connection: %v", err)
+		}
+
+		stored, err := serviceLayer.GetConnection(ctx, "conn-1")
+		if err != nil {
+			t.Fatalf("Failed to get connection: %v", err)
+		}
+		if stored.Status != "active" {
+			t.Errorf("Expected default status active, got %s", stored.Status)
+		}
+	})
+
+	t.Run("update to same source and target", func(t *testing.T) {
+		err := serviceLayer.UpdateConnection(ctx, "conn-1", &repository.Connection{TargetSubnetID: "subnet-a"})
+		if !errors.Is(err, ErrSameSubnet) {
+			t.Errorf("Expected ErrSameSubnet, got %v", err)
+		}
+	})
+}
+
+// TestDuplicateConnections tests rejecting a second connection of the same
+// type between the same subnets, in both directions for undirected types
+func TestDuplicateConnections(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		UndirectedConnectionTypes: []string{"peering"},
+	})
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "subnet-a", CIDR: "10.0.0.0/24", Name: "A"},
+		{ID: "subnet-b", CIDR: "10.0.1.0/24", Name: "B"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	connect := func(id, source, target, connectionType string) error {
+		return serviceLayer.CreateConnection(ctx, &repository.Connection{
+			ID: id, SourceSubnetID: source, TargetSubnetID: target, ConnectionType: connectionType, Name: id,
+		})
+	}
+	for _, c := range []struct{ id, source, target, connectionType string }{
+		{"vpn-ab", "subnet-a", "subnet-b", "vpn"},
+		{"vpn-ba", "subnet-b", "subnet-a", "vpn"},
+		{"peering-ab", "subnet-a", "subnet-b", "peering"},
+		{"firewall-ab", "subnet-a", "subnet-b", "firewall"},
+	} {
+		if err := connect(c.id, c.source, c.target, c.connectionType); err != nil {
+			t.Fatalf("Failed to create connection %s: %v", c.id, err)
+		}
+	}
+
+	tests := []struct {
+		name                           string
+		source, target, connectionType string
+	}{
+		{"same directed connection", "subnet-a", "subnet-b", "vpn"},
+		{"same undirected connection", "subnet-a", "subnet-b", "peering"},
+		{"reversed undirected connection", "subnet-b", "subnet-a", "peering"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := connect("duplicate", tt.source, tt.target, tt.connectionType); !errors.Is(err, ErrDuplicateConnection) {
+				t.Errorf("Expected ErrDuplicateConnection, got %v", err)
+			}
+		})
+	}
+
+	t.Run("update into a duplicate", func(t *testing.T) {
+		err := serviceLayer.UpdateConnection(ctx, "firewall-ab", &repository.Connection{ConnectionType: "vpn"})
+		if !errors.Is(err, ErrDuplicateConnection) {
+			t.Errorf("Expected ErrDuplicateConnection, got %v", err)
+		}
+		if err := serviceLayer.UpdateConnection(ctx, "firewall-ab", &repository.Connection{Name: "Renamed"}); err != nil {
+			t.Errorf("Expected an update keeping the pair and type to succeed, got %v", err)
+		}
+	})
+}
+
+// TestConnectionMetadataSchema tests validating connection metadata against
+// the configured allowed keys
+func TestConnectionMetadataSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	for _, subnet := range []*repository.Subnet{
+		{ID: "subnet-a", CIDR: "10.0.0.0/24", Name: "A"},
+		{ID: "subnet-b", CIDR: "10.0.1.0/24", Name: "B"},
+	} {
+		if err := NewServiceLayer(repo, NewGoIPAMService(), nil).CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	enforced := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		ConnectionMetadataSchema: map[string]string{
+			"circuit_id": "string",
+			"vlan":       "number",
+			"redundant":  "boolean",
+			"labels":     "array",
+			"extra":      "any",
+		},
+	})
+	unenforced := NewServiceLayer(repo, NewGoIPAMService(), nil)
+
+	// Each connection gets its own type so that they do not duplicate each other
+	newConnection := func(id string, metadata map[string]interface{}) *repository.Connection {
+		return &repository.Connection{
+			ID: id, SourceSubnetID: "subnet-a", TargetSubnetID: "subnet-b", ConnectionType: "vpn-" + id, Name: id, Metadata: metadata,
+		}
+	}
+
+	t.Run("allowed keys", func(t *testing.T) {
+		metadata := map[string]interface{}{
+			"circuit_id": "CKT-42",
+			"vlan":       float64(100),
+			"redundant":  true,
+			"labels":     []interface{}{"a", "b"},
+			"extra":      map[string]interface{}{"free": "form"},
+		}
+		if err := enforced.CreateConnection(ctx, newConnection("conn-allowed", metadata)); err != nil {
+			t.Fatalf("Expected allowed metadata to be accepted, got %v", err)
+		}
+		update := newConnection("conn-allowed", map[string]interface{}{"vlan": float64(200)})
+		if err := enforced.UpdateConnection(ctx, "conn-allowed", update); err != nil {
+			t.Errorf("Expected allowed metadata to be accepted on update, got %v", err)
+		}
+	})
+
+	t.Run("disallowed keys", func(t *testing.T) {
+		err := enforced.CreateConnection(ctx, newConnection("conn-unknown", map[string]interface{}{"owner": "net-team"}))
+		if !errors.Is(err, ErrInvalidConnectionMetadata) || !strings.Contains(err.Error(), `"owner"`) {
+			t.Errorf("Expected ErrInvalidConnectionMetadata naming the key, got %v", err)
+		}
+
+		err = enforced.CreateConnection(ctx, newConnection("conn-type", map[string]interface{}{"vlan": "100"}))
+		if !errors.Is(err, ErrInvalidConnectionMetadata) || !strings.Contains(err.Error(), "number") {
+			t.Errorf("Expected ErrInvalidConnectionMetadata for the wrong type, got %v", err)
+		}
+
+		update := newConnection("conn-allowed", map[string]interface{}{"owner": "net-team"})
+		if err := enforced.UpdateConnection(ctx, "conn-allowed", update); !errors.Is(err, ErrInvalidConnectionMetadata) {
+			t.Errorf("Expected ErrInvalidConnectionMetadata on update, got %v", err)
+		}
+
+		if _, err := enforced.GetConnection(ctx, "conn-unknown"); err == nil {
+			t.Error("Expected the rejected connection not to be created")
+		}
+	})
+
+	t.Run("schema disabled", func(t *testing.T) {
+		metadata := map[string]interface{}{"owner": "net-team", "vlan": "not a number"}
+		if err := unenforced.CreateConnection(ctx, newConnection("conn-free", metadata)); err != nil {
+			t.Errorf("Expected any metadata without a schema, got %v", err)
+		}
+	})
+
+	t.Run("empty schema allows no metadata", func(t *testing.T) {
+		strict := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+			ConnectionMetadataSchema: map[string]string{},
+		})
+		if err := strict.CreateConnection(ctx, newConnection("conn-bare", nil)); err != nil {
+			t.Errorf("Expected a connection without metadata, got %v", err)
+		}
+		err := strict.CreateConnection(ctx, newConnection("conn-strict", map[string]interface{}{"vlan": float64(1)}))
+		if !errors.Is(err, ErrInvalidConnectionMetadata) {
+			t.Errorf("Expected ErrInvalidConnectionMetadata, got %v", err)
+		}
+	})
+}
+
+// TestIPAllocations tests allocating and releasing individual IPs inside a subnet
+func TestIPAllocations(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	subnet := &repository.Subnet{ID: "hosts", CIDR: "192.168.10.0/30", Name: "Hosts", Location: "datacenter-1"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	assertUtilization := func(t *testing.T, allocated int32, percent float32) {
+		t.Helper()
+		found, err := repo.FindByID(ctx, subnet.ID)
+		if err != nil {
+			t.Fatalf("Failed to find subnet: %v", err)
+		}
+		if found.Utilization.AllocatedIps != allocated || found.Utilization.UtilizationPercent != percent {
+			t.Errorf("Expected %d allocated at %.0f%%, got %d at %.0f%%",
+				allocated, percent, found.Utilization.AllocatedIps, found.Utilization.UtilizationPercent)
+		}
+	}
+
+	t.Run("next IP starts at HostMin", func(t *testing.T) {
+		allocation, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", "gateway")
+		if err != nil {
+			t.Fatalf("AllocateNextIP failed: %v", err)
+		}
+		if allocation.IP != "192.168.10.1" || allocation.Description != "gateway" {
+			t.Errorf("Expected 192.168.10.1, got %+v", allocation)
+		}
+		assertUtilization(t, 1, 50)
+	})
+
+	t.Run("reject invalid, out of range and duplicate IPs", func(t *testing.T) {
+		tests := []struct {
+			ip      string
+			wantErr error
+		}{
+			{"not-an-ip", ErrInvalidIP},
+			{"192.168.10.0", ErrIPOutOfRange},
+			{"192.168.10.3", ErrIPOutOfRange},
+			{"10.0.0.1", ErrIPOutOfRange},
+			{"192.168.10.1", ErrIPAlreadyAllocated},
+		}
+		for _, tt := range tests {
+			if _, err := serviceLayer.AllocateIP(ctx, subnet.ID, tt.ip, "", ""); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AllocateIP(%s): expected %v, got %v", tt.ip, tt.wantErr, err)
+			}
+		}
+	})
+
+	t.Run("subnet full", func(t *testing.T) {
+		if _, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", ""); err != nil {
+			t.Fatalf("AllocateNextIP failed: %v", err)
+		}
+		assertUtilization(t, 2, 100)
+
+		if _, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", ""); !errors.Is(err, ErrNoSpaceAvailable) {
+			t.Errorf("Expected ErrNoSpaceAvailable, got %v", err)
+		}
+	})
+
+	t.Run("release frees the address", func(t *testing.T) {
+		if err := serviceLayer.ReleaseIP(ctx, subnet.ID, "192.168.10.1"); err != nil {
+			t.Fatalf("ReleaseIP failed: %v", err)
+		}
+		assertUtilization(t, 1, 50)
+
+		allocation, err := serviceLayer.AllocateNextIP(ctx, subnet.ID, "", "")
+		if err != nil {
+			t.Fatalf("AllocateNextIP failed: %v", err)
+		}
+		if allocation.IP != "192.168.10.1" {
+			t.Errorf("Expected released 192.168.10.1 to be reused, got %s", allocation.IP)
+		}
+	})
+
+	t.Run("missing subnet", func(t *testing.T) {
+		if _, err := serviceLayer.AllocateNextIP(ctx, "missing", "", ""); err == nil || !strings.Contains(err.Error(), "subnet not found") {
+			t.Errorf("Expected subnet not found, got %v", err)
+		}
+	})
+}
+
+// TestRecalculateParentUtilization tests aggregating child address space into
+// the parent's prefix utilization, next to its unchanged IP-based utilization
+func TestRecalculateParentUtilization(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	assertParentUtilization := func(t *testing.T, want float64) {
+		t.Helper()
+		parent, err := repo.GetSubnetByID(ctx, "vpc")
+		if err != nil {
+			t.Fatalf("Failed to find parent: %v", err)
+		}
+		if parent.Utilization.PrefixUtilizationPercent != want {
+			t.Errorf("Expected parent prefix utilization %v%%, got %v%%", want, parent.Utilization.PrefixUtilizationPercent)
+		}
+		if parent.Utilization.UtilizationPercent != 25 {
+			t.Errorf("Expected IP-based utilization to stay 25%%, got %v%%", parent.Utilization.UtilizationPercent)
+		}
+	}
+
+	if err := serviceLayer.CreateSubnetRepository(ctx, &repository.Subnet{ID: "vpc", CIDR: "10.0.0.0/16", Name: "VPC"}); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+	if err := repo.BulkUpdateUtilization(ctx, []*repository.UtilizationUpdate{{SubnetID: "vpc", AllocatedIPs: 16384, UtilizationPercent: 25}}); err != nil {
+		t.Fatalf("Failed to set parent IP utilization: %v", err)
+	}
+
+	t.Run("recalculated on child creation", func(t *testing.T) {
+		child := &repository.Subnet{ID: "child-a", CIDR: "10.0.0.0/24", Name: "A", ParentID: "vpc"}
+		if err := serviceLayer.CreateSubnetRepository(ctx, child); err != nil {
+			t.Fatalf("Failed to create child: %v", err)
+		}
+		assertParentUtilization(t, 256.0/65536*100)
+	})
+
+	t.Run("overlapping children counted once", func(t *testing.T) {
+		// Written directly since the service rejects overlapping siblings
+		for _, child := range []*repository.Subnet{
+			{ID: "child-b", CIDR: "10.0.0.0/23", Name: "B", ParentID: "vpc"},
+			{ID: "child-c", CIDR: "10.0.2.0/24", Name: "C", ParentID: "vpc"},
+			{ID: "stray", CIDR: "192.168.0.0/24", Name: "Outside parent", ParentID: "vpc"},
+		} {
+			if err := repo.CreateSubnet(ctx, child); err != nil {
+				t.Fatalf("Failed to create child %s: %v", child.ID, err)
+			}
+		}
+
+		if err := serviceLayer.RecalculateParentUtilization(ctx, "vpc"); err != nil {
+			t.Fatalf("RecalculateParentUtilization failed: %v", err)
+		}
+		assertParentUtilization(t, 768.0/65536*100)
+	})
+
+	t.Run("recalculated on child deletion", func(t *testing.T) {
+		resp, err := serviceLayer.DeleteSubnet(ctx, &pb.DeleteSubnetRequest{Id: "child-c"})
+		if err != nil || !resp.Success {
+			t.Fatalf("Failed to delete child: %v %v", err, resp.GetError())
+		}
+		assertParentUtilization(t, 512.0/65536*100)
+	})
+
+	t.Run("missing parent", func(t *testing.T) {
+		if err := serviceLayer.RecalculateParentUtilization(ctx, "missing"); err == nil {
+			t.Error("Expected error for missing parent, got nil")
+		}
+	})
+}
+
+func TestSubnetTagLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{MaxTagsPerSubnet: 2})
+	ctx := context.Background()
+
+	atLimit := &repository.Subnet{ID: "at-limit", CIDR: "10.20.0.0/24", Name: "At limit", Location: "datacenter-1",
+		Tags: map[string]string{"env": "prod", "team": "netops"}}
+	if err := serviceLayer.CreateSubnetRepository(ctx, atLimit); err != nil {
+		t.Fatalf("Expected subnet at the tag limit to be created, got %v", err)
+	}
+
+	overLimit := &repository.Subnet{ID: "over-limit", CIDR: "10.20.1.0/24", Name: "Over limit", Location: "datacenter-1",
+		Tags: map[string]string{"env": "prod", "team": "netops", "cost-center": "42"}}
+	err = serviceLayer.CreateSubnetRepository(ctx, overLimit)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected LimitError, got %v", err)
+	}
+	if limitErr.Field != "tags" || limitErr.Count != 3 || limitErr.Max != 2 {
+		t.Errorf("Unexpected limit error: %+v", limitErr)
+	}
+	if _, err := repo.GetSubnetByID(ctx, overLimit.ID); err == nil {
+		t.Error("Expected rejected subnet not to be stored")
+	}
+
+	unlimited := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	if err := unlimited.CreateSubnetRepository(ctx, overLimit); err != nil {
+		t.Errorf("Expected no tag limit by default, got %v", err)
+	}
+}
+
+func TestCreateSubnetChildContainment(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	parent := &repository.Subnet{ID: "parent", CIDR: "192.168.0.0/16", Name: "Parent", Location: "datacenter-1"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, parent); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cidr    string
+		wantErr bool
+	}{
+		{name: "valid nesting", cidr: "192.168.1.0/24"},
+		{name: "out of range child", cidr: "10.5.0.0/24", wantErr: true},
+		{name: "equal prefix child", cidr: "192.168.0.0/16", wantErr: true},
+		{name: "shorter prefix child", cidr: "192.0.0.0/8", wantErr: true},
+		{name: "other address family", cidr: "2001:db8::/64", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			child := &repository.Subnet{
+				ID:       fmt.Sprintf("child-%d", i),
+				CIDR:     tt.cidr,
+				Name:     tt.name,
+				Location: "datacenter-1",
+				ParentID: parent.ID,
+			}
+			err := serviceLayer.CreateSubnetRepository(ctx, child)
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected child to be created, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrChildNotContained) {
+				t.Fatalf("Expected ErrChildNotContained, got %v", err)
+			}
+			if _, err := repo.GetSubnetByID(ctx, child.ID); err == nil {
+				t.Error("Expected rejected child not to be stored")
+			}
+		})
+	}
+}
+
+func TestCreateSubnetSiblingOverlap(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(t *testing.T, options ServiceOptions) *ServiceLayer {
+		repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+
+		serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, options)
+		subnets := []*repository.Subnet{
+			{ID: "parent", CIDR: "10.0.0.0/16", Name: "Parent", Location: "datacenter-1"},
+			{ID: "first", CIDR: "10.0.0.0/25", Name: "First", Location: "datacenter-1", ParentID: "parent"},
+		}
+		for _, subnet := range subnets {
+			if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+				t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+			}
+		}
+		return serviceLayer
+	}
+
+	t.Run("rejects overlapping siblings", func(t *testing.T) {
+		serviceLayer := newService(t, ServiceOptions{})
+
+		nested := &repository.Subnet{ID: "nested", CIDR: "10.0.0.0/26", Name: "Nested", Location: "datacenter-2", ParentID: "parent"}
+		err := serviceLayer.CreateSubnetRepository(ctx, nested)
+		var siblingErr *SiblingOverlapError
+		if !errors.As(err, &siblingErr) {
+			t.Fatalf("Expected SiblingOverlapError, got %v", err)
+		}
+		if siblingErr.ParentID != "parent" || len(siblingErr.SubnetIDs) != 1 || siblingErr.SubnetIDs[0] != "first" {
+			t.Errorf("Expected first under parent to be reported, got %+v", siblingErr)
+		}
+
+		adjacent := &repository.Subnet{ID: "adjacent", CIDR: "10.0.0.128/25", Name: "Adjacent", Location: "datacenter-2", ParentID: "parent"}
+		if err := serviceLayer.CreateSubnetRepository(ctx, adjacent); err != nil {
+			t.Errorf("Expected a non-overlapping sibling to be created, got %v", err)
+		}
+	})
+
+	t.Run("allows overlapping siblings in other locations when configured", func(t *testing.T) {
+		serviceLayer := newService(t, ServiceOptions{AllowSiblingOverlap: true})
+
+		nested := &repository.Subnet{ID: "nested", CIDR: "10.0.0.0/26", Name: "Nested", Location: "datacenter-2", ParentID: "parent"}
+		if err := serviceLayer.CreateSubnetRepository(ctx, nested); err != nil {
+			t.Errorf("Expected the sibling in another location to be created, got %v", err)
+		}
+
+		local := &repository.Subnet{ID: "local", CIDR: "10.0.0.64/26", Name: "Local", Location: "datacenter-1", ParentID: "parent"}
+		var overlapErr *OverlapError
+		if err := serviceLayer.CreateSubnetRepository(ctx, local); !errors.As(err, &overlapErr) {
+			t.Errorf("Expected OverlapError within the location, got %v", err)
+		}
+	})
+}
+
+func TestUpdateSubnetExplicitEmptyFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	fields := []struct {
+		name string
+		get  func(*pb.Subnet) string
+	}{
+		{name: UpdateFieldDescription, get: func(s *pb.Subnet) string { return s.Description }},
+		{name: UpdateFieldLocation, get: func(s *pb.Subnet) string { return s.Location }},
+	}
+
+	named := func(s *pb.Subnet) string { return s.Name }
+	var id string
+	for i, field := range fields {
+		createResp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{
+			Cidr:        fmt.Sprintf("10.90.%d.0/24", i),
+			Name:        "Named",
+			Description: "Described",
+			Location:    "datacenter-1",
+		})
+		if err != nil || createResp.Error != nil {
+			t.Fatalf("Failed to create subnet: %v %v", err, createResp.GetError())
+		}
+		id = createResp.Subnet.Id
+
+		// Omitted: an empty value without presence leaves the field unchanged
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id}, UpdateSubnetOptions{})
+		if err != nil || resp.Error != nil {
+			t.Fatalf("Update failed: %v %v", err, resp.GetError())
+		}
+		if field.get(resp.Subnet) == "" {
+			t.Errorf("Expected omitted %s to be kept", field.name)
+		}
+
+		// Explicitly empty: the field is cleared and the others are kept
+		opts := UpdateSubnetOptions{SetFields: UpdateFieldSet{field.name: true}}
+		resp, err = serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id}, opts)
+		if err != nil || resp.Error != nil {
+			t.Fatalf("Update failed: %v %v", err, resp.GetError())
+		}
+		stored, err := repo.FindByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to reload subnet: %v", err)
+		}
+		for _, other := range fields {
+			got := other.get(stored)
+			if other.name == field.name && got != "" {
+				t.Errorf("Expected explicit empty %s to clear it, got %q", field.name, got)
+			}
+			if other.name != field.name && got == "" {
+				t.Errorf("Clearing %s also cleared %s", field.name, other.name)
+			}
+		}
+		if named(stored) == "" {
+			t.Errorf("Clearing %s also cleared the name", field.name)
+		}
+	}
+
+	// The name is required: an explicitly empty one is rejected, not applied
+	opts := UpdateSubnetOptions{SetFields: UpdateFieldSet{UpdateFieldName: true}}
+	resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id}, opts)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if resp.GetError().GetCode() != "MISSING_FIELD" {
+		t.Errorf("Expected MISSING_FIELD for an empty name, got %v", resp.GetError())
+	}
+	if stored, err := repo.FindByID(ctx, id); err != nil || stored.Name != "Named" {
+		t.Errorf("Expected the name to be kept, got %v %v", stored, err)
+	}
+}
+
+func TestUpdateSubnetCIDRWithChildren(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	parent := &repository.Subnet{ID: "parent", CIDR: "10.60.0.0/16", Name: "Parent", Location: "datacenter-1"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, parent); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+	child := &repository.Subnet{ID: "child", CIDR: "10.60.200.0/24", Name: "Child", Location: "datacenter-1", ParentID: parent.ID}
+	if err := serviceLayer.CreateSubnetRepository(ctx, child); err != nil {
+		t.Fatalf("Failed to create child: %v", err)
+	}
+
+	update := func(cidr string, opts UpdateSubnetOptions) *pb.UpdateSubnetResponse {
+		t.Helper()
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: parent.ID, Cidr: cidr}, opts)
+		if err != nil {
+			t.Fatalf("UpdateSubnet failed: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("shrinking below a child is rejected", func(t *testing.T) {
+		resp := update("10.60.0.0/17", UpdateSubnetOptions{})
+		if resp.Error == nil || resp.Error.Code != "CHILDREN_OUT_OF_RANGE" {
+			t.Fatalf("Expected CHILDREN_OUT_OF_RANGE, got %+v", resp.Error)
+		}
+		if resp.Error.Details["subnet_ids"] != child.ID {
+			t.Errorf("Expected offending child %s, got %q", child.ID, resp.Error.Details["subnet_ids"])
+		}
+		stored, err := repo.GetSubnetByID(ctx, parent.ID)
+		if err != nil {
+			t.Fatalf("Failed to get parent: %v", err)
+		}
+		if stored.CIDR != "10.60.0.0/16" {
+			t.Errorf("Expected parent CIDR to be unchanged, got %s", stored.CIDR)
+		}
+	})
+
+	t.Run("enlarging around the children is allowed", func(t *testing.T) {
+		if resp := update("10.60.0.0/15", UpdateSubnetOptions{}); resp.Error != nil {
+			t.Fatalf("Expected enlarging to succeed, got %+v", resp.Error)
+		}
+	})
+
+	t.Run("force allows orphaning children", func(t *testing.T) {
+		if resp := update("10.60.0.0/17", UpdateSubnetOptions{Force: true}); resp.Error != nil {
+			t.Fatalf("Expected forced update to succeed, got %+v", resp.Error)
+		}
+	})
+}
+
+func TestGetSubnetPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	hierarchy := []*repository.Subnet{
+		{ID: "root", CIDR: "10.0.0.0/8", Name: "Root", Location: "datacenter-1"},
+		{ID: "mid", CIDR: "10.1.0.0/16", Name: "Mid", Location: "datacenter-1", ParentID: "root"},
+		{ID: "leaf", CIDR: "10.1.2.0/24", Name: "Leaf", Location: "datacenter-1", ParentID: "mid"},
+	}
+	for _, subnet := range hierarchy {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+		}
+	}
+
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{id: "root", want: []string{"10.0.0.0/8"}},
+		{id: "mid", want: []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		{id: "leaf", want: []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"}},
+	}
+	for _, tt := range tests {
+		path, err := serviceLayer.GetSubnetPath(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("GetSubnetPath(%s) failed: %v", tt.id, err)
+		}
+		if strings.Join(path, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("GetSubnetPath(%s) = %v, want %v", tt.id, path, tt.want)
+		}
+	}
+
+	if _, err := serviceLayer.GetSubnetPath(ctx, "missing"); err == nil {
+		t.Error("Expected an error for an unknown subnet")
+	}
+
+	t.Run("cyclic parent links terminate", func(t *testing.T) {
+		createSubnetCycle(t, repo)
+
+		path, err := serviceLayer.GetSubnetPath(ctx, "cycle-z")
+		if err != nil {
+			t.Fatalf("GetSubnetPath failed: %v", err)
+		}
+		if want := "172.16.0.0/24 172.16.1.0/24 172.16.2.0/24"; strings.Join(path, " ") != want {
+			t.Errorf("Expected %s, got %v", want, path)
+		}
+	})
+}
+
+func TestLookupSubnets(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "root", CIDR: "10.0.0.0/8", Name: "Root", Location: "datacenter-1"},
+		{ID: "mid", CIDR: "10.2.0.0/16", Name: "Mid", Location: "datacenter-1", ParentID: "root"},
+		{ID: "leaf", CIDR: "10.2.3.0/24", Name: "Leaf", Location: "datacenter-1", ParentID: "mid"},
+		{ID: "sibling", CIDR: "10.2.16.0/24", Name: "Sibling", Location: "datacenter-1", ParentID: "mid"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+		}
+	}
+
+	t.Run("by IP", func(t *testing.T) {
+		tests := []struct {
+			ip        string
+			want      string
+			ancestors int
+		}{
+			{ip: "10.2.3.4", want: "leaf", ancestors: 2},
+			{ip: "10.2.4.1", want: "mid", ancestors: 1},
+			{ip: "10.200.0.1", want: "root", ancestors: 0},
+		}
+		for _, tt := range tests {
+			lookup, err := serviceLayer.LookupByIP(ctx, tt.ip)
+			if err != nil {
+				t.Fatalf("LookupByIP(%s) failed: %v", tt.ip, err)
+			}
+			if lookup.Subnet.ID != tt.want || len(lookup.Ancestors) != tt.ancestors {
+				t.Errorf("LookupByIP(%s) = %s with %d ancestors, want %s with %d", tt.ip, lookup.Subnet.ID, len(lookup.Ancestors), tt.want, tt.ancestors)
+			}
+		}
+
+		if _, err := serviceLayer.LookupByIP(ctx, "192.168.1.1"); err == nil || !strings.Contains(err.Error(), "subnet not found") {
+			t.Errorf("Expected subnet not found, got %v", err)
+		}
+		if _, err := serviceLayer.LookupByIP(ctx, "10.2.3"); !errors.Is(err, ErrInvalidIP) {
+			t.Errorf("Expected ErrInvalidIP, got %v", err)
+		}
+	})
+
+	t.Run("by CIDR", func(t *testing.T) {
+		subnets, err := serviceLayer.FindContainedSubnets(ctx, "10.2.0.0/20")
+		if err != nil {
+			t.Fatalf("FindContainedSubnets failed: %v", err)
+		}
+		if len(subnets) != 1 || subnets[0].ID != "leaf" {
+			t.Errorf("Expected only the leaf within 10.2.0.0/20, got %v", subnets)
+		}
+
+		subnets, err = serviceLayer.FindContainedSubnets(ctx, "10.2.0.0/16")
+		if err != nil {
+			t.Fatalf("FindContainedSubnets failed: %v", err)
+		}
+		if len(subnets) != 3 || subnets[0].ID != "mid" || subnets[2].ID != "sibling" {
+			t.Errorf("Expected mid, leaf and sibling within 10.2.0.0/16, got %v", subnets)
+		}
+
+		if _, err := serviceLayer.FindContainedSubnets(ctx, "172.16.0.0/12"); err == nil || !strings.Contains(err.Error(), "subnet not found") {
+			t.Errorf("Expected subnet not found, got %v", err)
+		}
+		if _, err := serviceLayer.FindContainedSubnets(ctx, "10.2.0.0/40"); !errors.Is(err, ErrInvalidCIDR) {
+			t.Errorf("Expected ErrInvalidCIDR, got %v", err)
+		}
+	})
+}
+
+func TestWalkSubnets(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		subnet := &repository.Subnet{ID: fmt.Sprintf("subnet-%d", i), CIDR: fmt.Sprintf("10.90.%d.0/24", i), Name: "walk", Location: "datacenter-1"}
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet: %v", err)
+		}
+	}
+
+	var pages []int
+	seen := make(map[string]bool)
+	err = serviceLayer.WalkSubnets(ctx, 2, func(page []*repository.Subnet) error {
+		pages = append(pages, len(page))
+		for _, subnet := range page {
+			seen[subnet.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkSubnets failed: %v", err)
+	}
+	if fmt.Sprint(pages) != "[2 2 1]" {
+		t.Errorf("Expected pages of [2 2 1], got %v", pages)
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected all 5 subnets to be visited, got %d", len(seen))
+	}
+
+	stop := errors.New("stop")
+	if err := serviceLayer.WalkSubnets(ctx, 2, func([]*repository.Subnet) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("Expected the callback error to end the walk, got %v", err)
+	}
+}
+
+func TestGetSubnetTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "root", CIDR: "10.0.0.0/8", Name: "Root", Location: "datacenter-1"},
+		{ID: "b", CIDR: "10.20.0.0/16", Name: "B", Location: "datacenter-1", ParentID: "root"},
+		{ID: "a", CIDR: "10.3.0.0/16", Name: "A", Location: "datacenter-1", ParentID: "root"},
+		{ID: "a1", CIDR: "10.3.1.0/24", Name: "A1", Location: "datacenter-1", ParentID: "a"},
+		{ID: "other", CIDR: "172.16.0.0/12", Name: "Other", Location: "datacenter-1"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+		}
+	}
+
+	// describe renders a tree as id(descendants)[children...]
+	var describe func(node *SubnetTreeNode) string
+	describe = func(node *SubnetTreeNode) string {
+		out := fmt.Sprintf("%s(%d)", node.Subnet.ID, node.DescendantCount)
+		if len(node.Children) > 0 {
+			var children []string
+			for _, child := range node.Children {
+				children = append(children, describe(child))
+			}
+			out += "[" + strings.Join(children, " ") + "]"
+		}
+		return out
+	}
+
+	tree, err := serviceLayer.GetSubnetTree(ctx, "root")
+	if err != nil {
+		t.Fatalf("GetSubnetTree failed: %v", err)
+	}
+	if got, want := describe(tree), "root(3)[a(1)[a1(0)] b(0)]"; got != want {
+		t.Errorf("Expected tree %s, got %s", want, got)
+	}
+
+	if _, err := serviceLayer.GetSubnetTree(ctx, "missing"); err == nil {
+		t.Error("Expected an error for an unknown subnet")
+	}
+
+	t.Run("cyclic parent links are broken", func(t *testing.T) {
+		createSubnetCycle(t, repo)
+
+		tree, err := serviceLayer.GetSubnetTree(ctx, "cycle-x")
+		if err != nil {
+			t.Fatalf("GetSubnetTree failed: %v", err)
+		}
+		if got, want := describe(tree), "cycle-x(2)[cycle-y(1)[cycle-z(0)]]"; got != want {
+			t.Errorf("Expected tree %s, got %s", want, got)
+		}
+	})
+}
+
+// createSubnetCycle stores cycle-x -> cycle-y -> cycle-z -> cycle-x directly in
+// the repository, bypassing the service checks that would reject it
+func createSubnetCycle(t *testing.T, repo repository.SubnetRepository) {
+	t.Helper()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "cycle-x", CIDR: "172.16.0.0/24", Name: "X", Location: "datacenter-2", ParentID: "cycle-z"},
+		{ID: "cycle-y", CIDR: "172.16.1.0/24", Name: "Y", Location: "datacenter-2", ParentID: "cycle-x"},
+		{ID: "cycle-z", CIDR: "172.16.2.0/24", Name: "Z", Location: "datacenter-2", ParentID: "cycle-y"},
+	} {
+		if err := repo.CreateSubnet(context.Background(), subnet); err != nil {
+			t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+		}
+	}
+}
+
+func TestSubnetEnvironment(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, environment := range []string{"", "prod", "staging", "dev", "test"} {
+		if err := serviceLayer.ValidateEnvironment(environment); err != nil {
+			t.Errorf("Expected %q to be a valid default environment, got %v", environment, err)
+		}
+	}
+
+	subnet := &repository.Subnet{ID: "web", CIDR: "10.30.0.0/24", Name: "Web", Location: "datacenter-1", Environment: "qa"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); !errors.Is(err, ErrInvalidEnvironment) {
+		t.Fatalf("Expected ErrInvalidEnvironment, got %v", err)
+	}
+
+	subnet.Environment = "prod"
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	if err := serviceLayer.SetSubnetEnvironment(ctx, subnet.ID, "production"); !errors.Is(err, ErrInvalidEnvironment) {
+		t.Errorf("Expected ErrInvalidEnvironment on update, got %v", err)
+	}
+	if err := serviceLayer.SetSubnetEnvironment(ctx, subnet.ID, "staging"); err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+	found, err := serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+	if err != nil || found.Environment != "staging" {
+		t.Errorf("Expected staging environment, got %+v, %v", found, err)
+	}
+
+	custom := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{AllowedEnvironments: []string{"qa"}})
+	if err := custom.ValidateEnvironment("qa"); err != nil {
+		t.Errorf("Expected configured environment to be valid, got %v", err)
+	}
+	if err := custom.ValidateEnvironment("prod"); !errors.Is(err, ErrInvalidEnvironment) {
+		t.Errorf("Expected default environment to be rejected by a custom set, got %v", err)
+	}
+}
+
+func TestSubnetDHCPRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	t.Run("rejects invalid ranges on create", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			start, end string
+		}{
+			{"outside the subnet", "10.31.0.10", "10.31.1.10"},
+			{"reversed", "10.31.0.200", "10.31.0.100"},
+			{"missing end", "10.31.0.100", ""},
+			{"not an address", "10.31.0.100", "dhcp-end"},
+		}
+		for _, tt := range tests {
+			subnet := &repository.Subnet{ID: "bad", CIDR: "10.31.0.0/24", Name: "Bad", DHCPRangeStart: tt.start, DHCPRangeEnd: tt.end}
+			if err := serviceLayer.CreateSubnetRepository(ctx, subnet); !errors.Is(err, ErrInvalidDHCPRange) {
+				t.Errorf("%s: expected ErrInvalidDHCPRange, got %v", tt.name, err)
+			}
+		}
+	})
+
+	subnet := &repository.Subnet{ID: "office", CIDR: "10.31.0.0/24", Name: "Office", DHCPRangeStart: "10.31.0.100", DHCPRangeEnd: "10.31.0.200"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet with a valid range: %v", err)
+	}
+	found, err := serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+	if err != nil || found.DHCPRangeStart != "10.31.0.100" || found.DHCPRangeEnd != "10.31.0.200" {
+		t.Fatalf("Expected the DHCP range to be stored, got %+v, %v", found, err)
+	}
+
+	update := func(opts UpdateSubnetOptions) *pb.UpdateSubnetResponse {
+		t.Helper()
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: subnet.ID}, opts)
+		if err != nil {
+			t.Fatalf("UpdateSubnetWithOptions failed: %v", err)
+		}
+		return resp
+	}
+	ptr := func(s string) *string { return &s }
+
+	t.Run("rejects an update leaving the subnet", func(t *testing.T) {
+		resp := update(UpdateSubnetOptions{DHCPRangeEnd: ptr("10.31.1.1")})
+		if resp.Error == nil || resp.Error.Code != "INVALID_DHCP_RANGE" {
+			t.Fatalf("Expected INVALID_DHCP_RANGE, got %+v", resp.Error)
+		}
+	})
+
+	t.Run("rejects a reversed update", func(t *testing.T) {
+		resp := update(UpdateSubnetOptions{DHCPRangeStart: ptr("10.31.0.250")})
+		if resp.Error == nil || resp.Error.Code != "INVALID_DHCP_RANGE" {
+			t.Fatalf("Expected INVALID_DHCP_RANGE, got %+v", resp.Error)
+		}
+	})
+
+	t.Run("rejects a CIDR change leaving the stored range outside", func(t *testing.T) {
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: subnet.ID, Cidr: "10.31.0.0/25"}, UpdateSubnetOptions{})
+		if err != nil {
+			t.Fatalf("UpdateSubnetWithOptions failed: %v", err)
+		}
+		if resp.Error == nil || resp.Error.Code != "INVALID_DHCP_RANGE" {
+			t.Fatalf("Expected INVALID_DHCP_RANGE, got %+v", resp.Error)
+		}
+		found, err := serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+		if err != nil || found.CIDR != "10.31.0.0/24" {
+			t.Errorf("Expected the CIDR to be unchanged, got %+v, %v", found, err)
+		}
+	})
+
+	t.Run("updates one end", func(t *testing.T) {
+		if resp := update(UpdateSubnetOptions{DHCPRangeStart: ptr("10.31.0.50")}); resp.Error != nil {
+			t.Fatalf("Unexpected error: %+v", resp.Error)
+		}
+		found, err := serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+		if err != nil || found.DHCPRangeStart != "10.31.0.50" || found.DHCPRangeEnd != "10.31.0.200" || found.Name != "Office" {
+			t.Errorf("Expected range 10.31.0.50-10.31.0.200, got %+v, %v", found, err)
+		}
+	})
+
+	t.Run("clears the range", func(t *testing.T) {
+		if resp := update(UpdateSubnetOptions{DHCPRangeStart: ptr(""), DHCPRangeEnd: ptr("")}); resp.Error != nil {
+			t.Fatalf("Unexpected error: %+v", resp.Error)
+		}
+		found, err := serviceLayer.GetSubnetRepository(ctx, subnet.ID)
+		if err != nil || found.DHCPRangeStart != "" || found.DHCPRangeEnd != "" {
+			t.Errorf("Expected the range to be cleared, got %+v, %v", found, err)
+		}
+	})
+}
+
+func TestSplitSubnet(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{MaxSplitSubnets: 8})
+	ctx := context.Background()
+
+	parent := &repository.Subnet{ID: "parent", CIDR: "10.30.0.0/22", Name: "Parent", Location: "datacenter-1", Environment: "prod"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, parent); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+	existing := &repository.Subnet{ID: "existing", CIDR: "10.30.1.0/24", Name: "Existing", Location: "datacenter-1", ParentID: "parent"}
+	if err := serviceLayer.CreateSubnetRepository(ctx, existing); err != nil {
+		t.Fatalf("Failed to create existing child: %v", err)
+	}
+
+	t.Run("rejects invalid prefix lengths", func(t *testing.T) {
+		for _, prefix := range []int{16, 22, 33} {
+			if _, err := serviceLayer.SplitSubnet(ctx, "parent", prefix); !errors.Is(err, ErrInvalidPrefixLength) {
+				t.Errorf("Expected ErrInvalidPrefixLength for /%d, got %v", prefix, err)
+			}
+		}
+	})
+
+	t.Run("rejects splits over the cap", func(t *testing.T) {
+		_, err := serviceLayer.SplitSubnet(ctx, "parent", 26)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Count != 16 || limitErr.Max != 8 {
+			t.Fatalf("Expected LimitError of 16 over 8, got %v", err)
+		}
+	})
+
+	t.Run("previews without creating children", func(t *testing.T) {
+		if _, err := serviceLayer.PreviewSplit(ctx, "parent", 33); !errors.Is(err, ErrInvalidPrefixLength) {
+			t.Errorf("Expected ErrInvalidPrefixLength, got %v", err)
+		}
+
+		preview, err := serviceLayer.PreviewSplit(ctx, "parent", 24)
+		if err != nil {
+			t.Fatalf("Failed to preview split: %v", err)
+		}
+		if want := "10.30.0.0/24,10.30.2.0/24,10.30.3.0/24"; strings.Join(preview, ",") != want {
+			t.Errorf("Expected %s, got %s", want, strings.Join(preview, ","))
+		}
+
+		children, err := serviceLayer.GetSubnetChildren(ctx, "parent")
+		if err != nil || len(children) != 1 {
+			t.Fatalf("Expected the preview to leave 1 child, got %d (%v)", len(children), err)
+		}
+	})
+
+	t.Run("creates the free blocks as children", func(t *testing.T) {
+		preview, err := serviceLayer.PreviewSplit(ctx, "parent", 24)
+		if err != nil {
+			t.Fatalf("Failed to preview split: %v", err)
+		}
+
+		created, err := serviceLayer.SplitSubnet(ctx, "parent", 24)
+		if err != nil {
+			t.Fatalf("Failed to split subnet: %v", err)
+		}
+
+		var cidrs []string
+		for _, subnet := range created {
+			cidrs = append(cidrs, subnet.CIDR)
+			if subnet.ParentID != "parent" || subnet.Location != "datacenter-1" || subnet.Environment != "prod" {
+				t.Errorf("Expected %s to inherit the parent's placement, got %+v", subnet.CIDR, subnet)
+			}
+		}
+		if want := "10.30.0.0/24,10.30.2.0/24,10.30.3.0/24"; strings.Join(cidrs, ",") != want {
+			t.Errorf("Expected %s, got %s", want, strings.Join(cidrs, ","))
+		}
+		if strings.Join(preview, ",") != strings.Join(cidrs, ",") {
+			t.Errorf("Preview %v does not match the split %v", preview, cidrs)
+		}
+
+		children, err := serviceLayer.GetSubnetChildren(ctx, "parent")
+		if err != nil || len(children) != 4 {
+			t.Fatalf("Expected 4 children, got %d (%v)", len(children), err)
+		}
+
+		stored, err := repo.GetSubnetByID(ctx, "parent")
+		if err != nil {
+			t.Fatalf("Failed to get parent: %v", err)
+		}
+		if stored.Utilization.PrefixUtilizationPercent != 100 {
+			t.Errorf("Expected parent fully utilized, got %.2f%%", stored.Utilization.PrefixUtilizationPercent)
+		}
+	})
+
+	t.Run("reports no space once every block is taken", func(t *testing.T) {
+		if _, err := serviceLayer.SplitSubnet(ctx, "parent", 24); !errors.Is(err, ErrNoSpaceAvailable) {
+			t.Errorf("Expected ErrNoSpaceAvailable, got %v", err)
+		}
+	})
+}
+
+func TestBulkUpdateUtilization(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "a", CIDR: "10.32.0.0/24", Name: "A"},
+		{ID: "b", CIDR: "10.32.1.0/24", Name: "B"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	allocated := func(id string) *repository.Utilization {
+		t.Helper()
+		subnet, err := serviceLayer.GetSubnetRepository(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get subnet %s: %v", id, err)
+		}
+		return subnet.Utilization
+	}
+
+	t.Run("updates every subnet in the batch", func(t *testing.T) {
+		err := serviceLayer.BulkUpdateUtilization(ctx, []*UtilizationReport{
+			{SubnetID: "a", AllocatedIPs: 127},
+			{SubnetID: "b", AllocatedIPs: 254},
+		})
+		if err != nil {
+			t.Fatalf("BulkUpdateUtilization failed: %v", err)
+		}
+
+		if got := allocated("a"); got.AllocatedIPs != 127 || got.UtilizationPercent != 50 {
+			t.Errorf("Expected 127 allocated at 50%%, got %d at %.2f%%", got.AllocatedIPs, got.UtilizationPercent)
+		}
+		if got := allocated("b"); got.AllocatedIPs != 254 || got.UtilizationPercent != 100 {
+			t.Errorf("Expected 254 allocated at 100%%, got %d at %.2f%%", got.AllocatedIPs, got.UtilizationPercent)
+		}
+	})
+
+	t.Run("rejects allocated above total without applying the batch", func(t *testing.T) {
+		err := serviceLayer.BulkUpdateUtilization(ctx, []*UtilizationReport{
+			{SubnetID: "a", AllocatedIPs: 10},
+			{SubnetID: "b", AllocatedIPs: 255},
+		})
+		var bulkErr *repository.BulkUpdateError
+		if !errors.Is(err, ErrInvalidUtilization) || !errors.As(err, &bulkErr) || bulkErr.Index != 1 {
+			t.Fatalf("Expected ErrInvalidUtilization for item 1, got %v", err)
+		}
+		if got := allocated("a"); got.AllocatedIPs != 127 {
+			t.Errorf("Expected subnet a to keep 127 allocated, got %d", got.AllocatedIPs)
+		}
+	})
+
+	t.Run("rolls back when a subnet is missing", func(t *testing.T) {
+		err := serviceLayer.BulkUpdateUtilization(ctx, []*UtilizationReport{
+			{SubnetID: "a", AllocatedIPs: 10},
+			{SubnetID: "missing", AllocatedIPs: 1},
+		})
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+		if got := allocated("a"); got.AllocatedIPs != 127 {
+			t.Errorf("Expected subnet a to keep 127 allocated, got %d", got.AllocatedIPs)
+		}
+	})
+}
+
+func TestDeleteSubnetWithChildren(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "vpc", CIDR: "10.40.0.0/16", Name: "VPC"},
+		{ID: "tier-a", CIDR: "10.40.0.0/20", Name: "Tier A", ParentID: "vpc"},
+		{ID: "tier-b", CIDR: "10.40.16.0/20", Name: "Tier B", ParentID: "vpc"},
+		{ID: "app", CIDR: "10.40.1.0/24", Name: "App", ParentID: "tier-a"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create subnet %s: %v", subnet.ID, err)
+		}
+	}
+
+	t.Run("refuses to delete a parent", func(t *testing.T) {
+		resp, err := serviceLayer.DeleteSubnet(ctx, &pb.DeleteSubnetRequest{Id: "vpc"})
+		if err != nil {
+			t.Fatalf("DeleteSubnet failed: %v", err)
+		}
+		if resp.Error == nil || resp.Error.Code != "HAS_CHILDREN" {
+			t.Fatalf("Expected HAS_CHILDREN, got %+v", resp.Error)
+		}
+		blocking := strings.Split(resp.Error.Details["subnet_ids"], ",")
+		sort.Strings(blocking)
+		if strings.Join(blocking, ",") != "tier-a,tier-b" {
+			t.Errorf("Expected the direct children tier-a and tier-b, got %v", blocking)
+		}
+		if _, err := serviceLayer.GetSubnetRepository(ctx, "vpc"); err != nil {
+			t.Errorf("Expected the parent to survive, got %v", err)
+		}
+	})
+
+	t.Run("cascades through a two-level tree", func(t *testing.T) {
+		resp, err := serviceLayer.DeleteSubnetWithOptions(ctx, &pb.DeleteSubnetRequest{Id: "vpc"}, DeleteSubnetOptions{Cascade: true})
+		if err != nil || resp.Error != nil {
+			t.Fatalf("Cascading delete failed: %v %v", err, resp.GetError())
+		}
+		for _, id := range []string{"vpc", "tier-a", "tier-b", "app"} {
+			if _, err := serviceLayer.GetSubnetRepository(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+				t.Errorf("Expected %s to be deleted, got %v", id, err)
+			}
+		}
+	})
+}
+
+func TestPartialUpdatesBumpUpdatedAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		Clock: func() time.Time { return clock },
+	})
+	ctx := context.Background()
+
+	createResp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{
+		Cidr:     "10.95.0.0/24",
+		Name:     "Tagged",
+		Location: "datacenter-1",
+	})
+	if err != nil || createResp.Error != nil {
+		t.Fatalf("Failed to create subnet: %v %v", err, createResp.GetError())
+	}
+	id := createResp.Subnet.Id
+	if createResp.Subnet.UpdatedAt != clock.Unix() {
+		t.Fatalf("Expected updated_at %d from the clock, got %d", clock.Unix(), createResp.Subnet.UpdatedAt)
+	}
+
+	updates := []struct {
+		name   string
+		update func() error
+	}{
+		{"tags only", func() error {
+			return serviceLayer.SetSubnetTags(ctx, id, map[string]string{"team": "network"})
+		}},
+		{"environment only", func() error {
+			return serviceLayer.SetSubnetEnvironment(ctx, id, "prod")
+		}},
+		{"description only", func() error {
+			resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id, Description: "Edge"}, UpdateSubnetOptions{})
+			if err == nil && resp.Error != nil {
+				err = errors.New(resp.Error.Message)
+			}
+			return err
+		}},
+	}
+
+	for _, tt := range updates {
+		t.Run(tt.name, func(t *testing.T) {
+			clock = clock.Add(time.Hour)
+			if err := tt.update(); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			found, err := serviceLayer.GetSubnetRepository(ctx, id)
+			if err != nil {
+				t.Fatalf("Failed to get subnet: %v", err)
+			}
+			if !found.UpdatedAt.Equal(clock) {
+				t.Errorf("Expected updated_at %s, got %s", clock, found.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestUpdateSubnetIfMatch(t *testing.T) {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	// The clock never moves, so only the ETag bump tells the edits apart
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		Clock: func() time.Time { return clock },
+	})
+	ctx := context.Background()
+
+	createResp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{Cidr: "10.96.0.0/24", Name: "Web", Location: "datacenter-1"})
+	if err != nil || createResp.Error != nil {
+		t.Fatalf("Failed to create subnet: %v %v", err, createResp.GetError())
+	}
+	id := createResp.Subnet.Id
+	etag := SubnetETag(id, createResp.Subnet.UpdatedAt)
+
+	update := func(name, ifMatch string) *pb.UpdateSubnetResponse {
+		t.Helper()
+		resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id, Name: name}, UpdateSubnetOptions{IfMatch: ifMatch})
+		if err != nil {
+			t.Fatalf("UpdateSubnetWithOptions failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := update("First", etag)
+	if resp.Error != nil {
+		t.Fatalf("Expected an update with the current ETag to succeed, got %v", resp.Error)
+	}
+	current := SubnetETag(id, resp.Subnet.UpdatedAt)
+	if current == etag {
+		t.Fatal("Expected the update to change the ETag within the same second")
+	}
+
+	resp = update("Stale", etag)
+	if resp.Error == nil || resp.Error.Code != "PRECONDITION_FAILED" || resp.Error.Details["etag"] != current {
+		t.Fatalf("Expected PRECONDITION_FAILED naming %s, got %v", current, resp.Error)
+	}
+	if found, err := serviceLayer.GetSubnetRepository(ctx, id); err != nil || found.Name != "First" {
+		t.Errorf("Expected the stale update to leave the subnet unchanged, got %+v (%v)", found, err)
+	}
+
+	for _, ifMatch := range []string{`"other", ` + current, "*", ""} {
+		if resp := update("Later", ifMatch); resp.Error != nil {
+			t.Errorf("Expected If-Match %q to be accepted, got %v", ifMatch, resp.Error)
+		}
+	}
+}
+
+// writeCountingRepository counts the subnet writes reaching the repository
+type writeCountingRepository struct {
+	repository.SubnetRepository
+	writes int
+}
+
+func (r *writeCountingRepository) Update(ctx context.Context, subnet *pb.Subnet) error {
+	r.writes++
+	return r.SubnetRepository.Update(ctx, subnet)
+}
+
+func (r *writeCountingRepository) UpdateWithStoredFields(ctx context.Context, subnet *pb.Subnet, stored *repository.StoredFields) error {
+	r.writes++
+	return r.SubnetRepository.UpdateWithStoredFields(ctx, subnet, stored)
+}
+
+func (r *writeCountingRepository) UpdateSubnet(ctx context.Context, id string, subnet *repository.Subnet) error {
+	r.writes++
+	return r.SubnetRepository.UpdateSubnet(ctx, id, subnet)
+}
+
+func TestUpdateSubnetStoredFieldsInOneWrite(t *testing.T) {
+	sqliteRepo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer sqliteRepo.Close()
+	repo := &writeCountingRepository{SubnetRepository: sqliteRepo}
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		Clock: func() time.Time { return clock },
+	})
+	ctx := context.Background()
+
+	createResp, err := serviceLayer.CreateSubnet(ctx, &pb.CreateSubnetRequest{Cidr: "10.97.0.0/24", Name: "Web"})
+	if err != nil || createResp.Error != nil {
+		t.Fatalf("Failed to create subnet: %v %v", err, createResp.GetError())
+	}
+	id := createResp.Subnet.Id
+
+	environment, start, end, zone := "staging", "10.97.0.100", "10.97.0.200", "97.10.in-addr.arpa"
+	repo.writes = 0
+	resp, err := serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id, Name: "Renamed"}, UpdateSubnetOptions{
+		Environment:    &environment,
+		DHCPRangeStart: &start,
+		DHCPRangeEnd:   &end,
+		DNSZone:        &zone,
+	})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("Update failed: %v %v", err, resp.GetError())
+	}
+	if repo.writes != 1 {
+		t.Errorf("Expected the update to be a single write, got %d", repo.writes)
+	}
+
+	stored, err := sqliteRepo.GetSubnetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to reload subnet: %v", err)
+	}
+	if stored.Name != "Renamed" || stored.Environment != environment || stored.DHCPRangeStart != start || stored.DHCPRangeEnd != end || stored.DNSZone != zone {
+		t.Errorf("Expected every field applied, got %+v", stored)
+	}
+	if stored.UpdatedAt.Unix() != resp.Subnet.UpdatedAt {
+		t.Errorf("Expected the stored updated_at %d to match the response, got %d", resp.Subnet.UpdatedAt, stored.UpdatedAt.Unix())
+	}
+
+	invalid := "nowhere"
+	resp, err = serviceLayer.UpdateSubnetWithOptions(ctx, &pb.UpdateSubnetRequest{Id: id}, UpdateSubnetOptions{Environment: &invalid})
+	if err != nil || resp.GetError().GetCode() != "INVALID_ENVIRONMENT" {
+		t.Errorf("Expected INVALID_ENVIRONMENT, got %v %v", err, resp.GetError())
+	}
+}
+
+func TestFindSubnetsForIPs(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	for _, subnet := range []*repository.Subnet{
+		{ID: "root", CIDR: "10.0.0.0/8", Name: "Root", Location: "datacenter-1"},
+		{ID: "mid", CIDR: "10.2.0.0/16", Name: "Mid", Location: "datacenter-1", ParentID: "root"},
+		{ID: "leaf", CIDR: "10.2.3.0/24", Name: "Leaf", Location: "datacenter-1", ParentID: "mid"},
+		{ID: "sibling", CIDR: "10.2.16.0/24", Name: "Sibling", Location: "datacenter-1", ParentID: "mid"},
+		{ID: "other", CIDR: "192.168.0.0/24", Name: "Other", Location: "datacenter-1"},
+		{ID: "v6", CIDR: "2001:db8::/32", Name: "V6", Location: "datacenter-1"},
+	} {
+		if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+			t.Fatalf("Failed to create %s: %v", subnet.ID, err)
+		}
+	}
+
+	ips := []string{
+		"10.2.3.4",        // leaf
+		"10.2.17.1",       // past the sibling, back to mid
+		"10.3.0.1",        // past mid, back to root
+		"10.2.16.255",     // sibling
+		"172.16.0.1",      // between root and other
+		"192.168.1.1",     // past every IPv4 subnet
+		"::ffff:10.2.3.9", // IPv4-mapped leaf address
+		"2001:db8:1::1",   // v6
+		"2001:db9::1",     // past every subnet
+		"9.255.255.255",   // before every subnet
+	}
+	want := []string{"leaf", "mid", "root", "sibling", "", "", "leaf", "v6", "", ""}
+
+	results, err := serviceLayer.FindSubnetsForIPs(ctx, ips)
+	if err != nil {
+		t.Fatalf("FindSubnetsForIPs failed: %v", err)
+	}
+	if len(results) != len(ips) {
+		t.Fatalf("Expected %d results, got %d", len(ips), len(results))
+	}
+	for i, result := range results {
+		got := ""
+		if result != nil {
+			got = result.ID
+		}
+		if got != want[i] {
+			t.Errorf("%s: expected %q, got %q", ips[i], want[i], got)
+		}
+	}
+
+	if _, err := serviceLayer.FindSubnetsForIPs(ctx, []string{"10.2.3.4", "10.2.3"}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("Expected ErrInvalidIP, got %v", err)
+	}
+}
+
+func TestPrefixUtilization(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	if err := serviceLayer.CreateSubnetRepository(ctx, &repository.Subnet{ID: "parent", CIDR: "192.168.10.0/24", Name: "Parent"}); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+	if _, err := serviceLayer.AllocateIP(ctx, "parent", "192.168.10.200", "", "gateway"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if err := serviceLayer.CreateSubnetRepository(ctx, &repository.Subnet{ID: "child", CIDR: "192.168.10.0/25", Name: "Child", ParentID: "parent"}); err != nil {
+		t.Fatalf("Failed to create child: %v", err)
+	}
+
+	parent, err := serviceLayer.GetSubnetRepository(ctx, "parent")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	if parent.Utilization.PrefixUtilizationPercent != 50 {
+		t.Errorf("Expected 50%% prefix utilization, got %v%%", parent.Utilization.PrefixUtilizationPercent)
+	}
+	// One allocated address out of the /24's usable hosts
+	if want := 100.0 / 254; math.Abs(parent.Utilization.UtilizationPercent-want) > 1e-4 {
+		t.Errorf("Expected IP-based utilization %v%% to be kept, got %v%%", want, parent.Utilization.UtilizationPercent)
+	}
+}
+
+// countingIPService counts detail calculations of the wrapped IP service
+type countingIPService struct {
+	IPService
+	calculations int
+}
+
+func (c *countingIPService) CalculateSubnetDetails(cidr string) (*pb.SubnetDetails, error) {
+	c.calculations++
+	return c.IPService.CalculateSubnetDetails(cidr)
+}
+
+func TestCreateSubnetSkipDetails(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	ipService := &countingIPService{IPService: NewGoIPAMService()}
+	serviceLayer := NewServiceLayer(repo, ipService, nil)
+	ctx := context.Background()
+
+	t.Run("normal creates calculate details", func(t *testing.T) {
+		if err := serviceLayer.CreateSubnetRepository(ctx, &repository.Subnet{ID: "calculated", CIDR: "10.50.0.0/24", Name: "Calculated"}); err != nil {
+			t.Fatalf("Failed to create subnet: %v", err)
+		}
+		if ipService.calculations != 1 {
+			t.Errorf("Expected one detail calculation, got %d", ipService.calculations)
+		}
+		subnet, err := serviceLayer.GetSubnetRepository(ctx, "calculated")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if subnet.Details == nil || subnet.Details.Netmask != "255.255.255.0" || subnet.Utilization.TotalIPs != 254 {
+			t.Errorf("Expected calculated details, got %+v and %+v", subnet.Details, subnet.Utilization)
+		}
+	})
+
+	t.Run("provided details are stored as-is", func(t *testing.T) {
+		ipService.calculations = 0
+		provided := &repository.SubnetDetails{Address: "10.51.0.0", Netmask: "255.255.255.0", HostsPerNet: 200}
+		subnet := &repository.Subnet{ID: "provided", CIDR: "10.51.0.0/24", Name: "Provided", Details: provided}
+		if err := serviceLayer.CreateSubnetRepositoryWithOptions(ctx, subnet, CreateSubnetOptions{SkipDetails: true}); err != nil {
+			t.Fatalf("Failed to create subnet: %v", err)
+		}
+		if ipService.calculations != 0 {
+			t.Errorf("Expected no detail calculation, got %d", ipService.calculations)
+		}
+		stored, err := serviceLayer.GetSubnetRepository(ctx, "provided")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if stored.Details == nil || stored.Details.HostsPerNet != 200 || stored.Details.HostMin != "" || stored.Utilization.TotalIPs != 200 {
+			t.Errorf("Expected the provided details, got %+v and %+v", stored.Details, stored.Utilization)
+		}
+	})
+
+	t.Run("bulk creates without details", func(t *testing.T) {
+		ipService.calculations = 0
+		subnets := []*repository.Subnet{
+			{ID: "bulk-1", CIDR: "10.52.0.0/24", Name: "Bulk 1"},
+			{ID: "bulk-2", CIDR: "10.52.1.0/24", Name: "Bulk 2"},
+		}
+		results, err := serviceLayer.BulkCreateSubnetsWithOptions(ctx, subnets, CreateSubnetOptions{SkipDetails: true})
+		if err != nil {
+			t.Fatalf("Failed to create subnets: %v", err)
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				t.Fatalf("Failed to create subnet %s: %v", result.CIDR, result.Err)
+			}
+		}
+		if ipService.calculations != 0 {
+			t.Errorf("Expected no detail calculation, got %d", ipService.calculations)
+		}
+		stored, err := serviceLayer.GetSubnetRepository(ctx, "bulk-1")
+		if err != nil {
+			t.Fatalf("Failed to get subnet: %v", err)
+		}
+		if stored.Details != nil && (stored.Details.Netmask != "" || stored.Details.HostsPerNet != 0) {
+			t.Errorf("Expected empty details, got %+v", stored.Details)
+		}
+	})
 }
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestValidateChildPrefixLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		parent     string
+		prefixLen  int
+		wantReason string
+	}{
+		{"prefix 33 on IPv4", "10.0.0.0/16", 33, PrefixExceedsFamilyMax},
+		{"prefix 129 on IPv6", "2001:db8::/32", 129, PrefixExceedsFamilyMax},
+		{"negative prefix", "10.0.0.0/16", -1, PrefixExceedsFamilyMax},
+		{"prefix equal to parent", "10.0.0.0/16", 16, PrefixNotLongerThanParent},
+		{"prefix shorter than parent", "10.0.0.0/16", 8, PrefixNotLongerThanParent},
+		{"valid IPv4 prefix", "10.0.0.0/16", 24, ""},
+		{"valid IPv4 host prefix", "10.0.0.0/16", 32, ""},
+		{"valid IPv6 prefix", "2001:db8::/32", 64, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateChildPrefixLength(netip.MustParsePrefix(tt.parent), tt.prefixLen)
+
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var prefixErr *PrefixLengthError
+			if !errors.As(err, &prefixErr) {
+				t.Fatalf("Expected PrefixLengthError, got %v", err)
+			}
+			if prefixErr.Reason != tt.wantReason {
+				t.Errorf("Expected reason %s, got %s", tt.wantReason, prefixErr.Reason)
+			}
+			if !errors.Is(err, ErrInvalidPrefixLength) {
+				t.Error("Expected error to match ErrInvalidPrefixLength")
+			}
+		})
+	}
+}
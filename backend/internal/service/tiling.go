@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// TilingOverlap is a pair of candidate CIDRs sharing addresses. Overlap is
+// the shared block, which is the smaller of the two since prefixes nest.
+type TilingOverlap struct {
+	CIDRs   [2]string
+	Overlap string
+}
+
+// TilingResult reports how a set of candidate CIDRs covers a parent. The
+// candidates tile the parent when they leave no gaps, do not overlap each
+// other and all lie inside it.
+type TilingResult struct {
+	ParentCIDR string
+	Valid      bool
+	Gaps       []string
+	Overlaps   []TilingOverlap
+	Outside    []string
+}
+
+// ValidateTiling checks whether cidrs exactly cover the subnet parentID with
+// no gaps and no overlaps, without creating anything
+func (s *ServiceLayer) ValidateTiling(ctx context.Context, parentID string, cidrs []string) (*TilingResult, error) {
+	parent, err := s.subnetRepo.GetSubnetByID(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	parentPrefix, err := netip.ParsePrefix(parent.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parent CIDR %s: %w", parent.CIDR, err)
+	}
+
+	candidates := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrInvalidCIDR, cidr)
+		}
+		if prefix.Addr().Is4() != parentPrefix.Addr().Is4() {
+			return nil, fmt.Errorf("%w %q: address family differs from parent %s", ErrInvalidCIDR, cidr, parent.CIDR)
+		}
+		candidates[i] = prefix.Masked()
+	}
+
+	return checkTiling(parentPrefix.Masked(), candidates)
+}
+
+// checkTiling compares candidates against parent. Gaps are the difference
+// between the parent and the union of the candidates, as minimal CIDRs.
+func checkTiling(parent netip.Prefix, candidates []netip.Prefix) (*TilingResult, error) {
+	result := &TilingResult{
+		ParentCIDR: parent.String(),
+		Gaps:       []string{},
+		Overlaps:   []TilingOverlap{},
+		Outside:    []string{},
+	}
+
+	var b netipx.IPSetBuilder
+	b.AddPrefix(parent)
+	for _, candidate := range candidates {
+		b.RemovePrefix(candidate)
+		if candidate.Bits() < parent.Bits() || !parent.Contains(candidate.Addr()) {
+			result.Outside = append(result.Outside, candidate.String())
+		}
+	}
+	gaps, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build gap set: %w", err)
+	}
+	for _, gap := range gaps.Prefixes() {
+		result.Gaps = append(result.Gaps, gap.String())
+	}
+
+	// Two prefixes either nest or are disjoint, so in address order a
+	// candidate can only overlap the ones starting inside it
+	sorted := slices.Clone(candidates)
+	slices.SortFunc(sorted, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	for i, outer := range sorted {
+		for _, inner := range sorted[i+1:] {
+			if !outer.Contains(inner.Addr()) {
+				break
+			}
+			result.Overlaps = append(result.Overlaps, TilingOverlap{
+				CIDRs:   [2]string{outer.String(), inner.String()},
+				Overlap: inner.String(),
+			})
+		}
+	}
+
+	result.Valid = len(result.Gaps) == 0 && len(result.Overlaps) == 0 && len(result.Outside) == 0
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestCheckTiling(t *testing.T) {
+	tests := []struct {
+		name         string
+		candidates   []string
+		wantValid    bool
+		wantGaps     []string
+		wantOverlaps []TilingOverlap
+		wantOutside  []string
+	}{
+		{
+			name:       "perfect tiling",
+			candidates: []string{"10.0.0.128/25", "10.0.0.0/26", "10.0.0.64/26"},
+			wantValid:  true,
+		},
+		{
+			name:       "gap",
+			candidates: []string{"10.0.0.0/26", "10.0.0.128/25"},
+			wantGaps:   []string{"10.0.0.64/26"},
+		},
+		{
+			name:       "overlap",
+			candidates: []string{"10.0.0.0/25", "10.0.0.64/26", "10.0.0.128/25"},
+			wantOverlaps: []TilingOverlap{
+				{CIDRs: [2]string{"10.0.0.0/25", "10.0.0.64/26"}, Overlap: "10.0.0.64/26"},
+			},
+		},
+		{
+			name:       "duplicate",
+			candidates: []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.0.0/25"},
+			wantOverlaps: []TilingOverlap{
+				{CIDRs: [2]string{"10.0.0.0/25", "10.0.0.0/25"}, Overlap: "10.0.0.0/25"},
+			},
+		},
+		{
+			name:        "outside the parent",
+			candidates:  []string{"10.0.0.0/24", "10.0.1.0/24"},
+			wantOutside: []string{"10.0.1.0/24"},
+		},
+	}
+
+	parent := netip.MustParsePrefix("10.0.0.0/24")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := make([]netip.Prefix, len(tt.candidates))
+			for i, cidr := range tt.candidates {
+				candidates[i] = netip.MustParsePrefix(cidr)
+			}
+
+			result, err := checkTiling(parent, candidates)
+			if err != nil {
+				t.Fatalf("checkTiling failed: %v", err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Errorf("Expected valid %v, got %v", tt.wantValid, result.Valid)
+			}
+			if want := orEmpty(tt.wantGaps); !reflect.DeepEqual(result.Gaps, want) {
+				t.Errorf("Expected gaps %v, got %v", want, result.Gaps)
+			}
+			if want := orEmpty(tt.wantOverlaps); !reflect.DeepEqual(result.Overlaps, want) {
+				t.Errorf("Expected overlaps %v, got %v", want, result.Overlaps)
+			}
+			if want := orEmpty(tt.wantOutside); !reflect.DeepEqual(result.Outside, want) {
+				t.Errorf("Expected outside %v, got %v", want, result.Outside)
+			}
+		})
+	}
+}
+
+// orEmpty returns an empty slice for nil, matching the results of checkTiling
+func orEmpty[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+// HistoryRetention defines the downsampling tiers of utilization history.
+// Points newer than MinuteRetention are kept per minute, points newer than
+// HourlyRetention per hour, and older points per day.
+type HistoryRetention struct {
+	MinuteRetention time.Duration
+	HourlyRetention time.Duration
+}
+
+// ListUtilizationHistory returns a subnet's utilization samples recorded in
+// [from, to), oldest first. A zero from or to leaves that end open.
+func (s *ServiceLayer) ListUtilizationHistory(ctx context.Context, subnetID string, from, to time.Time) ([]*repository.UtilizationSample, error) {
+	if _, err := s.subnetRepo.GetSubnetByID(ctx, subnetID); err != nil {
+		return nil, err
+	}
+
+	return s.subnetRepo.ListUtilizationHistory(ctx, subnetID, from, to)
+}
+
+// recordUtilization appends a sample stamped with the current time to a
+// subnet's history and prunes it to MaxUtilizationSamples. History is
+// secondary to the utilization itself, so failures are only logged.
+func (s *ServiceLayer) recordUtilization(ctx context.Context, sample *repository.UtilizationSample) {
+	sample.RecordedAt = s.now()
+	if err := s.subnetRepo.CreateUtilizationSample(ctx, sample); err != nil {
+		log.Printf("Failed to record utilization of subnet %s: %v", sample.SubnetID, err)
+		return
+	}
+
+	if s.options.MaxUtilizationSamples > 0 {
+		if err := s.subnetRepo.PruneUtilizationHistory(ctx, sample.SubnetID, s.options.MaxUtilizationSamples); err != nil {
+			log.Printf("Failed to prune utilization history of subnet %s: %v", sample.SubnetID, err)
+		}
+	}
+}
+
+// CompactUtilizationHistory downsamples the utilization history of every subnet
+// according to the retention tiers, relative to now. Histories are then pruned
+// to MaxUtilizationSamples, which also caps samples recorded by cloud sync.
+func (s *ServiceLayer) CompactUtilizationHistory(ctx context.Context, retention HistoryRetention, now time.Time) error {
+	subnetIDs, err := s.subnetRepo.ListUtilizationHistorySubnetIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list subnets with history: %w", err)
+	}
+
+	// Tier boundaries are aligned to the coarser bucket on each side so a
+	// bucket never straddles two tiers
+	currentMinute := now.Truncate(time.Minute)
+	minuteCutoff := now.Add(-retention.MinuteRetention).Truncate(time.Hour)
+	hourCutoff := now.Add(-retention.HourlyRetention).Truncate(24 * time.Hour)
+	if hourCutoff.After(minuteCutoff) {
+		hourCutoff = minuteCutoff
+	}
+
+	tiers := []struct {
+		from, to time.Time
+		bucket   time.Duration
+	}{
+		{time.Unix(0, 0), hourCutoff, 24 * time.Hour},
+		{hourCutoff, minuteCutoff, time.Hour},
+		{minuteCutoff, currentMinute, time.Minute},
+	}
+
+	for _, subnetID := range subnetIDs {
+		for _, tier := range tiers {
+			if !tier.from.Before(tier.to) {
+				continue
+			}
+			if err := s.downsampleHistory(ctx, subnetID, tier.from, tier.to, tier.bucket); err != nil {
+				return err
+			}
+		}
+
+		if s.options.MaxUtilizationSamples > 0 {
+			if err := s.subnetRepo.PruneUtilizationHistory(ctx, subnetID, s.options.MaxUtilizationSamples); err != nil {
+				return fmt.Errorf("failed to prune utilization history for %s: %w", subnetID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// downsampleHistory collapses a subnet's samples in [from, to) to one per bucket
+func (s *ServiceLayer) downsampleHistory(ctx context.Context, subnetID string, from, to time.Time, bucket time.Duration) error {
+	samples, err := s.subnetRepo.ListUtilizationHistory(ctx, subnetID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to load utilization history for %s: %w", subnetID, err)
+	}
+
+	downsampled := downsampleSamples(samples, bucket)
+	if len(downsampled) == len(samples) {
+		return nil
+	}
+
+	if err := s.subnetRepo.ReplaceUtilizationHistory(ctx, subnetID, from, to, downsampled); err != nil {
+		return fmt.Errorf("failed to store downsampled history for %s: %w", subnetID, err)
+	}
+
+	return nil
+}
+
+// downsampleSamples averages time-ordered samples into one point per bucket,
+// stamped with the bucket start. Total IPs take the latest value in the bucket.
+func downsampleSamples(samples []*repository.UtilizationSample, bucket time.Duration) []*repository.UtilizationSample {
+	var result []*repository.UtilizationSample
+	var percentSum, allocatedSum float64
+	var count int
+
+	flush := func() {
+		last := result[len(result)-1]
+		last.Percent = percentSum / float64(count)
+		last.AllocatedIPs = int32(math.Round(allocatedSum / float64(count)))
+	}
+
+	for _, sample := range samples {
+		start := sample.RecordedAt.Truncate(bucket)
+		if len(result) == 0 || !result[len(result)-1].RecordedAt.Equal(start) {
+			if len(result) > 0 {
+				flush()
+			}
+			result = append(result, &repository.UtilizationSample{
+				SubnetID:   sample.SubnetID,
+				RecordedAt: start,
+			})
+			percentSum, allocatedSum, count = 0, 0, 0
+		}
+
+		percentSum += sample.Percent
+		allocatedSum += float64(sample.AllocatedIPs)
+		count++
+		result[len(result)-1].TotalIPs = sample.TotalIPs
+	}
+
+	if len(result) > 0 {
+		flush()
+	}
+
+	return result
+}
+
+// HistoryCompactor periodically downsamples utilization history in the background
+type HistoryCompactor struct {
+	service   *ServiceLayer
+	interval  time.Duration
+	retention HistoryRetention
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewHistoryCompactor creates a new utilization history compactor
+func NewHistoryCompactor(service *ServiceLayer, interval time.Duration, retention HistoryRetention) *HistoryCompactor {
+	return &HistoryCompactor{
+		service:   service,
+		interval:  interval,
+		retention: retention,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start runs the compaction loop until Stop is called
+func (c *HistoryCompactor) Start(ctx context.Context) {
+	log.Printf("Starting utilization history compaction with interval: %v", c.interval)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.service.CompactUtilizationHistory(ctx, c.retention, time.Now()); err != nil {
+					log.Printf("Utilization history compaction failed: %v", err)
+				}
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully stops the compaction loop
+func (c *HistoryCompactor) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+}
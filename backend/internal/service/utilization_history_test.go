@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bananaops/ipam-bananaops/internal/repository"
+)
+
+func TestCompactUtilizationHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	serviceLayer := NewServiceLayer(repo, NewGoIPAMService(), nil)
+	ctx := context.Background()
+
+	now := time.Date(2026, 3, 15, 12, 30, 0, 0, time.UTC)
+	retention := HistoryRetention{
+		MinuteRetention: 24 * time.Hour,
+		HourlyRetention: 30 * 24 * time.Hour,
+	}
+
+	record := func(at time.Time, percent float64) {
+		sample := &repository.UtilizationSample{
+			SubnetID:     "subnet-1",
+			Percent:      percent,
+			TotalIPs:     254,
+			AllocatedIPs: int32(percent * 2.54),
+			RecordedAt:   at,
+		}
+		if err := repo.CreateUtilizationSample(ctx, sample); err != nil {
+			t.Fatalf("Failed to record sample: %v", err)
+		}
+	}
+
+	// Every 15 minutes for 40 days, then every 10 seconds for the last 2 hours
+	start := now.Add(-40 * 24 * time.Hour)
+	for at := start; at.Before(now.Add(-2 * time.Hour)); at = at.Add(15 * time.Minute) {
+		record(at, 50)
+	}
+	for at := now.Add(-2 * time.Hour); at.Before(now); at = at.Add(10 * time.Second) {
+		// Alternate so each minute averages to 30%
+		if at.Second()%20 == 0 {
+			record(at, 20)
+		} else {
+			record(at, 40)
+		}
+	}
+
+	if err := serviceLayer.CompactUtilizationHistory(ctx, retention, now); err != nil {
+		t.Fatalf("CompactUtilizationHistory failed: %v", err)
+	}
+
+	samples, err := repo.ListUtilizationHistory(ctx, "subnet-1", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list history: %v", err)
+	}
+
+	minuteCutoff := now.Add(-retention.MinuteRetention).Truncate(time.Hour)
+	hourCutoff := now.Add(-retention.HourlyRetention).Truncate(24 * time.Hour)
+
+	seen := make(map[time.Time]bool)
+	var daily, hourly, minutely int
+	for i, sample := range samples {
+		if i > 0 && sample.RecordedAt.Before(samples[i-1].RecordedAt) {
+			t.Fatalf("History is not ordered at index %d", i)
+		}
+
+		var bucket time.Duration
+		switch {
+		case sample.RecordedAt.Before(hourCutoff):
+			bucket = 24 * time.Hour
+			daily++
+		case sample.RecordedAt.Before(minuteCutoff):
+			bucket = time.Hour
+			hourly++
+		default:
+			bucket = time.Minute
+			minutely++
+		}
+
+		if !sample.RecordedAt.Equal(sample.RecordedAt.Truncate(bucket)) {
+			t.Errorf("Sample at %v is not aligned to its %v bucket", sample.RecordedAt, bucket)
+		}
+		if seen[sample.RecordedAt] {
+			t.Errorf("Duplicate sample at %v", sample.RecordedAt)
+		}
+		seen[sample.RecordedAt] = true
+	}
+
+	// 40 days back from 12:30 reaches into the day containing start, 10 days
+	// before the day-aligned hour cutoff
+	if wantDaily := int(hourCutoff.Sub(start.Truncate(24*time.Hour)) / (24 * time.Hour)); daily != wantDaily {
+		t.Errorf("Expected %d daily points, got %d", wantDaily, daily)
+	}
+	if wantHourly := int(minuteCutoff.Sub(hourCutoff) / time.Hour); hourly != wantHourly {
+		t.Errorf("Expected %d hourly points, got %d", wantHourly, hourly)
+	}
+	// 22 hours of quarter-hour points plus 120 dense minutes
+	if wantMinutely := int(now.Add(-2*time.Hour).Sub(minuteCutoff)/(15*time.Minute)) + 120; minutely != wantMinutely {
+		t.Errorf("Expected %d per-minute points, got %d", wantMinutely, minutely)
+	}
+
+	// Dense samples collapse to their per-minute average
+	last := samples[len(samples)-1]
+	if !last.RecordedAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Expected last point at %v, got %v", now.Add(-time.Minute), last.RecordedAt)
+	}
+	if math.Abs(last.Percent-30) > 0.001 {
+		t.Errorf("Expected last minute to average 30%%, got %.3f", last.Percent)
+	}
+	if last.TotalIPs != 254 {
+		t.Errorf("Expected total IPs 254, got %d", last.TotalIPs)
+	}
+
+	// A second pass leaves already downsampled history untouched
+	if err := serviceLayer.CompactUtilizationHistory(ctx, retention, now); err != nil {
+		t.Fatalf("Second CompactUtilizationHistory failed: %v", err)
+	}
+	again, err := repo.ListUtilizationHistory(ctx, "subnet-1", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list history: %v", err)
+	}
+	if len(again) != len(samples) {
+		t.Errorf("Expected %d samples after second pass, got %d", len(samples), len(again))
+	}
+}
+
+func TestRecordUtilizationHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	repo, err := repository.NewSQLiteRepository(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	clock := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	serviceLayer := NewServiceLayerWithOptions(repo, NewGoIPAMService(), nil, ServiceOptions{
+		Clock: func() time.Time { return clock },
+	})
+	ctx := context.Background()
+
+	subnet := &repository.Subnet{
+		ID:           "subnet-1",
+		CIDR:         "10.70.0.0/24",
+		Name:         "subnet-1",
+		Location:     "datacenter-1",
+		LocationType: "datacenter",
+	}
+	if err := serviceLayer.CreateSubnetRepository(ctx, subnet); err != nil {
+		t.Fatalf("Failed to create subnet: %v", err)
+	}
+
+	// Each allocation changes utilization and records one sample
+	for i := 0; i < 3; i++ {
+		clock = clock.Add(time.Minute)
+		if _, err := serviceLayer.AllocateNextIP(ctx, "subnet-1", "", ""); err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+	}
+
+	samples, err := serviceLayer.ListUtilizationHistory(ctx, "subnet-1", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ListUtilizationHistory failed: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(samples))
+	}
+	for i, sample := range samples {
+		wantAt := time.Date(2026, 3, 15, 12, i+1, 0, 0, time.UTC)
+		if !sample.RecordedAt.Equal(wantAt) {
+			t.Errorf("Sample %d: expected recorded at %v, got %v", i, wantAt, sample.RecordedAt)
+		}
+		if sample.AllocatedIPs != int32(i+1) || sample.TotalIPs != 254 {
+			t.Errorf("Sample %d: expected %d of 254 allocated, got %d of %d", i, i+1, sample.AllocatedIPs, sample.TotalIPs)
+		}
+		if want := float64(i+1) / 254 * 100; math.Abs(sample.Percent-want) > 0.001 {
+			t.Errorf("Sample %d: expected %.3f%%, got %.3f%%", i, want, sample.Percent)
+		}
+	}
+
+	t.Run("range", func(t *testing.T) {
+		from := time.Date(2026, 3, 15, 12, 2, 0, 0, time.UTC)
+		samples, err := serviceLayer.ListUtilizationHistory(ctx, "subnet-1", from, from.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("ListUtilizationHistory failed: %v", err)
+		}
+		if len(samples) != 1 || samples[0].AllocatedIPs != 2 {
+			t.Errorf("Expected only the second sample, got %+v", samples)
+		}
+	})
+
+	t.Run("retention cap", func(t *testing.T) {
+		serviceLayer.options.MaxUtilizationSamples = 2
+		defer func() { serviceLayer.options.MaxUtilizationSamples = 0 }()
+
+		clock = clock.Add(time.Minute)
+		if _, err := serviceLayer.AllocateNextIP(ctx, "subnet-1", "", ""); err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+
+		samples, err := serviceLayer.ListUtilizationHistory(ctx, "subnet-1", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("ListUtilizationHistory failed: %v", err)
+		}
+		if len(samples) != 2 || samples[0].AllocatedIPs != 3 || samples[1].AllocatedIPs != 4 {
+			t.Errorf("Expected the two newest samples to remain, got %+v", samples)
+		}
+	})
+
+	t.Run("unknown subnet", func(t *testing.T) {
+		if _, err := serviceLayer.ListUtilizationHistory(ctx, "missing", time.Time{}, time.Time{}); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}